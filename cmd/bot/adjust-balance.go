@@ -0,0 +1,87 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+
+	"betting-discord-bot/internal/permissions"
+	"betting-discord-bot/internal/wallet"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// maxAdjustment bounds a single adjustment of a balance.
+const maxAdjustment = 1_000_000_000
+
+// handleAdjustBalanceCommand gives points to or takes points from a member.
+// Every adjustment is recorded in the ledger against the house.
+func (bot *Bot) handleAdjustBalanceCommand(ctx context.Context, i *discordgo.InteractionCreate) {
+	if bot.doesNotHavePermission(ctx, i, permissions.AdjustBalance, "") {
+		return
+	}
+
+	var discordID, memo string
+	var points int64
+	for _, option := range i.ApplicationCommandData().Options {
+		switch option.Name {
+		case "user":
+			discordID = option.UserValue(nil).ID
+		case "points":
+			points = option.IntValue()
+		case "reason":
+			memo = strings.TrimSpace(option.StringValue())
+		}
+	}
+
+	if points == 0 || points < -maxAdjustment || points > maxAdjustment {
+		bot.sendInteractionResponse(ctx, i, fmt.Sprintf("The adjustment must be between -%d and %d points, and not 0.", maxAdjustment, maxAdjustment))
+		return
+	}
+
+	user, err := bot.getOrCreateUser(ctx, discordID)
+	if err != nil {
+		log.Printf("Error getting user: %v", err)
+		bot.sendInteractionResponse(ctx, i, "The balance could not be adjusted. Please try again later.")
+		return
+	}
+
+	if _, err := bot.WalletService.OpenWallet(ctx, i.GuildID, user.GetID(), bot.guildSettings(ctx, i.GuildID).StartingBalance); err != nil {
+		log.Printf("Error opening wallet: %v", err)
+		bot.sendInteractionResponse(ctx, i, "The balance could not be adjusted. Please try again later.")
+		return
+	}
+
+	reason := wallet.Reason{Kind: wallet.Adjustment, Memo: memo}
+	if points > 0 {
+		err = bot.WalletService.Credit(ctx, i.GuildID, user.GetID(), points, reason)
+	} else {
+		err = bot.WalletService.Debit(ctx, i.GuildID, user.GetID(), -points, reason)
+	}
+	if err != nil {
+		var insufficientErr *wallet.InsufficientBalanceError
+		if errors.As(err, &insufficientErr) {
+			bot.sendInteractionResponse(ctx, i, fmt.Sprintf("<@%s> only has %d points, so %d cannot be taken.", discordID, insufficientErr.Balance, insufficientErr.Amount))
+			return
+		}
+		log.Printf("Error adjusting balance: %v", err)
+		bot.sendInteractionResponse(ctx, i, "The balance could not be adjusted. Please try again later.")
+		return
+	}
+
+	log.Printf("User %s adjusted the balance of %s by %d", interactionUser(i).ID, discordID, points)
+
+	confirmation := fmt.Sprintf("Gave <@%s> %d points.", discordID, points)
+	if points < 0 {
+		confirmation = fmt.Sprintf("Took %d points from <@%s>.", -points, discordID)
+	}
+	if userWallet, err := bot.WalletService.GetWallet(ctx, i.GuildID, user.GetID()); err == nil {
+		confirmation += fmt.Sprintf(" They now have %d points.", userWallet.GetBalance())
+	} else {
+		log.Printf("Error getting wallet: %v", err)
+	}
+
+	bot.sendInteractionResponse(ctx, i, confirmation)
+}
@@ -1,28 +1,55 @@
 package main
 
 import (
+	"sync"
+
 	"betting-discord-bot/internal/bets"
+	"betting-discord-bot/internal/discord"
+	"betting-discord-bot/internal/permissions"
 	"betting-discord-bot/internal/polls"
+	"betting-discord-bot/internal/settings"
+	"betting-discord-bot/internal/storage"
 	"betting-discord-bot/internal/users"
+	"betting-discord-bot/internal/wallet"
 	"github.com/bwmarrin/discordgo"
 )
 
 type Bot struct {
 	DiscordSession *discordgo.Session
+	Discord        *discord.Client
 	PollService    polls.PollService
 	BetService     bets.BetService
 	UserService    users.UserService
+	WalletService  wallet.WalletService
+	Settings       settings.SettingsService
+	Permissions    permissions.PermissionService
+	PollMessages   PollMessageRepository
+	Scheduler      *pollScheduler
 	AppID          string
 	GuildID        string
+	// UnitOfWork makes changes that span several services atomic, such as
+	// creating a user on their first bet.
+	UnitOfWork storage.UnitOfWork
+	// pendingReplies holds the reply channel of each interaction awaiting an
+	// answer over the HTTP endpoint, keyed by interaction ID.
+	pendingReplies sync.Map
 }
 
-func NewBot(session *discordgo.Session, pollService polls.PollService, betService bets.BetService, userService users.UserService, appID, guildID string) *Bot {
-	return &Bot{
+func NewBot(session *discordgo.Session, discordClient *discord.Client, pollService polls.PollService, betService bets.BetService, userService users.UserService, walletService wallet.WalletService, settingsService settings.SettingsService, permissionService permissions.PermissionService, pollMessages PollMessageRepository, unitOfWork storage.UnitOfWork, appID, guildID string) *Bot {
+	bot := &Bot{
 		DiscordSession: session,
+		Discord:        discordClient,
 		PollService:    pollService,
 		BetService:     betService,
 		UserService:    userService,
+		WalletService:  walletService,
+		Settings:       settingsService,
+		Permissions:    permissionService,
+		PollMessages:   pollMessages,
+		UnitOfWork:     unitOfWork,
 		AppID:          appID,
 		GuildID:        guildID,
 	}
-}
\ No newline at end of file
+	bot.Scheduler = newPollScheduler(bot.closePollAtDeadline)
+	return bot
+}
@@ -3,17 +3,213 @@ package main
 import (
 	"log"
 
+	"betting-discord-bot/internal/settings"
+
 	"github.com/bwmarrin/discordgo"
 )
 
 func (bot *Bot) RegisterCommands() error {
+	manageGuild := int64(discordgo.PermissionManageGuild)
+	minStartingBalance := float64(0)
+	minAdjustment := float64(-maxAdjustment)
+
 	commands := []*discordgo.ApplicationCommand{
 		{
 			Name:        "create-poll",
 			Description: "Create a new poll",
 		},
+		{
+			Name:        "leaderboard",
+			Description: "Show the top bettors",
+			Options: []*discordgo.ApplicationCommandOption{
+				{
+					Type:        discordgo.ApplicationCommandOptionString,
+					Name:        "sort",
+					Description: "What to rank bettors by",
+					Choices: []*discordgo.ApplicationCommandOptionChoice{
+						{Name: "Wins", Value: "wins"},
+						{Name: "Win rate", Value: "win-rate"},
+						{Name: "Points", Value: "points"},
+					},
+				},
+			},
+		},
+		{
+			Name:        "mybets",
+			Description: "Show your bets",
+			Options: []*discordgo.ApplicationCommandOption{
+				{
+					Type:        discordgo.ApplicationCommandOptionString,
+					Name:        "show",
+					Description: "Which bets to show",
+					Choices: []*discordgo.ApplicationCommandOptionChoice{
+						{Name: "All", Value: "all"},
+						{Name: "Open", Value: "open"},
+						{Name: "Settled", Value: "settled"},
+					},
+				},
+			},
+		},
+		{
+			Name:        "stats",
+			Description: "Show a member's betting profile",
+			Options: []*discordgo.ApplicationCommandOption{
+				{
+					Type:        discordgo.ApplicationCommandOptionUser,
+					Name:        "user",
+					Description: "The member to show, or yourself if left out",
+				},
+			},
+		},
+		{
+			Name:        "export-my-data",
+			Description: "Get a file of everything the bot keeps about you",
+		},
+		{
+			Name:        "polls",
+			Description: "List open and recently closed polls",
+			Options: []*discordgo.ApplicationCommandOption{
+				{
+					Type:        discordgo.ApplicationCommandOptionString,
+					Name:        "status",
+					Description: "Which polls to list",
+					Choices: []*discordgo.ApplicationCommandOptionChoice{
+						{Name: "Open and recently closed", Value: "all"},
+						{Name: "Open", Value: "open"},
+						{Name: "Recently closed", Value: "closed"},
+					},
+				},
+			},
+		},
+		{
+			Name:        "adjust-balance",
+			Description: "Give points to or take points from a member",
+			Options: []*discordgo.ApplicationCommandOption{
+				{
+					Type:        discordgo.ApplicationCommandOptionUser,
+					Name:        "user",
+					Description: "The member whose balance to adjust",
+					Required:    true,
+				},
+				{
+					Type:        discordgo.ApplicationCommandOptionInteger,
+					Name:        "points",
+					Description: "The points to give, or to take if negative",
+					Required:    true,
+					MinValue:    &minAdjustment,
+					MaxValue:    maxAdjustment,
+				},
+				{
+					Type:        discordgo.ApplicationCommandOptionString,
+					Name:        "reason",
+					Description: "Why the balance is adjusted, kept in the ledger",
+					MaxLength:   200,
+				},
+			},
+		},
+		{
+			Name:        "ledger",
+			Description: "Show every point movement of a member in this server",
+			Options: []*discordgo.ApplicationCommandOption{
+				{
+					Type:        discordgo.ApplicationCommandOptionUser,
+					Name:        "user",
+					Description: "The member whose ledger to show",
+					Required:    true,
+				},
+			},
+		},
+		{
+			Name:                     "config",
+			Description:              "Show or change the bot's settings for this server",
+			DefaultMemberPermissions: &manageGuild,
+			Options: []*discordgo.ApplicationCommandOption{
+				{
+					Type:        discordgo.ApplicationCommandOptionSubCommand,
+					Name:        "show",
+					Description: "Show the current settings",
+				},
+				{
+					Type:        discordgo.ApplicationCommandOptionSubCommand,
+					Name:        "add-moderator-role",
+					Description: "Let members with a role manage polls",
+					Options: []*discordgo.ApplicationCommandOption{
+						{Type: discordgo.ApplicationCommandOptionRole, Name: "role", Description: "The role to add", Required: true},
+					},
+				},
+				{
+					Type:        discordgo.ApplicationCommandOptionSubCommand,
+					Name:        "remove-moderator-role",
+					Description: "Stop members with a role from managing polls",
+					Options: []*discordgo.ApplicationCommandOption{
+						{Type: discordgo.ApplicationCommandOptionRole, Name: "role", Description: "The role to remove", Required: true},
+					},
+				},
+				{
+					Type:        discordgo.ApplicationCommandOptionSubCommand,
+					Name:        "poll-duration",
+					Description: "Close betting after this long when a poll has no close time",
+					Options: []*discordgo.ApplicationCommandOption{
+						{Type: discordgo.ApplicationCommandOptionString, Name: "duration", Description: "Such as 90m, 2h or 1h30m, or none", Required: true},
+					},
+				},
+				{
+					Type:        discordgo.ApplicationCommandOptionSubCommand,
+					Name:        "accent-colour",
+					Description: "Set the colour of the bar beside the bot's messages",
+					Options: []*discordgo.ApplicationCommandOption{
+						{Type: discordgo.ApplicationCommandOptionString, Name: "colour", Description: "A hex colour such as #e32458", Required: true},
+					},
+				},
+				{
+					Type:        discordgo.ApplicationCommandOptionSubCommand,
+					Name:        "announcement-channel",
+					Description: "Announce closed polls and outcomes in a channel",
+					Options: []*discordgo.ApplicationCommandOption{
+						{
+							Type:         discordgo.ApplicationCommandOptionChannel,
+							Name:         "channel",
+							Description:  "Leave empty to announce in the channel of each poll",
+							ChannelTypes: []discordgo.ChannelType{discordgo.ChannelTypeGuildText, discordgo.ChannelTypeGuildNews},
+						},
+					},
+				},
+				{
+					Type:        discordgo.ApplicationCommandOptionSubCommand,
+					Name:        "starting-balance",
+					Description: "Set the points new wallets open with",
+					Options: []*discordgo.ApplicationCommandOption{
+						{Type: discordgo.ApplicationCommandOptionInteger, Name: "points", Description: "The starting balance", Required: true, MinValue: &minStartingBalance, MaxValue: settings.MaxStartingBalance},
+					},
+				},
+				{
+					Type:        discordgo.ApplicationCommandOptionSubCommand,
+					Name:        "locale",
+					Description: "Set the preferred locale (messages are still in English for now)",
+					Options: []*discordgo.ApplicationCommandOption{
+						{Type: discordgo.ApplicationCommandOptionString, Name: "locale", Description: "A Discord locale such as en-US or fr", Required: true},
+					},
+				},
+				{
+					Type:        discordgo.ApplicationCommandOptionSubCommand,
+					Name:        "stakes",
+					Description: "Turn wagering points on bets on or off",
+					Options: []*discordgo.ApplicationCommandOption{
+						{Type: discordgo.ApplicationCommandOptionBoolean, Name: "enabled", Description: "Whether bets take a stake", Required: true},
+					},
+				},
+				permissionsConfigGroup(),
+			},
+		},
+	}
+
+	// Polls, bets and leaderboards belong to a guild, so no command works in DMs.
+	guildOnly := []discordgo.InteractionContextType{discordgo.InteractionContextGuild}
+	for _, command := range commands {
+		command.Contexts = &guildOnly
 	}
 
+	// Commands are registered globally unless the bot is pinned to a guild.
 	_, err := bot.DiscordSession.ApplicationCommandBulkOverwrite(bot.AppID, bot.GuildID, commands)
 	if err != nil {
 		log.Printf("Error overwriting commands: %v", err)
@@ -22,4 +218,4 @@ func (bot *Bot) RegisterCommands() error {
 
 	log.Println("Commands successfully registered.")
 	return nil
-}
\ No newline at end of file
+}
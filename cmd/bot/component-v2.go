@@ -10,12 +10,21 @@ Need this flag to enable components v2 for the specific message
 
 */
 
+import "fmt"
+
 const IsComponentsV2 = 1 << 15
 const MessageIsEphemeral = 1 << 6
 
 type MessageSend struct {
-	Flags      int           `json:"flags"`
-	Components []interface{} `json:"components"`
+	Flags           int              `json:"flags"`
+	Components      []interface{}    `json:"components"`
+	AllowedMentions *AllowedMentions `json:"allowed_mentions,omitempty"`
+}
+
+// AllowedMentions limits who a message pings. An empty Parse list renders
+// mentions without notifying anyone.
+type AllowedMentions struct {
+	Parse []string `json:"parse"`
 }
 
 type InteractionCallbackType int
@@ -24,6 +33,7 @@ const (
 	ChannelMessageWithSource         InteractionCallbackType = 4
 	DeferredChannelMessageWithSource InteractionCallbackType = 5
 	DeferredUpdateMessage            InteractionCallbackType = 6
+	UpdateMessage                    InteractionCallbackType = 7
 	Modal                            InteractionCallbackType = 9
 )
 
@@ -37,6 +47,7 @@ func NewInteractionResponse(responseType InteractionCallbackType, data MessageSe
 	case ChannelMessageWithSource:
 	case DeferredChannelMessageWithSource:
 	case DeferredUpdateMessage:
+	case UpdateMessage:
 	case Modal:
 		// Nothing
 	default:
@@ -78,6 +89,7 @@ type Button struct {
 	Style    int    `json:"style"`
 	Label    string `json:"label"`
 	CustomID string `json:"custom_id"`
+	Disabled bool   `json:"disabled,omitempty"`
 }
 
 func NewButton(style int, label string, customID string) *Button {
@@ -89,6 +101,17 @@ func NewButton(style int, label string, customID string) *Button {
 	}
 }
 
+// newPaginationRow builds Previous and Next buttons whose custom IDs are the
+// prefix followed by the page they lead to.
+func newPaginationRow(customIDPrefix string, page int, pageCount int) *ActionRow {
+	previousButton := NewButton(2, "Previous", fmt.Sprintf("%s:%d", customIDPrefix, page-1))
+	previousButton.Disabled = page == 0
+	nextButton := NewButton(2, "Next", fmt.Sprintf("%s:%d", customIDPrefix, page+1))
+	nextButton.Disabled = page+1 >= pageCount
+
+	return NewActionRow([]interface{}{previousButton, nextButton})
+}
+
 type StringSelect struct {
 	Type        int           `json:"type"`
 	Options     []interface{} `json:"options"`
@@ -96,6 +119,7 @@ type StringSelect struct {
 	MinValues   int           `json:"min_values"`
 	MaxValues   int           `json:"max_values"`
 	CustomID    string        `json:"custom_id"`
+	Disabled    bool          `json:"disabled,omitempty"`
 }
 
 func NewStringSelect(placeholder string, minValues, maxValues int, customID string, options []interface{}) *StringSelect {
@@ -1,53 +1,146 @@
 package main
 
 import (
+	"crypto/ed25519"
 	"encoding/hex"
 	"fmt"
+	"math"
 	"os"
+	"strconv"
+
+	"betting-discord-bot/internal/discord"
+)
+
+// defaultStartingBalance is the number of points a wallet opens with when
+// STARTING_BALANCE is not set.
+const defaultStartingBalance = 1000
+
+// Interaction modes select how Discord delivers interactions to the bot.
+const (
+	// GatewayMode receives interactions over the gateway websocket.
+	GatewayMode = "gateway"
+	// HTTPMode serves Discord's interactions endpoint over HTTP instead.
+	HTTPMode = "http"
 )
 
+// defaultListenAddr is where the interactions endpoint listens when LISTEN_ADDR is not set.
+const defaultListenAddr = ":8080"
+
 type Config struct {
-	GuildID       string
-	Token         string
-	AppID         string
-	DBPath        string
-	EncryptionKey string
+	// GuildID pins the commands to a single guild, where they are available
+	// immediately. Commands are registered globally when it is empty.
+	GuildID         string
+	Token           string
+	AppID           string
+	DBPath          string
+	EncryptionKey   string
+	StartingBalance int64
+	// HouseCut is the share of each settled pool kept by the house, in basis points.
+	HouseCut int64
+	// DiscordAPIURL is the base URL of the Discord REST API. It only needs
+	// changing to point the bot at a fake server.
+	DiscordAPIURL string
+	// InteractionsMode is GatewayMode or HTTPMode.
+	InteractionsMode string
+	// PublicKey is the hex encoded Ed25519 public key of the application. It
+	// is required in HTTP mode to verify that interactions come from Discord.
+	PublicKey  string
+	ListenAddr string
 }
 
 func LoadConfig() (*Config, error) {
 	cfg := &Config{
-		GuildID:       os.Getenv("GUILD_ID"),
-		Token:         os.Getenv("TOKEN"),
-		AppID:         os.Getenv("APP_ID"),
-		DBPath:        os.Getenv("DB_PATH"),
-		EncryptionKey: os.Getenv("ENCRYPTION_KEY"),
+		GuildID:          os.Getenv("GUILD_ID"),
+		Token:            os.Getenv("TOKEN"),
+		AppID:            os.Getenv("APP_ID"),
+		DBPath:           os.Getenv("DB_PATH"),
+		EncryptionKey:    os.Getenv("ENCRYPTION_KEY"),
+		StartingBalance:  defaultStartingBalance,
+		DiscordAPIURL:    os.Getenv("DISCORD_API_URL"),
+		InteractionsMode: os.Getenv("INTERACTIONS_MODE"),
+		PublicKey:        os.Getenv("PUBLIC_KEY"),
+		ListenAddr:       os.Getenv("LISTEN_ADDR"),
 	}
 
-	if cfg.GuildID == "" {
-		return nil, fmt.Errorf("GUILD_ID environment variable is not set")
-	}
 	if cfg.Token == "" {
 		return nil, fmt.Errorf("TOKEN environment variable is not set")
 	}
 	if cfg.AppID == "" {
 		return nil, fmt.Errorf("APP_ID environment variable is not set")
 	}
+	if err := validateDatabaseConfig(cfg); err != nil {
+		return nil, err
+	}
+
+	if rawStartingBalance := os.Getenv("STARTING_BALANCE"); rawStartingBalance != "" {
+		startingBalance, err := strconv.ParseInt(rawStartingBalance, 10, 64)
+		if err != nil || startingBalance < 0 {
+			return nil, fmt.Errorf("STARTING_BALANCE must be a non-negative whole number, got %q", rawStartingBalance)
+		}
+		cfg.StartingBalance = startingBalance
+	}
+
+	if rawHouseCut := os.Getenv("HOUSE_CUT_PERCENT"); rawHouseCut != "" {
+		houseCutPercent, err := strconv.ParseFloat(rawHouseCut, 64)
+		if err != nil || houseCutPercent < 0 || houseCutPercent > 100 {
+			return nil, fmt.Errorf("HOUSE_CUT_PERCENT must be a percentage between 0 and 100, got %q", rawHouseCut)
+		}
+		cfg.HouseCut = int64(math.Round(houseCutPercent * 100))
+	}
+
+	if cfg.DiscordAPIURL == "" {
+		cfg.DiscordAPIURL = discord.DefaultBaseURL
+	}
+
+	switch cfg.InteractionsMode {
+	case "":
+		cfg.InteractionsMode = GatewayMode
+	case GatewayMode:
+	case HTTPMode:
+		publicKey, err := hex.DecodeString(cfg.PublicKey)
+		if err != nil || len(publicKey) != ed25519.PublicKeySize {
+			return nil, fmt.Errorf("PUBLIC_KEY must be the application's %d byte public key in hex when INTERACTIONS_MODE is %q", ed25519.PublicKeySize, HTTPMode)
+		}
+		if cfg.ListenAddr == "" {
+			cfg.ListenAddr = defaultListenAddr
+		}
+	default:
+		return nil, fmt.Errorf("INTERACTIONS_MODE must be %q or %q, got %q", GatewayMode, HTTPMode, cfg.InteractionsMode)
+	}
+
+	return cfg, nil
+}
+
+// LoadDatabaseConfig loads only what is needed to open the database, for
+// commands such as migrate that do not connect to Discord.
+func LoadDatabaseConfig() (*Config, error) {
+	cfg := &Config{
+		DBPath:        os.Getenv("DB_PATH"),
+		EncryptionKey: os.Getenv("ENCRYPTION_KEY"),
+	}
+
+	if err := validateDatabaseConfig(cfg); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+func validateDatabaseConfig(cfg *Config) error {
 	if cfg.DBPath == "" {
-		return nil, fmt.Errorf("DB_PATH environment variable is not set")
+		return fmt.Errorf("DB_PATH environment variable is not set")
 	}
 
 	if cfg.EncryptionKey == "" {
-		return nil, fmt.Errorf("ENCRYPTION_KEY environment variable is not set")
+		return fmt.Errorf("ENCRYPTION_KEY environment variable is not set")
 	}
 
 	// Validate Encryption Key
 	keyBytes, err := hex.DecodeString(cfg.EncryptionKey)
 	if err != nil {
-		return nil, fmt.Errorf("ENCRYPTION_KEY must be a valid hex string: %w", err)
+		return fmt.Errorf("ENCRYPTION_KEY must be a valid hex string: %w", err)
 	}
 	if len(keyBytes) != 32 {
-		return nil, fmt.Errorf("ENCRYPTION_KEY must be exactly 32 bytes (64 hex characters), got %d bytes", len(keyBytes))
+		return fmt.Errorf("ENCRYPTION_KEY must be exactly 32 bytes (64 hex characters), got %d bytes", len(keyBytes))
 	}
-
-	return cfg, nil
+	return nil
 }
@@ -73,6 +73,64 @@ func TestLoadConfig_EncryptionKey(t *testing.T) {
 			},
 			wantErr: true,
 		},
+		{
+			name: "Without Guild ID",
+			env: map[string]string{
+				"TOKEN":          "abc",
+				"APP_ID":         "456",
+				"DB_PATH":        "test.db",
+				"ENCRYPTION_KEY": "000102030405060708090a0b0c0d0e0f101112131415161718191a1b1c1d1e1f",
+			},
+			wantErr: false,
+		},
+		{
+			name: "Valid Starting Balance",
+			env: map[string]string{
+				"GUILD_ID":         "123",
+				"TOKEN":            "abc",
+				"APP_ID":           "456",
+				"DB_PATH":          "test.db",
+				"ENCRYPTION_KEY":   "000102030405060708090a0b0c0d0e0f101112131415161718191a1b1c1d1e1f",
+				"STARTING_BALANCE": "500",
+			},
+			wantErr: false,
+		},
+		{
+			name: "Invalid Starting Balance",
+			env: map[string]string{
+				"GUILD_ID":         "123",
+				"TOKEN":            "abc",
+				"APP_ID":           "456",
+				"DB_PATH":          "test.db",
+				"ENCRYPTION_KEY":   "000102030405060708090a0b0c0d0e0f101112131415161718191a1b1c1d1e1f",
+				"STARTING_BALANCE": "-5",
+			},
+			wantErr: true,
+		},
+		{
+			name: "Valid House Cut",
+			env: map[string]string{
+				"GUILD_ID":          "123",
+				"TOKEN":             "abc",
+				"APP_ID":            "456",
+				"DB_PATH":           "test.db",
+				"ENCRYPTION_KEY":    "000102030405060708090a0b0c0d0e0f101112131415161718191a1b1c1d1e1f",
+				"HOUSE_CUT_PERCENT": "2.5",
+			},
+			wantErr: false,
+		},
+		{
+			name: "House Cut Above 100 Percent",
+			env: map[string]string{
+				"GUILD_ID":          "123",
+				"TOKEN":             "abc",
+				"APP_ID":            "456",
+				"DB_PATH":           "test.db",
+				"ENCRYPTION_KEY":    "000102030405060708090a0b0c0d0e0f101112131415161718191a1b1c1d1e1f",
+				"HOUSE_CUT_PERCENT": "150",
+			},
+			wantErr: true,
+		},
 	}
 
 	for _, tt := range tests {
@@ -85,3 +143,96 @@ func TestLoadConfig_EncryptionKey(t *testing.T) {
 		})
 	}
 }
+
+func TestLoadConfig_DiscordAPIURL(t *testing.T) {
+	baseEnv := map[string]string{
+		"GUILD_ID":       "123",
+		"TOKEN":          "abc",
+		"APP_ID":         "456",
+		"DB_PATH":        "test.db",
+		"ENCRYPTION_KEY": "000102030405060708090a0b0c0d0e0f101112131415161718191a1b1c1d1e1f",
+	}
+
+	tests := []struct {
+		name   string
+		apiURL string
+		want   string
+	}{
+		{name: "Defaults To Discord", apiURL: "", want: "https://discord.com/api/v10"},
+		{name: "Fake Server", apiURL: "http://127.0.0.1:8080", want: "http://127.0.0.1:8080"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			os.Clearenv()
+			for k, v := range baseEnv {
+				os.Setenv(k, v)
+			}
+			if tt.apiURL != "" {
+				os.Setenv("DISCORD_API_URL", tt.apiURL)
+			}
+
+			cfg, err := LoadConfig()
+			if err != nil {
+				t.Fatalf("LoadConfig() returned an unexpected error: %v", err)
+			}
+			if cfg.DiscordAPIURL != tt.want {
+				t.Errorf("LoadConfig().DiscordAPIURL = %q, want %q", cfg.DiscordAPIURL, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoadConfig_InteractionsMode(t *testing.T) {
+	const publicKey = "a1b2c3d4e5f60718293a4b5c6d7e8f90a1b2c3d4e5f60718293a4b5c6d7e8f90"
+
+	tests := []struct {
+		name       string
+		env        map[string]string
+		wantErr    bool
+		wantMode   string
+		wantListen string
+	}{
+		{name: "Defaults To Gateway", env: map[string]string{}, wantMode: GatewayMode},
+		{
+			name:       "HTTP With Public Key",
+			env:        map[string]string{"INTERACTIONS_MODE": "http", "PUBLIC_KEY": publicKey},
+			wantMode:   HTTPMode,
+			wantListen: ":8080",
+		},
+		{
+			name:       "HTTP With Listen Address",
+			env:        map[string]string{"INTERACTIONS_MODE": "http", "PUBLIC_KEY": publicKey, "LISTEN_ADDR": "127.0.0.1:9000"},
+			wantMode:   HTTPMode,
+			wantListen: "127.0.0.1:9000",
+		},
+		{name: "HTTP Without Public Key", env: map[string]string{"INTERACTIONS_MODE": "http"}, wantErr: true},
+		{name: "HTTP With Short Public Key", env: map[string]string{"INTERACTIONS_MODE": "http", "PUBLIC_KEY": "deadbeef"}, wantErr: true},
+		{name: "Unknown Mode", env: map[string]string{"INTERACTIONS_MODE": "webhook"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			os.Clearenv()
+			os.Setenv("GUILD_ID", "123")
+			os.Setenv("TOKEN", "abc")
+			os.Setenv("APP_ID", "456")
+			os.Setenv("DB_PATH", "test.db")
+			os.Setenv("ENCRYPTION_KEY", "000102030405060708090a0b0c0d0e0f101112131415161718191a1b1c1d1e1f")
+			for k, v := range tt.env {
+				os.Setenv(k, v)
+			}
+
+			cfg, err := LoadConfig()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("LoadConfig() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if cfg.InteractionsMode != tt.wantMode || cfg.ListenAddr != tt.wantListen {
+				t.Errorf("LoadConfig() mode = %q, listen = %q, want %q, %q", cfg.InteractionsMode, cfg.ListenAddr, tt.wantMode, tt.wantListen)
+			}
+		})
+	}
+}
@@ -0,0 +1,554 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"betting-discord-bot/internal/polls"
+	"betting-discord-bot/internal/users"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// createTestPoll runs /create-poll as the moderator and submits the poll modal.
+func createTestPoll(t *testing.T, harness *testHarness, moderatorID string, options string) polls.Poll {
+	t.Helper()
+
+	modal := harness.response(harness.runCommand(moderatorID, "create-poll"))
+	if modal["type"] != float64(discordgo.InteractionResponseModal) || !containsCustomID(modal, "poll_modal") {
+		t.Fatalf("Expected /create-poll to open the poll modal, but got %v", modal)
+	}
+
+	harness.submitModal(moderatorID, "poll_modal", map[string]string{
+		"title":   "Who wins the final?",
+		"options": options,
+	})
+
+	openPolls, err := harness.bot.PollService.GetOpenPolls(t.Context(), testGuildID)
+	if err != nil || len(openPolls) != 1 {
+		t.Fatalf("Expected one open poll, but got %d (%v)", len(openPolls), err)
+	}
+	return openPolls[0]
+}
+
+func containsCustomID(message map[string]any, customID string) bool {
+	data, _ := message["data"].(map[string]any)
+	return data != nil && data["custom_id"] == customID
+}
+
+// placeTestBet presses the bet button and submits the stake modal as the user.
+func placeTestBet(t *testing.T, harness *testHarness, userID string, pollID string, optionIndex int, stake int64) {
+	t.Helper()
+
+	stakeModalID := fmt.Sprintf("stake_modal:%s:%d", pollID, optionIndex)
+	modal := harness.response(harness.press(userID, fmt.Sprintf("bet:%s:%d", pollID, optionIndex)))
+	if !containsCustomID(modal, stakeModalID) {
+		t.Fatalf("Expected the bet button to open %s, but got %v", stakeModalID, modal)
+	}
+
+	confirmation := harness.response(harness.submitModal(userID, stakeModalID, map[string]string{"stake": fmt.Sprint(stake)}))
+	if !containsText(confirmation, fmt.Sprintf("Bet of %d points submitted", stake)) {
+		t.Fatalf("Expected the bet of %s to be confirmed, but got %v", userID, confirmation)
+	}
+}
+
+func (harness *testHarness) balanceOf(discordID string) int64 {
+	harness.t.Helper()
+	user, err := harness.bot.resolveDiscordUser(harness.t.Context(), discordID)
+	if err != nil {
+		harness.t.Fatalf("Failed to resolve user %s: %v", discordID, err)
+	}
+	userWallet, err := harness.bot.WalletService.GetWallet(harness.t.Context(), harness.guildID, user.GetID())
+	if err != nil {
+		harness.t.Fatalf("Failed to get wallet of %s: %v", discordID, err)
+	}
+	return userWallet.GetBalance()
+}
+
+// lastPollMessageEdit returns the most recent edit of the poll message.
+func (harness *testHarness) lastPollMessageEdit(pollID string) map[string]any {
+	harness.t.Helper()
+	pollMessage, err := harness.bot.PollMessages.GetByPollID(harness.t.Context(), pollID)
+	if err != nil {
+		harness.t.Fatalf("Failed to get poll message: %v", err)
+	}
+
+	edits := harness.discord.Calls(http.MethodPatch, fmt.Sprintf("/channels/%s/messages/%s", pollMessage.ChannelID, pollMessage.MessageID))
+	if len(edits) == 0 {
+		harness.t.Fatal("Expected the poll message to be edited, but it never was")
+	}
+	return edits[len(edits)-1].Body
+}
+
+func TestPollLifecycleEndToEnd(t *testing.T) {
+	t.Parallel()
+	harness := newTestHarness(t)
+	harness.moderators["moderator"] = true
+
+	poll := createTestPoll(t, harness, "moderator", "Red\nBlue")
+	pollID := poll.GetID()
+
+	posted := harness.discord.Calls(http.MethodPost, "/channels/"+testChannelID+"/messages")
+	if len(posted) != 1 || !containsText(posted[0].Body, "# Who wins the final?") {
+		t.Fatalf("Expected the poll to be posted in the channel, but got %v", posted)
+	}
+	if _, err := harness.bot.PollMessages.GetByPollID(t.Context(), pollID); err != nil {
+		t.Fatalf("Expected the poll message to be remembered, but got %v", err)
+	}
+
+	placeTestBet(t, harness, "alice", pollID, 0, 100)
+	placeTestBet(t, harness, "bob", pollID, 1, 50)
+
+	if refused := harness.response(harness.press("carol", fmt.Sprintf("bet:%s:9", pollID))); !containsText(refused, "That is not one of the poll's options.") {
+		t.Errorf("Expected a bet on an option the poll does not have to be refused, but got %v", refused)
+	}
+
+	if balance := harness.balanceOf("alice"); balance != testStartingPoints-100 {
+		t.Errorf("Expected alice to have %d points after betting, but got %d", testStartingPoints-100, balance)
+	}
+	if edit := harness.lastPollMessageEdit(pollID); !containsText(edit, "**Blue** · 1 bet · 50 points") {
+		t.Errorf("Expected the poll message to show the bet on Blue, but got %v", texts(edit))
+	}
+
+	// Only moderators may end the poll.
+	denied := harness.response(harness.press("alice", "end:"+pollID))
+	if !containsText(denied, "You do not have permission") {
+		t.Errorf("Expected alice to be refused, but got %v", denied)
+	}
+
+	closed := harness.response(harness.press("moderator", "end:"+pollID))
+	if !containsText(closed, "The poll is closed") {
+		t.Errorf("Expected the poll to be closed, but got %v", closed)
+	}
+	closedEdit := harness.lastPollMessageEdit(pollID)
+	if !containsText(closedEdit, "**Closed**") {
+		t.Errorf("Expected the poll message to show it is closed, but got %v", texts(closedEdit))
+	}
+	for _, button := range componentsWithPrefix(closedEdit, "bet:") {
+		if button["disabled"] != true {
+			t.Errorf("Expected bet button %v to be disabled once the poll is closed", button["custom_id"])
+		}
+	}
+
+	prompt := harness.response(harness.press("moderator", "outcome:"+pollID))
+	if len(componentsWithPrefix(prompt, "select:"+pollID)) != 1 {
+		t.Fatalf("Expected the outcome prompt to offer the outcome menu, but got %v", prompt)
+	}
+
+	if refused := harness.response(harness.press("moderator", "select:"+pollID, "5")); !containsText(refused, "That is not one of the poll's options.") {
+		t.Errorf("Expected an outcome that is not an option to be refused, but got %v", refused)
+	}
+
+	harness.press("moderator", "select:"+pollID, "0")
+
+	if balance := harness.balanceOf("alice"); balance != testStartingPoints+50 {
+		t.Errorf("Expected alice to win bob's stake and have %d points, but got %d", testStartingPoints+50, balance)
+	}
+	if balance := harness.balanceOf("bob"); balance != testStartingPoints-50 {
+		t.Errorf("Expected bob to lose the stake and have %d points, but got %d", testStartingPoints-50, balance)
+	}
+
+	resolvedEdit := harness.lastPollMessageEdit(pollID)
+	if !containsText(resolvedEdit, "The outcome is **Red**") || !containsText(resolvedEdit, "**Winners:** <@alice> (won 150)") {
+		t.Errorf("Expected the poll message to show the outcome and winners, but got %v", texts(resolvedEdit))
+	}
+
+	announcements := harness.discord.Calls(http.MethodPost, "/channels/"+testChannelID+"/messages")
+	if len(announcements) != 2 || !containsText(announcements[1].Body, "The outcome is **Red**") {
+		t.Errorf("Expected the outcome to be announced in the channel, but got %v", announcements)
+	}
+
+	if refused := harness.response(harness.press("moderator", "correct:"+pollID, "5")); !containsText(refused, "That is not one of the poll's options.") {
+		t.Errorf("Expected a correction that is not an option to be refused, but got %v", refused)
+	}
+}
+
+func TestCancelledPollRefundsEndToEnd(t *testing.T) {
+	t.Parallel()
+	harness := newTestHarness(t)
+	harness.moderators["moderator"] = true
+
+	pollID := createTestPoll(t, harness, "moderator", "Red\nBlue").GetID()
+	placeTestBet(t, harness, "alice", pollID, 1, 200)
+
+	confirmation := harness.response(harness.press("moderator", "cancel:"+pollID))
+	if len(componentsWithPrefix(confirmation, "void:"+pollID)) != 1 {
+		t.Fatalf("Expected cancelling to ask for confirmation, but got %v", confirmation)
+	}
+
+	harness.press("moderator", "void:"+pollID)
+
+	if balance := harness.balanceOf("alice"); balance != testStartingPoints {
+		t.Errorf("Expected alice's stake to be refunded, but alice has %d points", balance)
+	}
+	if edit := harness.lastPollMessageEdit(pollID); !containsText(edit, "This poll was cancelled") {
+		t.Errorf("Expected the poll message to show the cancellation, but got %v", texts(edit))
+	}
+
+	stale := harness.response(harness.submitModal("bob", fmt.Sprintf("stake_modal:%s:0", pollID), map[string]string{"stake": "10"}))
+	if !containsText(stale, "This poll was cancelled. You cannot place a bet.") {
+		t.Errorf("Expected a bet on a cancelled poll to be refused, but got %v", stale)
+	}
+
+	if refused := harness.response(harness.press("moderator", "select:"+pollID, "0")); !containsText(refused, "The poll was cancelled, so it has no outcome.") {
+		t.Errorf("Expected selecting the outcome of a cancelled poll to be refused, but got %v", refused)
+	}
+	if refused := harness.response(harness.press("moderator", "correct:"+pollID, "0")); !containsText(refused, "The poll has no outcome to correct.") {
+		t.Errorf("Expected correcting the outcome of a cancelled poll to be refused, but got %v", refused)
+	}
+}
+
+func TestVoidSettledPollEndToEnd(t *testing.T) {
+	t.Parallel()
+	harness := newTestHarness(t)
+	harness.moderators["moderator"] = true
+
+	pollID := createTestPoll(t, harness, "moderator", "Red\nBlue").GetID()
+	placeTestBet(t, harness, "alice", pollID, 0, 100)
+	placeTestBet(t, harness, "bob", pollID, 1, 50)
+	harness.press("moderator", "end:"+pollID)
+	harness.press("moderator", "select:"+pollID, "0")
+
+	voided := harness.response(harness.press("moderator", "void:"+pollID))
+	if !containsText(voided, "The poll is cancelled and all bets have been voided") {
+		t.Errorf("Expected the settled poll to be cancelled, but got %v", voided)
+	}
+	for _, member := range []string{"alice", "bob"} {
+		if balance := harness.balanceOf(member); balance != testStartingPoints {
+			t.Errorf("Expected %s to be back to %d points, but got %d", member, testStartingPoints, balance)
+		}
+	}
+
+	again := harness.response(harness.press("moderator", "void:"+pollID))
+	if !containsText(again, "The poll is already cancelled") {
+		t.Errorf("Expected cancelling the poll again to be refused, but got %v", again)
+	}
+}
+
+func TestGuildsAreIsolatedEndToEnd(t *testing.T) {
+	t.Parallel()
+	harness := newTestHarness(t)
+	harness.moderators["moderator"] = true
+
+	pollID := createTestPoll(t, harness, "moderator", "Red\nBlue").GetID()
+	placeTestBet(t, harness, "alice", pollID, 0, 100)
+	harness.press("moderator", "end:"+pollID)
+	harness.press("moderator", "select:"+pollID, "0")
+
+	listed := harness.response(harness.runCommand("alice", "polls"))
+	if !containsText(listed, "Who wins the final?") {
+		t.Errorf("Expected the poll to be listed in its own guild, but got %v", texts(listed))
+	}
+
+	harness.guildID = "another guild"
+
+	listed = harness.response(harness.runCommand("alice", "polls"))
+	if containsText(listed, "Who wins the final?") || !containsText(listed, "There are no polls here right now.") {
+		t.Errorf("Expected no polls to be listed in another guild, but got %v", texts(listed))
+	}
+
+	leaderboard := harness.response(harness.runCommand("alice", "leaderboard"))
+	if containsText(leaderboard, "<@alice>") || !containsText(leaderboard, "Nobody has a settled bet yet.") {
+		t.Errorf("Expected nobody to be ranked in another guild, but got %v", texts(leaderboard))
+	}
+
+	openPolls, err := harness.bot.PollService.GetOpenPolls(t.Context(), "another guild")
+	if err != nil || len(openPolls) != 0 {
+		t.Errorf("Expected no open polls in another guild, but got %d (%v)", len(openPolls), err)
+	}
+}
+
+func TestGuildSettingsEndToEnd(t *testing.T) {
+	t.Parallel()
+	harness := newTestHarness(t)
+	harness.moderators["moderator"] = true
+	harness.admins["admin"] = true
+	harness.roles["carol"] = []string{"referee"}
+
+	subcommand := func(name string, options ...*discordgo.ApplicationCommandInteractionDataOption) *discordgo.ApplicationCommandInteractionDataOption {
+		return &discordgo.ApplicationCommandInteractionDataOption{Name: name, Type: discordgo.ApplicationCommandOptionSubCommand, Options: options}
+	}
+
+	denied := harness.response(harness.runCommand("moderator", "config", subcommand("show")))
+	if !containsText(denied, "You need the Manage Server permission") {
+		t.Errorf("Expected the moderator to be refused, but got %v", denied)
+	}
+
+	updated := harness.response(harness.runCommand("admin", "config", subcommand("add-moderator-role",
+		&discordgo.ApplicationCommandInteractionDataOption{Name: "role", Type: discordgo.ApplicationCommandOptionRole, Value: "referee"})))
+	if !containsText(updated, "**Moderator roles:** <@&referee>") {
+		t.Errorf("Expected the referee role to be a moderator role, but got %v", updated)
+	}
+	harness.runCommand("admin", "config", subcommand("stakes",
+		&discordgo.ApplicationCommandInteractionDataOption{Name: "enabled", Type: discordgo.ApplicationCommandOptionBoolean, Value: false}))
+
+	pollID := createTestPoll(t, harness, "moderator", "Red\nBlue").GetID()
+
+	// Without stakes, the bet button places the bet straight away.
+	confirmation := harness.response(harness.press("alice", fmt.Sprintf("bet:%s:%d", pollID, 0)))
+	if !containsText(confirmation, "Bet submitted.") {
+		t.Errorf("Expected the bet to be placed without a stake, but got %v", confirmation)
+	}
+	if balance := harness.balanceOf("alice"); balance != testStartingPoints {
+		t.Errorf("Expected alice to keep all %d points, but got %d", testStartingPoints, balance)
+	}
+
+	// Betting again offers to switch the bet, without talk of a stake.
+	prompt := harness.response(harness.press("alice", fmt.Sprintf("bet:%s:%d", pollID, 1)))
+	if !containsText(prompt, "You already bet on **Red**. Switch your bet to **Blue**?") {
+		t.Errorf("Expected a prompt to switch the bet without a stake, but got %v", texts(prompt))
+	}
+	switched := harness.response(harness.press("alice", fmt.Sprintf("switch:%s:%d", pollID, 1)))
+	if !containsText(switched, "Your bet is now on **Blue**.") || containsText(switched, "points") {
+		t.Errorf("Expected the bet to switch without talk of points, but got %v", switched)
+	}
+	withdrawn := harness.response(harness.press("alice", "withdraw:"+pollID))
+	if !containsText(withdrawn, "Your bet was withdrawn.") || containsText(withdrawn, "points") {
+		t.Errorf("Expected the bet to be withdrawn without talk of points, but got %v", withdrawn)
+	}
+
+	// Members with a moderator role may end polls.
+	closed := harness.response(harness.press("carol", "end:"+pollID))
+	if !containsText(closed, "The poll is closed") {
+		t.Errorf("Expected carol to close the poll through their role, but got %v", closed)
+	}
+
+	harness.guildID = "another guild"
+	shown := harness.response(harness.runCommand("admin", "config", subcommand("show")))
+	if !containsText(shown, "**Stakes:** On") {
+		t.Errorf("Expected another guild to keep the default settings, but got %v", shown)
+	}
+}
+
+func TestPermissionPolicyEndToEnd(t *testing.T) {
+	t.Parallel()
+	harness := newTestHarness(t)
+	harness.admins["admin"] = true
+	harness.roles["host"] = []string{"hosts"}
+	harness.roles["other host"] = []string{"hosts"}
+
+	permissionsCommand := func(name string, options ...*discordgo.ApplicationCommandInteractionDataOption) *discordgo.ApplicationCommandInteractionDataOption {
+		return &discordgo.ApplicationCommandInteractionDataOption{
+			Name: "permissions",
+			Type: discordgo.ApplicationCommandOptionSubCommandGroup,
+			Options: []*discordgo.ApplicationCommandInteractionDataOption{
+				{Name: name, Type: discordgo.ApplicationCommandOptionSubCommand, Options: options},
+			},
+		}
+	}
+	action := func(value string) *discordgo.ApplicationCommandInteractionDataOption {
+		return &discordgo.ApplicationCommandInteractionDataOption{Name: "action", Type: discordgo.ApplicationCommandOptionString, Value: value}
+	}
+	hosts := &discordgo.ApplicationCommandInteractionDataOption{Name: "role", Type: discordgo.ApplicationCommandOptionRole, Value: "hosts"}
+	enabled := &discordgo.ApplicationCommandInteractionDataOption{Name: "enabled", Type: discordgo.ApplicationCommandOptionBoolean, Value: true}
+
+	harness.runCommand("admin", "config", permissionsCommand("add-role", action("close_poll"), hosts))
+	harness.runCommand("admin", "config", permissionsCommand("add-role", action("resolve_poll"), hosts))
+	updated := harness.response(harness.runCommand("admin", "config", permissionsCommand("creator-resolves", enabled)))
+	if !containsText(updated, "**Select outcomes:** Moderators, <@&hosts>") || !containsText(updated, "**Only creators and moderators select outcomes:** On") {
+		t.Fatalf("Expected hosts to be allowed to select outcomes of their own polls, but got %v", texts(updated))
+	}
+
+	pollID := createTestPoll(t, harness, "host", "Red\nBlue").GetID()
+
+	// Members outside the policy cannot pick an outcome, even through the menu.
+	denied := harness.response(harness.press("alice", "select:"+pollID, "0"))
+	if !containsText(denied, "You do not have permission to select the outcome of polls") {
+		t.Errorf("Expected alice to be refused, but got %v", denied)
+	}
+
+	harness.press("host", "end:"+pollID)
+
+	notCreator := harness.response(harness.press("other host", "outcome:"+pollID))
+	if !containsText(notCreator, "Only the creator of this poll or a moderator") {
+		t.Errorf("Expected another host to be refused, but got %v", notCreator)
+	}
+
+	prompt := harness.response(harness.press("host", "outcome:"+pollID))
+	if len(componentsWithPrefix(prompt, "select:"+pollID)) != 1 {
+		t.Errorf("Expected the creator to be offered the outcome menu, but got %v", prompt)
+	}
+}
+
+func TestAdjustBalanceEndToEnd(t *testing.T) {
+	t.Parallel()
+	harness := newTestHarness(t)
+	harness.moderators["moderator"] = true
+	harness.admins["admin"] = true
+
+	options := []*discordgo.ApplicationCommandInteractionDataOption{
+		{Name: "user", Type: discordgo.ApplicationCommandOptionUser, Value: "alice"},
+		{Name: "points", Type: discordgo.ApplicationCommandOptionInteger, Value: float64(-250)},
+		{Name: "reason", Type: discordgo.ApplicationCommandOptionString, Value: "Spamming bets"},
+	}
+
+	denied := harness.response(harness.runCommand("moderator", "adjust-balance", options...))
+	if !containsText(denied, "You do not have permission to adjust balances") {
+		t.Errorf("Expected the moderator to be refused, but got %v", denied)
+	}
+
+	adjusted := harness.response(harness.runCommand("admin", "adjust-balance", options...))
+	if !containsText(adjusted, fmt.Sprintf("Took 250 points from <@alice>. They now have %d points.", testStartingPoints-250)) {
+		t.Errorf("Expected 250 points to be taken from alice, but got %v", adjusted)
+	}
+
+	// Balances are kept per guild, so the adjustment does not reach others.
+	harness.guildID = "101"
+	if balance := harness.balanceOf("alice"); balance != testStartingPoints {
+		t.Errorf("Expected alice to have %d points in another guild, but got %d", testStartingPoints, balance)
+	}
+}
+
+func TestLedgerEndToEnd(t *testing.T) {
+	t.Parallel()
+	harness := newTestHarness(t)
+	harness.moderators["moderator"] = true
+	harness.admins["admin"] = true
+
+	poll := createTestPoll(t, harness, "moderator", "Red\nBlue")
+	placeTestBet(t, harness, "alice", poll.GetID(), 0, 100)
+	harness.runCommand("admin", "adjust-balance",
+		&discordgo.ApplicationCommandInteractionDataOption{Name: "user", Type: discordgo.ApplicationCommandOptionUser, Value: "alice"},
+		&discordgo.ApplicationCommandInteractionDataOption{Name: "points", Type: discordgo.ApplicationCommandOptionInteger, Value: float64(50)},
+		&discordgo.ApplicationCommandInteractionDataOption{Name: "reason", Type: discordgo.ApplicationCommandOptionString, Value: "Tournament prize"},
+	)
+
+	userOption := &discordgo.ApplicationCommandInteractionDataOption{Name: "user", Type: discordgo.ApplicationCommandOptionUser, Value: "alice"}
+
+	denied := harness.response(harness.runCommand("bob", "ledger", userOption))
+	if !containsText(denied, "You do not have permission to view ledgers") {
+		t.Errorf("Expected a member to be refused, but got %v", denied)
+	}
+
+	ledger := harness.response(harness.runCommand("moderator", "ledger", userOption))
+	for _, expected := range []string{
+		fmt.Sprintf("Starting balance · +%d", testStartingPoints),
+		"Stake · -100 · **Who wins the final?**",
+		"Adjustment · +50 · Tournament prize",
+		fmt.Sprintf("**Balance:** %d points", testStartingPoints-50),
+	} {
+		if !containsText(ledger, expected) {
+			t.Errorf("Expected the ledger to contain %q, but got %v", expected, ledger)
+		}
+	}
+
+	harness.guildID = "101"
+	elsewhere := harness.response(harness.runCommand("moderator", "ledger", userOption))
+	if !containsText(elsewhere, "<@alice> has no ledger entries in this server.") {
+		t.Errorf("Expected no ledger entries in another server, but got %v", elsewhere)
+	}
+}
+
+func TestExportMyDataEndToEnd(t *testing.T) {
+	t.Parallel()
+	harness := newTestHarness(t)
+	harness.moderators["moderator"] = true
+
+	nothing := harness.response(harness.runCommand("alice", "export-my-data"))
+	if !containsText(nothing, "The bot keeps no data about you.") {
+		t.Errorf("Expected no export for a member without data, but got %v", nothing)
+	}
+
+	poll := createTestPoll(t, harness, "moderator", "Red\nBlue")
+	placeTestBet(t, harness, "alice", poll.GetID(), 1, 100)
+
+	interactionID := harness.runCommand("alice", "export-my-data")
+	deferred := harness.response(interactionID)
+	data, _ := deferred["data"].(map[string]any)
+	if deferred["type"] != float64(discordgo.InteractionResponseDeferredChannelMessageWithSource) || data["flags"] != float64(discordgo.MessageFlagsEphemeral) {
+		t.Fatalf("Expected an ephemeral deferred answer, but got %v", deferred)
+	}
+
+	edits := harness.discord.Calls(http.MethodPatch, "/webhooks/300/token-"+interactionID+"/messages/@original")
+	if len(edits) != 1 {
+		t.Fatalf("Expected the answer to be filled in once, but got %v", edits)
+	}
+
+	var export users.DataExport
+	if err := json.Unmarshal(edits[0].Files["my-data.json"], &export); err != nil {
+		t.Fatalf("Expected the export to be attached as JSON, but got %v", err)
+	}
+	if export.Version != users.DataExportVersion {
+		t.Errorf("Expected version %d of the export, but got %d", users.DataExportVersion, export.Version)
+	}
+	if len(export.Identities) != 1 || export.Identities[0].ExternalID != "alice" {
+		t.Errorf("Expected alice's Discord identity in the export, but got %+v", export.Identities)
+	}
+	if len(export.Bets) != 1 || export.Bets[0].Option != "Blue" || export.Bets[0].Stake != 100 {
+		t.Errorf("Expected alice's bet of 100 on Blue in the export, but got %+v", export.Bets)
+	}
+	if len(export.Ledger) == 0 {
+		t.Error("Expected alice's ledger in the export")
+	}
+	if len(export.Wallets) != 1 || export.Wallets[0].GuildID != testGuildID || export.Wallets[0].Balance != testStartingPoints-100 {
+		t.Errorf("Expected alice's balance in the export, but got %+v", export.Wallets)
+	}
+	if len(export.Polls) != 0 {
+		t.Errorf("Expected no polls created by alice in the export, but got %+v", export.Polls)
+	}
+}
+
+func TestDirectMessagesAreRefused(t *testing.T) {
+	t.Parallel()
+	harness := newTestHarness(t)
+
+	harness.bot.interactionHandler(nil, &discordgo.InteractionCreate{
+		Interaction: &discordgo.Interaction{
+			ID:    "dm",
+			Token: "token-dm",
+			Type:  discordgo.InteractionMessageComponent,
+			Data:  discordgo.MessageComponentInteractionData{CustomID: "end:poll"},
+			User:  &discordgo.User{ID: "alice"},
+		},
+	})
+
+	if refused := harness.response("dm"); !containsText(refused, "This can only be done in a server.") {
+		t.Errorf("Expected the interaction to be refused outside a server, but got %v", refused)
+	}
+}
+
+func TestMyBetsDoesNotCreateUsersEndToEnd(t *testing.T) {
+	t.Parallel()
+	harness := newTestHarness(t)
+
+	history := harness.response(harness.runCommand("carol", "mybets"))
+	if !containsText(history, "You have no bets here yet.") {
+		t.Errorf("Expected an empty bet history, but got %v", texts(history))
+	}
+
+	if _, err := harness.bot.resolveDiscordUser(t.Context(), "carol"); !errors.Is(err, users.ErrUserNotFound) {
+		t.Errorf("Expected viewing /mybets not to create carol, but got %v", err)
+	}
+}
+
+func TestFailedFirstBetDoesNotCreateUserEndToEnd(t *testing.T) {
+	t.Parallel()
+	harness := newTestHarness(t)
+	harness.moderators["moderator"] = true
+
+	pollID := createTestPoll(t, harness, "moderator", "Red\nBlue").GetID()
+
+	modal := harness.response(harness.press("dave", fmt.Sprintf("bet:%s:0", pollID)))
+	if !containsCustomID(modal, fmt.Sprintf("stake_modal:%s:0", pollID)) {
+		t.Fatalf("Expected the bet button to open the stake modal, but got %v", modal)
+	}
+	if _, err := harness.bot.resolveDiscordUser(t.Context(), "dave"); !errors.Is(err, users.ErrUserNotFound) {
+		t.Errorf("Expected opening the stake modal not to create dave, but got %v", err)
+	}
+
+	refused := harness.response(harness.submitModal("dave", fmt.Sprintf("stake_modal:%s:0", pollID), map[string]string{"stake": fmt.Sprint(testStartingPoints + 1)}))
+	if !containsText(refused, fmt.Sprintf("you only have %d", testStartingPoints)) {
+		t.Errorf("Expected a stake above the starting balance to be refused, but got %v", refused)
+	}
+	if _, err := harness.bot.resolveDiscordUser(t.Context(), "dave"); !errors.Is(err, users.ErrUserNotFound) {
+		t.Errorf("Expected the failed first bet not to leave dave behind, but got %v", err)
+	}
+
+	placeTestBet(t, harness, "dave", pollID, 0, 10)
+	if balance := harness.balanceOf("dave"); balance != testStartingPoints-10 {
+		t.Errorf("Expected dave to have %d points after the first bet, but got %d", testStartingPoints-10, balance)
+	}
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+
+	"betting-discord-bot/internal/discord"
+	"betting-discord-bot/internal/users"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+const exportFileName = "my-data.json"
+
+// exportMessage is the message the caller's data export is attached to.
+type exportMessage struct {
+	Content     string               `json:"content"`
+	Attachments []discord.Attachment `json:"attachments"`
+}
+
+// handleExportMyDataCommand sends the caller everything the bot keeps about
+// them as a JSON file that only they can see.
+func (bot *Bot) handleExportMyDataCommand(ctx context.Context, i *discordgo.InteractionCreate) {
+	user, err := bot.resolveDiscordUser(ctx, interactionUser(i).ID)
+	if errors.Is(err, users.ErrUserNotFound) {
+		bot.sendInteractionResponse(ctx, i, "The bot keeps no data about you.")
+		return
+	}
+	if err != nil {
+		log.Printf("Error resolving user: %v", err)
+		bot.sendInteractionResponse(ctx, i, "Your data could not be exported. Please try again later.")
+		return
+	}
+
+	// Gathering every bet may take longer than Discord waits for an answer,
+	// so the answer is deferred and the file attached once it is ready.
+	deferred := &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseDeferredChannelMessageWithSource,
+		Data: &discordgo.InteractionResponseData{Flags: discordgo.MessageFlagsEphemeral},
+	}
+	if err := bot.respondToInteraction(ctx, i, deferred); err != nil {
+		log.Printf("Error deferring data export: %v", err)
+		return
+	}
+
+	ctx, cancel := followUp(ctx)
+	defer cancel()
+
+	message := exportMessage{Content: "Here is everything the bot keeps about you.", Attachments: []discord.Attachment{{ID: 0, Filename: exportFileName}}}
+	data, err := bot.exportData(ctx, user.GetID())
+	if err != nil {
+		log.Printf("Error exporting data of user %s: %v", user.GetID(), err)
+		message = exportMessage{Content: "Your data could not be exported. Please try again later.", Attachments: []discord.Attachment{}}
+	}
+
+	var files []discord.File
+	if data != nil {
+		files = []discord.File{{Name: exportFileName, ContentType: "application/json", Data: data}}
+	}
+	if err := bot.Discord.EditInteractionResponse(ctx, bot.AppID, i.Token, message, files); err != nil {
+		log.Printf("Error sending data export: %v", err)
+	}
+}
+
+// exportData encodes the user's data export as indented JSON.
+func (bot *Bot) exportData(ctx context.Context, userID string) ([]byte, error) {
+	export, err := bot.UserService.ExportData(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	return json.MarshalIndent(export, "", "  ")
+}
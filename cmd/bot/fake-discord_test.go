@@ -0,0 +1,291 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+
+	"betting-discord-bot/internal/bets"
+	"betting-discord-bot/internal/discord"
+	"betting-discord-bot/internal/permissions"
+	"betting-discord-bot/internal/polls"
+	"betting-discord-bot/internal/settings"
+	"betting-discord-bot/internal/storage"
+	"betting-discord-bot/internal/users"
+	"betting-discord-bot/internal/wallet"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+const (
+	testGuildID        = "100"
+	testChannelID      = "200"
+	testStartingPoints = 1000
+)
+
+// restCall is a request the bot made to the fake Discord API.
+type restCall struct {
+	Method string
+	Path   string
+	Body   map[string]any
+	// Files are the files uploaded with the request, by name.
+	Files map[string][]byte
+}
+
+// fakeDiscord is an in-process stand-in for the Discord REST API. It records
+// every request and answers the way Discord would.
+type fakeDiscord struct {
+	server        *httptest.Server
+	mu            sync.Mutex
+	calls         []restCall
+	nextMessageID int
+}
+
+func newFakeDiscord(t *testing.T) *fakeDiscord {
+	t.Helper()
+	fake := &fakeDiscord{nextMessageID: 1000}
+	fake.server = httptest.NewServer(http.HandlerFunc(fake.serveHTTP))
+	t.Cleanup(fake.server.Close)
+	return fake
+}
+
+func (fake *fakeDiscord) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	call := restCall{Method: r.Method, Path: r.URL.Path}
+	if mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); mediaType == "multipart/form-data" {
+		call.Body, call.Files = readMultipart(r)
+	} else if rawBody, err := io.ReadAll(r.Body); err == nil && len(rawBody) > 0 {
+		_ = json.Unmarshal(rawBody, &call.Body)
+	}
+
+	fake.mu.Lock()
+	fake.calls = append(fake.calls, call)
+	fake.nextMessageID++
+	messageID := fake.nextMessageID
+	fake.mu.Unlock()
+
+	segments := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	switch {
+	case r.Method == http.MethodPost && len(segments) == 3 && segments[0] == "channels" && segments[2] == "messages":
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = fmt.Fprintf(w, `{"id": "%d", "channel_id": "%s"}`, messageID, segments[1])
+	case r.Method == http.MethodPatch:
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = io.WriteString(w, `{}`)
+	default:
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// readMultipart reads a request that uploads files: its payload_json and the
+// files themselves.
+func readMultipart(r *http.Request) (map[string]any, map[string][]byte) {
+	if err := r.ParseMultipartForm(1 << 20); err != nil {
+		return nil, nil
+	}
+
+	var body map[string]any
+	_ = json.Unmarshal([]byte(r.FormValue("payload_json")), &body)
+
+	files := make(map[string][]byte)
+	for _, headers := range r.MultipartForm.File {
+		for _, header := range headers {
+			file, err := header.Open()
+			if err != nil {
+				continue
+			}
+			files[header.Filename], _ = io.ReadAll(file)
+			_ = file.Close()
+		}
+	}
+	return body, files
+}
+
+// Calls returns the requests made so far whose path starts with pathPrefix.
+func (fake *fakeDiscord) Calls(method string, pathPrefix string) []restCall {
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+
+	var matching []restCall
+	for _, call := range fake.calls {
+		if call.Method == method && strings.HasPrefix(call.Path, pathPrefix) {
+			matching = append(matching, call)
+		}
+	}
+	return matching
+}
+
+// testHarness runs a bot backed by the memory repositories against a fake
+// Discord API, and feeds it interactions as if they came from the gateway.
+type testHarness struct {
+	t          *testing.T
+	bot        *Bot
+	discord    *fakeDiscord
+	moderators map[string]bool
+	// admins may manage the server, and so change the bot's settings.
+	admins map[string]bool
+	// roles are the roles of each member.
+	roles map[string][]string
+	// guildID is the guild interactions come from.
+	guildID string
+
+	mu                sync.Mutex
+	nextInteractionID int
+}
+
+func newTestHarness(t *testing.T) *testHarness {
+	t.Helper()
+	fake := newFakeDiscord(t)
+
+	pollRepo := polls.NewMemoryRepository()
+	pollService := polls.NewService(pollRepo)
+	walletService := wallet.NewService(wallet.NewMemoryRepository(), testStartingPoints)
+	unitOfWork := storage.NewMemoryUnitOfWork()
+	betService := bets.NewService(pollService, bets.NewMemoryRepositoryWithPolls(pollRepo), walletService, bets.PayoutCalculator{}, unitOfWork)
+	userService := users.NewService(users.NewMemoryRepository(), pollService, betService, walletService)
+	settingsService := settings.NewService(settings.NewMemoryRepository(), defaultGuildSettings(testStartingPoints))
+	permissionService := permissions.NewService(permissions.NewMemoryRepository(), settingsService)
+
+	discordClient := discord.NewClient(fake.server.URL, "test-token")
+	bot := NewBot(nil, discordClient, pollService, betService, userService, walletService, settingsService, permissionService, NewMemoryPollMessageRepository(), unitOfWork, "300", testGuildID)
+	t.Cleanup(bot.Scheduler.Stop)
+
+	return &testHarness{t: t, bot: bot, discord: fake, moderators: make(map[string]bool), admins: make(map[string]bool), roles: make(map[string][]string), guildID: testGuildID, nextInteractionID: 500}
+}
+
+// send delivers the interaction from the user and returns its ID.
+func (harness *testHarness) send(userID string, interactionType discordgo.InteractionType, data discordgo.InteractionData) string {
+	harness.mu.Lock()
+	harness.nextInteractionID++
+	interactionID := fmt.Sprint(harness.nextInteractionID)
+	harness.mu.Unlock()
+
+	var permissions int64
+	if harness.moderators[userID] {
+		permissions |= discordgo.PermissionManageMessages
+	}
+	if harness.admins[userID] {
+		permissions |= discordgo.PermissionManageGuild
+	}
+
+	harness.bot.interactionHandler(nil, &discordgo.InteractionCreate{
+		Interaction: &discordgo.Interaction{
+			ID:        interactionID,
+			Token:     "token-" + interactionID,
+			Type:      interactionType,
+			Data:      data,
+			GuildID:   harness.guildID,
+			ChannelID: testChannelID,
+			Member: &discordgo.Member{
+				User:        &discordgo.User{ID: userID, GlobalName: userID},
+				Permissions: permissions,
+				Roles:       harness.roles[userID],
+			},
+		},
+	})
+
+	return interactionID
+}
+
+func (harness *testHarness) runCommand(userID string, name string, options ...*discordgo.ApplicationCommandInteractionDataOption) string {
+	return harness.send(userID, discordgo.InteractionApplicationCommand, discordgo.ApplicationCommandInteractionData{
+		Name:    name,
+		Options: options,
+	})
+}
+
+func (harness *testHarness) submitModal(userID string, customID string, values map[string]string) string {
+	inputIDs := make([]string, 0, len(values))
+	for inputID := range values {
+		inputIDs = append(inputIDs, inputID)
+	}
+	sort.Strings(inputIDs)
+
+	rows := make([]discordgo.MessageComponent, len(inputIDs))
+	for index, inputID := range inputIDs {
+		rows[index] = &discordgo.ActionsRow{
+			Components: []discordgo.MessageComponent{
+				&discordgo.TextInput{CustomID: inputID, Value: values[inputID]},
+			},
+		}
+	}
+
+	return harness.send(userID, discordgo.InteractionModalSubmit, discordgo.ModalSubmitInteractionData{
+		CustomID:   customID,
+		Components: rows,
+	})
+}
+
+// press clicks a button, or picks values from a select menu.
+func (harness *testHarness) press(userID string, customID string, values ...string) string {
+	return harness.send(userID, discordgo.InteractionMessageComponent, discordgo.MessageComponentInteractionData{
+		CustomID: customID,
+		Values:   values,
+	})
+}
+
+// response returns how the bot answered the interaction.
+func (harness *testHarness) response(interactionID string) map[string]any {
+	harness.t.Helper()
+	calls := harness.discord.Calls(http.MethodPost, "/interactions/"+interactionID+"/")
+	if len(calls) != 1 {
+		harness.t.Fatalf("Expected one response to interaction %s, but got %d", interactionID, len(calls))
+	}
+	return calls[0].Body
+}
+
+// texts collects the text content anywhere in a message, such as the text
+// displays of a Components V2 message.
+func texts(value any) []string {
+	var found []string
+	switch typed := value.(type) {
+	case map[string]any:
+		for key, child := range typed {
+			if content, isString := child.(string); isString && key == "content" {
+				found = append(found, content)
+				continue
+			}
+			found = append(found, texts(child)...)
+		}
+	case []any:
+		for _, child := range typed {
+			found = append(found, texts(child)...)
+		}
+	}
+	return found
+}
+
+func containsText(value any, expected string) bool {
+	for _, text := range texts(value) {
+		if strings.Contains(text, expected) {
+			return true
+		}
+	}
+	return false
+}
+
+// componentsWithPrefix finds the components anywhere in a message whose custom
+// ID starts with prefix.
+func componentsWithPrefix(value any, prefix string) []map[string]any {
+	var found []map[string]any
+	switch typed := value.(type) {
+	case map[string]any:
+		if customID, isString := typed["custom_id"].(string); isString && strings.HasPrefix(customID, prefix) {
+			found = append(found, typed)
+		}
+		for _, child := range typed {
+			found = append(found, componentsWithPrefix(child, prefix)...)
+		}
+	case []any:
+		for _, child := range typed {
+			found = append(found, componentsWithPrefix(child, prefix)...)
+		}
+	}
+	return found
+}
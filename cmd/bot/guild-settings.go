@@ -0,0 +1,251 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"betting-discord-bot/internal/settings"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// Defaults for guilds that have not changed their settings. The starting
+// balance comes from the configuration instead.
+const (
+	defaultAccentColour = 0xe32458
+	defaultLocale       = "en-US"
+)
+
+// defaultGuildSettings are the settings of a guild that has not changed any.
+func defaultGuildSettings(startingBalance int64) settings.Settings {
+	return settings.Settings{
+		AccentColour:    defaultAccentColour,
+		StartingBalance: startingBalance,
+		Locale:          defaultLocale,
+		StakesEnabled:   true,
+	}
+}
+
+// guildSettings returns the settings of the guild, falling back to the
+// defaults if they cannot be read.
+func (bot *Bot) guildSettings(ctx context.Context, guildID string) settings.Settings {
+	guildSettings, err := bot.Settings.GetSettings(ctx, guildID)
+	if err != nil {
+		log.Printf("Error getting settings of guild %s, using the defaults: %v", guildID, err)
+		return bot.Settings.Defaults(guildID)
+	}
+	return guildSettings
+}
+
+func (bot *Bot) accentColour(ctx context.Context, guildID string) int {
+	return bot.guildSettings(ctx, guildID).AccentColour
+}
+
+// settingsErrorMessages explain why the settings service rejected a change.
+var settingsErrorMessages = map[error]string{
+	settings.ErrTooManyModeratorRoles:  fmt.Sprintf("A server can have at most %d moderator roles.", settings.MaxModeratorRoles),
+	settings.ErrInvalidPollDuration:    fmt.Sprintf("The default poll duration can be at most %s.", formatDuration(settings.MaxPollDuration)),
+	settings.ErrInvalidAccentColour:    "The accent colour must be a hex colour such as #e32458.",
+	settings.ErrInvalidStartingBalance: fmt.Sprintf("The starting balance must be between 0 and %d points.", settings.MaxStartingBalance),
+	settings.ErrUnsupportedLocale:      "The locale must be one of Discord's locales: " + strings.Join(settings.SupportedLocales, ", ") + ".",
+}
+
+// handleConfigCommand shows or changes the settings of the guild. Each
+// subcommand of /config changes one setting.
+func (bot *Bot) handleConfigCommand(ctx context.Context, i *discordgo.InteractionCreate) {
+	if bot.doesNotHaveManageGuildPerm(ctx, i) {
+		return
+	}
+
+	options := i.ApplicationCommandData().Options
+	if len(options) != 1 {
+		log.Printf("Expected a /config subcommand, but got %d options", len(options))
+		return
+	}
+	subcommand := options[0]
+
+	if subcommand.Type == discordgo.ApplicationCommandOptionSubCommandGroup {
+		bot.handlePermissionsConfig(ctx, i, subcommand)
+		return
+	}
+
+	current, err := bot.Settings.GetSettings(ctx, i.GuildID)
+	if err != nil {
+		log.Printf("Error getting settings: %v", err)
+		bot.sendInteractionResponse(ctx, i, "The settings could not be loaded. Please try again.")
+		return
+	}
+
+	if subcommand.Name == "show" {
+		policy, err := bot.Permissions.GetPolicy(ctx, i.GuildID)
+		if err != nil {
+			log.Printf("Error getting permission policy: %v", err)
+			bot.sendInteractionResponse(ctx, i, formatGuildSettings(current))
+			return
+		}
+		bot.sendInteractionResponse(ctx, i, formatGuildSettings(current)+"\n\n"+formatPermissionPolicy(policy))
+		return
+	}
+
+	updated, problem := applyConfigChange(current, subcommand)
+	if problem != "" {
+		bot.sendInteractionResponse(ctx, i, problem)
+		return
+	}
+
+	if err := bot.Settings.UpdateSettings(ctx, updated); err != nil {
+		for settingsErr, message := range settingsErrorMessages {
+			if errors.Is(err, settingsErr) {
+				bot.sendInteractionResponse(ctx, i, message)
+				return
+			}
+		}
+		log.Printf("Error updating settings: %v", err)
+		bot.sendInteractionResponse(ctx, i, "The settings could not be saved. Please try again.")
+		return
+	}
+
+	log.Printf("User %s changed the %s setting of guild %s", interactionUser(i).ID, subcommand.Name, i.GuildID)
+	bot.sendInteractionResponse(ctx, i, "Settings updated.\n\n"+formatGuildSettings(updated))
+}
+
+// applyConfigChange applies a /config subcommand to the settings. It returns
+// why the change cannot be made if the input is unusable.
+func applyConfigChange(guildSettings settings.Settings, subcommand *discordgo.ApplicationCommandInteractionDataOption) (settings.Settings, string) {
+	options := make(map[string]*discordgo.ApplicationCommandInteractionDataOption)
+	for _, option := range subcommand.Options {
+		options[option.Name] = option
+	}
+
+	switch subcommand.Name {
+	case "add-moderator-role":
+		roleID := options["role"].RoleValue(nil, "").ID
+		if guildSettings.IsModeratorRole(roleID) {
+			return guildSettings, fmt.Sprintf("<@&%s> is already a moderator role.", roleID)
+		}
+		guildSettings.ModeratorRoleIDs = append(slices.Clone(guildSettings.ModeratorRoleIDs), roleID)
+	case "remove-moderator-role":
+		roleID := options["role"].RoleValue(nil, "").ID
+		if !guildSettings.IsModeratorRole(roleID) {
+			return guildSettings, fmt.Sprintf("<@&%s> is not a moderator role.", roleID)
+		}
+		guildSettings.ModeratorRoleIDs = slices.DeleteFunc(slices.Clone(guildSettings.ModeratorRoleIDs), func(moderatorRoleID string) bool {
+			return moderatorRoleID == roleID
+		})
+	case "poll-duration":
+		duration, err := parsePollDuration(options["duration"].StringValue())
+		if err != nil {
+			return guildSettings, "The duration must be such as 90m, 2h or 1h30m, or none to leave polls open until they are ended."
+		}
+		guildSettings.DefaultPollDuration = duration
+	case "accent-colour":
+		colour, err := parseHexColour(options["colour"].StringValue())
+		if err != nil {
+			return guildSettings, settingsErrorMessages[settings.ErrInvalidAccentColour]
+		}
+		guildSettings.AccentColour = colour
+	case "announcement-channel":
+		guildSettings.AnnouncementChannelID = ""
+		if option, exists := options["channel"]; exists {
+			guildSettings.AnnouncementChannelID = option.ChannelValue(nil).ID
+		}
+	case "starting-balance":
+		guildSettings.StartingBalance = options["points"].IntValue()
+	case "locale":
+		guildSettings.Locale = strings.TrimSpace(options["locale"].StringValue())
+	case "stakes":
+		guildSettings.StakesEnabled = options["enabled"].BoolValue()
+	default:
+		return guildSettings, fmt.Sprintf("Unknown setting %q.", subcommand.Name)
+	}
+
+	return guildSettings, ""
+}
+
+// parsePollDuration reads a default poll duration. None, off and 0 clear it.
+func parsePollDuration(rawDuration string) (time.Duration, error) {
+	rawDuration = strings.ToLower(strings.TrimSpace(rawDuration))
+	switch rawDuration {
+	case "none", "off", "0":
+		return 0, nil
+	}
+
+	duration, err := time.ParseDuration(rawDuration)
+	if err != nil {
+		return 0, err
+	}
+	if duration <= 0 {
+		return 0, fmt.Errorf("duration must be above zero, got %s", duration)
+	}
+	return duration, nil
+}
+
+// parseHexColour reads an RGB colour such as #e32458.
+func parseHexColour(rawColour string) (int, error) {
+	rawColour = strings.TrimPrefix(strings.TrimSpace(rawColour), "#")
+	if len(rawColour) != 6 {
+		return 0, fmt.Errorf("colour must have six hex digits, got %q", rawColour)
+	}
+
+	colour, err := strconv.ParseUint(rawColour, 16, 32)
+	if err != nil {
+		return 0, err
+	}
+	return int(colour), nil
+}
+
+// formatDuration drops the zero minutes and seconds Go spells out, so two
+// hours reads 2h rather than 2h0m0s.
+func formatDuration(duration time.Duration) string {
+	text := duration.String()
+	if strings.HasSuffix(text, "m0s") {
+		text = strings.TrimSuffix(text, "0s")
+	}
+	if strings.HasSuffix(text, "h0m") {
+		text = strings.TrimSuffix(text, "0m")
+	}
+	return text
+}
+
+func formatGuildSettings(guildSettings settings.Settings) string {
+	moderatorRoles := "None, only members who can manage messages"
+	if len(guildSettings.ModeratorRoleIDs) > 0 {
+		mentions := make([]string, len(guildSettings.ModeratorRoleIDs))
+		for index, roleID := range guildSettings.ModeratorRoleIDs {
+			mentions[index] = fmt.Sprintf("<@&%s>", roleID)
+		}
+		moderatorRoles = strings.Join(mentions, ", ")
+	}
+
+	pollDuration := "None, polls stay open until they are ended"
+	if guildSettings.DefaultPollDuration > 0 {
+		pollDuration = formatDuration(guildSettings.DefaultPollDuration)
+	}
+
+	announcementChannel := "The channel each poll was posted in"
+	if guildSettings.AnnouncementChannelID != "" {
+		announcementChannel = fmt.Sprintf("<#%s>", guildSettings.AnnouncementChannelID)
+	}
+
+	stakes := "Off"
+	if guildSettings.StakesEnabled {
+		stakes = "On"
+	}
+
+	return strings.Join([]string{
+		"## Server settings",
+		"**Moderator roles:** " + moderatorRoles,
+		"**Default poll duration:** " + pollDuration,
+		fmt.Sprintf("**Accent colour:** #%06x", guildSettings.AccentColour),
+		"**Announcement channel:** " + announcementChannel,
+		fmt.Sprintf("**Starting balance:** %d points", guildSettings.StartingBalance),
+		"**Locale:** " + guildSettings.Locale + " (not applied yet)",
+		"**Stakes:** " + stakes,
+	}, "\n")
+}
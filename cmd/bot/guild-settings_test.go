@@ -0,0 +1,183 @@
+package main
+
+import (
+	"slices"
+	"testing"
+	"time"
+
+	"betting-discord-bot/internal/settings"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+func subcommandForTest(name string, options ...*discordgo.ApplicationCommandInteractionDataOption) *discordgo.ApplicationCommandInteractionDataOption {
+	return &discordgo.ApplicationCommandInteractionDataOption{
+		Name:    name,
+		Type:    discordgo.ApplicationCommandOptionSubCommand,
+		Options: options,
+	}
+}
+
+func optionForTest(name string, optionType discordgo.ApplicationCommandOptionType, value any) *discordgo.ApplicationCommandInteractionDataOption {
+	return &discordgo.ApplicationCommandInteractionDataOption{Name: name, Type: optionType, Value: value}
+}
+
+func TestApplyConfigChange(t *testing.T) {
+	t.Parallel()
+	current := defaultGuildSettings(1000)
+	current.GuildID = "guild"
+	current.ModeratorRoleIDs = []string{"role-1"}
+
+	tests := []struct {
+		name        string
+		subcommand  *discordgo.ApplicationCommandInteractionDataOption
+		wantProblem bool
+		check       func(t *testing.T, updated settings.Settings)
+	}{
+		{
+			name:       "Add Moderator Role",
+			subcommand: subcommandForTest("add-moderator-role", optionForTest("role", discordgo.ApplicationCommandOptionRole, "role-2")),
+			check: func(t *testing.T, updated settings.Settings) {
+				if !slices.Equal(updated.ModeratorRoleIDs, []string{"role-1", "role-2"}) {
+					t.Errorf("Expected role-2 to be added, but got %v", updated.ModeratorRoleIDs)
+				}
+			},
+		},
+		{
+			name:        "Add Existing Moderator Role",
+			subcommand:  subcommandForTest("add-moderator-role", optionForTest("role", discordgo.ApplicationCommandOptionRole, "role-1")),
+			wantProblem: true,
+		},
+		{
+			name:       "Remove Moderator Role",
+			subcommand: subcommandForTest("remove-moderator-role", optionForTest("role", discordgo.ApplicationCommandOptionRole, "role-1")),
+			check: func(t *testing.T, updated settings.Settings) {
+				if len(updated.ModeratorRoleIDs) != 0 {
+					t.Errorf("Expected no moderator roles to be left, but got %v", updated.ModeratorRoleIDs)
+				}
+			},
+		},
+		{
+			name:        "Remove Unknown Moderator Role",
+			subcommand:  subcommandForTest("remove-moderator-role", optionForTest("role", discordgo.ApplicationCommandOptionRole, "role-2")),
+			wantProblem: true,
+		},
+		{
+			name:       "Poll Duration",
+			subcommand: subcommandForTest("poll-duration", optionForTest("duration", discordgo.ApplicationCommandOptionString, "1h30m")),
+			check: func(t *testing.T, updated settings.Settings) {
+				if updated.DefaultPollDuration != 90*time.Minute {
+					t.Errorf("Expected a default poll duration of 1h30m, but got %s", updated.DefaultPollDuration)
+				}
+			},
+		},
+		{
+			name:        "Unreadable Poll Duration",
+			subcommand:  subcommandForTest("poll-duration", optionForTest("duration", discordgo.ApplicationCommandOptionString, "a week")),
+			wantProblem: true,
+		},
+		{
+			name:       "Accent Colour",
+			subcommand: subcommandForTest("accent-colour", optionForTest("colour", discordgo.ApplicationCommandOptionString, "#00ff7f")),
+			check: func(t *testing.T, updated settings.Settings) {
+				if updated.AccentColour != 0x00ff7f {
+					t.Errorf("Expected an accent colour of #00ff7f, but got #%06x", updated.AccentColour)
+				}
+			},
+		},
+		{
+			name:        "Unreadable Accent Colour",
+			subcommand:  subcommandForTest("accent-colour", optionForTest("colour", discordgo.ApplicationCommandOptionString, "pink")),
+			wantProblem: true,
+		},
+		{
+			name:       "Announcement Channel",
+			subcommand: subcommandForTest("announcement-channel", optionForTest("channel", discordgo.ApplicationCommandOptionChannel, "channel")),
+			check: func(t *testing.T, updated settings.Settings) {
+				if updated.AnnouncementChannelID != "channel" {
+					t.Errorf("Expected announcements to go to channel, but got %q", updated.AnnouncementChannelID)
+				}
+			},
+		},
+		{
+			name:       "Starting Balance",
+			subcommand: subcommandForTest("starting-balance", optionForTest("points", discordgo.ApplicationCommandOptionInteger, float64(250))),
+			check: func(t *testing.T, updated settings.Settings) {
+				if updated.StartingBalance != 250 {
+					t.Errorf("Expected a starting balance of 250, but got %d", updated.StartingBalance)
+				}
+			},
+		},
+		{
+			name:       "Stakes",
+			subcommand: subcommandForTest("stakes", optionForTest("enabled", discordgo.ApplicationCommandOptionBoolean, false)),
+			check: func(t *testing.T, updated settings.Settings) {
+				if updated.StakesEnabled {
+					t.Error("Expected stakes to be turned off")
+				}
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			updated, problem := applyConfigChange(current, tt.subcommand)
+			if (problem != "") != tt.wantProblem {
+				t.Fatalf("applyConfigChange(%s) problem = %q, wantProblem %v", tt.subcommand.Name, problem, tt.wantProblem)
+			}
+			if tt.check != nil {
+				tt.check(t, updated)
+			}
+			if !slices.Equal(current.ModeratorRoleIDs, []string{"role-1"}) {
+				t.Errorf("Expected the current settings to be left alone, but their roles are %v", current.ModeratorRoleIDs)
+			}
+		})
+	}
+}
+
+func TestParseHexColour(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		input   string
+		want    int
+		wantErr bool
+	}{
+		{input: "#e32458", want: 0xe32458},
+		{input: " FFFFFF ", want: 0xffffff},
+		{input: "000000", want: 0},
+		{input: "#fff", wantErr: true},
+		{input: "#gggggg", wantErr: true},
+		{input: "-12345", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		got, err := parseHexColour(tt.input)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("parseHexColour(%q) error = %v, wantErr %v", tt.input, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("parseHexColour(%q) = %#x, want %#x", tt.input, got, tt.want)
+		}
+	}
+}
+
+func TestFormatDuration(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		input time.Duration
+		want  string
+	}{
+		{input: 2 * time.Hour, want: "2h"},
+		{input: 90 * time.Minute, want: "1h30m"},
+		{input: 45 * time.Minute, want: "45m"},
+		{input: 90 * time.Second, want: "1m30s"},
+	}
+
+	for _, tt := range tests {
+		if got := formatDuration(tt.input); got != tt.want {
+			t.Errorf("formatDuration(%s) = %q, want %q", tt.input, got, tt.want)
+		}
+	}
+}
@@ -1,22 +1,30 @@
 package main
 
 import (
+	"context"
 	"log"
 
+	"betting-discord-bot/internal/permissions"
+
 	"github.com/bwmarrin/discordgo"
 )
 
-func (bot *Bot) handleCreatePollCommand(s *discordgo.Session, i *discordgo.InteractionCreate) {
+func (bot *Bot) handleCreatePollCommand(ctx context.Context, s *discordgo.Session, i *discordgo.InteractionCreate) {
 	log.Println("A user requested to create a poll")
 
+	if bot.doesNotHavePermission(ctx, i, permissions.CreatePoll, "") {
+		return
+	}
+
 	modalData := &discordgo.InteractionResponseData{
 		CustomID:   "poll_modal", // The ID we'll check for on submission
 		Title:      "Create a New Poll",
 		Components: pollModalComponents(),
 	}
 
-	if err := s.InteractionRespond(
-		i.Interaction,
+	if err := bot.respondToInteraction(
+		ctx,
+		i,
 		&discordgo.InteractionResponse{
 			Type: discordgo.InteractionResponseModal,
 			Data: modalData,
@@ -1,7 +1,7 @@
 package main
 
 import (
-	"encoding/json"
+	"context"
 	"errors"
 	"fmt"
 	"log"
@@ -9,17 +9,47 @@ import (
 	"strings"
 
 	"betting-discord-bot/internal/bets"
+	"betting-discord-bot/internal/permissions"
 	"betting-discord-bot/internal/polls"
+	"betting-discord-bot/internal/storage"
 	"betting-discord-bot/internal/users"
+	"betting-discord-bot/internal/wallet"
 
 	"github.com/bwmarrin/discordgo"
 )
 
-func handleBet(s *discordgo.Session, i *discordgo.InteractionCreate, bot *Bot, pollID string, user users.User, optionIndex int) {
-	bet, betErr := bot.BetService.CreateBet(pollID, user.GetID(), optionIndex)
+// handleBet places the bet. A user betting for the first time is created, and
+// their wallet opened, in the same unit of work as the bet, so that a bet
+// that fails leaves neither behind.
+func handleBet(ctx context.Context, s *discordgo.Session, i *discordgo.InteractionCreate, bot *Bot, pollID string, optionIndex int, stake int64) {
+	startingBalance := bot.guildSettings(ctx, i.GuildID).StartingBalance
+
+	var user users.User
+	var bet bets.Bet
+	betErr := bot.UnitOfWork.Do(ctx, func(tx *storage.Tx) error {
+		var err error
+		if user, err = getOrCreateDiscordUser(ctx, bot.UserService.WithTx(tx), interactionUser(i).ID); err != nil {
+			return err
+		}
+
+		if stake > 0 {
+			if _, err := bot.WalletService.WithTx(tx).OpenWallet(ctx, i.GuildID, user.GetID(), startingBalance); err != nil {
+				return fmt.Errorf("error opening wallet: %w", err)
+			}
+		}
+
+		bet, err = bot.BetService.WithTx(tx).CreateBet(ctx, pollID, user.GetID(), optionIndex, stake)
+		return err
+	})
 	if betErr != nil {
+		var insufficientErr *wallet.InsufficientBalanceError
+		if errors.As(betErr, &insufficientErr) {
+			bot.sendInteractionResponse(ctx, i, fmt.Sprintf("You cannot stake %d points, you only have %d.", insufficientErr.Amount, insufficientErr.Balance))
+			return
+		}
+
 		if errors.Is(betErr, bets.ErrUserAlreadyBet) {
-			if err := s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+			if err := bot.respondToInteraction(ctx, i, &discordgo.InteractionResponse{
 				Type: discordgo.InteractionResponseChannelMessageWithSource,
 				Data: &discordgo.InteractionResponseData{
 					Content: "You have already bet on this poll.",
@@ -28,10 +58,11 @@ func handleBet(s *discordgo.Session, i *discordgo.InteractionCreate, bot *Bot, p
 			}); err != nil {
 				log.Printf("Error sending invalid action response: %v", err)
 			}
+			return
 		}
 
 		if errors.Is(betErr, bets.ErrPollIsClosed) {
-			if err := s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+			if err := bot.respondToInteraction(ctx, i, &discordgo.InteractionResponse{
 				Type: discordgo.InteractionResponseChannelMessageWithSource,
 				Data: &discordgo.InteractionResponseData{
 					Content: "This poll is closed. You cannot place a bet.",
@@ -40,88 +71,124 @@ func handleBet(s *discordgo.Session, i *discordgo.InteractionCreate, bot *Bot, p
 			}); err != nil {
 				log.Printf("Error sending poll is closed response: %v", err)
 			}
+			return
+		}
 
+		if errors.Is(betErr, bets.ErrPollIsCancelled) {
+			bot.sendInteractionResponse(ctx, i, "This poll was cancelled. You cannot place a bet.")
+			return
 		}
 
 		log.Printf("Error creating bet: %v", betErr)
+		bot.sendInteractionResponse(ctx, i, "Your bet could not be placed. Please try again.")
 		return
 	}
 
 	log.Printf("Bet created: %v", bet)
 
-	if err := s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+	confirmation := "Bet submitted."
+	if bet.GetStake() > 0 {
+		confirmation = fmt.Sprintf("Bet of %d points submitted", bet.GetStake())
+		if userWallet, err := bot.WalletService.GetWallet(ctx, i.GuildID, user.GetID()); err == nil {
+			confirmation += fmt.Sprintf(". You have %d points left.", userWallet.GetBalance())
+		} else {
+			log.Printf("Error getting wallet: %v", err)
+		}
+	}
+
+	if err := bot.respondToInteraction(ctx, i, &discordgo.InteractionResponse{
 		Type: discordgo.InteractionResponseChannelMessageWithSource,
 		Data: &discordgo.InteractionResponseData{
-			Content: "Bet submitted",
+			Content: confirmation,
 			Flags:   discordgo.MessageFlagsEphemeral,
 		},
 	}); err != nil {
 		log.Printf("Error sending bet confirmation: %v", err)
 	}
+
+	bot.refreshPollMessage(ctx, pollID)
 }
 
-func handleEndPoll(s *discordgo.Session, i *discordgo.InteractionCreate, bot *Bot, pollID string) {
-	if doesNotHaveManageMemberPerm(s, i) {
+func handleEndPoll(ctx context.Context, s *discordgo.Session, i *discordgo.InteractionCreate, bot *Bot, pollID string) {
+	if bot.doesNotHavePermission(ctx, i, permissions.ClosePoll, pollID) {
 		return
 	}
 
-	if err := bot.PollService.ClosePoll(pollID); err != nil {
+	if err := bot.PollService.ClosePoll(ctx, pollID); err != nil {
 		if errors.Is(err, polls.ErrPollIsAlreadyClosed) {
 			log.Printf("Poll \"%s\" is already closed", pollID)
 
-			sendInteractionResponse(s, i, "The poll is already closed")
+			bot.sendInteractionResponse(ctx, i, "The poll is already closed")
 
 			return
 		}
 		log.Printf("Error closing poll: %v", err)
+		bot.sendInteractionResponse(ctx, i, "The poll could not be closed. Please try again.")
 		return
 	}
 
-	sendInteractionResponse(s, i, "The poll is closed")
+	// The deadline timer is only stopped once the poll is closed, so a poll
+	// that failed to close still closes at its deadline.
+	bot.Scheduler.Cancel(pollID)
 
-	log.Printf("User %s ended poll %s", i.Member.User.GlobalName, pollID)
+	bot.sendInteractionResponse(ctx, i, "The poll is closed")
+
+	log.Printf("User %s ended poll %s", interactionUser(i).GlobalName, pollID)
+
+	bot.refreshPollMessage(ctx, pollID)
 }
 
-func (bot *Bot) handleSelectOutcomeButton(s *discordgo.Session, i *discordgo.InteractionCreate, pollID string) {
-	if doesNotHaveManageMemberPerm(s, i) {
+func (bot *Bot) handleSelectOutcomeButton(ctx context.Context, s *discordgo.Session, i *discordgo.InteractionCreate, pollID string) {
+	if bot.doesNotHavePermission(ctx, i, permissions.ResolvePoll, pollID) {
 		return
 	}
 
-	poll, pollErr := bot.PollService.GetPollById(pollID)
+	poll, pollErr := bot.PollService.GetPollById(ctx, pollID)
+	if errors.Is(pollErr, polls.ErrPollNotFound) {
+		bot.sendInteractionResponse(ctx, i, "This poll no longer exists.")
+		return
+	}
 	if pollErr != nil {
 		log.Printf("Error getting poll: %v", pollErr)
+		bot.sendInteractionResponse(ctx, i, "The poll could not be loaded. Please try again.")
 		return
 	}
 
 	if poll.GetStatus() == polls.Open {
-		sendInteractionResponse(s, i, "The poll is still open. You cannot select an outcome.")
+		bot.sendInteractionResponse(ctx, i, "The poll is still open. You cannot select an outcome.")
+		return
 	}
 
-	textDisplay := NewTextDisplay("Choose the outcome of the poll")
+	if poll.GetStatus() == polls.Cancelled {
+		bot.sendInteractionResponse(ctx, i, "The poll was cancelled. You cannot select an outcome.")
+		return
+	}
+
+	// Once an outcome is selected, picking another one corrects it instead.
+	prompt := "Choose the outcome of the poll"
+	customID := fmt.Sprintf("select:%s", pollID)
+	if poll.GetOutcome() != polls.Pending {
+		prompt = fmt.Sprintf(
+			"The outcome is currently **%s**. Choose the corrected outcome and every bet will be re-settled.",
+			poll.GetOptions()[poll.GetOutcome()],
+		)
+		customID = fmt.Sprintf("correct:%s", pollID)
+	}
+
+	textDisplay := NewTextDisplay(prompt)
 
 	selectOutcomeDropdown := NewStringSelect(
 		"Select An Outcome",
 		1,
 		1,
-		fmt.Sprintf("select:%s", pollID),
-		[]interface{}{
-			&StringOption{
-				Label:       poll.GetOptions()[0],
-				Value:       "1",
-				Description: "Option 1",
-			},
-			&StringOption{
-				Label:       poll.GetOptions()[1],
-				Value:       "2",
-				Description: "Option 2",
-			},
-		},
+		customID,
+		newOptionSelectList(poll.GetOptions()),
 	)
 
 	actionRow := NewActionRow([]interface{}{selectOutcomeDropdown})
 
 	messageContainer := NewContainer(
-		0xe32458,
+		bot.accentColour(ctx, i.GuildID),
 		[]interface{}{
 			textDisplay,
 			actionRow,
@@ -137,86 +204,355 @@ func (bot *Bot) handleSelectOutcomeButton(s *discordgo.Session, i *discordgo.Int
 		},
 	}
 
-	response := NewInteractionResponse(ChannelMessageWithSource, message)
-
-	jsonMessage, jsonErr := json.Marshal(response)
-	if jsonErr != nil {
-		log.Printf("Error marshaling selectOutcomeDropdown: %v", jsonErr)
-		return
+	if err := bot.sendInteractionCallback(ctx, i, ChannelMessageWithSource, message); err != nil {
+		log.Printf("Error sending select outcome dropdown: %v", err)
 	}
-
-	interactionID := i.ID
-	interactionToken := i.Token
-	url := fmt.Sprintf("https://discord.com/api/v10/interactions/%s/%s/callback", interactionID, interactionToken)
-	sendHttpRequest(url, jsonMessage)
 }
 
-func (bot *Bot) handleSelectOutcomeDropdown(s *discordgo.Session, i *discordgo.InteractionCreate) {
+func (bot *Bot) handleSelectOutcomeDropdown(ctx context.Context, s *discordgo.Session, i *discordgo.InteractionCreate) {
 	customID := i.MessageComponentData().CustomID
 	messageData := strings.Split(customID, ":")
 	pollID := messageData[1]
+	if bot.doesNotHavePermission(ctx, i, permissions.ResolvePoll, pollID) {
+		return
+	}
+
 	optionIndex, err := strconv.Atoi(i.MessageComponentData().Values[0])
 	if err != nil {
 		log.Printf("Error parsing option index: %v", err)
+		bot.sendInteractionResponse(ctx, i, "That is not one of the poll's options.")
+		return
+	}
+
+	if err := bot.BetService.SettlePoll(ctx, pollID, polls.OutcomeStatus(optionIndex)); err != nil {
+		if errors.Is(err, bets.ErrPollIsOpen) {
+			bot.sendInteractionResponse(ctx, i, "The poll is still open. You cannot select an outcome.")
+			return
+		}
+		if errors.Is(err, bets.ErrOutcomeAlreadySelected) {
+			bot.sendInteractionResponse(ctx, i, "The outcome has already been selected. Press Select Outcome again to correct it.")
+			return
+		}
+		if errors.Is(err, bets.ErrPollIsCancelled) {
+			bot.sendInteractionResponse(ctx, i, "The poll was cancelled, so it has no outcome.")
+			return
+		}
+		if errors.Is(err, bets.ErrInvalidOutcome) {
+			bot.sendInteractionResponse(ctx, i, "That is not one of the poll's options.")
+			return
+		}
+		if errors.Is(err, polls.ErrPollNotFound) {
+			bot.sendInteractionResponse(ctx, i, "This poll no longer exists.")
+			return
+		}
+		log.Printf("Error settling poll: %v", err)
+		bot.sendInteractionResponse(ctx, i, "The outcome could not be selected. Please try again.")
 		return
 	}
 
-	poll, pollErr := bot.PollService.GetPollById(pollID)
+	bot.sendInteractionResponse(ctx, i, "The outcome of the poll has been selected and all bets have been settled.")
+
+	// The bets are settled, so a poll that cannot be read back only misses
+	// its announcement.
+	poll, pollErr := bot.PollService.GetPollById(ctx, pollID)
 	if pollErr != nil {
 		log.Printf("Error getting poll: %v", pollErr)
 		return
 	}
 
-	var pollOutcome polls.OutcomeStatus
-	switch optionIndex {
-	case 1:
-		pollOutcome = polls.Option1
-	case 2:
-		pollOutcome = polls.Option2
-	default:
-		log.Panicf("Invalid option index: %d", optionIndex)
+	bot.announce(ctx, i.GuildID, i.ChannelID, fmt.Sprintf(
+		"Outcome for **%s** has been decided.\n\nThe outcome is **%s**.",
+		poll.GetTitle(),
+		poll.GetOptions()[poll.GetOutcome()],
+	))
+
+	bot.refreshPollMessage(ctx, pollID)
+}
+
+func (bot *Bot) handleCorrectOutcomeDropdown(ctx context.Context, s *discordgo.Session, i *discordgo.InteractionCreate, pollID string) {
+	if bot.doesNotHavePermission(ctx, i, permissions.ResolvePoll, pollID) {
+		return
+	}
+
+	optionIndex, err := strconv.Atoi(i.MessageComponentData().Values[0])
+	if err != nil {
+		log.Printf("Error parsing option index: %v", err)
+		bot.sendInteractionResponse(ctx, i, "That is not one of the poll's options.")
+		return
 	}
 
-	if err := bot.PollService.SelectOutcome(pollID, pollOutcome); err != nil {
-		log.Printf("Error selecting outcome: %v", err)
+	moderator, userErr := bot.getOrCreateUser(ctx, interactionUser(i).ID)
+	if userErr != nil {
+		log.Printf("Error getting user: %v", userErr)
+		bot.sendInteractionResponse(ctx, i, "The outcome could not be corrected. Please try again.")
 		return
 	}
 
-	poll, pollErr = bot.PollService.GetPollById(pollID)
-	if pollErr != nil {
-		log.Panicf("Error getting poll: %v", pollErr)
+	correction, correctErr := bot.BetService.CorrectOutcome(ctx, pollID, polls.OutcomeStatus(optionIndex), moderator.GetID())
+	if correctErr != nil {
+		switch {
+		case errors.Is(correctErr, polls.ErrOutcomeUnchanged):
+			bot.sendInteractionResponse(ctx, i, "The poll already has this outcome.")
+		case errors.Is(correctErr, polls.ErrOutcomeNotSelected):
+			bot.sendInteractionResponse(ctx, i, "The poll has no outcome to correct. It may have been cancelled.")
+		case errors.Is(correctErr, polls.ErrInvalidOutcome):
+			bot.sendInteractionResponse(ctx, i, "That is not one of the poll's options.")
+		case errors.Is(correctErr, polls.ErrPollNotFound):
+			bot.sendInteractionResponse(ctx, i, "This poll no longer exists.")
+		default:
+			log.Printf("Error correcting outcome: %v", correctErr)
+			bot.sendInteractionResponse(ctx, i, "The outcome could not be corrected. Please try again.")
+		}
+		return
 	}
 
-	sendInteractionResponse(s, i, "The outcome of the poll has been selected.")
+	bot.sendInteractionResponse(ctx, i, "The outcome has been corrected and all bets have been re-settled.")
+
+	log.Printf("User %s corrected the outcome of poll %s", interactionUser(i).GlobalName, pollID)
 
-	messageString := NewTextDisplay(fmt.Sprintf(
-		"Outcome for **%s** between **%s** and **%s** has been decided.\n\nThe outcome is **%s**.",
+	// The bets are re-settled, so a poll that cannot be read back only misses
+	// its announcement.
+	poll, pollErr := bot.PollService.GetPollById(ctx, pollID)
+	if pollErr != nil {
+		log.Printf("Error getting poll: %v", pollErr)
+		return
+	}
+
+	bot.announce(ctx, i.GuildID, i.ChannelID, fmt.Sprintf(
+		"**Correction** for **%s**: the outcome was changed from **%s** to **%s** by <@%s>.\n\nAll bets have been re-settled.",
 		poll.GetTitle(),
-		poll.GetOptions()[0],
-		poll.GetOptions()[1],
-		poll.GetOptions()[poll.GetOutcome()],
+		poll.GetOptions()[correction.PreviousOutcome],
+		poll.GetOptions()[correction.NewOutcome],
+		interactionUser(i).ID,
 	))
 
+	bot.refreshPollMessage(ctx, pollID)
+}
+
+// handleCancelPollButton asks the moderator to confirm before the poll is voided.
+func (bot *Bot) handleCancelPollButton(ctx context.Context, s *discordgo.Session, i *discordgo.InteractionCreate, pollID string) {
+	if bot.doesNotHavePermission(ctx, i, permissions.VoidPoll, pollID) {
+		return
+	}
+
+	confirmButton := NewButton(
+		4,
+		"Yes, cancel the poll",
+		fmt.Sprintf("void:%s", pollID),
+	)
+
 	messageContainer := NewContainer(
-		0xe32458,
+		bot.accentColour(ctx, i.GuildID),
 		[]interface{}{
-			messageString,
+			NewTextDisplay("Cancelling the poll voids every bet on it. This cannot be undone."),
+			NewActionRow([]interface{}{confirmButton}),
 		},
 	)
 
-	const permissions = IsComponentsV2
-	messageSend := MessageSend{
-		Flags: permissions,
+	message := MessageSend{
+		Flags: IsComponentsV2 | MessageIsEphemeral,
+		Components: []interface{}{
+			messageContainer,
+		},
+	}
+
+	if err := bot.sendInteractionCallback(ctx, i, ChannelMessageWithSource, message); err != nil {
+		log.Printf("Error sending cancel confirmation: %v", err)
+	}
+}
+
+func (bot *Bot) handleVoidPoll(ctx context.Context, s *discordgo.Session, i *discordgo.InteractionCreate, pollID string) {
+	if bot.doesNotHavePermission(ctx, i, permissions.VoidPoll, pollID) {
+		return
+	}
+
+	poll, pollErr := bot.PollService.GetPollById(ctx, pollID)
+	if errors.Is(pollErr, polls.ErrPollNotFound) {
+		bot.sendInteractionResponse(ctx, i, "This poll no longer exists.")
+		return
+	}
+	if pollErr != nil {
+		log.Printf("Error getting poll: %v", pollErr)
+		bot.sendInteractionResponse(ctx, i, "The poll could not be cancelled. Please try again.")
+		return
+	}
+
+	if poll.GetStatus() == polls.Cancelled {
+		bot.sendInteractionResponse(ctx, i, "The poll is already cancelled")
+		return
+	}
+
+	bot.Scheduler.Cancel(pollID)
+
+	if err := bot.BetService.VoidPoll(ctx, pollID); err != nil {
+		if errors.Is(err, polls.ErrPollIsAlreadyCancelled) {
+			bot.sendInteractionResponse(ctx, i, "The poll is already cancelled")
+			return
+		}
+		log.Printf("Error voiding poll: %v", err)
+		bot.sendInteractionResponse(ctx, i, "The poll could not be cancelled. Please try again.")
+		return
+	}
+
+	bot.sendInteractionResponse(ctx, i, "The poll is cancelled and all bets have been voided")
+
+	log.Printf("User %s cancelled poll %s", interactionUser(i).GlobalName, pollID)
+
+	bot.refreshPollMessage(ctx, pollID)
+}
+
+// sendChangeBetPrompt offers a user who already bet on the poll to switch their
+// bet to the option they just picked, or to withdraw it.
+func (bot *Bot) sendChangeBetPrompt(ctx context.Context, i *discordgo.InteractionCreate, pollID string, existingBet bets.Bet, optionIndex int) {
+	poll, pollErr := bot.PollService.GetPollById(ctx, pollID)
+	if pollErr != nil {
+		log.Printf("Error getting poll: %v", pollErr)
+		bot.sendInteractionResponse(ctx, i, "Your bet could not be loaded. Please try again.")
+		return
+	}
+
+	options := poll.GetOptions()
+	currentOption := options[existingBet.GetSelectedOptionIndex()]
+
+	withdrawButton := NewButton(
+		4,
+		"Withdraw Bet",
+		fmt.Sprintf("withdraw:%s", pollID),
+	)
+
+	prompt := fmt.Sprintf("You already bet on **%s**.", currentOption)
+	if existingBet.GetStake() > 0 {
+		prompt = fmt.Sprintf("You already bet %d points on **%s**.", existingBet.GetStake(), currentOption)
+	}
+
+	var buttons []interface{}
+	if optionIndex == existingBet.GetSelectedOptionIndex() || optionIndex < 0 || optionIndex >= len(options) {
+		buttons = []interface{}{withdrawButton}
+	} else {
+		prompt += fmt.Sprintf(" Switch your bet to **%s**?", options[optionIndex])
+		if existingBet.GetStake() > 0 {
+			prompt += " Your stake moves with it."
+		}
+		switchButton := NewButton(
+			1,
+			fmt.Sprintf("Switch to %s", options[optionIndex]),
+			fmt.Sprintf("switch:%s:%d", pollID, optionIndex),
+		)
+		buttons = []interface{}{switchButton, withdrawButton}
+	}
+
+	messageContainer := NewContainer(
+		bot.accentColour(ctx, i.GuildID),
+		[]interface{}{
+			NewTextDisplay(prompt),
+			NewActionRow(buttons),
+		},
+	)
+
+	message := MessageSend{
+		Flags: IsComponentsV2 | MessageIsEphemeral,
 		Components: []interface{}{
 			messageContainer,
 		},
 	}
 
-	jsonMessage, jsonErr := json.Marshal(messageSend)
-	if jsonErr != nil {
-		log.Panicf("Error marshaling selectOutcomeDropdown:%v", jsonErr)
+	if err := bot.sendInteractionCallback(ctx, i, ChannelMessageWithSource, message); err != nil {
+		log.Printf("Error sending change bet prompt: %v", err)
+	}
+}
+
+func (bot *Bot) handleSwitchBet(ctx context.Context, s *discordgo.Session, i *discordgo.InteractionCreate, pollID string) {
+	switchData := strings.Split(i.MessageComponentData().CustomID, ":")
+	if len(switchData) != 3 {
+		log.Printf("Invalid switch bet custom ID: %s", i.MessageComponentData().CustomID)
+		bot.sendInteractionResponse(ctx, i, "Your bet could not be switched. Please try again.")
+		return
+	}
+
+	optionIndex, err := strconv.Atoi(switchData[2])
+	if err != nil {
+		log.Printf("Invalid option index in switch bet custom ID: %v", err)
+		bot.sendInteractionResponse(ctx, i, "Your bet could not be switched. Please try again.")
+		return
+	}
+
+	user, err := bot.getOrCreateUser(ctx, interactionUser(i).ID)
+	if err != nil {
+		log.Printf("Error getting user: %v", err)
+		bot.sendInteractionResponse(ctx, i, "Your bet could not be switched. Please try again.")
+		return
+	}
+
+	changedBet, changeErr := bot.BetService.ChangeBet(ctx, pollID, user.GetID(), optionIndex)
+	if changeErr != nil {
+		switch {
+		case errors.Is(changeErr, bets.ErrPollIsClosed):
+			bot.sendInteractionResponse(ctx, i, "This poll is closed. You can no longer change your bet.")
+		case errors.Is(changeErr, bets.ErrBetNotFound):
+			bot.sendInteractionResponse(ctx, i, "You no longer have a bet on this poll.")
+		case errors.Is(changeErr, bets.ErrBetUnchanged):
+			bot.sendInteractionResponse(ctx, i, "Your bet is already on that option.")
+		default:
+			log.Printf("Error changing bet: %v", changeErr)
+			bot.sendInteractionResponse(ctx, i, "Your bet could not be switched. Please try again.")
+		}
+		return
+	}
+
+	// The bet is already switched, so it is confirmed even when the poll
+	// cannot be read back to name the new option.
+	confirmation := "Your bet was switched."
+	if poll, pollErr := bot.PollService.GetPollById(ctx, pollID); pollErr == nil {
+		newOption := poll.GetOptions()[changedBet.GetSelectedOptionIndex()]
+		confirmation = fmt.Sprintf("Your bet is now on **%s**.", newOption)
+		if changedBet.GetStake() > 0 {
+			confirmation = fmt.Sprintf("Your bet of %d points is now on **%s**.", changedBet.GetStake(), newOption)
+		}
+	} else {
+		log.Printf("Error getting poll: %v", pollErr)
+	}
+	bot.sendInteractionResponse(ctx, i, confirmation)
+
+	bot.refreshPollMessage(ctx, pollID)
+}
+
+func (bot *Bot) handleWithdrawBet(ctx context.Context, s *discordgo.Session, i *discordgo.InteractionCreate, pollID string) {
+	user, err := bot.getOrCreateUser(ctx, interactionUser(i).ID)
+	if err != nil {
+		log.Printf("Error getting user: %v", err)
+		bot.sendInteractionResponse(ctx, i, "Your bet could not be withdrawn. Please try again.")
+		return
+	}
+
+	existingBet, betErr := bot.BetService.GetBet(ctx, pollID, user.GetID())
+	if errors.Is(betErr, bets.ErrBetNotFound) {
+		bot.sendInteractionResponse(ctx, i, "You no longer have a bet on this poll.")
+		return
+	}
+	if betErr != nil {
+		log.Printf("Error getting bet: %v", betErr)
+		bot.sendInteractionResponse(ctx, i, "Your bet could not be withdrawn. Please try again.")
+		return
+	}
+
+	if err := bot.BetService.WithdrawBet(ctx, pollID, user.GetID()); err != nil {
+		switch {
+		case errors.Is(err, bets.ErrPollIsClosed):
+			bot.sendInteractionResponse(ctx, i, "This poll is closed. You can no longer withdraw your bet.")
+		case errors.Is(err, bets.ErrBetNotFound):
+			bot.sendInteractionResponse(ctx, i, "You no longer have a bet on this poll.")
+		default:
+			log.Printf("Error withdrawing bet: %v", err)
+			bot.sendInteractionResponse(ctx, i, "Your bet could not be withdrawn. Please try again.")
+		}
+		return
+	}
+
+	if existingBet.GetStake() > 0 {
+		bot.sendInteractionResponse(ctx, i, fmt.Sprintf("Your bet was withdrawn and %d points were refunded.", existingBet.GetStake()))
+	} else {
+		bot.sendInteractionResponse(ctx, i, "Your bet was withdrawn.")
 	}
 
-	url := createMessageAPI(i.ChannelID)
-	sendHttpRequest(url, jsonMessage)
+	bot.refreshPollMessage(ctx, pollID)
 }
@@ -1,31 +1,45 @@
 package main
 
 import (
-	"encoding/json"
+	"context"
+	"errors"
 	"fmt"
 	"log"
+	"strconv"
+	"strings"
+	"time"
 
+	"betting-discord-bot/internal/bets"
+	"betting-discord-bot/internal/permissions"
 	"betting-discord-bot/internal/polls"
 	"github.com/bwmarrin/discordgo"
 )
 
+// maxOptionLength keeps "Bet on <option>" within Discord's 80 character button label limit.
+const maxOptionLength = 50
+
+// maxBetButtons is the number of buttons Discord fits in a single action row.
+// Polls with more options get a select menu instead.
+const maxBetButtons = 5
+
 func pollModalComponents() []discordgo.MessageComponent {
 	return []discordgo.MessageComponent{
-		newTextInputRow("title", "Poll Title", "Who will win the grand finals?", 50),
-		newTextInputRow("option1", "First Option", "", 20),
-		newTextInputRow("option2", "Second Option", "", 20),
+		newTextInputRow("title", "Poll Title", "Who will win the grand finals?", discordgo.TextInputShort, 50, true),
+		newTextInputRow("options", "Options (one per line)", "Team A\nTeam B", discordgo.TextInputParagraph, 1300, true),
+		newTextInputRow("closes_in", "Close Betting After (optional)", "90m, 2h or 1h30m", discordgo.TextInputShort, 10, false),
+		newTextInputRow("category", "Category (optional)", "Valorant", discordgo.TextInputShort, polls.MaxCategoryLength, false),
 	}
 }
 
-func newTextInputRow(customID, label, placeholder string, maxLength int) discordgo.ActionsRow {
+func newTextInputRow(customID, label, placeholder string, style discordgo.TextInputStyle, maxLength int, required bool) discordgo.ActionsRow {
 	return discordgo.ActionsRow{
 		Components: []discordgo.MessageComponent{
 			&discordgo.TextInput{
 				CustomID:    customID,
 				Label:       label,
 				Placeholder: placeholder,
-				Style:       discordgo.TextInputShort,
-				Required:    true,
+				Style:       style,
+				Required:    required,
 				MaxLength:   maxLength,
 			},
 		},
@@ -33,98 +47,230 @@ func newTextInputRow(customID, label, placeholder string, maxLength int) discord
 }
 
 // handlePollModalSubmit processes the data from the poll creation modal.
-func (bot *Bot) handlePollModalSubmit(s *discordgo.Session, i *discordgo.InteractionCreate) {
+func (bot *Bot) handlePollModalSubmit(ctx context.Context, s *discordgo.Session, i *discordgo.InteractionCreate) {
 	log.Println("A user submitted a poll modal")
 
+	if bot.doesNotHavePermission(ctx, i, permissions.CreatePoll, "") {
+		return
+	}
+
 	data := i.ModalSubmitData()
 
 	// Safely parse the data from the modal.
-	var title, option1, option2 string
+	var title, rawOptions, rawClosesIn, category string
 	for _, row := range data.Components {
 		input := row.(*discordgo.ActionsRow).Components[0].(*discordgo.TextInput)
 		switch input.CustomID {
 		case "title":
 			title = input.Value
-		case "option1":
-			option1 = input.Value
-		case "option2":
-			option2 = input.Value
+		case "options":
+			rawOptions = input.Value
+		case "closes_in":
+			rawClosesIn = input.Value
+		case "category":
+			category = input.Value
+		}
+	}
+
+	options := parsePollOptions(rawOptions)
+
+	log.Printf("Poll submitted: Title='%s', Options=%q, ClosesIn='%s'", title, options, rawClosesIn)
+
+	closesAt, closesAtErr := parseClosesAt(rawClosesIn, bot.guildSettings(ctx, i.GuildID).DefaultPollDuration, time.Now())
+	if closesAtErr != nil {
+		bot.sendInteractionResponse(ctx, i, "The close time must be a duration such as 90m, 2h or 1h30m.")
+		return
+	}
+
+	for _, option := range options {
+		if len(option) > maxOptionLength {
+			bot.sendInteractionResponse(ctx, i, fmt.Sprintf("Options can be at most %d characters long.", maxOptionLength))
+			return
 		}
 	}
 
-	log.Printf("Poll submitted: Title='%s', Option1='%s', Option2='%s'", title, option1, option2)
+	creator, err := bot.getOrCreateUser(ctx, interactionUser(i).ID)
+	if err != nil {
+		log.Printf("Error getting user: %v", err)
+		bot.sendInteractionResponse(ctx, i, "The poll could not be created. Please try again.")
+		return
+	}
 
-	poll, err := bot.PollService.CreatePoll(title, []string{option1, option2})
+	poll, err := bot.PollService.CreatePoll(ctx, i.GuildID, creator.GetID(), title, options, closesAt, category)
 	if err != nil {
+		if errors.Is(err, polls.ErrInvalidOptionCount) {
+			bot.sendInteractionResponse(ctx, i, fmt.Sprintf("A poll needs between %d and %d options, one per line.", polls.MinOptions, polls.MaxOptions))
+			return
+		}
+		if errors.Is(err, polls.ErrDeadlineInPast) {
+			bot.sendInteractionResponse(ctx, i, "The close time must be in the future.")
+			return
+		}
+		if errors.Is(err, polls.ErrCategoryTooLong) {
+			bot.sendInteractionResponse(ctx, i, fmt.Sprintf("Categories can be at most %d characters long.", polls.MaxCategoryLength))
+			return
+		}
 		log.Printf("Error creating poll: %v", err)
+		bot.sendInteractionResponse(ctx, i, "The poll could not be created. Please try again.")
 		return
 	}
 
 	responseMessage := "Reminder: You must end the poll before you are allowed to select an outcome."
-	sendInteractionResponse(s, i, responseMessage)
+	bot.sendInteractionResponse(ctx, i, responseMessage)
+
+	bot.sendPollMessage(ctx, poll, i)
 
-	sendPollMessage(title, option1, option2, poll, i)
+	if !poll.GetClosesAt().IsZero() {
+		bot.Scheduler.Schedule(poll.GetID(), poll.GetClosesAt())
+	}
 }
 
-func sendPollMessage(title string, option1 string, option2 string, poll polls.Poll, i *discordgo.InteractionCreate) {
-	pollString := fmt.Sprintf("# %s\n-# Warning: You cannot change your bet after submission.", title)
-	pollTitle := NewTextDisplay(pollString)
-
-	option1Button := NewButton(
-		2,
-		fmt.Sprintf("Bet on %s", option1),
-		fmt.Sprintf("bet:%s:0", poll.GetID()),
-	)
-
-	option2Button := NewButton(
-		2,
-		fmt.Sprintf("Bet on %s", option2),
-		fmt.Sprintf("bet:%s:1", poll.GetID()),
-	)
-
-	endPollButton := NewButton(
-		4,
-		"End Poll",
-		fmt.Sprintf("bet:%s:2", poll.GetID()),
-	)
-
-	selectOutcomeButton := NewButton(
-		4,
-		"Select Outcome",
-		fmt.Sprintf("bet:%s:3", poll.GetID()),
-	)
-
-	buttons := NewActionRow(
-		[]interface{}{
-			option1Button,
-			option2Button,
-			endPollButton,
-			selectOutcomeButton,
-		},
-	)
+// parsePollOptions splits the options text input into one option per non-empty line.
+func parsePollOptions(rawOptions string) []string {
+	var options []string
+	for _, line := range strings.Split(rawOptions, "\n") {
+		if option := strings.TrimSpace(line); option != "" {
+			options = append(options, option)
+		}
+	}
+	return options
+}
 
-	container := NewContainer(
-		0xe32458,
-		[]interface{}{
-			pollTitle,
-			buttons,
-		},
-	)
+// parseClosesAt turns the optional "close betting after" input into a deadline.
+// An empty input closes betting after the default duration, or means the poll
+// has no deadline if the default is zero.
+func parseClosesAt(rawClosesIn string, defaultDuration time.Duration, now time.Time) (time.Time, error) {
+	rawClosesIn = strings.TrimSpace(rawClosesIn)
+	if rawClosesIn == "" {
+		if defaultDuration == 0 {
+			return time.Time{}, nil
+		}
+		return now.Add(defaultDuration), nil
+	}
+
+	closesIn, err := time.ParseDuration(rawClosesIn)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	return now.Add(closesIn), nil
+}
+
+func (bot *Bot) sendPollMessage(ctx context.Context, poll polls.Poll, i *discordgo.InteractionCreate) {
+	ctx, cancel := followUp(ctx)
+	defer cancel()
+
+	message := renderPollMessage(poll, nil, bot.accentColour(ctx, poll.GetGuildID()), bot.mentioner(ctx))
+
+	channelID := i.ChannelID
+	sentMessage, err := bot.Discord.CreateMessage(ctx, channelID, message)
+	if err != nil {
+		log.Printf("Error sending poll message: %v", err)
+		return
+	}
 
-	message := MessageSend{
-		Flags: IsComponentsV2,
-		Components: []interface{}{
-			container,
+	pollMessage := PollMessage{
+		PollID:    poll.GetID(),
+		GuildID:   i.GuildID,
+		ChannelID: channelID,
+		MessageID: sentMessage.ID,
+	}
+	if err := bot.PollMessages.Save(ctx, pollMessage); err != nil {
+		log.Printf("Error saving poll message: %v", err)
+	}
+}
+
+// newOptionSelectList lists the poll options for a select menu. The value of
+// each entry is the option index.
+func newOptionSelectList(options []string) []interface{} {
+	selectOptions := make([]interface{}, len(options))
+	for index, option := range options {
+		selectOptions[index] = &StringOption{
+			Label:       option,
+			Value:       strconv.Itoa(index),
+			Description: fmt.Sprintf("Option %d", index+1),
+		}
+	}
+	return selectOptions
+}
+
+// showStakeModal asks how many points to wager on an option. The poll and
+// option are carried in the modal's custom ID ("stake_modal:<pollID>:<index>").
+func (bot *Bot) showStakeModal(ctx context.Context, s *discordgo.Session, i *discordgo.InteractionCreate, pollID string, optionIndex int, balance int64, odds bets.OptionOdds) {
+	modalData := &discordgo.InteractionResponseData{
+		CustomID: fmt.Sprintf("stake_modal:%s:%d", pollID, optionIndex),
+		Title:    "Place Your Bet",
+		Components: []discordgo.MessageComponent{
+			newTextInputRow("stake", stakeInputLabel(odds), fmt.Sprintf("You have %d points", balance), discordgo.TextInputShort, 18, true),
 		},
 	}
 
-	jsonMessage, jsonErr := json.Marshal(message)
-	if jsonErr != nil {
-		log.Printf("Error marshaling message: %v", jsonErr)
+	if err := bot.respondToInteraction(ctx, i, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseModal,
+		Data: modalData,
+	}); err != nil {
+		log.Printf("Error showing stake modal: %v", err)
+	}
+}
+
+// stakeInputLabel shows the live odds of the option. They move as others bet,
+// so the payout is only fixed once the poll is settled.
+func stakeInputLabel(odds bets.OptionOdds) string {
+	if odds.Staked == 0 {
+		return "Stake (no one has backed this option yet)"
+	}
+	return fmt.Sprintf("Stake (currently pays %.2fx)", odds.Odds)
+}
+
+// handleStakeModalSubmit places the bet with the stake entered in the stake modal.
+func (bot *Bot) handleStakeModalSubmit(ctx context.Context, s *discordgo.Session, i *discordgo.InteractionCreate) {
+	data := i.ModalSubmitData()
+
+	stakeData := strings.Split(data.CustomID, ":")
+	if len(stakeData) != 3 {
+		log.Printf("Invalid stake modal custom ID: %s", data.CustomID)
+		bot.sendInteractionResponse(ctx, i, "Your bet could not be placed. Please try again.")
 		return
 	}
 
-	channelID := i.ChannelID
-	url := fmt.Sprintf("https://discord.com/api/v10/channels/%s/messages", channelID)
-	sendHttpRequest(url, jsonMessage)
+	pollID := stakeData[1]
+	optionIndex, err := strconv.Atoi(stakeData[2])
+	if err != nil {
+		log.Printf("Invalid option index in stake modal custom ID: %s", data.CustomID)
+		bot.sendInteractionResponse(ctx, i, "Your bet could not be placed. Please try again.")
+		return
+	}
+
+	var rawStake string
+	for _, row := range data.Components {
+		input := row.(*discordgo.ActionsRow).Components[0].(*discordgo.TextInput)
+		if input.CustomID == "stake" {
+			rawStake = input.Value
+		}
+	}
+
+	if !bot.guildSettings(ctx, i.GuildID).StakesEnabled {
+		bot.sendInteractionResponse(ctx, i, "Stakes are turned off in this server. Press the bet button again to bet without one.")
+		return
+	}
+
+	stake, err := parseStake(rawStake)
+	if err != nil {
+		bot.sendInteractionResponse(ctx, i, "The stake must be a whole number of points above zero.")
+		return
+	}
+
+	handleBet(ctx, s, i, bot, pollID, optionIndex, stake)
+}
+
+// parseStake reads a positive whole number of points from the stake input.
+func parseStake(rawStake string) (int64, error) {
+	stake, err := strconv.ParseInt(strings.TrimSpace(rawStake), 10, 64)
+	if err != nil {
+		return 0, err
+	}
+	if stake <= 0 {
+		return 0, fmt.Errorf("stake must be above zero, got %d", stake)
+	}
+	return stake, nil
 }
@@ -0,0 +1,31 @@
+package main
+
+import "testing"
+
+func TestParseStake(t *testing.T) {
+	tests := []struct {
+		name      string
+		rawStake  string
+		wantStake int64
+		wantErr   bool
+	}{
+		{name: "Whole Number", rawStake: "250", wantStake: 250},
+		{name: "Surrounding Whitespace", rawStake: " 40 ", wantStake: 40},
+		{name: "Zero", rawStake: "0", wantErr: true},
+		{name: "Negative", rawStake: "-10", wantErr: true},
+		{name: "Not A Number", rawStake: "lots", wantErr: true},
+		{name: "Fraction", rawStake: "1.5", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stake, err := parseStake(tt.rawStake)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseStake(%q) error = %v, wantErr %v", tt.rawStake, err, tt.wantErr)
+			}
+			if stake != tt.wantStake {
+				t.Errorf("parseStake(%q) = %d, want %d", tt.rawStake, stake, tt.wantStake)
+			}
+		})
+	}
+}
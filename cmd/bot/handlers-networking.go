@@ -1,54 +1,74 @@
 package main
 
 import (
-	"bytes"
-	"fmt"
-	"io"
+	"context"
+	"errors"
 	"log"
-	"net/http"
-	"os"
+	"time"
+
+	"betting-discord-bot/internal/discord"
 
 	"github.com/bwmarrin/discordgo"
 )
 
-const DiscordApi = `https://discord.com/api/v10`
+// followUpTimeout bounds work done after an interaction was answered, such as
+// redrawing the poll message, and work done outside any interaction.
+const followUpTimeout = 30 * time.Second
 
-func sendHttpRequest(url string, jsonMessage []byte) {
-	request, requestErr := http.NewRequest("POST", url, bytes.NewBuffer(jsonMessage))
-	if requestErr != nil {
-		log.Printf("error creating request: %v", requestErr)
-		return
-	}
+// followUp detaches ctx from the interaction's reply deadline, for work that
+// carries on after the interaction was answered. The values of ctx are kept.
+func followUp(ctx context.Context) (context.Context, context.CancelFunc) {
+	return context.WithTimeout(context.WithoutCancel(ctx), followUpTimeout)
+}
+
+// announce posts a Components V2 message with a single text block to the
+// guild's announcement channel, or to channelID if the guild has none.
+func (bot *Bot) announce(ctx context.Context, guildID string, channelID string, content string) {
+	ctx, cancel := followUp(ctx)
+	defer cancel()
 
-	request.Header.Set("Content-Type", "application/json")
-	botToken := os.Getenv("TOKEN")
-	request.Header.Set("Authorization", fmt.Sprintf("Bot %s", botToken))
+	guildSettings := bot.guildSettings(ctx, guildID)
+	if guildSettings.AnnouncementChannelID != "" {
+		channelID = guildSettings.AnnouncementChannelID
+	}
 
-	log.Println("Sending manual HTTP request to Discord API...")
+	messageContainer := NewContainer(
+		guildSettings.AccentColour,
+		[]interface{}{
+			NewTextDisplay(content),
+		},
+	)
 
-	resp, err := http.DefaultClient.Do(request)
-	if err != nil {
-		log.Printf("error sending HTTP request to Discord: %v", err)
+	messageSend := MessageSend{
+		Flags: IsComponentsV2,
+		Components: []interface{}{
+			messageContainer,
+		},
 	}
 
-	defer func(Body io.ReadCloser) {
-		err := Body.Close()
-		if err != nil {
-			log.Printf("Error closing response body: %v", err)
-		}
-	}(resp.Body)
+	if _, err := bot.Discord.CreateMessage(ctx, channelID, messageSend); err != nil {
+		log.Printf("Error sending message to channel %s: %v", channelID, err)
+	}
+}
 
-	if resp.StatusCode < 200 || resp.StatusCode > 299 {
-		// If it's not a success, we read the error message Discord sent back.
-		bodyBytes, _ := io.ReadAll(resp.Body)
-		log.Printf("discord API returned a non-success status code %d: %s", resp.StatusCode, string(bodyBytes))
+// editPollMessage replaces the components of the message the poll was posted in.
+func (bot *Bot) editPollMessage(ctx context.Context, pollID string, message MessageSend) {
+	pollMessage, err := bot.PollMessages.GetByPollID(ctx, pollID)
+	if err != nil {
+		log.Printf("Error getting message of poll %s: %v", pollID, err)
 		return
 	}
 
-	log.Println("Successfully sent http request to Discord.")
+	if err := bot.Discord.EditMessage(ctx, pollMessage.ChannelID, pollMessage.MessageID, message); err != nil {
+		if errors.Is(err, discord.ErrNotFound) {
+			log.Printf("The message of poll %s was deleted, so it cannot be updated", pollID)
+			return
+		}
+		log.Printf("Error editing message of poll %s: %v", pollID, err)
+	}
 }
 
-func sendInteractionResponse(s *discordgo.Session, i *discordgo.InteractionCreate, message string) {
+func (bot *Bot) sendInteractionResponse(ctx context.Context, i *discordgo.InteractionCreate, message string) {
 	// Empty response
 	data := &discordgo.InteractionResponse{
 		Type: discordgo.InteractionResponseDeferredMessageUpdate,
@@ -65,11 +85,29 @@ func sendInteractionResponse(s *discordgo.Session, i *discordgo.InteractionCreat
 		}
 	}
 
-	if err := s.InteractionRespond(i.Interaction, data); err != nil {
+	if err := bot.respondToInteraction(ctx, i, data); err != nil {
 		log.Printf("Error sending interaction response: %v", err)
 	}
 }
 
-func createMessageAPI(channelID string) string {
-	return DiscordApi + fmt.Sprintf("/channels/%s/messages", channelID)
+// respondToInteraction answers an interaction with a discordgo response, such as a modal.
+func (bot *Bot) respondToInteraction(ctx context.Context, i *discordgo.InteractionCreate, response *discordgo.InteractionResponse) error {
+	return bot.answerInteraction(ctx, i, response)
+}
+
+// sendInteractionCallback answers an interaction with a Components V2 message.
+func (bot *Bot) sendInteractionCallback(ctx context.Context, i *discordgo.InteractionCreate, responseType InteractionCallbackType, message MessageSend) error {
+	return bot.answerInteraction(ctx, i, NewInteractionResponse(responseType, message))
+}
+
+// answerInteraction sends the response to an interaction. Interactions that
+// came in over the HTTP endpoint are answered in the body of their request
+// instead of through the REST API.
+func (bot *Bot) answerInteraction(ctx context.Context, i *discordgo.InteractionCreate, response any) error {
+	if reply, waiting := bot.pendingReplies.LoadAndDelete(i.ID); waiting {
+		reply.(chan any) <- response
+		return nil
+	}
+
+	return bot.Discord.CreateInteractionResponse(ctx, i.ID, i.Token, response)
 }
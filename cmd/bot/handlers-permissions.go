@@ -1,15 +1,92 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"log"
 
+	"betting-discord-bot/internal/permissions"
+
 	"github.com/bwmarrin/discordgo"
 )
 
-func doesNotHaveManageMemberPerm(s *discordgo.Session, i *discordgo.InteractionCreate) bool {
-	if (i.Member.Permissions & discordgo.PermissionManageMessages) != discordgo.PermissionManageMessages {
-		log.Printf("User \"%s\" does not have permission to end polls", i.Member.User.GlobalName)
-		sendInteractionResponse(s, i, "You do not have permission to edit polls")
+// actionDenials tell members which action the guild's policy kept them from.
+var actionDenials = map[permissions.Action]string{
+	permissions.CreatePoll:    "You do not have permission to create polls in this server.",
+	permissions.ClosePoll:     "You do not have permission to close polls in this server.",
+	permissions.ResolvePoll:   "You do not have permission to select the outcome of polls in this server.",
+	permissions.VoidPoll:      "You do not have permission to cancel polls in this server.",
+	permissions.AdjustBalance: "You do not have permission to adjust balances in this server.",
+	permissions.ViewLedger:    "You do not have permission to view ledgers in this server.",
+}
+
+// interactionUser returns who sent the interaction, whether it came from a
+// guild or from a DM.
+func interactionUser(i *discordgo.InteractionCreate) *discordgo.User {
+	if i.Member != nil {
+		return i.Member.User
+	}
+	return i.User
+}
+
+// doesNotHavePermission checks that the guild's policy lets the member take the
+// action, and tells them why not if it does not. Pass the poll the action is
+// taken on, or an empty string for actions not on a poll.
+func (bot *Bot) doesNotHavePermission(ctx context.Context, i *discordgo.InteractionCreate, action permissions.Action, pollID string) bool {
+	if i.Member == nil {
+		bot.sendInteractionResponse(ctx, i, "This can only be done in a server.")
+		return true
+	}
+
+	member := permissions.Member{RoleIDs: i.Member.Roles, Permissions: i.Member.Permissions}
+
+	// Only resolving a poll depends on who created it.
+	var pollCreatorID string
+	if action == permissions.ResolvePoll && pollID != "" {
+		poll, err := bot.PollService.GetPollById(ctx, pollID)
+		if err != nil {
+			log.Printf("Error getting poll: %v", err)
+			bot.sendInteractionResponse(ctx, i, "Your permissions could not be checked. Please try again.")
+			return true
+		}
+		pollCreatorID = poll.GetCreatorID()
+
+		user, err := bot.getOrCreateUser(ctx, i.Member.User.ID)
+		if err != nil {
+			log.Printf("Error getting user: %v", err)
+			bot.sendInteractionResponse(ctx, i, "Your permissions could not be checked. Please try again.")
+			return true
+		}
+		member.UserID = user.GetID()
+	}
+
+	err := bot.Permissions.Authorize(ctx, i.GuildID, member, action, pollCreatorID)
+	switch {
+	case err == nil:
+		return false
+	case errors.Is(err, permissions.ErrNotPollCreator):
+		bot.sendInteractionResponse(ctx, i, "Only the creator of this poll or a moderator can select its outcome.")
+	case errors.Is(err, permissions.ErrPermissionDenied):
+		bot.sendInteractionResponse(ctx, i, actionDenials[action])
+	default:
+		log.Printf("Error checking permissions: %v", err)
+		bot.sendInteractionResponse(ctx, i, "Your permissions could not be checked. Please try again.")
+		return true
+	}
+
+	log.Printf("User \"%s\" is not allowed to %s", i.Member.User.GlobalName, action)
+	return true
+}
+
+func (bot *Bot) doesNotHaveManageGuildPerm(ctx context.Context, i *discordgo.InteractionCreate) bool {
+	if i.Member == nil {
+		bot.sendInteractionResponse(ctx, i, "This can only be done in a server.")
+		return true
+	}
+
+	if (i.Member.Permissions & discordgo.PermissionManageGuild) != discordgo.PermissionManageGuild {
+		log.Printf("User \"%s\" does not have permission to change settings", i.Member.User.GlobalName)
+		bot.sendInteractionResponse(ctx, i, "You need the Manage Server permission to change the bot's settings.")
 		return true
 	}
 	return false
@@ -1,113 +1,235 @@
 package main
 
 import (
+	"context"
 	"errors"
+	"fmt"
 	"log"
 	"strconv"
 	"strings"
 
+	"betting-discord-bot/internal/bets"
 	"betting-discord-bot/internal/users"
 
 	"github.com/bwmarrin/discordgo"
 )
 
+// interactionHandler routes an interaction to its handler. The handler's
+// context expires when Discord stops waiting for the answer, so that a slow
+// call to storage is cancelled rather than answered too late.
 func (bot *Bot) interactionHandler(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	ctx, cancel := context.WithTimeout(context.Background(), interactionReplyTimeout)
+	defer cancel()
+
 	switch i.Type {
 	case discordgo.InteractionApplicationCommand:
-		bot.handleSlashCommands(s, i)
+		bot.handleSlashCommands(ctx, s, i)
 	case discordgo.InteractionModalSubmit:
 		// This is a modal submission
-		bot.handleModals(s, i)
+		bot.handleModals(ctx, s, i)
 	case discordgo.InteractionMessageComponent:
-		bot.handleMessageComponents(s, i)
+		bot.handleMessageComponents(ctx, s, i)
 	default:
 		log.Printf("Unknown interaction type received: %v", i.Type)
 	}
 }
 
-func (bot *Bot) handleSlashCommands(s *discordgo.Session, i *discordgo.InteractionCreate) {
+func (bot *Bot) handleSlashCommands(ctx context.Context, s *discordgo.Session, i *discordgo.InteractionCreate) {
 	commandName := i.ApplicationCommandData().Name
 	switch commandName {
 	case "create-poll":
-		bot.handleCreatePollCommand(s, i)
+		bot.handleCreatePollCommand(ctx, s, i)
+	case "leaderboard":
+		bot.handleLeaderboardCommand(ctx, i)
+	case "mybets":
+		bot.handleMyBetsCommand(ctx, i)
+	case "stats":
+		bot.handleStatsCommand(ctx, s, i)
+	case "export-my-data":
+		bot.handleExportMyDataCommand(ctx, i)
+	case "polls":
+		bot.handlePollsCommand(ctx, i)
+	case "config":
+		bot.handleConfigCommand(ctx, i)
+	case "adjust-balance":
+		bot.handleAdjustBalanceCommand(ctx, i)
+	case "ledger":
+		bot.handleLedgerCommand(ctx, i)
 	default:
 		log.Printf("Unknown slash command received: %s", commandName)
 	}
 }
 
-func (bot *Bot) handleModals(s *discordgo.Session, i *discordgo.InteractionCreate) {
+func (bot *Bot) handleModals(ctx context.Context, s *discordgo.Session, i *discordgo.InteractionCreate) {
 	customID := i.ModalSubmitData().CustomID
-	switch customID {
+	modalData := strings.Split(customID, ":")
+	switch modalData[0] {
 	case "poll_modal":
-		bot.handlePollModalSubmit(s, i)
+		bot.handlePollModalSubmit(ctx, s, i)
+	case "stake_modal":
+		bot.handleStakeModalSubmit(ctx, s, i)
 	default:
 		log.Printf("Unknown modal submission received: %s", customID)
 	}
 }
 
-func (bot *Bot) handleMessageComponents(s *discordgo.Session, i *discordgo.InteractionCreate) {
+func (bot *Bot) handleMessageComponents(ctx context.Context, s *discordgo.Session, i *discordgo.InteractionCreate) {
 	customID := i.MessageComponentData().CustomID
 	messageData := strings.Split(customID, ":")
+	if len(messageData) < 2 {
+		log.Printf("Invalid custom ID received: %s", customID)
+		return
+	}
+
+	pollID := messageData[1]
 	switch messageData[0] {
 	case "bet":
 		log.Println("Routing bet interaction")
-		bot.handleButtonPresses(s, i)
+		bot.handleBetInteraction(ctx, s, i, pollID)
+	case "end":
+		log.Println("Routing end poll interaction")
+		handleEndPoll(ctx, s, i, bot, pollID)
+	case "outcome":
+		log.Println("Routing select outcome interaction")
+		bot.handleSelectOutcomeButton(ctx, s, i, pollID)
+	case "cancel":
+		log.Println("Routing cancel poll interaction")
+		bot.handleCancelPollButton(ctx, s, i, pollID)
+	case "switch":
+		log.Println("Routing switch bet interaction")
+		bot.handleSwitchBet(ctx, s, i, pollID)
+	case "withdraw":
+		log.Println("Routing withdraw bet interaction")
+		bot.handleWithdrawBet(ctx, s, i, pollID)
+	case "void":
+		log.Println("Routing void poll interaction")
+		bot.handleVoidPoll(ctx, s, i, pollID)
 	case "select":
 		log.Println("Routing select interaction")
-		bot.handleSelectOutcomeDropdown(s, i)
+		bot.handleSelectOutcomeDropdown(ctx, s, i)
+	case "leaderboard":
+		log.Println("Routing leaderboard page interaction")
+		bot.handleLeaderboardPage(ctx, i, customID)
+	case "mybets":
+		log.Println("Routing my bets page interaction")
+		bot.handleMyBetsPage(ctx, i, customID)
+	case "polls":
+		log.Println("Routing polls page interaction")
+		bot.handlePollsPage(ctx, i, customID)
+	case "correct":
+		log.Println("Routing correct outcome interaction")
+		bot.handleCorrectOutcomeDropdown(ctx, s, i, pollID)
 	default:
 		log.Printf("Unknown interaction type received: %v", messageData[0])
 	}
 }
 
-func (bot *Bot) handleButtonPresses(s *discordgo.Session, i *discordgo.InteractionCreate) {
-	customID := i.MessageComponentData().CustomID
-	betData := strings.Split(customID, ":")
+// handleBetInteraction asks how many points to stake on the picked option. The
+// bet is placed once the stake modal is submitted, or straight away without a
+// stake if the guild turned stakes off. Users who already bet on the poll are
+// offered to switch or withdraw their bet instead. Users the bot has not seen
+// yet are only created once their bet is placed.
+func (bot *Bot) handleBetInteraction(ctx context.Context, s *discordgo.Session, i *discordgo.InteractionCreate, pollID string) {
+	optionIndex, err := parseBetOptionIndex(i.MessageComponentData())
+	if err != nil {
+		log.Printf("failed to parse bet option index: %v", err)
+		bot.sendInteractionResponse(ctx, i, "Your bet could not be placed. Please try again.")
+		return
+	}
 
-	if len(betData) != 3 {
-		log.Printf("Invalid custom ID received: %s", customID)
+	user, err := bot.resolveDiscordUser(ctx, interactionUser(i).ID)
+	if err != nil && !errors.Is(err, users.ErrUserNotFound) {
+		log.Printf("Error resolving user: %v", err)
+		bot.sendInteractionResponse(ctx, i, "Your bet could not be placed. Please try again.")
+		return
+	}
+
+	if user != nil {
+		existingBet, err := bot.BetService.GetBet(ctx, pollID, user.GetID())
+		if err == nil {
+			bot.sendChangeBetPrompt(ctx, i, pollID, existingBet, optionIndex)
+			return
+		}
+		if !errors.Is(err, bets.ErrBetNotFound) {
+			log.Printf("Error getting bet: %v", err)
+			bot.sendInteractionResponse(ctx, i, "Your bet could not be placed. Please try again.")
+			return
+		}
+	}
+
+	guildSettings := bot.guildSettings(ctx, i.GuildID)
+	if !guildSettings.StakesEnabled {
+		handleBet(ctx, s, i, bot, pollID, optionIndex, 0)
 		return
 	}
 
-	pollID := betData[1]
-	optionIndex, err := strconv.Atoi(betData[2])
+	balance := guildSettings.StartingBalance
+	if user != nil {
+		userWallet, err := bot.WalletService.OpenWallet(ctx, i.GuildID, user.GetID(), guildSettings.StartingBalance)
+		if err != nil {
+			log.Printf("Error getting wallet: %v", err)
+			bot.sendInteractionResponse(ctx, i, "Your bet could not be placed. Please try again.")
+			return
+		}
+		balance = userWallet.GetBalance()
+	}
+
+	odds, err := bot.BetService.GetImpliedOdds(ctx, pollID)
 	if err != nil {
-		log.Printf("failed to convert option index to int: %s", betData[2])
+		log.Printf("Error getting implied odds: %v", err)
+		bot.sendInteractionResponse(ctx, i, "Your bet could not be placed. Please try again.")
 		return
 	}
+	if optionIndex < 0 || optionIndex >= len(odds) {
+		bot.sendInteractionResponse(ctx, i, "That is not one of the poll's options.")
+		return
+	}
+
+	bot.showStakeModal(ctx, s, i, pollID, optionIndex, balance, odds[optionIndex])
+}
+
+// parseBetOptionIndex reads the option index from a bet button ("bet:<pollID>:<index>")
+// or from the value picked in the bet select menu ("bet:<pollID>").
+func parseBetOptionIndex(data discordgo.MessageComponentInteractionData) (int, error) {
+	betData := strings.Split(data.CustomID, ":")
+
+	switch {
+	case len(betData) == 3:
+		return strconv.Atoi(betData[2])
+	case len(betData) == 2 && len(data.Values) == 1:
+		return strconv.Atoi(data.Values[0])
+	default:
+		return 0, fmt.Errorf("invalid bet custom ID: %s", data.CustomID)
+	}
+}
 
-	userDiscordID := i.Member.User.ID
+// getOrCreateUser finds the internal user linked to a Discord account, creating
+// one on first contact.
+func (bot *Bot) getOrCreateUser(ctx context.Context, discordID string) (users.User, error) {
+	return getOrCreateDiscordUser(ctx, bot.UserService, discordID)
+}
 
+// getOrCreateDiscordUser is getOrCreateUser with the user service to use, so
+// that the user can be created as part of a unit of work.
+func getOrCreateDiscordUser(ctx context.Context, userService users.UserService, discordID string) (users.User, error) {
 	identity := users.Identity{
 		Provider:   "discord",
-		ExternalID: userDiscordID,
-	}
-
-	user, getUserErr := bot.UserService.GetUserByExternalID(identity)
-	if getUserErr != nil {
-		if errors.Is(getUserErr, users.ErrUserNotFound) {
-			var createUserErr error
-			user, createUserErr = bot.UserService.CreateUser(identity)
-			if createUserErr != nil {
-				log.Printf("Error creating user: %v", createUserErr)
-				return
-			}
-		} else {
-			log.Printf("Error getting user: %v", getUserErr)
-			return
-		}
+		ExternalID: discordID,
 	}
 
-	if optionIndex < 2 {
-		handleBet(s, i, bot, pollID, user, optionIndex)
-		return
+	user, getUserErr := userService.GetUserByExternalID(ctx, identity)
+	if getUserErr == nil {
+		return user, nil
 	}
 
-	if optionIndex == 2 {
-		handleEndPoll(s, i, bot, pollID)
+	if !errors.Is(getUserErr, users.ErrUserNotFound) {
+		return nil, getUserErr
 	}
 
-	if optionIndex == 3 {
-		bot.handleSelectOutcomeButton(s, i, pollID)
+	user, createUserErr := userService.CreateUser(ctx, identity)
+	if createUserErr != nil {
+		return nil, fmt.Errorf("error creating user: %w", createUserErr)
 	}
+
+	return user, nil
 }
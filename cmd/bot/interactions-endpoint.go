@@ -0,0 +1,126 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// interactionReplyTimeout is how long Discord waits for the answer to an interaction.
+const interactionReplyTimeout = 3 * time.Second
+
+// maxInteractionSize bounds the body of an interaction request.
+const maxInteractionSize = 1 << 20
+
+// interactionsPath is where the endpoint is served. The interactions endpoint
+// URL of the application must point here.
+const interactionsPath = "/interactions"
+
+// serveInteractions listens on listenAddr and serves the interactions endpoint
+// until the returned server is shut down.
+func (bot *Bot) serveInteractions(listenAddr string, publicKey ed25519.PublicKey) (*http.Server, error) {
+	listener, err := net.Listen("tcp", listenAddr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen on %s: %w", listenAddr, err)
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle(interactionsPath, bot.interactionsEndpoint(publicKey))
+
+	server := &http.Server{
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	go func() {
+		if err := server.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Printf("Interactions endpoint stopped: %v", err)
+		}
+	}()
+
+	log.Printf("Serving interactions on %s%s", listener.Addr(), interactionsPath)
+	return server, nil
+}
+
+// interactionsEndpoint serves Discord's outgoing webhook for interactions. It
+// verifies each request against the application's public key and routes the
+// interaction the same way as interactions from the gateway.
+func (bot *Bot) interactionsEndpoint(publicKey ed25519.PublicKey) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		r.Body = http.MaxBytesReader(w, r.Body, maxInteractionSize)
+		if !discordgo.VerifyInteraction(r, publicKey) {
+			http.Error(w, "invalid request signature", http.StatusUnauthorized)
+			return
+		}
+
+		var interaction discordgo.Interaction
+		if err := json.NewDecoder(r.Body).Decode(&interaction); err != nil {
+			http.Error(w, "invalid interaction", http.StatusBadRequest)
+			return
+		}
+
+		if interaction.Type == discordgo.InteractionPing {
+			writeInteractionReply(w, &discordgo.InteractionResponse{Type: discordgo.InteractionResponsePong})
+			return
+		}
+
+		bot.handleEndpointInteraction(w, &interaction)
+	})
+}
+
+// handleEndpointInteraction routes the interaction and writes its answer as the
+// response. Work the handler does after answering carries on in the background.
+func (bot *Bot) handleEndpointInteraction(w http.ResponseWriter, interaction *discordgo.Interaction) {
+	reply := make(chan any, 1)
+	bot.pendingReplies.Store(interaction.ID, reply)
+
+	handled := make(chan struct{})
+	go func() {
+		defer close(handled)
+		bot.interactionHandler(bot.DiscordSession, &discordgo.InteractionCreate{Interaction: interaction})
+	}()
+
+	timeout := time.NewTimer(interactionReplyTimeout)
+	defer timeout.Stop()
+
+	select {
+	case response := <-reply:
+		writeInteractionReply(w, response)
+	case <-handled:
+		select {
+		case response := <-reply:
+			writeInteractionReply(w, response)
+		default:
+			bot.pendingReplies.Delete(interaction.ID)
+			log.Printf("Interaction %s was handled without an answer", interaction.ID)
+			http.Error(w, "interaction was not answered", http.StatusInternalServerError)
+		}
+	case <-timeout.C:
+		if _, stillPending := bot.pendingReplies.LoadAndDelete(interaction.ID); stillPending {
+			log.Printf("Interaction %s was not answered within %s", interaction.ID, interactionReplyTimeout)
+			http.Error(w, "interaction timed out", http.StatusServiceUnavailable)
+			return
+		}
+		// The answer was handed over just as the timeout fired.
+		writeInteractionReply(w, <-reply)
+	}
+}
+
+func writeInteractionReply(w http.ResponseWriter, response any) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		log.Printf("Error writing interaction reply: %v", err)
+	}
+}
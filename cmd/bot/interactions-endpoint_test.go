@@ -0,0 +1,113 @@
+package main
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// newSignedRequest signs the interaction the way Discord does.
+func newSignedRequest(t *testing.T, privateKey ed25519.PrivateKey, body string) *http.Request {
+	t.Helper()
+	timestamp := time.Now().Format(time.RFC3339)
+	signature := ed25519.Sign(privateKey, []byte(timestamp+body))
+
+	request := httptest.NewRequest(http.MethodPost, interactionsPath, bytes.NewBufferString(body))
+	request.Header.Set("X-Signature-Ed25519", hex.EncodeToString(signature))
+	request.Header.Set("X-Signature-Timestamp", timestamp)
+	return request
+}
+
+func newEndpointHarness(t *testing.T) (*testHarness, http.Handler, ed25519.PrivateKey) {
+	t.Helper()
+	publicKey, privateKey, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal("Failed to generate key:", err)
+	}
+
+	harness := newTestHarness(t)
+	return harness, harness.bot.interactionsEndpoint(publicKey), privateKey
+}
+
+func TestInteractionsEndpointAnswersPing(t *testing.T) {
+	t.Parallel()
+	_, endpoint, privateKey := newEndpointHarness(t)
+
+	recorder := httptest.NewRecorder()
+	endpoint.ServeHTTP(recorder, newSignedRequest(t, privateKey, `{"id": "1", "type": 1}`))
+
+	if recorder.Code != http.StatusOK || recorder.Body.String() != "{\"type\":1}\n" {
+		t.Errorf("Expected a pong, but got %d %q", recorder.Code, recorder.Body.String())
+	}
+}
+
+func TestInteractionsEndpointRejectsUnsignedRequests(t *testing.T) {
+	t.Parallel()
+	_, endpoint, privateKey := newEndpointHarness(t)
+	_, otherKey, _ := ed25519.GenerateKey(nil)
+
+	tampered := newSignedRequest(t, privateKey, `{"id": "1", "type": 1}`)
+	tampered.Body = http.NoBody
+
+	unsigned := httptest.NewRequest(http.MethodPost, interactionsPath, bytes.NewBufferString(`{"id": "1", "type": 1}`))
+
+	testCases := []struct {
+		name    string
+		request *http.Request
+	}{
+		{"Signed With Another Key", newSignedRequest(t, otherKey, `{"id": "1", "type": 1}`)},
+		{"Tampered Body", tampered},
+		{"Missing Signature", unsigned},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			recorder := httptest.NewRecorder()
+			endpoint.ServeHTTP(recorder, testCase.request)
+			if recorder.Code != http.StatusUnauthorized {
+				t.Errorf("Expected status %d, but got %d", http.StatusUnauthorized, recorder.Code)
+			}
+		})
+	}
+}
+
+func TestInteractionsEndpointRoutesInteractions(t *testing.T) {
+	t.Parallel()
+	harness, endpoint, privateKey := newEndpointHarness(t)
+
+	body := `{
+		"id": "900",
+		"token": "endpoint-token",
+		"type": 2,
+		"guild_id": "` + testGuildID + `",
+		"channel_id": "` + testChannelID + `",
+		"member": {"user": {"id": "moderator"}, "permissions": "8192"},
+		"data": {"id": "1", "name": "create-poll", "type": 1}
+	}`
+
+	recorder := httptest.NewRecorder()
+	endpoint.ServeHTTP(recorder, newSignedRequest(t, privateKey, body))
+
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, but got %d: %s", http.StatusOK, recorder.Code, recorder.Body.String())
+	}
+
+	var response map[string]any
+	if err := json.Unmarshal(recorder.Body.Bytes(), &response); err != nil {
+		t.Fatal("Failed to decode the interaction reply:", err)
+	}
+	if response["type"] != float64(discordgo.InteractionResponseModal) || !containsCustomID(response, "poll_modal") {
+		t.Errorf("Expected the poll modal in the reply, but got %v", response)
+	}
+
+	if callbacks := harness.discord.Calls(http.MethodPost, "/interactions/"); len(callbacks) != 0 {
+		t.Errorf("Expected the reply to be sent in the response body only, but it was also sent %d times over REST", len(callbacks))
+	}
+}
@@ -0,0 +1,188 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math"
+	"strconv"
+	"strings"
+
+	"betting-discord-bot/internal/bets"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+const leaderboardPageSize = 10
+
+// maxLeaderboardPage keeps the offset of a page from overflowing. Pages past
+// the end show the last page instead.
+const maxLeaderboardPage = math.MaxInt32 / leaderboardPageSize
+
+// leaderboardMinBets is how many settled bets a user needs before they are
+// ranked by win rate.
+const leaderboardMinBets = 5
+
+var leaderboardSorts = map[string]bets.LeaderboardOrder{
+	"wins":     bets.ByWins,
+	"win-rate": bets.ByWinRate,
+	"points":   bets.ByPoints,
+}
+
+var leaderboardSortLabels = map[string]string{
+	"wins":     "wins",
+	"win-rate": "win rate",
+	"points":   "points",
+}
+
+func (bot *Bot) handleLeaderboardCommand(ctx context.Context, i *discordgo.InteractionCreate) {
+	sort := "wins"
+	for _, option := range i.ApplicationCommandData().Options {
+		if option.Name == "sort" {
+			sort = option.StringValue()
+		}
+	}
+
+	message, err := bot.leaderboardMessage(ctx, i.GuildID, sort, 0)
+	if err != nil {
+		log.Printf("Error building leaderboard: %v", err)
+		bot.sendInteractionResponse(ctx, i, "The leaderboard could not be loaded. Please try again.")
+		return
+	}
+
+	if err := bot.sendInteractionCallback(ctx, i, ChannelMessageWithSource, message); err != nil {
+		log.Printf("Error sending leaderboard: %v", err)
+	}
+}
+
+// handleLeaderboardPage shows another page of the leaderboard in place of the
+// one whose button was pressed ("leaderboard:<sort>:<page>").
+func (bot *Bot) handleLeaderboardPage(ctx context.Context, i *discordgo.InteractionCreate, customID string) {
+	sort, page, err := parseLeaderboardCustomID(customID)
+	if err != nil {
+		log.Printf("failed to parse leaderboard custom ID: %v", err)
+		bot.sendInteractionResponse(ctx, i, "The leaderboard could not be loaded. Please try again.")
+		return
+	}
+
+	message, err := bot.leaderboardMessage(ctx, i.GuildID, sort, page)
+	if err != nil {
+		log.Printf("Error building leaderboard: %v", err)
+		bot.sendInteractionResponse(ctx, i, "The leaderboard could not be loaded. Please try again.")
+		return
+	}
+
+	if err := bot.sendInteractionCallback(ctx, i, UpdateMessage, message); err != nil {
+		log.Printf("Error sending leaderboard: %v", err)
+	}
+}
+
+func parseLeaderboardCustomID(customID string) (string, int, error) {
+	leaderboardData := strings.Split(customID, ":")
+	if len(leaderboardData) != 3 {
+		return "", 0, fmt.Errorf("invalid leaderboard custom ID: %s", customID)
+	}
+
+	if _, exists := leaderboardSorts[leaderboardData[1]]; !exists {
+		return "", 0, fmt.Errorf("invalid leaderboard sort: %s", leaderboardData[1])
+	}
+
+	page, err := strconv.Atoi(leaderboardData[2])
+	if err != nil || page < 0 {
+		return "", 0, fmt.Errorf("invalid leaderboard page: %s", leaderboardData[2])
+	}
+
+	return leaderboardData[1], min(page, maxLeaderboardPage), nil
+}
+
+func (bot *Bot) leaderboardMessage(ctx context.Context, guildID string, sort string, page int) (MessageSend, error) {
+	orderBy, exists := leaderboardSorts[sort]
+	if !exists {
+		return MessageSend{}, fmt.Errorf("invalid leaderboard sort: %s", sort)
+	}
+
+	query := bets.LeaderboardQuery{GuildID: guildID, OrderBy: orderBy, Limit: leaderboardPageSize, Offset: page * leaderboardPageSize}
+	if orderBy == bets.ByWinRate {
+		query.MinBets = leaderboardMinBets
+	}
+
+	leaderboard, err := bot.BetService.GetLeaderboard(ctx, query)
+	if err != nil {
+		return MessageSend{}, err
+	}
+
+	// The leaderboard may have shrunk since the page button was rendered.
+	if len(leaderboard.Entries) == 0 && leaderboard.Total > 0 {
+		page = (leaderboard.Total - 1) / leaderboardPageSize
+		query.Offset = page * leaderboardPageSize
+		if leaderboard, err = bot.BetService.GetLeaderboard(ctx, query); err != nil {
+			return MessageSend{}, err
+		}
+	}
+
+	lines := []string{fmt.Sprintf("## Leaderboard by %s", leaderboardSortLabels[sort])}
+	if len(leaderboard.Entries) == 0 {
+		if orderBy == bets.ByWinRate {
+			lines = append(lines, fmt.Sprintf("Nobody has %d settled bets yet.", leaderboardMinBets))
+		} else {
+			lines = append(lines, "Nobody has a settled bet yet.")
+		}
+	}
+	for _, entry := range leaderboard.Entries {
+		lines = append(lines, formatLeaderboardEntry(entry, bot.mentionUser(ctx, entry.UserID)))
+	}
+
+	pageCount := max((leaderboard.Total+leaderboardPageSize-1)/leaderboardPageSize, 1)
+	if orderBy == bets.ByWinRate {
+		lines = append(lines, fmt.Sprintf("-# Page %d of %d · At least %d settled bets to rank", page+1, pageCount, leaderboardMinBets))
+	} else {
+		lines = append(lines, fmt.Sprintf("-# Page %d of %d", page+1, pageCount))
+	}
+
+	messageContainer := NewContainer(
+		bot.accentColour(ctx, guildID),
+		[]interface{}{
+			NewTextDisplay(strings.Join(lines, "\n")),
+			newPaginationRow("leaderboard:"+sort, page, pageCount),
+		},
+	)
+
+	return MessageSend{
+		Flags: IsComponentsV2,
+		Components: []interface{}{
+			messageContainer,
+		},
+		AllowedMentions: &AllowedMentions{Parse: []string{}},
+	}, nil
+}
+
+func formatLeaderboardEntry(entry bets.LeaderboardEntry, mention string) string {
+	return fmt.Sprintf(
+		"**%d.** %s · %dW %dL · %.0f%% · %+d points",
+		entry.Rank,
+		mention,
+		entry.Wins,
+		entry.Losses,
+		entry.WinRate()*100,
+		entry.Points,
+	)
+}
+
+// mentionUser renders an internal user as a Discord mention, falling back to a
+// placeholder for users without a Discord identity.
+func (bot *Bot) mentionUser(ctx context.Context, userID string) string {
+	discordID, err := bot.UserService.GetExternalID(ctx, userID, "discord")
+	if err != nil {
+		log.Printf("Error getting Discord ID of user %s: %v", userID, err)
+		return "Unknown user"
+	}
+	return fmt.Sprintf("<@%s>", discordID)
+}
+
+// mentioner binds mentionUser to ctx, for rendering that takes a plain
+// mention function.
+func (bot *Bot) mentioner(ctx context.Context) func(userID string) string {
+	return func(userID string) string {
+		return bot.mentionUser(ctx, userID)
+	}
+}
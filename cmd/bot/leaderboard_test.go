@@ -0,0 +1,46 @@
+package main
+
+import (
+	"testing"
+
+	"betting-discord-bot/internal/bets"
+)
+
+func TestParseLeaderboardCustomID(t *testing.T) {
+	tests := []struct {
+		name     string
+		customID string
+		wantSort string
+		wantPage int
+		wantErr  bool
+	}{
+		{name: "First Page", customID: "leaderboard:wins:0", wantSort: "wins", wantPage: 0},
+		{name: "Later Page", customID: "leaderboard:win-rate:3", wantSort: "win-rate", wantPage: 3},
+		{name: "Unknown Sort", customID: "leaderboard:luck:0", wantErr: true},
+		{name: "Negative Page", customID: "leaderboard:points:-1", wantErr: true},
+		{name: "Missing Page", customID: "leaderboard:points", wantErr: true},
+		{name: "Huge Page", customID: "leaderboard:points:9000000000000000000", wantSort: "points", wantPage: maxLeaderboardPage},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sort, page, err := parseLeaderboardCustomID(tt.customID)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseLeaderboardCustomID(%q) error = %v, wantErr %v", tt.customID, err, tt.wantErr)
+			}
+			if sort != tt.wantSort || page != tt.wantPage {
+				t.Errorf("parseLeaderboardCustomID(%q) = (%q, %d), want (%q, %d)", tt.customID, sort, page, tt.wantSort, tt.wantPage)
+			}
+		})
+	}
+}
+
+func TestFormatLeaderboardEntry(t *testing.T) {
+	entry := bets.LeaderboardEntry{Rank: 2, UserID: "user", Wins: 3, Losses: 1, Points: -40}
+
+	got := formatLeaderboardEntry(entry, "<@123>")
+	want := "**2.** <@123> · 3W 1L · 75% · -40 points"
+	if got != want {
+		t.Errorf("formatLeaderboardEntry() = %q, want %q", got, want)
+	}
+}
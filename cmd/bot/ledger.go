@@ -0,0 +1,150 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"slices"
+	"strings"
+
+	"betting-discord-bot/internal/bets"
+	"betting-discord-bot/internal/permissions"
+	"betting-discord-bot/internal/users"
+	"betting-discord-bot/internal/wallet"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+const (
+	// ledgerEntriesShown is how many of the newest entries /ledger lists.
+	ledgerEntriesShown = 15
+	// ledgerMessageLength keeps the listing under Discord's 2000 character
+	// limit, as memos may be long.
+	ledgerMessageLength = 1900
+	// pollTitlePageSize is how many bets are read at a time to name the polls
+	// of the listed entries.
+	pollTitlePageSize = 100
+)
+
+// handleLedgerCommand shows moderators every point movement of a member in
+// this server, newest first, to settle disputes about where points went.
+func (bot *Bot) handleLedgerCommand(ctx context.Context, i *discordgo.InteractionCreate) {
+	if bot.doesNotHavePermission(ctx, i, permissions.ViewLedger, "") {
+		return
+	}
+
+	var discordID string
+	for _, option := range i.ApplicationCommandData().Options {
+		if option.Name == "user" {
+			discordID = option.UserValue(nil).ID
+		}
+	}
+
+	user, err := bot.resolveDiscordUser(ctx, discordID)
+	if errors.Is(err, users.ErrUserNotFound) {
+		bot.sendInteractionResponse(ctx, i, fmt.Sprintf("<@%s> has no ledger entries in this server.", discordID))
+		return
+	}
+	if err != nil {
+		log.Printf("Error resolving user: %v", err)
+		bot.sendInteractionResponse(ctx, i, "The ledger could not be loaded. Please try again later.")
+		return
+	}
+
+	ledger, err := bot.WalletService.GetLedger(ctx, user.GetID())
+	if err != nil {
+		log.Printf("Error getting ledger of user %s: %v", user.GetID(), err)
+		bot.sendInteractionResponse(ctx, i, "The ledger could not be loaded. Please try again later.")
+		return
+	}
+	// The ledger holds the user's accounts in every guild.
+	ledger = slices.DeleteFunc(ledger, func(entry wallet.LedgerEntry) bool {
+		return entry.GuildID != i.GuildID
+	})
+	if len(ledger) == 0 {
+		bot.sendInteractionResponse(ctx, i, fmt.Sprintf("<@%s> has no ledger entries in this server.", discordID))
+		return
+	}
+
+	titles, err := bot.pollTitles(ctx, user.GetID(), i.GuildID)
+	if err != nil {
+		log.Printf("Error getting poll titles: %v", err)
+	}
+
+	bot.sendInteractionResponse(ctx, i, formatLedger(discordID, ledger, titles, wallet.UserAccount(i.GuildID, user.GetID())))
+}
+
+// pollTitles names the polls the user bet on in the guild. Polls whose bet was
+// withdrawn are left out.
+func (bot *Bot) pollTitles(ctx context.Context, userID, guildID string) (map[string]string, error) {
+	titles := make(map[string]string)
+	for offset := 0; ; offset += pollTitlePageSize {
+		page, err := bot.BetService.GetBetHistory(ctx, bets.BetHistoryQuery{UserID: userID, GuildID: guildID, Limit: pollTitlePageSize, Offset: offset})
+		if err != nil {
+			return titles, err
+		}
+		for _, entry := range page.Entries {
+			titles[entry.PollID] = entry.PollTitle
+		}
+		if offset+len(page.Entries) >= page.Total || len(page.Entries) == 0 {
+			return titles, nil
+		}
+	}
+}
+
+// formatLedger lists the newest entries on the account, which the ledger holds
+// oldest first, along with the balance they add up to.
+func formatLedger(discordID string, ledger []wallet.LedgerEntry, titles map[string]string, account string) string {
+	header := fmt.Sprintf("## Ledger of <@%s>", discordID)
+	footer := fmt.Sprintf("**Balance:** %d points", wallet.ReplayBalance(ledger, account))
+
+	var lines []string
+	length := len(header) + len(footer) + 2
+	for index := len(ledger) - 1; index >= 0 && len(lines) < ledgerEntriesShown; index-- {
+		line := formatLedgerEntry(ledger[index], titles[ledger[index].PollID])
+		if length+len(line)+1 > ledgerMessageLength {
+			break
+		}
+		lines = append(lines, line)
+		length += len(line) + 1
+	}
+
+	if hidden := len(ledger) - len(lines); hidden > 0 {
+		footer += fmt.Sprintf("\n-# %d older entries not shown", hidden)
+	}
+
+	return header + "\n" + strings.Join(lines, "\n") + "\n" + footer
+}
+
+func formatLedgerEntry(entry wallet.LedgerEntry, pollTitle string) string {
+	line := fmt.Sprintf("<t:%d:f> · %s · %+d", entry.CreatedAt.Unix(), ledgerKindLabel(entry.Kind), entry.Amount)
+
+	if pollTitle != "" {
+		line += fmt.Sprintf(" · **%s**", pollTitle)
+	}
+	if entry.Memo != "" {
+		line += " · " + entry.Memo
+	}
+
+	return line
+}
+
+func ledgerKindLabel(kind wallet.EntryKind) string {
+	switch kind {
+	case wallet.Grant:
+		return "Starting balance"
+	case wallet.Stake:
+		return "Stake"
+	case wallet.Payout:
+		return "Payout"
+	case wallet.Refund:
+		return "Refund"
+	case wallet.Adjustment:
+		return "Adjustment"
+	case wallet.Transfer:
+		return "Transfer"
+	default:
+		return string(kind)
+	}
+}
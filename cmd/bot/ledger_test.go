@@ -0,0 +1,61 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"betting-discord-bot/internal/wallet"
+)
+
+func TestFormatLedgerEntry(t *testing.T) {
+	tests := []struct {
+		name      string
+		entry     wallet.LedgerEntry
+		pollTitle string
+		want      string
+	}{
+		{
+			name:      "Stake On Poll",
+			entry:     wallet.LedgerEntry{Kind: wallet.Stake, Amount: -20, PollID: "poll", CreatedAt: time.Unix(1_700_000_000, 0)},
+			pollTitle: "Who wins?",
+			want:      "<t:1700000000:f> · Stake · -20 · **Who wins?**",
+		},
+		{
+			name:  "Adjustment With Memo",
+			entry: wallet.LedgerEntry{Kind: wallet.Adjustment, Amount: 50, Memo: "Tournament prize", CreatedAt: time.Unix(1_700_000_000, 0)},
+			want:  "<t:1700000000:f> · Adjustment · +50 · Tournament prize",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := formatLedgerEntry(tt.entry, tt.pollTitle); got != tt.want {
+				t.Errorf("formatLedgerEntry() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFormatLedgerShowsNewestEntries(t *testing.T) {
+	account := wallet.UserAccount("guild", "user")
+	ledger := make([]wallet.LedgerEntry, ledgerEntriesShown+5)
+	for index := range ledger {
+		ledger[index] = wallet.LedgerEntry{Account: account, Kind: wallet.Adjustment, Amount: int64(index + 1), CreatedAt: time.Unix(int64(index), 0)}
+	}
+
+	got := formatLedger("alice", ledger, nil, account)
+
+	if !strings.Contains(got, "· +20") || strings.Contains(got, "· +5\n") {
+		t.Errorf("Expected only the %d newest entries, but got:\n%s", ledgerEntriesShown, got)
+	}
+	if !strings.Contains(got, "**Balance:** 210 points") {
+		t.Errorf("Expected the balance to add up every entry, but got:\n%s", got)
+	}
+	if !strings.Contains(got, "5 older entries not shown") {
+		t.Errorf("Expected the hidden entries to be counted, but got:\n%s", got)
+	}
+	if len(got) > 2000 {
+		t.Errorf("Expected the ledger to fit in a message, but it is %d characters", len(got))
+	}
+}
@@ -1,23 +1,29 @@
 package main
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
 	"log"
+	"net/http"
 	"os"
 	"os/signal"
 
 	"betting-discord-bot/internal/bets"
 	"betting-discord-bot/internal/cryptography"
+	"betting-discord-bot/internal/discord"
+	"betting-discord-bot/internal/permissions"
 	"betting-discord-bot/internal/polls"
+	"betting-discord-bot/internal/settings"
 	"betting-discord-bot/internal/storage"
 	"betting-discord-bot/internal/users"
+	"betting-discord-bot/internal/wallet"
 	"encoding/hex"
 
 	"github.com/bwmarrin/discordgo"
 )
 
-func run() (err error) {
+func run(ctx context.Context) (err error) {
 	// Validate ENV
 	config, err := LoadConfig()
 	if err != nil {
@@ -39,22 +45,55 @@ func run() (err error) {
 
 	log.Println("Database initialized successfully")
 
+	if config.GuildID != "" {
+		if err := storage.AdoptUnscopedPolls(ctx, db, config.GuildID); err != nil {
+			return fmt.Errorf("failed to scope existing polls: %w", err)
+		}
+		if err := storage.AdoptUnscopedWallets(ctx, db, config.GuildID); err != nil {
+			return fmt.Errorf("failed to scope existing wallets: %w", err)
+		}
+	}
+
 	// Init services
-	pollService, betService, userService, err := initServices(db, config)
+	unitOfWork := storage.NewLibSQLUnitOfWork(db)
+	pollService, betService, userService, walletService, err := initServices(db, unitOfWork, config)
 	if err != nil {
 		return fmt.Errorf("failed to initialize services: %w", err)
 	}
 
+	reconcileLedger(ctx, walletService)
+
+	settingsService := settings.NewService(settings.NewLibSQLRepository(db), defaultGuildSettings(config.StartingBalance))
+	permissionService := permissions.NewService(permissions.NewLibSQLRepository(db), settingsService)
+
 	// Setup discord bot
-	if err := setupDiscordBot(discordSession, config, pollService, betService, userService); err != nil {
+	pollMessages := NewLibSQLPollMessageRepository(db)
+	bot, err := setupDiscordBot(ctx, discordSession, config, pollService, betService, userService, walletService, settingsService, permissionService, pollMessages, unitOfWork)
+	if err != nil {
 		return fmt.Errorf("failed to setup discord bot: %w", err)
 	}
 
+	var interactionsServer *http.Server
+	if config.InteractionsMode == HTTPMode {
+		publicKey, _ := hex.DecodeString(config.PublicKey)
+		if interactionsServer, err = bot.serveInteractions(config.ListenAddr, publicKey); err != nil {
+			return fmt.Errorf("failed to serve interactions: %w", err)
+		}
+	}
+
 	// Bot shutdown handlers
 	stop := make(chan os.Signal, 1)
 	signal.Notify(stop, os.Interrupt)
 	<-stop
 	log.Println("Graceful shutdown")
+	if interactionsServer != nil {
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), interactionReplyTimeout)
+		defer cancel()
+		if err := interactionsServer.Shutdown(shutdownCtx); err != nil {
+			log.Printf("Error shutting down the interactions endpoint: %v", err)
+		}
+	}
+	bot.Scheduler.Stop()
 
 	defer func(discordSession *discordgo.Session) {
 		_ = discordSession.Close()
@@ -72,50 +111,91 @@ func run() (err error) {
 	return nil
 }
 
-func setupDiscordBot(discordSession *discordgo.Session, config *Config, pollService polls.PollService, betService bets.BetService, userService users.UserService) error {
-	bot := NewBot(discordSession, pollService, betService, userService, config.AppID, config.GuildID)
-
-	bot.DiscordSession.AddHandler(bot.interactionHandler)
+func setupDiscordBot(ctx context.Context, discordSession *discordgo.Session, config *Config, pollService polls.PollService, betService bets.BetService, userService users.UserService, walletService wallet.WalletService, settingsService settings.SettingsService, permissionService permissions.PermissionService, pollMessages PollMessageRepository, unitOfWork storage.UnitOfWork) (*Bot, error) {
+	discordClient := discord.NewClient(config.DiscordAPIURL, config.Token)
+	bot := NewBot(discordSession, discordClient, pollService, betService, userService, walletService, settingsService, permissionService, pollMessages, unitOfWork, config.AppID, config.GuildID)
 
 	if err := bot.RegisterCommands(); err != nil {
-		return fmt.Errorf("failed to register commands: %w", err)
+		return nil, fmt.Errorf("failed to register commands: %w", err)
+	}
+
+	if err := bot.schedulePollDeadlines(ctx); err != nil {
+		return nil, fmt.Errorf("failed to schedule poll deadlines: %w", err)
 	}
 
+	// In HTTP mode interactions arrive at the endpoint, so the gateway is not needed.
+	if config.InteractionsMode == HTTPMode {
+		return bot, nil
+	}
+
+	bot.DiscordSession.AddHandler(bot.interactionHandler)
+
 	discordSession.AddHandler(func(discordSession *discordgo.Session, ready *discordgo.Ready) {
 		log.Println("Bot is up")
 	})
 
 	if err := discordSession.Open(); err != nil {
-		return fmt.Errorf("cannot open the session: %w", err)
+		return nil, fmt.Errorf("cannot open the session: %w", err)
 	}
-	return nil
+	return bot, nil
+}
+
+// reconcileLedger logs any wallet whose balance does not match its ledger, so
+// drift is noticed before users report it.
+func reconcileLedger(ctx context.Context, walletService wallet.WalletService) {
+	discrepancies, err := walletService.Reconcile(ctx)
+	if err != nil {
+		log.Printf("Ledger reconciliation failed: %v", err)
+		return
+	}
+
+	for _, discrepancy := range discrepancies {
+		log.Printf("Wallet of user %s in guild %q holds %d points but its ledger adds up to %d",
+			discrepancy.UserID, discrepancy.GuildID, discrepancy.Balance, discrepancy.LedgerBalance)
+	}
+	log.Printf("Ledger reconciled with %d discrepancies", len(discrepancies))
 }
 
-func initServices(db *sql.DB, config *Config) (polls.PollService, bets.BetService, users.UserService, error) {
+func initServices(db *sql.DB, unitOfWork storage.UnitOfWork, config *Config) (polls.PollService, bets.BetService, users.UserService, wallet.WalletService, error) {
 	// Initialize cryptography service
 	keyBytes, err := hex.DecodeString(config.EncryptionKey)
 	if err != nil {
-		return nil, nil, nil, fmt.Errorf("failed to decode encryption key")
+		return nil, nil, nil, nil, fmt.Errorf("failed to decode encryption key")
 	}
 	var key [32]byte
 	copy(key[:], keyBytes)
 
 	cryptoService, err := cryptography.NewService(key)
 	if err != nil {
-		return nil, nil, nil, fmt.Errorf("failed to initialize crypto service: %w", err)
+		return nil, nil, nil, nil, fmt.Errorf("failed to initialize crypto service: %w", err)
 	}
 
 	pollRepo := polls.NewLibSQLRepository(db)
 	pollService := polls.NewService(pollRepo)
 	betRepo := bets.NewLibSQLRepository(db)
-	betService := bets.NewService(pollService, betRepo)
+	walletRepo := wallet.NewLibSQLRepository(db)
+	walletService := wallet.NewService(walletRepo, config.StartingBalance)
+	betService := bets.NewService(pollService, betRepo, walletService, bets.PayoutCalculator{HouseCut: config.HouseCut}, unitOfWork)
 	userRepo := users.NewLibSQLRepository(db, cryptoService)
-	userService := users.NewService(userRepo, betService)
-	return pollService, betService, userService, nil
+	userService := users.NewService(userRepo, pollService, betService, walletService)
+	return pollService, betService, userService, walletService, nil
 }
 
 func main() {
-	if err := run(); err != nil {
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		if err := runMigrate(os.Stdout, os.Args[2:]); err != nil {
+			log.Fatalf("migration failed: %v", err)
+		}
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "repair" {
+		if err := runRepair(os.Stdout, os.Args[2:]); err != nil {
+			log.Fatalf("repair failed: %v", err)
+		}
+		return
+	}
+
+	if err := run(context.Background()); err != nil {
 		log.Fatalf("application failed to start: %v", err)
 	}
 }
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"io"
+	"text/tabwriter"
+	"time"
+
+	"betting-discord-bot/internal/storage"
+)
+
+const migrateUsage = "usage: bot migrate [status|dry-run|up]"
+
+// runMigrate runs the migrate command, which shows and applies schema
+// migrations without starting the bot. It only needs DB_PATH and
+// ENCRYPTION_KEY.
+func runMigrate(out io.Writer, args []string) (err error) {
+	command := "status"
+	if len(args) > 0 {
+		command = args[0]
+	}
+	if len(args) > 1 {
+		return fmt.Errorf("%s", migrateUsage)
+	}
+
+	config, err := LoadDatabaseConfig()
+	if err != nil {
+		return fmt.Errorf("failed to load configuration: %w", err)
+	}
+
+	db, err := storage.OpenDatabase(config.DBPath, config.EncryptionKey)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if closeError := db.Close(); closeError != nil && err == nil {
+			err = closeError
+		}
+	}()
+
+	switch command {
+	case "status":
+		return printMigrationStatus(out, db)
+	case "dry-run":
+		pending, err := storage.PendingMigrations(db)
+		if err != nil {
+			return err
+		}
+		if len(pending) == 0 {
+			_, err = fmt.Fprintf(out, "Schema is up to date at version %d.\n", storage.LatestSchemaVersion())
+			return err
+		}
+		fmt.Fprintf(out, "Would apply %d migrations:\n", len(pending))
+		for _, migration := range pending {
+			fmt.Fprintf(out, "  %d %s\n", migration.Version, migration.Name)
+			for _, statement := range migration.Statements {
+				fmt.Fprintf(out, "\n%s\n", statement)
+			}
+			fmt.Fprintln(out)
+		}
+		return nil
+	case "up":
+		applied, err := storage.Migrate(db)
+		for _, migration := range applied {
+			fmt.Fprintf(out, "Applied %d %s\n", migration.Version, migration.Name)
+		}
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintf(out, "Schema is at version %d.\n", storage.LatestSchemaVersion())
+		return err
+	default:
+		return fmt.Errorf("unknown migrate command %q, %s", command, migrateUsage)
+	}
+}
+
+func printMigrationStatus(out io.Writer, db *sql.DB) error {
+	statuses, err := storage.Status(db)
+	if err != nil {
+		return err
+	}
+
+	table := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(table, "VERSION\tNAME\tSTATUS\tAPPLIED AT")
+	for _, status := range statuses {
+		state, appliedAt := "pending", ""
+		if status.Applied {
+			state = "applied"
+			appliedAt = status.AppliedAt.UTC().Format(time.RFC3339)
+		}
+		switch {
+		case status.Unknown:
+			state = "newer than this binary"
+		case status.ChecksumMismatch:
+			state = "changed since applied"
+		}
+		fmt.Fprintf(table, "%d\t%s\t%s\t%s\n", status.Version, status.Name, state, appliedAt)
+	}
+	return table.Flush()
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"betting-discord-bot/internal/storage"
+)
+
+func TestRunMigrate(t *testing.T) {
+	t.Setenv("DB_PATH", filepath.Join(t.TempDir(), "bets.db"))
+	t.Setenv("ENCRYPTION_KEY", "000102030405060708090a0b0c0d0e0f101112131415161718191a1b1c1d1e1f")
+
+	migrate := func(args ...string) string {
+		t.Helper()
+		var out bytes.Buffer
+		if err := runMigrate(&out, args); err != nil {
+			t.Fatalf("migrate %v returned an unexpected error: %v", args, err)
+		}
+		return out.String()
+	}
+
+	if status := migrate(); !strings.Contains(status, "pending") || strings.Contains(status, "applied") {
+		t.Errorf("Expected every migration to be pending on a new database, but got:\n%s", status)
+	}
+
+	if dryRun := migrate("dry-run"); !strings.Contains(dryRun, fmt.Sprintf("Would apply %d migrations", storage.LatestSchemaVersion())) {
+		t.Errorf("Expected a dry run to list every migration, but got:\n%s", dryRun)
+	}
+	if status := migrate("status"); strings.Contains(status, "applied") {
+		t.Errorf("Expected a dry run to apply nothing, but got:\n%s", status)
+	}
+
+	if up := migrate("up"); !strings.Contains(up, "Applied 1 baseline") {
+		t.Errorf("Expected up to apply the baseline, but got:\n%s", up)
+	}
+	if status := migrate("status"); strings.Contains(status, "pending") {
+		t.Errorf("Expected nothing to be pending after up, but got:\n%s", status)
+	}
+	if dryRun := migrate("dry-run"); !strings.Contains(dryRun, "up to date") {
+		t.Errorf("Expected the schema to be up to date, but got:\n%s", dryRun)
+	}
+
+	if err := runMigrate(&bytes.Buffer{}, []string{"down"}); err == nil {
+		t.Error("Expected an unknown migrate command to be refused")
+	}
+}
@@ -0,0 +1,188 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"strconv"
+	"strings"
+
+	"betting-discord-bot/internal/bets"
+	"betting-discord-bot/internal/users"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+const myBetsPageSize = 10
+
+// maxMyBetsPage is the furthest page a button can ask for, so that the offset
+// of the page cannot overflow.
+const maxMyBetsPage = math.MaxInt32 / myBetsPageSize
+
+var myBetsFilters = map[string]bets.BetHistoryFilter{
+	"all":     bets.AllBets,
+	"open":    bets.OpenBets,
+	"settled": bets.SettledBets,
+}
+
+var myBetsFilterHeadings = map[string]string{
+	"all":     "Your bets",
+	"open":    "Your open bets",
+	"settled": "Your settled bets",
+}
+
+func (bot *Bot) handleMyBetsCommand(ctx context.Context, i *discordgo.InteractionCreate) {
+	filter := "all"
+	for _, option := range i.ApplicationCommandData().Options {
+		if option.Name == "show" {
+			filter = option.StringValue()
+		}
+	}
+
+	message, err := bot.myBetsMessage(ctx, i.GuildID, interactionUser(i).ID, filter, 0)
+	if err != nil {
+		log.Printf("Error building bet history: %v", err)
+		bot.sendInteractionResponse(ctx, i, "Your bets could not be loaded. Please try again.")
+		return
+	}
+
+	if err := bot.sendInteractionCallback(ctx, i, ChannelMessageWithSource, message); err != nil {
+		log.Printf("Error sending bet history: %v", err)
+	}
+}
+
+// handleMyBetsPage shows another page of the user's bets in place of the one
+// whose button was pressed ("mybets:<filter>:<page>").
+func (bot *Bot) handleMyBetsPage(ctx context.Context, i *discordgo.InteractionCreate, customID string) {
+	filter, page, err := parseMyBetsCustomID(customID)
+	if err != nil {
+		log.Printf("failed to parse my bets custom ID: %v", err)
+		bot.sendInteractionResponse(ctx, i, "Your bets could not be loaded. Please try again.")
+		return
+	}
+
+	message, err := bot.myBetsMessage(ctx, i.GuildID, interactionUser(i).ID, filter, page)
+	if err != nil {
+		log.Printf("Error building bet history: %v", err)
+		bot.sendInteractionResponse(ctx, i, "Your bets could not be loaded. Please try again.")
+		return
+	}
+
+	if err := bot.sendInteractionCallback(ctx, i, UpdateMessage, message); err != nil {
+		log.Printf("Error sending bet history: %v", err)
+	}
+}
+
+func parseMyBetsCustomID(customID string) (string, int, error) {
+	myBetsData := strings.Split(customID, ":")
+	if len(myBetsData) != 3 {
+		return "", 0, fmt.Errorf("invalid my bets custom ID: %s", customID)
+	}
+
+	if _, exists := myBetsFilters[myBetsData[1]]; !exists {
+		return "", 0, fmt.Errorf("invalid my bets filter: %s", myBetsData[1])
+	}
+
+	page, err := strconv.Atoi(myBetsData[2])
+	if err != nil || page < 0 {
+		return "", 0, fmt.Errorf("invalid my bets page: %s", myBetsData[2])
+	}
+
+	return myBetsData[1], min(page, maxMyBetsPage), nil
+}
+
+func (bot *Bot) myBetsMessage(ctx context.Context, guildID string, discordID string, filter string, page int) (MessageSend, error) {
+	historyFilter, exists := myBetsFilters[filter]
+	if !exists {
+		return MessageSend{}, fmt.Errorf("invalid my bets filter: %s", filter)
+	}
+
+	// Users the bot has never seen have no bets, so they are shown an empty
+	// history instead of being created just to look at it.
+	var history bets.BetHistory
+	user, err := bot.resolveDiscordUser(ctx, discordID)
+	switch {
+	case errors.Is(err, users.ErrUserNotFound):
+		page = 0
+	case err != nil:
+		return MessageSend{}, fmt.Errorf("error resolving user: %w", err)
+	default:
+		query := bets.BetHistoryQuery{UserID: user.GetID(), GuildID: guildID, Filter: historyFilter, Limit: myBetsPageSize, Offset: page * myBetsPageSize}
+		if history, err = bot.BetService.GetBetHistory(ctx, query); err != nil {
+			return MessageSend{}, err
+		}
+
+		// Bets may have been withdrawn since the page button was rendered.
+		if len(history.Entries) == 0 && history.Total > 0 {
+			page = (history.Total - 1) / myBetsPageSize
+			query.Offset = page * myBetsPageSize
+			if history, err = bot.BetService.GetBetHistory(ctx, query); err != nil {
+				return MessageSend{}, err
+			}
+		}
+	}
+
+	lines := []string{"## " + myBetsFilterHeadings[filter]}
+	if len(history.Entries) == 0 {
+		lines = append(lines, "You have no bets here yet.")
+	}
+	for _, entry := range history.Entries {
+		lines = append(lines, formatBetHistoryEntry(entry))
+	}
+
+	pageCount := max((history.Total+myBetsPageSize-1)/myBetsPageSize, 1)
+	lines = append(lines, fmt.Sprintf("-# Page %d of %d", page+1, pageCount))
+
+	messageContainer := NewContainer(
+		bot.accentColour(ctx, guildID),
+		[]interface{}{
+			NewTextDisplay(strings.Join(lines, "\n")),
+			newPaginationRow("mybets:"+filter, page, pageCount),
+		},
+	)
+
+	return MessageSend{
+		Flags: IsComponentsV2 | MessageIsEphemeral,
+		Components: []interface{}{
+			messageContainer,
+		},
+	}, nil
+}
+
+func formatBetHistoryEntry(entry bets.BetHistoryEntry) string {
+	line := fmt.Sprintf("**%s** · %s · %s", entry.PollTitle, entry.Option, betStatusLabel(entry.BetStatus))
+
+	if entry.Stake > 0 {
+		switch entry.BetStatus {
+		case bets.Won:
+			line += fmt.Sprintf(" · staked %d, won %d", entry.Stake, entry.Payout)
+		case bets.Void:
+			line += fmt.Sprintf(" · staked %d, refunded", entry.Stake)
+		default:
+			line += fmt.Sprintf(" · staked %d", entry.Stake)
+		}
+	}
+
+	if !entry.PlacedAt.IsZero() {
+		line += fmt.Sprintf(" · <t:%d:R>", entry.PlacedAt.Unix())
+	}
+
+	return line
+}
+
+func betStatusLabel(status bets.BetStatus) string {
+	switch status {
+	case bets.Pending:
+		return "Pending"
+	case bets.Won:
+		return "Won"
+	case bets.Lost:
+		return "Lost"
+	case bets.Void:
+		return "Voided"
+	default:
+		return status.String()
+	}
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"betting-discord-bot/internal/bets"
+)
+
+func TestParseMyBetsCustomID(t *testing.T) {
+	filter, page, err := parseMyBetsCustomID("mybets:settled:2")
+	if err != nil {
+		t.Fatalf("parseMyBetsCustomID() returned an unexpected error: %v", err)
+	}
+	if filter != "settled" || page != 2 {
+		t.Errorf("parseMyBetsCustomID() = (%q, %d), want (%q, %d)", filter, page, "settled", 2)
+	}
+
+	if _, page, _ := parseMyBetsCustomID("mybets:all:9000000000000000000"); page != maxMyBetsPage {
+		t.Errorf("parseMyBetsCustomID() page = %d, want it clamped to %d", page, maxMyBetsPage)
+	}
+
+	for _, customID := range []string{"mybets:won:0", "mybets:open:-1", "mybets:open"} {
+		if _, _, err := parseMyBetsCustomID(customID); err == nil {
+			t.Errorf("parseMyBetsCustomID(%q) expected an error", customID)
+		}
+	}
+}
+
+func TestFormatBetHistoryEntry(t *testing.T) {
+	tests := []struct {
+		name  string
+		entry bets.BetHistoryEntry
+		want  string
+	}{
+		{
+			name:  "Won With Stake",
+			entry: bets.BetHistoryEntry{PollTitle: "Who wins?", Option: "Red", BetStatus: bets.Won, Stake: 20, Payout: 45, PlacedAt: time.Unix(1_700_000_000, 0)},
+			want:  "**Who wins?** · Red · Won · staked 20, won 45 · <t:1700000000:R>",
+		},
+		{
+			name:  "Pending Without Stake",
+			entry: bets.BetHistoryEntry{PollTitle: "Will it rain?", Option: "No", BetStatus: bets.Pending},
+			want:  "**Will it rain?** · No · Pending",
+		},
+		{
+			name:  "Voided With Stake",
+			entry: bets.BetHistoryEntry{PollTitle: "Best snack", Option: "Chips", BetStatus: bets.Void, Stake: 5},
+			want:  "**Best snack** · Chips · Voided · staked 5, refunded",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := formatBetHistoryEntry(tt.entry); got != tt.want {
+				t.Errorf("formatBetHistoryEntry() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
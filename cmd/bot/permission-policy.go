@@ -0,0 +1,275 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"slices"
+	"strings"
+
+	"betting-discord-bot/internal/permissions"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// actionNames describe each action in /config.
+var actionNames = map[permissions.Action]string{
+	permissions.CreatePoll:    "Create polls",
+	permissions.ClosePoll:     "Close polls",
+	permissions.ResolvePoll:   "Select outcomes",
+	permissions.VoidPoll:      "Cancel polls",
+	permissions.AdjustBalance: "Adjust balances",
+	permissions.ViewLedger:    "View ledgers",
+}
+
+// permissionChoice is a Discord permission a rule can let members in with.
+type permissionChoice struct {
+	name  string
+	value string
+	bits  int64
+}
+
+var permissionChoices = []permissionChoice{
+	{name: "No permission", value: "none", bits: 0},
+	{name: "Manage Messages", value: "manage-messages", bits: discordgo.PermissionManageMessages},
+	{name: "Manage Server", value: "manage-server", bits: discordgo.PermissionManageGuild},
+	{name: "Manage Roles", value: "manage-roles", bits: discordgo.PermissionManageRoles},
+	{name: "Moderate Members", value: "moderate-members", bits: discordgo.PermissionModerateMembers},
+	{name: "Administrator", value: "administrator", bits: discordgo.PermissionAdministrator},
+}
+
+// permissionsConfigGroup is the /config permissions group, whose subcommands
+// change who may take each action.
+func permissionsConfigGroup() *discordgo.ApplicationCommandOption {
+	actionChoices := make([]*discordgo.ApplicationCommandOptionChoice, len(permissions.Actions))
+	for index, action := range permissions.Actions {
+		actionChoices[index] = &discordgo.ApplicationCommandOptionChoice{Name: actionNames[action], Value: string(action)}
+	}
+	actionOption := &discordgo.ApplicationCommandOption{
+		Type:        discordgo.ApplicationCommandOptionString,
+		Name:        "action",
+		Description: "The action to change who may take",
+		Required:    true,
+		Choices:     actionChoices,
+	}
+
+	permissionOptionChoices := make([]*discordgo.ApplicationCommandOptionChoice, len(permissionChoices))
+	for index, choice := range permissionChoices {
+		permissionOptionChoices[index] = &discordgo.ApplicationCommandOptionChoice{Name: choice.name, Value: choice.value}
+	}
+
+	return &discordgo.ApplicationCommandOption{
+		Type:        discordgo.ApplicationCommandOptionSubCommandGroup,
+		Name:        "permissions",
+		Description: "Change who may create, close, resolve and cancel polls or adjust balances",
+		Options: []*discordgo.ApplicationCommandOption{
+			{
+				Type:        discordgo.ApplicationCommandOptionSubCommand,
+				Name:        "add-role",
+				Description: "Let members with a role take an action",
+				Options: []*discordgo.ApplicationCommandOption{
+					actionOption,
+					{Type: discordgo.ApplicationCommandOptionRole, Name: "role", Description: "The role to let in", Required: true},
+				},
+			},
+			{
+				Type:        discordgo.ApplicationCommandOptionSubCommand,
+				Name:        "remove-role",
+				Description: "Stop letting members with a role take an action",
+				Options: []*discordgo.ApplicationCommandOption{
+					actionOption,
+					{Type: discordgo.ApplicationCommandOptionRole, Name: "role", Description: "The role to stop letting in", Required: true},
+				},
+			},
+			{
+				Type:        discordgo.ApplicationCommandOptionSubCommand,
+				Name:        "permission",
+				Description: "Let members with a Discord permission take an action",
+				Options: []*discordgo.ApplicationCommandOption{
+					actionOption,
+					{Type: discordgo.ApplicationCommandOptionString, Name: "permission", Description: "The permission to let in", Required: true, Choices: permissionOptionChoices},
+				},
+			},
+			{
+				Type:        discordgo.ApplicationCommandOptionSubCommand,
+				Name:        "everyone",
+				Description: "Let every member take an action",
+				Options: []*discordgo.ApplicationCommandOption{
+					actionOption,
+					{Type: discordgo.ApplicationCommandOptionBoolean, Name: "enabled", Description: "Whether every member may take it", Required: true},
+				},
+			},
+			{
+				Type:        discordgo.ApplicationCommandOptionSubCommand,
+				Name:        "moderators",
+				Description: "Let moderators take an action",
+				Options: []*discordgo.ApplicationCommandOption{
+					actionOption,
+					{Type: discordgo.ApplicationCommandOptionBoolean, Name: "enabled", Description: "Whether moderators may take it", Required: true},
+				},
+			},
+			{
+				Type:        discordgo.ApplicationCommandOptionSubCommand,
+				Name:        "reset",
+				Description: "Put back who may take an action by default",
+				Options:     []*discordgo.ApplicationCommandOption{actionOption},
+			},
+			{
+				Type:        discordgo.ApplicationCommandOptionSubCommand,
+				Name:        "creator-resolves",
+				Description: "Let only the creator of a poll or a moderator select its outcome",
+				Options: []*discordgo.ApplicationCommandOption{
+					{Type: discordgo.ApplicationCommandOptionBoolean, Name: "enabled", Description: "Whether only creators and moderators may", Required: true},
+				},
+			},
+		},
+	}
+}
+
+// handlePermissionsConfig changes the guild's permission policy with a
+// subcommand of /config permissions.
+func (bot *Bot) handlePermissionsConfig(ctx context.Context, i *discordgo.InteractionCreate, group *discordgo.ApplicationCommandInteractionDataOption) {
+	if len(group.Options) != 1 {
+		log.Printf("Expected a /config permissions subcommand, but got %d options", len(group.Options))
+		return
+	}
+	subcommand := group.Options[0]
+
+	policy, err := bot.Permissions.GetPolicy(ctx, i.GuildID)
+	if err != nil {
+		log.Printf("Error getting permission policy: %v", err)
+		bot.sendInteractionResponse(ctx, i, "The permissions could not be loaded. Please try again.")
+		return
+	}
+
+	updated, problem := applyPolicyChange(policy, subcommand)
+	if problem != "" {
+		bot.sendInteractionResponse(ctx, i, problem)
+		return
+	}
+
+	if err := bot.Permissions.UpdatePolicy(ctx, updated); err != nil {
+		if errors.Is(err, permissions.ErrTooManyRoles) {
+			bot.sendInteractionResponse(ctx, i, fmt.Sprintf("An action can be given to at most %d roles.", permissions.MaxRuleRoles))
+			return
+		}
+		log.Printf("Error updating permission policy: %v", err)
+		bot.sendInteractionResponse(ctx, i, "The permissions could not be saved. Please try again.")
+		return
+	}
+
+	// Reset actions fall back to their default rule, which the saved policy leaves out.
+	updated, err = bot.Permissions.GetPolicy(ctx, i.GuildID)
+	if err != nil {
+		log.Printf("Error getting permission policy: %v", err)
+		bot.sendInteractionResponse(ctx, i, "Permissions updated.")
+		return
+	}
+
+	log.Printf("User %s changed the %s permission of guild %s", interactionUser(i).ID, subcommand.Name, i.GuildID)
+	bot.sendInteractionResponse(ctx, i, "Permissions updated.\n\n"+formatPermissionPolicy(updated))
+}
+
+// applyPolicyChange applies a /config permissions subcommand to the policy. It
+// returns why the change cannot be made if the input is unusable.
+func applyPolicyChange(policy permissions.Policy, subcommand *discordgo.ApplicationCommandInteractionDataOption) (permissions.Policy, string) {
+	options := make(map[string]*discordgo.ApplicationCommandInteractionDataOption)
+	for _, option := range subcommand.Options {
+		options[option.Name] = option
+	}
+
+	rules := make(map[permissions.Action]permissions.Rule, len(policy.Rules))
+	for action, rule := range policy.Rules {
+		rules[action] = rule
+	}
+	policy.Rules = rules
+
+	if subcommand.Name == "creator-resolves" {
+		policy.CreatorResolves = options["enabled"].BoolValue()
+		return policy, ""
+	}
+
+	action := permissions.Action(options["action"].StringValue())
+	if !slices.Contains(permissions.Actions, action) {
+		return policy, fmt.Sprintf("Unknown action %q.", action)
+	}
+	rule := policy.Rule(action)
+
+	switch subcommand.Name {
+	case "add-role":
+		roleID := options["role"].RoleValue(nil, "").ID
+		if slices.Contains(rule.RoleIDs, roleID) {
+			return policy, fmt.Sprintf("<@&%s> can already %s.", roleID, strings.ToLower(actionNames[action]))
+		}
+		rule.RoleIDs = append(slices.Clone(rule.RoleIDs), roleID)
+	case "remove-role":
+		roleID := options["role"].RoleValue(nil, "").ID
+		if !slices.Contains(rule.RoleIDs, roleID) {
+			return policy, fmt.Sprintf("<@&%s> is not one of the roles that can %s.", roleID, strings.ToLower(actionNames[action]))
+		}
+		rule.RoleIDs = slices.DeleteFunc(slices.Clone(rule.RoleIDs), func(ruleRoleID string) bool {
+			return ruleRoleID == roleID
+		})
+	case "permission":
+		choice := options["permission"].StringValue()
+		index := slices.IndexFunc(permissionChoices, func(permission permissionChoice) bool {
+			return permission.value == choice
+		})
+		if index < 0 {
+			return policy, fmt.Sprintf("Unknown permission %q.", choice)
+		}
+		rule.Permissions = permissionChoices[index].bits
+	case "everyone":
+		rule.Everyone = options["enabled"].BoolValue()
+	case "moderators":
+		rule.Moderators = options["enabled"].BoolValue()
+	case "reset":
+		delete(policy.Rules, action)
+		return policy, ""
+	default:
+		return policy, fmt.Sprintf("Unknown permissions setting %q.", subcommand.Name)
+	}
+
+	policy.Rules[action] = rule
+	return policy, ""
+}
+
+// describeRule lists who a rule lets take its action.
+func describeRule(rule permissions.Rule) string {
+	if rule.Everyone {
+		return "Everyone"
+	}
+
+	var who []string
+	if rule.Moderators {
+		who = append(who, "Moderators")
+	}
+	for _, roleID := range rule.RoleIDs {
+		who = append(who, fmt.Sprintf("<@&%s>", roleID))
+	}
+	for _, choice := range permissionChoices {
+		if choice.bits != 0 && choice.bits == rule.Permissions {
+			who = append(who, "members with "+choice.name)
+		}
+	}
+	if len(who) == 0 {
+		return "Nobody"
+	}
+	return strings.Join(who, ", ")
+}
+
+func formatPermissionPolicy(policy permissions.Policy) string {
+	lines := []string{"## Permissions"}
+	for _, action := range permissions.Actions {
+		lines = append(lines, fmt.Sprintf("**%s:** %s", actionNames[action], describeRule(policy.Rule(action))))
+	}
+
+	creatorResolves := "Off"
+	if policy.CreatorResolves {
+		creatorResolves = "On"
+	}
+	lines = append(lines, "**Only creators and moderators select outcomes:** "+creatorResolves)
+
+	return strings.Join(lines, "\n")
+}
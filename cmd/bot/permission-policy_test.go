@@ -0,0 +1,45 @@
+package main
+
+import (
+	"testing"
+
+	"betting-discord-bot/internal/permissions"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+func TestApplyPolicyChange(t *testing.T) {
+	t.Parallel()
+	current := permissions.Policy{GuildID: "guild", Rules: permissions.DefaultRules()}
+	current.Rules[permissions.CreatePoll] = permissions.Rule{RoleIDs: []string{"hosts"}}
+
+	action := optionForTest("action", discordgo.ApplicationCommandOptionString, string(permissions.CreatePoll))
+
+	updated, problem := applyPolicyChange(current, subcommandForTest("permission", action,
+		optionForTest("permission", discordgo.ApplicationCommandOptionString, "manage-server")))
+	if problem != "" {
+		t.Fatalf("Expected the permission to be set, but got %q", problem)
+	}
+	if rule := updated.Rule(permissions.CreatePoll); rule.Permissions != discordgo.PermissionManageGuild || len(rule.RoleIDs) != 1 {
+		t.Errorf("Expected Manage Server to be added to the hosts role, but got %+v", rule)
+	}
+	if describeRule(updated.Rule(permissions.CreatePoll)) != "<@&hosts>, members with Manage Server" {
+		t.Errorf("Unexpected description %q", describeRule(updated.Rule(permissions.CreatePoll)))
+	}
+
+	reset, problem := applyPolicyChange(updated, subcommandForTest("reset", action))
+	if problem != "" {
+		t.Fatalf("Expected the rule to be reset, but got %q", problem)
+	}
+	if _, exists := reset.Rules[permissions.CreatePoll]; exists {
+		t.Errorf("Expected the reset rule to be left out so the default applies, but got %+v", reset.Rules[permissions.CreatePoll])
+	}
+	if _, exists := updated.Rules[permissions.CreatePoll]; !exists {
+		t.Error("Expected resetting to leave the policy it was given alone")
+	}
+
+	if _, problem := applyPolicyChange(current, subcommandForTest("remove-role", action,
+		optionForTest("role", discordgo.ApplicationCommandOptionRole, "players"))); problem == "" {
+		t.Error("Expected removing a role the rule does not list to be refused")
+	}
+}
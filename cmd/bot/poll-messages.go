@@ -0,0 +1,165 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// PollMessage links a poll to the Discord message it was posted in.
+type PollMessage struct {
+	PollID string
+	// GuildID is empty for polls posted before it was recorded.
+	GuildID   string
+	ChannelID string
+	MessageID string
+}
+
+// JumpURL links to the poll message in the Discord client.
+func (message PollMessage) JumpURL(fallbackGuildID string) string {
+	guildID := message.GuildID
+	if guildID == "" {
+		guildID = fallbackGuildID
+	}
+	return fmt.Sprintf("https://discord.com/channels/%s/%s/%s", guildID, message.ChannelID, message.MessageID)
+}
+
+type PollMessageRepository interface {
+	Save(ctx context.Context, message PollMessage) error
+	GetByPollID(ctx context.Context, pollID string) (PollMessage, error)
+	// GetByPollIDs returns the messages of the given polls, keyed by poll ID.
+	// Polls without a message are left out.
+	GetByPollIDs(ctx context.Context, pollIDs []string) (map[string]PollMessage, error)
+}
+
+var ErrPollMessageNotFound = errors.New("poll message not found")
+
+type libSQLPollMessageRepository struct {
+	db *sql.DB
+}
+
+func NewLibSQLPollMessageRepository(db *sql.DB) PollMessageRepository {
+	return &libSQLPollMessageRepository{db: db}
+}
+
+func (repo *libSQLPollMessageRepository) Save(ctx context.Context, message PollMessage) error {
+	query := `INSERT INTO poll_messages (poll_id, guild_id, channel_id, message_id) VALUES (?, ?, ?, ?)
+              ON CONFLICT (poll_id) DO UPDATE SET guild_id = excluded.guild_id, channel_id = excluded.channel_id, message_id = excluded.message_id`
+
+	if _, err := repo.db.ExecContext(ctx, query, message.PollID, message.GuildID, message.ChannelID, message.MessageID); err != nil {
+		return fmt.Errorf("error saving poll message: %w", err)
+	}
+
+	return nil
+}
+
+func (repo *libSQLPollMessageRepository) GetByPollID(ctx context.Context, pollID string) (PollMessage, error) {
+	query := `SELECT poll_id, guild_id, channel_id, message_id FROM poll_messages WHERE poll_id = ?`
+	row := repo.db.QueryRowContext(ctx, query, pollID)
+
+	var message PollMessage
+	if err := row.Scan(&message.PollID, &message.GuildID, &message.ChannelID, &message.MessageID); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return PollMessage{}, ErrPollMessageNotFound
+		}
+		return PollMessage{}, fmt.Errorf("error retrieving poll message: %w", err)
+	}
+
+	return message, nil
+}
+
+func (repo *libSQLPollMessageRepository) GetByPollIDs(ctx context.Context, pollIDs []string) (map[string]PollMessage, error) {
+	messages := make(map[string]PollMessage)
+	if len(pollIDs) == 0 {
+		return messages, nil
+	}
+
+	args := make([]any, len(pollIDs))
+	for index, pollID := range pollIDs {
+		args[index] = pollID
+	}
+	placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(pollIDs)), ", ")
+
+	query := `SELECT poll_id, guild_id, channel_id, message_id FROM poll_messages WHERE poll_id IN (` + placeholders + `)`
+	rows, err := repo.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("error retrieving poll messages: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var message PollMessage
+		if err := rows.Scan(&message.PollID, &message.GuildID, &message.ChannelID, &message.MessageID); err != nil {
+			return nil, fmt.Errorf("error scanning poll message: %w", err)
+		}
+		messages[message.PollID] = message
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating over poll messages: %w", err)
+	}
+
+	return messages, nil
+}
+
+var _ PollMessageRepository = (*libSQLPollMessageRepository)(nil)
+
+type memoryPollMessageRepository struct {
+	mu       sync.Mutex
+	messages map[string]PollMessage
+}
+
+func NewMemoryPollMessageRepository() PollMessageRepository {
+	return &memoryPollMessageRepository{
+		messages: make(map[string]PollMessage),
+	}
+}
+
+func (repo *memoryPollMessageRepository) Save(ctx context.Context, message PollMessage) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+
+	repo.messages[message.PollID] = message
+	return nil
+}
+
+func (repo *memoryPollMessageRepository) GetByPollID(ctx context.Context, pollID string) (PollMessage, error) {
+	if err := ctx.Err(); err != nil {
+		return PollMessage{}, err
+	}
+
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+
+	message, exists := repo.messages[pollID]
+	if !exists {
+		return PollMessage{}, ErrPollMessageNotFound
+	}
+	return message, nil
+}
+
+func (repo *memoryPollMessageRepository) GetByPollIDs(ctx context.Context, pollIDs []string) (map[string]PollMessage, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+
+	messages := make(map[string]PollMessage)
+	for _, pollID := range pollIDs {
+		if message, exists := repo.messages[pollID]; exists {
+			messages[pollID] = message
+		}
+	}
+	return messages, nil
+}
+
+var _ PollMessageRepository = (*memoryPollMessageRepository)(nil)
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"strings"
+	"testing"
+
+	"betting-discord-bot/internal/storage"
+)
+
+func setupLibSQLPollMessages(t *testing.T) (PollMessageRepository, func()) {
+	t.Helper()
+
+	sanitizedTestName := strings.ReplaceAll(t.Name(), "/", "_")
+	dbPath := sanitizedTestName + ".db"
+	_ = os.Remove(dbPath)
+
+	db, err := storage.InitializeDatabase(dbPath, "")
+	if err != nil {
+		t.Fatalf("Failed to initialize test database: %v", err)
+	}
+
+	// Poll messages belong to polls, so the polls the tests post must exist.
+	for _, pollID := range []string{"poll", "first", "second", "other"} {
+		if _, err := db.Exec("INSERT INTO polls (id) VALUES (?)", pollID); err != nil {
+			t.Fatalf("Failed to save poll %s: %v", pollID, err)
+		}
+	}
+
+	repo := NewLibSQLPollMessageRepository(db)
+	teardown := func() {
+		if err := db.Close(); err != nil {
+			t.Fatal("failed to close database")
+		}
+		if err := os.Remove(dbPath); err != nil {
+			t.Fatal("failed to remove database file")
+		}
+	}
+
+	return repo, teardown
+}
+
+func setupInMemoryPollMessages(t *testing.T) (PollMessageRepository, func()) {
+	t.Helper()
+	return NewMemoryPollMessageRepository(), func() {}
+}
+
+func TestPollMessageRepositoryImplementations(t *testing.T) {
+	t.Parallel()
+	implementations := []struct {
+		name  string
+		setup func(t *testing.T) (PollMessageRepository, func())
+	}{
+		{name: "InMemoryRepository", setup: setupInMemoryPollMessages},
+		{name: "LibSQLRepository", setup: setupLibSQLPollMessages},
+	}
+
+	testCases := []struct {
+		name string
+		run  func(t *testing.T, repo PollMessageRepository)
+	}{
+		{"it should save and get a poll message", testSaveAndGetPollMessage},
+		{"it should replace the message of a poll", testReplacePollMessage},
+		{"it should return an error for an unknown poll", testUnknownPollMessage},
+		{"it should get the messages of many polls", testGetPollMessagesByPollIDs},
+	}
+
+	for _, impl := range implementations {
+		t.Run(impl.name, func(t *testing.T) {
+			t.Parallel()
+
+			for _, tc := range testCases {
+				t.Run(tc.name, func(t *testing.T) {
+					t.Parallel()
+
+					repo, cleanup := impl.setup(t)
+					t.Cleanup(cleanup)
+
+					tc.run(t, repo)
+				})
+			}
+		})
+	}
+}
+
+func testSaveAndGetPollMessage(t *testing.T, repo PollMessageRepository) {
+	message := PollMessage{PollID: "poll", GuildID: "guild", ChannelID: "channel", MessageID: "message"}
+	if err := repo.Save(t.Context(), message); err != nil {
+		t.Fatalf("Save() returned an unexpected error: %v", err)
+	}
+
+	retrieved, err := repo.GetByPollID(t.Context(), message.PollID)
+	if err != nil {
+		t.Fatalf("GetByPollID() returned an unexpected error: %v", err)
+	}
+	if retrieved != message {
+		t.Errorf("Expected %+v, but got %+v", message, retrieved)
+	}
+}
+
+func testReplacePollMessage(t *testing.T, repo PollMessageRepository) {
+	if err := repo.Save(t.Context(), PollMessage{PollID: "poll", ChannelID: "channel", MessageID: "old"}); err != nil {
+		t.Fatalf("Save() returned an unexpected error: %v", err)
+	}
+	replacement := PollMessage{PollID: "poll", ChannelID: "channel", MessageID: "new"}
+	if err := repo.Save(t.Context(), replacement); err != nil {
+		t.Fatalf("Save() returned an unexpected error: %v", err)
+	}
+
+	retrieved, err := repo.GetByPollID(t.Context(), "poll")
+	if err != nil {
+		t.Fatalf("GetByPollID() returned an unexpected error: %v", err)
+	}
+	if retrieved != replacement {
+		t.Errorf("Expected %+v, but got %+v", replacement, retrieved)
+	}
+}
+
+func testUnknownPollMessage(t *testing.T, repo PollMessageRepository) {
+	_, err := repo.GetByPollID(t.Context(), "missing")
+	if !errors.Is(err, ErrPollMessageNotFound) {
+		t.Errorf("Expected error '%v', but got '%v'", ErrPollMessageNotFound, err)
+	}
+}
+
+func testGetPollMessagesByPollIDs(t *testing.T, repo PollMessageRepository) {
+	first := PollMessage{PollID: "first", GuildID: "guild", ChannelID: "channel", MessageID: "1"}
+	second := PollMessage{PollID: "second", GuildID: "guild", ChannelID: "channel", MessageID: "2"}
+	for _, message := range []PollMessage{first, second, {PollID: "other", ChannelID: "channel", MessageID: "3"}} {
+		if err := repo.Save(t.Context(), message); err != nil {
+			t.Fatalf("Save() returned an unexpected error: %v", err)
+		}
+	}
+
+	messages, err := repo.GetByPollIDs(t.Context(), []string{"first", "second", "missing"})
+	if err != nil {
+		t.Fatalf("GetByPollIDs() returned an unexpected error: %v", err)
+	}
+	if len(messages) != 2 || messages["first"] != first || messages["second"] != second {
+		t.Errorf("Expected the messages of the first and second polls, but got %+v", messages)
+	}
+}
+
+func TestPollMessageJumpURL(t *testing.T) {
+	message := PollMessage{PollID: "poll", GuildID: "guild", ChannelID: "channel", MessageID: "message"}
+	if got := message.JumpURL("fallback"); got != "https://discord.com/channels/guild/channel/message" {
+		t.Errorf("JumpURL() = %q", got)
+	}
+
+	message.GuildID = ""
+	if got := message.JumpURL("fallback"); got != "https://discord.com/channels/fallback/channel/message" {
+		t.Errorf("JumpURL() = %q", got)
+	}
+}
@@ -0,0 +1,213 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+
+	"betting-discord-bot/internal/bets"
+	"betting-discord-bot/internal/polls"
+)
+
+// maxListedWinners caps how many winners are named on a resolved poll.
+const maxListedWinners = 10
+
+// refreshPollMessage redraws the poll message to match the current state of
+// the poll and its bets.
+func (bot *Bot) refreshPollMessage(ctx context.Context, pollID string) {
+	ctx, cancel := followUp(ctx)
+	defer cancel()
+
+	poll, err := bot.PollService.GetPollById(ctx, pollID)
+	if err != nil {
+		log.Printf("Error getting poll: %v", err)
+		return
+	}
+
+	pollBets, err := bot.BetService.GetBetsByPollId(ctx, pollID)
+	if err != nil {
+		log.Printf("Error getting bets of poll %s: %v", pollID, err)
+		return
+	}
+
+	bot.editPollMessage(ctx, pollID, renderPollMessage(poll, pollBets, bot.accentColour(ctx, poll.GetGuildID()), bot.mentioner(ctx)))
+}
+
+// renderPollMessage draws the poll message: the title and state of the poll,
+// the bets on each option, the winners once an outcome is selected, and the
+// buttons that still apply. mention renders an internal user ID.
+func renderPollMessage(poll polls.Poll, pollBets []bets.Bet, accentColour int, mention func(userID string) string) MessageSend {
+	if poll.GetStatus() == polls.Cancelled {
+		return MessageSend{
+			Flags: IsComponentsV2,
+			Components: []interface{}{
+				NewContainer(
+					accentColour,
+					[]interface{}{
+						NewTextDisplay(fmt.Sprintf(
+							"# ~~%s~~\n**This poll was cancelled.** All bets on it have been voided.",
+							poll.GetTitle(),
+						)),
+					},
+				),
+			},
+		}
+	}
+
+	lines := []string{"# " + poll.GetTitle()}
+	resolved := poll.GetStatus() == polls.Closed && poll.GetOutcome() != polls.Pending
+	switch {
+	case poll.GetStatus() == polls.Open:
+		lines = append(lines, "-# You can switch or withdraw your bet until betting closes.")
+		if !poll.GetClosesAt().IsZero() {
+			lines = append(lines, fmt.Sprintf("-# Betting closes <t:%d:R>.", poll.GetClosesAt().Unix()))
+		}
+	case resolved:
+		lines = append(lines, fmt.Sprintf("**Closed** · The outcome is **%s**.", poll.GetOptions()[poll.GetOutcome()]))
+	default:
+		lines = append(lines, "**Closed** · An outcome will be selected soon.")
+	}
+
+	lines = append(lines, "", formatPollTally(poll, pollBets))
+	if resolved {
+		lines = append(lines, "", formatPollWinners(pollBets, mention))
+	}
+
+	endPollButton := NewButton(4, "End Poll", fmt.Sprintf("end:%s", poll.GetID()))
+	endPollButton.Disabled = poll.GetStatus() != polls.Open
+
+	// Once an outcome is selected, the same button corrects it.
+	outcomeLabel := "Select Outcome"
+	if resolved {
+		outcomeLabel = "Correct Outcome"
+	}
+	selectOutcomeButton := NewButton(4, outcomeLabel, fmt.Sprintf("outcome:%s", poll.GetID()))
+	selectOutcomeButton.Disabled = poll.GetStatus() == polls.Open
+
+	cancelPollButton := NewButton(2, "Cancel Poll", fmt.Sprintf("cancel:%s", poll.GetID()))
+
+	moderatorButtons := NewActionRow(
+		[]interface{}{
+			endPollButton,
+			selectOutcomeButton,
+			cancelPollButton,
+		},
+	)
+
+	container := NewContainer(
+		accentColour,
+		[]interface{}{
+			NewTextDisplay(strings.Join(lines, "\n")),
+			newBetActionRow(poll),
+			moderatorButtons,
+		},
+	)
+
+	return MessageSend{
+		Flags: IsComponentsV2,
+		Components: []interface{}{
+			container,
+		},
+		AllowedMentions: &AllowedMentions{Parse: []string{}},
+	}
+}
+
+// formatPollTally lists the number of bets and the points staked on each option.
+func formatPollTally(poll polls.Poll, pollBets []bets.Bet) string {
+	options := poll.GetOptions()
+	betCounts := make([]int, len(options))
+	staked := make([]int64, len(options))
+	for _, pollBet := range pollBets {
+		index := pollBet.GetSelectedOptionIndex()
+		if index < 0 || index >= len(options) {
+			continue
+		}
+		betCounts[index]++
+		staked[index] += pollBet.GetStake()
+	}
+
+	lines := make([]string, len(options))
+	for index, option := range options {
+		line := fmt.Sprintf("**%s** · %d bets", option, betCounts[index])
+		if betCounts[index] == 1 {
+			line = fmt.Sprintf("**%s** · 1 bet", option)
+		}
+		if staked[index] > 0 {
+			line += fmt.Sprintf(" · %d points", staked[index])
+		}
+		if poll.GetStatus() == polls.Closed && poll.GetOutcome() == polls.OutcomeStatus(index) {
+			line += " · Winner"
+		}
+		lines[index] = line
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+// formatPollWinners names the winners of a resolved poll, largest payout first.
+func formatPollWinners(pollBets []bets.Bet, mention func(userID string) string) string {
+	var winners []bets.Bet
+	for _, pollBet := range pollBets {
+		if pollBet.GetBetStatus() == bets.Won {
+			winners = append(winners, pollBet)
+		}
+	}
+
+	if len(winners) == 0 {
+		return "Nobody backed the winning option."
+	}
+
+	sort.SliceStable(winners, func(a, b int) bool {
+		return winners[a].GetPayout() > winners[b].GetPayout()
+	})
+
+	names := make([]string, 0, min(len(winners), maxListedWinners))
+	for _, winner := range winners[:min(len(winners), maxListedWinners)] {
+		name := mention(winner.GetBetKey().UserID)
+		if winner.GetPayout() > 0 {
+			name += fmt.Sprintf(" (won %d)", winner.GetPayout())
+		}
+		names = append(names, name)
+	}
+
+	line := "**Winners:** " + strings.Join(names, ", ")
+	if len(winners) > maxListedWinners {
+		line += fmt.Sprintf(" and %d more", len(winners)-maxListedWinners)
+	}
+	return line
+}
+
+// newBetActionRow renders one bet button per option, or a single select menu
+// when there are more options than fit in a row. The bet controls are disabled
+// once betting has closed.
+func newBetActionRow(poll polls.Poll) *ActionRow {
+	options := poll.GetOptions()
+	closed := poll.GetStatus() != polls.Open
+
+	if len(options) <= maxBetButtons {
+		buttons := make([]interface{}, len(options))
+		for index, option := range options {
+			button := NewButton(
+				2,
+				fmt.Sprintf("Bet on %s", option),
+				fmt.Sprintf("bet:%s:%d", poll.GetID(), index),
+			)
+			button.Disabled = closed
+			buttons[index] = button
+		}
+		return NewActionRow(buttons)
+	}
+
+	betDropdown := NewStringSelect(
+		"Place your bet",
+		1,
+		1,
+		fmt.Sprintf("bet:%s", poll.GetID()),
+		newOptionSelectList(options),
+	)
+	betDropdown.Disabled = closed
+
+	return NewActionRow([]interface{}{betDropdown})
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"betting-discord-bot/internal/bets"
+	"betting-discord-bot/internal/polls"
+)
+
+type tallyBet struct {
+	userID      string
+	optionIndex int
+	status      bets.BetStatus
+	stake       int64
+	payout      int64
+}
+
+func (b tallyBet) GetBetKey() bets.BetKey       { return bets.BetKey{PollID: "poll-1", UserID: b.userID} }
+func (b tallyBet) GetSelectedOptionIndex() int  { return b.optionIndex }
+func (b tallyBet) GetBetStatus() bets.BetStatus { return b.status }
+func (b tallyBet) GetStake() int64              { return b.stake }
+func (b tallyBet) GetPayout() int64             { return b.payout }
+
+func mentionForTest(userID string) string { return "<@" + userID + ">" }
+
+func TestFormatPollTally(t *testing.T) {
+	poll := listedPoll{title: "Who wins?", options: []string{"Red", "Blue", "Green"}, status: polls.Closed, outcome: polls.OutcomeStatus(1)}
+	pollBets := []bets.Bet{
+		tallyBet{userID: "alice", optionIndex: 0, stake: 10},
+		tallyBet{userID: "bob", optionIndex: 1, stake: 25},
+		tallyBet{userID: "carol", optionIndex: 1},
+	}
+
+	want := "**Red** · 1 bet · 10 points\n**Blue** · 2 bets · 25 points · Winner\n**Green** · 0 bets"
+	if got := formatPollTally(poll, pollBets); got != want {
+		t.Errorf("formatPollTally() = %q, want %q", got, want)
+	}
+}
+
+func TestFormatPollWinners(t *testing.T) {
+	tests := []struct {
+		name     string
+		pollBets []bets.Bet
+		want     string
+	}{
+		{
+			name: "Largest Payout First",
+			pollBets: []bets.Bet{
+				tallyBet{userID: "alice", status: bets.Won, stake: 10, payout: 15},
+				tallyBet{userID: "bob", status: bets.Lost, stake: 20},
+				tallyBet{userID: "carol", status: bets.Won, stake: 20, payout: 30},
+				tallyBet{userID: "dave", status: bets.Won},
+			},
+			want: "**Winners:** <@carol> (won 30), <@alice> (won 15), <@dave>",
+		},
+		{
+			name:     "No Winners",
+			pollBets: []bets.Bet{tallyBet{userID: "bob", status: bets.Lost}},
+			want:     "Nobody backed the winning option.",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := formatPollWinners(tt.pollBets, mentionForTest); got != tt.want {
+				t.Errorf("formatPollWinners() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	var manyWinners []bets.Bet
+	for index := range maxListedWinners + 2 {
+		manyWinners = append(manyWinners, tallyBet{userID: fmt.Sprint(index), status: bets.Won})
+	}
+	if got := formatPollWinners(manyWinners, mentionForTest); !strings.HasSuffix(got, " and 2 more") {
+		t.Errorf("formatPollWinners() = %q, want it to end with %q", got, " and 2 more")
+	}
+}
+
+func TestRenderPollMessageDisablesBettingOnceClosed(t *testing.T) {
+	tests := []struct {
+		name              string
+		status            polls.PollStatus
+		outcome           polls.OutcomeStatus
+		betsDisabled      bool
+		endDisabled       bool
+		outcomeLabel      string
+		outcomeDisabled   bool
+		expectedInSummary string
+	}{
+		{"Open", polls.Open, polls.Pending, false, false, "Select Outcome", true, "until betting closes"},
+		{"Closed", polls.Closed, polls.Pending, true, true, "Select Outcome", false, "**Closed** · An outcome will be selected soon."},
+		{"Resolved", polls.Closed, polls.OutcomeStatus(0), true, true, "Correct Outcome", false, "**Closed** · The outcome is **Red**."},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			poll := listedPoll{title: "Who wins?", options: []string{"Red", "Blue"}, status: tt.status, outcome: tt.outcome}
+			message := renderPollMessage(poll, nil, defaultAccentColour, mentionForTest)
+
+			container := message.Components[0].(*Container)
+			summary := container.Components[0].(*TextDisplay).Content
+			if !strings.Contains(summary, tt.expectedInSummary) {
+				t.Errorf("poll message %q does not contain %q", summary, tt.expectedInSummary)
+			}
+
+			for _, component := range container.Components[1].(*ActionRow).Components {
+				if button := component.(*Button); button.Disabled != tt.betsDisabled {
+					t.Errorf("bet button %q disabled = %v, want %v", button.Label, button.Disabled, tt.betsDisabled)
+				}
+			}
+
+			moderatorButtons := container.Components[2].(*ActionRow).Components
+			if endButton := moderatorButtons[0].(*Button); endButton.Disabled != tt.endDisabled {
+				t.Errorf("End Poll disabled = %v, want %v", endButton.Disabled, tt.endDisabled)
+			}
+			outcomeButton := moderatorButtons[1].(*Button)
+			if outcomeButton.Label != tt.outcomeLabel || outcomeButton.Disabled != tt.outcomeDisabled {
+				t.Errorf("outcome button = (%q, disabled %v), want (%q, disabled %v)", outcomeButton.Label, outcomeButton.Disabled, tt.outcomeLabel, tt.outcomeDisabled)
+			}
+		})
+	}
+}
+
+func TestRenderCancelledPollMessage(t *testing.T) {
+	poll := listedPoll{title: "Who wins?", options: []string{"Red", "Blue"}, status: polls.Cancelled, outcome: polls.Pending}
+	container := renderPollMessage(poll, nil, defaultAccentColour, mentionForTest).Components[0].(*Container)
+
+	if len(container.Components) != 1 {
+		t.Fatalf("Expected a cancelled poll to have no buttons, but got %d components", len(container.Components))
+	}
+	if summary := container.Components[0].(*TextDisplay).Content; !strings.Contains(summary, "~~Who wins?~~") {
+		t.Errorf("poll message %q does not strike through the title", summary)
+	}
+}
@@ -0,0 +1,208 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"betting-discord-bot/internal/polls"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+const pollsPageSize = 5
+
+// maxPollsPage caps the page asked for by a button, which would otherwise be
+// able to overflow the offset.
+const maxPollsPage = math.MaxInt32 / pollsPageSize
+
+// recentlyClosedWindow is how long a closed poll stays on the list.
+const recentlyClosedWindow = 7 * 24 * time.Hour
+
+var pollsFilterHeadings = map[string]string{
+	"all":    "Open and recently closed polls",
+	"open":   "Open polls",
+	"closed": "Recently closed polls",
+}
+
+func (bot *Bot) handlePollsCommand(ctx context.Context, i *discordgo.InteractionCreate) {
+	filter := "all"
+	for _, option := range i.ApplicationCommandData().Options {
+		if option.Name == "status" {
+			filter = option.StringValue()
+		}
+	}
+
+	message, err := bot.pollsMessage(ctx, i.GuildID, filter, 0, time.Now())
+	if err != nil {
+		log.Printf("Error building poll list: %v", err)
+		bot.sendInteractionResponse(ctx, i, "The polls could not be loaded. Please try again.")
+		return
+	}
+
+	if err := bot.sendInteractionCallback(ctx, i, ChannelMessageWithSource, message); err != nil {
+		log.Printf("Error sending poll list: %v", err)
+	}
+}
+
+// handlePollsPage shows another page of polls in place of the one whose button
+// was pressed ("polls:<status>:<page>").
+func (bot *Bot) handlePollsPage(ctx context.Context, i *discordgo.InteractionCreate, customID string) {
+	filter, page, err := parsePollsCustomID(customID)
+	if err != nil {
+		log.Printf("failed to parse polls custom ID: %v", err)
+		bot.sendInteractionResponse(ctx, i, "The polls could not be loaded. Please try again.")
+		return
+	}
+
+	message, err := bot.pollsMessage(ctx, i.GuildID, filter, page, time.Now())
+	if err != nil {
+		log.Printf("Error building poll list: %v", err)
+		bot.sendInteractionResponse(ctx, i, "The polls could not be loaded. Please try again.")
+		return
+	}
+
+	if err := bot.sendInteractionCallback(ctx, i, UpdateMessage, message); err != nil {
+		log.Printf("Error sending poll list: %v", err)
+	}
+}
+
+func parsePollsCustomID(customID string) (string, int, error) {
+	pollsData := strings.Split(customID, ":")
+	if len(pollsData) != 3 {
+		return "", 0, fmt.Errorf("invalid polls custom ID: %s", customID)
+	}
+
+	if _, exists := pollsFilterHeadings[pollsData[1]]; !exists {
+		return "", 0, fmt.Errorf("invalid polls status: %s", pollsData[1])
+	}
+
+	page, err := strconv.Atoi(pollsData[2])
+	if err != nil || page < 0 {
+		return "", 0, fmt.Errorf("invalid polls page: %s", pollsData[2])
+	}
+
+	return pollsData[1], min(page, maxPollsPage), nil
+}
+
+func pollQueryFor(filter string, now time.Time) polls.PollQuery {
+	query := polls.PollQuery{ClosedSince: now.Add(-recentlyClosedWindow)}
+	switch filter {
+	case "open":
+		query.Statuses = []polls.PollStatus{polls.Open}
+	case "closed":
+		query.Statuses = []polls.PollStatus{polls.Closed, polls.Cancelled}
+	}
+	return query
+}
+
+func (bot *Bot) pollsMessage(ctx context.Context, guildID string, filter string, page int, now time.Time) (MessageSend, error) {
+	if _, exists := pollsFilterHeadings[filter]; !exists {
+		return MessageSend{}, fmt.Errorf("invalid polls status: %s", filter)
+	}
+
+	query := pollQueryFor(filter, now)
+	query.GuildID = guildID
+	query.Limit = pollsPageSize
+	query.Offset = page * pollsPageSize
+
+	pollPage, err := bot.PollService.ListPolls(ctx, query)
+	if err != nil {
+		return MessageSend{}, err
+	}
+
+	// Polls may have dropped off the list since the page button was rendered.
+	if len(pollPage.Polls) == 0 && pollPage.Total > 0 {
+		page = (pollPage.Total - 1) / pollsPageSize
+		query.Offset = page * pollsPageSize
+		if pollPage, err = bot.PollService.ListPolls(ctx, query); err != nil {
+			return MessageSend{}, err
+		}
+	}
+
+	var pollIDs []string
+	for _, poll := range pollPage.Polls {
+		pollIDs = append(pollIDs, poll.GetID())
+	}
+
+	betCounts, err := bot.BetService.GetBetCounts(ctx, pollIDs)
+	if err != nil {
+		return MessageSend{}, err
+	}
+
+	pollMessages, err := bot.PollMessages.GetByPollIDs(ctx, pollIDs)
+	if err != nil {
+		return MessageSend{}, err
+	}
+
+	lines := []string{"## " + pollsFilterHeadings[filter]}
+	if len(pollPage.Polls) == 0 {
+		lines = append(lines, "There are no polls here right now.")
+	}
+	for _, poll := range pollPage.Polls {
+		jumpURL := ""
+		if pollMessage, exists := pollMessages[poll.GetID()]; exists {
+			jumpURL = pollMessage.JumpURL(guildID)
+		}
+		lines = append(lines, formatPollListEntry(poll, betCounts[poll.GetID()], jumpURL))
+	}
+
+	pageCount := max((pollPage.Total+pollsPageSize-1)/pollsPageSize, 1)
+	lines = append(lines, fmt.Sprintf("-# Page %d of %d", page+1, pageCount))
+
+	messageContainer := NewContainer(
+		bot.accentColour(ctx, guildID),
+		[]interface{}{
+			NewTextDisplay(strings.Join(lines, "\n")),
+			newPaginationRow("polls:"+filter, page, pageCount),
+		},
+	)
+
+	return MessageSend{
+		Flags: IsComponentsV2 | MessageIsEphemeral,
+		Components: []interface{}{
+			messageContainer,
+		},
+	}, nil
+}
+
+// formatPollListEntry renders a poll as a line of the poll list. The title
+// links to the poll message when jumpURL is set.
+func formatPollListEntry(poll polls.Poll, betCount int, jumpURL string) string {
+	title := fmt.Sprintf("**%s**", poll.GetTitle())
+	if jumpURL != "" {
+		title = fmt.Sprintf("**[%s](%s)**", poll.GetTitle(), jumpURL)
+	}
+
+	parts := []string{title}
+	if poll.GetCategory() != "" {
+		parts = append(parts, poll.GetCategory())
+	}
+
+	if betCount == 1 {
+		parts = append(parts, "1 bet")
+	} else {
+		parts = append(parts, fmt.Sprintf("%d bets", betCount))
+	}
+
+	switch {
+	case poll.GetStatus() == polls.Cancelled:
+		parts = append(parts, "Cancelled")
+	case poll.GetStatus() == polls.Open && poll.GetClosesAt().IsZero():
+		parts = append(parts, "Open")
+	case poll.GetStatus() == polls.Open:
+		parts = append(parts, fmt.Sprintf("Closes <t:%d:R>", poll.GetClosesAt().Unix()))
+	case poll.GetOutcome() != polls.Pending && int(poll.GetOutcome()) < len(poll.GetOptions()):
+		parts = append(parts, fmt.Sprintf("Won by **%s**", poll.GetOptions()[poll.GetOutcome()]))
+	case !poll.GetClosedAt().IsZero():
+		parts = append(parts, fmt.Sprintf("Closed <t:%d:R>", poll.GetClosedAt().Unix()))
+	default:
+		parts = append(parts, "Closed")
+	}
+
+	return strings.Join(parts, " · ")
+}
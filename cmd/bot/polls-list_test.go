@@ -0,0 +1,124 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"betting-discord-bot/internal/polls"
+)
+
+type listedPoll struct {
+	title     string
+	options   []string
+	status    polls.PollStatus
+	outcome   polls.OutcomeStatus
+	closesAt  time.Time
+	category  string
+	createdAt time.Time
+	closedAt  time.Time
+}
+
+func (p listedPoll) GetID() string                   { return "poll-1" }
+func (p listedPoll) GetGuildID() string              { return testGuildID }
+func (p listedPoll) GetCreatorID() string            { return "" }
+func (p listedPoll) GetTitle() string                { return p.title }
+func (p listedPoll) GetOptions() []string            { return p.options }
+func (p listedPoll) GetStatus() polls.PollStatus     { return p.status }
+func (p listedPoll) GetOutcome() polls.OutcomeStatus { return p.outcome }
+func (p listedPoll) GetClosesAt() time.Time          { return p.closesAt }
+func (p listedPoll) GetCategory() string             { return p.category }
+func (p listedPoll) GetCreatedAt() time.Time         { return p.createdAt }
+func (p listedPoll) GetClosedAt() time.Time          { return p.closedAt }
+
+func TestParsePollsCustomID(t *testing.T) {
+	filter, page, err := parsePollsCustomID("polls:closed:3")
+	if err != nil {
+		t.Fatalf("parsePollsCustomID() returned an unexpected error: %v", err)
+	}
+	if filter != "closed" || page != 3 {
+		t.Errorf("parsePollsCustomID() = (%q, %d), want (%q, %d)", filter, page, "closed", 3)
+	}
+
+	if _, page, _ := parsePollsCustomID("polls:open:9000000000000000000"); page != maxPollsPage {
+		t.Errorf("parsePollsCustomID() page = %d, want it clamped to %d", page, maxPollsPage)
+	}
+
+	for _, customID := range []string{"polls:resolved:0", "polls:open:-1", "polls:open"} {
+		if _, _, err := parsePollsCustomID(customID); err == nil {
+			t.Errorf("parsePollsCustomID(%q) expected an error", customID)
+		}
+	}
+}
+
+func TestPollQueryFor(t *testing.T) {
+	now := time.Unix(1_700_000_000, 0)
+
+	closedQuery := pollQueryFor("closed", now)
+	if len(closedQuery.Statuses) != 2 || closedQuery.Statuses[0] != polls.Closed || closedQuery.Statuses[1] != polls.Cancelled {
+		t.Errorf("pollQueryFor(closed).Statuses = %v, want [Closed Cancelled]", closedQuery.Statuses)
+	}
+	if !closedQuery.ClosedSince.Equal(now.Add(-recentlyClosedWindow)) {
+		t.Errorf("pollQueryFor(closed).ClosedSince = %v, want %v", closedQuery.ClosedSince, now.Add(-recentlyClosedWindow))
+	}
+
+	if openQuery := pollQueryFor("open", now); len(openQuery.Statuses) != 1 || openQuery.Statuses[0] != polls.Open {
+		t.Errorf("pollQueryFor(open).Statuses = %v, want [Open]", openQuery.Statuses)
+	}
+
+	if allQuery := pollQueryFor("all", now); len(allQuery.Statuses) != 0 {
+		t.Errorf("pollQueryFor(all).Statuses = %v, want every status", allQuery.Statuses)
+	}
+}
+
+func TestFormatPollListEntry(t *testing.T) {
+	options := []string{"Red", "Blue"}
+	jumpURL := "https://discord.com/channels/1/2/3"
+
+	tests := []struct {
+		name     string
+		poll     listedPoll
+		betCount int
+		jumpURL  string
+		want     string
+	}{
+		{
+			name:     "Open With Deadline",
+			poll:     listedPoll{title: "Who wins?", options: options, status: polls.Open, outcome: polls.Pending, closesAt: time.Unix(1_700_000_000, 0), category: "Valorant"},
+			betCount: 4,
+			jumpURL:  jumpURL,
+			want:     "**[Who wins?](https://discord.com/channels/1/2/3)** · Valorant · 4 bets · Closes <t:1700000000:R>",
+		},
+		{
+			name:     "Open Without Deadline",
+			poll:     listedPoll{title: "Who wins?", options: options, status: polls.Open, outcome: polls.Pending},
+			betCount: 1,
+			want:     "**Who wins?** · 1 bet · Open",
+		},
+		{
+			name: "Closed Awaiting Outcome",
+			poll: listedPoll{title: "Who wins?", options: options, status: polls.Closed, outcome: polls.Pending, closedAt: time.Unix(1_700_000_000, 0)},
+			want: "**Who wins?** · 0 bets · Closed <t:1700000000:R>",
+		},
+		{
+			name:     "Resolved",
+			poll:     listedPoll{title: "Who wins?", options: options, status: polls.Closed, outcome: polls.OutcomeStatus(1), closedAt: time.Unix(1_700_000_000, 0)},
+			betCount: 2,
+			jumpURL:  jumpURL,
+			want:     "**[Who wins?](https://discord.com/channels/1/2/3)** · 2 bets · Won by **Blue**",
+		},
+		{
+			name:     "Cancelled",
+			poll:     listedPoll{title: "Who wins?", options: options, status: polls.Cancelled, outcome: polls.Pending},
+			betCount: 3,
+			want:     "**Who wins?** · 3 bets · Cancelled",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := formatPollListEntry(tt.poll, tt.betCount, tt.jumpURL); got != tt.want {
+				t.Errorf("formatPollListEntry() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
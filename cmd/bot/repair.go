@@ -0,0 +1,76 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"text/tabwriter"
+
+	"betting-discord-bot/internal/storage"
+)
+
+const repairUsage = "usage: bot repair [check|fix]"
+
+// runRepair runs the repair command, which finds and deletes rows whose poll
+// or user no longer exists without starting the bot. Like migrate, it only
+// needs DB_PATH and ENCRYPTION_KEY.
+func runRepair(out io.Writer, args []string) (err error) {
+	command := "check"
+	if len(args) > 0 {
+		command = args[0]
+	}
+	if len(args) > 1 {
+		return fmt.Errorf("%s", repairUsage)
+	}
+	if command != "check" && command != "fix" {
+		return fmt.Errorf("unknown repair command %q, %s", command, repairUsage)
+	}
+
+	config, err := LoadDatabaseConfig()
+	if err != nil {
+		return fmt.Errorf("failed to load configuration: %w", err)
+	}
+
+	db, err := storage.OpenDatabase(config.DBPath, config.EncryptionKey)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if closeError := db.Close(); closeError != nil && err == nil {
+			err = closeError
+		}
+	}()
+
+	if command == "check" {
+		orphans, err := storage.FindOrphans(db)
+		if err != nil {
+			return err
+		}
+		return printOrphans(out, orphans, "ORPHANS")
+	}
+
+	removed, err := storage.RemoveOrphans(db)
+	if err != nil {
+		return err
+	}
+	return printOrphans(out, removed, "DELETED")
+}
+
+func printOrphans(out io.Writer, orphans []storage.Orphans, heading string) error {
+	total := 0
+	table := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(table, "TABLE\tCOLUMN\tPARENT\t%s\n", heading)
+	for _, orphan := range orphans {
+		total += orphan.Count
+		fmt.Fprintf(table, "%s\t%s\t%s\t%d\n", orphan.Table, orphan.Column, orphan.Parent, orphan.Count)
+	}
+	if err := table.Flush(); err != nil {
+		return err
+	}
+
+	if total == 0 {
+		_, err := fmt.Fprintln(out, "No orphaned rows.")
+		return err
+	}
+	_, err := fmt.Fprintf(out, "%d orphaned rows in total.\n", total)
+	return err
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"bytes"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"betting-discord-bot/internal/storage"
+)
+
+func TestRunRepair(t *testing.T) {
+	dbPath := filepath.Join(t.TempDir(), "bets.db")
+	t.Setenv("DB_PATH", dbPath)
+	t.Setenv("ENCRYPTION_KEY", "000102030405060708090a0b0c0d0e0f101112131415161718191a1b1c1d1e1f")
+
+	repair := func(args ...string) string {
+		t.Helper()
+		var out bytes.Buffer
+		if err := runRepair(&out, args); err != nil {
+			t.Fatalf("repair %v returned an unexpected error: %v", args, err)
+		}
+		return out.String()
+	}
+
+	if err := runMigrate(&bytes.Buffer{}, []string{"up"}); err != nil {
+		t.Fatal("Failed to migrate:", err)
+	}
+
+	// Orphans can only be written with foreign keys off.
+	db, err := storage.OpenDatabase(dbPath, "")
+	if err != nil {
+		t.Fatal("Failed to open database:", err)
+	}
+	conn, err := db.Conn(t.Context())
+	if err != nil {
+		t.Fatal("Failed to get a connection:", err)
+	}
+	for _, statement := range []string{
+		"PRAGMA foreign_keys = OFF",
+		"INSERT INTO poll_options (poll_id, option_index, option_text) VALUES ('gone', 0, 'A')",
+		"INSERT INTO poll_options (poll_id, option_index, option_text) VALUES ('gone', 1, 'B')",
+	} {
+		if _, err := conn.ExecContext(t.Context(), statement); err != nil {
+			t.Fatalf("Failed to insert orphans: %v", err)
+		}
+	}
+	_ = conn.Close()
+	if err := db.Close(); err != nil {
+		t.Fatal("Failed to close database:", err)
+	}
+
+	if check := repair(); !strings.Contains(check, "2 orphaned rows") {
+		t.Errorf("Expected check to find the orphaned options, but got:\n%s", check)
+	}
+	if check := repair("check"); !strings.Contains(check, "2 orphaned rows") {
+		t.Errorf("Expected check to leave the orphaned options alone, but got:\n%s", check)
+	}
+
+	if fix := repair("fix"); !strings.Contains(fix, "2 orphaned rows") {
+		t.Errorf("Expected fix to delete the orphaned options, but got:\n%s", fix)
+	}
+	if check := repair("check"); !strings.Contains(check, "No orphaned rows") {
+		t.Errorf("Expected no orphans left after fix, but got:\n%s", check)
+	}
+
+	if err := runRepair(&bytes.Buffer{}, []string{"everything"}); err == nil {
+		t.Error("Expected an unknown repair command to be refused")
+	}
+}
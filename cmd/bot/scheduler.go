@@ -0,0 +1,123 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"betting-discord-bot/internal/polls"
+)
+
+// pollScheduler runs a callback once for each poll when its deadline passes.
+// Deadlines that have already passed fire straight away, so overdue polls are
+// handled as soon as they are scheduled after a restart.
+type pollScheduler struct {
+	mu         sync.Mutex
+	timers     map[string]*time.Timer
+	onDeadline func(pollID string)
+}
+
+func newPollScheduler(onDeadline func(pollID string)) *pollScheduler {
+	return &pollScheduler{
+		timers:     make(map[string]*time.Timer),
+		onDeadline: onDeadline,
+	}
+}
+
+// Schedule replaces any existing deadline for the poll.
+func (scheduler *pollScheduler) Schedule(pollID string, closesAt time.Time) {
+	scheduler.mu.Lock()
+	defer scheduler.mu.Unlock()
+
+	if timer, exists := scheduler.timers[pollID]; exists {
+		timer.Stop()
+	}
+
+	scheduler.timers[pollID] = time.AfterFunc(time.Until(closesAt), func() {
+		scheduler.mu.Lock()
+		delete(scheduler.timers, pollID)
+		scheduler.mu.Unlock()
+
+		scheduler.onDeadline(pollID)
+	})
+}
+
+func (scheduler *pollScheduler) Cancel(pollID string) {
+	scheduler.mu.Lock()
+	defer scheduler.mu.Unlock()
+
+	if timer, exists := scheduler.timers[pollID]; exists {
+		timer.Stop()
+		delete(scheduler.timers, pollID)
+	}
+}
+
+func (scheduler *pollScheduler) Stop() {
+	scheduler.mu.Lock()
+	defer scheduler.mu.Unlock()
+
+	for pollID, timer := range scheduler.timers {
+		timer.Stop()
+		delete(scheduler.timers, pollID)
+	}
+}
+
+// schedulePollDeadlines reloads the deadlines of every open poll, in every
+// guild, from storage.
+func (bot *Bot) schedulePollDeadlines(ctx context.Context) error {
+	openPolls, err := bot.PollService.GetOpenPolls(ctx, "")
+	if err != nil {
+		return fmt.Errorf("failed to get open polls: %w", err)
+	}
+
+	scheduled := 0
+	for _, poll := range openPolls {
+		if poll.GetClosesAt().IsZero() {
+			continue
+		}
+		bot.Scheduler.Schedule(poll.GetID(), poll.GetClosesAt())
+		scheduled++
+	}
+
+	log.Printf("Scheduled %d poll deadlines", scheduled)
+	return nil
+}
+
+// closePollAtDeadline closes the poll and announces it in the guild's
+// announcement channel, or the poll's channel if there is none.
+func (bot *Bot) closePollAtDeadline(pollID string) {
+	ctx, cancel := followUp(context.Background())
+	defer cancel()
+
+	if err := bot.PollService.ClosePoll(ctx, pollID); err != nil {
+		if errors.Is(err, polls.ErrPollIsAlreadyClosed) {
+			return
+		}
+		log.Printf("Error closing poll %s at its deadline: %v", pollID, err)
+		return
+	}
+
+	log.Printf("Poll %s closed at its deadline", pollID)
+
+	bot.refreshPollMessage(ctx, pollID)
+
+	poll, pollErr := bot.PollService.GetPollById(ctx, pollID)
+	if pollErr != nil {
+		log.Printf("Error getting poll: %v", pollErr)
+		return
+	}
+
+	pollMessage, messageErr := bot.PollMessages.GetByPollID(ctx, pollID)
+	if messageErr != nil {
+		log.Printf("Error getting message of poll %s: %v", pollID, messageErr)
+		return
+	}
+
+	bot.announce(ctx, poll.GetGuildID(), pollMessage.ChannelID, fmt.Sprintf(
+		"Betting on **%s** has closed.\n\nAn outcome will be selected soon.",
+		poll.GetTitle(),
+	))
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestPollSchedulerFiresAtDeadline(t *testing.T) {
+	t.Parallel()
+	fired := make(chan string, 2)
+	scheduler := newPollScheduler(func(pollID string) { fired <- pollID })
+	t.Cleanup(scheduler.Stop)
+
+	scheduler.Schedule("overdue", time.Now().Add(-time.Minute))
+	scheduler.Schedule("soon", time.Now().Add(10*time.Millisecond))
+
+	received := map[string]bool{}
+	for range 2 {
+		select {
+		case pollID := <-fired:
+			received[pollID] = true
+		case <-time.After(time.Second):
+			t.Fatal("Scheduler did not fire in time")
+		}
+	}
+
+	if !received["overdue"] || !received["soon"] {
+		t.Errorf("Expected both polls to fire, but got %v", received)
+	}
+}
+
+func TestPollSchedulerCancel(t *testing.T) {
+	t.Parallel()
+	fired := make(chan string, 1)
+	scheduler := newPollScheduler(func(pollID string) { fired <- pollID })
+	t.Cleanup(scheduler.Stop)
+
+	scheduler.Schedule("cancelled", time.Now().Add(10*time.Millisecond))
+	scheduler.Cancel("cancelled")
+
+	select {
+	case pollID := <-fired:
+		t.Errorf("Expected cancelled poll not to fire, but %s did", pollID)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestParseClosesAt(t *testing.T) {
+	t.Parallel()
+	now := time.Now()
+
+	tests := []struct {
+		input           string
+		defaultDuration time.Duration
+		want            time.Time
+		wantErr         bool
+	}{
+		{input: "", want: time.Time{}},
+		{input: "", defaultDuration: 2 * time.Hour, want: now.Add(2 * time.Hour)},
+		{input: " 90m ", want: now.Add(90 * time.Minute)},
+		{input: "1h30m", defaultDuration: 2 * time.Hour, want: now.Add(90 * time.Minute)},
+		{input: "tomorrow", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		got, err := parseClosesAt(tt.input, tt.defaultDuration, now)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("parseClosesAt(%q) error = %v, wantErr %v", tt.input, err, tt.wantErr)
+			continue
+		}
+		if !got.Equal(tt.want) {
+			t.Errorf("parseClosesAt(%q) = %v, want %v", tt.input, got, tt.want)
+		}
+	}
+}
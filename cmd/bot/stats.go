@@ -0,0 +1,105 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+
+	"betting-discord-bot/internal/users"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// handleStatsCommand shows the profile of the mentioned member, or of the
+// caller when nobody is mentioned.
+func (bot *Bot) handleStatsCommand(ctx context.Context, s *discordgo.Session, i *discordgo.InteractionCreate) {
+	discordID := interactionUser(i).ID
+	for _, option := range i.ApplicationCommandData().Options {
+		if option.Name == "user" {
+			discordID = option.UserValue(nil).ID
+		}
+	}
+
+	user, err := bot.resolveDiscordUser(ctx, discordID)
+	if errors.Is(err, users.ErrUserNotFound) {
+		bot.sendInteractionResponse(ctx, i, fmt.Sprintf("<@%s> has not placed any bets yet.", discordID))
+		return
+	}
+	if err != nil {
+		log.Printf("Error resolving user: %v", err)
+		bot.sendInteractionResponse(ctx, i, "The stats could not be loaded. Please try again.")
+		return
+	}
+
+	stats, err := bot.UserService.GetStats(ctx, user.GetID(), i.GuildID)
+	if err != nil {
+		log.Printf("Error getting user stats: %v", err)
+		bot.sendInteractionResponse(ctx, i, "The stats could not be loaded. Please try again.")
+		return
+	}
+
+	messageContainer := NewContainer(
+		bot.accentColour(ctx, i.GuildID),
+		[]interface{}{
+			NewTextDisplay(formatUserStats(discordID, stats)),
+		},
+	)
+
+	message := MessageSend{
+		Flags: IsComponentsV2,
+		Components: []interface{}{
+			messageContainer,
+		},
+		AllowedMentions: &AllowedMentions{Parse: []string{}},
+	}
+
+	if err := bot.sendInteractionCallback(ctx, i, ChannelMessageWithSource, message); err != nil {
+		log.Printf("Error sending stats: %v", err)
+	}
+}
+
+// resolveDiscordUser finds the internal user linked to a Discord account
+// without creating one, so that looking someone up leaves no trace.
+func (bot *Bot) resolveDiscordUser(ctx context.Context, discordID string) (users.User, error) {
+	return bot.UserService.GetUserByExternalID(ctx, users.Identity{
+		Provider:   "discord",
+		ExternalID: discordID,
+	})
+}
+
+func formatUserStats(discordID string, stats *users.UserStats) string {
+	lines := []string{
+		fmt.Sprintf("## Stats for <@%s>", discordID),
+		fmt.Sprintf(
+			"**Bets:** %d (%d won, %d lost, %d pending, %d voided)",
+			stats.TotalBets,
+			stats.Wins,
+			stats.Losses,
+			stats.Pending,
+			stats.Voided,
+		),
+		fmt.Sprintf("**Win rate:** %.0f%%", stats.WinRate()*100),
+		fmt.Sprintf("**Points:** %+d", stats.Points),
+		fmt.Sprintf("**Win streak:** %d (longest %d)", stats.CurrentStreak, stats.LongestStreak),
+	}
+
+	if len(stats.FavouriteCategories) == 0 {
+		lines = append(lines, "**Favourite categories:** None yet")
+	} else {
+		var categories []string
+		for _, category := range stats.FavouriteCategories {
+			categories = append(categories, fmt.Sprintf("%s (%d)", category.Category, category.Bets))
+		}
+		lines = append(lines, "**Favourite categories:** "+strings.Join(categories, ", "))
+	}
+
+	if stats.Rank == 0 {
+		lines = append(lines, "**Rank:** Unranked")
+	} else {
+		lines = append(lines, fmt.Sprintf("**Rank:** #%d of %d", stats.Rank, stats.RankedUsers))
+	}
+
+	return strings.Join(lines, "\n")
+}
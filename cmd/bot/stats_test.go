@@ -0,0 +1,42 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"betting-discord-bot/internal/users"
+)
+
+func TestFormatUserStats(t *testing.T) {
+	stats := &users.UserStats{
+		TotalBets:           9,
+		Wins:                3,
+		Losses:              1,
+		Pending:             4,
+		Voided:              1,
+		Points:              -15,
+		CurrentStreak:       2,
+		LongestStreak:       3,
+		FavouriteCategories: []users.CategoryCount{{Category: "Valorant", Bets: 5}, {Category: "Food", Bets: 1}},
+		Rank:                4,
+		RankedUsers:         12,
+	}
+
+	want := "## Stats for <@123>\n" +
+		"**Bets:** 9 (3 won, 1 lost, 4 pending, 1 voided)\n" +
+		"**Win rate:** 75%\n" +
+		"**Points:** -15\n" +
+		"**Win streak:** 2 (longest 3)\n" +
+		"**Favourite categories:** Valorant (5), Food (1)\n" +
+		"**Rank:** #4 of 12"
+	if got := formatUserStats("123", stats); got != want {
+		t.Errorf("formatUserStats() = %q, want %q", got, want)
+	}
+
+	unranked := formatUserStats("123", &users.UserStats{})
+	for _, line := range []string{"**Favourite categories:** None yet", "**Rank:** Unranked"} {
+		if !strings.Contains(unranked, line) {
+			t.Errorf("formatUserStats() = %q, want it to contain %q", unranked, line)
+		}
+	}
+}
@@ -1,24 +1,90 @@
 package bets
 
-import "errors"
+import (
+	"context"
+	"errors"
+
+	"betting-discord-bot/internal/polls"
+	"betting-discord-bot/internal/storage"
+)
 
 type BetService interface {
-	CreateBet(pollID string, userID string, selectedOptionIndex int) (Bet, error)
-	GetBet(pollID string, userID string) (Bet, error)
-	UpdateBetsByPollId(pollID string) error
-	GetBetsFromUser(userID string) ([]Bet, error)
+	// CreateBet places a bet and takes the stake from the user's wallet. A stake
+	// of zero places a bet without a wager.
+	CreateBet(ctx context.Context, pollID string, userID string, selectedOptionIndex int, stake int64) (Bet, error)
+	GetBet(ctx context.Context, pollID string, userID string) (Bet, error)
+	// ChangeBet moves the user's bet, and its stake, to another option while the
+	// poll is open.
+	ChangeBet(ctx context.Context, pollID string, userID string, newOptionIndex int) (Bet, error)
+	// WithdrawBet removes the user's bet and refunds its stake while the poll is
+	// open. The user may bet on the poll again afterwards.
+	WithdrawBet(ctx context.Context, pollID string, userID string) error
+	// GetBetChanges returns the user's changes to their bet on the poll, oldest first.
+	GetBetChanges(ctx context.Context, pollID string, userID string) ([]BetChange, error)
+	// GetBetChangesByUser returns the user's changes to their bets on every
+	// poll, oldest first.
+	GetBetChangesByUser(ctx context.Context, userID string) ([]BetChange, error)
+	// UpdateBetsByPollId re-settles every bet on the poll against its stored outcome.
+	UpdateBetsByPollId(ctx context.Context, pollID string) error
+	// SettlePoll selects the outcome of a closed poll and settles every bet on it.
+	// Running it again with the same outcome leaves the bets unchanged.
+	SettlePoll(ctx context.Context, pollID string, outcome polls.OutcomeStatus) error
+	// CorrectOutcome changes the outcome of a settled poll and re-settles every bet on it.
+	CorrectOutcome(ctx context.Context, pollID string, newOutcome polls.OutcomeStatus, correctedBy string) (polls.OutcomeCorrection, error)
+	// VoidPoll cancels the poll and voids every bet on it. Voiding a poll that is
+	// already cancelled voids any bets that were missed.
+	VoidPoll(ctx context.Context, pollID string) error
+	// GetImpliedOdds returns the current odds of every option on the poll.
+	GetImpliedOdds(ctx context.Context, pollID string) ([]OptionOdds, error)
+	GetBetsFromUser(ctx context.Context, userID string) ([]Bet, error)
+	// GetBetsByPollId returns every bet on the poll.
+	GetBetsByPollId(ctx context.Context, pollID string) ([]Bet, error)
+	// GetLeaderboard ranks users by their settled bets.
+	GetLeaderboard(ctx context.Context, query LeaderboardQuery) (Leaderboard, error)
+	// GetBetHistory lists a user's bets along with the polls they were placed on.
+	GetBetHistory(ctx context.Context, query BetHistoryQuery) (BetHistory, error)
+	// GetBetCounts counts the bets on each of the given polls.
+	GetBetCounts(ctx context.Context, pollIDs []string) (map[string]int, error)
+	// WithTx returns the service with its changes made as part of the unit of work.
+	WithTx(tx *storage.Tx) BetService
 }
 
 type BetRepository interface {
-	Save(bet *bet) error
-	GetByPollIdAndUserId(pollID string, userID string) (*bet, error)
-	GetBetsFromUser(userID string) ([]*bet, error)
-	GetBetsByPollId(pollID string) ([]*bet, error)
-	UpdateBet(bet *bet) error
+	// WithTx returns the repository with its reads and writes made as part of
+	// the unit of work.
+	WithTx(tx *storage.Tx) BetRepository
+	Save(ctx context.Context, bet *bet) error
+	GetByPollIdAndUserId(ctx context.Context, pollID string, userID string) (*bet, error)
+	GetBetsFromUser(ctx context.Context, userID string) ([]*bet, error)
+	GetBetsByPollId(ctx context.Context, pollID string) ([]*bet, error)
+	UpdateBet(ctx context.Context, bet *bet) error
+	// SettleBetsByPollId marks every bet on the poll as Won or Lost at once.
+	SettleBetsByPollId(ctx context.Context, pollID string, winningOptionIndex int) error
+	VoidBetsByPollId(ctx context.Context, pollID string) error
+	// SaveBetChange moves the bet to its new option and records the change in a
+	// single transaction.
+	SaveBetChange(ctx context.Context, bet *bet, change BetChange) error
+	// SaveBetWithdrawal deletes the bet and records the change in a single transaction.
+	SaveBetWithdrawal(ctx context.Context, bet *bet, change BetChange) error
+	GetBetChanges(ctx context.Context, pollID string, userID string) ([]BetChange, error)
+	GetBetChangesByUser(ctx context.Context, userID string) ([]BetChange, error)
+	GetLeaderboard(ctx context.Context, query LeaderboardQuery) (Leaderboard, error)
+	GetBetHistory(ctx context.Context, query BetHistoryQuery) (BetHistory, error)
+	CountBetsByPollIDs(ctx context.Context, pollIDs []string) (map[string]int, error)
 }
 
 // Errors related to bets
 
+var ErrInvalidOptionIndex = errors.New("invalid option index")
+var ErrInvalidStake = errors.New("stake cannot be negative")
 var ErrBetNotFound = errors.New("bet not found")
 var ErrUserAlreadyBet = errors.New("user already bet")
 var ErrPollIsClosed = errors.New("poll is closed")
+var ErrPollIsCancelled = errors.New("poll is cancelled")
+var ErrPollIsOpen = errors.New("poll is still open")
+var ErrBetUnchanged = errors.New("bet is already on that option")
+var ErrInvalidBetHistoryQuery = errors.New("invalid bet history query")
+var ErrInvalidLeaderboardQuery = errors.New("invalid leaderboard query")
+var ErrOutcomeAlreadySelected = errors.New("poll outcome has already been selected")
+var ErrOutcomeNotSelected = errors.New("poll outcome has not been selected")
+var ErrInvalidOutcome = errors.New("invalid outcome")
@@ -1,13 +1,18 @@
 package bets
 
 import (
+	"context"
 	"database/sql"
 	"errors"
 	"fmt"
+	"strings"
+	"time"
+
+	"betting-discord-bot/internal/storage"
 )
 
 type libSQLRepository struct {
-	db *sql.DB
+	db storage.DBTX
 }
 
 func NewLibSQLRepository(db *sql.DB) BetRepository {
@@ -16,15 +21,21 @@ func NewLibSQLRepository(db *sql.DB) BetRepository {
 	}
 }
 
-func (repo libSQLRepository) Save(bet *bet) error {
-	query := `INSERT INTO bets (poll_id, user_id, selected_option_index, bet_status) VALUES (?, ?, ?, ?)`
+func (repo libSQLRepository) WithTx(tx *storage.Tx) BetRepository {
+	return &libSQLRepository{
+		db: tx.Conn(repo.db),
+	}
+}
 
-	preparedStatement, preparedErr := repo.db.Prepare(query)
+func (repo libSQLRepository) Save(ctx context.Context, bet *bet) error {
+	query := `INSERT INTO bets (poll_id, user_id, selected_option_index, bet_status, stake, payout, placed_at) VALUES (?, ?, ?, ?, ?, ?, ?)`
+
+	preparedStatement, preparedErr := repo.db.PrepareContext(ctx, query)
 	if preparedErr != nil {
 		return fmt.Errorf("error while preparing save bet statement: %w", preparedErr)
 	}
 
-	_, execErr := preparedStatement.Exec(bet.PollID, bet.UserID, bet.SelectedOptionIndex, bet.BetStatus)
+	_, execErr := preparedStatement.ExecContext(ctx, bet.PollID, bet.UserID, bet.SelectedOptionIndex, bet.BetStatus, bet.Stake, bet.Payout, unixMilliOrZero(bet.PlacedAt))
 	if execErr != nil {
 		return fmt.Errorf("error while executing save bet statement: %w", execErr)
 	}
@@ -32,16 +43,16 @@ func (repo libSQLRepository) Save(bet *bet) error {
 	return nil
 }
 
-func (repo libSQLRepository) GetByPollIdAndUserId(pollID string, userID string) (*bet, error) {
-	query := "SELECT poll_id, user_id, selected_option_index, bet_status FROM bets WHERE poll_id = ? AND user_id = ?"
-	preparedStatement, preparedErr := repo.db.Prepare(query)
+func (repo libSQLRepository) GetByPollIdAndUserId(ctx context.Context, pollID string, userID string) (*bet, error) {
+	query := "SELECT poll_id, user_id, selected_option_index, bet_status, stake, payout FROM bets WHERE poll_id = ? AND user_id = ?"
+	preparedStatement, preparedErr := repo.db.PrepareContext(ctx, query)
 	if preparedErr != nil {
 		return nil, fmt.Errorf("error while preparing get bet by poll_id and user_id statement: %w", preparedErr)
 	}
 
 	var bet bet
-	row := preparedStatement.QueryRow(pollID, userID)
-	if scanErr := row.Scan(&bet.PollID, &bet.UserID, &bet.SelectedOptionIndex, &bet.BetStatus); scanErr != nil {
+	row := preparedStatement.QueryRowContext(ctx, pollID, userID)
+	if scanErr := row.Scan(&bet.PollID, &bet.UserID, &bet.SelectedOptionIndex, &bet.BetStatus, &bet.Stake, &bet.Payout); scanErr != nil {
 		if errors.Is(scanErr, sql.ErrNoRows) {
 			return nil, ErrBetNotFound
 		}
@@ -51,14 +62,14 @@ func (repo libSQLRepository) GetByPollIdAndUserId(pollID string, userID string)
 	return &bet, nil
 }
 
-func (repo libSQLRepository) GetBetsFromUser(userID string) ([]*bet, error) {
-	query := "SELECT poll_id, user_id, selected_option_index, bet_status FROM bets WHERE user_id = ?"
-	preparedStatement, preparedErr := repo.db.Prepare(query)
+func (repo libSQLRepository) GetBetsFromUser(ctx context.Context, userID string) ([]*bet, error) {
+	query := "SELECT poll_id, user_id, selected_option_index, bet_status, stake, payout FROM bets WHERE user_id = ?"
+	preparedStatement, preparedErr := repo.db.PrepareContext(ctx, query)
 	if preparedErr != nil {
 		return nil, fmt.Errorf("error while preparing get bets from user statement: %w", preparedErr)
 	}
 
-	rows, queryErr := preparedStatement.Query(userID)
+	rows, queryErr := preparedStatement.QueryContext(ctx, userID)
 	if queryErr != nil {
 		return nil, fmt.Errorf("error while querying bets from user: %w", queryErr)
 	}
@@ -73,7 +84,7 @@ func (repo libSQLRepository) GetBetsFromUser(userID string) ([]*bet, error) {
 	var bets []*bet
 	for rows.Next() {
 		var bet bet
-		if scanErr := rows.Scan(&bet.PollID, &bet.UserID, &bet.SelectedOptionIndex, &bet.BetStatus); scanErr != nil {
+		if scanErr := rows.Scan(&bet.PollID, &bet.UserID, &bet.SelectedOptionIndex, &bet.BetStatus, &bet.Stake, &bet.Payout); scanErr != nil {
 			return nil, fmt.Errorf("error while scanning bet: %w", scanErr)
 		}
 		bets = append(bets, &bet)
@@ -86,22 +97,22 @@ func (repo libSQLRepository) GetBetsFromUser(userID string) ([]*bet, error) {
 	return bets, nil
 }
 
-func (repo libSQLRepository) GetBetsByPollId(pollID string) ([]*bet, error) {
-	query := "SELECT poll_id, user_id, selected_option_index, bet_status FROM bets WHERE poll_id = ?"
-	preparedStatement, preparedErr := repo.db.Prepare(query)
+func (repo libSQLRepository) GetBetsByPollId(ctx context.Context, pollID string) ([]*bet, error) {
+	query := "SELECT poll_id, user_id, selected_option_index, bet_status, stake, payout FROM bets WHERE poll_id = ?"
+	preparedStatement, preparedErr := repo.db.PrepareContext(ctx, query)
 	if preparedErr != nil {
-		return nil, fmt.Errorf("error while preparing get bets by poll_id")
+		return nil, fmt.Errorf("error while preparing get bets by poll_id statement: %w", preparedErr)
 	}
 
-	rows, queryErr := preparedStatement.Query(pollID)
+	rows, queryErr := preparedStatement.QueryContext(ctx, pollID)
 	if queryErr != nil {
-		return nil, fmt.Errorf("error while querying bets by poll_id")
+		return nil, fmt.Errorf("error while querying bets by poll_id: %w", queryErr)
 	}
 
 	var bets []*bet
 	for rows.Next() {
 		var bet bet
-		if scanErr := rows.Scan(&bet.PollID, &bet.UserID, &bet.SelectedOptionIndex, &bet.BetStatus); scanErr != nil {
+		if scanErr := rows.Scan(&bet.PollID, &bet.UserID, &bet.SelectedOptionIndex, &bet.BetStatus, &bet.Stake, &bet.Payout); scanErr != nil {
 			return nil, fmt.Errorf("error while scanning bet: %w", scanErr)
 		}
 
@@ -114,14 +125,14 @@ func (repo libSQLRepository) GetBetsByPollId(pollID string) ([]*bet, error) {
 	return bets, nil
 }
 
-func (repo libSQLRepository) UpdateBet(bet *bet) error {
-	query := "UPDATE bets SET selected_option_index = ?, bet_status = ? WHERE poll_id = ? AND user_id = ?"
-	preparedStatement, preparedErr := repo.db.Prepare(query)
+func (repo libSQLRepository) UpdateBet(ctx context.Context, bet *bet) error {
+	query := "UPDATE bets SET selected_option_index = ?, bet_status = ?, stake = ?, payout = ? WHERE poll_id = ? AND user_id = ?"
+	preparedStatement, preparedErr := repo.db.PrepareContext(ctx, query)
 	if preparedErr != nil {
 		return fmt.Errorf("error while preparing update bet statement: %w", preparedErr)
 	}
 
-	result, execErr := preparedStatement.Exec(bet.SelectedOptionIndex, bet.BetStatus, bet.PollID, bet.UserID)
+	result, execErr := preparedStatement.ExecContext(ctx, bet.SelectedOptionIndex, bet.BetStatus, bet.Stake, bet.Payout, bet.PollID, bet.UserID)
 	if execErr != nil {
 		return fmt.Errorf("error while executing update bet statement: %w", execErr)
 	}
@@ -136,3 +147,283 @@ func (repo libSQLRepository) UpdateBet(bet *bet) error {
 
 	return nil
 }
+
+func (repo libSQLRepository) SettleBetsByPollId(ctx context.Context, pollID string, winningOptionIndex int) error {
+	query := `UPDATE bets
+              SET bet_status = CASE WHEN selected_option_index = ? THEN ? ELSE ? END
+              WHERE poll_id = ?`
+	if _, execErr := repo.db.ExecContext(ctx, query, winningOptionIndex, Won, Lost, pollID); execErr != nil {
+		return fmt.Errorf("error while executing settle bets statement: %w", execErr)
+	}
+
+	return nil
+}
+
+func (repo libSQLRepository) VoidBetsByPollId(ctx context.Context, pollID string) error {
+	query := "UPDATE bets SET bet_status = ? WHERE poll_id = ?"
+	if _, execErr := repo.db.ExecContext(ctx, query, Void, pollID); execErr != nil {
+		return fmt.Errorf("error while executing void bets statement: %w", execErr)
+	}
+
+	return nil
+}
+
+func (repo libSQLRepository) SaveBetChange(ctx context.Context, bet *bet, change BetChange) error {
+	return storage.InTransaction(ctx, repo.db, func(transaction storage.DBTX) error {
+		query := "UPDATE bets SET selected_option_index = ? WHERE poll_id = ? AND user_id = ?"
+		result, execErr := transaction.ExecContext(ctx, query, bet.SelectedOptionIndex, bet.PollID, bet.UserID)
+		if execErr != nil {
+			return fmt.Errorf("error while updating bet option: %w", execErr)
+		}
+		if rowsAffected, _ := result.RowsAffected(); rowsAffected == 0 {
+			return ErrBetNotFound
+		}
+
+		if err := insertBetChange(ctx, transaction, change); err != nil {
+			return err
+		}
+
+		return nil
+	})
+}
+
+func (repo libSQLRepository) SaveBetWithdrawal(ctx context.Context, bet *bet, change BetChange) error {
+	return storage.InTransaction(ctx, repo.db, func(transaction storage.DBTX) error {
+		result, execErr := transaction.ExecContext(ctx, "DELETE FROM bets WHERE poll_id = ? AND user_id = ?", bet.PollID, bet.UserID)
+		if execErr != nil {
+			return fmt.Errorf("error while deleting bet: %w", execErr)
+		}
+		if rowsAffected, _ := result.RowsAffected(); rowsAffected == 0 {
+			return ErrBetNotFound
+		}
+
+		if err := insertBetChange(ctx, transaction, change); err != nil {
+			return err
+		}
+
+		return nil
+	})
+}
+
+func insertBetChange(ctx context.Context, transaction storage.DBTX, change BetChange) error {
+	query := `INSERT INTO bet_changes (poll_id, user_id, kind, previous_option_index, new_option_index, changed_at)
+              VALUES (?, ?, ?, ?, ?, ?)`
+	if _, execErr := transaction.ExecContext(ctx, query, change.PollID, change.UserID, change.Kind, change.PreviousOptionIndex, change.NewOptionIndex, change.ChangedAt.UnixMilli()); execErr != nil {
+		return fmt.Errorf("error while inserting bet change: %w", execErr)
+	}
+	return nil
+}
+
+func (repo libSQLRepository) GetBetChanges(ctx context.Context, pollID string, userID string) ([]BetChange, error) {
+	query := `SELECT poll_id, user_id, kind, previous_option_index, new_option_index, changed_at
+              FROM bet_changes WHERE poll_id = ? AND user_id = ? ORDER BY id`
+	rows, err := repo.db.QueryContext(ctx, query, pollID, userID)
+	if err != nil {
+		return nil, fmt.Errorf("error while executing query: %w", err)
+	}
+	return scanBetChanges(rows)
+}
+
+func (repo libSQLRepository) GetBetChangesByUser(ctx context.Context, userID string) ([]BetChange, error) {
+	query := `SELECT poll_id, user_id, kind, previous_option_index, new_option_index, changed_at
+              FROM bet_changes WHERE user_id = ? ORDER BY id`
+	rows, err := repo.db.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, fmt.Errorf("error while executing query: %w", err)
+	}
+	return scanBetChanges(rows)
+}
+
+func scanBetChanges(rows *sql.Rows) ([]BetChange, error) {
+	defer rows.Close()
+
+	var changes []BetChange
+	for rows.Next() {
+		var change BetChange
+		var changedAt int64
+		if err := rows.Scan(&change.PollID, &change.UserID, &change.Kind, &change.PreviousOptionIndex, &change.NewOptionIndex, &changedAt); err != nil {
+			return nil, fmt.Errorf("error while scanning row: %w", err)
+		}
+		change.ChangedAt = time.UnixMilli(changedAt)
+		changes = append(changes, change)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error during row iteration: %w", err)
+	}
+
+	return changes, nil
+}
+
+// leaderboardOrderings are the window orderings for each leaderboard order.
+// They are fixed fragments so that no caller input is spliced into the query.
+var leaderboardOrderings = map[LeaderboardOrder]string{
+	ByWins:    "wins DESC",
+	ByWinRate: "CAST(wins AS REAL) / (wins + losses) DESC",
+	ByPoints:  "points DESC",
+}
+
+func (repo libSQLRepository) GetLeaderboard(ctx context.Context, query LeaderboardQuery) (Leaderboard, error) {
+	ordering, exists := leaderboardOrderings[query.OrderBy]
+	if !exists {
+		return Leaderboard{}, ErrInvalidLeaderboardQuery
+	}
+
+	statement := `WITH standings AS (
+                      SELECT user_id,
+                             SUM(CASE WHEN bet_status = ? THEN 1 ELSE 0 END) AS wins,
+                             SUM(CASE WHEN bet_status = ? THEN 1 ELSE 0 END) AS losses,
+                             SUM(payout - stake) AS points
+                      FROM bets b
+                      LEFT JOIN polls p ON p.id = b.poll_id
+                      WHERE bet_status IN (?, ?) AND (? = '' OR p.guild_id = ?)
+                      GROUP BY user_id
+                      HAVING COUNT(*) >= ?
+                  ),
+                  ranked AS (
+                      SELECT RANK() OVER (ORDER BY ` + ordering + `) AS rank,
+                             user_id, wins, losses, points,
+                             COUNT(*) OVER () AS total
+                      FROM standings
+                  )
+                  SELECT rank, user_id, wins, losses, points, total
+                  FROM ranked
+                  WHERE ? = '' OR user_id = ?
+                  ORDER BY rank, user_id
+                  LIMIT ? OFFSET ?`
+	rows, err := repo.db.QueryContext(ctx, statement, Won, Lost, Won, Lost, query.GuildID, query.GuildID, query.MinBets, query.UserID, query.UserID, query.Limit, query.Offset)
+	if err != nil {
+		return Leaderboard{}, fmt.Errorf("error while executing query: %w", err)
+	}
+	defer rows.Close()
+
+	var leaderboard Leaderboard
+	for rows.Next() {
+		var entry LeaderboardEntry
+		if err := rows.Scan(&entry.Rank, &entry.UserID, &entry.Wins, &entry.Losses, &entry.Points, &leaderboard.Total); err != nil {
+			return Leaderboard{}, fmt.Errorf("error while scanning row: %w", err)
+		}
+		leaderboard.Entries = append(leaderboard.Entries, entry)
+	}
+
+	if err := rows.Err(); err != nil {
+		return Leaderboard{}, fmt.Errorf("error during row iteration: %w", err)
+	}
+
+	// A page past the end, or an unranked user, has no rows to carry the total.
+	if len(leaderboard.Entries) == 0 {
+		countQuery := `SELECT COUNT(*) FROM (
+                           SELECT user_id FROM bets b
+                           LEFT JOIN polls p ON p.id = b.poll_id
+                           WHERE bet_status IN (?, ?) AND (? = '' OR p.guild_id = ?)
+                           GROUP BY user_id HAVING COUNT(*) >= ?
+                       )`
+		if err := repo.db.QueryRowContext(ctx, countQuery, Won, Lost, query.GuildID, query.GuildID, query.MinBets).Scan(&leaderboard.Total); err != nil {
+			return Leaderboard{}, fmt.Errorf("error while counting leaderboard: %w", err)
+		}
+	}
+
+	return leaderboard, nil
+}
+
+// betHistoryFilters are the bet statuses each bet history filter matches.
+var betHistoryFilters = map[BetHistoryFilter]string{
+	AllBets:     "",
+	OpenBets:    fmt.Sprintf("AND b.bet_status = %d", Pending),
+	SettledBets: fmt.Sprintf("AND b.bet_status IN (%d, %d, %d)", Won, Lost, Void),
+}
+
+func (repo libSQLRepository) GetBetHistory(ctx context.Context, query BetHistoryQuery) (BetHistory, error) {
+	filter, exists := betHistoryFilters[query.Filter]
+	if !exists {
+		return BetHistory{}, ErrInvalidBetHistoryQuery
+	}
+
+	// The poll and the picked option are joined in so that listing a page
+	// of bets takes a single query.
+	statement := `SELECT b.poll_id, COALESCE(p.title, ''), COALESCE(p.category, ''), b.selected_option_index, COALESCE(o.option_text, ''),
+                         b.bet_status, b.stake, b.payout, b.placed_at,
+                         COUNT(*) OVER () AS total
+                  FROM bets b
+                  LEFT JOIN polls p ON p.id = b.poll_id
+                  LEFT JOIN poll_options o ON o.poll_id = b.poll_id AND o.option_index = b.selected_option_index
+                  WHERE b.user_id = ? AND (? = '' OR p.guild_id = ?) ` + filter + `
+                  ORDER BY b.placed_at DESC, b.poll_id
+                  LIMIT ? OFFSET ?`
+	rows, err := repo.db.QueryContext(ctx, statement, query.UserID, query.GuildID, query.GuildID, query.Limit, query.Offset)
+	if err != nil {
+		return BetHistory{}, fmt.Errorf("error while executing query: %w", err)
+	}
+	defer rows.Close()
+
+	var history BetHistory
+	for rows.Next() {
+		var entry BetHistoryEntry
+		var placedAt int64
+		if err := rows.Scan(&entry.PollID, &entry.PollTitle, &entry.PollCategory, &entry.OptionIndex, &entry.Option, &entry.BetStatus, &entry.Stake, &entry.Payout, &placedAt, &history.Total); err != nil {
+			return BetHistory{}, fmt.Errorf("error while scanning row: %w", err)
+		}
+		if placedAt != 0 {
+			entry.PlacedAt = time.UnixMilli(placedAt)
+		}
+		history.Entries = append(history.Entries, entry)
+	}
+
+	if err := rows.Err(); err != nil {
+		return BetHistory{}, fmt.Errorf("error during row iteration: %w", err)
+	}
+
+	// A page past the end has no rows to carry the total.
+	if len(history.Entries) == 0 && query.Offset > 0 {
+		countQuery := `SELECT COUNT(*) FROM bets b
+                       LEFT JOIN polls p ON p.id = b.poll_id
+                       WHERE b.user_id = ? AND (? = '' OR p.guild_id = ?) ` + filter
+		if err := repo.db.QueryRowContext(ctx, countQuery, query.UserID, query.GuildID, query.GuildID).Scan(&history.Total); err != nil {
+			return BetHistory{}, fmt.Errorf("error while counting bet history: %w", err)
+		}
+	}
+
+	return history, nil
+}
+
+func (repo libSQLRepository) CountBetsByPollIDs(ctx context.Context, pollIDs []string) (map[string]int, error) {
+	counts := make(map[string]int)
+	if len(pollIDs) == 0 {
+		return counts, nil
+	}
+
+	args := make([]any, len(pollIDs))
+	for index, pollID := range pollIDs {
+		args[index] = pollID
+	}
+	placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(pollIDs)), ", ")
+
+	query := "SELECT poll_id, COUNT(*) FROM bets WHERE poll_id IN (" + placeholders + ") GROUP BY poll_id"
+	rows, err := repo.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("error while executing query: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var pollID string
+		var count int
+		if err := rows.Scan(&pollID, &count); err != nil {
+			return nil, fmt.Errorf("error while scanning row: %w", err)
+		}
+		counts[pollID] = count
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error during row iteration: %w", err)
+	}
+
+	return counts, nil
+}
+
+func unixMilliOrZero(t time.Time) int64 {
+	if t.IsZero() {
+		return 0
+	}
+	return t.UnixMilli()
+}
@@ -1,18 +1,113 @@
 package bets
 
-import "errors"
+import (
+	"context"
+	"errors"
+	"maps"
+	"slices"
+	"sort"
+
+	"betting-discord-bot/internal/polls"
+	"betting-discord-bot/internal/storage"
+)
 
 type memoryRepository struct {
-	betList map[BetKey]*bet
+	betList    map[BetKey]*bet
+	betChanges map[BetKey][]BetChange
+	// pollRepo stands in for the polls table when bets are listed with their
+	// polls or scoped to a guild. It is nil unless the repository was built
+	// with one.
+	pollRepo polls.PollRepository
+}
+
+// DeleteNotifier is a memory repository of polls or users. Memory
+// repositories have no foreign keys, so they call the functions registered
+// with OnDelete with the ID of every poll or user deleted from them instead.
+type DeleteNotifier interface {
+	OnDelete(fn func(id string))
 }
 
 func NewMemoryRepository() BetRepository {
-	return &memoryRepository{
-		betList: make(map[BetKey]*bet),
+	return NewMemoryRepositoryWithParents(nil, nil)
+}
+
+// NewMemoryRepositoryWithPolls returns a repository that reads poll titles,
+// options and guilds from pollRepo when listing a user's bet history or the
+// leaderboard. Bets on polls deleted from pollRepo are deleted with them.
+func NewMemoryRepositoryWithPolls(pollRepo polls.PollRepository) BetRepository {
+	return NewMemoryRepositoryWithParents(pollRepo, nil)
+}
+
+// NewMemoryRepositoryWithParents returns a repository like
+// NewMemoryRepositoryWithPolls that also deletes the bets of users deleted
+// from userRepo, as the foreign keys of the bets table do.
+func NewMemoryRepositoryWithParents(pollRepo polls.PollRepository, userRepo DeleteNotifier) BetRepository {
+	repo := &memoryRepository{
+		betList:    make(map[BetKey]*bet),
+		betChanges: make(map[BetKey][]BetChange),
+		pollRepo:   pollRepo,
+	}
+	if notifier, ok := pollRepo.(DeleteNotifier); ok {
+		notifier.OnDelete(func(pollID string) {
+			repo.deleteWhere(func(key BetKey) bool { return key.PollID == pollID })
+		})
+	}
+	if userRepo != nil {
+		userRepo.OnDelete(func(userID string) {
+			repo.deleteWhere(func(key BetKey) bool { return key.UserID == userID })
+		})
 	}
+	return repo
 }
 
-func (repo memoryRepository) Save(bet *bet) error {
+// deleteWhere deletes the bets and bet changes whose key matches, as
+// deleting their poll or user cascades in SQL.
+func (repo memoryRepository) deleteWhere(matches func(key BetKey) bool) {
+	for key := range repo.betList {
+		if matches(key) {
+			delete(repo.betList, key)
+		}
+	}
+	for key := range repo.betChanges {
+		if matches(key) {
+			delete(repo.betChanges, key)
+		}
+	}
+}
+
+// WithTx snapshots the bets, so that they are put back if the unit of work is
+// rolled back. Bets are changed in place, so the snapshot copies each one.
+func (repo memoryRepository) WithTx(tx *storage.Tx) BetRepository {
+	betList := make(map[BetKey]*bet, len(repo.betList))
+	for key, stored := range repo.betList {
+		snapshot := *stored
+		betList[key] = &snapshot
+	}
+	betChanges := make(map[BetKey][]BetChange, len(repo.betChanges))
+	for key, changes := range repo.betChanges {
+		betChanges[key] = slices.Clone(changes)
+	}
+
+	tx.OnRollback(func() {
+		for key, snapshot := range betList {
+			if stored, exists := repo.betList[key]; exists {
+				*stored = *snapshot
+				betList[key] = stored
+			}
+		}
+		clear(repo.betList)
+		maps.Copy(repo.betList, betList)
+		clear(repo.betChanges)
+		maps.Copy(repo.betChanges, betChanges)
+	})
+	return repo
+}
+
+func (repo memoryRepository) Save(ctx context.Context, bet *bet) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
 	key := BetKey{bet.PollID, bet.UserID}
 	if _, exists := repo.betList[key]; exists {
 		return errors.New("user already placed a bet on this poll")
@@ -22,15 +117,23 @@ func (repo memoryRepository) Save(bet *bet) error {
 	return nil
 }
 
-func (repo memoryRepository) GetByPollIdAndUserId(pollID string, userID string) (*bet, error) {
+func (repo memoryRepository) GetByPollIdAndUserId(ctx context.Context, pollID string, userID string) (*bet, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
 	key := BetKey{PollID: pollID, UserID: userID}
 	if bet, exists := repo.betList[key]; exists {
 		return bet, nil
 	}
-	return nil, errors.New("bet not found for the given poll and user")
+	return nil, ErrBetNotFound
 }
 
-func (repo memoryRepository) GetBetsFromUser(userID string) ([]*bet, error) {
+func (repo memoryRepository) GetBetsFromUser(ctx context.Context, userID string) ([]*bet, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
 	var bets []*bet
 	for key, bet := range repo.betList {
 		if key.UserID == userID {
@@ -40,7 +143,11 @@ func (repo memoryRepository) GetBetsFromUser(userID string) ([]*bet, error) {
 	return bets, nil
 }
 
-func (repo memoryRepository) GetBetsByPollId(pollID string) ([]*bet, error) {
+func (repo memoryRepository) GetBetsByPollId(ctx context.Context, pollID string) ([]*bet, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
 	var bets []*bet
 	for key, bet := range repo.betList {
 		if key.PollID == pollID {
@@ -50,7 +157,11 @@ func (repo memoryRepository) GetBetsByPollId(pollID string) ([]*bet, error) {
 	return bets, nil
 }
 
-func (repo memoryRepository) UpdateBet(bet *bet) error {
+func (repo memoryRepository) UpdateBet(ctx context.Context, bet *bet) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
 	key := BetKey{bet.PollID, bet.UserID}
 	if _, exists := repo.betList[key]; !exists {
 		return errors.New("bet not found for the given poll and user")
@@ -60,4 +171,258 @@ func (repo memoryRepository) UpdateBet(bet *bet) error {
 	return nil
 }
 
+func (repo memoryRepository) SettleBetsByPollId(ctx context.Context, pollID string, winningOptionIndex int) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	for key, bet := range repo.betList {
+		if key.PollID != pollID {
+			continue
+		}
+
+		if bet.SelectedOptionIndex == winningOptionIndex {
+			bet.BetStatus = Won
+		} else {
+			bet.BetStatus = Lost
+		}
+	}
+	return nil
+}
+
+func (repo memoryRepository) VoidBetsByPollId(ctx context.Context, pollID string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	for key, bet := range repo.betList {
+		if key.PollID == pollID {
+			bet.BetStatus = Void
+		}
+	}
+	return nil
+}
+
+func (repo memoryRepository) SaveBetChange(ctx context.Context, bet *bet, change BetChange) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	key := BetKey{bet.PollID, bet.UserID}
+	stored, exists := repo.betList[key]
+	if !exists {
+		return ErrBetNotFound
+	}
+
+	stored.SelectedOptionIndex = bet.SelectedOptionIndex
+	repo.betChanges[key] = append(repo.betChanges[key], change)
+	return nil
+}
+
+func (repo memoryRepository) SaveBetWithdrawal(ctx context.Context, bet *bet, change BetChange) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	key := BetKey{bet.PollID, bet.UserID}
+	if _, exists := repo.betList[key]; !exists {
+		return ErrBetNotFound
+	}
+
+	delete(repo.betList, key)
+	repo.betChanges[key] = append(repo.betChanges[key], change)
+	return nil
+}
+
+func (repo memoryRepository) GetBetChanges(ctx context.Context, pollID string, userID string) ([]BetChange, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	changes := repo.betChanges[BetKey{PollID: pollID, UserID: userID}]
+	return append([]BetChange(nil), changes...), nil
+}
+
+func (repo memoryRepository) GetBetChangesByUser(ctx context.Context, userID string) ([]BetChange, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	var changes []BetChange
+	for key, betChanges := range repo.betChanges {
+		if key.UserID == userID {
+			changes = append(changes, betChanges...)
+		}
+	}
+	// Changes to the same bet are kept in the order they were made.
+	sort.SliceStable(changes, func(i, j int) bool {
+		return changes[i].ChangedAt.Before(changes[j].ChangedAt)
+	})
+	return changes, nil
+}
+
+func (repo memoryRepository) GetLeaderboard(ctx context.Context, query LeaderboardQuery) (Leaderboard, error) {
+	if err := ctx.Err(); err != nil {
+		return Leaderboard{}, err
+	}
+
+	standings := make(map[string]*LeaderboardEntry)
+	for key, bet := range repo.betList {
+		if bet.BetStatus != Won && bet.BetStatus != Lost || !repo.inGuild(ctx, bet.PollID, query.GuildID) {
+			continue
+		}
+
+		entry, exists := standings[key.UserID]
+		if !exists {
+			entry = &LeaderboardEntry{UserID: key.UserID}
+			standings[key.UserID] = entry
+		}
+		if bet.BetStatus == Won {
+			entry.Wins++
+		} else {
+			entry.Losses++
+		}
+		entry.Points += bet.Payout - bet.Stake
+	}
+
+	var entries []LeaderboardEntry
+	for _, entry := range standings {
+		if entry.Wins+entry.Losses >= query.MinBets {
+			entries = append(entries, *entry)
+		}
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		if order := compareStandings(entries[i], entries[j], query.OrderBy); order != 0 {
+			return order > 0
+		}
+		return entries[i].UserID < entries[j].UserID
+	})
+
+	for index := range entries {
+		if index > 0 && compareStandings(entries[index-1], entries[index], query.OrderBy) == 0 {
+			entries[index].Rank = entries[index-1].Rank
+		} else {
+			entries[index].Rank = index + 1
+		}
+	}
+
+	leaderboard := Leaderboard{Total: len(entries)}
+	if query.UserID != "" {
+		var userEntries []LeaderboardEntry
+		for _, entry := range entries {
+			if entry.UserID == query.UserID {
+				userEntries = append(userEntries, entry)
+			}
+		}
+		entries = userEntries
+	}
+	if query.Offset < len(entries) {
+		end := min(query.Offset+query.Limit, len(entries))
+		leaderboard.Entries = entries[query.Offset:end]
+	}
+
+	return leaderboard, nil
+}
+
+func (repo memoryRepository) GetBetHistory(ctx context.Context, query BetHistoryQuery) (BetHistory, error) {
+	if err := ctx.Err(); err != nil {
+		return BetHistory{}, err
+	}
+
+	var entries []BetHistoryEntry
+	for key, bet := range repo.betList {
+		if key.UserID != query.UserID || !matchesHistoryFilter(bet.BetStatus, query.Filter) || !repo.inGuild(ctx, bet.PollID, query.GuildID) {
+			continue
+		}
+
+		entry := BetHistoryEntry{
+			PollID:      bet.PollID,
+			OptionIndex: bet.SelectedOptionIndex,
+			BetStatus:   bet.BetStatus,
+			Stake:       bet.Stake,
+			Payout:      bet.Payout,
+			PlacedAt:    bet.PlacedAt,
+		}
+		if repo.pollRepo != nil {
+			if poll, err := repo.pollRepo.GetById(ctx, bet.PollID); err == nil {
+				entry.PollTitle = poll.GetTitle()
+				entry.PollCategory = poll.GetCategory()
+				if options := poll.GetOptions(); bet.SelectedOptionIndex < len(options) {
+					entry.Option = options[bet.SelectedOptionIndex]
+				}
+			}
+		}
+		entries = append(entries, entry)
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		if !entries[i].PlacedAt.Equal(entries[j].PlacedAt) {
+			return entries[i].PlacedAt.After(entries[j].PlacedAt)
+		}
+		return entries[i].PollID < entries[j].PollID
+	})
+
+	history := BetHistory{Total: len(entries)}
+	if query.Offset < len(entries) {
+		end := min(query.Offset+query.Limit, len(entries))
+		history.Entries = entries[query.Offset:end]
+	}
+
+	return history, nil
+}
+
+// inGuild reports whether the poll belongs to the guild. Every poll matches an
+// empty guild, and no poll matches any other guild without a poll repository,
+// just as bets without a poll drop out of the guild join in SQL.
+func (repo memoryRepository) inGuild(ctx context.Context, pollID string, guildID string) bool {
+	if guildID == "" {
+		return true
+	}
+	if repo.pollRepo == nil {
+		return false
+	}
+	poll, err := repo.pollRepo.GetById(ctx, pollID)
+	return err == nil && poll.GetGuildID() == guildID
+}
+
+func matchesHistoryFilter(status BetStatus, filter BetHistoryFilter) bool {
+	switch filter {
+	case OpenBets:
+		return status == Pending
+	case SettledBets:
+		return status != Pending
+	default:
+		return true
+	}
+}
+
+func (repo memoryRepository) CountBetsByPollIDs(ctx context.Context, pollIDs []string) (map[string]int, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	counts := make(map[string]int)
+	for key := range repo.betList {
+		if slices.Contains(pollIDs, key.PollID) {
+			counts[key.PollID]++
+		}
+	}
+	return counts, nil
+}
+
+// compareStandings returns a positive number when a ranks above b, a negative
+// number when it ranks below, and zero for a tie.
+func compareStandings(a LeaderboardEntry, b LeaderboardEntry, orderBy LeaderboardOrder) int64 {
+	switch orderBy {
+	case ByWinRate:
+		// Cross-multiplied to compare the ratios without rounding.
+		return int64(a.Wins)*int64(b.Wins+b.Losses) - int64(b.Wins)*int64(a.Wins+a.Losses)
+	case ByPoints:
+		return a.Points - b.Points
+	default:
+		return int64(a.Wins - b.Wins)
+	}
+}
+
 var _ BetRepository = (*memoryRepository)(nil)
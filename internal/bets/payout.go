@@ -0,0 +1,164 @@
+package bets
+
+import (
+	"math/bits"
+	"sort"
+)
+
+// maxHouseCut is a house cut of 100%, in basis points.
+const maxHouseCut = 10_000
+
+// Wager is the part of a bet the payout calculator needs.
+type Wager struct {
+	UserID      string
+	OptionIndex int
+	Stake       int64
+}
+
+// Settlement is how a poll's pool is paid out.
+type Settlement struct {
+	// Payouts holds the total owed to each user, stake included.
+	Payouts map[string]int64
+	// Pool is the sum of every stake on the poll.
+	Pool int64
+	// HouseCut is the part of the pool kept by the house.
+	HouseCut int64
+}
+
+// OptionOdds are the live decimal odds of a poll option: what one point staked
+// on it would return if betting closed now and the option won.
+type OptionOdds struct {
+	OptionIndex int
+	Staked      int64
+	// Odds is zero while nothing is staked on the option.
+	Odds float64
+}
+
+// PayoutCalculator splits a poll's pool parimutuel-style: the pool, minus the
+// house cut, is shared among the winners in proportion to their stakes.
+type PayoutCalculator struct {
+	// HouseCut is the share of the pool kept by the house, in basis points
+	// (1/100th of a percent).
+	HouseCut int64
+}
+
+// Settle pays out the pool to the wagers on the winning option. Points lost to
+// integer division go one each to the winners with the largest remainders, so
+// the whole pool after the house cut is paid out and the same wagers always
+// settle the same way. If nobody backed the winning option every stake is
+// refunded and the house takes nothing.
+func (calculator PayoutCalculator) Settle(wagers []Wager, winningOption int) Settlement {
+	pool := totalStake(wagers)
+
+	var winners []Wager
+	var winningStake int64
+	for _, wager := range wagers {
+		if wager.OptionIndex == winningOption && wager.Stake > 0 {
+			winners = append(winners, wager)
+			winningStake += wager.Stake
+		}
+	}
+
+	if winningStake == 0 {
+		return calculator.Refund(wagers)
+	}
+
+	houseCut := calculator.houseCutOf(pool)
+	settlement := Settlement{
+		Payouts:  make(map[string]int64, len(wagers)),
+		Pool:     pool,
+		HouseCut: houseCut,
+	}
+	for _, wager := range wagers {
+		settlement.Payouts[wager.UserID] = 0
+	}
+
+	distributable := pool - houseCut
+	remainders := make([]uint64, len(winners))
+	var paid int64
+	for index, winner := range winners {
+		share, remainder := mulDiv(distributable, winner.Stake, winningStake)
+		settlement.Payouts[winner.UserID] += share
+		remainders[index] = remainder
+		paid += share
+	}
+
+	order := make([]int, len(winners))
+	for index := range order {
+		order[index] = index
+	}
+	sort.SliceStable(order, func(a, b int) bool {
+		left, right := order[a], order[b]
+		if remainders[left] != remainders[right] {
+			return remainders[left] > remainders[right]
+		}
+		return winners[left].UserID < winners[right].UserID
+	})
+
+	// Each winner's remainder is below winningStake, so fewer points are left
+	// over than there are winners.
+	for _, index := range order[:distributable-paid] {
+		settlement.Payouts[winners[index].UserID]++
+	}
+
+	return settlement
+}
+
+// Refund gives every wager its stake back, as when a poll is voided.
+func (calculator PayoutCalculator) Refund(wagers []Wager) Settlement {
+	settlement := Settlement{
+		Payouts: make(map[string]int64, len(wagers)),
+		Pool:    totalStake(wagers),
+	}
+	for _, wager := range wagers {
+		settlement.Payouts[wager.UserID] += wager.Stake
+	}
+	return settlement
+}
+
+// ImpliedOdds returns the odds of every option given the wagers placed so far.
+func (calculator PayoutCalculator) ImpliedOdds(wagers []Wager, optionCount int) []OptionOdds {
+	odds := make([]OptionOdds, optionCount)
+	for index := range odds {
+		odds[index].OptionIndex = index
+	}
+
+	for _, wager := range wagers {
+		if wager.OptionIndex >= 0 && wager.OptionIndex < optionCount {
+			odds[wager.OptionIndex].Staked += wager.Stake
+		}
+	}
+
+	pool := totalStake(wagers)
+	distributable := pool - calculator.houseCutOf(pool)
+	for index := range odds {
+		if odds[index].Staked > 0 {
+			odds[index].Odds = float64(distributable) / float64(odds[index].Staked)
+		}
+	}
+
+	return odds
+}
+
+// houseCutOf rounds the house cut down, in the players' favour.
+func (calculator PayoutCalculator) houseCutOf(pool int64) int64 {
+	houseCut := min(max(calculator.HouseCut, 0), maxHouseCut)
+	cut, _ := mulDiv(pool, houseCut, maxHouseCut)
+	return cut
+}
+
+// mulDiv returns a*b/c rounded down and the remainder, without overflowing
+// when a*b does not fit in 64 bits. It expects b <= c so the result fits.
+func mulDiv(a, b, c int64) (int64, uint64) {
+	hi, lo := bits.Mul64(uint64(a), uint64(b))
+	quotient, remainder := bits.Div64(hi, lo, uint64(c))
+	return int64(quotient), remainder
+}
+
+func totalStake(wagers []Wager) int64 {
+	var total int64
+	for _, wager := range wagers {
+		total += wager.Stake
+	}
+	return total
+}
@@ -0,0 +1,201 @@
+package bets
+
+import (
+	"maps"
+	"testing"
+)
+
+func TestPayoutCalculatorSettle(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name            string
+		houseCut        int64
+		wagers          []Wager
+		winningOption   int
+		expectedPayouts map[string]int64
+		expectedCut     int64
+	}{
+		{
+			name:     "it should split the pool among winners pro-rata",
+			houseCut: 0,
+			wagers: []Wager{
+				{UserID: "a", OptionIndex: 0, Stake: 30},
+				{UserID: "b", OptionIndex: 0, Stake: 10},
+				{UserID: "c", OptionIndex: 1, Stake: 60},
+			},
+			winningOption:   0,
+			expectedPayouts: map[string]int64{"a": 75, "b": 25, "c": 0},
+		},
+		{
+			name:     "it should take the house cut before paying winners",
+			houseCut: 500,
+			wagers: []Wager{
+				{UserID: "a", OptionIndex: 1, Stake: 100},
+				{UserID: "b", OptionIndex: 0, Stake: 100},
+			},
+			winningOption:   1,
+			expectedPayouts: map[string]int64{"a": 190, "b": 0},
+			expectedCut:     10,
+		},
+		{
+			name:     "it should round the house cut down",
+			houseCut: 250,
+			wagers: []Wager{
+				{UserID: "a", OptionIndex: 0, Stake: 30},
+				{UserID: "b", OptionIndex: 1, Stake: 9},
+			},
+			winningOption:   0,
+			expectedPayouts: map[string]int64{"a": 39, "b": 0},
+			expectedCut:     0,
+		},
+		{
+			name:     "it should give leftover points to the largest remainders",
+			houseCut: 0,
+			wagers: []Wager{
+				{UserID: "a", OptionIndex: 0, Stake: 1},
+				{UserID: "b", OptionIndex: 0, Stake: 2},
+				{UserID: "c", OptionIndex: 1, Stake: 2},
+			},
+			winningOption: 0,
+			// a is owed 5/3 and b is owed 10/3, so a gets the leftover point.
+			expectedPayouts: map[string]int64{"a": 2, "b": 3, "c": 0},
+		},
+		{
+			name:     "it should break remainder ties by user ID",
+			houseCut: 0,
+			wagers: []Wager{
+				{UserID: "b", OptionIndex: 0, Stake: 1},
+				{UserID: "a", OptionIndex: 0, Stake: 1},
+				{UserID: "c", OptionIndex: 1, Stake: 1},
+			},
+			winningOption:   0,
+			expectedPayouts: map[string]int64{"a": 2, "b": 1, "c": 0},
+		},
+		{
+			name:     "it should refund everyone when nobody backed the winner",
+			houseCut: 1000,
+			wagers: []Wager{
+				{UserID: "a", OptionIndex: 0, Stake: 30},
+				{UserID: "b", OptionIndex: 1, Stake: 20},
+			},
+			winningOption:   2,
+			expectedPayouts: map[string]int64{"a": 30, "b": 20},
+		},
+		{
+			name:     "it should pay nothing for bets without a stake",
+			houseCut: 0,
+			wagers: []Wager{
+				{UserID: "a", OptionIndex: 0, Stake: 0},
+				{UserID: "b", OptionIndex: 0, Stake: 50},
+				{UserID: "c", OptionIndex: 1, Stake: 50},
+			},
+			winningOption:   0,
+			expectedPayouts: map[string]int64{"a": 0, "b": 100, "c": 0},
+		},
+		{
+			name:     "it should not overflow on large pools",
+			houseCut: 0,
+			wagers: []Wager{
+				{UserID: "a", OptionIndex: 0, Stake: 6_000_000_000_000_000_000},
+				{UserID: "b", OptionIndex: 0, Stake: 2_000_000_000_000_000_000},
+				{UserID: "c", OptionIndex: 1, Stake: 1_000_000_000_000_000_000},
+			},
+			winningOption: 0,
+			expectedPayouts: map[string]int64{
+				"a": 6_750_000_000_000_000_000,
+				"b": 2_250_000_000_000_000_000,
+				"c": 0,
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			calculator := PayoutCalculator{HouseCut: tc.houseCut}
+
+			settlement := calculator.Settle(tc.wagers, tc.winningOption)
+
+			if !maps.Equal(settlement.Payouts, tc.expectedPayouts) {
+				t.Errorf("Expected payouts %v, but got %v", tc.expectedPayouts, settlement.Payouts)
+			}
+			if settlement.HouseCut != tc.expectedCut {
+				t.Errorf("Expected house cut %d, but got %d", tc.expectedCut, settlement.HouseCut)
+			}
+
+			var paid int64
+			for _, payout := range settlement.Payouts {
+				paid += payout
+			}
+			if paid+settlement.HouseCut != settlement.Pool {
+				t.Errorf("Expected payouts and house cut to add up to the pool of %d, but got %d", settlement.Pool, paid+settlement.HouseCut)
+			}
+		})
+	}
+}
+
+func TestPayoutCalculatorSettleIsDeterministic(t *testing.T) {
+	t.Parallel()
+	calculator := PayoutCalculator{HouseCut: 300}
+	wagers := []Wager{
+		{UserID: "a", OptionIndex: 0, Stake: 7},
+		{UserID: "b", OptionIndex: 0, Stake: 11},
+		{UserID: "c", OptionIndex: 0, Stake: 13},
+		{UserID: "d", OptionIndex: 1, Stake: 17},
+	}
+	reversed := []Wager{wagers[3], wagers[2], wagers[1], wagers[0]}
+
+	first := calculator.Settle(wagers, 0)
+	second := calculator.Settle(reversed, 0)
+
+	if !maps.Equal(first.Payouts, second.Payouts) {
+		t.Errorf("Expected the order of wagers not to matter, but got %v and %v", first.Payouts, second.Payouts)
+	}
+}
+
+func TestPayoutCalculatorRefund(t *testing.T) {
+	t.Parallel()
+	calculator := PayoutCalculator{HouseCut: 1000}
+	wagers := []Wager{
+		{UserID: "a", OptionIndex: 0, Stake: 30},
+		{UserID: "b", OptionIndex: 1, Stake: 20},
+	}
+
+	settlement := calculator.Refund(wagers)
+
+	expected := map[string]int64{"a": 30, "b": 20}
+	if !maps.Equal(settlement.Payouts, expected) {
+		t.Errorf("Expected payouts %v, but got %v", expected, settlement.Payouts)
+	}
+	if settlement.HouseCut != 0 {
+		t.Errorf("Expected no house cut on a refund, but got %d", settlement.HouseCut)
+	}
+}
+
+func TestPayoutCalculatorImpliedOdds(t *testing.T) {
+	t.Parallel()
+	calculator := PayoutCalculator{HouseCut: 1000}
+	wagers := []Wager{
+		{UserID: "a", OptionIndex: 0, Stake: 60},
+		{UserID: "b", OptionIndex: 0, Stake: 30},
+		{UserID: "c", OptionIndex: 1, Stake: 10},
+	}
+
+	odds := calculator.ImpliedOdds(wagers, 3)
+
+	// 90 of the 100 point pool is paid out after the 10% house cut.
+	expected := []OptionOdds{
+		{OptionIndex: 0, Staked: 90, Odds: 1},
+		{OptionIndex: 1, Staked: 10, Odds: 9},
+		{OptionIndex: 2, Staked: 0, Odds: 0},
+	}
+	if len(odds) != len(expected) {
+		t.Fatalf("Expected odds for %d options, but got %d", len(expected), len(odds))
+	}
+	for index := range expected {
+		if odds[index] != expected[index] {
+			t.Errorf("Expected odds %+v, but got %+v", expected[index], odds[index])
+		}
+	}
+}
@@ -3,11 +3,18 @@
 package bets
 
 import (
+	"context"
+	"database/sql"
+	"errors"
 	"os"
+	"slices"
 	"strings"
 	"testing"
+	"time"
 
+	"betting-discord-bot/internal/polls"
 	"betting-discord-bot/internal/storage"
+	"betting-discord-bot/internal/wallet"
 )
 
 // setupLibSQL is a helper function specifically for the LibSQL implementation.
@@ -26,7 +33,7 @@ func setupLibSQL(t *testing.T) (BetRepository, func()) {
 		t.Fatalf("Failed to initialize test database: %v", err)
 	}
 
-	repo := NewLibSQLRepository(db)
+	repo := withParents(NewLibSQLRepository(db), db)
 
 	teardown := func() {
 		if err := db.Close(); err != nil {
@@ -40,6 +47,28 @@ func setupLibSQL(t *testing.T) (BetRepository, func()) {
 	return repo, teardown
 }
 
+// parentsRepository creates the poll and the user of each bet it saves, unless
+// they exist, so that contract tests about bets alone can make up poll and
+// user IDs that the foreign keys of the bets table would refuse.
+type parentsRepository struct {
+	BetRepository
+	db *sql.DB
+}
+
+func withParents(repo BetRepository, db *sql.DB) BetRepository {
+	return parentsRepository{BetRepository: repo, db: db}
+}
+
+func (repo parentsRepository) Save(ctx context.Context, bet *bet) error {
+	if _, err := repo.db.ExecContext(ctx, "INSERT INTO polls (id) VALUES (?) ON CONFLICT (id) DO NOTHING", bet.PollID); err != nil {
+		return err
+	}
+	if _, err := repo.db.ExecContext(ctx, "INSERT INTO users (id) VALUES (?) ON CONFLICT (id) DO NOTHING", bet.UserID); err != nil {
+		return err
+	}
+	return repo.BetRepository.Save(ctx, bet)
+}
+
 // setupInMemory is a helper function for the in-memory implementation.
 func setupInMemory(t *testing.T) (BetRepository, func()) {
 	t.Helper()
@@ -71,6 +100,17 @@ func TestBetRepositoryImplementations(t *testing.T) {
 		{"it should get all bets from a user", testGetAllBetsFromUser},
 		{"it should get all bets from a poll", testGetAllBetsFromPoll},
 		{"it should update a bet", testUpdateBet},
+		{"it should settle all bets from a poll", testSettleBetsByPollId},
+		{"it should void all bets from a poll", testVoidBetsByPollId},
+		{"it should switch a bet and record the change", testSaveBetChange},
+		{"it should withdraw a bet and record the change", testSaveBetWithdrawal},
+		{"it should not change a missing bet", testChangeMissingBet},
+		{"it should get the changes of a user across polls", testGetBetChangesByUser},
+		{"it should rank users on the leaderboard", testLeaderboardOrders},
+		{"it should page through the leaderboard", testLeaderboardPages},
+		{"it should rank a single user against everyone", testLeaderboardUserEntry},
+		{"it should count the bets on each poll", testCountBetsByPollIDs},
+		{"it should stop once the context is cancelled", testCancelledContext},
 	}
 
 	// Loop through each implementation and run each test against it. Did this
@@ -102,22 +142,23 @@ func testSaveAndGet(t *testing.T, repo BetRepository) {
 		UserID:              "user456",
 		SelectedOptionIndex: 0,
 		BetStatus:           Pending,
+		Stake:               25,
 	}
 
 	// ACT & ASSERT (Save)
-	if err := repo.Save(bet); err != nil {
+	if err := repo.Save(t.Context(), bet); err != nil {
 		t.Fatalf("Failed to save bet: %v", err)
 	}
 
 	// ACT & ASSERT (Get)
-	retrievedBet, err := repo.GetByPollIdAndUserId(bet.PollID, bet.UserID)
+	retrievedBet, err := repo.GetByPollIdAndUserId(t.Context(), bet.PollID, bet.UserID)
 	if err != nil {
 		t.Fatalf("Failed to get bet by PollID and UserID: %v", err)
 	}
 	if retrievedBet == nil {
 		t.Fatal("Retrieved bet is nil, expected a valid bet")
 	}
-	if retrievedBet.PollID != bet.PollID || retrievedBet.UserID != bet.UserID {
+	if retrievedBet.PollID != bet.PollID || retrievedBet.UserID != bet.UserID || retrievedBet.Stake != bet.Stake {
 		t.Errorf("Retrieved bet does not match original: got %+v, want %+v", retrievedBet, bet)
 	}
 }
@@ -130,13 +171,13 @@ func testGetAllBetsFromUser(t *testing.T, repo BetRepository) {
 		{PollID: "poll2", UserID: userID, SelectedOptionIndex: 1, BetStatus: Pending},
 	}
 	for _, bet := range bets {
-		if err := repo.Save(&bet); err != nil {
+		if err := repo.Save(t.Context(), &bet); err != nil {
 			t.Fatalf("Failed to save bet: %v", err)
 		}
 	}
 
 	// ACT
-	retrievedBets, err := repo.GetBetsFromUser(userID)
+	retrievedBets, err := repo.GetBetsFromUser(t.Context(), userID)
 	if err != nil {
 		t.Fatalf("Failed to get bets from user: %v", err)
 	}
@@ -155,13 +196,13 @@ func testGetAllBetsFromPoll(t *testing.T, repo BetRepository) {
 		{PollID: pollID, UserID: "user2", SelectedOptionIndex: 1, BetStatus: Pending},
 	}
 	for _, bet := range bets {
-		if err := repo.Save(&bet); err != nil {
+		if err := repo.Save(t.Context(), &bet); err != nil {
 			t.Fatalf("Failed to save bet: %v", err)
 		}
 	}
 
 	// ACT
-	retrievedBets, err := repo.GetBetsByPollId(pollID)
+	retrievedBets, err := repo.GetBetsByPollId(t.Context(), pollID)
 	if err != nil {
 		t.Fatalf("Failed to get bets by PollID: %v", err)
 	}
@@ -178,23 +219,925 @@ func testUpdateBet(t *testing.T, repo BetRepository) {
 		PollID:    "poll123",
 		UserID:    "user456",
 		BetStatus: Pending,
+		Stake:     25,
 	}
-	if err := repo.Save(bet); err != nil {
+	if err := repo.Save(t.Context(), bet); err != nil {
 		t.Fatalf("Failed to save initial bet: %v", err)
 	}
 
 	// ACT
 	bet.BetStatus = Won
-	if err := repo.UpdateBet(bet); err != nil {
+	bet.Payout = 50
+	if err := repo.UpdateBet(t.Context(), bet); err != nil {
 		t.Fatalf("Failed to update bet: %v", err)
 	}
 
 	// ASSERT
-	retrievedBet, err := repo.GetByPollIdAndUserId(bet.PollID, bet.UserID)
+	retrievedBet, err := repo.GetByPollIdAndUserId(t.Context(), bet.PollID, bet.UserID)
 	if err != nil {
 		t.Fatalf("Failed to get updated bet: %v", err)
 	}
 	if retrievedBet.BetStatus != Won {
 		t.Errorf("Expected bet status %v, but got %v", Won, retrievedBet.BetStatus)
 	}
+	if retrievedBet.Stake != 25 || retrievedBet.Payout != 50 {
+		t.Errorf("Expected stake 25 and payout 50, but got %d and %d", retrievedBet.Stake, retrievedBet.Payout)
+	}
+}
+
+func testSettleBetsByPollId(t *testing.T, repo BetRepository) {
+	// ARRANGE
+	pollID := "poll789"
+	bets := []bet{
+		{PollID: pollID, UserID: "winner", SelectedOptionIndex: 1, BetStatus: Pending},
+		{PollID: pollID, UserID: "loser", SelectedOptionIndex: 0, BetStatus: Pending},
+		{PollID: "otherPoll", UserID: "winner", SelectedOptionIndex: 1, BetStatus: Pending},
+	}
+	for _, bet := range bets {
+		if err := repo.Save(t.Context(), &bet); err != nil {
+			t.Fatalf("Failed to save bet: %v", err)
+		}
+	}
+
+	// ACT
+	if err := repo.SettleBetsByPollId(t.Context(), pollID, 1); err != nil {
+		t.Fatalf("Failed to settle bets: %v", err)
+	}
+
+	// ASSERT
+	expectedStatuses := []struct {
+		pollID string
+		userID string
+		status BetStatus
+	}{
+		{pollID, "winner", Won},
+		{pollID, "loser", Lost},
+		{"otherPoll", "winner", Pending},
+	}
+	for _, expected := range expectedStatuses {
+		retrievedBet, err := repo.GetByPollIdAndUserId(t.Context(), expected.pollID, expected.userID)
+		if err != nil {
+			t.Fatalf("Failed to get bet: %v", err)
+		}
+		if retrievedBet.BetStatus != expected.status {
+			t.Errorf("Expected bet status %v for user %s on poll %s, but got %v", expected.status, expected.userID, expected.pollID, retrievedBet.BetStatus)
+		}
+	}
+}
+
+func testVoidBetsByPollId(t *testing.T, repo BetRepository) {
+	// ARRANGE
+	bets := []bet{
+		{PollID: "cancelledPoll", UserID: "user1", SelectedOptionIndex: 0, BetStatus: Pending},
+		{PollID: "cancelledPoll", UserID: "user2", SelectedOptionIndex: 1, BetStatus: Won},
+		{PollID: "otherPoll", UserID: "user1", SelectedOptionIndex: 0, BetStatus: Pending},
+	}
+	for _, bet := range bets {
+		if err := repo.Save(t.Context(), &bet); err != nil {
+			t.Fatalf("Failed to save bet: %v", err)
+		}
+	}
+
+	// ACT
+	if err := repo.VoidBetsByPollId(t.Context(), "cancelledPoll"); err != nil {
+		t.Fatalf("Failed to void bets: %v", err)
+	}
+
+	// ASSERT
+	for _, bet := range bets {
+		expectedStatus := Void
+		if bet.PollID == "otherPoll" {
+			expectedStatus = Pending
+		}
+
+		retrievedBet, err := repo.GetByPollIdAndUserId(t.Context(), bet.PollID, bet.UserID)
+		if err != nil {
+			t.Fatalf("Failed to get bet: %v", err)
+		}
+		if retrievedBet.BetStatus != expectedStatus {
+			t.Errorf("Expected bet status %v for user %s on poll %s, but got %v", expectedStatus, bet.UserID, bet.PollID, retrievedBet.BetStatus)
+		}
+	}
+}
+
+func testSaveBetChange(t *testing.T, repo BetRepository) {
+	// ARRANGE
+	original := &bet{PollID: "poll123", UserID: "user456", SelectedOptionIndex: 0, BetStatus: Pending, Stake: 25}
+	if err := repo.Save(t.Context(), original); err != nil {
+		t.Fatalf("Failed to save bet: %v", err)
+	}
+
+	changed := *original
+	changed.SelectedOptionIndex = 2
+	change := BetChange{
+		PollID:              "poll123",
+		UserID:              "user456",
+		Kind:                Switched,
+		PreviousOptionIndex: 0,
+		NewOptionIndex:      2,
+		ChangedAt:           time.UnixMilli(1_700_000_000_000),
+	}
+
+	// ACT
+	if err := repo.SaveBetChange(t.Context(), &changed, change); err != nil {
+		t.Fatalf("Failed to save bet change: %v", err)
+	}
+
+	// ASSERT
+	retrievedBet, err := repo.GetByPollIdAndUserId(t.Context(), "poll123", "user456")
+	if err != nil {
+		t.Fatalf("Failed to get bet: %v", err)
+	}
+	if retrievedBet.SelectedOptionIndex != 2 || retrievedBet.Stake != 25 {
+		t.Errorf("Expected option 2 with stake 25, but got option %d with stake %d", retrievedBet.SelectedOptionIndex, retrievedBet.Stake)
+	}
+
+	changes, err := repo.GetBetChanges(t.Context(), "poll123", "user456")
+	if err != nil {
+		t.Fatalf("Failed to get bet changes: %v", err)
+	}
+	if len(changes) != 1 || changes[0] != change {
+		t.Errorf("Expected changes %+v, but got %+v", []BetChange{change}, changes)
+	}
+}
+
+func testSaveBetWithdrawal(t *testing.T, repo BetRepository) {
+	// ARRANGE
+	original := &bet{PollID: "poll123", UserID: "user456", SelectedOptionIndex: 1, BetStatus: Pending}
+	if err := repo.Save(t.Context(), original); err != nil {
+		t.Fatalf("Failed to save bet: %v", err)
+	}
+	change := BetChange{
+		PollID:              "poll123",
+		UserID:              "user456",
+		Kind:                Withdrawn,
+		PreviousOptionIndex: 1,
+		NewOptionIndex:      -1,
+		ChangedAt:           time.UnixMilli(1_700_000_000_000),
+	}
+
+	// ACT
+	if err := repo.SaveBetWithdrawal(t.Context(), original, change); err != nil {
+		t.Fatalf("Failed to save bet withdrawal: %v", err)
+	}
+
+	// ASSERT
+	if _, err := repo.GetByPollIdAndUserId(t.Context(), "poll123", "user456"); !errors.Is(err, ErrBetNotFound) {
+		t.Errorf("Expected error '%v', but got '%v'", ErrBetNotFound, err)
+	}
+
+	changes, err := repo.GetBetChanges(t.Context(), "poll123", "user456")
+	if err != nil {
+		t.Fatalf("Failed to get bet changes: %v", err)
+	}
+	if len(changes) != 1 || changes[0] != change {
+		t.Errorf("Expected changes %+v, but got %+v", []BetChange{change}, changes)
+	}
+
+	// The user can bet on the poll again.
+	if err := repo.Save(t.Context(), original); err != nil {
+		t.Errorf("Failed to save bet after withdrawal: %v", err)
+	}
+}
+
+func testChangeMissingBet(t *testing.T, repo BetRepository) {
+	missing := &bet{PollID: "poll123", UserID: "missing"}
+	change := BetChange{PollID: "poll123", UserID: "missing", Kind: Withdrawn, ChangedAt: time.Now()}
+
+	if err := repo.SaveBetChange(t.Context(), missing, change); !errors.Is(err, ErrBetNotFound) {
+		t.Errorf("Expected error '%v', but got '%v'", ErrBetNotFound, err)
+	}
+	if err := repo.SaveBetWithdrawal(t.Context(), missing, change); !errors.Is(err, ErrBetNotFound) {
+		t.Errorf("Expected error '%v', but got '%v'", ErrBetNotFound, err)
+	}
+
+	changes, err := repo.GetBetChanges(t.Context(), "poll123", "missing")
+	if err != nil {
+		t.Fatalf("Failed to get bet changes: %v", err)
+	}
+	if len(changes) != 0 {
+		t.Errorf("Expected no changes to be recorded, but got %+v", changes)
+	}
+}
+
+func testGetBetChangesByUser(t *testing.T, repo BetRepository) {
+	// ARRANGE
+	var want []BetChange
+	for index, bet := range []*bet{
+		{PollID: "poll1", UserID: "user456", SelectedOptionIndex: 0, BetStatus: Pending},
+		{PollID: "poll2", UserID: "user456", SelectedOptionIndex: 1, BetStatus: Pending},
+		{PollID: "poll1", UserID: "other", SelectedOptionIndex: 0, BetStatus: Pending},
+	} {
+		if err := repo.Save(t.Context(), bet); err != nil {
+			t.Fatalf("Failed to save bet: %v", err)
+		}
+		change := BetChange{
+			PollID:              bet.PollID,
+			UserID:              bet.UserID,
+			Kind:                Withdrawn,
+			PreviousOptionIndex: bet.SelectedOptionIndex,
+			NewOptionIndex:      -1,
+			ChangedAt:           time.UnixMilli(1_700_000_000_000 + int64(index)),
+		}
+		if err := repo.SaveBetWithdrawal(t.Context(), bet, change); err != nil {
+			t.Fatalf("Failed to save bet withdrawal: %v", err)
+		}
+		if bet.UserID == "user456" {
+			want = append(want, change)
+		}
+	}
+
+	// ACT
+	changes, err := repo.GetBetChangesByUser(t.Context(), "user456")
+
+	// ASSERT
+	if err != nil {
+		t.Fatalf("Failed to get bet changes: %v", err)
+	}
+	if !slices.Equal(changes, want) {
+		t.Errorf("Expected changes %+v, but got %+v", want, changes)
+	}
+}
+
+func saveLeaderboardBets(t *testing.T, repo BetRepository) {
+	t.Helper()
+
+	bets := []*bet{
+		// alice: 3 wins, 1 loss, 50 points
+		{PollID: "poll1", UserID: "alice", BetStatus: Won, Stake: 10, Payout: 30},
+		{PollID: "poll2", UserID: "alice", BetStatus: Won, Stake: 10, Payout: 30},
+		{PollID: "poll3", UserID: "alice", BetStatus: Won, Stake: 10, Payout: 30},
+		{PollID: "poll4", UserID: "alice", BetStatus: Lost, Stake: 10},
+		// bob: 3 wins, 0 losses, 10 points
+		{PollID: "poll1", UserID: "bob", BetStatus: Won, Stake: 10, Payout: 15},
+		{PollID: "poll2", UserID: "bob", BetStatus: Won, Stake: 10, Payout: 15},
+		{PollID: "poll3", UserID: "bob", BetStatus: Won},
+		// carol: 1 win, 2 losses, 200 points
+		{PollID: "poll1", UserID: "carol", BetStatus: Won, Stake: 100, Payout: 300},
+		{PollID: "poll2", UserID: "carol", BetStatus: Lost},
+		{PollID: "poll3", UserID: "carol", BetStatus: Lost},
+		// Unsettled bets are not ranked.
+		{PollID: "poll5", UserID: "dave", BetStatus: Pending, Stake: 10},
+		{PollID: "poll5", UserID: "erin", BetStatus: Void, Stake: 10, Payout: 10},
+	}
+	for _, bet := range bets {
+		if err := repo.Save(t.Context(), bet); err != nil {
+			t.Fatalf("Failed to save bet: %v", err)
+		}
+	}
+}
+
+func testLeaderboardOrders(t *testing.T, repo BetRepository) {
+	saveLeaderboardBets(t, repo)
+
+	alice := LeaderboardEntry{UserID: "alice", Wins: 3, Losses: 1, Points: 50}
+	bob := LeaderboardEntry{UserID: "bob", Wins: 3, Losses: 0, Points: 10}
+	carol := LeaderboardEntry{UserID: "carol", Wins: 1, Losses: 2, Points: 200}
+	ranked := func(entry LeaderboardEntry, rank int) LeaderboardEntry {
+		entry.Rank = rank
+		return entry
+	}
+
+	tests := []struct {
+		name     string
+		query    LeaderboardQuery
+		expected []LeaderboardEntry
+	}{
+		{
+			name:     "by wins, with ties sharing a rank",
+			query:    LeaderboardQuery{OrderBy: ByWins, Limit: 10},
+			expected: []LeaderboardEntry{ranked(alice, 1), ranked(bob, 1), ranked(carol, 3)},
+		},
+		{
+			name:     "by win rate",
+			query:    LeaderboardQuery{OrderBy: ByWinRate, Limit: 10},
+			expected: []LeaderboardEntry{ranked(bob, 1), ranked(alice, 2), ranked(carol, 3)},
+		},
+		{
+			name:     "by win rate with a minimum number of bets",
+			query:    LeaderboardQuery{OrderBy: ByWinRate, MinBets: 4, Limit: 10},
+			expected: []LeaderboardEntry{ranked(alice, 1)},
+		},
+		{
+			name:     "by points",
+			query:    LeaderboardQuery{OrderBy: ByPoints, Limit: 10},
+			expected: []LeaderboardEntry{ranked(carol, 1), ranked(alice, 2), ranked(bob, 3)},
+		},
+	}
+
+	for _, test := range tests {
+		leaderboard, err := repo.GetLeaderboard(t.Context(), test.query)
+		if err != nil {
+			t.Fatalf("%s: failed to get leaderboard: %v", test.name, err)
+		}
+		if leaderboard.Total != len(test.expected) {
+			t.Errorf("%s: expected a total of %d, but got %d", test.name, len(test.expected), leaderboard.Total)
+		}
+		if len(leaderboard.Entries) != len(test.expected) {
+			t.Errorf("%s: expected entries %+v, but got %+v", test.name, test.expected, leaderboard.Entries)
+			continue
+		}
+		for index, entry := range leaderboard.Entries {
+			if entry != test.expected[index] {
+				t.Errorf("%s: expected entry %+v, but got %+v", test.name, test.expected[index], entry)
+			}
+		}
+	}
+}
+
+func testLeaderboardPages(t *testing.T, repo BetRepository) {
+	saveLeaderboardBets(t, repo)
+
+	page, err := repo.GetLeaderboard(t.Context(), LeaderboardQuery{OrderBy: ByPoints, Limit: 2, Offset: 2})
+	if err != nil {
+		t.Fatalf("Failed to get leaderboard: %v", err)
+	}
+	if page.Total != 3 {
+		t.Errorf("Expected a total of 3, but got %d", page.Total)
+	}
+	if len(page.Entries) != 1 || page.Entries[0].UserID != "bob" || page.Entries[0].Rank != 3 {
+		t.Errorf("Expected bob ranked 3rd alone on the second page, but got %+v", page.Entries)
+	}
+
+	pastTheEnd, err := repo.GetLeaderboard(t.Context(), LeaderboardQuery{OrderBy: ByPoints, Limit: 2, Offset: 4})
+	if err != nil {
+		t.Fatalf("Failed to get leaderboard: %v", err)
+	}
+	if len(pastTheEnd.Entries) != 0 || pastTheEnd.Total != 3 {
+		t.Errorf("Expected an empty page with a total of 3, but got %+v", pastTheEnd)
+	}
+}
+
+func testLeaderboardUserEntry(t *testing.T, repo BetRepository) {
+	saveLeaderboardBets(t, repo)
+
+	leaderboard, err := repo.GetLeaderboard(t.Context(), LeaderboardQuery{OrderBy: ByPoints, UserID: "alice", Limit: 1})
+	if err != nil {
+		t.Fatalf("Failed to get leaderboard: %v", err)
+	}
+	if leaderboard.Total != 3 {
+		t.Errorf("Expected a total of 3, but got %d", leaderboard.Total)
+	}
+	if len(leaderboard.Entries) != 1 || leaderboard.Entries[0].UserID != "alice" || leaderboard.Entries[0].Rank != 2 {
+		t.Errorf("Expected alice ranked 2nd, but got %+v", leaderboard.Entries)
+	}
+
+	unranked, err := repo.GetLeaderboard(t.Context(), LeaderboardQuery{OrderBy: ByPoints, UserID: "dave", Limit: 1})
+	if err != nil {
+		t.Fatalf("Failed to get leaderboard: %v", err)
+	}
+	if len(unranked.Entries) != 0 || unranked.Total != 3 {
+		t.Errorf("Expected no entry for an unranked user and a total of 3, but got %+v", unranked)
+	}
+}
+
+func setupLibSQLWithPolls(t *testing.T) (BetRepository, polls.PollRepository, func()) {
+	t.Helper()
+
+	sanitizedTestName := strings.ReplaceAll(t.Name(), "/", "_")
+	dbPath := sanitizedTestName + ".db"
+	_ = os.Remove(dbPath)
+
+	db, err := storage.InitializeDatabase(dbPath, "")
+	if err != nil {
+		t.Fatalf("Failed to initialize test database: %v", err)
+	}
+
+	teardown := func() {
+		if err := db.Close(); err != nil {
+			t.Fatal("failed to close database")
+		}
+		if err := os.Remove(dbPath); err != nil {
+			t.Fatal("failed to remove database file")
+		}
+	}
+
+	return withParents(NewLibSQLRepository(db), db), polls.NewLibSQLRepository(db), teardown
+}
+
+func setupInMemoryWithPolls(t *testing.T) (BetRepository, polls.PollRepository, func()) {
+	t.Helper()
+
+	pollRepo := polls.NewMemoryRepository()
+	return NewMemoryRepositoryWithPolls(pollRepo), pollRepo, func() {}
+}
+
+// TestBetHistoryImplementations covers listing bets with their polls, and
+// scoping them to a guild, which needs a poll repository backed by the same
+// storage.
+func TestBetHistoryImplementations(t *testing.T) {
+	t.Parallel()
+	implementations := []struct {
+		name  string
+		setup func(t *testing.T) (BetRepository, polls.PollRepository, func())
+	}{
+		{name: "InMemoryRepository", setup: setupInMemoryWithPolls},
+		{name: "LibSQLRepository", setup: setupLibSQLWithPolls},
+	}
+
+	testCases := []struct {
+		name string
+		run  func(t *testing.T, repo BetRepository, pollRepo polls.PollRepository)
+	}{
+		{"it should list a user's bets with their polls", testBetHistoryFilters},
+		{"it should page through a user's bets", testBetHistoryPages},
+		{"it should scope bets and the leaderboard to a guild", testGuildScope},
+		{"it should delete the bets of a deleted poll", testDeletedPollBets},
+	}
+
+	for _, impl := range implementations {
+		t.Run(impl.name, func(t *testing.T) {
+			t.Parallel()
+
+			for _, tc := range testCases {
+				t.Run(tc.name, func(t *testing.T) {
+					t.Parallel()
+
+					repo, pollRepo, cleanup := impl.setup(t)
+					t.Cleanup(cleanup)
+
+					tc.run(t, repo, pollRepo)
+				})
+			}
+		})
+	}
+}
+
+// saveHistoryBets places three bets for "user", one hour apart, and returns
+// the history entries they should produce, newest first.
+func saveHistoryBets(t *testing.T, repo BetRepository, pollRepo polls.PollRepository) []BetHistoryEntry {
+	t.Helper()
+
+	pollService := polls.NewService(pollRepo)
+	placedAt := time.UnixMilli(1_700_000_000_000)
+
+	fixtures := []struct {
+		title       string
+		category    string
+		options     []string
+		optionIndex int
+		status      BetStatus
+		stake       int64
+		payout      int64
+	}{
+		{"Who wins the final?", "Valorant", []string{"Red", "Blue"}, 1, Won, 10, 25},
+		{"Will it rain?", "", []string{"Yes", "No"}, 0, Pending, 5, 0},
+		{"Best snack", "Food", []string{"Chips", "Fruit"}, 1, Lost, 0, 0},
+	}
+
+	var expected []BetHistoryEntry
+	for index, fixture := range fixtures {
+		poll, err := pollService.CreatePoll(t.Context(), testGuildID, "", fixture.title, fixture.options, time.Time{}, fixture.category)
+		if err != nil {
+			t.Fatalf("Failed to create poll: %v", err)
+		}
+
+		userBet := &bet{
+			PollID:              poll.GetID(),
+			UserID:              "user",
+			SelectedOptionIndex: fixture.optionIndex,
+			BetStatus:           fixture.status,
+			Stake:               fixture.stake,
+			Payout:              fixture.payout,
+			PlacedAt:            placedAt.Add(time.Duration(index) * time.Hour),
+		}
+		if err := repo.Save(t.Context(), userBet); err != nil {
+			t.Fatalf("Failed to save bet: %v", err)
+		}
+		if err := repo.Save(t.Context(), &bet{PollID: poll.GetID(), UserID: "otherUser", PlacedAt: userBet.PlacedAt}); err != nil {
+			t.Fatalf("Failed to save bet: %v", err)
+		}
+
+		entry := BetHistoryEntry{
+			PollID:       poll.GetID(),
+			PollTitle:    fixture.title,
+			PollCategory: fixture.category,
+			OptionIndex:  fixture.optionIndex,
+			Option:       fixture.options[fixture.optionIndex],
+			BetStatus:    fixture.status,
+			Stake:        fixture.stake,
+			Payout:       fixture.payout,
+			PlacedAt:     userBet.PlacedAt,
+		}
+		expected = append([]BetHistoryEntry{entry}, expected...)
+	}
+
+	return expected
+}
+
+func assertHistoryEntries(t *testing.T, name string, expected []BetHistoryEntry, actual []BetHistoryEntry) {
+	t.Helper()
+
+	if len(actual) != len(expected) {
+		t.Fatalf("%s: expected %d entries, but got %+v", name, len(expected), actual)
+	}
+	for index, entry := range actual {
+		if !entry.PlacedAt.Equal(expected[index].PlacedAt) {
+			t.Errorf("%s: expected entry placed at %v, but got %v", name, expected[index].PlacedAt, entry.PlacedAt)
+		}
+		entry.PlacedAt = expected[index].PlacedAt
+		if entry != expected[index] {
+			t.Errorf("%s: expected entry %+v, but got %+v", name, expected[index], entry)
+		}
+	}
+}
+
+func testBetHistoryFilters(t *testing.T, repo BetRepository, pollRepo polls.PollRepository) {
+	all := saveHistoryBets(t, repo, pollRepo)
+
+	tests := []struct {
+		name     string
+		filter   BetHistoryFilter
+		expected []BetHistoryEntry
+	}{
+		{"all bets", AllBets, all},
+		{"open bets", OpenBets, []BetHistoryEntry{all[1]}},
+		{"settled bets", SettledBets, []BetHistoryEntry{all[0], all[2]}},
+	}
+
+	for _, test := range tests {
+		history, err := repo.GetBetHistory(t.Context(), BetHistoryQuery{UserID: "user", Filter: test.filter, Limit: 10})
+		if err != nil {
+			t.Fatalf("%s: failed to get bet history: %v", test.name, err)
+		}
+		if history.Total != len(test.expected) {
+			t.Errorf("%s: expected a total of %d, but got %d", test.name, len(test.expected), history.Total)
+		}
+		assertHistoryEntries(t, test.name, test.expected, history.Entries)
+	}
+}
+
+func testBetHistoryPages(t *testing.T, repo BetRepository, pollRepo polls.PollRepository) {
+	all := saveHistoryBets(t, repo, pollRepo)
+
+	page, err := repo.GetBetHistory(t.Context(), BetHistoryQuery{UserID: "user", Limit: 2, Offset: 2})
+	if err != nil {
+		t.Fatalf("Failed to get bet history: %v", err)
+	}
+	if page.Total != 3 {
+		t.Errorf("Expected a total of 3, but got %d", page.Total)
+	}
+	assertHistoryEntries(t, "second page", all[2:], page.Entries)
+
+	pastTheEnd, err := repo.GetBetHistory(t.Context(), BetHistoryQuery{UserID: "user", Limit: 2, Offset: 4})
+	if err != nil {
+		t.Fatalf("Failed to get bet history: %v", err)
+	}
+	if len(pastTheEnd.Entries) != 0 || pastTheEnd.Total != 3 {
+		t.Errorf("Expected an empty page with a total of 3, but got %+v", pastTheEnd)
+	}
+}
+
+func testCountBetsByPollIDs(t *testing.T, repo BetRepository) {
+	for _, key := range []BetKey{{"poll1", "first"}, {"poll1", "second"}, {"poll2", "first"}, {"poll3", "first"}} {
+		if err := repo.Save(t.Context(), &bet{PollID: key.PollID, UserID: key.UserID}); err != nil {
+			t.Fatalf("Failed to save bet: %v", err)
+		}
+	}
+
+	counts, err := repo.CountBetsByPollIDs(t.Context(), []string{"poll1", "poll2", "noBets"})
+	if err != nil {
+		t.Fatalf("Failed to count bets: %v", err)
+	}
+
+	expected := map[string]int{"poll1": 2, "poll2": 1}
+	if len(counts) != len(expected) {
+		t.Errorf("Expected counts %v, but got %v", expected, counts)
+	}
+	for pollID, count := range expected {
+		if counts[pollID] != count {
+			t.Errorf("Expected %d bets on %s, but got %d", count, pollID, counts[pollID])
+		}
+	}
+}
+
+func testGuildScope(t *testing.T, repo BetRepository, pollRepo polls.PollRepository) {
+	pollService := polls.NewService(pollRepo)
+	firstPoll, err := pollService.CreatePoll(t.Context(), "first", "", "Who wins the final?", []string{"Red", "Blue"}, time.Time{}, "")
+	if err != nil {
+		t.Fatalf("Failed to create poll: %v", err)
+	}
+	secondPoll, err := pollService.CreatePoll(t.Context(), "second", "", "Will it rain?", []string{"Yes", "No"}, time.Time{}, "")
+	if err != nil {
+		t.Fatalf("Failed to create poll: %v", err)
+	}
+
+	for _, saved := range []*bet{
+		{PollID: firstPoll.GetID(), UserID: "user", BetStatus: Won, Stake: 10, Payout: 20},
+		{PollID: firstPoll.GetID(), UserID: "otherUser", BetStatus: Lost, Stake: 10},
+		{PollID: secondPoll.GetID(), UserID: "user", BetStatus: Lost, Stake: 5},
+	} {
+		if err := repo.Save(t.Context(), saved); err != nil {
+			t.Fatalf("Failed to save bet: %v", err)
+		}
+	}
+
+	history, err := repo.GetBetHistory(t.Context(), BetHistoryQuery{UserID: "user", GuildID: "second", Limit: 10})
+	if err != nil {
+		t.Fatalf("Failed to get bet history: %v", err)
+	}
+	if history.Total != 1 || len(history.Entries) != 1 || history.Entries[0].PollID != secondPoll.GetID() {
+		t.Errorf("Expected only the bet in the second guild, but got %+v", history)
+	}
+
+	leaderboard, err := repo.GetLeaderboard(t.Context(), LeaderboardQuery{GuildID: "second", OrderBy: ByWins, Limit: 10})
+	if err != nil {
+		t.Fatalf("Failed to get leaderboard: %v", err)
+	}
+	if leaderboard.Total != 1 || len(leaderboard.Entries) != 1 || leaderboard.Entries[0].Wins != 0 || leaderboard.Entries[0].Losses != 1 {
+		t.Errorf("Expected only the loss in the second guild to be ranked, but got %+v", leaderboard)
+	}
+
+	leaderboard, err = repo.GetLeaderboard(t.Context(), LeaderboardQuery{GuildID: "first", OrderBy: ByWins, Limit: 10})
+	if err != nil {
+		t.Fatalf("Failed to get leaderboard: %v", err)
+	}
+	if leaderboard.Total != 2 || leaderboard.Entries[0].UserID != "user" || leaderboard.Entries[0].Wins != 1 || leaderboard.Entries[0].Losses != 0 {
+		t.Errorf("Expected user to lead the first guild with a single win, but got %+v", leaderboard)
+	}
+
+	unranked, err := repo.GetLeaderboard(t.Context(), LeaderboardQuery{GuildID: "third", OrderBy: ByWins, UserID: "user", Limit: 1})
+	if err != nil {
+		t.Fatalf("Failed to get leaderboard: %v", err)
+	}
+	if len(unranked.Entries) != 0 || unranked.Total != 0 {
+		t.Errorf("Expected nobody to be ranked in a guild without polls, but got %+v", unranked)
+	}
+}
+
+func testDeletedPollBets(t *testing.T, repo BetRepository, pollRepo polls.PollRepository) {
+	pollService := polls.NewService(pollRepo)
+	deleted, err := pollService.CreatePoll(t.Context(), testGuildID, "", "Who wins the final?", []string{"Red", "Blue"}, time.Time{}, "")
+	if err != nil {
+		t.Fatalf("Failed to create poll: %v", err)
+	}
+	kept, err := pollService.CreatePoll(t.Context(), testGuildID, "", "Will it rain?", []string{"Yes", "No"}, time.Time{}, "")
+	if err != nil {
+		t.Fatalf("Failed to create poll: %v", err)
+	}
+
+	for _, saved := range []*bet{
+		{PollID: deleted.GetID(), UserID: "user", BetStatus: Pending, Stake: 10},
+		{PollID: kept.GetID(), UserID: "user", BetStatus: Pending, Stake: 5},
+	} {
+		if err := repo.Save(t.Context(), saved); err != nil {
+			t.Fatalf("Failed to save bet: %v", err)
+		}
+	}
+	switched := &bet{PollID: deleted.GetID(), UserID: "user", SelectedOptionIndex: 1, BetStatus: Pending, Stake: 10}
+	if err := repo.SaveBetChange(t.Context(), switched, BetChange{PollID: deleted.GetID(), UserID: "user", Kind: Switched, NewOptionIndex: 1, ChangedAt: time.Now()}); err != nil {
+		t.Fatalf("Failed to switch bet: %v", err)
+	}
+
+	if err := pollRepo.Delete(t.Context(), deleted.GetID()); err != nil {
+		t.Fatalf("Failed to delete poll: %v", err)
+	}
+
+	if _, err := repo.GetByPollIdAndUserId(t.Context(), deleted.GetID(), "user"); !errors.Is(err, ErrBetNotFound) {
+		t.Errorf("Expected the bet on the deleted poll to be deleted, but got '%v'", err)
+	}
+	if changes, err := repo.GetBetChanges(t.Context(), deleted.GetID(), "user"); err != nil || len(changes) != 0 {
+		t.Errorf("Expected the bet changes on the deleted poll to be deleted, but got %v (%v)", changes, err)
+	}
+	remaining, err := repo.GetBetsFromUser(t.Context(), "user")
+	if err != nil {
+		t.Fatalf("Failed to get bets from user: %v", err)
+	}
+	if len(remaining) != 1 || remaining[0].PollID != kept.GetID() {
+		t.Errorf("Expected only the bet on the other poll to be kept, but got %+v", remaining)
+	}
+}
+
+// unitOfWorkRepos are the repositories a settlement writes to, sharing one
+// storage and unit of work.
+type unitOfWorkRepos struct {
+	bets       BetRepository
+	polls      polls.PollRepository
+	wallets    wallet.WalletRepository
+	unitOfWork storage.UnitOfWork
+}
+
+func setupLibSQLWithUnitOfWork(t *testing.T) (unitOfWorkRepos, func()) {
+	t.Helper()
+
+	sanitizedTestName := strings.ReplaceAll(t.Name(), "/", "_")
+	dbPath := sanitizedTestName + ".db"
+	_ = os.Remove(dbPath)
+
+	db, err := storage.InitializeDatabase(dbPath, "")
+	if err != nil {
+		t.Fatalf("Failed to initialize test database: %v", err)
+	}
+
+	teardown := func() {
+		if err := db.Close(); err != nil {
+			t.Fatal("failed to close database")
+		}
+		if err := os.Remove(dbPath); err != nil {
+			t.Fatal("failed to remove database file")
+		}
+	}
+
+	return unitOfWorkRepos{
+		bets:       withParents(NewLibSQLRepository(db), db),
+		polls:      polls.NewLibSQLRepository(db),
+		wallets:    wallet.NewLibSQLRepository(db),
+		unitOfWork: storage.NewLibSQLUnitOfWork(db),
+	}, teardown
+}
+
+func setupInMemoryWithUnitOfWork(t *testing.T) (unitOfWorkRepos, func()) {
+	t.Helper()
+
+	pollRepo := polls.NewMemoryRepository()
+	return unitOfWorkRepos{
+		bets:       NewMemoryRepositoryWithPolls(pollRepo),
+		polls:      pollRepo,
+		wallets:    wallet.NewMemoryRepository(),
+		unitOfWork: storage.NewMemoryUnitOfWork(),
+	}, func() {}
+}
+
+// TestUnitOfWorkImplementations covers changing bets, polls and wallets
+// together, as settling a poll does.
+func TestUnitOfWorkImplementations(t *testing.T) {
+	t.Parallel()
+	implementations := []struct {
+		name  string
+		setup func(t *testing.T) (unitOfWorkRepos, func())
+	}{
+		{name: "InMemoryRepository", setup: setupInMemoryWithUnitOfWork},
+		{name: "LibSQLRepository", setup: setupLibSQLWithUnitOfWork},
+	}
+
+	testCases := []struct {
+		name string
+		run  func(t *testing.T, repos unitOfWorkRepos)
+	}{
+		{"it should keep a settlement made in a unit of work", testUnitOfWorkSettlement},
+		{"it should undo a settlement that failed part way", testUnitOfWorkFailedSettlement},
+	}
+
+	for _, impl := range implementations {
+		t.Run(impl.name, func(t *testing.T) {
+			t.Parallel()
+
+			for _, tc := range testCases {
+				t.Run(tc.name, func(t *testing.T) {
+					t.Parallel()
+
+					repos, cleanup := impl.setup(t)
+					t.Cleanup(cleanup)
+
+					tc.run(t, repos)
+				})
+			}
+		})
+	}
+}
+
+// settleInUnitOfWork settles the poll on option 1 and pays the winner 20
+// points, failing with failure before it commits if failure is not nil.
+func settleInUnitOfWork(ctx context.Context, repos unitOfWorkRepos, pollID string, failure error) error {
+	pollService := polls.NewService(repos.polls)
+	walletService := wallet.NewService(repos.wallets, 100)
+
+	return repos.unitOfWork.Do(ctx, func(tx *storage.Tx) error {
+		if err := pollService.WithTx(tx).SelectOutcome(ctx, pollID, polls.OutcomeStatus(1)); err != nil {
+			return err
+		}
+
+		betRepo := repos.bets.WithTx(tx)
+		if err := betRepo.SettleBetsByPollId(ctx, pollID, 1); err != nil {
+			return err
+		}
+		winningBet, err := betRepo.GetByPollIdAndUserId(ctx, pollID, "winner")
+		if err != nil {
+			return err
+		}
+		winningBet.Payout = 20
+		if err := betRepo.UpdateBet(ctx, winningBet); err != nil {
+			return err
+		}
+
+		if err := walletService.WithTx(tx).Credit(ctx, testGuildID, "winner", 20, wallet.Reason{Kind: wallet.Payout, PollID: pollID}); err != nil {
+			return err
+		}
+
+		return failure
+	})
+}
+
+func saveSettlementFixture(t *testing.T, repos unitOfWorkRepos) string {
+	t.Helper()
+
+	pollService := polls.NewService(repos.polls)
+	poll, err := pollService.CreatePoll(t.Context(), "guild", "", "Who wins the final?", []string{"Red", "Blue"}, time.Time{}, "")
+	if err != nil {
+		t.Fatalf("Failed to create poll: %v", err)
+	}
+	if err := pollService.ClosePoll(t.Context(), poll.GetID()); err != nil {
+		t.Fatalf("Failed to close poll: %v", err)
+	}
+
+	for _, saved := range []*bet{
+		{PollID: poll.GetID(), UserID: "winner", SelectedOptionIndex: 1, BetStatus: Pending, Stake: 10},
+		{PollID: poll.GetID(), UserID: "loser", SelectedOptionIndex: 0, BetStatus: Pending, Stake: 10},
+	} {
+		if err := repos.bets.Save(t.Context(), saved); err != nil {
+			t.Fatalf("Failed to save bet: %v", err)
+		}
+	}
+
+	if _, err := wallet.NewService(repos.wallets, 100).GetWallet(t.Context(), testGuildID, "winner"); err != nil {
+		t.Fatalf("Failed to open wallet: %v", err)
+	}
+
+	return poll.GetID()
+}
+
+func testUnitOfWorkSettlement(t *testing.T, repos unitOfWorkRepos) {
+	pollID := saveSettlementFixture(t, repos)
+
+	if err := settleInUnitOfWork(t.Context(), repos, pollID, nil); err != nil {
+		t.Fatalf("Do() returned an unexpected error: %v", err)
+	}
+
+	poll, err := repos.polls.GetById(t.Context(), pollID)
+	if err != nil {
+		t.Fatalf("GetById() returned an unexpected error: %v", err)
+	}
+	if poll.Outcome != polls.OutcomeStatus(1) {
+		t.Errorf("Expected outcome 1, but got %v", poll.Outcome)
+	}
+
+	winningBet, err := repos.bets.GetByPollIdAndUserId(t.Context(), pollID, "winner")
+	if err != nil {
+		t.Fatalf("GetByPollIdAndUserId() returned an unexpected error: %v", err)
+	}
+	if winningBet.BetStatus != Won || winningBet.Payout != 20 {
+		t.Errorf("Expected the winning bet to be won with a payout of 20, but got %s with %d", winningBet.BetStatus, winningBet.Payout)
+	}
+
+	winnerWallet, err := repos.wallets.GetByUserID(t.Context(), testGuildID, "winner")
+	if err != nil {
+		t.Fatalf("GetByUserID() returned an unexpected error: %v", err)
+	}
+	if winnerWallet.Balance != 120 {
+		t.Errorf("Expected the winner to hold 120 points, but got %d", winnerWallet.Balance)
+	}
+}
+
+func testUnitOfWorkFailedSettlement(t *testing.T, repos unitOfWorkRepos) {
+	pollID := saveSettlementFixture(t, repos)
+
+	failure := errors.New("something went wrong")
+	if err := settleInUnitOfWork(t.Context(), repos, pollID, failure); !errors.Is(err, failure) {
+		t.Fatalf("Expected Do() to return the error of the unit of work, but got %v", err)
+	}
+
+	poll, err := repos.polls.GetById(t.Context(), pollID)
+	if err != nil {
+		t.Fatalf("GetById() returned an unexpected error: %v", err)
+	}
+	if poll.Outcome != polls.Pending {
+		t.Errorf("Expected the outcome to still be pending, but got %v", poll.Outcome)
+	}
+
+	for _, userID := range []string{"winner", "loser"} {
+		bet, err := repos.bets.GetByPollIdAndUserId(t.Context(), pollID, userID)
+		if err != nil {
+			t.Fatalf("GetByPollIdAndUserId() returned an unexpected error: %v", err)
+		}
+		if bet.BetStatus != Pending || bet.Payout != 0 {
+			t.Errorf("Expected the bet of %s to still be pending, but got %s with payout %d", userID, bet.BetStatus, bet.Payout)
+		}
+	}
+
+	winnerWallet, err := repos.wallets.GetByUserID(t.Context(), testGuildID, "winner")
+	if err != nil {
+		t.Fatalf("GetByUserID() returned an unexpected error: %v", err)
+	}
+	if winnerWallet.Balance != 100 {
+		t.Errorf("Expected the winner to still hold 100 points, but got %d", winnerWallet.Balance)
+	}
+	if entries, _ := repos.wallets.GetEntriesByPollID(t.Context(), pollID); len(entries) != 0 {
+		t.Errorf("Expected the payout to be off the ledger, but got %+v", entries)
+	}
+}
+
+func testCancelledContext(t *testing.T, repo BetRepository) {
+	ctx, cancel := context.WithCancel(t.Context())
+	cancel()
+
+	bet := &bet{PollID: "poll123", UserID: "user456", BetStatus: Pending, Stake: 25}
+	if err := repo.Save(ctx, bet); !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected Save() to return '%v', but got '%v'", context.Canceled, err)
+	}
+	if _, err := repo.GetByPollIdAndUserId(t.Context(), bet.PollID, bet.UserID); !errors.Is(err, ErrBetNotFound) {
+		t.Errorf("Expected the bet not to be saved with a cancelled context, but got '%v'", err)
+	}
+	if _, err := repo.GetBetsByPollId(ctx, bet.PollID); !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected GetBetsByPollId() to return '%v', but got '%v'", context.Canceled, err)
+	}
 }
@@ -1,40 +1,73 @@
 package bets
 
 import (
-	"errors"
+	"context"
 	"fmt"
+	"time"
 
 	"betting-discord-bot/internal/polls"
+	"betting-discord-bot/internal/storage"
+	"betting-discord-bot/internal/wallet"
 )
 
 type service struct {
-	pollService polls.PollService
-	betRepo     BetRepository
+	pollService   polls.PollService
+	betRepo       BetRepository
+	walletService wallet.WalletService
+	calculator    PayoutCalculator
+	unitOfWork    storage.UnitOfWork
 }
 
-func NewService(pollService polls.PollService, betRepo BetRepository) BetService {
+// NewService returns a bet service that places, settles and voids bets together
+// with the polls and wallets they touch in a single unit of work.
+func NewService(pollService polls.PollService, betRepo BetRepository, walletService wallet.WalletService, calculator PayoutCalculator, unitOfWork storage.UnitOfWork) BetService {
 	return &service{
-		pollService: pollService,
-		betRepo:     betRepo,
+		pollService:   pollService,
+		betRepo:       betRepo,
+		walletService: walletService,
+		calculator:    calculator,
+		unitOfWork:    unitOfWork,
 	}
 }
 
-func (betService *service) CreateBet(pollID string, userID string, selectedOptionIndex int) (Bet, error) {
-	if selectedOptionIndex < 0 || selectedOptionIndex > 2 {
-		return nil, errors.New("invalid option index")
-	}
+func (betService *service) WithTx(tx *storage.Tx) BetService {
+	return betService.withTx(tx)
+}
 
-	poll, err := betService.pollService.GetPollById(pollID)
-	if err != nil {
-		return nil, err
+func (betService *service) withTx(tx *storage.Tx) *service {
+	// A service may be built without the repositories or services it does not
+	// use, which stay nil.
+	bound := &service{
+		calculator: betService.calculator,
+		unitOfWork: tx,
+	}
+	if betService.pollService != nil {
+		bound.pollService = betService.pollService.WithTx(tx)
+	}
+	if betService.betRepo != nil {
+		bound.betRepo = betService.betRepo.WithTx(tx)
 	}
+	if betService.walletService != nil {
+		bound.walletService = betService.walletService.WithTx(tx)
+	}
+	return bound
+}
 
-	if poll.GetStatus() == polls.Closed {
-		return nil, ErrPollIsClosed
+// inTransaction calls fn with the service bound to a new unit of work, so that
+// everything fn changes is committed or rolled back together.
+func (betService *service) inTransaction(ctx context.Context, fn func(betService *service) error) error {
+	return betService.unitOfWork.Do(ctx, func(tx *storage.Tx) error {
+		return fn(betService.withTx(tx))
+	})
+}
+
+func (betService *service) CreateBet(ctx context.Context, pollID string, userID string, selectedOptionIndex int, stake int64) (Bet, error) {
+	if selectedOptionIndex < 0 {
+		return nil, ErrInvalidOptionIndex
 	}
 
-	if err := checkIfUserAlreadyBetOnPoll(pollID, userID, betService); err != nil {
-		return nil, err
+	if stake < 0 {
+		return nil, ErrInvalidStake
 	}
 
 	bet := &bet{
@@ -42,17 +75,55 @@ func (betService *service) CreateBet(pollID string, userID string, selectedOptio
 		UserID:              userID,
 		SelectedOptionIndex: selectedOptionIndex,
 		BetStatus:           Pending,
+		Stake:               stake,
+		PlacedAt:            time.Now(),
 	}
 
-	if err := betService.betRepo.Save(bet); err != nil {
-		return nil, fmt.Errorf("failed to save bet: %w", err)
+	// The poll is checked in the same unit of work the bet is saved in, so it
+	// cannot close in between. The stake is only taken if the bet is saved.
+	err := betService.inTransaction(ctx, func(betService *service) error {
+		poll, err := betService.pollService.GetPollById(ctx, pollID)
+		if err != nil {
+			return err
+		}
+
+		if selectedOptionIndex >= len(poll.GetOptions()) {
+			return ErrInvalidOptionIndex
+		}
+
+		if poll.GetStatus() == polls.Cancelled {
+			return ErrPollIsCancelled
+		}
+
+		if poll.GetStatus() != polls.Open || polls.DeadlinePassed(poll, time.Now()) {
+			return ErrPollIsClosed
+		}
+
+		if err := checkIfUserAlreadyBetOnPoll(ctx, pollID, userID, betService); err != nil {
+			return err
+		}
+
+		if stake > 0 {
+			if err := betService.walletService.Debit(ctx, poll.GetGuildID(), userID, stake, wallet.Reason{Kind: wallet.Stake, PollID: pollID}); err != nil {
+				return fmt.Errorf("failed to take stake: %w", err)
+			}
+		}
+
+		if err := betService.betRepo.Save(ctx, bet); err != nil {
+			return fmt.Errorf("failed to save bet: %w", err)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
 	}
 
 	return bet, nil
 }
 
-func checkIfUserAlreadyBetOnPoll(pollId string, userId string, s *service) error {
-	bet, err := s.betRepo.GetByPollIdAndUserId(pollId, userId)
+func checkIfUserAlreadyBetOnPoll(ctx context.Context, pollId string, userId string, s *service) error {
+	bet, err := s.betRepo.GetByPollIdAndUserId(ctx, pollId, userId)
 	if err != nil {
 		return nil
 	}
@@ -63,43 +134,314 @@ func checkIfUserAlreadyBetOnPoll(pollId string, userId string, s *service) error
 	return nil
 }
 
-func (betService *service) GetBet(pollID string, userID string) (Bet, error) {
-	if bet, err := betService.betRepo.GetByPollIdAndUserId(pollID, userID); err != nil {
+func (betService *service) GetBet(ctx context.Context, pollID string, userID string) (Bet, error) {
+	if bet, err := betService.betRepo.GetByPollIdAndUserId(ctx, pollID, userID); err != nil {
 		return nil, fmt.Errorf("failed to get bet: %w", err)
 	} else {
 		return bet, nil
 	}
 }
 
-func (betService *service) UpdateBetsByPollId(pollID string) error {
-	poll, err := betService.pollService.GetPollById(pollID)
+func (betService *service) ChangeBet(ctx context.Context, pollID string, userID string, newOptionIndex int) (Bet, error) {
+	if newOptionIndex < 0 {
+		return nil, ErrInvalidOptionIndex
+	}
+
+	var changedBet bet
+	err := betService.inTransaction(ctx, func(betService *service) error {
+		poll, err := betService.getOpenPoll(ctx, pollID)
+		if err != nil {
+			return err
+		}
+
+		if newOptionIndex >= len(poll.GetOptions()) {
+			return ErrInvalidOptionIndex
+		}
+
+		bet, err := betService.betRepo.GetByPollIdAndUserId(ctx, pollID, userID)
+		if err != nil {
+			return fmt.Errorf("failed to get bet: %w", err)
+		}
+
+		if bet.SelectedOptionIndex == newOptionIndex {
+			return ErrBetUnchanged
+		}
+
+		change := BetChange{
+			PollID:              pollID,
+			UserID:              userID,
+			Kind:                Switched,
+			PreviousOptionIndex: bet.SelectedOptionIndex,
+			NewOptionIndex:      newOptionIndex,
+			ChangedAt:           time.Now(),
+		}
+
+		changedBet = *bet
+		changedBet.SelectedOptionIndex = newOptionIndex
+		if err := betService.betRepo.SaveBetChange(ctx, &changedBet, change); err != nil {
+			return fmt.Errorf("failed to save bet change: %w", err)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &changedBet, nil
+}
+
+func (betService *service) WithdrawBet(ctx context.Context, pollID string, userID string) error {
+	// The bet is only withdrawn if its stake is refunded.
+	return betService.inTransaction(ctx, func(betService *service) error {
+		poll, err := betService.getOpenPoll(ctx, pollID)
+		if err != nil {
+			return err
+		}
+
+		bet, err := betService.betRepo.GetByPollIdAndUserId(ctx, pollID, userID)
+		if err != nil {
+			return fmt.Errorf("failed to get bet: %w", err)
+		}
+
+		change := BetChange{
+			PollID:              pollID,
+			UserID:              userID,
+			Kind:                Withdrawn,
+			PreviousOptionIndex: bet.SelectedOptionIndex,
+			NewOptionIndex:      -1,
+			ChangedAt:           time.Now(),
+		}
+
+		if err := betService.betRepo.SaveBetWithdrawal(ctx, bet, change); err != nil {
+			return fmt.Errorf("failed to save bet withdrawal: %w", err)
+		}
+
+		if bet.Stake > 0 {
+			reason := wallet.Reason{Kind: wallet.Refund, PollID: pollID, Memo: "bet withdrawn"}
+			if err := betService.walletService.Credit(ctx, poll.GetGuildID(), userID, bet.Stake, reason); err != nil {
+				return fmt.Errorf("failed to refund stake: %w", err)
+			}
+		}
+
+		return nil
+	})
+}
+
+// getOpenPoll returns the poll if bets on it can still be placed or changed.
+func (betService *service) getOpenPoll(ctx context.Context, pollID string) (polls.Poll, error) {
+	poll, err := betService.pollService.GetPollById(ctx, pollID)
+	if err != nil {
+		return nil, err
+	}
+
+	if poll.GetStatus() != polls.Open || polls.DeadlinePassed(poll, time.Now()) {
+		return nil, ErrPollIsClosed
+	}
+
+	return poll, nil
+}
+
+func (betService *service) GetBetChanges(ctx context.Context, pollID string, userID string) ([]BetChange, error) {
+	changes, err := betService.betRepo.GetBetChanges(ctx, pollID, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get bet changes: %w", err)
+	}
+	return changes, nil
+}
+
+func (betService *service) GetBetChangesByUser(ctx context.Context, userID string) ([]BetChange, error) {
+	changes, err := betService.betRepo.GetBetChangesByUser(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get bet changes: %w", err)
+	}
+	return changes, nil
+}
+
+func (betService *service) UpdateBetsByPollId(ctx context.Context, pollID string) error {
+	return betService.inTransaction(ctx, func(betService *service) error {
+		poll, err := betService.pollService.GetPollById(ctx, pollID)
+		if err != nil {
+			return fmt.Errorf("failed to get poll by ID: %w", err)
+		}
+
+		if poll.GetOutcome() == polls.Pending {
+			return ErrOutcomeNotSelected
+		}
+
+		if err := betService.betRepo.SettleBetsByPollId(ctx, pollID, int(poll.GetOutcome())); err != nil {
+			return fmt.Errorf("failed to settle bets: %w", err)
+		}
+
+		return betService.payOut(ctx, pollID)
+	})
+}
+
+func (betService *service) SettlePoll(ctx context.Context, pollID string, outcome polls.OutcomeStatus) error {
+	// The outcome, the bets and the payouts are saved together, so a failure
+	// part way leaves the poll unsettled rather than half paid out. The poll is
+	// checked in the same unit of work, so that of two selections made at once
+	// the second sees the first rather than overwriting it.
+	return betService.inTransaction(ctx, func(betService *service) error {
+		poll, err := betService.pollService.GetPollById(ctx, pollID)
+		if err != nil {
+			return fmt.Errorf("failed to get poll by ID: %w", err)
+		}
+
+		if poll.GetStatus() == polls.Open {
+			return ErrPollIsOpen
+		}
+
+		if poll.GetStatus() == polls.Cancelled {
+			return ErrPollIsCancelled
+		}
+
+		if outcome < 0 || int(outcome) >= len(poll.GetOptions()) {
+			return ErrInvalidOutcome
+		}
+
+		if poll.GetOutcome() != polls.Pending && poll.GetOutcome() != outcome {
+			return ErrOutcomeAlreadySelected
+		}
+
+		if err := betService.pollService.SelectOutcome(ctx, pollID, outcome); err != nil {
+			return fmt.Errorf("failed to select outcome: %w", err)
+		}
+
+		if err := betService.betRepo.SettleBetsByPollId(ctx, pollID, int(outcome)); err != nil {
+			return fmt.Errorf("failed to settle bets: %w", err)
+		}
+
+		return betService.payOut(ctx, pollID)
+	})
+}
+
+func (betService *service) CorrectOutcome(ctx context.Context, pollID string, newOutcome polls.OutcomeStatus, correctedBy string) (polls.OutcomeCorrection, error) {
+	var correction polls.OutcomeCorrection
+	err := betService.inTransaction(ctx, func(betService *service) error {
+		var err error
+		correction, err = betService.pollService.CorrectOutcome(ctx, pollID, newOutcome, correctedBy)
+		if err != nil {
+			return fmt.Errorf("failed to correct outcome: %w", err)
+		}
+
+		if err := betService.betRepo.SettleBetsByPollId(ctx, pollID, int(newOutcome)); err != nil {
+			return fmt.Errorf("failed to re-settle bets: %w", err)
+		}
+
+		return betService.payOut(ctx, pollID)
+	})
+	if err != nil {
+		return polls.OutcomeCorrection{}, err
+	}
+
+	return correction, nil
+}
+
+func (betService *service) VoidPoll(ctx context.Context, pollID string) error {
+	return betService.inTransaction(ctx, func(betService *service) error {
+		poll, err := betService.pollService.GetPollById(ctx, pollID)
+		if err != nil {
+			return fmt.Errorf("failed to get poll by ID: %w", err)
+		}
+
+		if poll.GetStatus() != polls.Cancelled {
+			if err := betService.pollService.CancelPoll(ctx, pollID); err != nil {
+				return fmt.Errorf("failed to cancel poll: %w", err)
+			}
+		}
+
+		if err := betService.betRepo.VoidBetsByPollId(ctx, pollID); err != nil {
+			return fmt.Errorf("failed to void bets: %w", err)
+		}
+
+		return betService.payOut(ctx, pollID)
+	})
+}
+
+// payOut brings each wallet in line with what its settled bet is owed. Only the
+// difference from the previous payout is credited or clawed back, so paying out
+// again after a correction never pays anyone twice. It must run in the same
+// unit of work as the change to the bets.
+func (betService *service) payOut(ctx context.Context, pollID string) error {
+	poll, err := betService.pollService.GetPollById(ctx, pollID)
 	if err != nil {
 		return fmt.Errorf("failed to get poll by ID: %w", err)
 	}
 
-	betList, err := betService.betRepo.GetBetsByPollId(pollID)
+	pollBets, err := betService.betRepo.GetBetsByPollId(ctx, pollID)
 	if err != nil {
-		return fmt.Errorf("failed to get bets for poll: %w", err)
+		return fmt.Errorf("failed to get bets by poll ID: %w", err)
+	}
+
+	wagers := wagersOf(pollBets)
+
+	var settlement Settlement
+	reason := wallet.Reason{PollID: pollID}
+	switch {
+	case poll.GetStatus() == polls.Cancelled:
+		settlement = betService.calculator.Refund(wagers)
+		reason.Kind = wallet.Refund
+	case poll.GetOutcome() != polls.Pending:
+		settlement = betService.calculator.Settle(wagers, int(poll.GetOutcome()))
+		reason.Kind = wallet.Payout
+	default:
+		return ErrOutcomeNotSelected
 	}
 
-	pollResult := int(poll.GetOutcome())
-	for _, bet := range betList {
-		if bet.SelectedOptionIndex == pollResult {
-			bet.BetStatus = Won
+	for _, bet := range pollBets {
+		owed := settlement.Payouts[bet.UserID]
+		difference := owed - bet.Payout
+		if difference == 0 {
+			continue
+		}
+
+		if difference > 0 {
+			err = betService.walletService.Credit(ctx, poll.GetGuildID(), bet.UserID, difference, reason)
 		} else {
-			bet.BetStatus = Lost
+			err = betService.walletService.Clawback(ctx, poll.GetGuildID(), bet.UserID, -difference, reason)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to pay out bet of user %s: %w", bet.UserID, err)
 		}
 
-		if err := betService.betRepo.UpdateBet(bet); err != nil {
-			return fmt.Errorf("failed to update bet: %w", err)
+		bet.Payout = owed
+		if err := betService.betRepo.UpdateBet(ctx, bet); err != nil {
+			return fmt.Errorf("failed to record payout: %w", err)
 		}
 	}
 
 	return nil
 }
 
-func (betService *service) GetBetsFromUser(userID string) ([]Bet, error) {
-	userBets, err := betService.betRepo.GetBetsFromUser(userID)
+func wagersOf(pollBets []*bet) []Wager {
+	wagers := make([]Wager, len(pollBets))
+	for index, bet := range pollBets {
+		wagers[index] = Wager{
+			UserID:      bet.UserID,
+			OptionIndex: bet.SelectedOptionIndex,
+			Stake:       bet.Stake,
+		}
+	}
+	return wagers
+}
+
+func (betService *service) GetImpliedOdds(ctx context.Context, pollID string) ([]OptionOdds, error) {
+	poll, err := betService.pollService.GetPollById(ctx, pollID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get poll by ID: %w", err)
+	}
+
+	pollBets, err := betService.betRepo.GetBetsByPollId(ctx, pollID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get bets by poll ID: %w", err)
+	}
+
+	return betService.calculator.ImpliedOdds(wagersOf(pollBets), len(poll.GetOptions())), nil
+}
+
+func (betService *service) GetBetsFromUser(ctx context.Context, userID string) ([]Bet, error) {
+	userBets, err := betService.betRepo.GetBetsFromUser(ctx, userID)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get bets for user: %w", err)
 	}
@@ -112,4 +454,63 @@ func (betService *service) GetBetsFromUser(userID string) ([]Bet, error) {
 	return bets, nil
 }
 
+func (betService *service) GetBetsByPollId(ctx context.Context, pollID string) ([]Bet, error) {
+	pollBets, err := betService.betRepo.GetBetsByPollId(ctx, pollID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get bets by poll ID: %w", err)
+	}
+
+	bets := make([]Bet, len(pollBets))
+	for index, bet := range pollBets {
+		bets[index] = bet
+	}
+
+	return bets, nil
+}
+
+func (betService *service) GetLeaderboard(ctx context.Context, query LeaderboardQuery) (Leaderboard, error) {
+	if query.Limit <= 0 || query.Offset < 0 || query.MinBets < 0 {
+		return Leaderboard{}, ErrInvalidLeaderboardQuery
+	}
+	if query.OrderBy != ByWins && query.OrderBy != ByWinRate && query.OrderBy != ByPoints {
+		return Leaderboard{}, ErrInvalidLeaderboardQuery
+	}
+
+	leaderboard, err := betService.betRepo.GetLeaderboard(ctx, query)
+	if err != nil {
+		return Leaderboard{}, fmt.Errorf("failed to get leaderboard: %w", err)
+	}
+
+	return leaderboard, nil
+}
+
+func (betService *service) GetBetHistory(ctx context.Context, query BetHistoryQuery) (BetHistory, error) {
+	if query.Limit <= 0 || query.Offset < 0 {
+		return BetHistory{}, ErrInvalidBetHistoryQuery
+	}
+	if query.Filter != AllBets && query.Filter != OpenBets && query.Filter != SettledBets {
+		return BetHistory{}, ErrInvalidBetHistoryQuery
+	}
+
+	history, err := betService.betRepo.GetBetHistory(ctx, query)
+	if err != nil {
+		return BetHistory{}, fmt.Errorf("failed to get bet history: %w", err)
+	}
+
+	return history, nil
+}
+
+func (betService *service) GetBetCounts(ctx context.Context, pollIDs []string) (map[string]int, error) {
+	if len(pollIDs) == 0 {
+		return map[string]int{}, nil
+	}
+
+	counts, err := betService.betRepo.CountBetsByPollIDs(ctx, pollIDs)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count bets: %w", err)
+	}
+
+	return counts, nil
+}
+
 var _ BetService = (*service)(nil)
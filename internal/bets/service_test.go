@@ -1,20 +1,27 @@
 package bets
 
 import (
+	"context"
 	"errors"
+	"sync"
 	"testing"
+	"time"
 
 	"betting-discord-bot/internal/polls"
+	"betting-discord-bot/internal/storage"
+	"betting-discord-bot/internal/wallet"
 )
 
+const testGuildID = "guild"
+
 func TestCreateBet(t *testing.T) {
 	t.Parallel()
 	pollMemoryRepo := polls.NewMemoryRepository()
 	pollService := polls.NewService(pollMemoryRepo)
 	betRepo := NewMemoryRepository()
-	betService := NewService(pollService, betRepo)
+	betService := NewService(pollService, betRepo, nil, PayoutCalculator{}, storage.NewMemoryUnitOfWork())
 
-	poll, err := pollService.CreatePoll("Test Poll", []string{"Option 1", "Option 2"})
+	poll, err := pollService.CreatePoll(t.Context(), testGuildID, "", "Test Poll", []string{"Option 1", "Option 2"}, time.Time{}, "")
 	if err != nil {
 		t.Fatal("Failed to create poll:", err)
 	}
@@ -22,7 +29,7 @@ func TestCreateBet(t *testing.T) {
 	pollId := poll.GetID()
 	userId := "12345"
 	selectedOptionIndex := 0
-	bet, err1 := betService.CreateBet(pollId, userId, selectedOptionIndex)
+	bet, err1 := betService.CreateBet(t.Context(), pollId, userId, selectedOptionIndex, 0)
 
 	if err1 != nil {
 		t.Fatal("CreateBet returned an unexpected error:", err1)
@@ -45,11 +52,11 @@ func TestInvalidOption(t *testing.T) {
 	t.Parallel()
 	pollMemoryRepo := polls.NewMemoryRepository()
 	pollService := polls.NewService(pollMemoryRepo)
-	betService := NewService(pollService, nil)
+	betService := NewService(pollService, nil, nil, PayoutCalculator{}, storage.NewMemoryUnitOfWork())
 	pollId := "12345"
 	userId := "12345"
 	selectedOptionIndex := -1 // Invalid index
-	_, err := betService.CreateBet(pollId, userId, selectedOptionIndex)
+	_, err := betService.CreateBet(t.Context(), pollId, userId, selectedOptionIndex, 0)
 
 	if err == nil {
 		t.Fatal("Expected CreateBet to return an error for invalid option index, but got nil")
@@ -60,24 +67,45 @@ func TestInvalidOption(t *testing.T) {
 	}
 }
 
+func TestBetOnPollWithManyOptions(t *testing.T) {
+	t.Parallel()
+	pollMemoryRepo := polls.NewMemoryRepository()
+	pollService := polls.NewService(pollMemoryRepo)
+	betService := NewService(pollService, NewMemoryRepository(), nil, PayoutCalculator{}, storage.NewMemoryUnitOfWork())
+
+	poll, err := pollService.CreatePoll(t.Context(), testGuildID, "", "Test Poll", []string{"Option 1", "Option 2", "Option 3"}, time.Time{}, "")
+	if err != nil {
+		t.Fatal("Failed to create poll:", err)
+	}
+
+	if _, err := betService.CreateBet(t.Context(), poll.GetID(), "12345", 2, 0); err != nil {
+		t.Fatal("CreateBet returned an unexpected error:", err)
+	}
+
+	_, err = betService.CreateBet(t.Context(), poll.GetID(), "67890", 3, 0)
+	if !errors.Is(err, ErrInvalidOptionIndex) {
+		t.Errorf("Expected error '%v', but got '%v'", ErrInvalidOptionIndex, err)
+	}
+}
+
 func TestPreventingMultipleBetsPerPoll(t *testing.T) {
 	t.Parallel()
 	pollMemoryRepo := polls.NewMemoryRepository()
 	pollService := polls.NewService(pollMemoryRepo)
 	betRepo := NewMemoryRepository()
-	betService := NewService(pollService, betRepo)
+	betService := NewService(pollService, betRepo, nil, PayoutCalculator{}, storage.NewMemoryUnitOfWork())
 
-	poll, _ := pollService.CreatePoll("Test Poll", []string{"Option 1", "Option 2"})
+	poll, _ := pollService.CreatePoll(t.Context(), testGuildID, "", "Test Poll", []string{"Option 1", "Option 2"}, time.Time{}, "")
 
 	// Create the first bet for the poll
 	pollId := poll.GetID()
 	userId := "12345"
 	selectedOptionIndex := 0
 
-	_, _ = betService.CreateBet(pollId, userId, selectedOptionIndex)
+	_, _ = betService.CreateBet(t.Context(), pollId, userId, selectedOptionIndex, 0)
 
 	// Attempt to create a second bet for the same poll
-	_, err := betService.CreateBet(pollId, userId, selectedOptionIndex)
+	_, err := betService.CreateBet(t.Context(), pollId, userId, selectedOptionIndex, 0)
 
 	if err == nil {
 		t.Fatal("Expected an error when creating a second bet for the same poll, but got nil")
@@ -94,19 +122,19 @@ func TestCannotBetOnClosedPoll(t *testing.T) {
 	t.Parallel()
 	pollMemoryRepo := polls.NewMemoryRepository()
 	pollService := polls.NewService(pollMemoryRepo)
-	betService := NewService(pollService, nil)
+	betService := NewService(pollService, nil, nil, PayoutCalculator{}, storage.NewMemoryUnitOfWork())
 
-	poll, err := pollService.CreatePoll("Test Poll", []string{"Option 1", "Option 2"})
+	poll, err := pollService.CreatePoll(t.Context(), testGuildID, "", "Test Poll", []string{"Option 1", "Option 2"}, time.Time{}, "")
 	if err != nil {
 		t.Fatal("Failed to create poll:", err)
 	}
 
-	if err := pollService.ClosePoll(poll.GetID()); err != nil {
+	if err := pollService.ClosePoll(t.Context(), poll.GetID()); err != nil {
 		t.Fatal("Failed to close poll:", err)
 	}
 
 	// Attempt to create a bet on a closed poll
-	_, err = betService.CreateBet(poll.GetID(), "12345", 0)
+	_, err = betService.CreateBet(t.Context(), poll.GetID(), "12345", 0, 0)
 	if err == nil {
 		t.Fatal("Expected an error when betting on a closed poll, but got nil")
 	}
@@ -124,8 +152,8 @@ func TestGetBetOutcome(t *testing.T) {
 	pollMemoryRepo := polls.NewMemoryRepository()
 	pollService := polls.NewService(pollMemoryRepo)
 	betRepo := NewMemoryRepository()
-	betService := NewService(pollService, betRepo)
-	poll, err := pollService.CreatePoll("Test Poll", []string{"Option 1", "Option 2"})
+	betService := NewService(pollService, betRepo, nil, PayoutCalculator{}, storage.NewMemoryUnitOfWork())
+	poll, err := pollService.CreatePoll(t.Context(), testGuildID, "", "Test Poll", []string{"Option 1", "Option 2"}, time.Time{}, "")
 	if err != nil {
 		t.Fatal("Failed to create poll:", err)
 	}
@@ -133,7 +161,7 @@ func TestGetBetOutcome(t *testing.T) {
 	pollId := poll.GetID()
 	userId := "12345"
 	selectedOptionIndex := 0
-	bet, err1 := betService.CreateBet(pollId, userId, selectedOptionIndex)
+	bet, err1 := betService.CreateBet(t.Context(), pollId, userId, selectedOptionIndex, 0)
 
 	if err1 != nil {
 		t.Fatal("CreateBet returned an unexpected error:", err1)
@@ -143,19 +171,19 @@ func TestGetBetOutcome(t *testing.T) {
 		t.Fatalf("Expected bet status to be 'PENDING', but got '%s'", bet.GetBetStatus())
 	}
 
-	if err := pollService.ClosePoll(poll.GetID()); err != nil {
+	if err := pollService.ClosePoll(t.Context(), poll.GetID()); err != nil {
 		t.Fatal("ClosePoll returned an unexpected error:", err)
 	}
 
-	err = pollService.SelectOutcome(poll.GetID(), polls.OutcomeStatus(selectedOptionIndex))
+	err = pollService.SelectOutcome(t.Context(), poll.GetID(), polls.OutcomeStatus(selectedOptionIndex))
 	if err != nil {
 		t.Fatal("SelectOutcome returned an unexpected error:", err)
 	}
 
-	if err := betService.UpdateBetsByPollId(poll.GetID()); err != nil {
+	if err := betService.UpdateBetsByPollId(t.Context(), poll.GetID()); err != nil {
 		t.Fatal("UpdateBetsByPollId returned an unexpected error:", err)
 	}
-	bet, err2 := betService.GetBet(pollId, userId)
+	bet, err2 := betService.GetBet(t.Context(), pollId, userId)
 
 	if err2 != nil {
 		t.Fatal("GetBet returned an unexpected error:", err2)
@@ -175,20 +203,20 @@ func TestGettingUserBets(t *testing.T) {
 	pollMemoryRepo := polls.NewMemoryRepository()
 	pollService := polls.NewService(pollMemoryRepo)
 	betRepo := NewMemoryRepository()
-	betService := NewService(pollService, betRepo)
+	betService := NewService(pollService, betRepo, nil, PayoutCalculator{}, storage.NewMemoryUnitOfWork())
 
-	poll, createPollErr := pollService.CreatePoll("Test Poll", []string{"Option 1", "Option 2"})
+	poll, createPollErr := pollService.CreatePoll(t.Context(), testGuildID, "", "Test Poll", []string{"Option 1", "Option 2"}, time.Time{}, "")
 	if createPollErr != nil {
 		t.Fatal("Failed to create poll:", createPollErr)
 	}
 
 	userID := "12345"
-	bet, createBetErr := betService.CreateBet(poll.GetID(), userID, 0)
+	bet, createBetErr := betService.CreateBet(t.Context(), poll.GetID(), userID, 0, 0)
 	if createBetErr != nil {
 		t.Fatal("Failed to create bet:", createBetErr)
 	}
 
-	bets, getBetsErr := betService.GetBetsFromUser(userID)
+	bets, getBetsErr := betService.GetBetsFromUser(t.Context(), userID)
 	if getBetsErr != nil {
 		t.Fatal("Failed to get bets from user:", getBetsErr)
 	}
@@ -201,3 +229,903 @@ func TestGettingUserBets(t *testing.T) {
 		t.Errorf("Expected bet %v, but got %v", bet, bets[0])
 	}
 }
+
+func TestGettingPollBets(t *testing.T) {
+	t.Parallel()
+	pollMemoryRepo := polls.NewMemoryRepository()
+	pollService := polls.NewService(pollMemoryRepo)
+	betService := NewService(pollService, NewMemoryRepository(), nil, PayoutCalculator{}, storage.NewMemoryUnitOfWork())
+
+	poll, createPollErr := pollService.CreatePoll(t.Context(), testGuildID, "", "Test Poll", []string{"Option 1", "Option 2"}, time.Time{}, "")
+	if createPollErr != nil {
+		t.Fatal("Failed to create poll:", createPollErr)
+	}
+	otherPoll, createPollErr := pollService.CreatePoll(t.Context(), testGuildID, "", "Other Poll", []string{"Option 1", "Option 2"}, time.Time{}, "")
+	if createPollErr != nil {
+		t.Fatal("Failed to create poll:", createPollErr)
+	}
+
+	for _, userID := range []string{"alice", "bob"} {
+		if _, err := betService.CreateBet(t.Context(), poll.GetID(), userID, 1, 0); err != nil {
+			t.Fatal("Failed to create bet:", err)
+		}
+	}
+	if _, err := betService.CreateBet(t.Context(), otherPoll.GetID(), "carol", 0, 0); err != nil {
+		t.Fatal("Failed to create bet:", err)
+	}
+
+	pollBets, err := betService.GetBetsByPollId(t.Context(), poll.GetID())
+	if err != nil {
+		t.Fatal("GetBetsByPollId returned an unexpected error:", err)
+	}
+
+	if len(pollBets) != 2 {
+		t.Fatalf("Expected 2 bets on the poll, but got %d", len(pollBets))
+	}
+	for _, pollBet := range pollBets {
+		if pollBet.GetBetKey().PollID != poll.GetID() {
+			t.Errorf("Expected only bets on poll %s, but got a bet on %s", poll.GetID(), pollBet.GetBetKey().PollID)
+		}
+	}
+}
+
+func TestSettlePoll(t *testing.T) {
+	t.Parallel()
+	pollMemoryRepo := polls.NewMemoryRepository()
+	pollService := polls.NewService(pollMemoryRepo)
+	betRepo := NewMemoryRepository()
+	betService := NewService(pollService, betRepo, nil, PayoutCalculator{}, storage.NewMemoryUnitOfWork())
+
+	poll, err := pollService.CreatePoll(t.Context(), testGuildID, "", "Test Poll", []string{"Option 1", "Option 2"}, time.Time{}, "")
+	if err != nil {
+		t.Fatal("Failed to create poll:", err)
+	}
+
+	if _, err := betService.CreateBet(t.Context(), poll.GetID(), "winner", 1, 0); err != nil {
+		t.Fatal("Failed to create bet:", err)
+	}
+	if _, err := betService.CreateBet(t.Context(), poll.GetID(), "loser", 0, 0); err != nil {
+		t.Fatal("Failed to create bet:", err)
+	}
+
+	if err := pollService.ClosePoll(t.Context(), poll.GetID()); err != nil {
+		t.Fatal("Failed to close poll:", err)
+	}
+
+	// Settling twice must leave the bets in the same state.
+	for range 2 {
+		if err := betService.SettlePoll(t.Context(), poll.GetID(), polls.OutcomeStatus(1)); err != nil {
+			t.Fatal("SettlePoll returned an unexpected error:", err)
+		}
+
+		settledPoll, err := pollService.GetPollById(t.Context(), poll.GetID())
+		if err != nil {
+			t.Fatal("GetPollById returned an unexpected error:", err)
+		}
+		if settledPoll.GetOutcome() != polls.OutcomeStatus(1) {
+			t.Errorf("Expected poll outcome %d, but got %d", polls.OutcomeStatus(1), settledPoll.GetOutcome())
+		}
+
+		winningBet, err := betService.GetBet(t.Context(), poll.GetID(), "winner")
+		if err != nil {
+			t.Fatal("GetBet returned an unexpected error:", err)
+		}
+		if winningBet.GetBetStatus() != Won {
+			t.Errorf("Expected bet status to be 'WON', but got '%s'", winningBet.GetBetStatus())
+		}
+
+		losingBet, err := betService.GetBet(t.Context(), poll.GetID(), "loser")
+		if err != nil {
+			t.Fatal("GetBet returned an unexpected error:", err)
+		}
+		if losingBet.GetBetStatus() != Lost {
+			t.Errorf("Expected bet status to be 'LOST', but got '%s'", losingBet.GetBetStatus())
+		}
+	}
+}
+
+func TestCannotSettleOpenPoll(t *testing.T) {
+	t.Parallel()
+	pollMemoryRepo := polls.NewMemoryRepository()
+	pollService := polls.NewService(pollMemoryRepo)
+	betService := NewService(pollService, NewMemoryRepository(), nil, PayoutCalculator{}, storage.NewMemoryUnitOfWork())
+
+	poll, err := pollService.CreatePoll(t.Context(), testGuildID, "", "Test Poll", []string{"Option 1", "Option 2"}, time.Time{}, "")
+	if err != nil {
+		t.Fatal("Failed to create poll:", err)
+	}
+
+	err = betService.SettlePoll(t.Context(), poll.GetID(), polls.OutcomeStatus(0))
+	if !errors.Is(err, ErrPollIsOpen) {
+		t.Errorf("Expected error '%v', but got '%v'", ErrPollIsOpen, err)
+	}
+}
+
+func TestCannotSettleWithInvalidOutcome(t *testing.T) {
+	t.Parallel()
+	pollMemoryRepo := polls.NewMemoryRepository()
+	pollService := polls.NewService(pollMemoryRepo)
+	betService := NewService(pollService, NewMemoryRepository(), nil, PayoutCalculator{}, storage.NewMemoryUnitOfWork())
+
+	poll, err := pollService.CreatePoll(t.Context(), testGuildID, "", "Test Poll", []string{"Option 1", "Option 2"}, time.Time{}, "")
+	if err != nil {
+		t.Fatal("Failed to create poll:", err)
+	}
+	if err := pollService.ClosePoll(t.Context(), poll.GetID()); err != nil {
+		t.Fatal("Failed to close poll:", err)
+	}
+
+	err = betService.SettlePoll(t.Context(), poll.GetID(), polls.Pending)
+	if !errors.Is(err, ErrInvalidOutcome) {
+		t.Errorf("Expected error '%v', but got '%v'", ErrInvalidOutcome, err)
+	}
+}
+
+func TestCannotBetAfterDeadline(t *testing.T) {
+	t.Parallel()
+	pollMemoryRepo := polls.NewMemoryRepository()
+	pollService := polls.NewService(pollMemoryRepo)
+	betService := NewService(pollService, NewMemoryRepository(), nil, PayoutCalculator{}, storage.NewMemoryUnitOfWork())
+
+	poll, err := pollService.CreatePoll(t.Context(), testGuildID, "", "Test Poll", []string{"Option 1", "Option 2"}, time.Now().Add(20*time.Millisecond), "")
+	if err != nil {
+		t.Fatal("Failed to create poll:", err)
+	}
+
+	time.Sleep(30 * time.Millisecond)
+
+	// The poll has not been closed yet, but its deadline has passed.
+	_, err = betService.CreateBet(t.Context(), poll.GetID(), "12345", 0, 0)
+	if !errors.Is(err, ErrPollIsClosed) {
+		t.Errorf("Expected error '%v', but got '%v'", ErrPollIsClosed, err)
+	}
+}
+
+func TestVoidPoll(t *testing.T) {
+	t.Parallel()
+	pollMemoryRepo := polls.NewMemoryRepository()
+	pollService := polls.NewService(pollMemoryRepo)
+	betService := NewService(pollService, NewMemoryRepository(), nil, PayoutCalculator{}, storage.NewMemoryUnitOfWork())
+
+	poll, err := pollService.CreatePoll(t.Context(), testGuildID, "", "Test Poll", []string{"Option 1", "Option 2"}, time.Time{}, "")
+	if err != nil {
+		t.Fatal("Failed to create poll:", err)
+	}
+	for index, userID := range []string{"user1", "user2"} {
+		if _, err := betService.CreateBet(t.Context(), poll.GetID(), userID, index, 0); err != nil {
+			t.Fatal("Failed to create bet:", err)
+		}
+	}
+
+	// Voiding twice must leave the bets in the same state.
+	for range 2 {
+		if err := betService.VoidPoll(t.Context(), poll.GetID()); err != nil {
+			t.Fatal("VoidPoll returned an unexpected error:", err)
+		}
+
+		cancelledPoll, err := pollService.GetPollById(t.Context(), poll.GetID())
+		if err != nil {
+			t.Fatal("GetPollById returned an unexpected error:", err)
+		}
+		if cancelledPoll.GetStatus() != polls.Cancelled {
+			t.Errorf("Expected poll status %v, but got %v", polls.Cancelled, cancelledPoll.GetStatus())
+		}
+
+		for _, userID := range []string{"user1", "user2"} {
+			bet, err := betService.GetBet(t.Context(), poll.GetID(), userID)
+			if err != nil {
+				t.Fatal("GetBet returned an unexpected error:", err)
+			}
+			if bet.GetBetStatus() != Void {
+				t.Errorf("Expected bet status to be 'VOID', but got '%s'", bet.GetBetStatus())
+			}
+		}
+	}
+
+	if _, err := betService.CreateBet(t.Context(), poll.GetID(), "user3", 0, 0); !errors.Is(err, ErrPollIsCancelled) {
+		t.Errorf("Expected error '%v', but got '%v'", ErrPollIsCancelled, err)
+	}
+
+	if err := betService.SettlePoll(t.Context(), poll.GetID(), polls.OutcomeStatus(0)); !errors.Is(err, ErrPollIsCancelled) {
+		t.Errorf("Expected error '%v', but got '%v'", ErrPollIsCancelled, err)
+	}
+}
+
+func TestCorrectOutcome(t *testing.T) {
+	t.Parallel()
+	pollMemoryRepo := polls.NewMemoryRepository()
+	pollService := polls.NewService(pollMemoryRepo)
+	betService := NewService(pollService, NewMemoryRepository(), nil, PayoutCalculator{}, storage.NewMemoryUnitOfWork())
+
+	poll, err := pollService.CreatePoll(t.Context(), testGuildID, "", "Test Poll", []string{"Option 1", "Option 2"}, time.Time{}, "")
+	if err != nil {
+		t.Fatal("Failed to create poll:", err)
+	}
+	for index, userID := range []string{"user1", "user2"} {
+		if _, err := betService.CreateBet(t.Context(), poll.GetID(), userID, index, 0); err != nil {
+			t.Fatal("Failed to create bet:", err)
+		}
+	}
+	if err := pollService.ClosePoll(t.Context(), poll.GetID()); err != nil {
+		t.Fatal("Failed to close poll:", err)
+	}
+	if err := betService.SettlePoll(t.Context(), poll.GetID(), polls.OutcomeStatus(0)); err != nil {
+		t.Fatal("SettlePoll returned an unexpected error:", err)
+	}
+
+	// Selecting a different outcome must go through a correction.
+	if err := betService.SettlePoll(t.Context(), poll.GetID(), polls.OutcomeStatus(1)); !errors.Is(err, ErrOutcomeAlreadySelected) {
+		t.Errorf("Expected error '%v', but got '%v'", ErrOutcomeAlreadySelected, err)
+	}
+
+	correction, err := betService.CorrectOutcome(t.Context(), poll.GetID(), polls.OutcomeStatus(1), "moderator")
+	if err != nil {
+		t.Fatal("CorrectOutcome returned an unexpected error:", err)
+	}
+	if correction.PreviousOutcome != polls.OutcomeStatus(0) {
+		t.Errorf("Expected previous outcome 0, but got %d", correction.PreviousOutcome)
+	}
+
+	expectedStatuses := map[string]BetStatus{"user1": Lost, "user2": Won}
+	for userID, expectedStatus := range expectedStatuses {
+		bet, err := betService.GetBet(t.Context(), poll.GetID(), userID)
+		if err != nil {
+			t.Fatal("GetBet returned an unexpected error:", err)
+		}
+		if bet.GetBetStatus() != expectedStatus {
+			t.Errorf("Expected bet status of %s to be '%s', but got '%s'", userID, expectedStatus, bet.GetBetStatus())
+		}
+	}
+}
+
+func newStakedBetService(startingBalance int64) (polls.PollService, BetService, wallet.WalletService) {
+	pollService := polls.NewService(polls.NewMemoryRepository())
+	walletService := wallet.NewService(wallet.NewMemoryRepository(), startingBalance)
+	betService := NewService(pollService, NewMemoryRepository(), walletService, PayoutCalculator{}, storage.NewMemoryUnitOfWork())
+	return pollService, betService, walletService
+}
+
+func assertBalance(t *testing.T, walletService wallet.WalletService, userID string, expected int64) {
+	t.Helper()
+	userWallet, err := walletService.GetWallet(t.Context(), testGuildID, userID)
+	if err != nil {
+		t.Fatal("GetWallet returned an unexpected error:", err)
+	}
+	if userWallet.GetBalance() != expected {
+		t.Errorf("Expected %s to have a balance of %d, but got %d", userID, expected, userWallet.GetBalance())
+	}
+}
+
+func TestCreateBetTakesStake(t *testing.T) {
+	t.Parallel()
+	pollService, betService, walletService := newStakedBetService(100)
+
+	poll, err := pollService.CreatePoll(t.Context(), testGuildID, "", "Test Poll", []string{"Option 1", "Option 2"}, time.Time{}, "")
+	if err != nil {
+		t.Fatal("Failed to create poll:", err)
+	}
+
+	bet, err := betService.CreateBet(t.Context(), poll.GetID(), "12345", 0, 40)
+	if err != nil {
+		t.Fatal("CreateBet returned an unexpected error:", err)
+	}
+
+	if bet.GetStake() != 40 {
+		t.Errorf("Expected stake 40, but got %d", bet.GetStake())
+	}
+	assertBalance(t, walletService, "12345", 60)
+}
+
+func TestCannotStakeMoreThanBalance(t *testing.T) {
+	t.Parallel()
+	pollService, betService, walletService := newStakedBetService(100)
+
+	poll, err := pollService.CreatePoll(t.Context(), testGuildID, "", "Test Poll", []string{"Option 1", "Option 2"}, time.Time{}, "")
+	if err != nil {
+		t.Fatal("Failed to create poll:", err)
+	}
+
+	_, err = betService.CreateBet(t.Context(), poll.GetID(), "12345", 0, 150)
+
+	var insufficientErr *wallet.InsufficientBalanceError
+	if !errors.As(err, &insufficientErr) {
+		t.Fatalf("Expected an insufficient balance error, but got '%v'", err)
+	}
+	if insufficientErr.Balance != 100 || insufficientErr.Amount != 150 {
+		t.Errorf("Expected balance 100 and amount 150, but got %d and %d", insufficientErr.Balance, insufficientErr.Amount)
+	}
+
+	if _, err := betService.GetBet(t.Context(), poll.GetID(), "12345"); err == nil {
+		t.Error("Expected no bet to be saved")
+	}
+	assertBalance(t, walletService, "12345", 100)
+}
+
+func TestCannotPlaceNegativeStake(t *testing.T) {
+	t.Parallel()
+	pollService, betService, _ := newStakedBetService(100)
+
+	poll, err := pollService.CreatePoll(t.Context(), testGuildID, "", "Test Poll", []string{"Option 1", "Option 2"}, time.Time{}, "")
+	if err != nil {
+		t.Fatal("Failed to create poll:", err)
+	}
+
+	_, err = betService.CreateBet(t.Context(), poll.GetID(), "12345", 0, -10)
+	if !errors.Is(err, ErrInvalidStake) {
+		t.Errorf("Expected error '%v', but got '%v'", ErrInvalidStake, err)
+	}
+}
+
+func TestRejectedBetKeepsStake(t *testing.T) {
+	t.Parallel()
+	pollService, betService, walletService := newStakedBetService(100)
+
+	poll, err := pollService.CreatePoll(t.Context(), testGuildID, "", "Test Poll", []string{"Option 1", "Option 2"}, time.Time{}, "")
+	if err != nil {
+		t.Fatal("Failed to create poll:", err)
+	}
+
+	if _, err := betService.CreateBet(t.Context(), poll.GetID(), "12345", 0, 30); err != nil {
+		t.Fatal("CreateBet returned an unexpected error:", err)
+	}
+	if _, err := betService.CreateBet(t.Context(), poll.GetID(), "12345", 1, 30); !errors.Is(err, ErrUserAlreadyBet) {
+		t.Errorf("Expected error '%v', but got '%v'", ErrUserAlreadyBet, err)
+	}
+
+	assertBalance(t, walletService, "12345", 70)
+}
+
+func TestSettlePollPaysOutStakes(t *testing.T) {
+	t.Parallel()
+	pollService, betService, walletService := newStakedBetService(100)
+
+	poll, err := pollService.CreatePoll(t.Context(), testGuildID, "", "Test Poll", []string{"Option 1", "Option 2"}, time.Time{}, "")
+	if err != nil {
+		t.Fatal("Failed to create poll:", err)
+	}
+
+	if _, err := betService.CreateBet(t.Context(), poll.GetID(), "winner", 1, 50); err != nil {
+		t.Fatal("Failed to create bet:", err)
+	}
+	if _, err := betService.CreateBet(t.Context(), poll.GetID(), "loser", 0, 50); err != nil {
+		t.Fatal("Failed to create bet:", err)
+	}
+
+	if err := pollService.ClosePoll(t.Context(), poll.GetID()); err != nil {
+		t.Fatal("Failed to close poll:", err)
+	}
+
+	// Settling again must not pay the winner twice.
+	for range 2 {
+		if err := betService.SettlePoll(t.Context(), poll.GetID(), polls.OutcomeStatus(1)); err != nil {
+			t.Fatal("SettlePoll returned an unexpected error:", err)
+		}
+	}
+	if err := betService.UpdateBetsByPollId(t.Context(), poll.GetID()); err != nil {
+		t.Fatal("UpdateBetsByPollId returned an unexpected error:", err)
+	}
+
+	assertBalance(t, walletService, "winner", 150)
+	assertBalance(t, walletService, "loser", 50)
+
+	winningBet, err := betService.GetBet(t.Context(), poll.GetID(), "winner")
+	if err != nil {
+		t.Fatal("GetBet returned an unexpected error:", err)
+	}
+	if winningBet.GetPayout() != 100 {
+		t.Errorf("Expected payout 100, but got %d", winningBet.GetPayout())
+	}
+}
+
+func TestCorrectOutcomeMovesPayouts(t *testing.T) {
+	t.Parallel()
+	pollService, betService, walletService := newStakedBetService(100)
+
+	poll, err := pollService.CreatePoll(t.Context(), testGuildID, "", "Test Poll", []string{"Option 1", "Option 2"}, time.Time{}, "")
+	if err != nil {
+		t.Fatal("Failed to create poll:", err)
+	}
+
+	if _, err := betService.CreateBet(t.Context(), poll.GetID(), "first", 0, 50); err != nil {
+		t.Fatal("Failed to create bet:", err)
+	}
+	if _, err := betService.CreateBet(t.Context(), poll.GetID(), "second", 1, 20); err != nil {
+		t.Fatal("Failed to create bet:", err)
+	}
+
+	if err := pollService.ClosePoll(t.Context(), poll.GetID()); err != nil {
+		t.Fatal("Failed to close poll:", err)
+	}
+	if err := betService.SettlePoll(t.Context(), poll.GetID(), polls.OutcomeStatus(0)); err != nil {
+		t.Fatal("SettlePoll returned an unexpected error:", err)
+	}
+
+	// "first" spends the whole balance, winnings included, before the outcome
+	// is corrected.
+	if err := walletService.Debit(t.Context(), testGuildID, "first", 120, wallet.Reason{Kind: wallet.Stake, PollID: "otherPoll"}); err != nil {
+		t.Fatal("Debit returned an unexpected error:", err)
+	}
+
+	if _, err := betService.CorrectOutcome(t.Context(), poll.GetID(), polls.OutcomeStatus(1), "moderator"); err != nil {
+		t.Fatal("CorrectOutcome returned an unexpected error:", err)
+	}
+
+	assertBalance(t, walletService, "first", -70)
+	assertBalance(t, walletService, "second", 150)
+}
+
+func TestVoidPollRefundsStakes(t *testing.T) {
+	t.Parallel()
+	pollService, betService, walletService := newStakedBetService(100)
+
+	poll, err := pollService.CreatePoll(t.Context(), testGuildID, "", "Test Poll", []string{"Option 1", "Option 2"}, time.Time{}, "")
+	if err != nil {
+		t.Fatal("Failed to create poll:", err)
+	}
+
+	if _, err := betService.CreateBet(t.Context(), poll.GetID(), "first", 0, 30); err != nil {
+		t.Fatal("Failed to create bet:", err)
+	}
+	if _, err := betService.CreateBet(t.Context(), poll.GetID(), "second", 1, 80); err != nil {
+		t.Fatal("Failed to create bet:", err)
+	}
+
+	for range 2 {
+		if err := betService.VoidPoll(t.Context(), poll.GetID()); err != nil {
+			t.Fatal("VoidPoll returned an unexpected error:", err)
+		}
+	}
+
+	assertBalance(t, walletService, "first", 100)
+	assertBalance(t, walletService, "second", 100)
+}
+
+func TestSettlePollKeepsHouseCut(t *testing.T) {
+	t.Parallel()
+	pollService := polls.NewService(polls.NewMemoryRepository())
+	walletService := wallet.NewService(wallet.NewMemoryRepository(), 100)
+	betService := NewService(pollService, NewMemoryRepository(), walletService, PayoutCalculator{HouseCut: 1000}, storage.NewMemoryUnitOfWork())
+
+	poll, err := pollService.CreatePoll(t.Context(), testGuildID, "", "Test Poll", []string{"Option 1", "Option 2"}, time.Time{}, "")
+	if err != nil {
+		t.Fatal("Failed to create poll:", err)
+	}
+
+	if _, err := betService.CreateBet(t.Context(), poll.GetID(), "winner", 0, 60); err != nil {
+		t.Fatal("Failed to create bet:", err)
+	}
+	if _, err := betService.CreateBet(t.Context(), poll.GetID(), "loser", 1, 40); err != nil {
+		t.Fatal("Failed to create bet:", err)
+	}
+
+	if err := pollService.ClosePoll(t.Context(), poll.GetID()); err != nil {
+		t.Fatal("Failed to close poll:", err)
+	}
+	if err := betService.SettlePoll(t.Context(), poll.GetID(), polls.OutcomeStatus(0)); err != nil {
+		t.Fatal("SettlePoll returned an unexpected error:", err)
+	}
+
+	// A 10% cut of the 100 point pool leaves 90 for the only winner.
+	assertBalance(t, walletService, "winner", 130)
+	assertBalance(t, walletService, "loser", 60)
+}
+
+func TestGetImpliedOdds(t *testing.T) {
+	t.Parallel()
+	pollService, betService, _ := newStakedBetService(100)
+
+	poll, err := pollService.CreatePoll(t.Context(), testGuildID, "", "Test Poll", []string{"Option 1", "Option 2", "Option 3"}, time.Time{}, "")
+	if err != nil {
+		t.Fatal("Failed to create poll:", err)
+	}
+
+	if _, err := betService.CreateBet(t.Context(), poll.GetID(), "first", 0, 75); err != nil {
+		t.Fatal("Failed to create bet:", err)
+	}
+	if _, err := betService.CreateBet(t.Context(), poll.GetID(), "second", 1, 25); err != nil {
+		t.Fatal("Failed to create bet:", err)
+	}
+
+	odds, err := betService.GetImpliedOdds(t.Context(), poll.GetID())
+	if err != nil {
+		t.Fatal("GetImpliedOdds returned an unexpected error:", err)
+	}
+
+	expected := []OptionOdds{
+		{OptionIndex: 0, Staked: 75, Odds: 100.0 / 75},
+		{OptionIndex: 1, Staked: 25, Odds: 4},
+		{OptionIndex: 2, Staked: 0, Odds: 0},
+	}
+	if len(odds) != len(expected) {
+		t.Fatalf("Expected odds for %d options, but got %d", len(expected), len(odds))
+	}
+	for index := range expected {
+		if odds[index] != expected[index] {
+			t.Errorf("Expected odds %+v, but got %+v", expected[index], odds[index])
+		}
+	}
+}
+
+func TestSettlementKeepsLedgerReconciled(t *testing.T) {
+	t.Parallel()
+	pollService := polls.NewService(polls.NewMemoryRepository())
+	walletService := wallet.NewService(wallet.NewMemoryRepository(), 100)
+	betService := NewService(pollService, NewMemoryRepository(), walletService, PayoutCalculator{HouseCut: 1000}, storage.NewMemoryUnitOfWork())
+
+	poll, err := pollService.CreatePoll(t.Context(), testGuildID, "", "Test Poll", []string{"Option 1", "Option 2"}, time.Time{}, "")
+	if err != nil {
+		t.Fatal("Failed to create poll:", err)
+	}
+
+	if _, err := betService.CreateBet(t.Context(), poll.GetID(), "first", 0, 33); err != nil {
+		t.Fatal("Failed to create bet:", err)
+	}
+	if _, err := betService.CreateBet(t.Context(), poll.GetID(), "second", 1, 47); err != nil {
+		t.Fatal("Failed to create bet:", err)
+	}
+
+	if err := pollService.ClosePoll(t.Context(), poll.GetID()); err != nil {
+		t.Fatal("Failed to close poll:", err)
+	}
+	if err := betService.SettlePoll(t.Context(), poll.GetID(), polls.OutcomeStatus(0)); err != nil {
+		t.Fatal("SettlePoll returned an unexpected error:", err)
+	}
+	if _, err := betService.CorrectOutcome(t.Context(), poll.GetID(), polls.OutcomeStatus(1), "moderator"); err != nil {
+		t.Fatal("CorrectOutcome returned an unexpected error:", err)
+	}
+
+	discrepancies, err := walletService.Reconcile(t.Context())
+	if err != nil {
+		t.Fatal("Reconcile returned an unexpected error:", err)
+	}
+	if len(discrepancies) != 0 {
+		t.Errorf("Expected no discrepancies, but got %+v", discrepancies)
+	}
+
+	ledger, err := walletService.GetLedger(t.Context(), "first")
+	if err != nil {
+		t.Fatal("GetLedger returned an unexpected error:", err)
+	}
+	expectedKinds := []wallet.EntryKind{wallet.Grant, wallet.Stake, wallet.Payout, wallet.Payout}
+	if len(ledger) != len(expectedKinds) {
+		t.Fatalf("Expected %d ledger entries, but got %d", len(expectedKinds), len(ledger))
+	}
+	for index, entry := range ledger {
+		if entry.Kind != expectedKinds[index] || entry.PollID != poll.GetID() && entry.Kind != wallet.Grant {
+			t.Errorf("Expected a %s on poll %s, but got %+v", expectedKinds[index], poll.GetID(), entry)
+		}
+	}
+}
+
+func TestChangeBet(t *testing.T) {
+	t.Parallel()
+	pollService, betService, walletService := newStakedBetService(100)
+
+	poll, err := pollService.CreatePoll(t.Context(), testGuildID, "", "Test Poll", []string{"Option 1", "Option 2", "Option 3"}, time.Time{}, "")
+	if err != nil {
+		t.Fatal("Failed to create poll:", err)
+	}
+
+	if _, err := betService.CreateBet(t.Context(), poll.GetID(), "12345", 0, 40); err != nil {
+		t.Fatal("Failed to create bet:", err)
+	}
+
+	changedBet, err := betService.ChangeBet(t.Context(), poll.GetID(), "12345", 2)
+	if err != nil {
+		t.Fatal("ChangeBet returned an unexpected error:", err)
+	}
+
+	if changedBet.GetSelectedOptionIndex() != 2 || changedBet.GetStake() != 40 {
+		t.Errorf("Expected option 2 with stake 40, but got option %d with stake %d", changedBet.GetSelectedOptionIndex(), changedBet.GetStake())
+	}
+	assertBalance(t, walletService, "12345", 60)
+
+	changes, err := betService.GetBetChanges(t.Context(), poll.GetID(), "12345")
+	if err != nil {
+		t.Fatal("GetBetChanges returned an unexpected error:", err)
+	}
+	if len(changes) != 1 {
+		t.Fatalf("Expected 1 change, but got %d", len(changes))
+	}
+	if changes[0].Kind != Switched || changes[0].PreviousOptionIndex != 0 || changes[0].NewOptionIndex != 2 || changes[0].ChangedAt.IsZero() {
+		t.Errorf("Expected a timestamped switch from option 0 to 2, but got %+v", changes[0])
+	}
+}
+
+func TestChangeBetRejections(t *testing.T) {
+	t.Parallel()
+	pollService, betService, _ := newStakedBetService(100)
+
+	poll, err := pollService.CreatePoll(t.Context(), testGuildID, "", "Test Poll", []string{"Option 1", "Option 2"}, time.Time{}, "")
+	if err != nil {
+		t.Fatal("Failed to create poll:", err)
+	}
+	if _, err := betService.CreateBet(t.Context(), poll.GetID(), "12345", 0, 10); err != nil {
+		t.Fatal("Failed to create bet:", err)
+	}
+
+	if _, err := betService.ChangeBet(t.Context(), poll.GetID(), "12345", 0); !errors.Is(err, ErrBetUnchanged) {
+		t.Errorf("Expected error '%v', but got '%v'", ErrBetUnchanged, err)
+	}
+	if _, err := betService.ChangeBet(t.Context(), poll.GetID(), "12345", 2); !errors.Is(err, ErrInvalidOptionIndex) {
+		t.Errorf("Expected error '%v', but got '%v'", ErrInvalidOptionIndex, err)
+	}
+	if _, err := betService.ChangeBet(t.Context(), poll.GetID(), "67890", 1); !errors.Is(err, ErrBetNotFound) {
+		t.Errorf("Expected error '%v', but got '%v'", ErrBetNotFound, err)
+	}
+
+	if err := pollService.ClosePoll(t.Context(), poll.GetID()); err != nil {
+		t.Fatal("Failed to close poll:", err)
+	}
+
+	if _, err := betService.ChangeBet(t.Context(), poll.GetID(), "12345", 1); !errors.Is(err, ErrPollIsClosed) {
+		t.Errorf("Expected error '%v', but got '%v'", ErrPollIsClosed, err)
+	}
+	if err := betService.WithdrawBet(t.Context(), poll.GetID(), "12345"); !errors.Is(err, ErrPollIsClosed) {
+		t.Errorf("Expected error '%v', but got '%v'", ErrPollIsClosed, err)
+	}
+}
+
+func TestWithdrawBet(t *testing.T) {
+	t.Parallel()
+	pollService, betService, walletService := newStakedBetService(100)
+
+	poll, err := pollService.CreatePoll(t.Context(), testGuildID, "", "Test Poll", []string{"Option 1", "Option 2"}, time.Time{}, "")
+	if err != nil {
+		t.Fatal("Failed to create poll:", err)
+	}
+	if _, err := betService.CreateBet(t.Context(), poll.GetID(), "12345", 1, 70); err != nil {
+		t.Fatal("Failed to create bet:", err)
+	}
+
+	if err := betService.WithdrawBet(t.Context(), poll.GetID(), "12345"); err != nil {
+		t.Fatal("WithdrawBet returned an unexpected error:", err)
+	}
+
+	assertBalance(t, walletService, "12345", 100)
+	if _, err := betService.GetBet(t.Context(), poll.GetID(), "12345"); !errors.Is(err, ErrBetNotFound) {
+		t.Errorf("Expected error '%v', but got '%v'", ErrBetNotFound, err)
+	}
+
+	changes, err := betService.GetBetChanges(t.Context(), poll.GetID(), "12345")
+	if err != nil {
+		t.Fatal("GetBetChanges returned an unexpected error:", err)
+	}
+	if len(changes) != 1 || changes[0].Kind != Withdrawn || changes[0].PreviousOptionIndex != 1 {
+		t.Errorf("Expected a withdrawal from option 1, but got %+v", changes)
+	}
+
+	// The user can bet again after withdrawing.
+	if _, err := betService.CreateBet(t.Context(), poll.GetID(), "12345", 0, 20); err != nil {
+		t.Fatal("CreateBet after withdrawal returned an unexpected error:", err)
+	}
+	assertBalance(t, walletService, "12345", 80)
+}
+
+func TestLeaderboardAfterSettlement(t *testing.T) {
+	t.Parallel()
+	pollService, betService, _ := newStakedBetService(100)
+
+	poll, err := pollService.CreatePoll(t.Context(), testGuildID, "", "Test Poll", []string{"Option 1", "Option 2"}, time.Time{}, "")
+	if err != nil {
+		t.Fatal("Failed to create poll:", err)
+	}
+	if _, err := betService.CreateBet(t.Context(), poll.GetID(), "winner", 0, 20); err != nil {
+		t.Fatal("Failed to create bet:", err)
+	}
+	if _, err := betService.CreateBet(t.Context(), poll.GetID(), "loser", 1, 30); err != nil {
+		t.Fatal("Failed to create bet:", err)
+	}
+	if err := pollService.ClosePoll(t.Context(), poll.GetID()); err != nil {
+		t.Fatal("Failed to close poll:", err)
+	}
+	if err := betService.SettlePoll(t.Context(), poll.GetID(), polls.OutcomeStatus(0)); err != nil {
+		t.Fatal("SettlePoll returned an unexpected error:", err)
+	}
+
+	leaderboard, err := betService.GetLeaderboard(t.Context(), LeaderboardQuery{OrderBy: ByPoints, Limit: 10})
+	if err != nil {
+		t.Fatal("GetLeaderboard returned an unexpected error:", err)
+	}
+
+	expected := []LeaderboardEntry{
+		{Rank: 1, UserID: "winner", Wins: 1, Points: 30},
+		{Rank: 2, UserID: "loser", Losses: 1, Points: -30},
+	}
+	if len(leaderboard.Entries) != len(expected) {
+		t.Fatalf("Expected entries %+v, but got %+v", expected, leaderboard.Entries)
+	}
+	for index, entry := range leaderboard.Entries {
+		if entry != expected[index] {
+			t.Errorf("Expected entry %+v, but got %+v", expected[index], entry)
+		}
+	}
+}
+
+func TestInvalidLeaderboardQuery(t *testing.T) {
+	t.Parallel()
+	_, betService, _ := newStakedBetService(100)
+
+	queries := []LeaderboardQuery{
+		{OrderBy: ByWins, Limit: 0},
+		{OrderBy: ByWins, Limit: 10, Offset: -1},
+		{OrderBy: ByWinRate, Limit: 10, MinBets: -1},
+		{OrderBy: LeaderboardOrder(99), Limit: 10},
+	}
+	for _, query := range queries {
+		if _, err := betService.GetLeaderboard(t.Context(), query); !errors.Is(err, ErrInvalidLeaderboardQuery) {
+			t.Errorf("Expected error '%v' for %+v, but got '%v'", ErrInvalidLeaderboardQuery, query, err)
+		}
+	}
+}
+
+func TestGetBetHistory(t *testing.T) {
+	t.Parallel()
+	pollRepo := polls.NewMemoryRepository()
+	pollService := polls.NewService(pollRepo)
+	walletService := wallet.NewService(wallet.NewMemoryRepository(), 100)
+	betService := NewService(pollService, NewMemoryRepositoryWithPolls(pollRepo), walletService, PayoutCalculator{}, storage.NewMemoryUnitOfWork())
+
+	poll, err := pollService.CreatePoll(t.Context(), testGuildID, "", "Test Poll", []string{"Option 1", "Option 2"}, time.Time{}, "")
+	if err != nil {
+		t.Fatal("Failed to create poll:", err)
+	}
+	if _, err := betService.CreateBet(t.Context(), poll.GetID(), "12345", 1, 30); err != nil {
+		t.Fatal("Failed to create bet:", err)
+	}
+
+	history, err := betService.GetBetHistory(t.Context(), BetHistoryQuery{UserID: "12345", Filter: OpenBets, Limit: 10})
+	if err != nil {
+		t.Fatal("GetBetHistory returned an unexpected error:", err)
+	}
+	if len(history.Entries) != 1 {
+		t.Fatalf("Expected 1 open bet, but got %+v", history.Entries)
+	}
+
+	entry := history.Entries[0]
+	if entry.PollTitle != "Test Poll" || entry.Option != "Option 2" || entry.Stake != 30 || entry.BetStatus != Pending {
+		t.Errorf("Expected a pending 30 point bet on 'Option 2' of 'Test Poll', but got %+v", entry)
+	}
+	if entry.PlacedAt.IsZero() {
+		t.Error("Expected the bet to record when it was placed")
+	}
+
+	for _, query := range []BetHistoryQuery{
+		{UserID: "12345", Limit: 0},
+		{UserID: "12345", Limit: 10, Offset: -1},
+		{UserID: "12345", Limit: 10, Filter: BetHistoryFilter(99)},
+	} {
+		if _, err := betService.GetBetHistory(t.Context(), query); !errors.Is(err, ErrInvalidBetHistoryQuery) {
+			t.Errorf("Expected error '%v' for %+v, but got '%v'", ErrInvalidBetHistoryQuery, query, err)
+		}
+	}
+}
+
+// failingCredits is a wallet service whose credits fail, to interrupt a
+// settlement part way through paying out.
+type failingCredits struct {
+	wallet.WalletService
+}
+
+func (failing failingCredits) Credit(context.Context, string, string, int64, wallet.Reason) error {
+	return errors.New("wallet is unavailable")
+}
+
+func (failing failingCredits) WithTx(tx *storage.Tx) wallet.WalletService {
+	return failingCredits{failing.WalletService.WithTx(tx)}
+}
+
+func TestFailedSettlementIsRolledBack(t *testing.T) {
+	t.Parallel()
+	pollService := polls.NewService(polls.NewMemoryRepository())
+	betRepo := NewMemoryRepository()
+	walletService := wallet.NewService(wallet.NewMemoryRepository(), 100)
+	unitOfWork := storage.NewMemoryUnitOfWork()
+	betService := NewService(pollService, betRepo, walletService, PayoutCalculator{}, unitOfWork)
+	failingBetService := NewService(pollService, betRepo, failingCredits{walletService}, PayoutCalculator{}, unitOfWork)
+
+	poll, err := pollService.CreatePoll(t.Context(), testGuildID, "", "Test Poll", []string{"Option 1", "Option 2"}, time.Time{}, "")
+	if err != nil {
+		t.Fatal("Failed to create poll:", err)
+	}
+	if _, err := betService.CreateBet(t.Context(), poll.GetID(), "winner", 1, 50); err != nil {
+		t.Fatal("Failed to create bet:", err)
+	}
+	if _, err := betService.CreateBet(t.Context(), poll.GetID(), "loser", 0, 50); err != nil {
+		t.Fatal("Failed to create bet:", err)
+	}
+	if err := pollService.ClosePoll(t.Context(), poll.GetID()); err != nil {
+		t.Fatal("Failed to close poll:", err)
+	}
+
+	if err := failingBetService.SettlePoll(t.Context(), poll.GetID(), polls.OutcomeStatus(1)); err == nil {
+		t.Fatal("Expected SettlePoll to fail when the payout fails")
+	}
+
+	// Nothing of the failed settlement is kept, so the poll can be settled again.
+	unsettled, err := pollService.GetPollById(t.Context(), poll.GetID())
+	if err != nil {
+		t.Fatal("GetPollById returned an unexpected error:", err)
+	}
+	if unsettled.GetOutcome() != polls.Pending {
+		t.Errorf("Expected the outcome to still be pending, but got %v", unsettled.GetOutcome())
+	}
+	for _, userID := range []string{"winner", "loser"} {
+		bet, err := betService.GetBet(t.Context(), poll.GetID(), userID)
+		if err != nil {
+			t.Fatal("GetBet returned an unexpected error:", err)
+		}
+		if bet.GetBetStatus() != Pending || bet.GetPayout() != 0 {
+			t.Errorf("Expected the bet of %s to still be pending, but got %s with payout %d", userID, bet.GetBetStatus(), bet.GetPayout())
+		}
+	}
+	assertBalance(t, walletService, "winner", 50)
+
+	if err := betService.SettlePoll(t.Context(), poll.GetID(), polls.OutcomeStatus(1)); err != nil {
+		t.Fatal("SettlePoll returned an unexpected error:", err)
+	}
+	assertBalance(t, walletService, "winner", 150)
+	assertBalance(t, walletService, "loser", 50)
+}
+
+// racingPolls is a poll service that, the first time a poll is read, lets a
+// competing call run before the read returns, as if the two were made at once.
+type racingPolls struct {
+	polls.PollService
+	compete func()
+	once    *sync.Once
+}
+
+func (racing racingPolls) GetPollById(ctx context.Context, pollID string) (polls.Poll, error) {
+	poll, err := racing.PollService.GetPollById(ctx, pollID)
+	racing.once.Do(racing.compete)
+	return poll, err
+}
+
+func (racing racingPolls) WithTx(tx *storage.Tx) polls.PollService {
+	return racingPolls{PollService: racing.PollService.WithTx(tx), compete: racing.compete, once: racing.once}
+}
+
+func TestConcurrentSettlementsDoNotOverwrite(t *testing.T) {
+	t.Parallel()
+	pollService := polls.NewService(polls.NewMemoryRepository())
+	betRepo := NewMemoryRepository()
+	unitOfWork := storage.NewMemoryUnitOfWork()
+	betService := NewService(pollService, betRepo, nil, PayoutCalculator{}, unitOfWork)
+
+	poll, err := pollService.CreatePoll(t.Context(), testGuildID, "", "Test Poll", []string{"Option 1", "Option 2"}, time.Time{}, "")
+	if err != nil {
+		t.Fatal("Failed to create poll:", err)
+	}
+	if err := pollService.ClosePoll(t.Context(), poll.GetID()); err != nil {
+		t.Fatal("Failed to close poll:", err)
+	}
+
+	// The competing selection is given a moment to run. Once the poll is read
+	// inside the unit of work it has to wait for the first selection instead.
+	competitorDone := make(chan error, 1)
+	compete := func() {
+		go func() { competitorDone <- betService.SettlePoll(t.Context(), poll.GetID(), polls.OutcomeStatus(0)) }()
+		select {
+		case err := <-competitorDone:
+			competitorDone <- err
+		case <-time.After(50 * time.Millisecond):
+		}
+	}
+	racingService := NewService(racingPolls{PollService: pollService, compete: compete, once: &sync.Once{}}, betRepo, nil, PayoutCalculator{}, unitOfWork)
+
+	if err := racingService.SettlePoll(t.Context(), poll.GetID(), polls.OutcomeStatus(1)); err != nil {
+		t.Fatal("SettlePoll returned an unexpected error:", err)
+	}
+	if err := <-competitorDone; !errors.Is(err, ErrOutcomeAlreadySelected) {
+		t.Errorf("Expected the competing selection to return '%v', but got '%v'", ErrOutcomeAlreadySelected, err)
+	}
+
+	settled, err := pollService.GetPollById(t.Context(), poll.GetID())
+	if err != nil {
+		t.Fatal("GetPollById returned an unexpected error:", err)
+	}
+	if settled.GetOutcome() != polls.OutcomeStatus(1) {
+		t.Errorf("Expected the outcome to stay 1, but got %d", settled.GetOutcome())
+	}
+}
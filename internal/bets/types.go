@@ -1,11 +1,15 @@
 package bets
 
+import "time"
+
 type BetStatus int
 
 const (
 	Pending BetStatus = iota
 	Won
 	Lost
+	// Void bets were placed on a cancelled poll and count as neither a win nor a loss.
+	Void
 )
 
 func (bs BetStatus) String() string {
@@ -16,6 +20,8 @@ func (bs BetStatus) String() string {
 		return "WON"
 	case Lost:
 		return "LOST"
+	case Void:
+		return "VOID"
 	default:
 		return "UNKNOWN"
 	}
@@ -26,19 +32,142 @@ type bet struct {
 	UserID              string
 	SelectedOptionIndex int
 	BetStatus           BetStatus
+	// Stake is the number of points wagered, or zero for a bet without a wager.
+	Stake int64
+	// Payout is the number of points credited to the user for this bet so far.
+	Payout int64
+	// PlacedAt is when the bet was placed, or the zero time for bets placed
+	// before it was recorded.
+	PlacedAt time.Time
 }
 
 type Bet interface {
 	GetBetKey() BetKey
 	GetSelectedOptionIndex() int
 	GetBetStatus() BetStatus
+	GetStake() int64
+	GetPayout() int64
 }
 
 func (b *bet) GetBetKey() BetKey           { return BetKey{b.PollID, b.UserID} }
 func (b *bet) GetSelectedOptionIndex() int { return b.SelectedOptionIndex }
 func (b *bet) GetBetStatus() BetStatus     { return b.BetStatus }
+func (b *bet) GetStake() int64             { return b.Stake }
+func (b *bet) GetPayout() int64            { return b.Payout }
 
 type BetKey struct {
 	PollID string
 	UserID string
 }
+
+type BetChangeKind string
+
+const (
+	// Switched bets moved to another option, keeping their stake.
+	Switched BetChangeKind = "SWITCHED"
+	// Withdrawn bets were removed and their stake refunded.
+	Withdrawn BetChangeKind = "WITHDRAWN"
+)
+
+// BetChange records a user switching or withdrawing their bet while the poll
+// was open.
+type BetChange struct {
+	PollID              string
+	UserID              string
+	Kind                BetChangeKind
+	PreviousOptionIndex int
+	// NewOptionIndex is -1 for a withdrawal.
+	NewOptionIndex int
+	ChangedAt      time.Time
+}
+
+// LeaderboardOrder is what users are ranked by on the leaderboard.
+type LeaderboardOrder int
+
+const (
+	ByWins LeaderboardOrder = iota
+	ByWinRate
+	ByPoints
+)
+
+type LeaderboardQuery struct {
+	// GuildID ranks users by their bets on the guild's polls, or on every
+	// guild's polls if empty.
+	GuildID string
+	OrderBy LeaderboardOrder
+	// MinBets leaves out users with fewer settled bets, so that one lucky win
+	// does not top the win rate ranking.
+	MinBets int
+	// UserID narrows the leaderboard down to one user's entry, still ranked
+	// against everyone else. Total stays the number of ranked users.
+	UserID string
+	Limit  int
+	Offset int
+}
+
+// LeaderboardEntry is a user's standing across their settled bets. Users tied
+// on the ranked value share a rank.
+type LeaderboardEntry struct {
+	Rank   int
+	UserID string
+	Wins   int
+	Losses int
+	// Points is the net number of points won or lost on settled bets.
+	Points int64
+}
+
+func (entry LeaderboardEntry) WinRate() float64 {
+	if entry.Wins+entry.Losses == 0 {
+		return 0
+	}
+	return float64(entry.Wins) / float64(entry.Wins+entry.Losses)
+}
+
+type Leaderboard struct {
+	Entries []LeaderboardEntry
+	// Total is the number of ranked users across every page.
+	Total int
+}
+
+// BetHistoryFilter picks which of a user's bets to list.
+type BetHistoryFilter int
+
+const (
+	AllBets BetHistoryFilter = iota
+	// OpenBets are still pending, including bets on closed polls that have
+	// not been resolved yet.
+	OpenBets
+	// SettledBets were won, lost or voided.
+	SettledBets
+)
+
+type BetHistoryQuery struct {
+	UserID string
+	// GuildID lists only bets on the guild's polls, or bets on every guild's
+	// polls if empty.
+	GuildID string
+	Filter  BetHistoryFilter
+	Limit   int
+	Offset  int
+}
+
+// BetHistoryEntry is one of a user's bets together with the poll it was placed on.
+type BetHistoryEntry struct {
+	PollID    string
+	PollTitle string
+	// PollCategory is empty for bets on uncategorised polls.
+	PollCategory string
+	OptionIndex  int
+	Option       string
+	BetStatus    BetStatus
+	Stake        int64
+	Payout       int64
+	PlacedAt     time.Time
+}
+
+type BetHistory struct {
+	// Entries are the newest bets first.
+	Entries []BetHistoryEntry
+	// Total is the number of matching bets across every page.
+	Total int
+}
@@ -0,0 +1,326 @@
+package discord
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// DefaultBaseURL is the version of the Discord REST API the bot is built against.
+const DefaultBaseURL = "https://discord.com/api/v10"
+
+const (
+	defaultTimeout      = 10 * time.Second
+	defaultMaxRetries   = 3
+	defaultRetryBackoff = 500 * time.Millisecond
+)
+
+// Client sends requests to the Discord REST API. It waits out the rate limits
+// Discord reports, retries rate-limited requests after Retry-After, and
+// retries idempotent requests that fail with a server error.
+type Client struct {
+	baseURL    string
+	token      string
+	HTTPClient *http.Client
+	// Timeout bounds each attempt at a request.
+	Timeout time.Duration
+	// MaxRetries is how many times a request is retried before giving up.
+	MaxRetries int
+	// RetryBackoff is the wait before the first retry of a failed request. It
+	// doubles with every retry.
+	RetryBackoff time.Duration
+	limiter      *rateLimiter
+}
+
+// NewClient creates a client for the API at baseURL, such as DefaultBaseURL or
+// the address of a fake server in tests.
+func NewClient(baseURL string, token string) *Client {
+	return &Client{
+		baseURL:      baseURL,
+		token:        token,
+		HTTPClient:   &http.Client{},
+		Timeout:      defaultTimeout,
+		MaxRetries:   defaultMaxRetries,
+		RetryBackoff: defaultRetryBackoff,
+		limiter:      newRateLimiter(),
+	}
+}
+
+// Message is the part of a Discord message the bot keeps track of.
+type Message struct {
+	ID        string `json:"id"`
+	ChannelID string `json:"channel_id"`
+}
+
+// CreateMessage posts the message to the channel.
+func (client *Client) CreateMessage(ctx context.Context, channelID string, message any) (Message, error) {
+	var sent Message
+	if err := client.Do(ctx, http.MethodPost, fmt.Sprintf("/channels/%s/messages", channelID), message, &sent); err != nil {
+		return Message{}, err
+	}
+	return sent, nil
+}
+
+// EditMessage replaces the content of a message the bot posted.
+func (client *Client) EditMessage(ctx context.Context, channelID string, messageID string, message any) error {
+	return client.Do(ctx, http.MethodPatch, fmt.Sprintf("/channels/%s/messages/%s", channelID, messageID), message, nil)
+}
+
+// CreateInteractionResponse answers an interaction.
+func (client *Client) CreateInteractionResponse(ctx context.Context, interactionID string, interactionToken string, response any) error {
+	return client.Do(ctx, http.MethodPost, fmt.Sprintf("/interactions/%s/%s/callback", interactionID, interactionToken), response, nil)
+}
+
+// File is uploaded along with a message as one of its attachments.
+type File struct {
+	Name        string
+	ContentType string
+	Data        []byte
+}
+
+// Attachment refers to the file uploaded at index ID from the message's
+// attachments.
+type Attachment struct {
+	ID       int    `json:"id"`
+	Filename string `json:"filename"`
+}
+
+// EditInteractionResponse replaces the original response to an interaction,
+// such as a deferred one, and uploads the files with it. The message lists
+// the files in its attachments.
+func (client *Client) EditInteractionResponse(ctx context.Context, applicationID string, interactionToken string, message any, files []File) error {
+	payload, contentType, err := encodeMultipart(message, files)
+	if err != nil {
+		return err
+	}
+	return client.do(ctx, http.MethodPatch, fmt.Sprintf("/webhooks/%s/%s/messages/@original", applicationID, interactionToken), payload, contentType, nil)
+}
+
+// Do sends body as JSON to the API path and decodes the response into result,
+// unless result is nil. Failed requests return an *APIError, or a
+// *RateLimitError once the retries are used up.
+func (client *Client) Do(ctx context.Context, method string, path string, body any, result any) error {
+	var payload []byte
+	if body != nil {
+		var err error
+		if payload, err = json.Marshal(body); err != nil {
+			return fmt.Errorf("error while encoding request body: %w", err)
+		}
+	}
+	return client.do(ctx, method, path, payload, "application/json", result)
+}
+
+// encodeMultipart encodes the message and the files it uploads as a
+// multipart form, the way Discord takes attachments.
+func encodeMultipart(message any, files []File) ([]byte, string, error) {
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+
+	payloadPart, err := form.CreatePart(textproto.MIMEHeader{
+		"Content-Disposition": {`form-data; name="payload_json"`},
+		"Content-Type":        {"application/json"},
+	})
+	if err != nil {
+		return nil, "", fmt.Errorf("error while encoding request body: %w", err)
+	}
+	if err := json.NewEncoder(payloadPart).Encode(message); err != nil {
+		return nil, "", fmt.Errorf("error while encoding request body: %w", err)
+	}
+
+	for index, file := range files {
+		filePart, err := form.CreatePart(textproto.MIMEHeader{
+			"Content-Disposition": {fmt.Sprintf(`form-data; name="files[%d]"; filename=%q`, index, file.Name)},
+			"Content-Type":        {file.ContentType},
+		})
+		if err != nil {
+			return nil, "", fmt.Errorf("error while encoding file %s: %w", file.Name, err)
+		}
+		if _, err := filePart.Write(file.Data); err != nil {
+			return nil, "", fmt.Errorf("error while encoding file %s: %w", file.Name, err)
+		}
+	}
+
+	if err := form.Close(); err != nil {
+		return nil, "", fmt.Errorf("error while encoding request body: %w", err)
+	}
+	return body.Bytes(), form.FormDataContentType(), nil
+}
+
+// do sends the encoded payload, retrying the way Do describes.
+func (client *Client) do(ctx context.Context, method string, path string, payload []byte, contentType string, result any) error {
+	route := routeKey(method, path)
+	for attempt := 0; ; attempt++ {
+		responseBody, retryAfter, err := client.attempt(ctx, method, path, route, payload, contentType)
+		if err == nil {
+			if result == nil || len(responseBody) == 0 {
+				return nil
+			}
+			if err := json.Unmarshal(responseBody, result); err != nil {
+				return fmt.Errorf("error while decoding response of %s %s: %w", method, route, err)
+			}
+			return nil
+		}
+
+		if attempt >= client.MaxRetries || ctx.Err() != nil {
+			return err
+		}
+
+		var rateLimitErr *RateLimitError
+		switch {
+		case errors.As(err, &rateLimitErr):
+			// Discord did not process a rate-limited request, so any method may be retried.
+		case isIdempotent(method) && isRetryable(err):
+			retryAfter = client.RetryBackoff << attempt
+		default:
+			return err
+		}
+
+		log.Printf("Discord request %s %s failed, retrying in %s: %v", method, route, retryAfter, err)
+		if err := sleep(ctx, retryAfter); err != nil {
+			return err
+		}
+	}
+}
+
+// attempt sends the request once. A rate-limited attempt returns how long to
+// wait before retrying.
+func (client *Client) attempt(ctx context.Context, method string, path string, route string, payload []byte, contentType string) ([]byte, time.Duration, error) {
+	routeBucket, err := client.limiter.acquire(ctx, route)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	response, err := client.send(ctx, method, path, payload, contentType)
+	if err != nil {
+		client.limiter.release(routeBucket, nil)
+		// The transport's error carries the full URL, which holds the token of
+		// interaction and webhook requests, so only its cause is kept.
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			err = urlErr.Err
+		}
+		return nil, 0, fmt.Errorf("error while sending %s %s: %w", method, route, err)
+	}
+	client.limiter.release(routeBucket, response.header)
+
+	if response.statusCode == http.StatusTooManyRequests {
+		rateLimitErr := parseRateLimit(method, route, response)
+		if rateLimitErr.Global {
+			client.limiter.holdGlobal(rateLimitErr.RetryAfter)
+		}
+		return nil, rateLimitErr.RetryAfter, rateLimitErr
+	}
+
+	if response.statusCode < 200 || response.statusCode > 299 {
+		return nil, 0, parseAPIError(method, route, response)
+	}
+
+	return response.body, 0, nil
+}
+
+type rawResponse struct {
+	statusCode int
+	header     http.Header
+	body       []byte
+}
+
+func (client *Client) send(ctx context.Context, method string, path string, payload []byte, contentType string) (rawResponse, error) {
+	ctx, cancel := context.WithTimeout(ctx, client.Timeout)
+	defer cancel()
+
+	var requestBody io.Reader
+	if payload != nil {
+		requestBody = bytes.NewReader(payload)
+	}
+
+	request, err := http.NewRequestWithContext(ctx, method, client.baseURL+path, requestBody)
+	if err != nil {
+		return rawResponse{}, err
+	}
+
+	request.Header.Set("Authorization", "Bot "+client.token)
+	if payload != nil {
+		request.Header.Set("Content-Type", contentType)
+	}
+
+	response, err := client.HTTPClient.Do(request)
+	if err != nil {
+		return rawResponse{}, err
+	}
+	defer response.Body.Close()
+
+	body, err := io.ReadAll(response.Body)
+	if err != nil {
+		return rawResponse{}, err
+	}
+
+	return rawResponse{statusCode: response.StatusCode, header: response.Header, body: body}, nil
+}
+
+func parseRateLimit(method string, route string, response rawResponse) *RateLimitError {
+	var rateLimitBody struct {
+		RetryAfter float64 `json:"retry_after"`
+		Global     bool    `json:"global"`
+	}
+	_ = json.Unmarshal(response.body, &rateLimitBody)
+
+	retryAfter := secondsToDuration(rateLimitBody.RetryAfter)
+	if headerSeconds, err := strconv.ParseFloat(response.header.Get("Retry-After"), 64); err == nil {
+		retryAfter = max(retryAfter, secondsToDuration(headerSeconds))
+	}
+
+	return &RateLimitError{
+		Method:     method,
+		Route:      route,
+		RetryAfter: retryAfter,
+		Global:     rateLimitBody.Global || response.header.Get("X-RateLimit-Global") == "true",
+	}
+}
+
+func parseAPIError(method string, route string, response rawResponse) *APIError {
+	apiErr := &APIError{Method: method, Route: route, StatusCode: response.statusCode}
+
+	var errorBody struct {
+		Code    int    `json:"code"`
+		Message string `json:"message"`
+	}
+	if err := json.Unmarshal(response.body, &errorBody); err == nil && errorBody.Message != "" {
+		apiErr.Code = errorBody.Code
+		apiErr.Message = errorBody.Message
+	} else {
+		apiErr.Message = http.StatusText(response.statusCode)
+	}
+
+	return apiErr
+}
+
+// isIdempotent reports whether repeating the request cannot apply it twice.
+// Creating messages and answering interactions are not.
+func isIdempotent(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodPut, http.MethodPatch, http.MethodDelete:
+		return true
+	default:
+		return false
+	}
+}
+
+// isRetryable reports whether the failure may go away on its own: a network
+// error, a timed out attempt or a server error.
+func isRetryable(err error) bool {
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		return apiErr.StatusCode >= 500
+	}
+	return true
+}
@@ -0,0 +1,310 @@
+package discord
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// newTestClient points a client at a fake Discord API that answers with handler.
+func newTestClient(t *testing.T, handler http.HandlerFunc) *Client {
+	t.Helper()
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+
+	client := NewClient(server.URL, "test-token")
+	client.RetryBackoff = time.Millisecond
+	return client
+}
+
+func TestCreateMessage(t *testing.T) {
+	t.Parallel()
+	client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.URL.Path != "/channels/123/messages" {
+			t.Errorf("Expected POST /channels/123/messages, but got %s %s", r.Method, r.URL.Path)
+		}
+		if r.Header.Get("Authorization") != "Bot test-token" {
+			t.Errorf("Expected the bot token to be sent, but got %q", r.Header.Get("Authorization"))
+		}
+
+		var body map[string]string
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil || body["content"] != "hello" {
+			t.Errorf("Expected the message to be sent as JSON, but got %v (%v)", body, err)
+		}
+
+		_, _ = io.WriteString(w, `{"id": "456", "channel_id": "123"}`)
+	})
+
+	message, err := client.CreateMessage(context.Background(), "123", map[string]string{"content": "hello"})
+	if err != nil {
+		t.Fatal("CreateMessage returned an unexpected error:", err)
+	}
+	if message.ID != "456" || message.ChannelID != "123" {
+		t.Errorf("Expected message 456 in channel 123, but got %+v", message)
+	}
+}
+
+func TestEditInteractionResponse(t *testing.T) {
+	t.Parallel()
+	client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPatch || r.URL.Path != "/webhooks/42/secret-token/messages/@original" {
+			t.Errorf("Expected PATCH /webhooks/42/secret-token/messages/@original, but got %s %s", r.Method, r.URL.Path)
+		}
+		if err := r.ParseMultipartForm(1 << 20); err != nil {
+			t.Fatalf("Expected a multipart form, but got %v", err)
+		}
+
+		var payload struct {
+			Content     string       `json:"content"`
+			Attachments []Attachment `json:"attachments"`
+		}
+		if err := json.Unmarshal([]byte(r.FormValue("payload_json")), &payload); err != nil || payload.Content != "hello" || len(payload.Attachments) != 1 {
+			t.Errorf("Expected the message in payload_json, but got %+v (%v)", payload, err)
+		}
+
+		file, header, err := r.FormFile("files[0]")
+		if err != nil {
+			t.Fatalf("Expected the file to be uploaded, but got %v", err)
+		}
+		defer file.Close()
+		data, _ := io.ReadAll(file)
+		if header.Filename != "data.json" || string(data) != `{"version":1}` {
+			t.Errorf("Expected data.json to be uploaded, but got %s with %q", header.Filename, data)
+		}
+
+		_, _ = io.WriteString(w, `{"id": "456", "channel_id": "123"}`)
+	})
+
+	message := map[string]any{
+		"content":     "hello",
+		"attachments": []Attachment{{ID: 0, Filename: "data.json"}},
+	}
+	files := []File{{Name: "data.json", ContentType: "application/json", Data: []byte(`{"version":1}`)}}
+	if err := client.EditInteractionResponse(context.Background(), "42", "secret-token", message, files); err != nil {
+		t.Fatal("EditInteractionResponse returned an unexpected error:", err)
+	}
+}
+
+func TestRetriesAfterRateLimit(t *testing.T) {
+	t.Parallel()
+	var calls atomic.Int32
+	client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) == 1 {
+			w.Header().Set("Retry-After", "0.01")
+			w.WriteHeader(http.StatusTooManyRequests)
+			_, _ = io.WriteString(w, `{"message": "You are being rate limited.", "retry_after": 0.01, "global": false}`)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	// Rate-limited requests were never processed, so even a POST is retried.
+	if err := client.CreateInteractionResponse(context.Background(), "1", "token", map[string]int{"type": 6}); err != nil {
+		t.Fatal("CreateInteractionResponse returned an unexpected error:", err)
+	}
+	if calls.Load() != 2 {
+		t.Errorf("Expected the request to be sent twice, but it was sent %d times", calls.Load())
+	}
+}
+
+func TestGivesUpWhenStillRateLimited(t *testing.T) {
+	t.Parallel()
+	var calls atomic.Int32
+	client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.Header().Set("X-RateLimit-Global", "true")
+		w.WriteHeader(http.StatusTooManyRequests)
+		_, _ = io.WriteString(w, `{"message": "You are being rate limited.", "retry_after": 0.005, "global": true}`)
+	})
+	client.MaxRetries = 1
+
+	err := client.EditMessage(context.Background(), "123", "456", map[string]string{"content": "edited"})
+
+	var rateLimitErr *RateLimitError
+	if !errors.As(err, &rateLimitErr) {
+		t.Fatalf("Expected a RateLimitError, but got %v", err)
+	}
+	if !rateLimitErr.Global || rateLimitErr.RetryAfter != 5*time.Millisecond {
+		t.Errorf("Expected a global limit retrying after 5ms, but got %+v", rateLimitErr)
+	}
+	if calls.Load() != 2 {
+		t.Errorf("Expected the request to be sent twice, but it was sent %d times", calls.Load())
+	}
+}
+
+func TestRetriesOnlyIdempotentServerErrors(t *testing.T) {
+	t.Parallel()
+	testCases := []struct {
+		method        string
+		expectedCalls int32
+		expectSuccess bool
+	}{
+		{http.MethodPatch, 2, true},
+		{http.MethodPost, 1, false},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.method, func(t *testing.T) {
+			t.Parallel()
+			var calls atomic.Int32
+			client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+				if calls.Add(1) == 1 {
+					w.WriteHeader(http.StatusBadGateway)
+					return
+				}
+				w.WriteHeader(http.StatusNoContent)
+			})
+
+			err := client.Do(context.Background(), testCase.method, "/channels/123/messages", map[string]string{}, nil)
+			if (err == nil) != testCase.expectSuccess {
+				t.Errorf("Expected success to be %v, but got error %v", testCase.expectSuccess, err)
+			}
+			if calls.Load() != testCase.expectedCalls {
+				t.Errorf("Expected %d calls, but got %d", testCase.expectedCalls, calls.Load())
+			}
+		})
+	}
+}
+
+func TestReturnsTypedAPIErrors(t *testing.T) {
+	t.Parallel()
+	client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+		_, _ = io.WriteString(w, `{"code": 10008, "message": "Unknown Message"}`)
+	})
+
+	err := client.EditMessage(context.Background(), "123", "456", map[string]string{})
+
+	if !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected the error to match ErrNotFound, but got %v", err)
+	}
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) || apiErr.Code != 10008 || apiErr.Route != "PATCH /channels/123/messages/:id" {
+		t.Errorf("Expected an APIError with code 10008 on the edit route, but got %+v", apiErr)
+	}
+}
+
+func TestWaitsForExhaustedBucket(t *testing.T) {
+	t.Parallel()
+	const resetAfter = 100 * time.Millisecond
+	client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-RateLimit-Remaining", "0")
+		w.Header().Set("X-RateLimit-Reset-After", fmt.Sprint(resetAfter.Seconds()))
+		_, _ = io.WriteString(w, `{"id": "1", "channel_id": "1"}`)
+	})
+
+	if _, err := client.CreateMessage(context.Background(), "123", map[string]string{}); err != nil {
+		t.Fatal("CreateMessage returned an unexpected error:", err)
+	}
+
+	start := time.Now()
+	if _, err := client.CreateMessage(context.Background(), "789", map[string]string{}); err != nil {
+		t.Fatal("CreateMessage returned an unexpected error:", err)
+	}
+	if waited := time.Since(start); waited >= resetAfter {
+		t.Errorf("Expected another channel to have its own bucket, but it waited %s", waited)
+	}
+
+	start = time.Now()
+	if _, err := client.CreateMessage(context.Background(), "123", map[string]string{}); err != nil {
+		t.Fatal("CreateMessage returned an unexpected error:", err)
+	}
+	if waited := time.Since(start); waited < resetAfter/2 {
+		t.Errorf("Expected the exhausted bucket to be waited out, but it only waited %s", waited)
+	}
+}
+
+func TestSendsRequestsOnTheSameRouteSideBySide(t *testing.T) {
+	t.Parallel()
+	var inFlight atomic.Int32
+	bothArrived := make(chan struct{})
+	client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		if inFlight.Add(1) == 2 {
+			close(bothArrived)
+		}
+		select {
+		case <-bothArrived:
+		case <-time.After(2 * time.Second):
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	})
+	client.MaxRetries = 0
+
+	errs := make(chan error, 2)
+	for _, interactionID := range []string{"1", "2"} {
+		go func() {
+			errs <- client.CreateInteractionResponse(context.Background(), interactionID, "token-"+interactionID, map[string]string{})
+		}()
+	}
+	for range 2 {
+		if err := <-errs; err != nil {
+			t.Errorf("Expected answers to interactions not to wait for each other, but got %v", err)
+		}
+	}
+}
+
+func TestTimesOutSlowRequests(t *testing.T) {
+	t.Parallel()
+	client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-time.After(200 * time.Millisecond):
+		}
+	})
+	client.Timeout = 20 * time.Millisecond
+	client.MaxRetries = 0
+
+	err := client.EditMessage(context.Background(), "123", "456", map[string]string{})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected the request to time out, but got %v", err)
+	}
+}
+
+func TestTransportErrorsHideTheToken(t *testing.T) {
+	t.Parallel()
+	server := httptest.NewServer(http.NotFoundHandler())
+	server.Close()
+
+	client := NewClient(server.URL, "test-token")
+	client.MaxRetries = 0
+
+	err := client.CreateInteractionResponse(context.Background(), "789", "secret-token", map[string]string{})
+	if err == nil {
+		t.Fatal("Expected the request to fail against a closed server")
+	}
+	if strings.Contains(err.Error(), "secret-token") {
+		t.Errorf("Expected the error to leave out the interaction token, but got %v", err)
+	}
+	if !strings.Contains(err.Error(), "POST /interactions/:id/:token/callback") {
+		t.Errorf("Expected the error to name the route, but got %v", err)
+	}
+}
+
+func TestRouteKey(t *testing.T) {
+	t.Parallel()
+	testCases := []struct {
+		method   string
+		path     string
+		expected string
+	}{
+		{http.MethodPost, "/channels/123/messages", "POST /channels/123/messages"},
+		{http.MethodPatch, "/channels/123/messages/456", "PATCH /channels/123/messages/:id"},
+		{http.MethodPost, "/interactions/789/secret-token/callback", "POST /interactions/:id/:token/callback"},
+		{http.MethodPatch, "/webhooks/42/secret-token/messages/@original", "PATCH /webhooks/42/:token/messages/@original"},
+		{http.MethodPut, "/applications/1/guilds/2/commands?with_localizations=true", "PUT /applications/:id/guilds/2/commands"},
+	}
+
+	for _, testCase := range testCases {
+		if got := routeKey(testCase.method, testCase.path); got != testCase.expected {
+			t.Errorf("routeKey(%s, %s) = %q, want %q", testCase.method, testCase.path, got, testCase.expected)
+		}
+	}
+}
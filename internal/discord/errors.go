@@ -0,0 +1,59 @@
+package discord
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// ErrNotFound matches API errors for resources that no longer exist, such as a
+// deleted message.
+var ErrNotFound = errors.New("discord resource not found")
+
+// ErrUnauthorized matches API errors caused by a missing or invalid bot token.
+var ErrUnauthorized = errors.New("discord rejected the bot token")
+
+// APIError is a non-success response from the Discord API.
+type APIError struct {
+	Method string
+	// Route is the request path with its IDs and tokens replaced, so it is safe to log.
+	Route      string
+	StatusCode int
+	// Code is Discord's JSON error code, such as 10008 for an unknown message.
+	Code    int
+	Message string
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("discord API returned %d for %s %s: %s (code %d)", e.StatusCode, e.Method, e.Route, e.Message, e.Code)
+}
+
+func (e *APIError) Is(target error) bool {
+	switch target {
+	case ErrNotFound:
+		return e.StatusCode == http.StatusNotFound
+	case ErrUnauthorized:
+		return e.StatusCode == http.StatusUnauthorized
+	default:
+		return false
+	}
+}
+
+// RateLimitError is returned once a request is still rate limited after every retry.
+type RateLimitError struct {
+	Method string
+	Route  string
+	// RetryAfter is how long Discord asked the client to wait.
+	RetryAfter time.Duration
+	// Global is set when the limit applies to every route of the bot.
+	Global bool
+}
+
+func (e *RateLimitError) Error() string {
+	scope := "route"
+	if e.Global {
+		scope = "global"
+	}
+	return fmt.Sprintf("discord %s rate limit hit for %s %s, retry after %s", scope, e.Method, e.Route, e.RetryAfter)
+}
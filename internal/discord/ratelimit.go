@@ -0,0 +1,162 @@
+package discord
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// bucket tracks the rate limit Discord reported for a route. Each request
+// takes one of the remaining requests before it is sent, and waits for the
+// reset once none are left. The lock is never held while a request is in
+// flight, so requests on the same route are sent side by side.
+type bucket struct {
+	mu        sync.Mutex
+	known     bool
+	remaining int
+	resetAt   time.Time
+}
+
+// rateLimiter hands out the bucket of each route and holds back every request
+// while a global rate limit is in force.
+type rateLimiter struct {
+	mu            sync.Mutex
+	buckets       map[string]*bucket
+	globalResetAt time.Time
+}
+
+func newRateLimiter() *rateLimiter {
+	return &rateLimiter{buckets: make(map[string]*bucket)}
+}
+
+// acquire waits until the route may be called and takes one of its remaining
+// requests. The bucket must be released with the response, or with nil if none
+// arrived.
+func (limiter *rateLimiter) acquire(ctx context.Context, route string) (*bucket, error) {
+	limiter.mu.Lock()
+	routeBucket, exists := limiter.buckets[route]
+	if !exists {
+		routeBucket = &bucket{}
+		limiter.buckets[route] = routeBucket
+	}
+	globalResetAt := limiter.globalResetAt
+	limiter.mu.Unlock()
+
+	if err := sleep(ctx, time.Until(globalResetAt)); err != nil {
+		return nil, err
+	}
+
+	for {
+		routeBucket.mu.Lock()
+		switch {
+		case !routeBucket.known:
+		case !time.Now().Before(routeBucket.resetAt):
+			// The limit has reset. The next response reports the new one.
+			routeBucket.known = false
+		case routeBucket.remaining > 0:
+			routeBucket.remaining--
+		default:
+			resetAt := routeBucket.resetAt
+			routeBucket.mu.Unlock()
+			if err := sleep(ctx, time.Until(resetAt)); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		routeBucket.mu.Unlock()
+		return routeBucket, nil
+	}
+}
+
+// release records the limit reported with the response.
+func (limiter *rateLimiter) release(routeBucket *bucket, header http.Header) {
+	if header == nil {
+		return
+	}
+
+	remaining, remainingErr := strconv.Atoi(header.Get("X-RateLimit-Remaining"))
+	resetAfter, resetErr := strconv.ParseFloat(header.Get("X-RateLimit-Reset-After"), 64)
+	if remainingErr != nil || resetErr != nil {
+		return
+	}
+
+	routeBucket.mu.Lock()
+	defer routeBucket.mu.Unlock()
+
+	routeBucket.known = true
+	routeBucket.remaining = remaining
+	routeBucket.resetAt = time.Now().Add(secondsToDuration(resetAfter))
+}
+
+// holdGlobal stops every request until the global rate limit resets.
+func (limiter *rateLimiter) holdGlobal(retryAfter time.Duration) {
+	limiter.mu.Lock()
+	defer limiter.mu.Unlock()
+
+	if resetAt := time.Now().Add(retryAfter); resetAt.After(limiter.globalResetAt) {
+		limiter.globalResetAt = resetAt
+	}
+}
+
+// routeKey identifies the rate limit bucket of a request. Discord keys its
+// buckets by the route and its major parameter (the channel, guild or webhook),
+// so every other ID and token is replaced with a placeholder.
+func routeKey(method string, path string) string {
+	if queryStart := strings.IndexByte(path, '?'); queryStart >= 0 {
+		path = path[:queryStart]
+	}
+
+	original := strings.Split(strings.Trim(path, "/"), "/")
+	segments := make([]string, len(original))
+	copy(segments, original)
+
+	for index := 1; index < len(original); index++ {
+		switch {
+		case original[index-1] == "channels" || original[index-1] == "guilds" || original[index-1] == "webhooks":
+			// Major parameters keep their own bucket.
+		case index >= 2 && (original[index-2] == "interactions" || original[index-2] == "webhooks"):
+			segments[index] = ":token"
+		case isSnowflake(original[index]):
+			segments[index] = ":id"
+		}
+	}
+
+	return method + " /" + strings.Join(segments, "/")
+}
+
+func isSnowflake(segment string) bool {
+	if segment == "" {
+		return false
+	}
+	for _, character := range segment {
+		if character < '0' || character > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// sleep waits for the duration, returning early with the context's error if
+// it is done first.
+func sleep(ctx context.Context, duration time.Duration) error {
+	if duration <= 0 {
+		return ctx.Err()
+	}
+
+	timer := time.NewTimer(duration)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+func secondsToDuration(seconds float64) time.Duration {
+	return time.Duration(seconds * float64(time.Second))
+}
@@ -0,0 +1,34 @@
+package permissions
+
+import (
+	"context"
+	"errors"
+)
+
+type PermissionService interface {
+	// GetPolicy returns the guild's policy. Actions the guild has no rule for
+	// use the default rules.
+	GetPolicy(ctx context.Context, guildID string) (Policy, error)
+	// UpdatePolicy validates the policy and saves it for its guild.
+	UpdatePolicy(ctx context.Context, policy Policy) error
+	// Authorize returns ErrPermissionDenied if the guild's policy does not let
+	// the member take the action, or ErrNotPollCreator if only the poll's
+	// creator or a moderator may resolve it. Pass the creator of the poll the
+	// action is taken on, or an empty string for actions not on a poll.
+	Authorize(ctx context.Context, guildID string, member Member, action Action, pollCreatorID string) error
+}
+
+type PolicyRepository interface {
+	// Save stores the policy, replacing any the guild had before.
+	Save(ctx context.Context, policy Policy) error
+	// GetByGuildID returns ErrPolicyNotFound if the guild's policy was never saved.
+	GetByGuildID(ctx context.Context, guildID string) (Policy, error)
+}
+
+var ErrPolicyNotFound = errors.New("permission policy not found")
+var ErrMissingGuild = errors.New("policy must belong to a guild")
+var ErrUnknownAction = errors.New("unknown action")
+var ErrTooManyRoles = errors.New("too many roles in a rule")
+var ErrInvalidPermissions = errors.New("invalid permissions")
+var ErrPermissionDenied = errors.New("permission denied")
+var ErrNotPollCreator = errors.New("only the poll creator or a moderator may resolve the poll")
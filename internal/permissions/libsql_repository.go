@@ -0,0 +1,127 @@
+package permissions
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+)
+
+type libSQLRepository struct {
+	db *sql.DB
+}
+
+func NewLibSQLRepository(db *sql.DB) PolicyRepository {
+	return &libSQLRepository{db: db}
+}
+
+func (repo *libSQLRepository) Save(ctx context.Context, policy Policy) error {
+	transaction, err := repo.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("error while starting transaction: %w", err)
+	}
+	defer transaction.Rollback()
+
+	query := `INSERT INTO guild_permission_policies (guild_id, creator_resolves) VALUES (?, ?)
+              ON CONFLICT (guild_id) DO UPDATE SET creator_resolves = excluded.creator_resolves`
+	if _, err := transaction.ExecContext(ctx, query, policy.GuildID, policy.CreatorResolves); err != nil {
+		return fmt.Errorf("error while saving policy: %w", err)
+	}
+
+	if _, err := transaction.ExecContext(ctx, "DELETE FROM guild_permission_rule_roles WHERE guild_id = ?", policy.GuildID); err != nil {
+		return fmt.Errorf("error while clearing rule roles: %w", err)
+	}
+	if _, err := transaction.ExecContext(ctx, "DELETE FROM guild_permission_rules WHERE guild_id = ?", policy.GuildID); err != nil {
+		return fmt.Errorf("error while clearing rules: %w", err)
+	}
+
+	for action, rule := range policy.Rules {
+		ruleQuery := "INSERT INTO guild_permission_rules (guild_id, action, everyone, moderators, permissions) VALUES (?, ?, ?, ?, ?)"
+		if _, err := transaction.ExecContext(ctx, ruleQuery, policy.GuildID, action, rule.Everyone, rule.Moderators, rule.Permissions); err != nil {
+			return fmt.Errorf("error while saving rule for %s: %w", action, err)
+		}
+
+		for index, roleID := range rule.RoleIDs {
+			roleQuery := "INSERT INTO guild_permission_rule_roles (guild_id, action, role_index, role_id) VALUES (?, ?, ?, ?)"
+			if _, err := transaction.ExecContext(ctx, roleQuery, policy.GuildID, action, index, roleID); err != nil {
+				return fmt.Errorf("error while saving role %s for %s: %w", roleID, action, err)
+			}
+		}
+	}
+
+	if err := transaction.Commit(); err != nil {
+		return fmt.Errorf("error while committing transaction: %w", err)
+	}
+
+	return nil
+}
+
+func (repo *libSQLRepository) GetByGuildID(ctx context.Context, guildID string) (Policy, error) {
+	policy := Policy{GuildID: guildID, Rules: make(map[Action]Rule)}
+
+	row := repo.db.QueryRowContext(ctx, "SELECT creator_resolves FROM guild_permission_policies WHERE guild_id = ?", guildID)
+	if err := row.Scan(&policy.CreatorResolves); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return Policy{}, ErrPolicyNotFound
+		}
+		return Policy{}, fmt.Errorf("error while scanning policy: %w", err)
+	}
+
+	if err := repo.fillRules(ctx, policy); err != nil {
+		return Policy{}, err
+	}
+	if err := repo.fillRuleRoles(ctx, policy); err != nil {
+		return Policy{}, err
+	}
+
+	return policy, nil
+}
+
+func (repo *libSQLRepository) fillRules(ctx context.Context, policy Policy) error {
+	rows, err := repo.db.QueryContext(ctx, "SELECT action, everyone, moderators, permissions FROM guild_permission_rules WHERE guild_id = ?", policy.GuildID)
+	if err != nil {
+		return fmt.Errorf("error while executing query: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var action Action
+		var rule Rule
+		if err := rows.Scan(&action, &rule.Everyone, &rule.Moderators, &rule.Permissions); err != nil {
+			return fmt.Errorf("error while scanning rule: %w", err)
+		}
+		policy.Rules[action] = rule
+	}
+
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("error during row iteration: %w", err)
+	}
+	return nil
+}
+
+func (repo *libSQLRepository) fillRuleRoles(ctx context.Context, policy Policy) error {
+	query := "SELECT action, role_id FROM guild_permission_rule_roles WHERE guild_id = ? ORDER BY action, role_index"
+	rows, err := repo.db.QueryContext(ctx, query, policy.GuildID)
+	if err != nil {
+		return fmt.Errorf("error while executing query: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var action Action
+		var roleID string
+		if err := rows.Scan(&action, &roleID); err != nil {
+			return fmt.Errorf("error while scanning rule role: %w", err)
+		}
+		rule := policy.Rules[action]
+		rule.RoleIDs = append(rule.RoleIDs, roleID)
+		policy.Rules[action] = rule
+	}
+
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("error during row iteration: %w", err)
+	}
+	return nil
+}
+
+var _ PolicyRepository = (*libSQLRepository)(nil)
@@ -0,0 +1,47 @@
+package permissions
+
+import (
+	"context"
+	"sync"
+)
+
+type memoryRepository struct {
+	mu       sync.Mutex
+	policies map[string]Policy
+}
+
+func NewMemoryRepository() PolicyRepository {
+	return &memoryRepository{
+		policies: make(map[string]Policy),
+	}
+}
+
+func (repo *memoryRepository) Save(ctx context.Context, policy Policy) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+
+	repo.policies[policy.GuildID] = policy.clone()
+	return nil
+}
+
+func (repo *memoryRepository) GetByGuildID(ctx context.Context, guildID string) (Policy, error) {
+	if err := ctx.Err(); err != nil {
+		return Policy{}, err
+	}
+
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+
+	policy, exists := repo.policies[guildID]
+	if !exists {
+		return Policy{}, ErrPolicyNotFound
+	}
+
+	return policy.clone(), nil
+}
+
+var _ PolicyRepository = (*memoryRepository)(nil)
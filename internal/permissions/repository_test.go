@@ -0,0 +1,178 @@
+package permissions
+
+import (
+	"errors"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+
+	"betting-discord-bot/internal/storage"
+)
+
+func setupLibSQL(t *testing.T) (PolicyRepository, func()) {
+	t.Helper()
+
+	// Sanitize the test name to create a clean, unique filename for each test run.
+	sanitizedTestName := strings.ReplaceAll(t.Name(), "/", "_")
+	dbPath := sanitizedTestName + ".db"
+
+	// Remove any old database file from a previous failed run.
+	_ = os.Remove(dbPath)
+
+	db, err := storage.InitializeDatabase(dbPath, "")
+	if err != nil {
+		t.Fatalf("Failed to initialize test database: %v", err)
+	}
+
+	repo := NewLibSQLRepository(db)
+
+	teardown := func() {
+		if err := db.Close(); err != nil {
+			t.Fatal("failed to close database")
+		}
+		if err := os.Remove(dbPath); err != nil {
+			t.Fatal("failed to remove database file")
+		}
+	}
+
+	return repo, teardown
+}
+
+func setupInMemory(t *testing.T) (PolicyRepository, func()) {
+	t.Helper()
+
+	repo := NewMemoryRepository()
+	teardown := func() {
+		// No cleanup needed for the in-memory version
+	}
+	return repo, teardown
+}
+
+func TestPolicyRepositoryImplementations(t *testing.T) {
+	t.Parallel()
+	implementations := []struct {
+		name  string
+		setup func(t *testing.T) (PolicyRepository, func())
+	}{
+		{name: "InMemoryRepository", setup: setupInMemory},
+		{name: "LibSQLRepository", setup: setupLibSQL},
+	}
+
+	testCases := []struct {
+		name string
+		run  func(t *testing.T, repo PolicyRepository)
+	}{
+		{"it should save and get a policy", testSaveAndGet},
+		{"it should replace a saved policy", testSaveReplaces},
+		{"it should return an error for a guild without a policy", testGetMissing},
+		{"it should keep each guild's policy apart", testGuildsKeptApart},
+	}
+
+	for _, impl := range implementations {
+		t.Run(impl.name, func(t *testing.T) {
+			t.Parallel()
+
+			for _, tc := range testCases {
+				t.Run(tc.name, func(t *testing.T) {
+					t.Parallel()
+
+					repo, cleanup := impl.setup(t)
+					t.Cleanup(cleanup)
+
+					tc.run(t, repo)
+				})
+			}
+		})
+	}
+}
+
+func newTestPolicy(guildID string) Policy {
+	return Policy{
+		GuildID: guildID,
+		Rules: map[Action]Rule{
+			CreatePoll:    {RoleIDs: []string{"host-b", "host-a"}},
+			ClosePoll:     {Moderators: true, RoleIDs: []string{"host-a"}},
+			ResolvePoll:   {Everyone: true},
+			AdjustBalance: {Permissions: ManageGuild | ManageMessages},
+		},
+		CreatorResolves: true,
+	}
+}
+
+func assertPolicy(t *testing.T, expected Policy, actual Policy) {
+	t.Helper()
+
+	if !reflect.DeepEqual(actual, expected) {
+		t.Errorf("Expected policy %+v, but got %+v", expected, actual)
+	}
+}
+
+func testSaveAndGet(t *testing.T, repo PolicyRepository) {
+	saved := newTestPolicy("guild")
+	if err := repo.Save(t.Context(), saved); err != nil {
+		t.Fatalf("Save() returned an unexpected error: %v", err)
+	}
+
+	retrieved, err := repo.GetByGuildID(t.Context(), "guild")
+	if err != nil {
+		t.Fatalf("GetByGuildID() returned an unexpected error: %v", err)
+	}
+	assertPolicy(t, saved, retrieved)
+
+	// Changing the retrieved policy must not change the saved one.
+	retrieved.Rules[CreatePoll] = Rule{Everyone: true}
+	if again, _ := repo.GetByGuildID(t.Context(), "guild"); again.Rules[CreatePoll].Everyone {
+		t.Error("Expected the saved policy to be unaffected by changes to a retrieved copy")
+	}
+}
+
+func testSaveReplaces(t *testing.T, repo PolicyRepository) {
+	if err := repo.Save(t.Context(), newTestPolicy("guild")); err != nil {
+		t.Fatalf("Save() returned an unexpected error: %v", err)
+	}
+
+	replacement := Policy{
+		GuildID: "guild",
+		Rules: map[Action]Rule{
+			CreatePoll: {RoleIDs: []string{"host-c"}},
+		},
+	}
+	if err := repo.Save(t.Context(), replacement); err != nil {
+		t.Fatalf("Save() returned an unexpected error: %v", err)
+	}
+
+	retrieved, err := repo.GetByGuildID(t.Context(), "guild")
+	if err != nil {
+		t.Fatalf("GetByGuildID() returned an unexpected error: %v", err)
+	}
+	assertPolicy(t, replacement, retrieved)
+}
+
+func testGetMissing(t *testing.T, repo PolicyRepository) {
+	if _, err := repo.GetByGuildID(t.Context(), "missing"); !errors.Is(err, ErrPolicyNotFound) {
+		t.Errorf("Expected ErrPolicyNotFound, but got %v", err)
+	}
+}
+
+func testGuildsKeptApart(t *testing.T, repo PolicyRepository) {
+	first := newTestPolicy("first")
+	second := Policy{GuildID: "second", Rules: map[Action]Rule{VoidPoll: {Everyone: true}}}
+	for _, saved := range []Policy{first, second} {
+		if err := repo.Save(t.Context(), saved); err != nil {
+			t.Fatalf("Save() returned an unexpected error: %v", err)
+		}
+	}
+
+	retrieved, err := repo.GetByGuildID(t.Context(), "first")
+	if err != nil {
+		t.Fatalf("GetByGuildID() returned an unexpected error: %v", err)
+	}
+	assertPolicy(t, first, retrieved)
+
+	retrieved, err = repo.GetByGuildID(t.Context(), "second")
+	if err != nil {
+		t.Fatalf("GetByGuildID() returned an unexpected error: %v", err)
+	}
+	assertPolicy(t, second, retrieved)
+}
@@ -0,0 +1,108 @@
+package permissions
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+
+	"betting-discord-bot/internal/settings"
+)
+
+type service struct {
+	policyRepo      PolicyRepository
+	settingsService settings.SettingsService
+}
+
+// NewService returns a service that takes the moderator roles of each guild
+// from its settings.
+func NewService(policyRepo PolicyRepository, settingsService settings.SettingsService) PermissionService {
+	return &service{
+		policyRepo:      policyRepo,
+		settingsService: settingsService,
+	}
+}
+
+func (s *service) GetPolicy(ctx context.Context, guildID string) (Policy, error) {
+	policy, err := s.policyRepo.GetByGuildID(ctx, guildID)
+	if errors.Is(err, ErrPolicyNotFound) {
+		return Policy{GuildID: guildID, Rules: DefaultRules()}, nil
+	}
+	if err != nil {
+		return Policy{}, fmt.Errorf("failed to get permission policy of guild %s: %w", guildID, err)
+	}
+
+	if policy.Rules == nil {
+		policy.Rules = make(map[Action]Rule)
+	}
+	for action, rule := range DefaultRules() {
+		if _, exists := policy.Rules[action]; !exists {
+			policy.Rules[action] = rule
+		}
+	}
+
+	return policy, nil
+}
+
+func (s *service) UpdatePolicy(ctx context.Context, policy Policy) error {
+	if err := validate(policy); err != nil {
+		return err
+	}
+
+	if err := s.policyRepo.Save(ctx, policy); err != nil {
+		return fmt.Errorf("failed to save permission policy of guild %s: %w", policy.GuildID, err)
+	}
+
+	return nil
+}
+
+func (s *service) Authorize(ctx context.Context, guildID string, member Member, action Action, pollCreatorID string) error {
+	policy, err := s.GetPolicy(ctx, guildID)
+	if err != nil {
+		return err
+	}
+
+	guildSettings, err := s.settingsService.GetSettings(ctx, guildID)
+	if err != nil {
+		return fmt.Errorf("failed to get moderator roles: %w", err)
+	}
+	moderator := isModerator(member, guildSettings)
+
+	if !policy.Rule(action).Allows(member, moderator) {
+		return ErrPermissionDenied
+	}
+
+	// Polls created before creators were recorded have no creator to match.
+	if action == ResolvePoll && policy.CreatorResolves && !moderator && (pollCreatorID == "" || member.UserID != pollCreatorID) {
+		return ErrNotPollCreator
+	}
+
+	return nil
+}
+
+// isModerator reports whether the member may manage polls, either through the
+// Manage Messages permission or one of the guild's moderator roles.
+func isModerator(member Member, guildSettings settings.Settings) bool {
+	if member.Permissions&ManageMessages == ManageMessages {
+		return true
+	}
+	return slices.ContainsFunc(member.RoleIDs, guildSettings.IsModeratorRole)
+}
+
+func validate(policy Policy) error {
+	if policy.GuildID == "" {
+		return ErrMissingGuild
+	}
+
+	for action, rule := range policy.Rules {
+		switch {
+		case !slices.Contains(Actions, action):
+			return fmt.Errorf("%w: %s", ErrUnknownAction, action)
+		case len(rule.RoleIDs) > MaxRuleRoles:
+			return ErrTooManyRoles
+		case rule.Permissions < 0:
+			return ErrInvalidPermissions
+		}
+	}
+	return nil
+}
@@ -0,0 +1,137 @@
+package permissions
+
+import (
+	"errors"
+	"testing"
+
+	"betting-discord-bot/internal/settings"
+)
+
+const testGuildID = "guild"
+
+func setupService(t *testing.T) (PermissionService, settings.SettingsService) {
+	t.Helper()
+
+	settingsService := settings.NewService(settings.NewMemoryRepository(), settings.Settings{Locale: "en-US"})
+	return NewService(NewMemoryRepository(), settingsService), settingsService
+}
+
+func TestGuildWithoutPolicyGetsDefaultRules(t *testing.T) {
+	t.Parallel()
+	permissionService, _ := setupService(t)
+
+	policy, err := permissionService.GetPolicy(t.Context(), testGuildID)
+	if err != nil {
+		t.Fatal("GetPolicy returned an unexpected error:", err)
+	}
+
+	assertPolicy(t, Policy{GuildID: testGuildID, Rules: DefaultRules()}, policy)
+}
+
+func TestSavedPolicyKeepsDefaultsForOtherActions(t *testing.T) {
+	t.Parallel()
+	permissionService, _ := setupService(t)
+
+	updated := Policy{GuildID: testGuildID, Rules: map[Action]Rule{CreatePoll: {RoleIDs: []string{"host"}}}}
+	if err := permissionService.UpdatePolicy(t.Context(), updated); err != nil {
+		t.Fatal("UpdatePolicy returned an unexpected error:", err)
+	}
+
+	policy, err := permissionService.GetPolicy(t.Context(), testGuildID)
+	if err != nil {
+		t.Fatal("GetPolicy returned an unexpected error:", err)
+	}
+
+	expected := Policy{GuildID: testGuildID, Rules: DefaultRules()}
+	expected.Rules[CreatePoll] = Rule{RoleIDs: []string{"host"}}
+	assertPolicy(t, expected, policy)
+}
+
+func TestRejectsInvalidPolicies(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name     string
+		policy   Policy
+		expected error
+	}{
+		{"Missing Guild", Policy{Rules: DefaultRules()}, ErrMissingGuild},
+		{"Unknown Action", Policy{GuildID: testGuildID, Rules: map[Action]Rule{"ban_member": {Everyone: true}}}, ErrUnknownAction},
+		{"Too Many Roles", Policy{GuildID: testGuildID, Rules: map[Action]Rule{
+			CreatePoll: {RoleIDs: make([]string, MaxRuleRoles+1)},
+		}}, ErrTooManyRoles},
+		{"Negative Permissions", Policy{GuildID: testGuildID, Rules: map[Action]Rule{VoidPoll: {Permissions: -1}}}, ErrInvalidPermissions},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			permissionService, _ := setupService(t)
+
+			if err := permissionService.UpdatePolicy(t.Context(), tc.policy); !errors.Is(err, tc.expected) {
+				t.Errorf("Expected %v, but got %v", tc.expected, err)
+			}
+		})
+	}
+}
+
+func TestAuthorize(t *testing.T) {
+	t.Parallel()
+
+	member := Member{UserID: "member"}
+	moderator := Member{UserID: "moderator", Permissions: ManageMessages}
+	roleModerator := Member{UserID: "role moderator", RoleIDs: []string{"referee"}}
+	host := Member{UserID: "host", RoleIDs: []string{"host"}}
+	admin := Member{UserID: "admin", Permissions: ManageGuild}
+
+	customRules := DefaultRules()
+	customRules[CreatePoll] = Rule{RoleIDs: []string{"host"}}
+	customRules[ResolvePoll] = Rule{Moderators: true, RoleIDs: []string{"host"}}
+	customPolicy := Policy{GuildID: testGuildID, Rules: customRules, CreatorResolves: true}
+
+	testCases := []struct {
+		name          string
+		policy        *Policy
+		member        Member
+		action        Action
+		pollCreatorID string
+		expected      error
+	}{
+		{name: "Anyone Creates Polls By Default", member: member, action: CreatePoll},
+		{name: "Members Cannot Close Polls By Default", member: member, action: ClosePoll, expected: ErrPermissionDenied},
+		{name: "Manage Messages Closes Polls", member: moderator, action: ClosePoll},
+		{name: "Moderator Role Voids Polls", member: roleModerator, action: VoidPoll},
+		{name: "Moderators Cannot Adjust Balances By Default", member: moderator, action: AdjustBalance, expected: ErrPermissionDenied},
+		{name: "Manage Server Adjusts Balances", member: admin, action: AdjustBalance},
+		{name: "Creating Polls Restricted To A Role", policy: &customPolicy, member: member, action: CreatePoll, expected: ErrPermissionDenied},
+		{name: "Role Creates Polls", policy: &customPolicy, member: host, action: CreatePoll},
+		{name: "Creator Resolves Own Poll", policy: &customPolicy, member: host, action: ResolvePoll, pollCreatorID: "host"},
+		{name: "Creator Cannot Resolve Another's Poll", policy: &customPolicy, member: host, action: ResolvePoll, pollCreatorID: "someone else", expected: ErrNotPollCreator},
+		{name: "Poll Without Creator Needs A Moderator", policy: &customPolicy, member: host, action: ResolvePoll, expected: ErrNotPollCreator},
+		{name: "Moderator Resolves Any Poll", policy: &customPolicy, member: roleModerator, action: ResolvePoll, pollCreatorID: "host"},
+		{name: "Creator Still Needs The Rule", policy: &customPolicy, member: member, action: ResolvePoll, pollCreatorID: "member", expected: ErrPermissionDenied},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			permissionService, settingsService := setupService(t)
+
+			guildSettings := settingsService.Defaults(testGuildID)
+			guildSettings.ModeratorRoleIDs = []string{"referee"}
+			if err := settingsService.UpdateSettings(t.Context(), guildSettings); err != nil {
+				t.Fatal("UpdateSettings returned an unexpected error:", err)
+			}
+			if tc.policy != nil {
+				if err := permissionService.UpdatePolicy(t.Context(), *tc.policy); err != nil {
+					t.Fatal("UpdatePolicy returned an unexpected error:", err)
+				}
+			}
+
+			err := permissionService.Authorize(t.Context(), testGuildID, tc.member, tc.action, tc.pollCreatorID)
+			if !errors.Is(err, tc.expected) {
+				t.Errorf("Expected %v, but got %v", tc.expected, err)
+			}
+		})
+	}
+}
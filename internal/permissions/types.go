@@ -0,0 +1,117 @@
+package permissions
+
+import "slices"
+
+// Action is something a member does that a guild may restrict.
+type Action string
+
+const (
+	CreatePoll  Action = "create_poll"
+	ClosePoll   Action = "close_poll"
+	ResolvePoll Action = "resolve_poll"
+	// VoidPoll cancels a poll and refunds every bet on it.
+	VoidPoll Action = "void_poll"
+	// AdjustBalance gives points to or takes points from a member.
+	AdjustBalance Action = "adjust_balance"
+	// ViewLedger lists every point movement of a member.
+	ViewLedger Action = "view_ledger"
+)
+
+// Actions lists every action a policy has a rule for.
+var Actions = []Action{CreatePoll, ClosePoll, ResolvePoll, VoidPoll, AdjustBalance, ViewLedger}
+
+// Discord permission bits the default policy relies on.
+const (
+	ManageGuild    int64 = 1 << 5
+	ManageMessages int64 = 1 << 13
+)
+
+// Rule says who may take an action. A member may take it if any part of the
+// rule lets them.
+type Rule struct {
+	// Everyone lets every member take the action.
+	Everyone bool
+	// Moderators lets members with the Manage Messages permission or one of
+	// the guild's moderator roles take the action.
+	Moderators bool
+	// RoleIDs lets members with any of the roles take the action.
+	RoleIDs []string
+	// Permissions lets members with all of these Discord permissions take the
+	// action. Zero lets nobody in through their permissions.
+	Permissions int64
+}
+
+// Allows reports whether the rule lets the member take the action.
+func (rule Rule) Allows(member Member, moderator bool) bool {
+	switch {
+	case rule.Everyone:
+		return true
+	case rule.Moderators && moderator:
+		return true
+	case rule.Permissions != 0 && member.Permissions&rule.Permissions == rule.Permissions:
+		return true
+	}
+
+	for _, roleID := range member.RoleIDs {
+		if slices.Contains(rule.RoleIDs, roleID) {
+			return true
+		}
+	}
+	return false
+}
+
+func (rule Rule) clone() Rule {
+	rule.RoleIDs = slices.Clone(rule.RoleIDs)
+	return rule
+}
+
+// Policy decides who may take each action in a guild.
+type Policy struct {
+	GuildID string
+	Rules   map[Action]Rule
+	// CreatorResolves lets only the creator of a poll or a moderator resolve
+	// it, even if the rule for resolving lets other members in.
+	CreatorResolves bool
+}
+
+// Rule returns the rule for the action. Actions without a rule are taken by
+// nobody.
+func (policy Policy) Rule(action Action) Rule {
+	return policy.Rules[action]
+}
+
+func (policy Policy) clone() Policy {
+	rules := make(map[Action]Rule, len(policy.Rules))
+	for action, rule := range policy.Rules {
+		rules[action] = rule.clone()
+	}
+	policy.Rules = rules
+	return policy
+}
+
+// DefaultRules are the rules of a guild that has not changed its policy:
+// everyone may create polls, moderators may close, resolve and void them and
+// view ledgers, and only members who can manage the server may adjust
+// balances.
+func DefaultRules() map[Action]Rule {
+	return map[Action]Rule{
+		CreatePoll:    {Everyone: true},
+		ClosePoll:     {Moderators: true},
+		ResolvePoll:   {Moderators: true},
+		VoidPoll:      {Moderators: true},
+		AdjustBalance: {Permissions: ManageGuild},
+		ViewLedger:    {Moderators: true},
+	}
+}
+
+// Member is who is asking to take an action.
+type Member struct {
+	// UserID is the member's user, compared against the creator of a poll.
+	UserID  string
+	RoleIDs []string
+	// Permissions are the member's Discord permissions in the channel.
+	Permissions int64
+}
+
+// MaxRuleRoles is how many roles a single rule may list.
+const MaxRuleRoles = 10
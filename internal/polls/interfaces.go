@@ -1,21 +1,64 @@
 package polls
 
-import "errors"
+import (
+	"context"
+	"errors"
+	"time"
+
+	"betting-discord-bot/internal/storage"
+)
 
 type PollService interface {
-	CreatePoll(title string, options []string) (Poll, error)
-	ClosePoll(pollID string) error
-	SelectOutcome(pollID string, outcomeIndex OutcomeStatus) error
-	GetPollById(id string) (Poll, error)
-	GetOpenPolls() ([]Poll, error)
+	// CreatePoll opens a new poll in the guild. Pass the zero time for closesAt
+	// if the poll should stay open until it is closed by hand, and an empty
+	// category for an uncategorised poll.
+	CreatePoll(ctx context.Context, guildID string, creatorID string, title string, options []string, closesAt time.Time, category string) (Poll, error)
+	ClosePoll(ctx context.Context, pollID string) error
+	// CancelPoll calls off an open or closed poll and clears its outcome.
+	CancelPoll(ctx context.Context, pollID string) error
+	SelectOutcome(ctx context.Context, pollID string, outcomeIndex OutcomeStatus) error
+	// CorrectOutcome replaces the outcome of a resolved poll and records who changed it.
+	CorrectOutcome(ctx context.Context, pollID string, newOutcome OutcomeStatus, correctedBy string) (OutcomeCorrection, error)
+	// GetOutcomeCorrections returns the corrections made to the poll, oldest first.
+	GetOutcomeCorrections(ctx context.Context, pollID string) ([]OutcomeCorrection, error)
+	// GetOutcomeCorrectionsByUser returns the corrections the user made to any
+	// poll, oldest first.
+	GetOutcomeCorrectionsByUser(ctx context.Context, userID string) ([]OutcomeCorrection, error)
+	GetPollById(ctx context.Context, id string) (Poll, error)
+	// GetOpenPolls returns the open polls of the guild, or of every guild if
+	// guildID is empty.
+	GetOpenPolls(ctx context.Context, guildID string) ([]Poll, error)
+	ListPolls(ctx context.Context, query PollQuery) (PollPage, error)
+	// WithTx returns the service with its changes made as part of the unit of work.
+	WithTx(tx *storage.Tx) PollService
 }
 
 type PollRepository interface {
-	Save(poll *poll) error
-	GetById(id string) (*poll, error)
-	GetOpenPolls() ([]*poll, error)
-	Update(poll *poll) error
-	Delete(pollID string) error
+	// WithTx returns the repository with its reads and writes made as part of
+	// the unit of work.
+	WithTx(tx *storage.Tx) PollRepository
+	Save(ctx context.Context, poll *poll) error
+	GetById(ctx context.Context, id string) (*poll, error)
+	GetOpenPolls(ctx context.Context, guildID string) ([]*poll, error)
+	// List returns a page of the polls matching the query and the number of
+	// matching polls across every page.
+	List(ctx context.Context, query PollQuery) ([]*poll, int, error)
+	Update(ctx context.Context, poll *poll) error
+	// Delete deletes the poll along with its options and outcome corrections.
+	// Its bets and message are deleted with it where they share storage.
+	Delete(ctx context.Context, pollID string) error
+	// SaveOutcomeCorrection updates the poll and records the correction in a single transaction.
+	SaveOutcomeCorrection(ctx context.Context, poll *poll, correction OutcomeCorrection) error
+	GetOutcomeCorrections(ctx context.Context, pollID string) ([]OutcomeCorrection, error)
+	GetOutcomeCorrectionsByUser(ctx context.Context, userID string) ([]OutcomeCorrection, error)
 }
 
 var ErrPollIsAlreadyClosed = errors.New("poll is already closed")
+var ErrPollIsAlreadyCancelled = errors.New("poll is already cancelled")
+var ErrInvalidOptionCount = errors.New("poll must have between 2 and 25 options")
+var ErrInvalidPollQuery = errors.New("invalid poll query")
+var ErrCategoryTooLong = errors.New("poll category is too long")
+var ErrDeadlineInPast = errors.New("poll deadline is in the past")
+var ErrOutcomeNotSelected = errors.New("poll outcome has not been selected")
+var ErrOutcomeUnchanged = errors.New("poll already has this outcome")
+var ErrInvalidOutcome = errors.New("outcome does not match any poll option")
@@ -1,38 +1,51 @@
 package polls
 
 import (
+	"context"
 	"database/sql"
 	"errors"
 	"fmt"
+	"strings"
+	"time"
+
+	"betting-discord-bot/internal/storage"
 )
 
 type libSQLRepository struct {
-	db *sql.DB
+	db storage.DBTX
 }
 
 func NewLibSQLRepository(db *sql.DB) PollRepository {
 	return &libSQLRepository{db: db}
 }
 
-func (repo *libSQLRepository) Save(poll *poll) error {
-	if err := saveToPollsTable(poll, repo); err != nil {
-		return fmt.Errorf("save polls table failed: %w", err)
-	}
+func (repo *libSQLRepository) WithTx(tx *storage.Tx) PollRepository {
+	return &libSQLRepository{db: tx.Conn(repo.db)}
+}
 
-	if err := saveToOptionsTable(poll, repo); err != nil {
-		return fmt.Errorf("save options table failed: %w", err)
-	}
+func (repo *libSQLRepository) Save(ctx context.Context, poll *poll) error {
+	return storage.InTransaction(ctx, repo.db, func(tx storage.DBTX) error {
+		txRepo := &libSQLRepository{db: tx}
 
-	return nil
+		if err := saveToPollsTable(ctx, poll, txRepo); err != nil {
+			return fmt.Errorf("save polls table failed: %w", err)
+		}
+
+		if err := saveToOptionsTable(ctx, poll, txRepo); err != nil {
+			return fmt.Errorf("save options table failed: %w", err)
+		}
+
+		return nil
+	})
 }
 
-func saveToPollsTable(poll *poll, repo *libSQLRepository) error {
-	query := "INSERT INTO polls (id, title, status, outcome) VALUES (?, ?, ?, ?)"
-	preparedStatement, prepareError := repo.db.Prepare(query)
+func saveToPollsTable(ctx context.Context, poll *poll, repo *libSQLRepository) error {
+	query := "INSERT INTO polls (id, guild_id, creator_id, title, status, outcome, closes_at, category, created_at, closed_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)"
+	preparedStatement, prepareError := repo.db.PrepareContext(ctx, query)
 	if prepareError != nil {
 		return fmt.Errorf("error while preparing statement: %w", prepareError)
 	}
-	if result, execErr := preparedStatement.Exec(poll.ID, poll.Title, poll.Status, poll.Outcome); execErr != nil {
+	if result, execErr := preparedStatement.ExecContext(ctx, poll.ID, poll.GuildID, poll.CreatorID, poll.Title, poll.Status, poll.Outcome, toNullUnix(poll.ClosesAt), poll.Category, toNullUnix(poll.CreatedAt), toNullUnix(poll.ClosedAt)); execErr != nil {
 		return fmt.Errorf("error while executing statement: %w", execErr)
 	} else {
 		rowsAffected, _ := result.RowsAffected()
@@ -43,15 +56,15 @@ func saveToPollsTable(poll *poll, repo *libSQLRepository) error {
 	return nil
 }
 
-func saveToOptionsTable(poll *poll, repo *libSQLRepository) error {
+func saveToOptionsTable(ctx context.Context, poll *poll, repo *libSQLRepository) error {
 	query := "INSERT INTO poll_options (poll_id, option_index, option_text) VALUES (?, ?, ?)"
-	preparedStatement, prepareError := repo.db.Prepare(query)
+	preparedStatement, prepareError := repo.db.PrepareContext(ctx, query)
 	if prepareError != nil {
 		return fmt.Errorf("error while preparing statement: %w", prepareError)
 	}
 
 	for index, option := range poll.Options {
-		if result, execErr := preparedStatement.Exec(poll.ID, index, option); execErr != nil {
+		if result, execErr := preparedStatement.ExecContext(ctx, poll.ID, index, option); execErr != nil {
 			return fmt.Errorf("error while executing statement for option %d: %w", index, execErr)
 		} else {
 			rowsAffected, _ := result.RowsAffected()
@@ -64,14 +77,14 @@ func saveToOptionsTable(poll *poll, repo *libSQLRepository) error {
 	return nil
 }
 
-func (repo *libSQLRepository) GetById(id string) (*poll, error) {
-	poll, pollErr := getFromPollTable(id, repo)
+func (repo *libSQLRepository) GetById(ctx context.Context, id string) (*poll, error) {
+	poll, pollErr := getFromPollTable(ctx, id, repo)
 	if pollErr != nil {
 		return nil, fmt.Errorf("error while getting poll from polls table: %w", pollErr)
 	}
 
 	var optionsErr error
-	poll.Options, optionsErr = getFromOptionsTable(id, repo)
+	poll.Options, optionsErr = getFromOptionsTable(ctx, id, repo)
 	if optionsErr != nil {
 		return nil, fmt.Errorf("error while getting options from options table: %w", optionsErr)
 	}
@@ -79,32 +92,36 @@ func (repo *libSQLRepository) GetById(id string) (*poll, error) {
 	return poll, nil
 }
 
-func getFromPollTable(id string, repo *libSQLRepository) (*poll, error) {
-	query := "SELECT id, title, status, outcome FROM polls WHERE id = ?"
-	preparedStatement, err := repo.db.Prepare(query)
+func getFromPollTable(ctx context.Context, id string, repo *libSQLRepository) (*poll, error) {
+	query := "SELECT id, guild_id, creator_id, title, status, outcome, closes_at, category, created_at, closed_at FROM polls WHERE id = ?"
+	preparedStatement, err := repo.db.PrepareContext(ctx, query)
 	if err != nil {
 		return nil, fmt.Errorf("error while preparing statement: %w", err)
 	}
 
-	row := preparedStatement.QueryRow(id)
+	row := preparedStatement.QueryRowContext(ctx, id)
 	poll := &poll{}
-	if err := row.Scan(&poll.ID, &poll.Title, &poll.Status, &poll.Outcome); err != nil {
+	var closesAt, createdAt, closedAt sql.NullInt64
+	if err := row.Scan(&poll.ID, &poll.GuildID, &poll.CreatorID, &poll.Title, &poll.Status, &poll.Outcome, &closesAt, &poll.Category, &createdAt, &closedAt); err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return nil, fmt.Errorf("poll with id %s not found", id)
 		}
 		return nil, fmt.Errorf("error while scanning row: %w", err)
 	}
+	poll.ClosesAt = fromNullUnix(closesAt)
+	poll.CreatedAt = fromNullUnix(createdAt)
+	poll.ClosedAt = fromNullUnix(closedAt)
 	return poll, nil
 }
 
-func getFromOptionsTable(pollID string, repo *libSQLRepository) ([]string, error) {
+func getFromOptionsTable(ctx context.Context, pollID string, repo *libSQLRepository) ([]string, error) {
 	query := "SELECT option_text FROM poll_options WHERE poll_id = ? ORDER BY option_index"
-	preparedStatement, preparedErr := repo.db.Prepare(query)
+	preparedStatement, preparedErr := repo.db.PrepareContext(ctx, query)
 	if preparedErr != nil {
 		return nil, fmt.Errorf("error while preparing statement: %w", preparedErr)
 	}
 
-	rows, rowErr := preparedStatement.Query(pollID)
+	rows, rowErr := preparedStatement.QueryContext(ctx, pollID)
 	if rowErr != nil {
 		return nil, fmt.Errorf("error while executing query: %w", rowErr)
 	}
@@ -125,14 +142,20 @@ func getFromOptionsTable(pollID string, repo *libSQLRepository) ([]string, error
 	return options, nil
 }
 
-func (repo *libSQLRepository) Update(poll *poll) error {
-	query := "UPDATE polls SET title = ?, status = ?, outcome = ? WHERE id = ?"
-	preparedStatement, prepareError := repo.db.Prepare(query)
+func (repo *libSQLRepository) Update(ctx context.Context, poll *poll) error {
+	return storage.InTransaction(ctx, repo.db, func(tx storage.DBTX) error {
+		return updatePoll(ctx, poll, &libSQLRepository{db: tx})
+	})
+}
+
+func updatePoll(ctx context.Context, poll *poll, repo *libSQLRepository) error {
+	query := "UPDATE polls SET title = ?, status = ?, outcome = ?, closes_at = ?, category = ?, closed_at = ? WHERE id = ?"
+	preparedStatement, prepareError := repo.db.PrepareContext(ctx, query)
 	if prepareError != nil {
 		return fmt.Errorf("error while preparing statement: %w", prepareError)
 	}
 
-	result, execErr := preparedStatement.Exec(poll.Title, poll.Status, poll.Outcome, poll.ID)
+	result, execErr := preparedStatement.ExecContext(ctx, poll.Title, poll.Status, poll.Outcome, toNullUnix(poll.ClosesAt), poll.Category, toNullUnix(poll.ClosedAt), poll.ID)
 	if execErr != nil {
 		return fmt.Errorf("error while executing statement: %w", execErr)
 	}
@@ -143,12 +166,12 @@ func (repo *libSQLRepository) Update(poll *poll) error {
 	}
 
 	query = "UPDATE poll_options SET option_text = ? WHERE poll_id = ? AND option_index = ?"
-	preparedStatement, prepareError = repo.db.Prepare(query)
+	preparedStatement, prepareError = repo.db.PrepareContext(ctx, query)
 	if prepareError != nil {
 		return fmt.Errorf("error while preparing statement for options: %w", prepareError)
 	}
 	for index, option := range poll.Options {
-		result, execErr := preparedStatement.Exec(option, poll.ID, index)
+		result, execErr := preparedStatement.ExecContext(ctx, option, poll.ID, index)
 		if execErr != nil {
 			return fmt.Errorf("error while executing statement for option %d: %w", index, execErr)
 		}
@@ -161,28 +184,20 @@ func (repo *libSQLRepository) Update(poll *poll) error {
 	return nil
 }
 
-func (repo *libSQLRepository) Delete(pollID string) error {
-	pollErr := deletePoll(pollID, repo)
-	if pollErr != nil {
-		return pollErr
-	}
-
-	pollOptionsErr := deletePollOptions(pollID, repo)
-	if pollOptionsErr != nil {
-		return pollOptionsErr
-	}
-
-	return nil
+// Delete deletes the poll. Its options, bets, outcome corrections and message
+// are deleted with it by their foreign keys.
+func (repo *libSQLRepository) Delete(ctx context.Context, pollID string) error {
+	return deletePoll(ctx, pollID, repo)
 }
 
-func deletePoll(pollID string, repo *libSQLRepository) error {
+func deletePoll(ctx context.Context, pollID string, repo *libSQLRepository) error {
 	query := "DELETE FROM polls WHERE id = ?"
-	preparedStatement, prepareError := repo.db.Prepare(query)
+	preparedStatement, prepareError := repo.db.PrepareContext(ctx, query)
 	if prepareError != nil {
 		return fmt.Errorf("error while preparing statement: %w", prepareError)
 	}
 
-	result, execErr := preparedStatement.Exec(pollID)
+	result, execErr := preparedStatement.ExecContext(ctx, pollID)
 	if execErr != nil {
 		return fmt.Errorf("error while executing delete statement: %w", execErr)
 	}
@@ -194,34 +209,15 @@ func deletePoll(pollID string, repo *libSQLRepository) error {
 	return nil
 }
 
-func deletePollOptions(pollID string, repo *libSQLRepository) error {
-	query := "DELETE FROM poll_options WHERE poll_id = ?"
-	preparedStatement, prepareError := repo.db.Prepare(query)
-	if prepareError != nil {
-		return fmt.Errorf("error while preparing statement for options: %w", prepareError)
-	}
-
-	result, execErr := preparedStatement.Exec(pollID)
-	if execErr != nil {
-		return fmt.Errorf("error while executing delete statement for options: %w", execErr)
-	}
-
-	rowsAffected, _ := result.RowsAffected()
-	if rowsAffected == 0 {
-		return fmt.Errorf("no rows were affected by the delete operation for options of poll ID %s", pollID)
-	}
-	return nil
-}
-
-func (repo *libSQLRepository) GetOpenPolls() ([]*poll, error) {
+func (repo *libSQLRepository) GetOpenPolls(ctx context.Context, guildID string) ([]*poll, error) {
 	// Getting IDs instead of polls because poll query is complicated and already exists in GetPollByID
-	query := "SELECT id FROM polls WHERE status = ?"
-	preparedStatement, preparedErr := repo.db.Prepare(query)
+	query := "SELECT id FROM polls WHERE status = ? AND (? = '' OR guild_id = ?)"
+	preparedStatement, preparedErr := repo.db.PrepareContext(ctx, query)
 	if preparedErr != nil {
 		return nil, fmt.Errorf("error while preparing statement: %w", preparedErr)
 	}
 
-	rows, rowErr := preparedStatement.Query(Open)
+	rows, rowErr := preparedStatement.QueryContext(ctx, Open, guildID, guildID)
 	if rowErr != nil {
 		return nil, fmt.Errorf("error while executing query: %w", rowErr)
 	}
@@ -239,7 +235,7 @@ func (repo *libSQLRepository) GetOpenPolls() ([]*poll, error) {
 	// Request Polls with those IDs
 	var openPolls []*poll
 	for _, id := range openPollIDs {
-		poll, err := repo.GetById(id)
+		poll, err := repo.GetById(ctx, id)
 		if err != nil {
 			return nil, fmt.Errorf("error while getting poll by ID: %w", err)
 		}
@@ -248,3 +244,186 @@ func (repo *libSQLRepository) GetOpenPolls() ([]*poll, error) {
 
 	return openPolls, nil
 }
+
+func (repo *libSQLRepository) List(ctx context.Context, query PollQuery) ([]*poll, int, error) {
+	var conditions []string
+	var args []any
+	if query.GuildID != "" {
+		conditions = append(conditions, "guild_id = ?")
+		args = append(args, query.GuildID)
+	}
+	if query.CreatorID != "" {
+		conditions = append(conditions, "creator_id = ?")
+		args = append(args, query.CreatorID)
+	}
+	if len(query.Statuses) > 0 {
+		placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(query.Statuses)), ", ")
+		conditions = append(conditions, "status IN ("+placeholders+")")
+		for _, status := range query.Statuses {
+			args = append(args, status)
+		}
+	}
+	if !query.ClosedSince.IsZero() {
+		conditions = append(conditions, "(status = ? OR closed_at >= ?)")
+		args = append(args, Open, query.ClosedSince.Unix())
+	}
+
+	where := ""
+	if len(conditions) > 0 {
+		where = "WHERE " + strings.Join(conditions, " AND ")
+	}
+
+	statement := `SELECT id, guild_id, creator_id, title, status, outcome, closes_at, category, created_at, closed_at,
+                         COUNT(*) OVER () AS total
+                  FROM polls ` + where + `
+                  ORDER BY status = ? DESC, COALESCE(created_at, 0) DESC, id
+                  LIMIT ? OFFSET ?`
+	rows, err := repo.db.QueryContext(ctx, statement, append(args, Open, query.Limit, query.Offset)...)
+	if err != nil {
+		return nil, 0, fmt.Errorf("error while executing query: %w", err)
+	}
+	defer rows.Close()
+
+	var polls []*poll
+	var pollIDs []any
+	total := 0
+	for rows.Next() {
+		poll := &poll{}
+		var closesAt, createdAt, closedAt sql.NullInt64
+		if err := rows.Scan(&poll.ID, &poll.GuildID, &poll.CreatorID, &poll.Title, &poll.Status, &poll.Outcome, &closesAt, &poll.Category, &createdAt, &closedAt, &total); err != nil {
+			return nil, 0, fmt.Errorf("error while scanning row: %w", err)
+		}
+		poll.ClosesAt = fromNullUnix(closesAt)
+		poll.CreatedAt = fromNullUnix(createdAt)
+		poll.ClosedAt = fromNullUnix(closedAt)
+		polls = append(polls, poll)
+		pollIDs = append(pollIDs, poll.ID)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, 0, fmt.Errorf("error while iterating over rows: %w", err)
+	}
+
+	if len(polls) == 0 {
+		// A page past the end has no rows to carry the total.
+		countStatement := "SELECT COUNT(*) FROM polls " + where
+		if err := repo.db.QueryRowContext(ctx, countStatement, args...).Scan(&total); err != nil {
+			return nil, 0, fmt.Errorf("error while counting polls: %w", err)
+		}
+		return nil, total, nil
+	}
+
+	if err := repo.fillOptions(ctx, polls, pollIDs); err != nil {
+		return nil, 0, err
+	}
+
+	return polls, total, nil
+}
+
+// fillOptions loads the options of every poll on a page in a single query.
+func (repo *libSQLRepository) fillOptions(ctx context.Context, polls []*poll, pollIDs []any) error {
+	placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(pollIDs)), ", ")
+	query := "SELECT poll_id, option_text FROM poll_options WHERE poll_id IN (" + placeholders + ") ORDER BY poll_id, option_index"
+	rows, err := repo.db.QueryContext(ctx, query, pollIDs...)
+	if err != nil {
+		return fmt.Errorf("error while executing query: %w", err)
+	}
+	defer rows.Close()
+
+	options := make(map[string][]string)
+	for rows.Next() {
+		var pollID, option string
+		if err := rows.Scan(&pollID, &option); err != nil {
+			return fmt.Errorf("error while scanning row: %w", err)
+		}
+		options[pollID] = append(options[pollID], option)
+	}
+
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("error while iterating over rows: %w", err)
+	}
+
+	for _, poll := range polls {
+		poll.Options = options[poll.ID]
+	}
+
+	return nil
+}
+
+func (repo *libSQLRepository) SaveOutcomeCorrection(ctx context.Context, poll *poll, correction OutcomeCorrection) error {
+	return storage.InTransaction(ctx, repo.db, func(transaction storage.DBTX) error {
+		result, execErr := transaction.ExecContext(ctx, "UPDATE polls SET outcome = ? WHERE id = ?", poll.Outcome, poll.ID)
+		if execErr != nil {
+			return fmt.Errorf("error while updating poll outcome: %w", execErr)
+		}
+		rowsAffected, _ := result.RowsAffected()
+		if rowsAffected == 0 {
+			return fmt.Errorf("no rows were affected by the update operation")
+		}
+
+		query := `INSERT INTO outcome_corrections (poll_id, previous_outcome, new_outcome, corrected_by, corrected_at)
+              VALUES (?, ?, ?, ?, ?)`
+		if _, execErr := transaction.ExecContext(ctx, query, correction.PollID, correction.PreviousOutcome, correction.NewOutcome, correction.CorrectedBy, correction.CorrectedAt.UnixMilli()); execErr != nil {
+			return fmt.Errorf("error while inserting outcome correction: %w", execErr)
+		}
+
+		return nil
+	})
+}
+
+func (repo *libSQLRepository) GetOutcomeCorrections(ctx context.Context, pollID string) ([]OutcomeCorrection, error) {
+	query := `SELECT poll_id, previous_outcome, new_outcome, corrected_by, corrected_at
+              FROM outcome_corrections WHERE poll_id = ? ORDER BY id`
+	rows, err := repo.db.QueryContext(ctx, query, pollID)
+	if err != nil {
+		return nil, fmt.Errorf("error while executing query: %w", err)
+	}
+	return scanOutcomeCorrections(rows)
+}
+
+func (repo *libSQLRepository) GetOutcomeCorrectionsByUser(ctx context.Context, userID string) ([]OutcomeCorrection, error) {
+	query := `SELECT poll_id, previous_outcome, new_outcome, corrected_by, corrected_at
+              FROM outcome_corrections WHERE corrected_by = ? ORDER BY id`
+	rows, err := repo.db.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, fmt.Errorf("error while executing query: %w", err)
+	}
+	return scanOutcomeCorrections(rows)
+}
+
+func scanOutcomeCorrections(rows *sql.Rows) ([]OutcomeCorrection, error) {
+	defer rows.Close()
+
+	var corrections []OutcomeCorrection
+	for rows.Next() {
+		var correction OutcomeCorrection
+		var correctedAt int64
+		if err := rows.Scan(&correction.PollID, &correction.PreviousOutcome, &correction.NewOutcome, &correction.CorrectedBy, &correctedAt); err != nil {
+			return nil, fmt.Errorf("error while scanning row: %w", err)
+		}
+		correction.CorrectedAt = time.UnixMilli(correctedAt)
+		corrections = append(corrections, correction)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error while iterating over rows: %w", err)
+	}
+
+	return corrections, nil
+}
+
+// Deadlines are stored as unix seconds, or NULL when the poll has no deadline.
+
+func toNullUnix(t time.Time) sql.NullInt64 {
+	if t.IsZero() {
+		return sql.NullInt64{}
+	}
+	return sql.NullInt64{Int64: t.Unix(), Valid: true}
+}
+
+func fromNullUnix(value sql.NullInt64) time.Time {
+	if !value.Valid {
+		return time.Time{}
+	}
+	return time.Unix(value.Int64, 0)
+}
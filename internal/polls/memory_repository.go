@@ -1,20 +1,73 @@
 package polls
 
-import "errors"
+import (
+	"context"
+	"errors"
+	"maps"
+	"slices"
+	"sort"
+
+	"betting-discord-bot/internal/storage"
+)
 
 type memoryRepository struct {
-	polls map[string]*poll
+	polls       map[string]*poll
+	corrections map[string][]OutcomeCorrection
+	// onDelete are called with the ID of every deleted poll, standing in for
+	// the foreign keys of the tables that belong to polls.
+	onDelete *[]func(pollID string)
 }
 
 func NewMemoryRepository() PollRepository {
 	return &memoryRepository{
-		polls: make(map[string]*poll),
+		polls:       make(map[string]*poll),
+		corrections: make(map[string][]OutcomeCorrection),
+		onDelete:    &[]func(pollID string){},
 	}
 }
 
+// OnDelete registers fn to be called with the ID of every poll deleted, so
+// that memory repositories of what belongs to polls can delete it with them.
+func (m memoryRepository) OnDelete(fn func(pollID string)) {
+	*m.onDelete = append(*m.onDelete, fn)
+}
+
 var ErrPollNotFound = errors.New("poll not found")
 
-func (m memoryRepository) Save(poll *poll) error {
+// WithTx snapshots the polls, so that they are put back if the unit of work is
+// rolled back. Polls are changed in place, so the snapshot copies each one.
+func (m memoryRepository) WithTx(tx *storage.Tx) PollRepository {
+	polls := make(map[string]*poll, len(m.polls))
+	for id, stored := range m.polls {
+		snapshot := *stored
+		snapshot.Options = slices.Clone(stored.Options)
+		polls[id] = &snapshot
+	}
+	corrections := make(map[string][]OutcomeCorrection, len(m.corrections))
+	for pollID, pollCorrections := range m.corrections {
+		corrections[pollID] = slices.Clone(pollCorrections)
+	}
+
+	tx.OnRollback(func() {
+		for id, snapshot := range polls {
+			if stored, exists := m.polls[id]; exists {
+				*stored = *snapshot
+				polls[id] = stored
+			}
+		}
+		clear(m.polls)
+		maps.Copy(m.polls, polls)
+		clear(m.corrections)
+		maps.Copy(m.corrections, corrections)
+	})
+	return m
+}
+
+func (m memoryRepository) Save(ctx context.Context, poll *poll) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
 	if _, exists := m.polls[poll.ID]; exists {
 		return errors.New("poll already exists")
 	}
@@ -22,14 +75,22 @@ func (m memoryRepository) Save(poll *poll) error {
 	return nil
 }
 
-func (m memoryRepository) GetById(id string) (*poll, error) {
+func (m memoryRepository) GetById(ctx context.Context, id string) (*poll, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
 	if poll, exists := m.polls[id]; exists {
 		return poll, nil
 	}
 	return nil, ErrPollNotFound
 }
 
-func (m memoryRepository) Update(poll *poll) error {
+func (m memoryRepository) Update(ctx context.Context, poll *poll) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
 	if _, exists := m.polls[poll.ID]; !exists {
 		return ErrPollNotFound
 	}
@@ -37,18 +98,30 @@ func (m memoryRepository) Update(poll *poll) error {
 	return nil
 }
 
-func (m memoryRepository) Delete(pollID string) error {
+func (m memoryRepository) Delete(ctx context.Context, pollID string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
 	if _, exists := m.polls[pollID]; !exists {
 		return ErrPollNotFound
 	}
 	delete(m.polls, pollID)
+	delete(m.corrections, pollID)
+	for _, fn := range *m.onDelete {
+		fn(pollID)
+	}
 	return nil
 }
 
-func (m memoryRepository) GetOpenPolls() ([]*poll, error) {
+func (m memoryRepository) GetOpenPolls(ctx context.Context, guildID string) ([]*poll, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
 	var openPolls []*poll
 	for _, poll := range m.polls {
-		if poll.Status == Open {
+		if poll.Status == Open && (guildID == "" || poll.GuildID == guildID) {
 			openPolls = append(openPolls, poll)
 		}
 	}
@@ -56,4 +129,85 @@ func (m memoryRepository) GetOpenPolls() ([]*poll, error) {
 	return openPolls, nil
 }
 
+func (m memoryRepository) List(ctx context.Context, query PollQuery) ([]*poll, int, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, 0, err
+	}
+
+	var matching []*poll
+	for _, poll := range m.polls {
+		if query.GuildID != "" && poll.GuildID != query.GuildID {
+			continue
+		}
+		if query.CreatorID != "" && poll.CreatorID != query.CreatorID {
+			continue
+		}
+		if len(query.Statuses) > 0 && !slices.Contains(query.Statuses, poll.Status) {
+			continue
+		}
+		if !query.ClosedSince.IsZero() && poll.Status != Open && poll.ClosedAt.Before(query.ClosedSince) {
+			continue
+		}
+		matching = append(matching, poll)
+	}
+
+	sort.Slice(matching, func(i, j int) bool {
+		a, b := matching[i], matching[j]
+		if (a.Status == Open) != (b.Status == Open) {
+			return a.Status == Open
+		}
+		if !a.CreatedAt.Equal(b.CreatedAt) {
+			return a.CreatedAt.After(b.CreatedAt)
+		}
+		return a.ID < b.ID
+	})
+
+	if query.Offset >= len(matching) {
+		return nil, len(matching), nil
+	}
+	end := min(query.Offset+query.Limit, len(matching))
+	return matching[query.Offset:end], len(matching), nil
+}
+
+func (m memoryRepository) SaveOutcomeCorrection(ctx context.Context, poll *poll, correction OutcomeCorrection) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	if _, exists := m.polls[poll.ID]; !exists {
+		return ErrPollNotFound
+	}
+	m.polls[poll.ID] = poll
+	m.corrections[poll.ID] = append(m.corrections[poll.ID], correction)
+	return nil
+}
+
+func (m memoryRepository) GetOutcomeCorrections(ctx context.Context, pollID string) ([]OutcomeCorrection, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	return m.corrections[pollID], nil
+}
+
+func (m memoryRepository) GetOutcomeCorrectionsByUser(ctx context.Context, userID string) ([]OutcomeCorrection, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	var corrections []OutcomeCorrection
+	for _, pollCorrections := range m.corrections {
+		for _, correction := range pollCorrections {
+			if correction.CorrectedBy == userID {
+				corrections = append(corrections, correction)
+			}
+		}
+	}
+	// Corrections to the same poll are kept in the order they were made.
+	sort.SliceStable(corrections, func(i, j int) bool {
+		return corrections[i].CorrectedAt.Before(corrections[j].CorrectedAt)
+	})
+	return corrections, nil
+}
+
 var _ PollRepository = (*memoryRepository)(nil)
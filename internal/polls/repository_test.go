@@ -1,9 +1,13 @@
 package polls
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"os"
 	"strings"
 	"testing"
+	"time"
 
 	"betting-discord-bot/internal/storage"
 
@@ -67,6 +71,15 @@ func TestPollRepositoryImplementations(t *testing.T) {
 		{"it should update the poll", testUpdate},
 		{"it should delete the poll", testDelete},
 		{"it should return all open polls", testGetAllOpenInRepo},
+		{"it should keep the order of many options", testSaveManyOptions},
+		{"it should save and update the deadline", testSaveDeadline},
+		{"it should save outcome corrections in order", testSaveOutcomeCorrection},
+		{"it should list polls by status and close time", testListPollsInRepo},
+		{"it should page through polls", testListPollPagesInRepo},
+		{"it should scope polls to their guild", testGuildScopeInRepo},
+		{"it should list the polls of a creator", testCreatorScopeInRepo},
+		{"it should stop once the context is cancelled", testCancelledContext},
+		{"it should delete the outcome corrections of a deleted poll", testDeleteCorrections},
 	}
 
 	for _, impl := range implementations {
@@ -91,24 +104,27 @@ func TestPollRepositoryImplementations(t *testing.T) {
 func testSaveAndReceive(t *testing.T, repo PollRepository) {
 	// ARRANGE: Create a new poll to save
 	pollToSave := &poll{
-		ID:    uuid.New().String(),
-		Title: "First Poll",
+		ID:        uuid.New().String(),
+		GuildID:   "guild",
+		CreatorID: "creator",
+		Title:     "First Poll",
 		Options: []string{
 			"Option 1",
 			"Option 2",
 		},
-		Outcome: Pending,
-		Status:  Open,
+		Outcome:  Pending,
+		Status:   Open,
+		Category: "Valorant",
 	}
 
 	// ACT: Save the poll
-	err := repo.Save(pollToSave)
+	err := repo.Save(t.Context(), pollToSave)
 	if err != nil {
 		t.Fatalf("Save() returned an unexpected error: %v", err)
 	}
 
 	// ACT: Get the poll back
-	retrievedPoll, err := repo.GetById(pollToSave.ID)
+	retrievedPoll, err := repo.GetById(t.Context(), pollToSave.ID)
 	if err != nil {
 		t.Fatalf("GetById() returned an unexpected error: %v", err)
 	}
@@ -117,6 +133,12 @@ func testSaveAndReceive(t *testing.T, repo PollRepository) {
 	if retrievedPoll.ID != pollToSave.ID {
 		t.Errorf("Expected poll ID %s, but got %s", pollToSave.ID, retrievedPoll.ID)
 	}
+	if retrievedPoll.GuildID != pollToSave.GuildID {
+		t.Errorf("Expected poll guild %q, but got %q", pollToSave.GuildID, retrievedPoll.GuildID)
+	}
+	if retrievedPoll.CreatorID != pollToSave.CreatorID {
+		t.Errorf("Expected poll creator %q, but got %q", pollToSave.CreatorID, retrievedPoll.CreatorID)
+	}
 	if retrievedPoll.Title != pollToSave.Title {
 		t.Errorf("Expected poll title %q, but got %q", pollToSave.Title, retrievedPoll.Title)
 	}
@@ -126,6 +148,9 @@ func testSaveAndReceive(t *testing.T, repo PollRepository) {
 	if retrievedPoll.Outcome != pollToSave.Outcome {
 		t.Errorf("Expected poll outcome %v, but got %v", pollToSave.Outcome, retrievedPoll.Outcome)
 	}
+	if retrievedPoll.Category != pollToSave.Category {
+		t.Errorf("Expected poll category %q, but got %q", pollToSave.Category, retrievedPoll.Category)
+	}
 }
 
 func testUpdate(t *testing.T, repo PollRepository) {
@@ -141,21 +166,21 @@ func testUpdate(t *testing.T, repo PollRepository) {
 	}
 
 	// ACT: Save the poll first
-	if err := repo.Save(pollToUpdate); err != nil {
+	if err := repo.Save(t.Context(), pollToUpdate); err != nil {
 		t.Fatalf("Save() returned an unexpected error: %v", err)
 	}
 
 	// ACT: Update the poll
 	pollToUpdate.Title = "Updated Poll Title"
 	pollToUpdate.Status = Closed
-	pollToUpdate.Outcome = Option2
+	pollToUpdate.Outcome = OutcomeStatus(1)
 	pollToUpdate.Options[0] = "Replaced"
-	if err := repo.Update(pollToUpdate); err != nil {
+	if err := repo.Update(t.Context(), pollToUpdate); err != nil {
 		t.Fatalf("Update() returned an unexpected error: %v", err)
 	}
 
 	// ACT: Retrieve the updated poll
-	retrievedPoll, err := repo.GetById(pollToUpdate.ID)
+	retrievedPoll, err := repo.GetById(t.Context(), pollToUpdate.ID)
 	if err != nil {
 		t.Fatalf("GetById() returned an unexpected error: %v", err)
 	}
@@ -189,31 +214,56 @@ func testDelete(t *testing.T, repo PollRepository) {
 	}
 
 	// ACT: Save the poll first
-	if err := repo.Save(pollToDelete); err != nil {
+	if err := repo.Save(t.Context(), pollToDelete); err != nil {
 		t.Fatalf("Save() returned an unexpected error: %v", err)
 	}
 
 	// ACT: Retrieve the poll to ensure it exists before deletion
-	_, err := repo.GetById(pollToDelete.ID)
+	_, err := repo.GetById(t.Context(), pollToDelete.ID)
 	if err != nil {
 		t.Fatalf("GetById() returned an unexpected error: %v", err)
 	}
 
 	// ACT: Delete the poll
-	if err := repo.Delete(pollToDelete.ID); err != nil {
+	if err := repo.Delete(t.Context(), pollToDelete.ID); err != nil {
 		t.Fatalf("Delete() returned an unexpected error: %v", err)
 	}
 
 	// ASSERT: Try to retrieve the deleted poll
-	_, err = repo.GetById(pollToDelete.ID)
+	_, err = repo.GetById(t.Context(), pollToDelete.ID)
 	if err == nil {
 		t.Fatal("Expected error when retrieving deleted poll, but got nil")
 	}
 }
 
+func testDeleteCorrections(t *testing.T, repo PollRepository) {
+	deleted := newTestPoll("Who wins the final?")
+	if err := repo.Save(t.Context(), deleted); err != nil {
+		t.Fatalf("Save() returned an unexpected error: %v", err)
+	}
+	deleted.Status = Closed
+	deleted.Outcome = 1
+	correction := OutcomeCorrection{PollID: deleted.ID, PreviousOutcome: 0, NewOutcome: 1, CorrectedAt: time.Now()}
+	if err := repo.SaveOutcomeCorrection(t.Context(), deleted, correction); err != nil {
+		t.Fatalf("SaveOutcomeCorrection() returned an unexpected error: %v", err)
+	}
+
+	if err := repo.Delete(t.Context(), deleted.ID); err != nil {
+		t.Fatalf("Delete() returned an unexpected error: %v", err)
+	}
+
+	corrections, err := repo.GetOutcomeCorrections(t.Context(), deleted.ID)
+	if err != nil {
+		t.Fatalf("GetOutcomeCorrections() returned an unexpected error: %v", err)
+	}
+	if len(corrections) != 0 {
+		t.Errorf("Expected the corrections of the deleted poll to be deleted, but got %+v", corrections)
+	}
+}
+
 func testGetAllOpenInRepo(t *testing.T, repo PollRepository) {
 	// ARRANGE: Create open and closed polls
-	if err := repo.Save(&poll{
+	if err := repo.Save(t.Context(), &poll{
 		ID:    uuid.NewString(),
 		Title: "open poll 1",
 		Options: []string{
@@ -225,7 +275,7 @@ func testGetAllOpenInRepo(t *testing.T, repo PollRepository) {
 	}); err != nil {
 		t.Fatalf("Save() returned an unexpected error: %v", err)
 	}
-	if err := repo.Save(&poll{
+	if err := repo.Save(t.Context(), &poll{
 		ID:    uuid.NewString(),
 		Title: "open poll 2",
 		Options: []string{
@@ -237,7 +287,7 @@ func testGetAllOpenInRepo(t *testing.T, repo PollRepository) {
 	}); err != nil {
 		t.Fatalf("Save() returned an unexpected error: %v", err)
 	}
-	if err := repo.Save(&poll{
+	if err := repo.Save(t.Context(), &poll{
 		ID:    uuid.NewString(),
 		Title: "closed poll 1",
 		Options: []string{
@@ -251,7 +301,7 @@ func testGetAllOpenInRepo(t *testing.T, repo PollRepository) {
 	}
 
 	// ACT: Get Open Polls
-	openPolls, err := repo.GetOpenPolls()
+	openPolls, err := repo.GetOpenPolls(t.Context(), "")
 	if err != nil {
 		t.Fatalf("GetOpenPolls() returned an unexpected error: %v", err)
 	}
@@ -267,3 +317,509 @@ func testGetAllOpenInRepo(t *testing.T, repo PollRepository) {
 		}
 	}
 }
+
+func testSaveManyOptions(t *testing.T, repo PollRepository) {
+	// ARRANGE
+	options := make([]string, MaxOptions)
+	for i := range options {
+		options[i] = fmt.Sprintf("Option %d", i+1)
+	}
+	pollToSave := &poll{
+		ID:      uuid.NewString(),
+		Title:   "Tournament",
+		Options: options,
+		Status:  Open,
+		Outcome: Pending,
+	}
+
+	// ACT
+	if err := repo.Save(t.Context(), pollToSave); err != nil {
+		t.Fatalf("Save() returned an unexpected error: %v", err)
+	}
+	retrievedPoll, err := repo.GetById(t.Context(), pollToSave.ID)
+	if err != nil {
+		t.Fatalf("GetById() returned an unexpected error: %v", err)
+	}
+
+	// ASSERT
+	if len(retrievedPoll.Options) != len(options) {
+		t.Fatalf("Expected %d options, but got %d", len(options), len(retrievedPoll.Options))
+	}
+	for i, option := range options {
+		if retrievedPoll.Options[i] != option {
+			t.Errorf("Expected option %d to be %q, but got %q", i, option, retrievedPoll.Options[i])
+		}
+	}
+	if retrievedPoll.Outcome != Pending {
+		t.Errorf("Expected poll outcome %v, but got %v", Pending, retrievedPoll.Outcome)
+	}
+}
+
+func testSaveDeadline(t *testing.T, repo PollRepository) {
+	// ARRANGE: Deadlines are stored with second precision
+	closesAt := time.Now().Add(time.Hour).Truncate(time.Second)
+	pollToSave := &poll{
+		ID:       uuid.NewString(),
+		Title:    "Poll with deadline",
+		Options:  []string{"Option 1", "Option 2"},
+		Status:   Open,
+		Outcome:  Pending,
+		ClosesAt: closesAt,
+	}
+
+	// ACT
+	if err := repo.Save(t.Context(), pollToSave); err != nil {
+		t.Fatalf("Save() returned an unexpected error: %v", err)
+	}
+	retrievedPoll, err := repo.GetById(t.Context(), pollToSave.ID)
+	if err != nil {
+		t.Fatalf("GetById() returned an unexpected error: %v", err)
+	}
+
+	// ASSERT
+	if !retrievedPoll.ClosesAt.Equal(closesAt) {
+		t.Errorf("Expected deadline %v, but got %v", closesAt, retrievedPoll.ClosesAt)
+	}
+
+	// ACT: Remove the deadline
+	pollToSave.ClosesAt = time.Time{}
+	if err := repo.Update(t.Context(), pollToSave); err != nil {
+		t.Fatalf("Update() returned an unexpected error: %v", err)
+	}
+	retrievedPoll, err = repo.GetById(t.Context(), pollToSave.ID)
+	if err != nil {
+		t.Fatalf("GetById() returned an unexpected error: %v", err)
+	}
+
+	// ASSERT
+	if !retrievedPoll.ClosesAt.IsZero() {
+		t.Errorf("Expected no deadline, but got %v", retrievedPoll.ClosesAt)
+	}
+}
+
+func testSaveOutcomeCorrection(t *testing.T, repo PollRepository) {
+	// ARRANGE
+	pollToCorrect := &poll{
+		ID:      uuid.NewString(),
+		Title:   "Poll to correct",
+		Options: []string{"Option 1", "Option 2", "Option 3"},
+		Status:  Closed,
+		Outcome: OutcomeStatus(0),
+	}
+	if err := repo.Save(t.Context(), pollToCorrect); err != nil {
+		t.Fatalf("Save() returned an unexpected error: %v", err)
+	}
+
+	corrections := []OutcomeCorrection{
+		{PollID: pollToCorrect.ID, PreviousOutcome: 0, NewOutcome: 1, CorrectedBy: "first", CorrectedAt: time.UnixMilli(1000)},
+		{PollID: pollToCorrect.ID, PreviousOutcome: 1, NewOutcome: 2, CorrectedBy: "second", CorrectedAt: time.UnixMilli(2000)},
+	}
+
+	// ACT
+	for _, correction := range corrections {
+		pollToCorrect.Outcome = correction.NewOutcome
+		if err := repo.SaveOutcomeCorrection(t.Context(), pollToCorrect, correction); err != nil {
+			t.Fatalf("SaveOutcomeCorrection() returned an unexpected error: %v", err)
+		}
+	}
+
+	// ASSERT
+	retrievedPoll, err := repo.GetById(t.Context(), pollToCorrect.ID)
+	if err != nil {
+		t.Fatalf("GetById() returned an unexpected error: %v", err)
+	}
+	if retrievedPoll.Outcome != OutcomeStatus(2) {
+		t.Errorf("Expected poll outcome %v, but got %v", OutcomeStatus(2), retrievedPoll.Outcome)
+	}
+
+	history, err := repo.GetOutcomeCorrections(t.Context(), pollToCorrect.ID)
+	if err != nil {
+		t.Fatalf("GetOutcomeCorrections() returned an unexpected error: %v", err)
+	}
+	if len(history) != len(corrections) {
+		t.Fatalf("Expected %d corrections, but got %d", len(corrections), len(history))
+	}
+	for i, correction := range corrections {
+		if history[i].CorrectedBy != correction.CorrectedBy || history[i].NewOutcome != correction.NewOutcome || !history[i].CorrectedAt.Equal(correction.CorrectedAt) {
+			t.Errorf("Expected correction %+v, but got %+v", correction, history[i])
+		}
+	}
+
+	byUser, err := repo.GetOutcomeCorrectionsByUser(t.Context(), "second")
+	if err != nil {
+		t.Fatalf("GetOutcomeCorrectionsByUser() returned an unexpected error: %v", err)
+	}
+	if len(byUser) != 1 || byUser[0].PreviousOutcome != 1 || byUser[0].NewOutcome != 2 {
+		t.Errorf("Expected the correction made by the second user, but got %+v", byUser)
+	}
+}
+
+// saveListPolls saves polls created an hour apart, oldest first, and returns
+// them by title.
+func saveListPolls(t *testing.T, repo PollRepository) map[string]*poll {
+	t.Helper()
+
+	createdAt := time.Unix(1_700_000_000, 0)
+	fixtures := []struct {
+		title    string
+		status   PollStatus
+		closedAt time.Time
+	}{
+		{"closed long ago", Closed, createdAt.Add(2 * time.Hour)},
+		{"open oldest", Open, time.Time{}},
+		{"cancelled recently", Cancelled, createdAt.Add(48 * time.Hour)},
+		{"closed recently", Closed, createdAt.Add(49 * time.Hour)},
+		{"open newest", Open, time.Time{}},
+	}
+
+	saved := make(map[string]*poll)
+	for index, fixture := range fixtures {
+		poll := &poll{
+			ID:        uuid.NewString(),
+			Title:     fixture.title,
+			Options:   []string{"Option 1", "Option 2"},
+			Status:    fixture.status,
+			Outcome:   Pending,
+			CreatedAt: createdAt.Add(time.Duration(index) * time.Hour),
+			ClosedAt:  fixture.closedAt,
+		}
+		if err := repo.Save(t.Context(), poll); err != nil {
+			t.Fatalf("Save() returned an unexpected error: %v", err)
+		}
+		saved[fixture.title] = poll
+	}
+
+	return saved
+}
+
+func assertPollTitles(t *testing.T, name string, expected []string, actual []*poll) {
+	t.Helper()
+
+	var titles []string
+	for _, poll := range actual {
+		titles = append(titles, poll.Title)
+	}
+	if strings.Join(titles, ", ") != strings.Join(expected, ", ") {
+		t.Errorf("%s: expected polls [%s], but got [%s]", name, strings.Join(expected, ", "), strings.Join(titles, ", "))
+	}
+}
+
+func testListPollsInRepo(t *testing.T, repo PollRepository) {
+	saved := saveListPolls(t, repo)
+	recently := saved["cancelled recently"].ClosedAt.Add(-time.Minute)
+
+	tests := []struct {
+		name     string
+		query    PollQuery
+		expected []string
+	}{
+		{
+			name:     "every poll, open first",
+			query:    PollQuery{Limit: 10},
+			expected: []string{"open newest", "open oldest", "closed recently", "cancelled recently", "closed long ago"},
+		},
+		{
+			name:     "open polls",
+			query:    PollQuery{Statuses: []PollStatus{Open}, Limit: 10},
+			expected: []string{"open newest", "open oldest"},
+		},
+		{
+			name:     "recently closed polls",
+			query:    PollQuery{Statuses: []PollStatus{Closed, Cancelled}, ClosedSince: recently, Limit: 10},
+			expected: []string{"closed recently", "cancelled recently"},
+		},
+		{
+			name:     "open and recently closed polls",
+			query:    PollQuery{ClosedSince: recently, Limit: 10},
+			expected: []string{"open newest", "open oldest", "closed recently", "cancelled recently"},
+		},
+	}
+
+	for _, test := range tests {
+		polls, total, err := repo.List(t.Context(), test.query)
+		if err != nil {
+			t.Fatalf("%s: List() returned an unexpected error: %v", test.name, err)
+		}
+		if total != len(test.expected) {
+			t.Errorf("%s: expected a total of %d, but got %d", test.name, len(test.expected), total)
+		}
+		assertPollTitles(t, test.name, test.expected, polls)
+	}
+
+	polls, _, err := repo.List(t.Context(), PollQuery{Statuses: []PollStatus{Closed}, ClosedSince: recently, Limit: 1})
+	if err != nil {
+		t.Fatalf("List() returned an unexpected error: %v", err)
+	}
+	expected := saved["closed recently"]
+	if len(polls) != 1 || len(polls[0].Options) != 2 || !polls[0].CreatedAt.Equal(expected.CreatedAt) || !polls[0].ClosedAt.Equal(expected.ClosedAt) {
+		t.Errorf("Expected the listed poll to match %+v, but got %+v", expected, polls)
+	}
+}
+
+func testListPollPagesInRepo(t *testing.T, repo PollRepository) {
+	saveListPolls(t, repo)
+
+	polls, total, err := repo.List(t.Context(), PollQuery{Limit: 2, Offset: 2})
+	if err != nil {
+		t.Fatalf("List() returned an unexpected error: %v", err)
+	}
+	if total != 5 {
+		t.Errorf("Expected a total of 5, but got %d", total)
+	}
+	assertPollTitles(t, "second page", []string{"closed recently", "cancelled recently"}, polls)
+
+	polls, total, err = repo.List(t.Context(), PollQuery{Limit: 2, Offset: 6})
+	if err != nil {
+		t.Fatalf("List() returned an unexpected error: %v", err)
+	}
+	if len(polls) != 0 || total != 5 {
+		t.Errorf("Expected an empty page with a total of 5, but got %d polls and a total of %d", len(polls), total)
+	}
+}
+
+func testGuildScopeInRepo(t *testing.T, repo PollRepository) {
+	for _, saved := range []*poll{
+		{ID: uuid.NewString(), GuildID: "first", Title: "first open", Options: []string{"A", "B"}, Status: Open, Outcome: Pending},
+		{ID: uuid.NewString(), GuildID: "first", Title: "first closed", Options: []string{"A", "B"}, Status: Closed, Outcome: Pending},
+		{ID: uuid.NewString(), GuildID: "second", Title: "second open", Options: []string{"A", "B"}, Status: Open, Outcome: Pending},
+	} {
+		if err := repo.Save(t.Context(), saved); err != nil {
+			t.Fatalf("Save() returned an unexpected error: %v", err)
+		}
+	}
+
+	openPolls, err := repo.GetOpenPolls(t.Context(), "first")
+	if err != nil {
+		t.Fatalf("GetOpenPolls() returned an unexpected error: %v", err)
+	}
+	assertPollTitles(t, "open polls of the first guild", []string{"first open"}, openPolls)
+
+	everyOpenPoll, err := repo.GetOpenPolls(t.Context(), "")
+	if err != nil {
+		t.Fatalf("GetOpenPolls() returned an unexpected error: %v", err)
+	}
+	if len(everyOpenPoll) != 2 {
+		t.Errorf("Expected the open polls of every guild, but got %d polls", len(everyOpenPoll))
+	}
+
+	listed, total, err := repo.List(t.Context(), PollQuery{GuildID: "second", Limit: 10})
+	if err != nil {
+		t.Fatalf("List() returned an unexpected error: %v", err)
+	}
+	if total != 1 {
+		t.Errorf("Expected a total of 1, but got %d", total)
+	}
+	assertPollTitles(t, "polls of the second guild", []string{"second open"}, listed)
+}
+
+func testCreatorScopeInRepo(t *testing.T, repo PollRepository) {
+	for _, saved := range []*poll{
+		{ID: uuid.NewString(), GuildID: "first", CreatorID: "creator", Title: "first guild", Options: []string{"A", "B"}, Status: Open, Outcome: Pending},
+		{ID: uuid.NewString(), GuildID: "second", CreatorID: "creator", Title: "second guild", Options: []string{"A", "B"}, Status: Closed, Outcome: Pending},
+		{ID: uuid.NewString(), GuildID: "first", CreatorID: "other", Title: "someone else's", Options: []string{"A", "B"}, Status: Open, Outcome: Pending},
+	} {
+		if err := repo.Save(t.Context(), saved); err != nil {
+			t.Fatalf("Save() returned an unexpected error: %v", err)
+		}
+	}
+
+	listed, total, err := repo.List(t.Context(), PollQuery{CreatorID: "creator", Limit: 10})
+	if err != nil {
+		t.Fatalf("List() returned an unexpected error: %v", err)
+	}
+	if total != 2 {
+		t.Errorf("Expected a total of 2, but got %d", total)
+	}
+	assertPollTitles(t, "polls of the creator", []string{"first guild", "second guild"}, listed)
+}
+
+func setupLibSQLWithUnitOfWork(t *testing.T) (PollRepository, storage.UnitOfWork, func()) {
+	t.Helper()
+
+	sanitizedTestName := strings.ReplaceAll(t.Name(), "/", "_")
+	dbPath := sanitizedTestName + ".db"
+	_ = os.Remove(dbPath)
+
+	db, err := storage.InitializeDatabase(dbPath, "")
+	if err != nil {
+		t.Fatalf("Failed to initialize test database: %v", err)
+	}
+
+	teardown := func() {
+		if err := db.Close(); err != nil {
+			t.Fatal("failed to close database")
+		}
+		if err := os.Remove(dbPath); err != nil {
+			t.Fatal("failed to remove database file")
+		}
+	}
+
+	return NewLibSQLRepository(db), storage.NewLibSQLUnitOfWork(db), teardown
+}
+
+func setupInMemoryWithUnitOfWork(t *testing.T) (PollRepository, storage.UnitOfWork, func()) {
+	t.Helper()
+
+	return NewMemoryRepository(), storage.NewMemoryUnitOfWork(), func() {}
+}
+
+// TestPollUnitOfWorkImplementations covers saving polls as part of a unit of
+// work, which needs a unit of work backed by the same storage.
+func TestPollUnitOfWorkImplementations(t *testing.T) {
+	t.Parallel()
+	implementations := []struct {
+		name  string
+		setup func(t *testing.T) (PollRepository, storage.UnitOfWork, func())
+	}{
+		{name: "InMemoryRepository", setup: setupInMemoryWithUnitOfWork},
+		{name: "LibSQLRepository", setup: setupLibSQLWithUnitOfWork},
+	}
+
+	testCases := []struct {
+		name string
+		run  func(t *testing.T, repo PollRepository, unitOfWork storage.UnitOfWork)
+	}{
+		{"it should keep what a unit of work saved", testUnitOfWorkCommit},
+		{"it should undo what a failed unit of work saved", testUnitOfWorkRollback},
+		{"it should not start a unit of work once the context is cancelled", testUnitOfWorkCancelled},
+	}
+
+	for _, impl := range implementations {
+		t.Run(impl.name, func(t *testing.T) {
+			t.Parallel()
+
+			for _, tc := range testCases {
+				t.Run(tc.name, func(t *testing.T) {
+					t.Parallel()
+
+					repo, unitOfWork, cleanup := impl.setup(t)
+					t.Cleanup(cleanup)
+
+					tc.run(t, repo, unitOfWork)
+				})
+			}
+		})
+	}
+}
+
+func newTestPoll(title string) *poll {
+	return &poll{
+		ID:      uuid.New().String(),
+		GuildID: "guild",
+		Title:   title,
+		Options: []string{"Yes", "No"},
+		Outcome: Pending,
+		Status:  Open,
+	}
+}
+
+func testUnitOfWorkCommit(t *testing.T, repo PollRepository, unitOfWork storage.UnitOfWork) {
+	saved := newTestPoll("Will it rain?")
+
+	err := unitOfWork.Do(t.Context(), func(tx *storage.Tx) error {
+		return repo.WithTx(tx).Save(t.Context(), saved)
+	})
+	if err != nil {
+		t.Fatalf("Do() returned an unexpected error: %v", err)
+	}
+
+	retrieved, err := repo.GetById(t.Context(), saved.ID)
+	if err != nil {
+		t.Fatalf("Expected the poll to be saved, but got %v", err)
+	}
+	if len(retrieved.Options) != 2 {
+		t.Errorf("Expected the options to be saved with the poll, but got %v", retrieved.Options)
+	}
+}
+
+func testUnitOfWorkRollback(t *testing.T, repo PollRepository, unitOfWork storage.UnitOfWork) {
+	existing := newTestPoll("Who wins the final?")
+	if err := repo.Save(t.Context(), existing); err != nil {
+		t.Fatalf("Save() returned an unexpected error: %v", err)
+	}
+
+	failure := errors.New("something went wrong")
+	added := newTestPoll("Will it rain?")
+	err := unitOfWork.Do(t.Context(), func(tx *storage.Tx) error {
+		txRepo := repo.WithTx(tx)
+		if err := txRepo.Save(t.Context(), added); err != nil {
+			return err
+		}
+
+		closed, err := txRepo.GetById(t.Context(), existing.ID)
+		if err != nil {
+			return err
+		}
+		closed.Status = Closed
+		closed.Outcome = 1
+		if err := txRepo.SaveOutcomeCorrection(t.Context(), closed, OutcomeCorrection{PollID: existing.ID, NewOutcome: 1, CorrectedAt: time.Now()}); err != nil {
+			return err
+		}
+		if err := txRepo.Update(t.Context(), closed); err != nil {
+			return err
+		}
+
+		return failure
+	})
+	if !errors.Is(err, failure) {
+		t.Fatalf("Expected Do() to return the error of the unit of work, but got %v", err)
+	}
+
+	if _, err := repo.GetById(t.Context(), added.ID); err == nil {
+		t.Error("Expected the poll saved in the failed unit of work to be gone")
+	}
+
+	retrieved, err := repo.GetById(t.Context(), existing.ID)
+	if err != nil {
+		t.Fatalf("GetById() returned an unexpected error: %v", err)
+	}
+	if retrieved.Status != Open || retrieved.Outcome != Pending {
+		t.Errorf("Expected the poll to be open and pending again, but got status %v and outcome %v", retrieved.Status, retrieved.Outcome)
+	}
+
+	corrections, err := repo.GetOutcomeCorrections(t.Context(), existing.ID)
+	if err != nil {
+		t.Fatalf("GetOutcomeCorrections() returned an unexpected error: %v", err)
+	}
+	if len(corrections) != 0 {
+		t.Errorf("Expected the correction to be undone, but got %+v", corrections)
+	}
+}
+
+func testCancelledContext(t *testing.T, repo PollRepository) {
+	ctx, cancel := context.WithCancel(t.Context())
+	cancel()
+
+	unsaved := newTestPoll("Will it rain?")
+	if err := repo.Save(ctx, unsaved); !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected Save() to return '%v', but got '%v'", context.Canceled, err)
+	}
+	if _, err := repo.GetById(t.Context(), unsaved.ID); err == nil {
+		t.Error("Expected the poll not to be saved with a cancelled context")
+	}
+
+	saved := newTestPoll("Who wins the final?")
+	if err := repo.Save(t.Context(), saved); err != nil {
+		t.Fatalf("Save() returned an unexpected error: %v", err)
+	}
+	if _, err := repo.GetById(ctx, saved.ID); !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected GetById() to return '%v', but got '%v'", context.Canceled, err)
+	}
+}
+
+func testUnitOfWorkCancelled(t *testing.T, repo PollRepository, unitOfWork storage.UnitOfWork) {
+	ctx, cancel := context.WithCancel(t.Context())
+	cancel()
+
+	called := false
+	err := unitOfWork.Do(ctx, func(tx *storage.Tx) error {
+		called = true
+		return nil
+	})
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected Do() to return '%v', but got '%v'", context.Canceled, err)
+	}
+	if called {
+		t.Error("Expected a unit of work with a cancelled context not to run")
+	}
+}
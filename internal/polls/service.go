@@ -1,8 +1,13 @@
 package polls
 
 import (
-	"errors"
+	"context"
 	"fmt"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"betting-discord-bot/internal/storage"
 
 	"github.com/google/uuid"
 )
@@ -17,22 +22,40 @@ func NewService(pollRepo PollRepository) PollService {
 	}
 }
 
-func (s *service) CreatePoll(title string, options []string) (Poll, error) {
-	if notExactlyTwo(options) {
-		return nil, errors.New("poll must have exactly two options")
+func (s *service) WithTx(tx *storage.Tx) PollService {
+	return &service{s.pollRepo.WithTx(tx)}
+}
+
+func (s *service) CreatePoll(ctx context.Context, guildID string, creatorID string, title string, options []string, closesAt time.Time, category string) (Poll, error) {
+	if len(options) < MinOptions || len(options) > MaxOptions {
+		return nil, ErrInvalidOptionCount
+	}
+
+	category = strings.TrimSpace(category)
+	if utf8.RuneCountInString(category) > MaxCategoryLength {
+		return nil, ErrCategoryTooLong
+	}
+
+	if !closesAt.IsZero() && !closesAt.After(time.Now()) {
+		return nil, ErrDeadlineInPast
 	}
 
 	// Create a new poll
 	poll := &poll{
-		ID:      uuid.New().String(),
-		Title:   title,
-		Options: options,
-		Status:  Open,
-		Outcome: Pending,
+		ID:        uuid.New().String(),
+		GuildID:   guildID,
+		CreatorID: creatorID,
+		Title:     title,
+		Options:   options,
+		Status:    Open,
+		Outcome:   Pending,
+		ClosesAt:  closesAt,
+		Category:  category,
+		CreatedAt: time.Now(),
 	}
 
 	// Save the poll to the repository
-	err := s.pollRepo.Save(poll)
+	err := s.pollRepo.Save(ctx, poll)
 	if err != nil {
 		return nil, err
 	}
@@ -40,12 +63,8 @@ func (s *service) CreatePoll(title string, options []string) (Poll, error) {
 	return poll, nil
 }
 
-func notExactlyTwo(options []string) bool {
-	return len(options) != 2
-}
-
-func (s *service) ClosePoll(pollID string) error {
-	poll, err := s.pollRepo.GetById(pollID)
+func (s *service) ClosePoll(ctx context.Context, pollID string) error {
+	poll, err := s.pollRepo.GetById(ctx, pollID)
 	if err != nil {
 		return fmt.Errorf("failed to get poll by ID: %w", err)
 	}
@@ -55,30 +74,109 @@ func (s *service) ClosePoll(pollID string) error {
 	}
 
 	poll.Status = Closed
-	if err := s.pollRepo.Update(poll); err != nil {
+	poll.ClosedAt = time.Now()
+	if err := s.pollRepo.Update(ctx, poll); err != nil {
 		return fmt.Errorf("failed to update poll status: %w", err)
 	}
 
 	return nil
 }
 
-func (s *service) SelectOutcome(pollID string, outcomeStatus OutcomeStatus) error {
-	poll, err := s.pollRepo.GetById(pollID)
+func (s *service) CancelPoll(ctx context.Context, pollID string) error {
+	poll, err := s.pollRepo.GetById(ctx, pollID)
 	if err != nil {
 		return fmt.Errorf("failed to get poll by ID: %w", err)
 	}
 
+	if poll.Status == Cancelled {
+		return ErrPollIsAlreadyCancelled
+	}
+
+	poll.Status = Cancelled
+	poll.Outcome = Pending
+	if poll.ClosedAt.IsZero() {
+		poll.ClosedAt = time.Now()
+	}
+	if err := s.pollRepo.Update(ctx, poll); err != nil {
+		return fmt.Errorf("failed to update poll status: %w", err)
+	}
+
+	return nil
+}
+
+func (s *service) SelectOutcome(ctx context.Context, pollID string, outcomeStatus OutcomeStatus) error {
+	poll, err := s.pollRepo.GetById(ctx, pollID)
+	if err != nil {
+		return fmt.Errorf("failed to get poll by ID: %w", err)
+	}
+
+	if outcomeStatus != Pending && (outcomeStatus < 0 || int(outcomeStatus) >= len(poll.Options)) {
+		return ErrInvalidOutcome
+	}
+
 	poll.Outcome = outcomeStatus
 
-	if err := s.pollRepo.Update(poll); err != nil {
+	if err := s.pollRepo.Update(ctx, poll); err != nil {
 		return fmt.Errorf("failed to update poll outcome: %w", err)
 	}
 
 	return nil
 }
 
-func (s *service) GetPollById(id string) (Poll, error) {
-	poll, err := s.pollRepo.GetById(id)
+func (s *service) CorrectOutcome(ctx context.Context, pollID string, newOutcome OutcomeStatus, correctedBy string) (OutcomeCorrection, error) {
+	poll, err := s.pollRepo.GetById(ctx, pollID)
+	if err != nil {
+		return OutcomeCorrection{}, fmt.Errorf("failed to get poll by ID: %w", err)
+	}
+
+	if poll.Status != Closed || poll.Outcome == Pending {
+		return OutcomeCorrection{}, ErrOutcomeNotSelected
+	}
+
+	if newOutcome < 0 || int(newOutcome) >= len(poll.Options) {
+		return OutcomeCorrection{}, ErrInvalidOutcome
+	}
+
+	if newOutcome == poll.Outcome {
+		return OutcomeCorrection{}, ErrOutcomeUnchanged
+	}
+
+	correction := OutcomeCorrection{
+		PollID:          pollID,
+		PreviousOutcome: poll.Outcome,
+		NewOutcome:      newOutcome,
+		CorrectedBy:     correctedBy,
+		CorrectedAt:     time.Now(),
+	}
+
+	poll.Outcome = newOutcome
+	if err := s.pollRepo.SaveOutcomeCorrection(ctx, poll, correction); err != nil {
+		return OutcomeCorrection{}, fmt.Errorf("failed to save outcome correction: %w", err)
+	}
+
+	return correction, nil
+}
+
+func (s *service) GetOutcomeCorrections(ctx context.Context, pollID string) ([]OutcomeCorrection, error) {
+	corrections, err := s.pollRepo.GetOutcomeCorrections(ctx, pollID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get outcome corrections: %w", err)
+	}
+
+	return corrections, nil
+}
+
+func (s *service) GetOutcomeCorrectionsByUser(ctx context.Context, userID string) ([]OutcomeCorrection, error) {
+	corrections, err := s.pollRepo.GetOutcomeCorrectionsByUser(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get outcome corrections: %w", err)
+	}
+
+	return corrections, nil
+}
+
+func (s *service) GetPollById(ctx context.Context, id string) (Poll, error) {
+	poll, err := s.pollRepo.GetById(ctx, id)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get poll by ID: %w", err)
 	}
@@ -86,8 +184,8 @@ func (s *service) GetPollById(id string) (Poll, error) {
 	return poll, nil
 }
 
-func (s *service) GetOpenPolls() ([]Poll, error) {
-	openPolls, err := s.pollRepo.GetOpenPolls()
+func (s *service) GetOpenPolls(ctx context.Context, guildID string) ([]Poll, error) {
+	openPolls, err := s.pollRepo.GetOpenPolls(ctx, guildID)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get open polls: %w", err)
 	}
@@ -101,4 +199,22 @@ func (s *service) GetOpenPolls() ([]Poll, error) {
 	return pollsAsInterfaces, nil
 }
 
+func (s *service) ListPolls(ctx context.Context, query PollQuery) (PollPage, error) {
+	if query.Limit <= 0 || query.Offset < 0 {
+		return PollPage{}, ErrInvalidPollQuery
+	}
+
+	polls, total, err := s.pollRepo.List(ctx, query)
+	if err != nil {
+		return PollPage{}, fmt.Errorf("failed to list polls: %w", err)
+	}
+
+	page := PollPage{Total: total}
+	for _, poll := range polls {
+		page.Polls = append(page.Polls, poll)
+	}
+
+	return page, nil
+}
+
 var _ PollService = (*service)(nil)
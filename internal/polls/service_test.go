@@ -1,6 +1,15 @@
 package polls
 
-import "testing"
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testGuildID = "guild"
 
 func setupService(t *testing.T) (PollService, func()) {
 	t.Helper()
@@ -28,8 +37,18 @@ func TestServiceImplementations(t *testing.T) {
 		{"it should create a poll", testCreatePoll},
 		{"it should close a poll", testClosePoll},
 		{"it should select an outcome", testSelectOutcome},
+		{"it should cancel a poll", testCancelPoll},
+		{"it should correct an outcome and record the change", testCorrectOutcome},
+		{"it should not correct a poll without an outcome", testCorrectUnresolvedPoll},
 		{"it should get a poll by ID", testGetPollById},
-		{"it should return an error for more than two options", testExactlyTwoOptions},
+		{"it should create a poll with more than two options", testCreatePollWithManyOptions},
+		{"it should return an error for too few or too many options", testInvalidOptionCount},
+		{"it should reject an outcome outside the options", testSelectInvalidOutcome},
+		{"it should create a poll with a deadline", testCreatePollWithDeadline},
+		{"it should reject a deadline in the past", testDeadlineInPast},
+		{"it should create a poll in a category", testCreatePollInCategory},
+		{"it should record when a poll opens and closes", testPollTimestamps},
+		{"it should list open polls", testListPolls},
 		{"it should return all open polls", testGetAllOpen},
 	}
 
@@ -51,23 +70,26 @@ func TestServiceImplementations(t *testing.T) {
 
 func testGetAllOpen(t *testing.T, pollService PollService) {
 	// ARRANGE: Create open and closed polls
-	if _, err := pollService.CreatePoll("openPoll1", []string{"option1", "option2"}); err != nil {
+	if _, err := pollService.CreatePoll(t.Context(), testGuildID, "", "openPoll1", []string{"option1", "option2"}, time.Time{}, ""); err != nil {
 		t.Fatalf("Failed to create open poll: %v", err)
 	}
-	if _, err := pollService.CreatePoll("openPoll2", []string{"option1", "option2"}); err != nil {
+	if _, err := pollService.CreatePoll(t.Context(), testGuildID, "", "openPoll2", []string{"option1", "option2"}, time.Time{}, ""); err != nil {
 		t.Fatalf("Failed to create open poll: %v", err)
 	}
-	closedPoll, err := pollService.CreatePoll("closedPoll", []string{"option1", "option2"})
+	closedPoll, err := pollService.CreatePoll(t.Context(), testGuildID, "", "closedPoll", []string{"option1", "option2"}, time.Time{}, "")
 	if err != nil {
 		t.Fatalf("Failed to create closed poll: %v", err)
 	}
-	err = pollService.ClosePoll(closedPoll.GetID())
+	err = pollService.ClosePoll(t.Context(), closedPoll.GetID())
 	if err != nil {
 		t.Fatalf("Failed to close poll: %v", err)
 	}
+	if _, err := pollService.CreatePoll(t.Context(), "another guild", "", "otherGuildPoll", []string{"option1", "option2"}, time.Time{}, ""); err != nil {
+		t.Fatalf("Failed to create open poll: %v", err)
+	}
 
 	// ACT: Get all open polls
-	polls, err := pollService.GetOpenPolls()
+	polls, err := pollService.GetOpenPolls(t.Context(), testGuildID)
 	if err != nil {
 		t.Fatalf("GetOpenPolls returned an unexpected error: %v", err)
 	}
@@ -83,7 +105,7 @@ func testCreatePoll(t *testing.T, service PollService) {
 	title := "Which team will win first map?"
 	options := []string{"Team A", "Team B"}
 
-	poll, err := service.CreatePoll(title, options)
+	poll, err := service.CreatePoll(t.Context(), testGuildID, "creator", title, options, time.Time{}, "")
 
 	if err != nil {
 		t.Fatalf("CreatePoll returned an unexpected error: %v", err)
@@ -93,6 +115,14 @@ func testCreatePoll(t *testing.T, service PollService) {
 		t.Error("Expected poll ID to be set, but it was empty")
 	}
 
+	if poll.GetGuildID() != testGuildID {
+		t.Errorf("Expected poll to belong to guild '%s', but got '%s'", testGuildID, poll.GetGuildID())
+	}
+
+	if poll.GetCreatorID() != "creator" {
+		t.Errorf("Expected poll to be created by 'creator', but got '%s'", poll.GetCreatorID())
+	}
+
 	if poll.GetTitle() != title {
 		t.Errorf("Expected poll title to be '%s', but got '%s'", title, poll.GetTitle())
 	}
@@ -109,24 +139,54 @@ func testCreatePoll(t *testing.T, service PollService) {
 
 }
 
-func testExactlyTwoOptions(t *testing.T, service PollService) {
+func testCreatePollWithManyOptions(t *testing.T, service PollService) {
+	title := "Who will win the tournament?"
+	options := []string{"Team A", "Team B", "Team C", "Team D", "Team E", "Team F"}
+
+	poll, err := service.CreatePoll(t.Context(), testGuildID, "", title, options, time.Time{}, "")
+	if err != nil {
+		t.Fatalf("CreatePoll returned an unexpected error: %v", err)
+	}
+
+	if len(poll.GetOptions()) != len(options) {
+		t.Fatalf("Expected %d options, but got %d", len(options), len(poll.GetOptions()))
+	}
+
+	if poll.GetOutcome() != Pending {
+		t.Errorf("Expected outcome to be pending, but got %d", poll.GetOutcome())
+	}
+}
+
+func testInvalidOptionCount(t *testing.T, service PollService) {
 	title := "Which team will win first map?"
-	options := []string{"Team A", "Team B", "Team C"}
 
-	_, err := service.CreatePoll(title, options)
+	tooMany := make([]string, MaxOptions+1)
+	for i := range tooMany {
+		tooMany[i] = fmt.Sprintf("Team %d", i)
+	}
 
-	if err == nil {
-		t.Fatal("Expected CreatePoll to return an error for more than two options, but it did not")
+	for _, options := range [][]string{{"Team A"}, tooMany} {
+		_, err := service.CreatePoll(t.Context(), testGuildID, "", title, options, time.Time{}, "")
+		if !errors.Is(err, ErrInvalidOptionCount) {
+			t.Errorf("Expected error '%v' for %d options, but got '%v'", ErrInvalidOptionCount, len(options), err)
+		}
 	}
+}
 
-	expectedError := "poll must have exactly two options"
-	if err.Error() != expectedError {
-		t.Errorf("Expected error message '%s', but got '%s'", expectedError, err.Error())
+func testSelectInvalidOutcome(t *testing.T, service PollService) {
+	poll, err := createDefaultTestPoll(t.Context(), service)
+	if err != nil {
+		t.Fatal("CreatePoll returned an unexpected error", err)
+	}
+
+	err = service.SelectOutcome(t.Context(), poll.GetID(), OutcomeStatus(len(poll.GetOptions())))
+	if !errors.Is(err, ErrInvalidOutcome) {
+		t.Errorf("Expected error '%v', but got '%v'", ErrInvalidOutcome, err)
 	}
 }
 
 func testClosePoll(t *testing.T, service PollService) {
-	poll, err := createDefaultTestPoll(service)
+	poll, err := createDefaultTestPoll(t.Context(), service)
 
 	if err != nil {
 		t.Fatal("CreatePoll returned an unexpected error:", err)
@@ -135,11 +195,11 @@ func testClosePoll(t *testing.T, service PollService) {
 		t.Fatal("Expected poll to be open after creation, but it was closed")
 	}
 
-	if err := service.ClosePoll(poll.GetID()); err != nil {
+	if err := service.ClosePoll(t.Context(), poll.GetID()); err != nil {
 		t.Fatal("ClosePoll returned an unexpected error:", err)
 	}
 
-	updatedPoll, updateError := service.GetPollById(poll.GetID())
+	updatedPoll, updateError := service.GetPollById(t.Context(), poll.GetID())
 	if updateError != nil {
 		t.Fatal("GetPollById returned an unexpected error:", updateError)
 	}
@@ -149,21 +209,51 @@ func testClosePoll(t *testing.T, service PollService) {
 	}
 }
 
+func testCancelPoll(t *testing.T, service PollService) {
+	poll, err := createDefaultTestPoll(t.Context(), service)
+	if err != nil {
+		t.Fatal("CreatePoll returned an unexpected error:", err)
+	}
+
+	if err := service.CancelPoll(t.Context(), poll.GetID()); err != nil {
+		t.Fatal("CancelPoll returned an unexpected error:", err)
+	}
+
+	cancelledPoll, err := service.GetPollById(t.Context(), poll.GetID())
+	if err != nil {
+		t.Fatal("GetPollById returned an unexpected error:", err)
+	}
+	if cancelledPoll.GetStatus() != Cancelled {
+		t.Errorf("Expected poll status %v, but got %v", Cancelled, cancelledPoll.GetStatus())
+	}
+	if cancelledPoll.GetOutcome() != Pending {
+		t.Errorf("Expected outcome to be pending, but got %d", cancelledPoll.GetOutcome())
+	}
+
+	if err := service.CancelPoll(t.Context(), poll.GetID()); !errors.Is(err, ErrPollIsAlreadyCancelled) {
+		t.Errorf("Expected error '%v', but got '%v'", ErrPollIsAlreadyCancelled, err)
+	}
+
+	if err := service.ClosePoll(t.Context(), poll.GetID()); !errors.Is(err, ErrPollIsAlreadyClosed) {
+		t.Errorf("Expected error '%v', but got '%v'", ErrPollIsAlreadyClosed, err)
+	}
+}
+
 func testSelectOutcome(t *testing.T, service PollService) {
-	poll, err := createDefaultTestPoll(service)
+	poll, err := createDefaultTestPoll(t.Context(), service)
 	if err != nil {
 		t.Fatal("CreatePoll returned an unexpected error", err)
 	}
 
 	// Test selecting an outcome
-	teamAIndex := Option1
-	err = service.SelectOutcome(poll.GetID(), teamAIndex)
+	teamAIndex := OutcomeStatus(0)
+	err = service.SelectOutcome(t.Context(), poll.GetID(), teamAIndex)
 	if err != nil {
 		t.Fatal("SelectOutcome returned an unexpected error", err)
 	}
 
 	// Get the updated poll
-	poll, err = service.GetPollById(poll.GetID())
+	poll, err = service.GetPollById(t.Context(), poll.GetID())
 	if err != nil {
 		t.Fatal("GetPollById returned an unexpected error:", err)
 	}
@@ -174,21 +264,21 @@ func testSelectOutcome(t *testing.T, service PollService) {
 	}
 }
 
-func createDefaultTestPoll(service PollService) (Poll, error) {
+func createDefaultTestPoll(ctx context.Context, service PollService) (Poll, error) {
 	title := "Which team will win first map?"
 	options := []string{"Team A", "Team B"}
-	poll, err := service.CreatePoll(title, options)
+	poll, err := service.CreatePoll(ctx, testGuildID, "", title, options, time.Time{}, "")
 	return poll, err
 }
 
 func testGetPollById(t *testing.T, pollService PollService) {
 	// Testing that the GetPollById method retrieves the exact poll that was created by CreatePoll instead of a copy.
-	poll, err := createDefaultTestPoll(pollService)
+	poll, err := createDefaultTestPoll(t.Context(), pollService)
 	if err != nil {
 		t.Fatal("CreatePoll returned an unexpected error:", err)
 	}
 
-	retrievedPoll, err := pollService.GetPollById(poll.GetID())
+	retrievedPoll, err := pollService.GetPollById(t.Context(), poll.GetID())
 	if err != nil {
 		t.Fatal("GetPollById returned an unexpected error:", err)
 	}
@@ -197,3 +287,176 @@ func testGetPollById(t *testing.T, pollService PollService) {
 		t.Errorf("Expected retrieved poll to be equal to created poll, but they differ")
 	}
 }
+
+func testCreatePollWithDeadline(t *testing.T, service PollService) {
+	closesAt := time.Now().Add(time.Hour)
+
+	poll, err := service.CreatePoll(t.Context(), testGuildID, "", "Which team will win first map?", []string{"Team A", "Team B"}, closesAt, "")
+	if err != nil {
+		t.Fatal("CreatePoll returned an unexpected error:", err)
+	}
+
+	if !poll.GetClosesAt().Equal(closesAt) {
+		t.Errorf("Expected poll to close at %v, but got %v", closesAt, poll.GetClosesAt())
+	}
+
+	if DeadlinePassed(poll, time.Now()) {
+		t.Error("Expected deadline not to have passed yet")
+	}
+
+	if !DeadlinePassed(poll, closesAt) {
+		t.Error("Expected deadline to have passed at the close time")
+	}
+}
+
+func testDeadlineInPast(t *testing.T, service PollService) {
+	_, err := service.CreatePoll(t.Context(), testGuildID, "", "Which team will win first map?", []string{"Team A", "Team B"}, time.Now().Add(-time.Minute), "")
+	if !errors.Is(err, ErrDeadlineInPast) {
+		t.Errorf("Expected error '%v', but got '%v'", ErrDeadlineInPast, err)
+	}
+}
+
+func testCorrectOutcome(t *testing.T, service PollService) {
+	poll, err := createDefaultTestPoll(t.Context(), service)
+	if err != nil {
+		t.Fatal("CreatePoll returned an unexpected error:", err)
+	}
+	if err := service.ClosePoll(t.Context(), poll.GetID()); err != nil {
+		t.Fatal("ClosePoll returned an unexpected error:", err)
+	}
+	if err := service.SelectOutcome(t.Context(), poll.GetID(), OutcomeStatus(0)); err != nil {
+		t.Fatal("SelectOutcome returned an unexpected error:", err)
+	}
+
+	correction, err := service.CorrectOutcome(t.Context(), poll.GetID(), OutcomeStatus(1), "moderator")
+	if err != nil {
+		t.Fatal("CorrectOutcome returned an unexpected error:", err)
+	}
+
+	if correction.PreviousOutcome != OutcomeStatus(0) || correction.NewOutcome != OutcomeStatus(1) {
+		t.Errorf("Expected correction from 0 to 1, but got %d to %d", correction.PreviousOutcome, correction.NewOutcome)
+	}
+	if correction.CorrectedBy != "moderator" {
+		t.Errorf("Expected correction by %q, but got %q", "moderator", correction.CorrectedBy)
+	}
+
+	correctedPoll, err := service.GetPollById(t.Context(), poll.GetID())
+	if err != nil {
+		t.Fatal("GetPollById returned an unexpected error:", err)
+	}
+	if correctedPoll.GetOutcome() != OutcomeStatus(1) {
+		t.Errorf("Expected outcome 1, but got %d", correctedPoll.GetOutcome())
+	}
+
+	if _, err := service.CorrectOutcome(t.Context(), poll.GetID(), OutcomeStatus(1), "moderator"); !errors.Is(err, ErrOutcomeUnchanged) {
+		t.Errorf("Expected error '%v', but got '%v'", ErrOutcomeUnchanged, err)
+	}
+
+	history, err := service.GetOutcomeCorrections(t.Context(), poll.GetID())
+	if err != nil {
+		t.Fatal("GetOutcomeCorrections returned an unexpected error:", err)
+	}
+	if len(history) != 1 {
+		t.Fatalf("Expected 1 correction, but got %d", len(history))
+	}
+	if history[0].NewOutcome != OutcomeStatus(1) {
+		t.Errorf("Expected recorded outcome 1, but got %d", history[0].NewOutcome)
+	}
+}
+
+func testCorrectUnresolvedPoll(t *testing.T, service PollService) {
+	poll, err := createDefaultTestPoll(t.Context(), service)
+	if err != nil {
+		t.Fatal("CreatePoll returned an unexpected error:", err)
+	}
+	if err := service.ClosePoll(t.Context(), poll.GetID()); err != nil {
+		t.Fatal("ClosePoll returned an unexpected error:", err)
+	}
+
+	if _, err := service.CorrectOutcome(t.Context(), poll.GetID(), OutcomeStatus(1), "moderator"); !errors.Is(err, ErrOutcomeNotSelected) {
+		t.Errorf("Expected error '%v', but got '%v'", ErrOutcomeNotSelected, err)
+	}
+}
+
+func testCreatePollInCategory(t *testing.T, service PollService) {
+	poll, err := service.CreatePoll(t.Context(), testGuildID, "", "Which team will win first map?", []string{"Team A", "Team B"}, time.Time{}, "  Valorant ")
+	if err != nil {
+		t.Fatal("CreatePoll returned an unexpected error:", err)
+	}
+
+	if poll.GetCategory() != "Valorant" {
+		t.Errorf("Expected category %q, but got %q", "Valorant", poll.GetCategory())
+	}
+
+	tooLong := strings.Repeat("a", MaxCategoryLength+1)
+	if _, err := service.CreatePoll(t.Context(), testGuildID, "", "Which team will win first map?", []string{"Team A", "Team B"}, time.Time{}, tooLong); !errors.Is(err, ErrCategoryTooLong) {
+		t.Errorf("Expected error '%v', but got '%v'", ErrCategoryTooLong, err)
+	}
+}
+
+func testPollTimestamps(t *testing.T, service PollService) {
+	before := time.Now()
+	poll, err := createDefaultTestPoll(t.Context(), service)
+	if err != nil {
+		t.Fatal("CreatePoll returned an unexpected error:", err)
+	}
+
+	if poll.GetCreatedAt().Before(before) {
+		t.Errorf("Expected the poll to be created after %v, but got %v", before, poll.GetCreatedAt())
+	}
+	if !poll.GetClosedAt().IsZero() {
+		t.Errorf("Expected an open poll to have no close time, but got %v", poll.GetClosedAt())
+	}
+
+	if err := service.ClosePoll(t.Context(), poll.GetID()); err != nil {
+		t.Fatal("ClosePoll returned an unexpected error:", err)
+	}
+	closedPoll, err := service.GetPollById(t.Context(), poll.GetID())
+	if err != nil {
+		t.Fatal("GetPollById returned an unexpected error:", err)
+	}
+	closedAt := closedPoll.GetClosedAt()
+	if closedAt.Before(before) {
+		t.Errorf("Expected the poll to close after %v, but got %v", before, closedAt)
+	}
+
+	// Cancelling a closed poll keeps the time betting closed.
+	if err := service.CancelPoll(t.Context(), poll.GetID()); err != nil {
+		t.Fatal("CancelPoll returned an unexpected error:", err)
+	}
+	cancelledPoll, err := service.GetPollById(t.Context(), poll.GetID())
+	if err != nil {
+		t.Fatal("GetPollById returned an unexpected error:", err)
+	}
+	if !cancelledPoll.GetClosedAt().Equal(closedAt) {
+		t.Errorf("Expected the close time to stay %v, but got %v", closedAt, cancelledPoll.GetClosedAt())
+	}
+}
+
+func testListPolls(t *testing.T, service PollService) {
+	openPoll, err := createDefaultTestPoll(t.Context(), service)
+	if err != nil {
+		t.Fatal("CreatePoll returned an unexpected error:", err)
+	}
+	closedPoll, err := createDefaultTestPoll(t.Context(), service)
+	if err != nil {
+		t.Fatal("CreatePoll returned an unexpected error:", err)
+	}
+	if err := service.ClosePoll(t.Context(), closedPoll.GetID()); err != nil {
+		t.Fatal("ClosePoll returned an unexpected error:", err)
+	}
+
+	page, err := service.ListPolls(t.Context(), PollQuery{Statuses: []PollStatus{Open}, Limit: 10})
+	if err != nil {
+		t.Fatal("ListPolls returned an unexpected error:", err)
+	}
+	if page.Total != 1 || len(page.Polls) != 1 || page.Polls[0].GetID() != openPoll.GetID() {
+		t.Errorf("Expected only the open poll, but got %+v", page)
+	}
+
+	for _, query := range []PollQuery{{Limit: 0}, {Limit: 10, Offset: -1}} {
+		if _, err := service.ListPolls(t.Context(), query); !errors.Is(err, ErrInvalidPollQuery) {
+			t.Errorf("Expected error '%v' for %+v, but got '%v'", ErrInvalidPollQuery, query, err)
+		}
+	}
+}
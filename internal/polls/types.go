@@ -1,22 +1,48 @@
 package polls
 
+import "time"
+
 type poll struct {
-	ID      string
-	Title   string
-	Options []string
-	Status  PollStatus
-	Outcome OutcomeStatus
+	ID string
+	// GuildID is the community the poll belongs to. It is empty for polls
+	// created before polls were scoped to a guild.
+	GuildID string
+	// CreatorID is the user who created the poll. It is empty for polls created
+	// before creators were recorded.
+	CreatorID string
+	Title     string
+	Options   []string
+	Status    PollStatus
+	Outcome   OutcomeStatus
+	ClosesAt  time.Time
+	// Category groups related polls, such as a game or a league. It is empty
+	// for uncategorised polls.
+	Category string
+	// CreatedAt is when the poll was opened. ClosedAt is when betting closed
+	// or the poll was cancelled, or the zero time while it is open. Both are
+	// zero for polls created before they were recorded.
+	CreatedAt time.Time
+	ClosedAt  time.Time
 }
 
 type Poll interface {
 	GetID() string
+	GetGuildID() string
+	GetCreatorID() string
 	GetTitle() string
 	GetOptions() []string
 	GetStatus() PollStatus
 	GetOutcome() OutcomeStatus
+	// GetClosesAt returns when betting closes, or the zero time if the poll has no deadline.
+	GetClosesAt() time.Time
+	GetCategory() string
+	GetCreatedAt() time.Time
+	GetClosedAt() time.Time
 }
 
 func (p *poll) GetID() string                    { return p.ID }
+func (p *poll) GetGuildID() string               { return p.GuildID }
+func (p *poll) GetCreatorID() string             { return p.CreatorID }
 func (p *poll) GetTitle() string                 { return p.Title }
 func (p *poll) SetTitle(title string)            { p.Title = title }
 func (p *poll) GetOptions() []string             { return p.Options }
@@ -25,18 +51,69 @@ func (p *poll) GetStatus() PollStatus            { return p.Status }
 func (p *poll) SetStatus(status PollStatus)      { p.Status = status }
 func (p *poll) GetOutcome() OutcomeStatus        { return p.Outcome }
 func (p *poll) SetOutcome(outcome OutcomeStatus) { p.Outcome = outcome }
+func (p *poll) GetClosesAt() time.Time           { return p.ClosesAt }
+func (p *poll) SetClosesAt(closesAt time.Time)   { p.ClosesAt = closesAt }
+func (p *poll) GetCategory() string              { return p.Category }
+func (p *poll) GetCreatedAt() time.Time          { return p.CreatedAt }
+func (p *poll) GetClosedAt() time.Time           { return p.ClosedAt }
+
+// DeadlinePassed reports whether the poll has a deadline that is at or before now.
+func DeadlinePassed(poll Poll, now time.Time) bool {
+	closesAt := poll.GetClosesAt()
+	return !closesAt.IsZero() && !now.Before(closesAt)
+}
+
+// OutcomeCorrection records a change to the outcome of a poll that had already been resolved.
+type OutcomeCorrection struct {
+	PollID          string
+	PreviousOutcome OutcomeStatus
+	NewOutcome      OutcomeStatus
+	CorrectedBy     string
+	CorrectedAt     time.Time
+}
 
 type PollStatus int
 
 const (
 	Open PollStatus = iota
 	Closed
+	// Cancelled polls were called off. Their bets count as neither a win nor a loss.
+	Cancelled
 )
 
+// OutcomeStatus is the index of the winning option, or Pending while the
+// poll has not been resolved.
 type OutcomeStatus int
 
+const Pending OutcomeStatus = -1
+
+// The number of options a poll may have. The upper bound matches the number of
+// entries Discord allows in a select menu.
 const (
-	Option1 OutcomeStatus = iota
-	Option2
-	Pending
+	MinOptions = 2
+	MaxOptions = 25
 )
+
+// MaxCategoryLength is the longest category a poll may have, in characters.
+const MaxCategoryLength = 30
+
+type PollQuery struct {
+	// GuildID is the guild whose polls are listed, or every guild if empty.
+	GuildID string
+	// CreatorID is the user whose polls are listed, or every user if empty.
+	CreatorID string
+	// Statuses are the statuses to list, or every status if empty.
+	Statuses []PollStatus
+	// ClosedSince leaves out polls that closed before it. Open polls are
+	// always listed, as are closed polls when it is the zero time.
+	ClosedSince time.Time
+	Limit       int
+	Offset      int
+}
+
+type PollPage struct {
+	// Polls are open polls first, then the most recently created.
+	Polls []Poll
+	// Total is the number of matching polls across every page.
+	Total int
+}
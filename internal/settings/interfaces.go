@@ -0,0 +1,31 @@
+package settings
+
+import (
+	"context"
+	"errors"
+)
+
+type SettingsService interface {
+	// GetSettings returns the guild's settings. A guild that has not changed
+	// any setting gets the defaults.
+	GetSettings(ctx context.Context, guildID string) (Settings, error)
+	// UpdateSettings validates the settings and saves them for their guild.
+	UpdateSettings(ctx context.Context, settings Settings) error
+	// Defaults returns the settings of a guild that has not changed any.
+	Defaults(guildID string) Settings
+}
+
+type SettingsRepository interface {
+	// Save stores the settings, replacing any the guild had before.
+	Save(ctx context.Context, settings Settings) error
+	// GetByGuildID returns ErrSettingsNotFound if the guild's settings were never saved.
+	GetByGuildID(ctx context.Context, guildID string) (Settings, error)
+}
+
+var ErrSettingsNotFound = errors.New("guild settings not found")
+var ErrMissingGuild = errors.New("settings must belong to a guild")
+var ErrTooManyModeratorRoles = errors.New("too many moderator roles")
+var ErrInvalidPollDuration = errors.New("invalid default poll duration")
+var ErrInvalidAccentColour = errors.New("invalid accent colour")
+var ErrInvalidStartingBalance = errors.New("invalid starting balance")
+var ErrUnsupportedLocale = errors.New("unsupported locale")
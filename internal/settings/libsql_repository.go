@@ -0,0 +1,93 @@
+package settings
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+type libSQLRepository struct {
+	db *sql.DB
+}
+
+func NewLibSQLRepository(db *sql.DB) SettingsRepository {
+	return &libSQLRepository{db: db}
+}
+
+func (repo *libSQLRepository) Save(ctx context.Context, settings Settings) error {
+	transaction, err := repo.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("error while starting transaction: %w", err)
+	}
+	defer transaction.Rollback()
+
+	query := `INSERT INTO guild_settings (guild_id, default_poll_duration, accent_colour, announcement_channel_id, starting_balance, locale, stakes_enabled)
+              VALUES (?, ?, ?, ?, ?, ?, ?)
+              ON CONFLICT (guild_id) DO UPDATE SET
+                  default_poll_duration = excluded.default_poll_duration,
+                  accent_colour = excluded.accent_colour,
+                  announcement_channel_id = excluded.announcement_channel_id,
+                  starting_balance = excluded.starting_balance,
+                  locale = excluded.locale,
+                  stakes_enabled = excluded.stakes_enabled`
+	if _, err := transaction.ExecContext(ctx, query, settings.GuildID, int64(settings.DefaultPollDuration/time.Second), settings.AccentColour,
+		settings.AnnouncementChannelID, settings.StartingBalance, settings.Locale, settings.StakesEnabled); err != nil {
+		return fmt.Errorf("error while saving settings: %w", err)
+	}
+
+	if _, err := transaction.ExecContext(ctx, "DELETE FROM guild_moderator_roles WHERE guild_id = ?", settings.GuildID); err != nil {
+		return fmt.Errorf("error while clearing moderator roles: %w", err)
+	}
+	for index, roleID := range settings.ModeratorRoleIDs {
+		if _, err := transaction.ExecContext(ctx, "INSERT INTO guild_moderator_roles (guild_id, role_index, role_id) VALUES (?, ?, ?)", settings.GuildID, index, roleID); err != nil {
+			return fmt.Errorf("error while saving moderator role %s: %w", roleID, err)
+		}
+	}
+
+	if err := transaction.Commit(); err != nil {
+		return fmt.Errorf("error while committing transaction: %w", err)
+	}
+
+	return nil
+}
+
+func (repo *libSQLRepository) GetByGuildID(ctx context.Context, guildID string) (Settings, error) {
+	query := `SELECT guild_id, default_poll_duration, accent_colour, announcement_channel_id, starting_balance, locale, stakes_enabled
+              FROM guild_settings WHERE guild_id = ?`
+	row := repo.db.QueryRowContext(ctx, query, guildID)
+
+	var settings Settings
+	var pollDurationSeconds int64
+	if err := row.Scan(&settings.GuildID, &pollDurationSeconds, &settings.AccentColour, &settings.AnnouncementChannelID,
+		&settings.StartingBalance, &settings.Locale, &settings.StakesEnabled); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return Settings{}, ErrSettingsNotFound
+		}
+		return Settings{}, fmt.Errorf("error while scanning settings: %w", err)
+	}
+	settings.DefaultPollDuration = time.Duration(pollDurationSeconds) * time.Second
+
+	rows, err := repo.db.QueryContext(ctx, "SELECT role_id FROM guild_moderator_roles WHERE guild_id = ? ORDER BY role_index", guildID)
+	if err != nil {
+		return Settings{}, fmt.Errorf("error while executing query: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var roleID string
+		if err := rows.Scan(&roleID); err != nil {
+			return Settings{}, fmt.Errorf("error while scanning moderator role: %w", err)
+		}
+		settings.ModeratorRoleIDs = append(settings.ModeratorRoleIDs, roleID)
+	}
+
+	if err := rows.Err(); err != nil {
+		return Settings{}, fmt.Errorf("error during row iteration: %w", err)
+	}
+
+	return settings, nil
+}
+
+var _ SettingsRepository = (*libSQLRepository)(nil)
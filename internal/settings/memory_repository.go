@@ -0,0 +1,50 @@
+package settings
+
+import (
+	"context"
+	"slices"
+	"sync"
+)
+
+type memoryRepository struct {
+	mu       sync.Mutex
+	settings map[string]Settings
+}
+
+func NewMemoryRepository() SettingsRepository {
+	return &memoryRepository{
+		settings: make(map[string]Settings),
+	}
+}
+
+func (repo *memoryRepository) Save(ctx context.Context, settings Settings) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+
+	settings.ModeratorRoleIDs = slices.Clone(settings.ModeratorRoleIDs)
+	repo.settings[settings.GuildID] = settings
+	return nil
+}
+
+func (repo *memoryRepository) GetByGuildID(ctx context.Context, guildID string) (Settings, error) {
+	if err := ctx.Err(); err != nil {
+		return Settings{}, err
+	}
+
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+
+	settings, exists := repo.settings[guildID]
+	if !exists {
+		return Settings{}, ErrSettingsNotFound
+	}
+
+	settings.ModeratorRoleIDs = slices.Clone(settings.ModeratorRoleIDs)
+	return settings, nil
+}
+
+var _ SettingsRepository = (*memoryRepository)(nil)
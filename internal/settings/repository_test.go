@@ -0,0 +1,179 @@
+package settings
+
+import (
+	"errors"
+	"os"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"betting-discord-bot/internal/storage"
+)
+
+func setupLibSQL(t *testing.T) (SettingsRepository, func()) {
+	t.Helper()
+
+	// Sanitize the test name to create a clean, unique filename for each test run.
+	sanitizedTestName := strings.ReplaceAll(t.Name(), "/", "_")
+	dbPath := sanitizedTestName + ".db"
+
+	// Remove any old database file from a previous failed run.
+	_ = os.Remove(dbPath)
+
+	db, err := storage.InitializeDatabase(dbPath, "")
+	if err != nil {
+		t.Fatalf("Failed to initialize test database: %v", err)
+	}
+
+	repo := NewLibSQLRepository(db)
+
+	teardown := func() {
+		if err := db.Close(); err != nil {
+			t.Fatal("failed to close database")
+		}
+		if err := os.Remove(dbPath); err != nil {
+			t.Fatal("failed to remove database file")
+		}
+	}
+
+	return repo, teardown
+}
+
+func setupInMemory(t *testing.T) (SettingsRepository, func()) {
+	t.Helper()
+
+	repo := NewMemoryRepository()
+	teardown := func() {
+		// No cleanup needed for the in-memory version
+	}
+	return repo, teardown
+}
+
+func TestSettingsRepositoryImplementations(t *testing.T) {
+	t.Parallel()
+	implementations := []struct {
+		name  string
+		setup func(t *testing.T) (SettingsRepository, func())
+	}{
+		{name: "InMemoryRepository", setup: setupInMemory},
+		{name: "LibSQLRepository", setup: setupLibSQL},
+	}
+
+	testCases := []struct {
+		name string
+		run  func(t *testing.T, repo SettingsRepository)
+	}{
+		{"it should save and get settings", testSaveAndGet},
+		{"it should replace saved settings", testSaveReplaces},
+		{"it should return an error for a guild without settings", testGetMissing},
+		{"it should keep each guild's settings apart", testGuildsKeptApart},
+	}
+
+	for _, impl := range implementations {
+		t.Run(impl.name, func(t *testing.T) {
+			t.Parallel()
+
+			for _, tc := range testCases {
+				t.Run(tc.name, func(t *testing.T) {
+					t.Parallel()
+
+					repo, cleanup := impl.setup(t)
+					t.Cleanup(cleanup)
+
+					tc.run(t, repo)
+				})
+			}
+		})
+	}
+}
+
+func newTestSettings(guildID string) Settings {
+	return Settings{
+		GuildID:               guildID,
+		ModeratorRoleIDs:      []string{"role-b", "role-a"},
+		DefaultPollDuration:   90 * time.Minute,
+		AccentColour:          0x123456,
+		AnnouncementChannelID: "channel",
+		StartingBalance:       250,
+		Locale:                "en-GB",
+		StakesEnabled:         true,
+	}
+}
+
+func assertSettings(t *testing.T, expected Settings, actual Settings) {
+	t.Helper()
+
+	if !slices.Equal(actual.ModeratorRoleIDs, expected.ModeratorRoleIDs) {
+		t.Errorf("Expected moderator roles %v, but got %v", expected.ModeratorRoleIDs, actual.ModeratorRoleIDs)
+	}
+	actual.ModeratorRoleIDs, expected.ModeratorRoleIDs = nil, nil
+	if !reflect.DeepEqual(actual, expected) {
+		t.Errorf("Expected settings %+v, but got %+v", expected, actual)
+	}
+}
+
+func testSaveAndGet(t *testing.T, repo SettingsRepository) {
+	saved := newTestSettings("guild")
+	if err := repo.Save(t.Context(), saved); err != nil {
+		t.Fatalf("Save() returned an unexpected error: %v", err)
+	}
+
+	retrieved, err := repo.GetByGuildID(t.Context(), "guild")
+	if err != nil {
+		t.Fatalf("GetByGuildID() returned an unexpected error: %v", err)
+	}
+	assertSettings(t, saved, retrieved)
+}
+
+func testSaveReplaces(t *testing.T, repo SettingsRepository) {
+	if err := repo.Save(t.Context(), newTestSettings("guild")); err != nil {
+		t.Fatalf("Save() returned an unexpected error: %v", err)
+	}
+
+	replacement := newTestSettings("guild")
+	replacement.ModeratorRoleIDs = []string{"role-c"}
+	replacement.DefaultPollDuration = 0
+	replacement.AnnouncementChannelID = ""
+	replacement.StakesEnabled = false
+	if err := repo.Save(t.Context(), replacement); err != nil {
+		t.Fatalf("Save() returned an unexpected error: %v", err)
+	}
+
+	retrieved, err := repo.GetByGuildID(t.Context(), "guild")
+	if err != nil {
+		t.Fatalf("GetByGuildID() returned an unexpected error: %v", err)
+	}
+	assertSettings(t, replacement, retrieved)
+}
+
+func testGetMissing(t *testing.T, repo SettingsRepository) {
+	if _, err := repo.GetByGuildID(t.Context(), "missing"); !errors.Is(err, ErrSettingsNotFound) {
+		t.Errorf("Expected ErrSettingsNotFound, but got %v", err)
+	}
+}
+
+func testGuildsKeptApart(t *testing.T, repo SettingsRepository) {
+	first := newTestSettings("first")
+	second := newTestSettings("second")
+	second.ModeratorRoleIDs = nil
+	second.Locale = "fr"
+	for _, saved := range []Settings{first, second} {
+		if err := repo.Save(t.Context(), saved); err != nil {
+			t.Fatalf("Save() returned an unexpected error: %v", err)
+		}
+	}
+
+	retrieved, err := repo.GetByGuildID(t.Context(), "first")
+	if err != nil {
+		t.Fatalf("GetByGuildID() returned an unexpected error: %v", err)
+	}
+	assertSettings(t, first, retrieved)
+
+	retrieved, err = repo.GetByGuildID(t.Context(), "second")
+	if err != nil {
+		t.Fatalf("GetByGuildID() returned an unexpected error: %v", err)
+	}
+	assertSettings(t, second, retrieved)
+}
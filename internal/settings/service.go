@@ -0,0 +1,71 @@
+package settings
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+)
+
+type service struct {
+	settingsRepo SettingsRepository
+	defaults     Settings
+}
+
+// NewService returns a service that hands out defaults to guilds without
+// saved settings. The GuildID of defaults is ignored.
+func NewService(settingsRepo SettingsRepository, defaults Settings) SettingsService {
+	return &service{
+		settingsRepo: settingsRepo,
+		defaults:     defaults,
+	}
+}
+
+func (s *service) GetSettings(ctx context.Context, guildID string) (Settings, error) {
+	settings, err := s.settingsRepo.GetByGuildID(ctx, guildID)
+	if errors.Is(err, ErrSettingsNotFound) {
+		return s.Defaults(guildID), nil
+	}
+	if err != nil {
+		return Settings{}, fmt.Errorf("failed to get settings of guild %s: %w", guildID, err)
+	}
+
+	return settings, nil
+}
+
+func (s *service) UpdateSettings(ctx context.Context, settings Settings) error {
+	if err := validate(settings); err != nil {
+		return err
+	}
+
+	if err := s.settingsRepo.Save(ctx, settings); err != nil {
+		return fmt.Errorf("failed to save settings of guild %s: %w", settings.GuildID, err)
+	}
+
+	return nil
+}
+
+func (s *service) Defaults(guildID string) Settings {
+	defaults := s.defaults
+	defaults.GuildID = guildID
+	defaults.ModeratorRoleIDs = slices.Clone(s.defaults.ModeratorRoleIDs)
+	return defaults
+}
+
+func validate(settings Settings) error {
+	switch {
+	case settings.GuildID == "":
+		return ErrMissingGuild
+	case len(settings.ModeratorRoleIDs) > MaxModeratorRoles:
+		return ErrTooManyModeratorRoles
+	case settings.DefaultPollDuration < 0 || settings.DefaultPollDuration > MaxPollDuration:
+		return ErrInvalidPollDuration
+	case settings.AccentColour < 0 || settings.AccentColour > MaxAccentColour:
+		return ErrInvalidAccentColour
+	case settings.StartingBalance < 0 || settings.StartingBalance > MaxStartingBalance:
+		return ErrInvalidStartingBalance
+	case !slices.Contains(SupportedLocales, settings.Locale):
+		return ErrUnsupportedLocale
+	}
+	return nil
+}
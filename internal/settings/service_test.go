@@ -0,0 +1,87 @@
+package settings
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+var testDefaults = Settings{AccentColour: 0xe32458, StartingBalance: 1000, Locale: "en-US", StakesEnabled: true}
+
+func setupService(t *testing.T) SettingsService {
+	t.Helper()
+
+	return NewService(NewMemoryRepository(), testDefaults)
+}
+
+func TestGuildWithoutSettingsGetsDefaults(t *testing.T) {
+	t.Parallel()
+	settingsService := setupService(t)
+
+	settings, err := settingsService.GetSettings(t.Context(), "guild")
+	if err != nil {
+		t.Fatal("GetSettings returned an unexpected error:", err)
+	}
+
+	expected := testDefaults
+	expected.GuildID = "guild"
+	assertSettings(t, expected, settings)
+}
+
+func TestUpdateSettings(t *testing.T) {
+	t.Parallel()
+	settingsService := setupService(t)
+
+	updated := settingsService.Defaults("guild")
+	updated.ModeratorRoleIDs = append(updated.ModeratorRoleIDs, "role")
+	updated.DefaultPollDuration = 2 * time.Hour
+	if err := settingsService.UpdateSettings(t.Context(), updated); err != nil {
+		t.Fatal("UpdateSettings returned an unexpected error:", err)
+	}
+
+	settings, err := settingsService.GetSettings(t.Context(), "guild")
+	if err != nil {
+		t.Fatal("GetSettings returned an unexpected error:", err)
+	}
+	assertSettings(t, updated, settings)
+
+	if defaults := settingsService.Defaults("other"); len(defaults.ModeratorRoleIDs) != 0 {
+		t.Errorf("Expected updating a guild to leave the defaults alone, but they have roles %v", defaults.ModeratorRoleIDs)
+	}
+}
+
+func TestRejectsInvalidSettings(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name     string
+		change   func(settings *Settings)
+		expected error
+	}{
+		{"no guild", func(settings *Settings) { settings.GuildID = "" }, ErrMissingGuild},
+		{"too many moderator roles", func(settings *Settings) { settings.ModeratorRoleIDs = make([]string, MaxModeratorRoles+1) }, ErrTooManyModeratorRoles},
+		{"negative poll duration", func(settings *Settings) { settings.DefaultPollDuration = -time.Minute }, ErrInvalidPollDuration},
+		{"poll duration too long", func(settings *Settings) { settings.DefaultPollDuration = MaxPollDuration + time.Second }, ErrInvalidPollDuration},
+		{"accent colour out of range", func(settings *Settings) { settings.AccentColour = MaxAccentColour + 1 }, ErrInvalidAccentColour},
+		{"negative starting balance", func(settings *Settings) { settings.StartingBalance = -1 }, ErrInvalidStartingBalance},
+		{"starting balance too large", func(settings *Settings) { settings.StartingBalance = MaxStartingBalance + 1 }, ErrInvalidStartingBalance},
+		{"unknown locale", func(settings *Settings) { settings.Locale = "xx" }, ErrUnsupportedLocale},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			t.Parallel()
+			settingsService := setupService(t)
+
+			settings := settingsService.Defaults("guild")
+			testCase.change(&settings)
+			if err := settingsService.UpdateSettings(t.Context(), settings); !errors.Is(err, testCase.expected) {
+				t.Errorf("Expected %v, but got %v", testCase.expected, err)
+			}
+
+			if _, err := settingsService.GetSettings(t.Context(), "guild"); err != nil {
+				t.Fatal("GetSettings returned an unexpected error:", err)
+			}
+		})
+	}
+}
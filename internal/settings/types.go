@@ -0,0 +1,54 @@
+package settings
+
+import (
+	"slices"
+	"time"
+)
+
+// Settings are the preferences of a single guild.
+type Settings struct {
+	GuildID string
+	// ModeratorRoleIDs are the Discord roles whose members count as moderators,
+	// alongside members with the Manage Messages permission.
+	ModeratorRoleIDs []string
+	// DefaultPollDuration is how long betting stays open on polls created
+	// without a close time. Zero leaves them open until they are ended by hand.
+	DefaultPollDuration time.Duration
+	// AccentColour is the RGB colour of the bar beside the bot's messages.
+	AccentColour int
+	// AnnouncementChannelID is where closed polls and outcomes are announced.
+	// They are announced in the channel the poll was posted in when it is empty.
+	AnnouncementChannelID string
+	// StartingBalance is the number of points a wallet opens with.
+	StartingBalance int64
+	// Locale is the Discord locale the guild would like the bot's messages in.
+	// It is only stored for now: every message is still written in English.
+	Locale string
+	// StakesEnabled lets users wager points on their bets. Bets are placed
+	// without a wager when it is off.
+	StakesEnabled bool
+}
+
+// IsModeratorRole reports whether members with the role count as moderators.
+func (settings Settings) IsModeratorRole(roleID string) bool {
+	return slices.Contains(settings.ModeratorRoleIDs, roleID)
+}
+
+// MaxModeratorRoles is how many moderator roles a guild may have.
+const MaxModeratorRoles = 10
+
+// MaxPollDuration is the longest default poll duration.
+const MaxPollDuration = 30 * 24 * time.Hour
+
+// MaxAccentColour is white, the largest RGB colour.
+const MaxAccentColour = 0xffffff
+
+// MaxStartingBalance keeps starting balances well clear of overflowing a wallet.
+const MaxStartingBalance = 1_000_000_000
+
+// SupportedLocales are the locales Discord lets users pick.
+var SupportedLocales = []string{
+	"id", "da", "de", "en-GB", "en-US", "es-ES", "es-419", "fr", "hr", "it", "lt", "hu",
+	"nl", "no", "pl", "pt-BR", "ro", "fi", "sv-SE", "vi", "tr", "cs", "el", "bg",
+	"ru", "uk", "hi", "th", "zh-CN", "ja", "zh-TW", "ko",
+}
@@ -0,0 +1,276 @@
+package storage
+
+import (
+	"cmp"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Migration is a versioned change to the schema. Each migration is applied in
+// its own transaction and recorded in schema_migrations with its checksum.
+type Migration struct {
+	Version    int
+	Name       string
+	Statements []string
+	// Check, if set, runs in the transaction of the migration before its
+	// statements, and refuses the migration by returning an error. It is not
+	// part of the checksum.
+	Check func(transaction *sql.Tx) error
+}
+
+// Checksum identifies the statements of the migration. Whitespace is ignored,
+// so reindenting a migration does not change it.
+func (migration Migration) Checksum() string {
+	hash := sha256.New()
+	hash.Write([]byte(migration.Name))
+	for _, statement := range migration.Statements {
+		hash.Write([]byte{0})
+		hash.Write([]byte(strings.Join(strings.Fields(statement), " ")))
+	}
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// MigrationStatus says whether a migration has been applied to a database.
+type MigrationStatus struct {
+	Migration
+	Applied   bool
+	AppliedAt time.Time
+	// ChecksumMismatch is set when the migration was applied with different
+	// statements than it has now.
+	ChecksumMismatch bool
+	// Unknown is set for migrations that were applied by a newer binary, which
+	// this binary has no statements for.
+	Unknown bool
+}
+
+var ErrDatabaseTooNew = errors.New("database schema is newer than this binary")
+var ErrChecksumMismatch = errors.New("applied migration was changed")
+
+const createMigrationsTable = `CREATE TABLE IF NOT EXISTS schema_migrations (
+	version INTEGER PRIMARY KEY,
+	name TEXT NOT NULL,
+	checksum TEXT NOT NULL,
+	applied_at INTEGER NOT NULL
+);`
+
+// LatestSchemaVersion is the version of the newest migration this binary has.
+func LatestSchemaVersion() int {
+	return migrations[len(migrations)-1].Version
+}
+
+// Status lists every migration this binary has, and any a newer binary
+// applied, with whether each is applied. It does not change the database.
+func Status(db *sql.DB) ([]MigrationStatus, error) {
+	applied, err := appliedMigrations(db)
+	if err != nil {
+		return nil, err
+	}
+
+	statuses := make([]MigrationStatus, 0, len(migrations))
+	for _, migration := range migrations {
+		status := MigrationStatus{Migration: migration}
+		if record, exists := applied[migration.Version]; exists {
+			status.Applied = true
+			status.AppliedAt = record.appliedAt
+			status.ChecksumMismatch = record.checksum != migration.Checksum()
+			delete(applied, migration.Version)
+		}
+		statuses = append(statuses, status)
+	}
+
+	for version, record := range applied {
+		statuses = append(statuses, MigrationStatus{
+			Migration: Migration{Version: version, Name: record.name},
+			Applied:   true,
+			AppliedAt: record.appliedAt,
+			Unknown:   true,
+		})
+	}
+
+	slices.SortFunc(statuses, func(a, b MigrationStatus) int {
+		return cmp.Compare(a.Version, b.Version)
+	})
+	return statuses, nil
+}
+
+// PendingMigrations returns the migrations Migrate would apply, in order. It
+// fails if the database was migrated by a newer binary or an applied
+// migration was changed since, and does not change the database.
+func PendingMigrations(db *sql.DB) ([]Migration, error) {
+	statuses, err := Status(db)
+	if err != nil {
+		return nil, err
+	}
+
+	var pending []Migration
+	for _, status := range statuses {
+		switch {
+		case status.Unknown:
+			return nil, fmt.Errorf("%w: migration %d (%s) is applied, but this binary only knows up to %d",
+				ErrDatabaseTooNew, status.Version, status.Name, LatestSchemaVersion())
+		case status.ChecksumMismatch:
+			return nil, fmt.Errorf("%w: migration %d (%s)", ErrChecksumMismatch, status.Version, status.Name)
+		case !status.Applied:
+			pending = append(pending, status.Migration)
+		}
+	}
+
+	return pending, nil
+}
+
+// Migrate applies every pending migration in order and returns the ones it
+// applied. A migration that fails is rolled back, along with its record.
+func Migrate(db *sql.DB) ([]Migration, error) {
+	pending, err := PendingMigrations(db)
+	if err != nil {
+		return nil, err
+	}
+	if len(pending) == 0 {
+		return nil, nil
+	}
+
+	if _, err := db.Exec(createMigrationsTable); err != nil {
+		return nil, fmt.Errorf("failed to create schema_migrations: %w", err)
+	}
+
+	for index, migration := range pending {
+		if err := applyMigration(db, migration); err != nil {
+			return pending[:index], fmt.Errorf("failed to apply migration %d (%s): %w", migration.Version, migration.Name, err)
+		}
+		log.Printf("Applied migration %d (%s)", migration.Version, migration.Name)
+	}
+
+	return pending, nil
+}
+
+func applyMigration(db *sql.DB, migration Migration) error {
+	transaction, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("error while starting transaction: %w", err)
+	}
+	defer transaction.Rollback()
+
+	if migration.Check != nil {
+		if err := migration.Check(transaction); err != nil {
+			return err
+		}
+	}
+
+	for index, statement := range migration.Statements {
+		if _, err := transaction.Exec(statement); err != nil {
+			return fmt.Errorf("error while executing statement %d: %w", index+1, err)
+		}
+	}
+
+	if migration.Version == migrations[0].Version {
+		if err := addLegacyColumns(transaction); err != nil {
+			return err
+		}
+	}
+
+	record := "INSERT INTO schema_migrations (version, name, checksum, applied_at) VALUES (?, ?, ?, ?)"
+	if _, err := transaction.Exec(record, migration.Version, migration.Name, migration.Checksum(), time.Now().UnixMilli()); err != nil {
+		return fmt.Errorf("error while recording migration: %w", err)
+	}
+
+	if err := transaction.Commit(); err != nil {
+		return fmt.Errorf("error while committing transaction: %w", err)
+	}
+
+	return nil
+}
+
+type migrationRecord struct {
+	name      string
+	checksum  string
+	appliedAt time.Time
+}
+
+func appliedMigrations(db *sql.DB) (map[int]migrationRecord, error) {
+	applied := make(map[int]migrationRecord)
+
+	var tableCount int
+	if err := db.QueryRow("SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = 'schema_migrations'").Scan(&tableCount); err != nil {
+		return nil, fmt.Errorf("failed to look for schema_migrations: %w", err)
+	}
+	if tableCount == 0 {
+		return applied, nil
+	}
+
+	rows, err := db.Query("SELECT version, name, checksum, applied_at FROM schema_migrations")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read schema_migrations: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var version int
+		var record migrationRecord
+		var appliedAt int64
+		if err := rows.Scan(&version, &record.name, &record.checksum, &appliedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan migration: %w", err)
+		}
+		record.appliedAt = time.UnixMilli(appliedAt)
+		applied[version] = record
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read schema_migrations: %w", err)
+	}
+	return applied, nil
+}
+
+type column struct {
+	table      string
+	name       string
+	definition string
+}
+
+// addLegacyColumns adds the legacy columns that tables created before
+// migrations existed are missing.
+func addLegacyColumns(transaction *sql.Tx) error {
+	for _, column := range legacyColumns {
+		exists, err := columnExists(transaction, column.table, column.name)
+		if err != nil {
+			return err
+		}
+		if exists {
+			continue
+		}
+
+		statement := fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", column.table, column.name, column.definition)
+		if _, err := transaction.Exec(statement); err != nil {
+			return fmt.Errorf("failed to add column %s.%s: %w", column.table, column.name, err)
+		}
+		log.Printf("Added column %s.%s", column.table, column.name)
+	}
+
+	return nil
+}
+
+func columnExists(transaction *sql.Tx, table string, name string) (bool, error) {
+	rows, err := transaction.Query("SELECT name FROM pragma_table_info(?)", table)
+	if err != nil {
+		return false, fmt.Errorf("failed to read columns of %s: %w", table, err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var columnName string
+		if err := rows.Scan(&columnName); err != nil {
+			return false, fmt.Errorf("failed to scan column of %s: %w", table, err)
+		}
+		if columnName == name {
+			return true, nil
+		}
+	}
+
+	return false, rows.Err()
+}
@@ -0,0 +1,326 @@
+package storage
+
+import (
+	"database/sql"
+	"errors"
+	"maps"
+	"os"
+	"strings"
+	"testing"
+)
+
+// openTestDatabase opens an empty database without migrating it.
+func openTestDatabase(t *testing.T) *sql.DB {
+	t.Helper()
+
+	// Sanitize the test name to create a clean, unique filename for each test run.
+	dbPath := strings.ReplaceAll(t.Name(), "/", "_") + ".db"
+
+	// Remove any old database file from a previous failed run.
+	_ = os.Remove(dbPath)
+
+	db, err := OpenDatabase(dbPath, "")
+	if err != nil {
+		t.Fatalf("Failed to open test database: %v", err)
+	}
+
+	t.Cleanup(func() {
+		if err := db.Close(); err != nil {
+			t.Error("failed to close database")
+		}
+		if err := os.Remove(dbPath); err != nil {
+			t.Error("failed to remove database file")
+		}
+	})
+	return db
+}
+
+func tableExists(t *testing.T, db *sql.DB, table string) bool {
+	t.Helper()
+	var count int
+	if err := db.QueryRow("SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = ?", table).Scan(&count); err != nil {
+		t.Fatalf("Failed to look for table %s: %v", table, err)
+	}
+	return count > 0
+}
+
+func TestMigrationVersionsAscend(t *testing.T) {
+	t.Parallel()
+	for index, migration := range migrations {
+		if migration.Version != index+1 {
+			t.Errorf("Expected migration %q to have version %d, but it has %d", migration.Name, index+1, migration.Version)
+		}
+		if migration.Name == "" || len(migration.Statements) == 0 {
+			t.Errorf("Expected migration %d to have a name and statements", migration.Version)
+		}
+	}
+}
+
+func TestMigrateNewDatabase(t *testing.T) {
+	t.Parallel()
+	db := openTestDatabase(t)
+
+	pending, err := PendingMigrations(db)
+	if err != nil {
+		t.Fatal("PendingMigrations returned an unexpected error:", err)
+	}
+	if len(pending) != len(migrations) {
+		t.Errorf("Expected every migration to be pending, but got %d of %d", len(pending), len(migrations))
+	}
+	if tableExists(t, db, "schema_migrations") {
+		t.Error("Expected listing pending migrations to leave the database alone")
+	}
+
+	applied, err := Migrate(db)
+	if err != nil {
+		t.Fatal("Migrate returned an unexpected error:", err)
+	}
+	if len(applied) != len(migrations) {
+		t.Errorf("Expected %d migrations to be applied, but got %d", len(migrations), len(applied))
+	}
+
+	applied, err = Migrate(db)
+	if err != nil || len(applied) != 0 {
+		t.Errorf("Expected nothing left to apply, but got %d migrations (%v)", len(applied), err)
+	}
+
+	statuses, err := Status(db)
+	if err != nil {
+		t.Fatal("Status returned an unexpected error:", err)
+	}
+	for _, status := range statuses {
+		if !status.Applied || status.ChecksumMismatch || status.Unknown || status.AppliedAt.IsZero() {
+			t.Errorf("Expected migration %d to be applied cleanly, but got %+v", status.Version, status)
+		}
+	}
+}
+
+func TestMigrateLegacyDatabase(t *testing.T) {
+	t.Parallel()
+	db := openTestDatabase(t)
+
+	// The schema as it was before polls had deadlines, stakes or guilds.
+	legacySchema := []string{
+		`CREATE TABLE polls (id TEXT PRIMARY KEY, title TEXT, outcome INTEGER, status INTEGER);`,
+		`CREATE TABLE poll_options (poll_id TEXT, option_index INTEGER, option_text TEXT, PRIMARY KEY (poll_id, option_index));`,
+		`CREATE TABLE bets (poll_id TEXT, user_id TEXT, selected_option_index INTEGER, bet_status INTEGER, PRIMARY KEY (poll_id, user_id));`,
+		`INSERT INTO polls (id, title, outcome, status) VALUES ('poll', 'Old poll', 2, 1);`,
+		`INSERT INTO poll_options (poll_id, option_index, option_text) VALUES ('poll', 0, 'A'), ('poll', 1, 'B');`,
+	}
+	for _, statement := range legacySchema {
+		if _, err := db.Exec(statement); err != nil {
+			t.Fatalf("Failed to create legacy schema: %v", err)
+		}
+	}
+
+	if _, err := Migrate(db); err != nil {
+		t.Fatal("Migrate returned an unexpected error:", err)
+	}
+
+	var title, guildID string
+	var outcome int
+	var stakeColumns int
+	if err := db.QueryRow("SELECT title, guild_id, outcome FROM polls WHERE id = 'poll'").Scan(&title, &guildID, &outcome); err != nil {
+		t.Fatalf("Expected the legacy poll to gain a guild, but got %v", err)
+	}
+	if title != "Old poll" || guildID != "" || outcome != -1 {
+		t.Errorf("Expected the legacy poll to be kept with a pending outcome, but got %q in guild %q with outcome %d", title, guildID, outcome)
+	}
+	if err := db.QueryRow("SELECT COUNT(*) FROM pragma_table_info('bets') WHERE name IN ('stake', 'payout', 'placed_at')").Scan(&stakeColumns); err != nil || stakeColumns != 3 {
+		t.Errorf("Expected bets to gain its stake columns, but found %d (%v)", stakeColumns, err)
+	}
+}
+
+func TestRefusesNewerDatabase(t *testing.T) {
+	t.Parallel()
+	db := openTestDatabase(t)
+	if _, err := Migrate(db); err != nil {
+		t.Fatal("Migrate returned an unexpected error:", err)
+	}
+
+	newer := LatestSchemaVersion() + 1
+	if _, err := db.Exec("INSERT INTO schema_migrations (version, name, checksum, applied_at) VALUES (?, 'from the future', '', 0)", newer); err != nil {
+		t.Fatalf("Failed to record a newer migration: %v", err)
+	}
+
+	if _, err := Migrate(db); !errors.Is(err, ErrDatabaseTooNew) {
+		t.Errorf("Expected ErrDatabaseTooNew, but got %v", err)
+	}
+
+	statuses, err := Status(db)
+	if err != nil {
+		t.Fatal("Status returned an unexpected error:", err)
+	}
+	if last := statuses[len(statuses)-1]; !last.Unknown || last.Version != newer {
+		t.Errorf("Expected the newer migration to be listed last as unknown, but got %+v", last)
+	}
+}
+
+func TestRefusesChangedMigration(t *testing.T) {
+	t.Parallel()
+	db := openTestDatabase(t)
+	if _, err := Migrate(db); err != nil {
+		t.Fatal("Migrate returned an unexpected error:", err)
+	}
+
+	if _, err := db.Exec("UPDATE schema_migrations SET checksum = 'changed' WHERE version = 2"); err != nil {
+		t.Fatalf("Failed to change the checksum: %v", err)
+	}
+
+	if _, err := PendingMigrations(db); !errors.Is(err, ErrChecksumMismatch) {
+		t.Errorf("Expected ErrChecksumMismatch, but got %v", err)
+	}
+}
+
+func TestChecksumIgnoresWhitespace(t *testing.T) {
+	t.Parallel()
+	compact := Migration{Version: 1, Name: "example", Statements: []string{"CREATE TABLE example (id TEXT, name TEXT);"}}
+	indented := Migration{Version: 1, Name: "example", Statements: []string{"CREATE TABLE example (id TEXT,\n\t\tname TEXT);\n"}}
+	changed := Migration{Version: 1, Name: "example", Statements: []string{"CREATE TABLE example (id INTEGER, name TEXT);"}}
+
+	if compact.Checksum() != indented.Checksum() {
+		t.Error("Expected reindenting a statement to keep its checksum")
+	}
+	if compact.Checksum() == changed.Checksum() {
+		t.Error("Expected changing a statement to change its checksum")
+	}
+}
+
+// TestFailedMigrationIsRolledBack swaps the migrations, so it must not run in
+// parallel with the tests that read them.
+func TestFailedMigrationIsRolledBack(t *testing.T) {
+	db := openTestDatabase(t)
+
+	released := migrations
+	t.Cleanup(func() { migrations = released })
+	migrations = append(append([]Migration(nil), released...), Migration{
+		Version: len(released) + 1,
+		Name:    "broken",
+		Statements: []string{
+			"CREATE TABLE half_done (id TEXT);",
+			"THIS IS NOT SQL;",
+		},
+	})
+
+	applied, err := Migrate(db)
+	if err == nil {
+		t.Fatal("Expected the broken migration to fail")
+	}
+	if len(applied) != len(released) {
+		t.Errorf("Expected the %d working migrations to be applied, but got %d", len(released), len(applied))
+	}
+	if tableExists(t, db, "half_done") {
+		t.Error("Expected the broken migration's first statement to be rolled back")
+	}
+
+	pending, err := PendingMigrations(db)
+	if err != nil || len(pending) != 1 || pending[0].Name != "broken" {
+		t.Errorf("Expected only the broken migration to be pending, but got %v (%v)", pending, err)
+	}
+}
+
+func TestAdoptUnscopedPolls(t *testing.T) {
+	t.Parallel()
+	db := openTestDatabase(t)
+
+	if _, err := Migrate(db); err != nil {
+		t.Fatal("Migrate returned an unexpected error:", err)
+	}
+	for _, statement := range []string{
+		`INSERT INTO polls (id, guild_id, title) VALUES ('unscoped', '', 'Old poll'), ('scoped', 'other', 'New poll');`,
+		`INSERT INTO poll_messages (poll_id, guild_id, channel_id, message_id) VALUES ('unscoped', '', 'channel', 'message');`,
+	} {
+		if _, err := db.Exec(statement); err != nil {
+			t.Fatalf("Failed to insert unscoped polls: %v", err)
+		}
+	}
+
+	if err := AdoptUnscopedPolls(t.Context(), db, "guild"); err != nil {
+		t.Fatal("AdoptUnscopedPolls returned an unexpected error:", err)
+	}
+
+	for _, check := range []struct{ query, id, expected string }{
+		{"SELECT guild_id FROM polls WHERE id = ?", "unscoped", "guild"},
+		{"SELECT guild_id FROM polls WHERE id = ?", "scoped", "other"},
+		{"SELECT guild_id FROM poll_messages WHERE poll_id = ?", "unscoped", "guild"},
+	} {
+		var guildID string
+		if err := db.QueryRow(check.query, check.id).Scan(&guildID); err != nil {
+			t.Fatalf("Failed to read the guild of %s: %v", check.id, err)
+		}
+		if guildID != check.expected {
+			t.Errorf("Expected %q to belong to guild %q, but got %q", check.query, check.expected, guildID)
+		}
+	}
+}
+
+func TestAdoptUnscopedWallets(t *testing.T) {
+	t.Parallel()
+	db := openTestDatabase(t)
+
+	// Wallets as they were before wallets were scoped to a guild.
+	if _, err := db.Exec(createMigrationsTable); err != nil {
+		t.Fatal("Failed to create schema_migrations:", err)
+	}
+	for _, migration := range migrations[:4] {
+		if err := applyMigration(db, migration); err != nil {
+			t.Fatalf("Failed to apply migration %d: %v", migration.Version, err)
+		}
+	}
+	for _, statement := range []string{
+		`INSERT INTO wallets (user_id, balance) VALUES ('alice', 150), ('bob', 0);`,
+		`INSERT INTO ledger_entries (transaction_id, account, user_id, kind, amount, created_at) VALUES
+			('grant', 'user:alice', 'alice', 'GRANT', 150, 0), ('grant', 'house', 'alice', 'GRANT', -150, 0);`,
+	} {
+		if _, err := db.Exec(statement); err != nil {
+			t.Fatalf("Failed to insert unscoped wallets: %v", err)
+		}
+	}
+	if _, err := Migrate(db); err != nil {
+		t.Fatal("Migrate returned an unexpected error:", err)
+	}
+
+	// Alice already opened a wallet in the guild since.
+	for _, statement := range []string{
+		`INSERT INTO wallets (guild_id, user_id, balance) VALUES ('guild', 'alice', 1000);`,
+		`INSERT INTO ledger_entries (transaction_id, account, guild_id, user_id, kind, amount, created_at) VALUES
+			('scoped', 'user:guild:alice', 'guild', 'alice', 'GRANT', 1000, 0), ('scoped', 'house', 'guild', 'alice', 'GRANT', -1000, 0);`,
+	} {
+		if _, err := db.Exec(statement); err != nil {
+			t.Fatalf("Failed to insert guild wallet: %v", err)
+		}
+	}
+
+	if err := AdoptUnscopedWallets(t.Context(), db, "guild"); err != nil {
+		t.Fatal("AdoptUnscopedWallets returned an unexpected error:", err)
+	}
+
+	balances := map[string]int64{}
+	rows, err := db.Query("SELECT guild_id, user_id, balance FROM wallets")
+	if err != nil {
+		t.Fatal("Failed to read wallets:", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var guildID, userID string
+		var balance int64
+		if err := rows.Scan(&guildID, &userID, &balance); err != nil {
+			t.Fatal("Failed to read wallet:", err)
+		}
+		balances[guildID+"/"+userID] = balance
+	}
+	expected := map[string]int64{"guild/alice": 1150, "guild/bob": 0}
+	if !maps.Equal(balances, expected) {
+		t.Errorf("Expected wallets %v, but got %v", expected, balances)
+	}
+
+	for account, expected := range map[string]int64{"user:alice": 0, "user:guild:alice": 1150, "house": -1150} {
+		var ledgerBalance int64
+		if err := db.QueryRow("SELECT COALESCE(SUM(amount), 0) FROM ledger_entries WHERE account = ?", account).Scan(&ledgerBalance); err != nil {
+			t.Fatalf("Failed to add up the ledger of %s: %v", account, err)
+		}
+		if ledgerBalance != expected {
+			t.Errorf("Expected the ledger to hold %d points in %s, but got %d", expected, account, ledgerBalance)
+		}
+	}
+}
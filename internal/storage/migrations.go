@@ -0,0 +1,296 @@
+package storage
+
+// migrations are applied in order of version. A released migration must never
+// change, as its checksum is checked against the one recorded when it was
+// applied: change the schema by adding a migration instead.
+var migrations = []Migration{
+	{
+		Version: 1,
+		Name:    "baseline",
+		// Databases created before migrations existed already have some of these
+		// tables, so every statement tolerates running against them.
+		Statements: []string{
+			`CREATE TABLE IF NOT EXISTS polls (
+				id TEXT PRIMARY KEY,
+				guild_id TEXT NOT NULL DEFAULT '',
+				creator_id TEXT NOT NULL DEFAULT '',
+				title TEXT,
+				outcome INTEGER,
+				status INTEGER,
+				closes_at INTEGER,
+				category TEXT NOT NULL DEFAULT '',
+				created_at INTEGER,
+				closed_at INTEGER
+			);`,
+			`CREATE TABLE IF NOT EXISTS poll_options (
+				poll_id TEXT,
+				option_index INTEGER,
+				option_text TEXT,
+				PRIMARY KEY (poll_id, option_index)
+			);`,
+			`CREATE TABLE IF NOT EXISTS bets (
+				poll_id TEXT,
+				user_id TEXT,
+				selected_option_index INTEGER,
+				bet_status INTEGER,
+				stake INTEGER NOT NULL DEFAULT 0,
+				payout INTEGER NOT NULL DEFAULT 0,
+				placed_at INTEGER NOT NULL DEFAULT 0,
+				PRIMARY KEY (poll_id, user_id)
+			);`,
+			`CREATE INDEX IF NOT EXISTS idx_bets_user_id ON bets(user_id);`,
+			`CREATE TABLE IF NOT EXISTS wallets (
+				user_id TEXT PRIMARY KEY,
+				balance INTEGER NOT NULL
+			);`,
+			`CREATE TABLE IF NOT EXISTS ledger_entries (
+				id INTEGER PRIMARY KEY AUTOINCREMENT,
+				transaction_id TEXT NOT NULL,
+				account TEXT NOT NULL,
+				user_id TEXT NOT NULL,
+				poll_id TEXT NOT NULL DEFAULT '',
+				kind TEXT NOT NULL,
+				amount INTEGER NOT NULL,
+				memo TEXT NOT NULL DEFAULT '',
+				created_at INTEGER NOT NULL
+			);`,
+			`CREATE INDEX IF NOT EXISTS idx_ledger_entries_user_id ON ledger_entries(user_id);`,
+			`CREATE INDEX IF NOT EXISTS idx_ledger_entries_poll_id ON ledger_entries(poll_id);`,
+			// The ledger is append-only.
+			`CREATE TRIGGER IF NOT EXISTS ledger_entries_no_update BEFORE UPDATE ON ledger_entries
+			BEGIN
+				SELECT RAISE(ABORT, 'ledger entries cannot be changed');
+			END;`,
+			`CREATE TRIGGER IF NOT EXISTS ledger_entries_no_delete BEFORE DELETE ON ledger_entries
+			BEGIN
+				SELECT RAISE(ABORT, 'ledger entries cannot be deleted');
+			END;`,
+			// Wallets opened before the ledger existed get an opening grant of their
+			// balance at the time, so that they reconcile.
+			`INSERT INTO ledger_entries (transaction_id, account, user_id, kind, amount, memo, created_at)
+				SELECT 'opening:' || user_id, 'user:' || user_id, user_id, 'GRANT', balance, 'balance before the ledger', CAST(strftime('%s', 'now') AS INTEGER) * 1000
+				FROM wallets
+				WHERE balance != 0 AND NOT EXISTS (SELECT 1 FROM ledger_entries WHERE ledger_entries.user_id = wallets.user_id)
+				UNION ALL
+				SELECT 'opening:' || user_id, 'house', user_id, 'GRANT', -balance, 'balance before the ledger', CAST(strftime('%s', 'now') AS INTEGER) * 1000
+				FROM wallets
+				WHERE balance != 0 AND NOT EXISTS (SELECT 1 FROM ledger_entries WHERE ledger_entries.user_id = wallets.user_id);`,
+			`CREATE TABLE IF NOT EXISTS users (
+				id TEXT PRIMARY KEY,
+				username TEXT,
+				display_name TEXT
+			);`,
+			`CREATE TABLE IF NOT EXISTS user_identities (
+				provider TEXT,
+				external_id TEXT,
+				external_id_hash TEXT,
+				user_id TEXT,
+				PRIMARY KEY (provider, external_id_hash),
+				FOREIGN KEY(user_id) REFERENCES users(id) ON DELETE CASCADE
+			);`,
+			`CREATE INDEX IF NOT EXISTS idx_identities_hash ON user_identities(provider, external_id_hash);`,
+			`CREATE TABLE IF NOT EXISTS outcome_corrections (
+				id INTEGER PRIMARY KEY AUTOINCREMENT,
+				poll_id TEXT,
+				previous_outcome INTEGER,
+				new_outcome INTEGER,
+				corrected_by TEXT,
+				corrected_at INTEGER
+			);`,
+			`CREATE TABLE IF NOT EXISTS bet_changes (
+				id INTEGER PRIMARY KEY AUTOINCREMENT,
+				poll_id TEXT,
+				user_id TEXT,
+				kind TEXT,
+				previous_option_index INTEGER,
+				new_option_index INTEGER,
+				changed_at INTEGER
+			);`,
+			`CREATE TABLE IF NOT EXISTS poll_messages (
+				poll_id TEXT PRIMARY KEY,
+				guild_id TEXT NOT NULL DEFAULT '',
+				channel_id TEXT,
+				message_id TEXT
+			);`,
+			// Two-option polls used to store a pending outcome as 2. Pending is now -1 so
+			// that 2 can be the index of a third option.
+			`UPDATE polls SET outcome = -1
+				WHERE outcome = 2
+				AND (SELECT COUNT(*) FROM poll_options WHERE poll_options.poll_id = polls.id) = 2;`,
+		},
+	},
+	{
+		Version: 2,
+		Name:    "guild settings",
+		Statements: []string{
+			`CREATE TABLE IF NOT EXISTS guild_settings (
+				guild_id TEXT PRIMARY KEY,
+				default_poll_duration INTEGER NOT NULL DEFAULT 0,
+				accent_colour INTEGER NOT NULL,
+				announcement_channel_id TEXT NOT NULL DEFAULT '',
+				starting_balance INTEGER NOT NULL,
+				locale TEXT NOT NULL,
+				stakes_enabled INTEGER NOT NULL
+			);`,
+			`CREATE TABLE IF NOT EXISTS guild_moderator_roles (
+				guild_id TEXT,
+				role_index INTEGER,
+				role_id TEXT,
+				PRIMARY KEY (guild_id, role_index)
+			);`,
+		},
+	},
+	{
+		Version: 3,
+		Name:    "permission policies",
+		Statements: []string{
+			`CREATE TABLE IF NOT EXISTS guild_permission_policies (
+				guild_id TEXT PRIMARY KEY,
+				creator_resolves INTEGER NOT NULL DEFAULT 0
+			);`,
+			`CREATE TABLE IF NOT EXISTS guild_permission_rules (
+				guild_id TEXT,
+				action TEXT,
+				everyone INTEGER NOT NULL DEFAULT 0,
+				moderators INTEGER NOT NULL DEFAULT 0,
+				permissions INTEGER NOT NULL DEFAULT 0,
+				PRIMARY KEY (guild_id, action)
+			);`,
+			`CREATE TABLE IF NOT EXISTS guild_permission_rule_roles (
+				guild_id TEXT,
+				action TEXT,
+				role_index INTEGER,
+				role_id TEXT,
+				PRIMARY KEY (guild_id, action, role_index)
+			);`,
+		},
+	},
+	{
+		Version: 4,
+		Name:    "foreign keys",
+		// SQLite cannot add a foreign key to a table, so each table that
+		// belongs to a poll or a user is rebuilt with one. Deleting a poll or a
+		// user deletes everything that belongs to it. Rows whose poll or user
+		// was already deleted could not be copied, so the migration is refused
+		// while there are any: the repair command lists and deletes them.
+		Check: refuseOrphans,
+		Statements: []string{
+			`CREATE TABLE poll_options_new (
+				poll_id TEXT,
+				option_index INTEGER,
+				option_text TEXT,
+				PRIMARY KEY (poll_id, option_index),
+				FOREIGN KEY(poll_id) REFERENCES polls(id) ON DELETE CASCADE
+			);`,
+			`INSERT INTO poll_options_new (poll_id, option_index, option_text)
+				SELECT poll_id, option_index, option_text FROM poll_options;`,
+			`DROP TABLE poll_options;`,
+			`ALTER TABLE poll_options_new RENAME TO poll_options;`,
+			`CREATE TABLE bets_new (
+				poll_id TEXT,
+				user_id TEXT,
+				selected_option_index INTEGER,
+				bet_status INTEGER,
+				stake INTEGER NOT NULL DEFAULT 0,
+				payout INTEGER NOT NULL DEFAULT 0,
+				placed_at INTEGER NOT NULL DEFAULT 0,
+				PRIMARY KEY (poll_id, user_id),
+				FOREIGN KEY(poll_id) REFERENCES polls(id) ON DELETE CASCADE,
+				FOREIGN KEY(user_id) REFERENCES users(id) ON DELETE CASCADE
+			);`,
+			`INSERT INTO bets_new (poll_id, user_id, selected_option_index, bet_status, stake, payout, placed_at)
+				SELECT poll_id, user_id, selected_option_index, bet_status, stake, payout, placed_at FROM bets;`,
+			`DROP TABLE bets;`,
+			`ALTER TABLE bets_new RENAME TO bets;`,
+			`CREATE INDEX idx_bets_user_id ON bets(user_id);`,
+			`CREATE TABLE bet_changes_new (
+				id INTEGER PRIMARY KEY AUTOINCREMENT,
+				poll_id TEXT,
+				user_id TEXT,
+				kind TEXT,
+				previous_option_index INTEGER,
+				new_option_index INTEGER,
+				changed_at INTEGER,
+				FOREIGN KEY(poll_id) REFERENCES polls(id) ON DELETE CASCADE,
+				FOREIGN KEY(user_id) REFERENCES users(id) ON DELETE CASCADE
+			);`,
+			`INSERT INTO bet_changes_new (id, poll_id, user_id, kind, previous_option_index, new_option_index, changed_at)
+				SELECT id, poll_id, user_id, kind, previous_option_index, new_option_index, changed_at FROM bet_changes;`,
+			`DROP TABLE bet_changes;`,
+			`ALTER TABLE bet_changes_new RENAME TO bet_changes;`,
+			`CREATE INDEX idx_bet_changes_poll_id ON bet_changes(poll_id, user_id);`,
+			`CREATE INDEX idx_bet_changes_user_id ON bet_changes(user_id);`,
+			`CREATE TABLE outcome_corrections_new (
+				id INTEGER PRIMARY KEY AUTOINCREMENT,
+				poll_id TEXT,
+				previous_outcome INTEGER,
+				new_outcome INTEGER,
+				corrected_by TEXT,
+				corrected_at INTEGER,
+				FOREIGN KEY(poll_id) REFERENCES polls(id) ON DELETE CASCADE
+			);`,
+			`INSERT INTO outcome_corrections_new (id, poll_id, previous_outcome, new_outcome, corrected_by, corrected_at)
+				SELECT id, poll_id, previous_outcome, new_outcome, corrected_by, corrected_at FROM outcome_corrections;`,
+			`DROP TABLE outcome_corrections;`,
+			`ALTER TABLE outcome_corrections_new RENAME TO outcome_corrections;`,
+			`CREATE INDEX idx_outcome_corrections_poll_id ON outcome_corrections(poll_id);`,
+			`CREATE TABLE poll_messages_new (
+				poll_id TEXT PRIMARY KEY,
+				guild_id TEXT NOT NULL DEFAULT '',
+				channel_id TEXT,
+				message_id TEXT,
+				FOREIGN KEY(poll_id) REFERENCES polls(id) ON DELETE CASCADE
+			);`,
+			`INSERT INTO poll_messages_new (poll_id, guild_id, channel_id, message_id)
+				SELECT poll_id, guild_id, channel_id, message_id FROM poll_messages;`,
+			`DROP TABLE poll_messages;`,
+			`ALTER TABLE poll_messages_new RENAME TO poll_messages;`,
+		},
+	},
+	{
+		Version: 5,
+		Name:    "guild wallets",
+		// A user has a wallet in each guild, so that points granted or
+		// adjusted in one guild cannot be spent in another. Wallets opened
+		// before then keep no guild and the ledger account they had, until
+		// AdoptUnscopedWallets moves them to the guild the bot was pinned to.
+		Statements: []string{
+			`CREATE TABLE wallets_new (
+				guild_id TEXT NOT NULL DEFAULT '',
+				user_id TEXT NOT NULL,
+				balance INTEGER NOT NULL,
+				PRIMARY KEY (guild_id, user_id)
+			);`,
+			`INSERT INTO wallets_new (guild_id, user_id, balance)
+				SELECT '', user_id, balance FROM wallets;`,
+			`DROP TABLE wallets;`,
+			`ALTER TABLE wallets_new RENAME TO wallets;`,
+			`ALTER TABLE ledger_entries ADD COLUMN guild_id TEXT NOT NULL DEFAULT '';`,
+		},
+	},
+	{
+		Version: 6,
+		Name:    "data export indexes",
+		Statements: []string{
+			`CREATE INDEX idx_wallets_user_id ON wallets(user_id);`,
+			`CREATE INDEX idx_polls_creator_id ON polls(creator_id);`,
+			`CREATE INDEX idx_outcome_corrections_corrected_by ON outcome_corrections(corrected_by);`,
+		},
+	},
+}
+
+// legacyColumns were added to tables after they were first created, back when
+// the schema was created with CREATE TABLE IF NOT EXISTS alone. Databases from
+// that time may lack them, so the baseline adds any that are missing.
+var legacyColumns = []column{
+	{table: "polls", name: "closes_at", definition: "INTEGER"},
+	{table: "polls", name: "category", definition: "TEXT NOT NULL DEFAULT ''"},
+	{table: "polls", name: "created_at", definition: "INTEGER"},
+	{table: "polls", name: "closed_at", definition: "INTEGER"},
+	{table: "polls", name: "guild_id", definition: "TEXT NOT NULL DEFAULT ''"},
+	{table: "polls", name: "creator_id", definition: "TEXT NOT NULL DEFAULT ''"},
+	{table: "bets", name: "stake", definition: "INTEGER NOT NULL DEFAULT 0"},
+	{table: "bets", name: "payout", definition: "INTEGER NOT NULL DEFAULT 0"},
+	{table: "bets", name: "placed_at", definition: "INTEGER NOT NULL DEFAULT 0"},
+	{table: "poll_messages", name: "guild_id", definition: "TEXT NOT NULL DEFAULT ''"},
+}
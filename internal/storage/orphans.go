@@ -0,0 +1,320 @@
+package storage
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+)
+
+// Reference is a column whose rows belong to a row of another table, and are
+// deleted along with it.
+type Reference struct {
+	Table  string
+	Column string
+	Parent string
+}
+
+// references are the foreign keys of the schema. Databases created before the
+// foreign keys existed may have rows whose parent is already gone.
+var references = []Reference{
+	{Table: "user_identities", Column: "user_id", Parent: "users"},
+	{Table: "poll_options", Column: "poll_id", Parent: "polls"},
+	{Table: "bets", Column: "poll_id", Parent: "polls"},
+	{Table: "bets", Column: "user_id", Parent: "users"},
+	{Table: "bet_changes", Column: "poll_id", Parent: "polls"},
+	{Table: "bet_changes", Column: "user_id", Parent: "users"},
+	{Table: "outcome_corrections", Column: "poll_id", Parent: "polls"},
+	{Table: "poll_messages", Column: "poll_id", Parent: "polls"},
+}
+
+var ErrOrphanedRows = errors.New("rows belong to polls or users that no longer exist")
+var ErrUnrefundableStakes = errors.New("orphaned bets hold stakes that cannot be refunded")
+
+// Orphans counts the rows of a table whose parent row does not exist.
+type Orphans struct {
+	Reference
+	Count int
+}
+
+// queryer is a database or a transaction.
+type queryer interface {
+	QueryRow(query string, args ...any) *sql.Row
+}
+
+func hasTable(db queryer, table string) (bool, error) {
+	var count int
+	if err := db.QueryRow("SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = ?", table).Scan(&count); err != nil {
+		return false, fmt.Errorf("error while looking for table %s: %w", table, err)
+	}
+	return count > 0, nil
+}
+
+// orphanCondition selects the orphaned rows of the reference. Databases from
+// before the migrations may be missing tables: there are no orphans in a
+// table that does not exist, and every row is an orphan when its parent table
+// does not exist. ok is false when the table does not exist.
+func (reference Reference) orphanCondition(db queryer) (condition string, ok bool, err error) {
+	exists, err := hasTable(db, reference.Table)
+	if err != nil || !exists {
+		return "", false, err
+	}
+	parentExists, err := hasTable(db, reference.Parent)
+	if err != nil {
+		return "", false, err
+	}
+	if !parentExists {
+		return "1", true, nil
+	}
+	return fmt.Sprintf("NOT EXISTS (SELECT 1 FROM %s WHERE %s.id = %s.%s)", reference.Parent, reference.Parent, reference.Table, reference.Column), true, nil
+}
+
+// FindOrphans counts the orphaned rows of every reference whose table exists,
+// whether or not there are any. It does not change the database.
+func FindOrphans(db *sql.DB) ([]Orphans, error) {
+	return findOrphans(db)
+}
+
+func findOrphans(db queryer) ([]Orphans, error) {
+	orphans := make([]Orphans, 0, len(references))
+	for _, reference := range references {
+		condition, ok, err := reference.orphanCondition(db)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			continue
+		}
+
+		query := fmt.Sprintf("SELECT COUNT(*) FROM %s WHERE %s", reference.Table, condition)
+		var count int
+		if err := db.QueryRow(query).Scan(&count); err != nil {
+			return nil, fmt.Errorf("error while counting orphans of %s.%s: %w", reference.Table, reference.Column, err)
+		}
+		orphans = append(orphans, Orphans{Reference: reference, Count: count})
+	}
+	return orphans, nil
+}
+
+// refuseOrphans fails with ErrOrphanedRows if there are any orphaned rows, so
+// that a migration that would drop them is not applied until they have been
+// looked at.
+func refuseOrphans(transaction *sql.Tx) error {
+	orphans, err := findOrphans(transaction)
+	if err != nil {
+		return err
+	}
+
+	total := 0
+	for _, orphan := range orphans {
+		total += orphan.Count
+	}
+	if total > 0 {
+		return fmt.Errorf("%w: found %d orphaned rows, list them with `repair check` and delete them with `repair fix`", ErrOrphanedRows, total)
+	}
+	return nil
+}
+
+// RemoveOrphans deletes every orphaned row in a single transaction, and
+// returns how many it deleted of each reference whose table exists.
+func RemoveOrphans(db *sql.DB) ([]Orphans, error) {
+	transaction, err := db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("error while starting transaction: %w", err)
+	}
+	defer transaction.Rollback()
+
+	if err := refundOrphanedStakes(transaction); err != nil {
+		return nil, err
+	}
+
+	removed := make([]Orphans, 0, len(references))
+	for _, reference := range references {
+		condition, ok, err := reference.orphanCondition(transaction)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			continue
+		}
+
+		result, err := transaction.Exec(fmt.Sprintf("DELETE FROM %s WHERE %s", reference.Table, condition))
+		if err != nil {
+			return nil, fmt.Errorf("error while deleting orphans of %s.%s: %w", reference.Table, reference.Column, err)
+		}
+		count, err := result.RowsAffected()
+		if err != nil {
+			return nil, fmt.Errorf("error while counting deleted orphans of %s.%s: %w", reference.Table, reference.Column, err)
+		}
+		removed = append(removed, Orphans{Reference: reference, Count: int(count)})
+	}
+
+	if err := transaction.Commit(); err != nil {
+		return nil, fmt.Errorf("error while committing transaction: %w", err)
+	}
+
+	return removed, nil
+}
+
+// stakedOrphan is an orphaned bet whose stake is still held in its poll's
+// ledger account.
+type stakedOrphan struct {
+	pollID string
+	userID string
+	held   int64
+}
+
+// refundOrphanedStakes gives the stakes still held for orphaned bets back to
+// their users, with a refund in the ledger, so that deleting the bets does not
+// strand the points in the poll's account. Stakes that cannot be traced back to
+// a ledger entry and a wallet fail with ErrUnrefundableStakes, listing the bets
+// so that they can be settled by hand.
+func refundOrphanedStakes(transaction *sql.Tx) error {
+	staked, err := findStakedOrphans(transaction)
+	if err != nil || len(staked) == 0 {
+		return err
+	}
+
+	ledgerExists, err := hasTable(transaction, "ledger_entries")
+	if err != nil {
+		return err
+	}
+	scopedWallets, err := columnExists(transaction, "wallets", "guild_id")
+	if err != nil {
+		return err
+	}
+	scopedLedger, err := columnExists(transaction, "ledger_entries", "guild_id")
+	if err != nil {
+		return err
+	}
+
+	var unrefundable []string
+	for _, orphan := range staked {
+		refunded := false
+		if ledgerExists {
+			refunded, err = refundStake(transaction, orphan, scopedWallets, scopedLedger)
+			if err != nil {
+				return err
+			}
+		}
+		if !refunded {
+			unrefundable = append(unrefundable, fmt.Sprintf("%d points of user %s on poll %s", orphan.held, orphan.userID, orphan.pollID))
+		}
+	}
+
+	if len(unrefundable) > 0 {
+		return fmt.Errorf("%w, refund them by hand and delete the bets: %s", ErrUnrefundableStakes, strings.Join(unrefundable, "; "))
+	}
+	return nil
+}
+
+// findStakedOrphans lists the orphaned bets that are neither won nor lost and
+// have not been paid back their whole stake.
+func findStakedOrphans(transaction *sql.Tx) ([]stakedOrphan, error) {
+	var conditions []string
+	for _, reference := range references {
+		if reference.Table != "bets" {
+			continue
+		}
+		condition, ok, err := reference.orphanCondition(transaction)
+		if err != nil || !ok {
+			return nil, err
+		}
+		conditions = append(conditions, condition)
+	}
+	staked, err := columnExists(transaction, "bets", "stake")
+	if err != nil || !staked {
+		return nil, err
+	}
+
+	// 0 is a pending bet and 3 a void one, whose stake may not have been
+	// refunded yet. Won and lost bets were settled against the other bets.
+	query := fmt.Sprintf(`SELECT poll_id, user_id, stake - payout FROM bets
+		WHERE bet_status IN (0, 3) AND stake > payout AND (%s)`, strings.Join(conditions, " OR "))
+	rows, err := transaction.Query(query)
+	if err != nil {
+		return nil, fmt.Errorf("error while finding staked orphans: %w", err)
+	}
+	defer rows.Close()
+
+	var orphans []stakedOrphan
+	for rows.Next() {
+		var orphan stakedOrphan
+		if err := rows.Scan(&orphan.pollID, &orphan.userID, &orphan.held); err != nil {
+			return nil, fmt.Errorf("error while scanning staked orphan: %w", err)
+		}
+		orphans = append(orphans, orphan)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error during row iteration: %w", err)
+	}
+	return orphans, nil
+}
+
+// refundStake moves the held stake from the poll's account back to the account
+// it was staked from, and reports false if there is no such account or wallet.
+func refundStake(transaction *sql.Tx, orphan stakedOrphan, scopedWallets, scopedLedger bool) (bool, error) {
+	var account string
+	err := transaction.QueryRow(`SELECT account FROM ledger_entries
+		WHERE poll_id = ? AND user_id = ? AND kind = 'STAKE' AND account LIKE 'user:%'
+		ORDER BY id DESC LIMIT 1`, orphan.pollID, orphan.userID).Scan(&account)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("error while finding the stake of user %s on poll %s: %w", orphan.userID, orphan.pollID, err)
+	}
+
+	// Accounts are "user:<user>", or "user:<guild>:<user>" once wallets were
+	// scoped to a guild.
+	guildID, userID, scoped := strings.Cut(strings.TrimPrefix(account, "user:"), ":")
+	if !scoped {
+		guildID, userID = "", guildID
+	}
+	if userID != orphan.userID || (guildID != "" && !scopedWallets) {
+		return false, nil
+	}
+
+	credit := "UPDATE wallets SET balance = balance + ? WHERE user_id = ?"
+	args := []any{orphan.held, userID}
+	if scopedWallets {
+		credit += " AND guild_id = ?"
+		args = append(args, guildID)
+	}
+	result, err := transaction.Exec(credit, args...)
+	if err != nil {
+		return false, fmt.Errorf("error while refunding user %s: %w", userID, err)
+	}
+	if credited, _ := result.RowsAffected(); credited == 0 {
+		return false, nil
+	}
+
+	transactionID := "orphan:" + orphan.pollID + ":" + orphan.userID
+	memo := "bet deleted by repair"
+	createdAt := time.Now().UnixMilli()
+	entries := []struct {
+		account string
+		amount  int64
+	}{
+		{account, orphan.held},
+		{"poll:" + orphan.pollID, -orphan.held},
+	}
+	for _, entry := range entries {
+		insert := `INSERT INTO ledger_entries (transaction_id, account, user_id, poll_id, kind, amount, memo, created_at)
+			VALUES (?, ?, ?, ?, 'REFUND', ?, ?, ?)`
+		args := []any{transactionID, entry.account, orphan.userID, orphan.pollID, entry.amount, memo, createdAt}
+		if scopedLedger {
+			insert = `INSERT INTO ledger_entries (transaction_id, account, user_id, poll_id, kind, amount, memo, created_at, guild_id)
+				VALUES (?, ?, ?, ?, 'REFUND', ?, ?, ?, ?)`
+			args = append(args, guildID)
+		}
+		if _, err := transaction.Exec(insert, args...); err != nil {
+			return false, fmt.Errorf("error while recording the refund of user %s on poll %s: %w", orphan.userID, orphan.pollID, err)
+		}
+	}
+
+	log.Printf("Refunded %d points of the orphaned bet of user %s on poll %s", orphan.held, orphan.userID, orphan.pollID)
+	return true, nil
+}
@@ -0,0 +1,339 @@
+package storage
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// orphanedRows are rows of every table belonging to a poll or a user, where
+// only the poll "poll" and the user "user" exist.
+var orphanedRows = []string{
+	`INSERT INTO polls (id, title) VALUES ('poll', 'Kept poll');`,
+	`INSERT INTO users (id) VALUES ('user');`,
+	`INSERT INTO user_identities (provider, external_id, external_id_hash, user_id) VALUES ('discord', 'kept', 'kept', 'user'), ('discord', 'gone', 'gone', 'gone');`,
+	`INSERT INTO poll_options (poll_id, option_index, option_text) VALUES ('poll', 0, 'A'), ('gone', 0, 'A');`,
+	`INSERT INTO bets (poll_id, user_id, selected_option_index, bet_status) VALUES ('poll', 'user', 0, 0), ('gone', 'user', 0, 0), ('poll', 'gone', 0, 0);`,
+	`INSERT INTO bet_changes (poll_id, user_id, kind) VALUES ('poll', 'user', 'placed'), ('gone', 'user', 'placed'), ('poll', 'gone', 'placed');`,
+	`INSERT INTO outcome_corrections (poll_id, previous_outcome, new_outcome) VALUES ('poll', 0, 1), ('gone', 0, 1);`,
+	`INSERT INTO poll_messages (poll_id, channel_id, message_id) VALUES ('poll', 'channel', 'kept'), ('gone', 'channel', 'gone');`,
+}
+
+// insertOrphans inserts orphanedRows with foreign keys off, the way databases
+// from before the foreign keys existed came to have orphans.
+func insertOrphans(t *testing.T, db *sql.DB) {
+	t.Helper()
+	insertWithoutForeignKeys(t, db, orphanedRows...)
+}
+
+func insertWithoutForeignKeys(t *testing.T, db *sql.DB, statements ...string) {
+	t.Helper()
+
+	conn, err := db.Conn(t.Context())
+	if err != nil {
+		t.Fatalf("Failed to get a connection: %v", err)
+	}
+	defer conn.Close()
+
+	if _, err := conn.ExecContext(t.Context(), "PRAGMA foreign_keys = OFF"); err != nil {
+		t.Fatalf("Failed to turn foreign keys off: %v", err)
+	}
+	for _, statement := range statements {
+		if _, err := conn.ExecContext(t.Context(), statement); err != nil {
+			t.Fatalf("Failed to insert orphans: %v", err)
+		}
+	}
+	if _, err := conn.ExecContext(t.Context(), "PRAGMA foreign_keys = ON"); err != nil {
+		t.Fatalf("Failed to turn foreign keys back on: %v", err)
+	}
+}
+
+func countRows(t *testing.T, db *sql.DB, table string) int {
+	t.Helper()
+	var count int
+	if err := db.QueryRow(fmt.Sprintf("SELECT COUNT(*) FROM %s", table)).Scan(&count); err != nil {
+		t.Fatalf("Failed to count the rows of %s: %v", table, err)
+	}
+	return count
+}
+
+// assertOnlyValidRowsLeft checks that the one valid row of each table in
+// orphanedRows is left.
+func assertOnlyValidRowsLeft(t *testing.T, db *sql.DB) {
+	t.Helper()
+	for _, table := range []string{"user_identities", "poll_options", "bets", "bet_changes", "outcome_corrections", "poll_messages"} {
+		if count := countRows(t, db, table); count != 1 {
+			t.Errorf("Expected only the valid row of %s to be left, but got %d rows", table, count)
+		}
+	}
+}
+
+func TestForeignKeysAreEnforced(t *testing.T) {
+	t.Parallel()
+	db := openTestDatabase(t)
+
+	var enabled int
+	if err := db.QueryRow("PRAGMA foreign_keys").Scan(&enabled); err != nil {
+		t.Fatal("Failed to read the foreign_keys pragma:", err)
+	}
+	if enabled != 1 {
+		t.Errorf("Expected foreign keys to be enforced, but foreign_keys is %d", enabled)
+	}
+}
+
+func TestReferencesMatchSchema(t *testing.T) {
+	t.Parallel()
+	db := openTestDatabase(t)
+	if _, err := Migrate(db); err != nil {
+		t.Fatal("Migrate returned an unexpected error:", err)
+	}
+
+	rows, err := db.Query(`SELECT m.name, f."from", f."table", f.on_delete
+		FROM sqlite_master m, pragma_foreign_key_list(m.name) f
+		WHERE m.type = 'table'`)
+	if err != nil {
+		t.Fatal("Failed to list foreign keys:", err)
+	}
+	defer rows.Close()
+
+	foreignKeys := map[Reference]bool{}
+	for rows.Next() {
+		var reference Reference
+		var onDelete string
+		if err := rows.Scan(&reference.Table, &reference.Column, &reference.Parent, &onDelete); err != nil {
+			t.Fatal("Failed to read foreign key:", err)
+		}
+		if onDelete != "CASCADE" {
+			t.Errorf("Expected %s.%s to cascade deletes, but it is %s", reference.Table, reference.Column, onDelete)
+		}
+		foreignKeys[reference] = true
+	}
+	if err := rows.Err(); err != nil {
+		t.Fatal("Failed to list foreign keys:", err)
+	}
+
+	if len(foreignKeys) != len(references) {
+		t.Errorf("Expected %d foreign keys, but the schema has %d", len(references), len(foreignKeys))
+	}
+	for _, reference := range references {
+		if !foreignKeys[reference] {
+			t.Errorf("Expected %s.%s to reference %s in the schema", reference.Table, reference.Column, reference.Parent)
+		}
+	}
+}
+
+func TestDeletingParentsCascades(t *testing.T) {
+	t.Parallel()
+	db := openTestDatabase(t)
+	if _, err := Migrate(db); err != nil {
+		t.Fatal("Migrate returned an unexpected error:", err)
+	}
+
+	for _, statement := range orphanedRows[:2] {
+		if _, err := db.Exec(statement); err != nil {
+			t.Fatalf("Failed to insert parents: %v", err)
+		}
+	}
+	if _, err := db.Exec(`INSERT INTO bets (poll_id, user_id, selected_option_index, bet_status) VALUES ('gone', 'user', 0, 0)`); err == nil {
+		t.Error("Expected a bet on a poll that does not exist to be refused")
+	}
+	if _, err := db.Exec(`INSERT INTO bets (poll_id, user_id, selected_option_index, bet_status) VALUES ('poll', 'user', 0, 0)`); err != nil {
+		t.Fatal("Failed to insert bet:", err)
+	}
+
+	if _, err := db.Exec(`DELETE FROM users WHERE id = 'user'`); err != nil {
+		t.Fatal("Failed to delete user:", err)
+	}
+	if count := countRows(t, db, "bets"); count != 0 {
+		t.Errorf("Expected the bets of the deleted user to be deleted, but got %d", count)
+	}
+}
+
+func TestRemoveOrphans(t *testing.T) {
+	t.Parallel()
+	db := openTestDatabase(t)
+	if _, err := Migrate(db); err != nil {
+		t.Fatal("Migrate returned an unexpected error:", err)
+	}
+	insertOrphans(t, db)
+
+	found, err := FindOrphans(db)
+	if err != nil {
+		t.Fatal("FindOrphans returned an unexpected error:", err)
+	}
+	if len(found) != len(references) {
+		t.Fatalf("Expected a count for each of the %d references, but got %d", len(references), len(found))
+	}
+	for _, orphans := range found {
+		if orphans.Count != 1 {
+			t.Errorf("Expected 1 orphan in %s.%s, but found %d", orphans.Table, orphans.Column, orphans.Count)
+		}
+	}
+
+	removed, err := RemoveOrphans(db)
+	if err != nil {
+		t.Fatal("RemoveOrphans returned an unexpected error:", err)
+	}
+	for _, orphans := range removed {
+		if orphans.Count != 1 {
+			t.Errorf("Expected 1 orphan removed from %s.%s, but got %d", orphans.Table, orphans.Column, orphans.Count)
+		}
+	}
+	assertOnlyValidRowsLeft(t, db)
+
+	found, err = FindOrphans(db)
+	if err != nil {
+		t.Fatal("FindOrphans returned an unexpected error:", err)
+	}
+	for _, orphans := range found {
+		if orphans.Count != 0 {
+			t.Errorf("Expected no orphans left in %s.%s, but found %d", orphans.Table, orphans.Column, orphans.Count)
+		}
+	}
+}
+
+// migrateBeforeForeignKeys creates the schema as it was before the foreign
+// keys, when databases could come to have orphans.
+func migrateBeforeForeignKeys(t *testing.T, db *sql.DB) {
+	t.Helper()
+	if _, err := db.Exec(createMigrationsTable); err != nil {
+		t.Fatal("Failed to create schema_migrations:", err)
+	}
+	for _, migration := range migrations[:3] {
+		if err := applyMigration(db, migration); err != nil {
+			t.Fatalf("Failed to apply migration %d: %v", migration.Version, err)
+		}
+	}
+}
+
+func TestRemoveOrphansRefundsStakes(t *testing.T) {
+	t.Parallel()
+	db := openTestDatabase(t)
+	migrateBeforeForeignKeys(t, db)
+	insertWithoutForeignKeys(t, db,
+		`INSERT INTO wallets (user_id, balance) VALUES ('user', 940);`,
+		`INSERT INTO ledger_entries (transaction_id, account, user_id, poll_id, kind, amount, created_at) VALUES
+			('grant', 'user:user', 'user', '', 'GRANT', 1000, 0), ('grant', 'house', 'user', '', 'GRANT', -1000, 0),
+			('stake', 'user:user', 'user', 'gone', 'STAKE', -50, 0), ('stake', 'poll:gone', 'user', 'gone', 'STAKE', 50, 0),
+			('lost', 'user:user', 'user', 'lost', 'STAKE', -10, 0), ('lost', 'poll:lost', 'user', 'lost', 'STAKE', 10, 0);`,
+		`INSERT INTO bets (poll_id, user_id, selected_option_index, bet_status, stake) VALUES ('gone', 'user', 0, 0, 50), ('lost', 'user', 0, 2, 10);`,
+	)
+
+	if _, err := RemoveOrphans(db); err != nil {
+		t.Fatal("RemoveOrphans returned an unexpected error:", err)
+	}
+	if count := countRows(t, db, "bets"); count != 0 {
+		t.Errorf("Expected the orphaned bets to be deleted, but %d are left", count)
+	}
+
+	var balance int64
+	if err := db.QueryRow("SELECT balance FROM wallets WHERE user_id = 'user'").Scan(&balance); err != nil {
+		t.Fatal("Failed to read the wallet:", err)
+	}
+	if balance != 990 {
+		t.Errorf("Expected the pending stake of 50 to be refunded to a balance of 990, but got %d", balance)
+	}
+
+	var held, userBalance int64
+	if err := db.QueryRow("SELECT COALESCE(SUM(amount), 0) FROM ledger_entries WHERE account = 'poll:gone'").Scan(&held); err != nil {
+		t.Fatal("Failed to read the poll's account:", err)
+	}
+	if held != 0 {
+		t.Errorf("Expected the poll's account to be emptied, but it holds %d", held)
+	}
+	if err := db.QueryRow("SELECT SUM(amount) FROM ledger_entries WHERE account = 'user:user'").Scan(&userBalance); err != nil {
+		t.Fatal("Failed to read the user's account:", err)
+	}
+	if userBalance != balance {
+		t.Errorf("Expected the ledger to agree with the wallet balance of %d, but got %d", balance, userBalance)
+	}
+
+	if _, err := Migrate(db); err != nil {
+		t.Fatal("Migrate returned an unexpected error:", err)
+	}
+}
+
+func TestRemoveOrphansRefusesUnrefundableStakes(t *testing.T) {
+	t.Parallel()
+	db := openTestDatabase(t)
+	migrateBeforeForeignKeys(t, db)
+	insertOrphans(t, db)
+	// A stake without a ledger entry cannot be traced back to a wallet.
+	insertWithoutForeignKeys(t, db,
+		`INSERT INTO bets (poll_id, user_id, selected_option_index, bet_status, stake) VALUES ('untraced', 'user', 0, 0, 25);`,
+	)
+
+	_, err := RemoveOrphans(db)
+	if !errors.Is(err, ErrUnrefundableStakes) {
+		t.Fatalf("Expected RemoveOrphans to be refused with %v, but got %v", ErrUnrefundableStakes, err)
+	}
+	if !strings.Contains(err.Error(), "25 points of user user on poll untraced") {
+		t.Errorf("Expected the error to list the unrefundable stake, but got %q", err)
+	}
+	if count := countRows(t, db, "bets"); count != 4 {
+		t.Errorf("Expected the refused repair to leave every bet, but got %d", count)
+	}
+	if count := countRows(t, db, "poll_options"); count != 2 {
+		t.Errorf("Expected the refused repair to leave every poll option, but got %d", count)
+	}
+}
+
+func TestForeignKeyMigrationRefusesOrphans(t *testing.T) {
+	t.Parallel()
+	db := openTestDatabase(t)
+	migrateBeforeForeignKeys(t, db)
+	insertOrphans(t, db)
+
+	if _, err := Migrate(db); !errors.Is(err, ErrOrphanedRows) {
+		t.Fatalf("Expected the migration to be refused with %v, but got %v", ErrOrphanedRows, err)
+	}
+	if count := countRows(t, db, "bets"); count != 3 {
+		t.Errorf("Expected the refused migration to leave every bet, but got %d", count)
+	}
+
+	if _, err := RemoveOrphans(db); err != nil {
+		t.Fatal("RemoveOrphans returned an unexpected error:", err)
+	}
+	if _, err := Migrate(db); err != nil {
+		t.Fatal("Migrate returned an unexpected error:", err)
+	}
+	assertOnlyValidRowsLeft(t, db)
+}
+
+func TestFindOrphansBeforeMigrations(t *testing.T) {
+	t.Parallel()
+	db := openTestDatabase(t)
+
+	// The schema as it was before users, bet history and poll messages.
+	legacySchema := []string{
+		`CREATE TABLE polls (id TEXT PRIMARY KEY, title TEXT, outcome INTEGER, status INTEGER);`,
+		`CREATE TABLE poll_options (poll_id TEXT, option_index INTEGER, option_text TEXT, PRIMARY KEY (poll_id, option_index));`,
+		`CREATE TABLE bets (poll_id TEXT, user_id TEXT, selected_option_index INTEGER, bet_status INTEGER, PRIMARY KEY (poll_id, user_id));`,
+		`INSERT INTO polls (id, title, outcome, status) VALUES ('poll', 'Old poll', 2, 1);`,
+		`INSERT INTO poll_options (poll_id, option_index, option_text) VALUES ('poll', 0, 'A'), ('gone', 0, 'A');`,
+		`INSERT INTO bets (poll_id, user_id, selected_option_index, bet_status) VALUES ('poll', 'user', 0, 0);`,
+	}
+	for _, statement := range legacySchema {
+		if _, err := db.Exec(statement); err != nil {
+			t.Fatalf("Failed to create legacy schema: %v", err)
+		}
+	}
+
+	found, err := FindOrphans(db)
+	if err != nil {
+		t.Fatal("FindOrphans returned an unexpected error:", err)
+	}
+
+	expected := []Orphans{
+		{Reference: Reference{Table: "poll_options", Column: "poll_id", Parent: "polls"}, Count: 1},
+		{Reference: Reference{Table: "bets", Column: "poll_id", Parent: "polls"}, Count: 0},
+		// There is no users table, so no bet has its user.
+		{Reference: Reference{Table: "bets", Column: "user_id", Parent: "users"}, Count: 1},
+	}
+	if !slices.Equal(found, expected) {
+		t.Errorf("Expected orphans %+v, but got %+v", expected, found)
+	}
+}
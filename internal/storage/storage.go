@@ -1,23 +1,53 @@
 package storage
 
 import (
+	"context"
 	"database/sql"
+	"database/sql/driver"
 	"fmt"
+	"io"
 	"log"
 	"net/url"
+	"time"
 
 	_ "github.com/tursodatabase/go-libsql"
 )
 
+// InitializeDatabase opens the database and applies any pending migrations.
+// It refuses a database that was migrated by a newer binary.
 func InitializeDatabase(dbPath, encryptionKey string) (*sql.DB, error) {
+	db, err := OpenDatabase(dbPath, encryptionKey)
+	if err != nil {
+		return nil, err
+	}
+
+	applied, err := Migrate(db)
+	if err != nil {
+		_ = db.Close()
+		return nil, fmt.Errorf("failed to migrate database: %w", err)
+	}
+	log.Printf("Schema is at version %d, %d migrations applied", LatestSchemaVersion(), len(applied))
+
+	return db, nil
+}
+
+// OpenDatabase opens the database without migrating it.
+func OpenDatabase(dbPath, encryptionKey string) (*sql.DB, error) {
 	dataSourceName := buildDatabaseConnection(dbPath, encryptionKey)
 
 	log.Printf("Attempting sql.Open with DSN: %s", dataSourceName)
 
-	db, err := sql.Open("libsql", dataSourceName)
+	// The libsql driver is only reachable through a database opened with it.
+	libsql, err := sql.Open("libsql", dataSourceName)
 	if err != nil {
 		return nil, fmt.Errorf("failed to open database: %w", err)
 	}
+	connector, err := libsql.Driver().(driver.DriverContext).OpenConnector(dataSourceName)
+	_ = libsql.Close()
+	if err != nil {
+		return nil, fmt.Errorf("failed to open database: %w", err)
+	}
+	db := sql.OpenDB(foreignKeysConnector{connector})
 
 	err = db.Ping()
 	if err != nil {
@@ -25,15 +55,41 @@ func InitializeDatabase(dbPath, encryptionKey string) (*sql.DB, error) {
 	}
 	log.Println("Database ping successful!")
 
-	schemaStatements := buildSchema()
-	for _, statement := range schemaStatements {
-		if _, err := db.Exec(statement); err != nil {
-			return nil, fmt.Errorf("failed to execute schema statement: %w", err)
-		}
+	return db, nil
+}
+
+// foreignKeysConnector turns on foreign keys for every connection it opens.
+// SQLite keeps the setting per connection, and cannot change it inside a
+// transaction, so it is set before the connection joins the pool.
+type foreignKeysConnector struct {
+	driver.Connector
+}
+
+func (connector foreignKeysConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	conn, err := connector.Connector.Connect(ctx)
+	if err != nil {
+		return nil, err
 	}
-	log.Println("Schema created successfully!")
 
-	return db, nil
+	execer, ok := conn.(driver.ExecerContext)
+	if !ok {
+		_ = conn.Close()
+		return nil, fmt.Errorf("connection cannot execute statements")
+	}
+	if _, err := execer.ExecContext(ctx, "PRAGMA foreign_keys = ON", nil); err != nil {
+		_ = conn.Close()
+		return nil, fmt.Errorf("failed to turn on foreign keys: %w", err)
+	}
+
+	return conn, nil
+}
+
+// Close releases the database the connections were opened on.
+func (connector foreignKeysConnector) Close() error {
+	if closer, ok := connector.Connector.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
 }
 
 func buildDatabaseConnection(dbPath string, encryptionKey string) string {
@@ -53,40 +109,67 @@ func buildDatabaseConnection(dbPath string, encryptionKey string) string {
 	return dataSourceName
 }
 
-func buildSchema() []string {
-	return []string{
-		`CREATE TABLE IF NOT EXISTS polls (
-			id TEXT PRIMARY KEY,
-			title TEXT,
-			outcome INTEGER,
-			status INTEGER
-		);`,
-		`CREATE TABLE IF NOT EXISTS poll_options (
-            poll_id TEXT,
-            option_index INTEGER,
-            option_text TEXT,
-            PRIMARY KEY (poll_id, option_index)
-        );`,
-		`CREATE TABLE IF NOT EXISTS bets (
-			poll_id TEXT,
-			user_id TEXT,
-			selected_option_index INTEGER,
-			bet_status INTEGER,
-			PRIMARY KEY (poll_id, user_id)
-		);`,
-		`CREATE TABLE IF NOT EXISTS users (
-			id TEXT PRIMARY KEY,
-			username TEXT,
-			display_name TEXT
-		);`,
-		`CREATE TABLE IF NOT EXISTS user_identities (
-			provider TEXT,
-			external_id TEXT,
-			external_id_hash TEXT,
-			user_id TEXT,
-			PRIMARY KEY (provider, external_id_hash),
-			FOREIGN KEY(user_id) REFERENCES users(id) ON DELETE CASCADE
-		);`,
-		`CREATE INDEX IF NOT EXISTS idx_identities_hash ON user_identities(provider, external_id_hash);`,
+// AdoptUnscopedPolls assigns polls created before polls were scoped to a guild,
+// and their poll messages, to the guild the bot used to be pinned to. Both are
+// assigned in one transaction, so a poll never ends up in a different guild
+// than its message.
+func AdoptUnscopedPolls(ctx context.Context, db *sql.DB, guildID string) error {
+	var adopted int64
+	err := InTransaction(ctx, db, func(transaction DBTX) error {
+		result, err := transaction.ExecContext(ctx, "UPDATE polls SET guild_id = ? WHERE guild_id = ''", guildID)
+		if err != nil {
+			return fmt.Errorf("failed to assign polls to guild %s: %w", guildID, err)
+		}
+		if _, err := transaction.ExecContext(ctx, "UPDATE poll_messages SET guild_id = ? WHERE guild_id = ''", guildID); err != nil {
+			return fmt.Errorf("failed to assign poll messages to guild %s: %w", guildID, err)
+		}
+
+		adopted, _ = result.RowsAffected()
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	if adopted > 0 {
+		log.Printf("Assigned %d polls to guild %s", adopted, guildID)
 	}
+	return nil
+}
+
+// AdoptUnscopedWallets moves the wallets opened before wallets were scoped to
+// a guild into the guild the bot used to be pinned to. The ledger is
+// append-only, so each balance is moved with a transfer between the user's old
+// and new accounts rather than by rewriting the entries behind it.
+func AdoptUnscopedWallets(ctx context.Context, db *sql.DB, guildID string) error {
+	return InTransaction(ctx, db, func(transaction DBTX) error {
+		memo := "moved to guild " + guildID
+		createdAt := time.Now().UnixMilli()
+
+		transfers := `INSERT INTO ledger_entries (transaction_id, account, guild_id, user_id, kind, amount, memo, created_at)
+			SELECT 'adopt:' || user_id, 'user:' || user_id, '', user_id, 'TRANSFER', -balance, ?1, ?2
+			FROM wallets WHERE guild_id = '' AND balance != 0
+			UNION ALL
+			SELECT 'adopt:' || user_id, 'user:' || ?3 || ':' || user_id, ?3, user_id, 'TRANSFER', balance, ?1, ?2
+			FROM wallets WHERE guild_id = '' AND balance != 0`
+		if _, err := transaction.ExecContext(ctx, transfers, memo, createdAt, guildID); err != nil {
+			return fmt.Errorf("failed to record wallet transfers to guild %s: %w", guildID, err)
+		}
+
+		moved := `INSERT INTO wallets (guild_id, user_id, balance)
+			SELECT ?, user_id, balance FROM wallets WHERE guild_id = ''
+			ON CONFLICT (guild_id, user_id) DO UPDATE SET balance = balance + excluded.balance`
+		if _, err := transaction.ExecContext(ctx, moved, guildID); err != nil {
+			return fmt.Errorf("failed to move wallets to guild %s: %w", guildID, err)
+		}
+
+		result, err := transaction.ExecContext(ctx, "DELETE FROM wallets WHERE guild_id = ''")
+		if err != nil {
+			return fmt.Errorf("failed to remove unscoped wallets: %w", err)
+		}
+		if adopted, _ := result.RowsAffected(); adopted > 0 {
+			log.Printf("Moved %d wallets to guild %s", adopted, guildID)
+		}
+		return nil
+	})
 }
@@ -0,0 +1,157 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sync"
+)
+
+// DBTX runs queries. Both *sql.DB and *sql.Tx satisfy it, so a LibSQL
+// repository runs the same queries on its own or as part of a unit of work.
+type DBTX interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+	PrepareContext(ctx context.Context, query string) (*sql.Stmt, error)
+}
+
+// UnitOfWork makes changes across several repositories atomic.
+type UnitOfWork interface {
+	// Do calls fn with a new transaction and commits it if fn returns nil. If
+	// fn fails or panics, everything written through the transaction is
+	// rolled back. The database transaction is rolled back as well if ctx is
+	// cancelled before it is committed.
+	Do(ctx context.Context, fn func(tx *Tx) error) error
+}
+
+// Tx is a unit of work in progress. Repositories join it with their WithTx
+// method, so that what they write is committed or rolled back together.
+type Tx struct {
+	sqlTx     *sql.Tx
+	rollbacks []func()
+}
+
+// Conn returns what a LibSQL repository joining the transaction should run its
+// queries on: the database transaction, or db if the unit of work is not
+// backed by a database.
+func (tx *Tx) Conn(db DBTX) DBTX {
+	if tx.sqlTx == nil {
+		return db
+	}
+	return tx.sqlTx
+}
+
+// OnRollback registers fn to undo an in-memory change if the unit of work is
+// rolled back. The newest changes are undone first.
+func (tx *Tx) OnRollback(fn func()) {
+	tx.rollbacks = append(tx.rollbacks, fn)
+}
+
+// Do calls fn with the transaction itself, so that a service joined to the
+// transaction runs its own units of work as part of it.
+func (tx *Tx) Do(ctx context.Context, fn func(tx *Tx) error) error {
+	return fn(tx)
+}
+
+func (tx *Tx) rollback() {
+	for index := len(tx.rollbacks) - 1; index >= 0; index-- {
+		tx.rollbacks[index]()
+	}
+	tx.rollbacks = nil
+}
+
+type libSQLUnitOfWork struct {
+	db *sql.DB
+}
+
+func NewLibSQLUnitOfWork(db *sql.DB) UnitOfWork {
+	return &libSQLUnitOfWork{db: db}
+}
+
+func (unitOfWork *libSQLUnitOfWork) Do(ctx context.Context, fn func(tx *Tx) error) (err error) {
+	transaction, err := unitOfWork.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("error while starting transaction: %w", err)
+	}
+
+	tx := &Tx{sqlTx: transaction}
+	committed := false
+	defer func() {
+		if !committed {
+			_ = transaction.Rollback()
+			tx.rollback()
+		}
+	}()
+
+	if err := fn(tx); err != nil {
+		return err
+	}
+
+	if err := transaction.Commit(); err != nil {
+		return fmt.Errorf("error while committing transaction: %w", err)
+	}
+	committed = true
+
+	return nil
+}
+
+// memoryUnitOfWork runs one unit of work at a time, and rolls back by undoing
+// the changes the memory repositories registered with the transaction.
+type memoryUnitOfWork struct {
+	mu sync.Mutex
+}
+
+func NewMemoryUnitOfWork() UnitOfWork {
+	return &memoryUnitOfWork{}
+}
+
+func (unitOfWork *memoryUnitOfWork) Do(ctx context.Context, fn func(tx *Tx) error) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	unitOfWork.mu.Lock()
+	defer unitOfWork.mu.Unlock()
+
+	tx := &Tx{}
+	committed := false
+	defer func() {
+		if !committed {
+			tx.rollback()
+		}
+	}()
+
+	if err := fn(tx); err != nil {
+		return err
+	}
+	committed = true
+
+	return nil
+}
+
+// InTransaction runs fn in a transaction on db. If db is already a
+// transaction, fn joins it and the unit of work it belongs to decides whether
+// it is committed.
+func InTransaction(ctx context.Context, db DBTX, fn func(tx DBTX) error) error {
+	sqlDB, ok := db.(*sql.DB)
+	if !ok {
+		return fn(db)
+	}
+
+	transaction, err := sqlDB.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("error while starting transaction: %w", err)
+	}
+	defer transaction.Rollback()
+
+	if err := fn(transaction); err != nil {
+		return err
+	}
+
+	if err := transaction.Commit(); err != nil {
+		return fmt.Errorf("error while committing transaction: %w", err)
+	}
+
+	return nil
+}
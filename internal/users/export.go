@@ -0,0 +1,245 @@
+package users
+
+import (
+	"time"
+
+	"betting-discord-bot/internal/bets"
+	"betting-discord-bot/internal/polls"
+	"betting-discord-bot/internal/wallet"
+)
+
+// DataExportVersion is the version of the DataExport format. It goes up
+// whenever a field is removed or changes meaning, so that whoever reads an
+// export can tell which format it is in.
+const DataExportVersion = 1
+
+// DataExport is everything kept about a user, in the shape it is handed to
+// them as JSON.
+type DataExport struct {
+	Version    int                `json:"version"`
+	ExportedAt time.Time          `json:"exported_at"`
+	User       ExportedUser       `json:"user"`
+	Identities []ExportedIdentity `json:"identities"`
+	Bets       []ExportedBet      `json:"bets"`
+	// WithdrawnBetChanges are the changes to bets the user withdrew and has
+	// not placed again. Changes to current bets are listed with the bet.
+	WithdrawnBetChanges []ExportedBetChange `json:"withdrawn_bet_changes"`
+	// Polls are the polls the user created.
+	Polls []ExportedPoll `json:"polls"`
+	// OutcomeCorrections are the corrections the user made to the outcome of
+	// any poll.
+	OutcomeCorrections []ExportedOutcomeCorrection `json:"outcome_corrections"`
+	// Wallets and Ledger are left out where balances are not kept.
+	Wallets []ExportedWallet      `json:"wallets,omitempty"`
+	Ledger  []ExportedLedgerEntry `json:"ledger,omitempty"`
+	Stats   ExportedStats         `json:"stats"`
+}
+
+type ExportedUser struct {
+	ID          string `json:"id"`
+	Username    string `json:"username"`
+	DisplayName string `json:"display_name"`
+}
+
+type ExportedIdentity struct {
+	Provider   string `json:"provider"`
+	ExternalID string `json:"external_id"`
+}
+
+type ExportedBet struct {
+	PollID       string              `json:"poll_id"`
+	PollTitle    string              `json:"poll_title"`
+	PollCategory string              `json:"poll_category,omitempty"`
+	OptionIndex  int                 `json:"option_index"`
+	Option       string              `json:"option"`
+	Status       string              `json:"status"`
+	Stake        int64               `json:"stake"`
+	Payout       int64               `json:"payout"`
+	PlacedAt     time.Time           `json:"placed_at"`
+	Changes      []ExportedBetChange `json:"changes"`
+}
+
+type ExportedBetChange struct {
+	PollID              string `json:"poll_id"`
+	Kind                string `json:"kind"`
+	PreviousOptionIndex int    `json:"previous_option_index"`
+	// NewOptionIndex is -1 for a withdrawal.
+	NewOptionIndex int       `json:"new_option_index"`
+	ChangedAt      time.Time `json:"changed_at"`
+}
+
+type ExportedPoll struct {
+	ID       string   `json:"id"`
+	GuildID  string   `json:"guild_id,omitempty"`
+	Title    string   `json:"title"`
+	Category string   `json:"category,omitempty"`
+	Options  []string `json:"options"`
+	Status   string   `json:"status"`
+	// OutcomeIndex is -1 while the poll has no outcome.
+	OutcomeIndex int       `json:"outcome_index"`
+	CreatedAt    time.Time `json:"created_at"`
+	// ClosedAt is the zero time while the poll is open.
+	ClosedAt time.Time `json:"closed_at"`
+}
+
+type ExportedOutcomeCorrection struct {
+	PollID               string    `json:"poll_id"`
+	PreviousOutcomeIndex int       `json:"previous_outcome_index"`
+	NewOutcomeIndex      int       `json:"new_outcome_index"`
+	CorrectedAt          time.Time `json:"corrected_at"`
+}
+
+// ExportedWallet is the user's current balance in a guild.
+type ExportedWallet struct {
+	GuildID string `json:"guild_id,omitempty"`
+	Balance int64  `json:"balance"`
+}
+
+type ExportedLedgerEntry struct {
+	TransactionID string    `json:"transaction_id"`
+	GuildID       string    `json:"guild_id,omitempty"`
+	PollID        string    `json:"poll_id,omitempty"`
+	Kind          string    `json:"kind"`
+	Amount        int64     `json:"amount"`
+	Memo          string    `json:"memo,omitempty"`
+	CreatedAt     time.Time `json:"created_at"`
+}
+
+// ExportedStats are the user's stats across every guild.
+type ExportedStats struct {
+	TotalBets           int                     `json:"total_bets"`
+	Wins                int                     `json:"wins"`
+	Losses              int                     `json:"losses"`
+	Pending             int                     `json:"pending"`
+	Voided              int                     `json:"voided"`
+	Points              int64                   `json:"points"`
+	CurrentStreak       int                     `json:"current_streak"`
+	LongestStreak       int                     `json:"longest_streak"`
+	FavouriteCategories []ExportedCategoryCount `json:"favourite_categories"`
+	Rank                int                     `json:"rank"`
+	RankedUsers         int                     `json:"ranked_users"`
+}
+
+type ExportedCategoryCount struct {
+	Category string `json:"category"`
+	Bets     int    `json:"bets"`
+}
+
+func exportIdentities(identities []Identity) []ExportedIdentity {
+	exported := make([]ExportedIdentity, 0, len(identities))
+	for _, identity := range identities {
+		exported = append(exported, ExportedIdentity{Provider: identity.Provider, ExternalID: identity.ExternalID})
+	}
+	return exported
+}
+
+func exportBet(entry bets.BetHistoryEntry, changes []bets.BetChange) ExportedBet {
+	exported := ExportedBet{
+		PollID:       entry.PollID,
+		PollTitle:    entry.PollTitle,
+		PollCategory: entry.PollCategory,
+		OptionIndex:  entry.OptionIndex,
+		Option:       entry.Option,
+		Status:       entry.BetStatus.String(),
+		Stake:        entry.Stake,
+		Payout:       entry.Payout,
+		PlacedAt:     entry.PlacedAt,
+	}
+	exported.Changes = exportBetChanges(changes)
+	return exported
+}
+
+func exportBetChanges(changes []bets.BetChange) []ExportedBetChange {
+	exported := make([]ExportedBetChange, 0, len(changes))
+	for _, change := range changes {
+		exported = append(exported, ExportedBetChange{
+			PollID:              change.PollID,
+			Kind:                string(change.Kind),
+			PreviousOptionIndex: change.PreviousOptionIndex,
+			NewOptionIndex:      change.NewOptionIndex,
+			ChangedAt:           change.ChangedAt,
+		})
+	}
+	return exported
+}
+
+var pollStatusNames = map[polls.PollStatus]string{
+	polls.Open:      "OPEN",
+	polls.Closed:    "CLOSED",
+	polls.Cancelled: "CANCELLED",
+}
+
+func exportPolls(created []polls.Poll) []ExportedPoll {
+	exported := make([]ExportedPoll, 0, len(created))
+	for _, poll := range created {
+		exported = append(exported, ExportedPoll{
+			ID:           poll.GetID(),
+			GuildID:      poll.GetGuildID(),
+			Title:        poll.GetTitle(),
+			Category:     poll.GetCategory(),
+			Options:      poll.GetOptions(),
+			Status:       pollStatusNames[poll.GetStatus()],
+			OutcomeIndex: int(poll.GetOutcome()),
+			CreatedAt:    poll.GetCreatedAt(),
+			ClosedAt:     poll.GetClosedAt(),
+		})
+	}
+	return exported
+}
+
+func exportOutcomeCorrections(corrections []polls.OutcomeCorrection) []ExportedOutcomeCorrection {
+	exported := make([]ExportedOutcomeCorrection, 0, len(corrections))
+	for _, correction := range corrections {
+		exported = append(exported, ExportedOutcomeCorrection{
+			PollID:               correction.PollID,
+			PreviousOutcomeIndex: int(correction.PreviousOutcome),
+			NewOutcomeIndex:      int(correction.NewOutcome),
+			CorrectedAt:          correction.CorrectedAt,
+		})
+	}
+	return exported
+}
+
+func exportWallets(wallets []wallet.Wallet) []ExportedWallet {
+	exported := make([]ExportedWallet, 0, len(wallets))
+	for _, wallet := range wallets {
+		exported = append(exported, ExportedWallet{GuildID: wallet.GetGuildID(), Balance: wallet.GetBalance()})
+	}
+	return exported
+}
+
+func exportLedger(entries []wallet.LedgerEntry) []ExportedLedgerEntry {
+	exported := make([]ExportedLedgerEntry, 0, len(entries))
+	for _, entry := range entries {
+		exported = append(exported, ExportedLedgerEntry{
+			TransactionID: entry.TransactionID,
+			GuildID:       entry.GuildID,
+			PollID:        entry.PollID,
+			Kind:          string(entry.Kind),
+			Amount:        entry.Amount,
+			Memo:          entry.Memo,
+			CreatedAt:     entry.CreatedAt,
+		})
+	}
+	return exported
+}
+
+func exportStats(stats *UserStats) ExportedStats {
+	exported := ExportedStats{
+		TotalBets:           stats.TotalBets,
+		Wins:                stats.Wins,
+		Losses:              stats.Losses,
+		Pending:             stats.Pending,
+		Voided:              stats.Voided,
+		Points:              stats.Points,
+		CurrentStreak:       stats.CurrentStreak,
+		LongestStreak:       stats.LongestStreak,
+		FavouriteCategories: make([]ExportedCategoryCount, 0, len(stats.FavouriteCategories)),
+		Rank:                stats.Rank,
+		RankedUsers:         stats.RankedUsers,
+	}
+	for _, category := range stats.FavouriteCategories {
+		exported.FavouriteCategories = append(exported.FavouriteCategories, ExportedCategoryCount{Category: category.Category, Bets: category.Bets})
+	}
+	return exported
+}
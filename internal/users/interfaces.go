@@ -1,31 +1,56 @@
 package users
 
-import "errors"
+import (
+	"context"
+	"errors"
+
+	"betting-discord-bot/internal/storage"
+)
 
 type UserService interface {
+	// WithTx returns the service with its changes made as part of the unit of
+	// work, so that a user created on first contact is rolled back with what
+	// failed after it.
+	WithTx(tx *storage.Tx) UserService
 	// CreateUser creates a new internal user and links it to the given provider identity.
-	CreateUser(identity Identity) (User, error)
+	CreateUser(ctx context.Context, identity Identity) (User, error)
 	// GetUserByExternalID finds a user by their provider identity
-	GetUserByExternalID(identity Identity) (User, error)
+	GetUserByExternalID(ctx context.Context, identity Identity) (User, error)
 	// DeleteUser deletes the user and all associated identities.
 	// For now, we still trigger this via a specific provider identity.
-	DeleteUser(identity Identity) error
-	GetWinLoss(userID string) (*WinLoss, error)
+	DeleteUser(ctx context.Context, identity Identity) error
+	GetWinLoss(ctx context.Context, userID string) (*WinLoss, error)
+	// GetStats builds the user's betting profile in the guild, including their
+	// rank on the guild's leaderboard by wins.
+	GetStats(ctx context.Context, userID string, guildID string) (*UserStats, error)
+	// GetExternalID finds the user's ID with the given provider, so that an
+	// internal user can be shown back to that provider.
+	GetExternalID(ctx context.Context, userID string, provider string) (string, error)
+	// ExportData gathers everything kept about the user: their record, their
+	// identities, their bets, the polls they created, the outcomes they
+	// corrected, their wallets and ledger, and their stats across every guild.
+	ExportData(ctx context.Context, userID string) (*DataExport, error)
 }
 
 type UserRepository interface {
-	Save(user *user, identity *Identity) error
+	// WithTx returns the repository with its reads and writes made as part of
+	// the unit of work.
+	WithTx(tx *storage.Tx) UserRepository
+	Save(ctx context.Context, user *user, identity *Identity) error
 	// AddIdentity links an external identity to an existing user.
-	AddIdentity(userID string, identity *Identity) error
-	GetByID(id string) (*user, error)
-	GetByExternalID(identity *Identity) (*user, error)
-	// Delete deletes the user and their identities.
-	// The implementation should handle the cascade or multi-table deletion.
-	Delete(userID string) error
+	AddIdentity(ctx context.Context, userID string, identity *Identity) error
+	GetByID(ctx context.Context, id string) (*user, error)
+	GetByExternalID(ctx context.Context, identity *Identity) (*user, error)
+	GetExternalID(ctx context.Context, userID string, provider string) (string, error)
+	// GetIdentities returns every identity linked to the user, ordered by provider.
+	GetIdentities(ctx context.Context, userID string) ([]Identity, error)
+	// Delete deletes the user and their identities. Their bets are deleted
+	// with them where they share storage.
+	Delete(ctx context.Context, userID string) error
 
 	// Private testing methods
 
-	getUserCount() (int, error)
+	getUserCount(ctx context.Context) (int, error)
 }
 
 var ErrUserNotFound = errors.New("user not found")
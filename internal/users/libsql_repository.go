@@ -2,13 +2,15 @@ package users
 
 import (
 	"betting-discord-bot/internal/cryptography"
+	"betting-discord-bot/internal/storage"
+	"context"
 	"database/sql"
 	"errors"
 	"fmt"
 )
 
 type libsqlRepository struct {
-	db            *sql.DB
+	db            storage.DBTX
 	cryptoService cryptography.CryptoService
 }
 
@@ -16,7 +18,11 @@ func NewLibSQLRepository(db *sql.DB, cryptoService cryptography.CryptoService) U
 	return &libsqlRepository{db, cryptoService}
 }
 
-func (repo *libsqlRepository) Save(user *user, identity *Identity) error {
+func (repo *libsqlRepository) WithTx(tx *storage.Tx) UserRepository {
+	return &libsqlRepository{db: tx.Conn(repo.db), cryptoService: repo.cryptoService}
+}
+
+func (repo *libsqlRepository) Save(ctx context.Context, user *user, identity *Identity) error {
 	// Encrypt sensitive data before saving
 	encryptedUsername, err := repo.cryptoService.Encrypt(user.Username)
 	if err != nil {
@@ -28,39 +34,35 @@ func (repo *libsqlRepository) Save(user *user, identity *Identity) error {
 		return fmt.Errorf("failed to encrypt display_name: %w", err)
 	}
 
-	// Start a transaction
-	transaction, err := repo.db.Begin()
-	if err != nil {
-		return err
-	}
-
-	defer transaction.Rollback()
+	// The user and their identity are saved together, in the caller's unit of
+	// work if the repository joined one.
+	return storage.InTransaction(ctx, repo.db, func(transaction storage.DBTX) error {
+		userQuery := `INSERT INTO users (id, username, display_name) VALUES (?, ?, ?)`
 
-	userQuery := `INSERT INTO users (id, username, display_name) VALUES (?, ?, ?)`
-
-	_, err = transaction.Exec(userQuery, user.ID, encryptedUsername, encryptedDisplayName)
-	if err != nil {
-		return fmt.Errorf("error saving user: %w", err)
-	}
+		_, err = transaction.ExecContext(ctx, userQuery, user.ID, encryptedUsername, encryptedDisplayName)
+		if err != nil {
+			return fmt.Errorf("error saving user: %w", err)
+		}
 
-	encryptedExternalID, err := repo.cryptoService.Encrypt(identity.ExternalID)
-	if err != nil {
-		return fmt.Errorf("failed to encrypt external_id: %w", err)
-	}
+		encryptedExternalID, err := repo.cryptoService.Encrypt(identity.ExternalID)
+		if err != nil {
+			return fmt.Errorf("failed to encrypt external_id: %w", err)
+		}
 
-	externalIDHash := repo.cryptoService.GenerateBlindIndex(identity.ExternalID)
+		externalIDHash := repo.cryptoService.GenerateBlindIndex(identity.ExternalID)
 
-	identityQuery := `INSERT INTO user_identities (provider, external_id, external_id_hash, user_id) VALUES (?, ?, ?, ?)`
+		identityQuery := `INSERT INTO user_identities (provider, external_id, external_id_hash, user_id) VALUES (?, ?, ?, ?)`
 
-	_, err = transaction.Exec(identityQuery, identity.Provider, encryptedExternalID, externalIDHash, user.ID)
-	if err != nil {
-		return fmt.Errorf("error saving identity: %w", err)
-	}
+		_, err = transaction.ExecContext(ctx, identityQuery, identity.Provider, encryptedExternalID, externalIDHash, user.ID)
+		if err != nil {
+			return fmt.Errorf("error saving identity: %w", err)
+		}
 
-	return transaction.Commit()
+		return nil
+	})
 }
 
-func (repo *libsqlRepository) AddIdentity(userID string, identity *Identity) error {
+func (repo *libsqlRepository) AddIdentity(ctx context.Context, userID string, identity *Identity) error {
 	encryptedExternalID, err := repo.cryptoService.Encrypt(identity.ExternalID)
 	if err != nil {
 		return fmt.Errorf("failed to encrypt external_id: %w", err)
@@ -70,7 +72,7 @@ func (repo *libsqlRepository) AddIdentity(userID string, identity *Identity) err
 
 	query := `INSERT INTO user_identities (provider, external_id, external_id_hash, user_id) VALUES (?, ?, ?, ?)`
 
-	_, err = repo.db.Exec(query, identity.Provider, encryptedExternalID, externalIDHash, userID)
+	_, err = repo.db.ExecContext(ctx, query, identity.Provider, encryptedExternalID, externalIDHash, userID)
 	if err != nil {
 		return fmt.Errorf("error saving identity: %w", err)
 	}
@@ -78,9 +80,9 @@ func (repo *libsqlRepository) AddIdentity(userID string, identity *Identity) err
 	return nil
 }
 
-func (repo *libsqlRepository) GetByID(id string) (*user, error) {
+func (repo *libsqlRepository) GetByID(ctx context.Context, id string) (*user, error) {
 	query := `SELECT id, username, display_name FROM users WHERE id = ?`
-	row := repo.db.QueryRow(query, id)
+	row := repo.db.QueryRowContext(ctx, query, id)
 
 	var u user
 	var encUsername, encDisplayName string
@@ -106,7 +108,7 @@ func (repo *libsqlRepository) GetByID(id string) (*user, error) {
 	return &u, nil
 }
 
-func (repo *libsqlRepository) GetByExternalID(identity *Identity) (*user, error) {
+func (repo *libsqlRepository) GetByExternalID(ctx context.Context, identity *Identity) (*user, error) {
 	// Search by blind index (hash)
 	externalIDHash := repo.cryptoService.GenerateBlindIndex(identity.ExternalID)
 
@@ -115,7 +117,7 @@ func (repo *libsqlRepository) GetByExternalID(identity *Identity) (*user, error)
               JOIN user_identities ui ON u.id = ui.user_id
               WHERE ui.provider = ? AND ui.external_id_hash = ?`
 
-	row := repo.db.QueryRow(query, identity.Provider, externalIDHash)
+	row := repo.db.QueryRowContext(ctx, query, identity.Provider, externalIDHash)
 
 	var retrievedUser user
 	var encryptedExternalID, encryptedUsername, encryptedDisplayName string
@@ -150,9 +152,58 @@ func (repo *libsqlRepository) GetByExternalID(identity *Identity) (*user, error)
 	return &retrievedUser, nil
 }
 
-func (repo *libsqlRepository) Delete(userID string) error {
+func (repo *libsqlRepository) GetExternalID(ctx context.Context, userID string, provider string) (string, error) {
+	query := `SELECT external_id FROM user_identities WHERE user_id = ? AND provider = ?`
+	row := repo.db.QueryRowContext(ctx, query, userID, provider)
+
+	var encryptedExternalID string
+	if err := row.Scan(&encryptedExternalID); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return "", ErrUserNotFound
+		}
+		return "", fmt.Errorf("error retrieving external ID: %w", err)
+	}
+
+	externalID, err := repo.cryptoService.Decrypt(encryptedExternalID)
+	if err != nil {
+		return "", fmt.Errorf("failed to decrypt external_id: %w", err)
+	}
+
+	return externalID, nil
+}
+
+func (repo *libsqlRepository) GetIdentities(ctx context.Context, userID string) ([]Identity, error) {
+	query := `SELECT provider, external_id FROM user_identities WHERE user_id = ? ORDER BY provider`
+	rows, err := repo.db.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, fmt.Errorf("error retrieving identities: %w", err)
+	}
+	defer rows.Close()
+
+	var identities []Identity
+	for rows.Next() {
+		var identity Identity
+		var encryptedExternalID string
+		if err := rows.Scan(&identity.Provider, &encryptedExternalID); err != nil {
+			return nil, fmt.Errorf("error scanning identity: %w", err)
+		}
+
+		identity.ExternalID, err = repo.cryptoService.Decrypt(encryptedExternalID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decrypt external_id: %w", err)
+		}
+		identities = append(identities, identity)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error retrieving identities: %w", err)
+	}
+
+	return identities, nil
+}
+
+func (repo *libsqlRepository) Delete(ctx context.Context, userID string) error {
 	query := "DELETE FROM users WHERE id = ?"
-	result, err := repo.db.Exec(query, userID)
+	result, err := repo.db.ExecContext(ctx, query, userID)
 	if err != nil {
 		return fmt.Errorf("error deleting user %s: %w", userID, err)
 	}
@@ -169,9 +220,9 @@ func (repo *libsqlRepository) Delete(userID string) error {
 	return nil
 }
 
-func (repo *libsqlRepository) getUserCount() (int, error) {
+func (repo *libsqlRepository) getUserCount(ctx context.Context) (int, error) {
 	query := "SELECT COUNT(*) FROM users"
-	row := repo.db.QueryRow(query)
+	row := repo.db.QueryRowContext(ctx, query)
 
 	var count int
 	err := row.Scan(&count)
@@ -1,12 +1,21 @@
 package users
 
 import (
+	"context"
 	"errors"
+	"maps"
+	"sort"
+	"strings"
+
+	"betting-discord-bot/internal/storage"
 )
 
 type memoryRepository struct {
 	users      map[string]*user
 	identities map[string]string // Key: provider:externalID, Value: userID
+	// onDelete are called with the ID of every deleted user, standing in for
+	// the foreign keys of the tables that belong to users.
+	onDelete []func(userID string)
 }
 
 func NewMemoryRepository() UserRepository {
@@ -16,7 +25,33 @@ func NewMemoryRepository() UserRepository {
 	}
 }
 
-func (repo *memoryRepository) Save(user *user, identity *Identity) error {
+// OnDelete registers fn to be called with the ID of every user deleted, so
+// that memory repositories of what belongs to users can delete it with them.
+func (repo *memoryRepository) OnDelete(fn func(userID string)) {
+	repo.onDelete = append(repo.onDelete, fn)
+}
+
+// WithTx snapshots the users and identities, so that users created in the unit
+// of work are forgotten if it is rolled back. Users are never changed in
+// place, so the snapshot shares them.
+func (repo *memoryRepository) WithTx(tx *storage.Tx) UserRepository {
+	users := maps.Clone(repo.users)
+	identities := maps.Clone(repo.identities)
+
+	tx.OnRollback(func() {
+		clear(repo.users)
+		maps.Copy(repo.users, users)
+		clear(repo.identities)
+		maps.Copy(repo.identities, identities)
+	})
+	return repo
+}
+
+func (repo *memoryRepository) Save(ctx context.Context, user *user, identity *Identity) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
 	if user == nil {
 		return errors.New("user is nil")
 	}
@@ -32,9 +67,13 @@ func (repo *memoryRepository) Save(user *user, identity *Identity) error {
 	return nil
 }
 
-func (repo *memoryRepository) AddIdentity(userID string, identity *Identity) error {
+func (repo *memoryRepository) AddIdentity(ctx context.Context, userID string, identity *Identity) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
 	if _, exists := repo.users[userID]; !exists {
-		return errors.New("user not found")
+		return ErrUserNotFound
 	}
 
 	key := identity.Provider + ":" + identity.ExternalID
@@ -46,26 +85,70 @@ func (repo *memoryRepository) AddIdentity(userID string, identity *Identity) err
 	return nil
 }
 
-func (repo *memoryRepository) GetByID(id string) (*user, error) {
+func (repo *memoryRepository) GetByID(ctx context.Context, id string) (*user, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
 	user, exists := repo.users[id]
 	if !exists {
-		return nil, errors.New("user not found")
+		return nil, ErrUserNotFound
 	}
 	return user, nil
 }
 
-func (repo *memoryRepository) GetByExternalID(identity *Identity) (*user, error) {
+func (repo *memoryRepository) GetByExternalID(ctx context.Context, identity *Identity) (*user, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
 	key := identity.Provider + ":" + identity.ExternalID
 	userID, exists := repo.identities[key]
 	if !exists {
-		return nil, errors.New("user not found")
+		return nil, ErrUserNotFound
+	}
+	return repo.GetByID(ctx, userID)
+}
+
+func (repo *memoryRepository) GetExternalID(ctx context.Context, userID string, provider string) (string, error) {
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+
+	prefix := provider + ":"
+	for key, identityUserID := range repo.identities {
+		if identityUserID == userID && strings.HasPrefix(key, prefix) {
+			return strings.TrimPrefix(key, prefix), nil
+		}
 	}
-	return repo.GetByID(userID)
+	return "", ErrUserNotFound
 }
 
-func (repo *memoryRepository) Delete(userID string) error {
+func (repo *memoryRepository) GetIdentities(ctx context.Context, userID string) ([]Identity, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	var identities []Identity
+	for key, identityUserID := range repo.identities {
+		if identityUserID == userID {
+			provider, externalID, _ := strings.Cut(key, ":")
+			identities = append(identities, Identity{Provider: provider, ExternalID: externalID})
+		}
+	}
+	sort.Slice(identities, func(i, j int) bool {
+		return identities[i].Provider < identities[j].Provider
+	})
+	return identities, nil
+}
+
+func (repo *memoryRepository) Delete(ctx context.Context, userID string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
 	if _, exists := repo.users[userID]; !exists {
-		return errors.New("user not found")
+		return ErrUserNotFound
 	}
 
 	delete(repo.users, userID)
@@ -76,10 +159,17 @@ func (repo *memoryRepository) Delete(userID string) error {
 			delete(repo.identities, k)
 		}
 	}
+	for _, fn := range repo.onDelete {
+		fn(userID)
+	}
 	return nil
 }
 
-func (repo *memoryRepository) getUserCount() (int, error) {
+func (repo *memoryRepository) getUserCount(ctx context.Context) (int, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+
 	return len(repo.users), nil
 }
 
@@ -1,11 +1,17 @@
 package users
 
 import (
+	"betting-discord-bot/internal/bets"
 	"betting-discord-bot/internal/cryptography"
+	"betting-discord-bot/internal/polls"
 	"betting-discord-bot/internal/storage"
+	"context"
+	"errors"
 	"os"
+	"slices"
 	"strings"
 	"testing"
+	"time"
 )
 
 func setupInMemory(t *testing.T) (UserRepository, func()) {
@@ -65,10 +71,13 @@ func TestUserRepositoryImplementations(t *testing.T) {
 	}
 
 	tests := map[string]func(t *testing.T, repo UserRepository){
-		"it should save then get a user":            testSaveAndGet,
-		"it should get a user by their external ID": testGetByExternalID,
-		"it should delete a user":                   testDelete,
-		"it should save the user atomically":        testSaveUserIsAtomicTransaction,
+		"it should save then get a user":               testSaveAndGet,
+		"it should get a user by their external ID":    testGetByExternalID,
+		"it should delete a user":                      testDelete,
+		"it should save the user atomically":           testSaveUserIsAtomicTransaction,
+		"it should get a user's external ID":           testGetExternalID,
+		"it should get every identity of a user":       testGetIdentities,
+		"it should stop once the context is cancelled": testCancelledContext,
 	}
 
 	for _, implementation := range implementations {
@@ -101,11 +110,11 @@ func testSaveAndGet(t *testing.T, repo UserRepository) {
 		ExternalID: "test-external-id",
 	}
 
-	if err := repo.Save(user, identity); err != nil {
+	if err := repo.Save(t.Context(), user, identity); err != nil {
 		t.Fatalf("Failed to save user: %v", err)
 	}
 
-	savedUser, err := repo.GetByID(user.ID)
+	savedUser, err := repo.GetByID(t.Context(), user.ID)
 	if err != nil {
 		t.Fatalf("Failed to get user by ID: %v", err)
 	}
@@ -128,11 +137,11 @@ func testGetByExternalID(t *testing.T, repo UserRepository) {
 		ExternalID: "test-external-id",
 	}
 
-	if err := repo.Save(user, identity); err != nil {
+	if err := repo.Save(t.Context(), user, identity); err != nil {
 		t.Fatalf("Failed to save user: %v", err)
 	}
 
-	savedUser, err := repo.GetByExternalID(identity)
+	savedUser, err := repo.GetByExternalID(t.Context(), identity)
 	if err != nil {
 		t.Fatalf("Failed to get user by External ID: %v", err)
 	}
@@ -140,6 +149,11 @@ func testGetByExternalID(t *testing.T, repo UserRepository) {
 	if savedUser.ID != user.ID {
 		t.Errorf("Expected ID %s, got %s", user.ID, savedUser.ID)
 	}
+
+	unknownIdentity := &Identity{Provider: "test-provider", ExternalID: "unknown-external-id"}
+	if _, err := repo.GetByExternalID(t.Context(), unknownIdentity); !errors.Is(err, ErrUserNotFound) {
+		t.Errorf("Expected error '%v', got '%v'", ErrUserNotFound, err)
+	}
 }
 
 // testDelete tests deleting a user
@@ -153,23 +167,23 @@ func testDelete(t *testing.T, repo UserRepository) {
 	}
 
 	// Save the user first
-	if err := repo.Save(user, identity); err != nil {
+	if err := repo.Save(t.Context(), user, identity); err != nil {
 		t.Fatalf("Failed to save user: %v", err)
 	}
 
 	// Ensure user exists before deletion
-	_, err := repo.GetByExternalID(identity)
+	_, err := repo.GetByExternalID(t.Context(), identity)
 	if err != nil {
 		t.Fatalf("Failed to get user by ExternalID before deletion: %v", err)
 	}
 
 	// Delete the user
-	if err := repo.Delete(user.ID); err != nil {
+	if err := repo.Delete(t.Context(), user.ID); err != nil {
 		t.Fatalf("Failed to delete user: %v", err)
 	}
 
 	// Assert that the user no longer exists
-	_, err = repo.GetByExternalID(identity)
+	_, err = repo.GetByExternalID(t.Context(), identity)
 	if err == nil {
 		t.Fatal("Expected error when getting deleted user, got none")
 	}
@@ -185,11 +199,11 @@ func testSaveUserIsAtomicTransaction(t *testing.T, repo UserRepository) {
 		ExternalID: "test-external-id",
 	}
 
-	if err := repo.Save(blockingUser, identity); err != nil {
+	if err := repo.Save(t.Context(), blockingUser, identity); err != nil {
 		t.Fatalf("Failed to save setup blocking user: %v", err)
 	}
 
-	startingUserCount, err := repo.getUserCount()
+	startingUserCount, err := repo.getUserCount(t.Context())
 	if err != nil {
 		t.Fatalf("Failed to count users: %v", err)
 	}
@@ -198,11 +212,11 @@ func testSaveUserIsAtomicTransaction(t *testing.T, repo UserRepository) {
 	testUser := &user{
 		ID: "new user",
 	}
-	if err := repo.Save(testUser, identity); err == nil {
+	if err := repo.Save(t.Context(), testUser, identity); err == nil {
 		t.Fatal("Didn't fail on already used identity")
 	}
 
-	endingUserCount, err := repo.getUserCount()
+	endingUserCount, err := repo.getUserCount(t.Context())
 	if err != nil {
 		t.Fatalf("Failed to count users: %v", err)
 	}
@@ -211,3 +225,280 @@ func testSaveUserIsAtomicTransaction(t *testing.T, repo UserRepository) {
 		t.Fatal("SaveUser is not atomic")
 	}
 }
+
+func testGetExternalID(t *testing.T, repo UserRepository) {
+	user := &user{ID: "test-id"}
+	identity := &Identity{Provider: "test-provider", ExternalID: "test-external-id"}
+	if err := repo.Save(t.Context(), user, identity); err != nil {
+		t.Fatalf("Failed to save user: %v", err)
+	}
+
+	externalID, err := repo.GetExternalID(t.Context(), user.ID, identity.Provider)
+	if err != nil {
+		t.Fatalf("Failed to get external ID: %v", err)
+	}
+	if externalID != identity.ExternalID {
+		t.Errorf("Expected external ID %s, got %s", identity.ExternalID, externalID)
+	}
+
+	if _, err := repo.GetExternalID(t.Context(), user.ID, "other-provider"); !errors.Is(err, ErrUserNotFound) {
+		t.Errorf("Expected error '%v', got '%v'", ErrUserNotFound, err)
+	}
+}
+
+func testGetIdentities(t *testing.T, repo UserRepository) {
+	exported := &user{ID: "test-id"}
+	if err := repo.Save(t.Context(), exported, &Identity{Provider: "test-provider", ExternalID: "test-external-id"}); err != nil {
+		t.Fatalf("Failed to save user: %v", err)
+	}
+	if err := repo.AddIdentity(t.Context(), exported.ID, &Identity{Provider: "other-provider", ExternalID: "other-external-id"}); err != nil {
+		t.Fatalf("Failed to add identity: %v", err)
+	}
+	if err := repo.Save(t.Context(), &user{ID: "other-id"}, &Identity{Provider: "test-provider", ExternalID: "someone-else"}); err != nil {
+		t.Fatalf("Failed to save other user: %v", err)
+	}
+
+	identities, err := repo.GetIdentities(t.Context(), exported.ID)
+	if err != nil {
+		t.Fatalf("Failed to get identities: %v", err)
+	}
+
+	expected := []Identity{
+		{Provider: "other-provider", ExternalID: "other-external-id"},
+		{Provider: "test-provider", ExternalID: "test-external-id"},
+	}
+	if !slices.Equal(identities, expected) {
+		t.Errorf("Expected identities %+v, got %+v", expected, identities)
+	}
+}
+
+func testCancelledContext(t *testing.T, repo UserRepository) {
+	ctx, cancel := context.WithCancel(t.Context())
+	cancel()
+
+	user := &user{ID: "test-id", Username: "test-username"}
+	identity := &Identity{Provider: "test-provider", ExternalID: "test-external-id"}
+	if err := repo.Save(ctx, user, identity); !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected Save() to return '%v', but got '%v'", context.Canceled, err)
+	}
+	if _, err := repo.GetByID(ctx, user.ID); !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected GetByID() to return '%v', but got '%v'", context.Canceled, err)
+	}
+	if _, err := repo.GetByID(t.Context(), user.ID); !errors.Is(err, ErrUserNotFound) {
+		t.Errorf("Expected the user not to be saved with a cancelled context, but got '%v'", err)
+	}
+}
+
+// deletionServices share one storage with the user repository, so that
+// deleting a user reaches the bets they placed.
+type deletionServices struct {
+	polls polls.PollService
+	bets  bets.BetService
+}
+
+func setupLibSQLWithBets(t *testing.T) (UserRepository, deletionServices, func()) {
+	t.Helper()
+
+	sanitizedTestName := strings.ReplaceAll(t.Name(), "/", "_")
+	dbPath := sanitizedTestName + ".db"
+	_ = os.Remove(dbPath)
+
+	db, err := storage.InitializeDatabase(dbPath, "")
+	if err != nil {
+		t.Fatalf("Failed to initialize test database: %v", err)
+	}
+
+	teardown := func() {
+		if err := db.Close(); err != nil {
+			t.Fatal("failed to close database")
+		}
+		if err := os.Remove(dbPath); err != nil {
+			t.Fatal("failed to remove database file")
+		}
+	}
+
+	pollService := polls.NewService(polls.NewLibSQLRepository(db))
+	betService := bets.NewService(pollService, bets.NewLibSQLRepository(db), nil, bets.PayoutCalculator{}, storage.NewLibSQLUnitOfWork(db))
+	return NewLibSQLRepository(db, setupCryptoService(t)), deletionServices{polls: pollService, bets: betService}, teardown
+}
+
+func setupInMemoryWithBets(t *testing.T) (UserRepository, deletionServices, func()) {
+	t.Helper()
+
+	repo := NewMemoryRepository()
+	pollRepo := polls.NewMemoryRepository()
+	pollService := polls.NewService(pollRepo)
+	betService := bets.NewService(pollService, bets.NewMemoryRepositoryWithParents(pollRepo, repo.(bets.DeleteNotifier)), nil, bets.PayoutCalculator{}, storage.NewMemoryUnitOfWork())
+	return repo, deletionServices{polls: pollService, bets: betService}, func() {}
+}
+
+// TestUserDeletionImplementations covers what deleting a user takes with them.
+func TestUserDeletionImplementations(t *testing.T) {
+	t.Parallel()
+	implementations := []struct {
+		name  string
+		setup func(t *testing.T) (UserRepository, deletionServices, func())
+	}{
+		{name: "InMemoryRepository", setup: setupInMemoryWithBets},
+		{name: "LibSQLRepository", setup: setupLibSQLWithBets},
+	}
+
+	for _, implementation := range implementations {
+		t.Run(implementation.name, func(t *testing.T) {
+			t.Parallel()
+
+			repo, services, teardown := implementation.setup(t)
+			t.Cleanup(teardown)
+
+			testDeleteUserBets(t, repo, services)
+		})
+	}
+}
+
+func testDeleteUserBets(t *testing.T, repo UserRepository, services deletionServices) {
+	for index, id := range []string{"deleted", "kept"} {
+		identity := &Identity{Provider: "test-provider", ExternalID: id}
+		if err := repo.Save(t.Context(), &user{ID: id}, identity); err != nil {
+			t.Fatalf("Failed to save user %d: %v", index, err)
+		}
+	}
+
+	poll, err := services.polls.CreatePoll(t.Context(), "guild", "", "Who wins the final?", []string{"Red", "Blue"}, time.Time{}, "")
+	if err != nil {
+		t.Fatalf("Failed to create poll: %v", err)
+	}
+	for _, userID := range []string{"deleted", "kept"} {
+		if _, err := services.bets.CreateBet(t.Context(), poll.GetID(), userID, 0, 0); err != nil {
+			t.Fatalf("Failed to place the bet of %s: %v", userID, err)
+		}
+	}
+	if _, err := services.bets.ChangeBet(t.Context(), poll.GetID(), "deleted", 1); err != nil {
+		t.Fatalf("Failed to switch the bet: %v", err)
+	}
+
+	if err := repo.Delete(t.Context(), "deleted"); err != nil {
+		t.Fatalf("Failed to delete user: %v", err)
+	}
+
+	if _, err := services.bets.GetBet(t.Context(), poll.GetID(), "deleted"); !errors.Is(err, bets.ErrBetNotFound) {
+		t.Errorf("Expected the bet of the deleted user to be deleted, but got '%v'", err)
+	}
+	if changes, err := services.bets.GetBetChanges(t.Context(), poll.GetID(), "deleted"); err != nil || len(changes) != 0 {
+		t.Errorf("Expected the bet changes of the deleted user to be deleted, but got %v (%v)", changes, err)
+	}
+	if _, err := services.bets.GetBet(t.Context(), poll.GetID(), "kept"); err != nil {
+		t.Errorf("Expected the bet of the other user to be kept, but got '%v'", err)
+	}
+}
+
+func setupLibSQLWithUnitOfWork(t *testing.T) (UserRepository, storage.UnitOfWork, func()) {
+	t.Helper()
+
+	sanitizedTestName := strings.ReplaceAll(t.Name(), "/", "_")
+	dbPath := sanitizedTestName + ".db"
+	_ = os.Remove(dbPath)
+
+	db, err := storage.InitializeDatabase(dbPath, "")
+	if err != nil {
+		t.Fatalf("Failed to initialize test database: %v", err)
+	}
+
+	teardown := func() {
+		if err := db.Close(); err != nil {
+			t.Fatal("failed to close database")
+		}
+		if err := os.Remove(dbPath); err != nil {
+			t.Fatal("failed to remove database file")
+		}
+	}
+
+	return NewLibSQLRepository(db, setupCryptoService(t)), storage.NewLibSQLUnitOfWork(db), teardown
+}
+
+func setupInMemoryWithUnitOfWork(t *testing.T) (UserRepository, storage.UnitOfWork, func()) {
+	t.Helper()
+
+	return NewMemoryRepository(), storage.NewMemoryUnitOfWork(), func() {}
+}
+
+// TestUserUnitOfWorkImplementations covers creating users as part of a unit of
+// work, which needs a unit of work backed by the same storage.
+func TestUserUnitOfWorkImplementations(t *testing.T) {
+	t.Parallel()
+	implementations := []struct {
+		name  string
+		setup func(t *testing.T) (UserRepository, storage.UnitOfWork, func())
+	}{
+		{name: "InMemoryRepository", setup: setupInMemoryWithUnitOfWork},
+		{name: "LibSQLRepository", setup: setupLibSQLWithUnitOfWork},
+	}
+
+	testCases := []struct {
+		name string
+		run  func(t *testing.T, repo UserRepository, unitOfWork storage.UnitOfWork)
+	}{
+		{"it should keep a user a unit of work saved", testUnitOfWorkCommit},
+		{"it should forget a user a failed unit of work saved", testUnitOfWorkRollback},
+	}
+
+	for _, impl := range implementations {
+		t.Run(impl.name, func(t *testing.T) {
+			t.Parallel()
+
+			for _, tc := range testCases {
+				t.Run(tc.name, func(t *testing.T) {
+					t.Parallel()
+
+					repo, unitOfWork, cleanup := impl.setup(t)
+					t.Cleanup(cleanup)
+
+					tc.run(t, repo, unitOfWork)
+				})
+			}
+		})
+	}
+}
+
+func testUnitOfWorkCommit(t *testing.T, repo UserRepository, unitOfWork storage.UnitOfWork) {
+	identity := &Identity{Provider: "discord", ExternalID: "123"}
+
+	err := unitOfWork.Do(t.Context(), func(tx *storage.Tx) error {
+		return repo.WithTx(tx).Save(t.Context(), &user{ID: "user"}, identity)
+	})
+	if err != nil {
+		t.Fatalf("Do() returned an unexpected error: %v", err)
+	}
+
+	if _, err := repo.GetByExternalID(t.Context(), identity); err != nil {
+		t.Errorf("Expected the user to be saved, but got %v", err)
+	}
+}
+
+func testUnitOfWorkRollback(t *testing.T, repo UserRepository, unitOfWork storage.UnitOfWork) {
+	existing := &Identity{Provider: "discord", ExternalID: "123"}
+	if err := repo.Save(t.Context(), &user{ID: "existing"}, existing); err != nil {
+		t.Fatalf("Save() returned an unexpected error: %v", err)
+	}
+
+	failure := errors.New("something went wrong")
+	added := &Identity{Provider: "discord", ExternalID: "456"}
+	err := unitOfWork.Do(t.Context(), func(tx *storage.Tx) error {
+		if err := repo.WithTx(tx).Save(t.Context(), &user{ID: "added"}, added); err != nil {
+			return err
+		}
+		return failure
+	})
+	if !errors.Is(err, failure) {
+		t.Fatalf("Expected Do() to return the error of the unit of work, but got %v", err)
+	}
+
+	if _, err := repo.GetByExternalID(t.Context(), added); !errors.Is(err, ErrUserNotFound) {
+		t.Errorf("Expected the user saved in the failed unit of work to be gone, but got %v", err)
+	}
+	if _, err := repo.GetByID(t.Context(), "added"); !errors.Is(err, ErrUserNotFound) {
+		t.Errorf("Expected the user record saved in the failed unit of work to be gone, but got %v", err)
+	}
+	if _, err := repo.GetByExternalID(t.Context(), existing); err != nil {
+		t.Errorf("Expected the user saved before the unit of work to be kept, but got %v", err)
+	}
+}
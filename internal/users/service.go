@@ -1,31 +1,50 @@
 package users
 
 import (
+	"context"
 	"fmt"
+	"sort"
+	"time"
 
 	"betting-discord-bot/internal/bets"
+	"betting-discord-bot/internal/polls"
+	"betting-discord-bot/internal/storage"
+	"betting-discord-bot/internal/wallet"
 
 	"github.com/google/uuid"
 )
 
 type service struct {
-	userRepo   UserRepository
-	betService bets.BetService
+	userRepo    UserRepository
+	pollService polls.PollService
+	betService  bets.BetService
+	// walletService is nil where balances are not kept, in which case data
+	// exports have no ledger.
+	walletService wallet.WalletService
 }
 
-func NewService(userRepo UserRepository, betService bets.BetService) UserService {
+func NewService(userRepo UserRepository, pollService polls.PollService, betService bets.BetService, walletService wallet.WalletService) UserService {
 	return &service{
-		userRepo:   userRepo,
-		betService: betService,
+		userRepo:      userRepo,
+		pollService:   pollService,
+		betService:    betService,
+		walletService: walletService,
 	}
 }
 
-func (service service) CreateUser(identity Identity) (User, error) {
+// WithTx binds the user repository to the unit of work. The services behind
+// stats and exports only read, so they are left as they are.
+func (service service) WithTx(tx *storage.Tx) UserService {
+	service.userRepo = service.userRepo.WithTx(tx)
+	return &service
+}
+
+func (service service) CreateUser(ctx context.Context, identity Identity) (User, error) {
 	user := &user{
 		ID: uuid.NewString(),
 	}
 
-	err := service.userRepo.Save(user, &identity)
+	err := service.userRepo.Save(ctx, user, &identity)
 	if err != nil {
 		return nil, fmt.Errorf("could not save user: %w", err)
 	}
@@ -33,8 +52,8 @@ func (service service) CreateUser(identity Identity) (User, error) {
 	return user, nil
 }
 
-func (service service) GetUserByExternalID(identity Identity) (User, error) {
-	user, userErr := service.userRepo.GetByExternalID(&identity)
+func (service service) GetUserByExternalID(ctx context.Context, identity Identity) (User, error) {
+	user, userErr := service.userRepo.GetByExternalID(ctx, &identity)
 	if userErr != nil {
 		return nil, userErr
 	}
@@ -42,13 +61,22 @@ func (service service) GetUserByExternalID(identity Identity) (User, error) {
 	return user, nil
 }
 
-func (service service) DeleteUser(identity Identity) error {
-	user, err := service.userRepo.GetByExternalID(&identity)
+func (service service) GetExternalID(ctx context.Context, userID string, provider string) (string, error) {
+	externalID, err := service.userRepo.GetExternalID(ctx, userID, provider)
+	if err != nil {
+		return "", fmt.Errorf("could not get external ID: %w", err)
+	}
+
+	return externalID, nil
+}
+
+func (service service) DeleteUser(ctx context.Context, identity Identity) error {
+	user, err := service.userRepo.GetByExternalID(ctx, &identity)
 	if err != nil {
 		return fmt.Errorf("could not find user to delete: %w", err)
 	}
 
-	err = service.userRepo.Delete(user.ID)
+	err = service.userRepo.Delete(ctx, user.ID)
 	if err != nil {
 		return fmt.Errorf("could not delete user: %w", err)
 	}
@@ -56,13 +84,13 @@ func (service service) DeleteUser(identity Identity) error {
 	return nil
 }
 
-func (service service) GetWinLoss(userID string) (*WinLoss, error) {
+func (service service) GetWinLoss(ctx context.Context, userID string) (*WinLoss, error) {
 	winLoss := &WinLoss{
 		Wins:   0,
 		Losses: 0,
 	}
 
-	betList, betListErr := service.betService.GetBetsFromUser(userID)
+	betList, betListErr := service.betService.GetBetsFromUser(ctx, userID)
 	if betListErr != nil {
 		return nil, fmt.Errorf("failed to get bets for user %s: %w", userID, betListErr)
 	}
@@ -73,7 +101,7 @@ func (service service) GetWinLoss(userID string) (*WinLoss, error) {
 			winLoss.Wins++
 		case bets.Lost:
 			winLoss.Losses++
-		case bets.Pending:
+		case bets.Pending, bets.Void:
 			continue
 		}
 	}
@@ -81,4 +109,199 @@ func (service service) GetWinLoss(userID string) (*WinLoss, error) {
 	return winLoss, nil
 }
 
+// statsPageSize is how many bets are read at a time while building stats.
+const statsPageSize = 100
+
+// exportPageSize is how many polls are read at a time while exporting data.
+const exportPageSize = 100
+
+// favouriteCategoryCount is how many categories a profile lists.
+const favouriteCategoryCount = 3
+
+func (service service) GetStats(ctx context.Context, userID string, guildID string) (*UserStats, error) {
+	history, err := service.betHistory(ctx, userID, guildID)
+	if err != nil {
+		return nil, err
+	}
+
+	return service.statsFromHistory(ctx, userID, guildID, history)
+}
+
+// betHistory reads every bet the user placed in the guild, or in every guild
+// if guildID is empty, newest first.
+func (service service) betHistory(ctx context.Context, userID string, guildID string) ([]bets.BetHistoryEntry, error) {
+	var history []bets.BetHistoryEntry
+	for {
+		page, err := service.betService.GetBetHistory(ctx, bets.BetHistoryQuery{UserID: userID, GuildID: guildID, Limit: statsPageSize, Offset: len(history)})
+		if err != nil {
+			return nil, fmt.Errorf("failed to get bets for user %s: %w", userID, err)
+		}
+		history = append(history, page.Entries...)
+		if len(page.Entries) == 0 || len(history) >= page.Total {
+			return history, nil
+		}
+	}
+}
+
+func (service service) statsFromHistory(ctx context.Context, userID string, guildID string, history []bets.BetHistoryEntry) (*UserStats, error) {
+	stats := computeStats(history)
+
+	leaderboard, err := service.betService.GetLeaderboard(ctx, bets.LeaderboardQuery{GuildID: guildID, OrderBy: bets.ByWins, UserID: userID, Limit: 1})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get rank of user %s: %w", userID, err)
+	}
+	stats.RankedUsers = leaderboard.Total
+	if len(leaderboard.Entries) == 1 {
+		stats.Rank = leaderboard.Entries[0].Rank
+	}
+
+	return stats, nil
+}
+
+func (service service) ExportData(ctx context.Context, userID string) (*DataExport, error) {
+	user, err := service.userRepo.GetByID(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user %s: %w", userID, err)
+	}
+
+	identities, err := service.userRepo.GetIdentities(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get identities of user %s: %w", userID, err)
+	}
+
+	history, err := service.betHistory(ctx, userID, "")
+	if err != nil {
+		return nil, err
+	}
+
+	export := &DataExport{
+		Version:    DataExportVersion,
+		ExportedAt: time.Now().UTC(),
+		User: ExportedUser{
+			ID:          user.ID,
+			Username:    user.Username,
+			DisplayName: user.DisplayName,
+		},
+		Identities: exportIdentities(identities),
+		Bets:       make([]ExportedBet, 0, len(history)),
+	}
+
+	changes, err := service.betService.GetBetChangesByUser(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get changes to the bets of user %s: %w", userID, err)
+	}
+	changesByPoll := make(map[string][]bets.BetChange)
+	for _, change := range changes {
+		changesByPoll[change.PollID] = append(changesByPoll[change.PollID], change)
+	}
+	for _, entry := range history {
+		export.Bets = append(export.Bets, exportBet(entry, changesByPoll[entry.PollID]))
+		delete(changesByPoll, entry.PollID)
+	}
+	// What is left are the changes to bets that were withdrawn, which have no
+	// entry in the history. They keep the order they were made in.
+	var withdrawn []bets.BetChange
+	for _, change := range changes {
+		if _, exists := changesByPoll[change.PollID]; exists {
+			withdrawn = append(withdrawn, change)
+		}
+	}
+	export.WithdrawnBetChanges = exportBetChanges(withdrawn)
+
+	created, err := service.createdPolls(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	export.Polls = exportPolls(created)
+
+	corrections, err := service.pollService.GetOutcomeCorrectionsByUser(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get outcome corrections of user %s: %w", userID, err)
+	}
+	export.OutcomeCorrections = exportOutcomeCorrections(corrections)
+
+	if service.walletService != nil {
+		wallets, err := service.walletService.GetWallets(ctx, userID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get wallets of user %s: %w", userID, err)
+		}
+		export.Wallets = exportWallets(wallets)
+
+		ledger, err := service.walletService.GetLedger(ctx, userID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get ledger of user %s: %w", userID, err)
+		}
+		export.Ledger = exportLedger(ledger)
+	}
+
+	stats, err := service.statsFromHistory(ctx, userID, "", history)
+	if err != nil {
+		return nil, err
+	}
+	export.Stats = exportStats(stats)
+
+	return export, nil
+}
+
+// createdPolls reads every poll the user created, in every guild.
+func (service service) createdPolls(ctx context.Context, userID string) ([]polls.Poll, error) {
+	var created []polls.Poll
+	for {
+		page, err := service.pollService.ListPolls(ctx, polls.PollQuery{CreatorID: userID, Limit: exportPageSize, Offset: len(created)})
+		if err != nil {
+			return nil, fmt.Errorf("failed to get polls created by user %s: %w", userID, err)
+		}
+		created = append(created, page.Polls...)
+		if len(page.Polls) == 0 || len(created) >= page.Total {
+			return created, nil
+		}
+	}
+}
+
+// computeStats tallies a user's bets, given newest first.
+func computeStats(history []bets.BetHistoryEntry) *UserStats {
+	stats := &UserStats{TotalBets: len(history)}
+	categoryBets := make(map[string]int)
+
+	// Streaks run in the order the bets were placed, so walk from the oldest.
+	for index := len(history) - 1; index >= 0; index-- {
+		entry := history[index]
+		if entry.PollCategory != "" {
+			categoryBets[entry.PollCategory]++
+		}
+
+		switch entry.BetStatus {
+		case bets.Won:
+			stats.Wins++
+			stats.Points += entry.Payout - entry.Stake
+			stats.CurrentStreak++
+			stats.LongestStreak = max(stats.LongestStreak, stats.CurrentStreak)
+		case bets.Lost:
+			stats.Losses++
+			stats.Points += entry.Payout - entry.Stake
+			stats.CurrentStreak = 0
+		case bets.Pending:
+			stats.Pending++
+		case bets.Void:
+			stats.Voided++
+		}
+	}
+
+	for category, count := range categoryBets {
+		stats.FavouriteCategories = append(stats.FavouriteCategories, CategoryCount{Category: category, Bets: count})
+	}
+	sort.Slice(stats.FavouriteCategories, func(i, j int) bool {
+		a, b := stats.FavouriteCategories[i], stats.FavouriteCategories[j]
+		if a.Bets != b.Bets {
+			return a.Bets > b.Bets
+		}
+		return a.Category < b.Category
+	})
+	if len(stats.FavouriteCategories) > favouriteCategoryCount {
+		stats.FavouriteCategories = stats.FavouriteCategories[:favouriteCategoryCount]
+	}
+
+	return stats
+}
+
 var _ UserService = (*service)(nil)
@@ -1,9 +1,12 @@
 package users
 
 import (
+	"context"
 	"testing"
 
 	"betting-discord-bot/internal/bets"
+	"betting-discord-bot/internal/polls"
+	"betting-discord-bot/internal/storage"
 
 	"github.com/google/uuid"
 )
@@ -25,27 +28,83 @@ func (m mockBet) GetBetStatus() bets.BetStatus {
 	return m.status
 }
 
+func (m mockBet) GetStake() int64 {
+	return 0
+}
+
+func (m mockBet) GetPayout() int64 {
+	return 0
+}
+
 func createMockBet(status bets.BetStatus) bets.Bet {
 	return mockBet{betKey: bets.BetKey{PollID: uuid.NewString(), UserID: "user"}, status: status}
 }
 
 type mockBetService struct {
-	betsToReturn []bets.Bet
+	betsToReturn        []bets.Bet
+	historyToReturn     []bets.BetHistoryEntry
+	leaderboardToReturn bets.Leaderboard
+	// queriedGuilds records the guild of every history and leaderboard query.
+	queriedGuilds []string
 }
 
-func (m *mockBetService) GetBetsFromUser(string) ([]bets.Bet, error) {
+func (m *mockBetService) GetBetsFromUser(context.Context, string) ([]bets.Bet, error) {
 	return m.betsToReturn, nil
 }
 
-func (m *mockBetService) CreateBet(string, string, int) (bets.Bet, error) {
+func (m *mockBetService) CreateBet(context.Context, string, string, int, int64) (bets.Bet, error) {
+	return nil, nil
+}
+func (m *mockBetService) GetBet(context.Context, string, string) (bets.Bet, error) { return nil, nil }
+func (m *mockBetService) ChangeBet(context.Context, string, string, int) (bets.Bet, error) {
+	return nil, nil
+}
+func (m *mockBetService) WithdrawBet(context.Context, string, string) error { return nil }
+func (m *mockBetService) GetBetChanges(context.Context, string, string) ([]bets.BetChange, error) {
+	return nil, nil
+}
+func (m *mockBetService) GetBetChangesByUser(context.Context, string) ([]bets.BetChange, error) {
+	return nil, nil
+}
+func (m *mockBetService) UpdateBetsByPollId(context.Context, string) error { return nil }
+func (m *mockBetService) SettlePoll(context.Context, string, polls.OutcomeStatus) error {
+	return nil
+}
+func (m *mockBetService) CorrectOutcome(context.Context, string, polls.OutcomeStatus, string) (polls.OutcomeCorrection, error) {
+	return polls.OutcomeCorrection{}, nil
+}
+func (m *mockBetService) VoidPoll(context.Context, string) error { return nil }
+func (m *mockBetService) GetImpliedOdds(context.Context, string) ([]bets.OptionOdds, error) {
 	return nil, nil
 }
-func (m *mockBetService) GetBet(string, string) (bets.Bet, error) { return nil, nil }
-func (m *mockBetService) UpdateBetsByPollId(string) error         { return nil }
+
+func (m *mockBetService) GetBetsByPollId(context.Context, string) ([]bets.Bet, error) {
+	return nil, nil
+}
+
+func (m *mockBetService) GetLeaderboard(ctx context.Context, query bets.LeaderboardQuery) (bets.Leaderboard, error) {
+	m.queriedGuilds = append(m.queriedGuilds, query.GuildID)
+	return m.leaderboardToReturn, nil
+}
+
+func (m *mockBetService) GetBetHistory(ctx context.Context, query bets.BetHistoryQuery) (bets.BetHistory, error) {
+	m.queriedGuilds = append(m.queriedGuilds, query.GuildID)
+	history := bets.BetHistory{Total: len(m.historyToReturn)}
+	if query.Offset < len(m.historyToReturn) {
+		end := min(query.Offset+query.Limit, len(m.historyToReturn))
+		history.Entries = m.historyToReturn[query.Offset:end]
+	}
+	return history, nil
+}
+
+func (m *mockBetService) GetBetCounts(context.Context, []string) (map[string]int, error) {
+	return nil, nil
+}
+func (m *mockBetService) WithTx(*storage.Tx) bets.BetService { return m }
 
 var _ bets.BetService = (*mockBetService)(nil)
 
-func getTestBets(wins int, losses int, pending int) []bets.Bet {
+func getTestBets(wins int, losses int, pending int, void int) []bets.Bet {
 	var betList []bets.Bet
 
 	for i := 0; i < wins; i++ {
@@ -60,6 +119,10 @@ func getTestBets(wins int, losses int, pending int) []bets.Bet {
 		betList = append(betList, createMockBet(bets.Pending))
 	}
 
+	for i := 0; i < void; i++ {
+		betList = append(betList, createMockBet(bets.Void))
+	}
+
 	return betList
 }
 
@@ -72,22 +135,27 @@ func TestGetUserWinLoss(t *testing.T) {
 	}{
 		{
 			"no bets",
-			getTestBets(0, 0, 0),
+			getTestBets(0, 0, 0, 0),
 			&WinLoss{Wins: 0, Losses: 0},
 		},
 		{
 			"a winning bet",
-			getTestBets(1, 0, 0),
+			getTestBets(1, 0, 0, 0),
 			&WinLoss{Wins: 1, Losses: 0},
 		},
 		{
 			"a losing bet",
-			getTestBets(0, 1, 0),
+			getTestBets(0, 1, 0, 0),
 			&WinLoss{Wins: 0, Losses: 1},
 		},
 		{
 			"pending bets should not count",
-			getTestBets(1, 1, 1),
+			getTestBets(1, 1, 1, 0),
+			&WinLoss{1, 1},
+		},
+		{
+			"void bets should not count",
+			getTestBets(1, 1, 0, 2),
 			&WinLoss{1, 1},
 		},
 	}
@@ -107,20 +175,20 @@ func testWinLoss(t *testing.T, betsToReturn []bets.Bet, expectedWinLoss *WinLoss
 	}
 
 	userRepo := NewMemoryRepository()
-	userService := NewService(userRepo, mockBets)
+	userService := NewService(userRepo, nil, mockBets, nil)
 
 	identity := &Identity{
 		Provider:   "test-provider",
 		ExternalID: "test-external-id",
 	}
 
-	user, err := userService.CreateUser(*identity)
+	user, err := userService.CreateUser(t.Context(), *identity)
 	if err != nil {
 		t.Fatalf("Setup failed: could not create user: %v", err)
 	}
 
 	// ACT
-	actualWinLoss, err := userService.GetWinLoss(user.GetID())
+	actualWinLoss, err := userService.GetWinLoss(t.Context(), user.GetID())
 	if err != nil {
 		t.Fatalf("GetWinLoss returned an unexpected error: %v", err)
 	}
@@ -134,3 +202,79 @@ func testWinLoss(t *testing.T, betsToReturn []bets.Bet, expectedWinLoss *WinLoss
 		t.Errorf("Expected Losses to be %d, but got %d", expectedWinLoss.Losses, actualWinLoss.Losses)
 	}
 }
+
+func TestGetUserStats(t *testing.T) {
+	t.Parallel()
+
+	// Oldest first.
+	placed := []bets.BetHistoryEntry{
+		{PollCategory: "Valorant", BetStatus: bets.Won, Stake: 10, Payout: 20},
+		{PollCategory: "Valorant", BetStatus: bets.Won},
+		{PollCategory: "Food", BetStatus: bets.Won},
+		{PollCategory: "Food", BetStatus: bets.Lost, Stake: 5},
+		{PollCategory: "Valorant", BetStatus: bets.Won, Stake: 10, Payout: 30},
+		{PollCategory: "Chess", BetStatus: bets.Void, Stake: 5, Payout: 5},
+		{BetStatus: bets.Won},
+		{PollCategory: "Chess", BetStatus: bets.Pending, Stake: 10},
+		{PollCategory: "Tennis", BetStatus: bets.Pending},
+	}
+	var history []bets.BetHistoryEntry
+	for index := len(placed) - 1; index >= 0; index-- {
+		history = append(history, placed[index])
+	}
+
+	mockBets := &mockBetService{
+		historyToReturn: history,
+		leaderboardToReturn: bets.Leaderboard{
+			Entries: []bets.LeaderboardEntry{{Rank: 2, UserID: "user", Wins: 5, Losses: 1}},
+			Total:   7,
+		},
+	}
+	userService := NewService(NewMemoryRepository(), nil, mockBets, nil)
+
+	stats, err := userService.GetStats(t.Context(), "user", "guild")
+	if err != nil {
+		t.Fatalf("GetStats returned an unexpected error: %v", err)
+	}
+	for _, guildID := range mockBets.queriedGuilds {
+		if guildID != "guild" {
+			t.Errorf("Expected every query to be scoped to the guild, but one was scoped to %q", guildID)
+		}
+	}
+
+	counts := []struct {
+		name     string
+		expected int64
+		actual   int64
+	}{
+		{"total bets", 9, int64(stats.TotalBets)},
+		{"wins", 5, int64(stats.Wins)},
+		{"losses", 1, int64(stats.Losses)},
+		{"pending", 2, int64(stats.Pending)},
+		{"voided", 1, int64(stats.Voided)},
+		{"points", 25, stats.Points},
+		{"current streak", 2, int64(stats.CurrentStreak)},
+		{"longest streak", 3, int64(stats.LongestStreak)},
+		{"rank", 2, int64(stats.Rank)},
+		{"ranked users", 7, int64(stats.RankedUsers)},
+	}
+	for _, count := range counts {
+		if count.actual != count.expected {
+			t.Errorf("Expected %s to be %d, but got %d", count.name, count.expected, count.actual)
+		}
+	}
+
+	expectedCategories := []CategoryCount{{"Valorant", 3}, {"Chess", 2}, {"Food", 2}}
+	if len(stats.FavouriteCategories) != len(expectedCategories) {
+		t.Fatalf("Expected favourite categories %+v, but got %+v", expectedCategories, stats.FavouriteCategories)
+	}
+	for index, category := range stats.FavouriteCategories {
+		if category != expectedCategories[index] {
+			t.Errorf("Expected favourite category %+v, but got %+v", expectedCategories[index], category)
+		}
+	}
+
+	if winRate := stats.WinRate(); winRate != 5.0/6.0 {
+		t.Errorf("Expected a win rate of %f, but got %f", 5.0/6.0, winRate)
+	}
+}
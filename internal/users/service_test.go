@@ -1,27 +1,33 @@
 package users
 
 import (
+	"encoding/json"
 	"errors"
+	"slices"
+	"strings"
 	"testing"
+	"time"
 
 	"betting-discord-bot/internal/bets"
 	"betting-discord-bot/internal/polls"
+	"betting-discord-bot/internal/storage"
+	"betting-discord-bot/internal/wallet"
 )
 
 func TestCreateUser(t *testing.T) {
 	t.Parallel()
 	pollMemoryRepo := polls.NewMemoryRepository()
 	pollService := polls.NewService(pollMemoryRepo)
-	betService := bets.NewService(pollService, nil)
+	betService := bets.NewService(pollService, nil, nil, bets.PayoutCalculator{}, storage.NewMemoryUnitOfWork())
 	userRepo := NewMemoryRepository()
-	userService := NewService(userRepo, betService)
+	userService := NewService(userRepo, pollService, betService, nil)
 
 	identity := Identity{
 		Provider:   "test-provider",
 		ExternalID: "test-external-id",
 	}
 
-	user, err := userService.CreateUser(identity)
+	user, err := userService.CreateUser(t.Context(), identity)
 	if err != nil {
 		t.Fatalf("CreateUser returned an unexpected error: %v", err)
 	}
@@ -34,18 +40,18 @@ func TestCreateUser(t *testing.T) {
 func TestGetUserByExternalID(t *testing.T) {
 	t.Parallel()
 	userRepo := NewMemoryRepository()
-	userService := NewService(userRepo, nil)
+	userService := NewService(userRepo, nil, nil, nil)
 
 	identity := Identity{
 		Provider:   "test-provider",
 		ExternalID: "test-external-id",
 	}
-	user, err := userService.CreateUser(identity)
+	user, err := userService.CreateUser(t.Context(), identity)
 	if err != nil {
 		t.Fatalf("CreateUser returned an unexpected error: %v", err)
 	}
 
-	retrievedUser, err := userService.GetUserByExternalID(identity)
+	retrievedUser, err := userService.GetUserByExternalID(t.Context(), identity)
 	if err != nil {
 		t.Fatalf("GetUserByExternalID returned an unexpected error: %v", err)
 	}
@@ -58,28 +64,178 @@ func TestGetUserByExternalID(t *testing.T) {
 func TestDeleteUser(t *testing.T) {
 	t.Parallel()
 	userRepo := NewMemoryRepository()
-	userService := NewService(userRepo, nil)
+	userService := NewService(userRepo, nil, nil, nil)
 
 	identity := Identity{
 		Provider:   "test-provider",
 		ExternalID: "test-external-id",
 	}
-	_, err := userService.CreateUser(identity)
+	_, err := userService.CreateUser(t.Context(), identity)
 	if err != nil {
 		t.Fatalf("CreateUser returned an unexpected error: %v", err)
 	}
 
-	err = userService.DeleteUser(identity)
+	err = userService.DeleteUser(t.Context(), identity)
 	if err != nil {
 		t.Fatalf("DeleteUser returned an unexpected error: %v", err)
 	}
 
-	_, err = userService.GetUserByExternalID(identity)
+	_, err = userService.GetUserByExternalID(t.Context(), identity)
 	if err == nil {
 		t.Fatalf("Expected GetUserByExternalID to return an error after deletion")
 	}
 
-	if errors.Is(err, ErrUserNotFound) {
+	if !errors.Is(err, ErrUserNotFound) {
 		t.Fatalf("Expected GetUserByExternalID to return ErrUserNotFound after deletion")
 	}
 }
+
+func TestExportData(t *testing.T) {
+	t.Parallel()
+	pollRepo := polls.NewMemoryRepository()
+	pollService := polls.NewService(pollRepo)
+	walletService := wallet.NewService(wallet.NewMemoryRepository(), 100)
+	betService := bets.NewService(pollService, bets.NewMemoryRepositoryWithPolls(pollRepo), walletService, bets.PayoutCalculator{}, storage.NewMemoryUnitOfWork())
+	userRepo := NewMemoryRepository()
+	userService := NewService(userRepo, pollService, betService, walletService)
+
+	identity := Identity{Provider: "discord", ExternalID: "123"}
+	user, err := userService.CreateUser(t.Context(), identity)
+	if err != nil {
+		t.Fatalf("CreateUser returned an unexpected error: %v", err)
+	}
+	if err := userRepo.AddIdentity(t.Context(), user.GetID(), &Identity{Provider: "web", ExternalID: "456"}); err != nil {
+		t.Fatalf("AddIdentity returned an unexpected error: %v", err)
+	}
+
+	poll, err := pollService.CreatePoll(t.Context(), "guild", user.GetID(), "Who wins the final?", []string{"Red", "Blue"}, time.Time{}, "Football")
+	if err != nil {
+		t.Fatalf("CreatePoll returned an unexpected error: %v", err)
+	}
+	corrected, err := pollService.CreatePoll(t.Context(), "guild", "", "Who scores first?", []string{"Red", "Blue"}, time.Time{}, "")
+	if err != nil {
+		t.Fatalf("CreatePoll returned an unexpected error: %v", err)
+	}
+	if err := pollService.ClosePoll(t.Context(), corrected.GetID()); err != nil {
+		t.Fatalf("ClosePoll returned an unexpected error: %v", err)
+	}
+	if err := betService.SettlePoll(t.Context(), corrected.GetID(), 0); err != nil {
+		t.Fatalf("SettlePoll returned an unexpected error: %v", err)
+	}
+	if _, err := betService.CorrectOutcome(t.Context(), corrected.GetID(), 1, user.GetID()); err != nil {
+		t.Fatalf("CorrectOutcome returned an unexpected error: %v", err)
+	}
+	withdrawn, err := pollService.CreatePoll(t.Context(), "guild", "", "Who plays in goal?", []string{"Red", "Blue"}, time.Time{}, "")
+	if err != nil {
+		t.Fatalf("CreatePoll returned an unexpected error: %v", err)
+	}
+	if _, err := betService.CreateBet(t.Context(), withdrawn.GetID(), user.GetID(), 1, 5); err != nil {
+		t.Fatalf("CreateBet returned an unexpected error: %v", err)
+	}
+	if err := betService.WithdrawBet(t.Context(), withdrawn.GetID(), user.GetID()); err != nil {
+		t.Fatalf("WithdrawBet returned an unexpected error: %v", err)
+	}
+	if _, err := betService.CreateBet(t.Context(), poll.GetID(), user.GetID(), 0, 10); err != nil {
+		t.Fatalf("CreateBet returned an unexpected error: %v", err)
+	}
+	if _, err := betService.ChangeBet(t.Context(), poll.GetID(), user.GetID(), 1); err != nil {
+		t.Fatalf("ChangeBet returned an unexpected error: %v", err)
+	}
+
+	export, err := userService.ExportData(t.Context(), user.GetID())
+	if err != nil {
+		t.Fatalf("ExportData returned an unexpected error: %v", err)
+	}
+
+	// The export is read back the way its recipient would.
+	encoded, err := json.Marshal(export)
+	if err != nil {
+		t.Fatalf("Failed to encode the export: %v", err)
+	}
+	var decoded DataExport
+	if err := json.Unmarshal(encoded, &decoded); err != nil {
+		t.Fatalf("Failed to decode the export: %v", err)
+	}
+
+	if decoded.Version != DataExportVersion || decoded.User.ID != user.GetID() {
+		t.Errorf("Expected version %d of the export of user %s, but got version %d of user %s", DataExportVersion, user.GetID(), decoded.Version, decoded.User.ID)
+	}
+	expectedIdentities := []ExportedIdentity{{Provider: "discord", ExternalID: "123"}, {Provider: "web", ExternalID: "456"}}
+	if !slices.Equal(decoded.Identities, expectedIdentities) {
+		t.Errorf("Expected identities %+v, but got %+v", expectedIdentities, decoded.Identities)
+	}
+	if len(decoded.Bets) != 1 {
+		t.Fatalf("Expected 1 bet, but got %+v", decoded.Bets)
+	}
+	if bet := decoded.Bets[0]; bet.PollTitle != "Who wins the final?" || bet.Option != "Blue" || bet.Stake != 10 || bet.Status != "PENDING" || len(bet.Changes) != 1 {
+		t.Errorf("Expected the switched bet of 10 on Blue, but got %+v", bet)
+	}
+	if len(decoded.WithdrawnBetChanges) != 1 {
+		t.Fatalf("Expected the change to the withdrawn bet, but got %+v", decoded.WithdrawnBetChanges)
+	}
+	if change := decoded.WithdrawnBetChanges[0]; change.PollID != withdrawn.GetID() || change.Kind != "WITHDRAWN" || change.PreviousOptionIndex != 1 {
+		t.Errorf("Expected the withdrawal of the bet on Blue, but got %+v", change)
+	}
+	var balance int64
+	for _, entry := range decoded.Ledger {
+		balance += entry.Amount
+	}
+	if len(decoded.Ledger) == 0 || balance != 90 {
+		t.Errorf("Expected the ledger to add up to a balance of 90, but got %d from %+v", balance, decoded.Ledger)
+	}
+	expectedWallets := []ExportedWallet{{GuildID: "guild", Balance: 90}}
+	if !slices.Equal(decoded.Wallets, expectedWallets) {
+		t.Errorf("Expected wallets %+v, but got %+v", expectedWallets, decoded.Wallets)
+	}
+	if len(decoded.Polls) != 1 {
+		t.Fatalf("Expected the poll the user created, but got %+v", decoded.Polls)
+	}
+	if created := decoded.Polls[0]; created.ID != poll.GetID() || created.Title != "Who wins the final?" || !slices.Equal(created.Options, []string{"Red", "Blue"}) || created.Status != "OPEN" || created.OutcomeIndex != -1 {
+		t.Errorf("Expected the open poll Who wins the final?, but got %+v", created)
+	}
+	if len(decoded.OutcomeCorrections) != 1 {
+		t.Fatalf("Expected the correction the user made, but got %+v", decoded.OutcomeCorrections)
+	}
+	if correction := decoded.OutcomeCorrections[0]; correction.PollID != corrected.GetID() || correction.PreviousOutcomeIndex != 0 || correction.NewOutcomeIndex != 1 {
+		t.Errorf("Expected the correction from Red to Blue, but got %+v", correction)
+	}
+	if decoded.Stats.TotalBets != 1 || decoded.Stats.Pending != 1 {
+		t.Errorf("Expected stats of 1 pending bet, but got %+v", decoded.Stats)
+	}
+}
+
+func TestExportDataWithoutLedger(t *testing.T) {
+	t.Parallel()
+	pollService := polls.NewService(polls.NewMemoryRepository())
+	betService := bets.NewService(pollService, bets.NewMemoryRepository(), nil, bets.PayoutCalculator{}, storage.NewMemoryUnitOfWork())
+	userService := NewService(NewMemoryRepository(), pollService, betService, nil)
+
+	user, err := userService.CreateUser(t.Context(), Identity{Provider: "discord", ExternalID: "123"})
+	if err != nil {
+		t.Fatalf("CreateUser returned an unexpected error: %v", err)
+	}
+
+	export, err := userService.ExportData(t.Context(), user.GetID())
+	if err != nil {
+		t.Fatalf("ExportData returned an unexpected error: %v", err)
+	}
+	encoded, err := json.Marshal(export)
+	if err != nil {
+		t.Fatalf("Failed to encode the export: %v", err)
+	}
+	if strings.Contains(string(encoded), `"ledger"`) {
+		t.Errorf("Expected no ledger without a wallet, but got %s", encoded)
+	}
+	if strings.Contains(string(encoded), `"wallets"`) {
+		t.Errorf("Expected no wallets without a wallet service, but got %s", encoded)
+	}
+	for _, section := range []string{`"bets":[]`, `"withdrawn_bet_changes":[]`, `"polls":[]`, `"outcome_corrections":[]`} {
+		if !strings.Contains(string(encoded), section) {
+			t.Errorf("Expected %s in the export, but got %s", section, encoded)
+		}
+	}
+
+	if _, err := userService.ExportData(t.Context(), "missing"); !errors.Is(err, ErrUserNotFound) {
+		t.Errorf("Expected exporting a missing user to return '%v', but got '%v'", ErrUserNotFound, err)
+	}
+}
@@ -21,6 +21,41 @@ type WinLoss struct {
 	Losses int
 }
 
+// UserStats is a user's betting profile.
+type UserStats struct {
+	TotalBets int
+	Wins      int
+	Losses    int
+	Pending   int
+	Voided    int
+	// Points is the net number of points won or lost on settled bets.
+	Points int64
+	// CurrentStreak is the number of bets won in a row up to the latest
+	// settled bet. LongestStreak is the most ever won in a row. Voided bets
+	// neither extend nor break a streak.
+	CurrentStreak int
+	LongestStreak int
+	// FavouriteCategories are the categories the user bet on most, most
+	// frequent first.
+	FavouriteCategories []CategoryCount
+	// Rank is the user's position on the leaderboard by wins, or 0 while they
+	// have no settled bets. RankedUsers is the number of users on it.
+	Rank        int
+	RankedUsers int
+}
+
+func (stats *UserStats) WinRate() float64 {
+	if stats.Wins+stats.Losses == 0 {
+		return 0
+	}
+	return float64(stats.Wins) / float64(stats.Wins+stats.Losses)
+}
+
+type CategoryCount struct {
+	Category string
+	Bets     int
+}
+
 type Identity struct {
 	Provider   string
 	ExternalID string
@@ -0,0 +1,71 @@
+package wallet
+
+import (
+	"context"
+	"errors"
+
+	"betting-discord-bot/internal/storage"
+)
+
+// WalletService moves a user's points within one guild. Each user has a
+// separate wallet in every guild they bet in.
+type WalletService interface {
+	// GetWallet returns the user's wallet in the guild, opening it with the starting balance on first use.
+	GetWallet(ctx context.Context, guildID, userID string) (Wallet, error)
+	// OpenWallet returns the user's wallet in the guild, opening it with the
+	// given starting balance rather than the default if this is its first use.
+	OpenWallet(ctx context.Context, guildID, userID string, startingBalance int64) (Wallet, error)
+	// GetWallets returns the wallets the user has opened in every guild,
+	// without opening any.
+	GetWallets(ctx context.Context, userID string) ([]Wallet, error)
+	// Debit takes points from the user. It fails with *InsufficientBalanceError
+	// rather than letting the balance go negative.
+	Debit(ctx context.Context, guildID, userID string, amount int64, reason Reason) error
+	// Credit gives points to the user.
+	Credit(ctx context.Context, guildID, userID string, amount int64, reason Reason) error
+	// Clawback takes back points that were credited in error, such as winnings
+	// from an outcome that was later corrected. The balance may go negative.
+	Clawback(ctx context.Context, guildID, userID string, amount int64, reason Reason) error
+	// GetLedger returns every entry on the user's accounts in every guild,
+	// oldest first.
+	GetLedger(ctx context.Context, userID string) ([]LedgerEntry, error)
+	// Reconcile checks that the ledger balances and that every wallet holds
+	// exactly what its ledger entries add up to.
+	Reconcile(ctx context.Context) ([]Discrepancy, error)
+	// WithTx returns the service with its changes made as part of the unit of work.
+	WithTx(tx *storage.Tx) WalletService
+}
+
+// WalletRepository stores wallets and the ledger behind them. Every change to
+// a balance is written together with its ledger entries, so the two cannot
+// drift apart.
+type WalletRepository interface {
+	LedgerRepository
+	// WithTx returns the repository with its reads and writes made as part of
+	// the unit of work.
+	WithTx(tx *storage.Tx) WalletRepository
+	Save(ctx context.Context, wallet *wallet, entries []LedgerEntry) error
+	GetByUserID(ctx context.Context, guildID, userID string) (*wallet, error)
+	GetAll(ctx context.Context) ([]*wallet, error)
+	// GetAllByUserID returns the user's wallets in every guild, ordered by guild.
+	GetAllByUserID(ctx context.Context, userID string) ([]*wallet, error)
+	// Debit subtracts the amount only if the balance covers it, returning
+	// *InsufficientBalanceError otherwise.
+	Debit(ctx context.Context, guildID, userID string, amount int64, entries []LedgerEntry) error
+	// Adjust adds the amount, which may be negative, to the balance.
+	Adjust(ctx context.Context, guildID, userID string, amount int64, entries []LedgerEntry) error
+}
+
+// LedgerRepository reads the append-only ledger. Entries are only ever written
+// by the WalletRepository alongside the balance change they record.
+type LedgerRepository interface {
+	GetEntriesByUserID(ctx context.Context, userID string) ([]LedgerEntry, error)
+	GetEntriesByPollID(ctx context.Context, pollID string) ([]LedgerEntry, error)
+	// GetAccountBalances adds up the entries of every account.
+	GetAccountBalances(ctx context.Context) (map[string]int64, error)
+}
+
+var ErrWalletNotFound = errors.New("wallet not found")
+var ErrWalletAlreadyExists = errors.New("wallet already exists")
+var ErrInvalidAmount = errors.New("amount must be positive")
+var ErrUnbalancedLedger = errors.New("ledger entries do not add up to zero")
@@ -0,0 +1,225 @@
+package wallet
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"betting-discord-bot/internal/storage"
+)
+
+type libSQLRepository struct {
+	db storage.DBTX
+}
+
+func NewLibSQLRepository(db *sql.DB) WalletRepository {
+	return &libSQLRepository{db: db}
+}
+
+func (repo *libSQLRepository) WithTx(tx *storage.Tx) WalletRepository {
+	return &libSQLRepository{db: tx.Conn(repo.db)}
+}
+
+func (repo *libSQLRepository) Save(ctx context.Context, wallet *wallet, entries []LedgerEntry) error {
+	return storage.InTransaction(ctx, repo.db, func(transaction storage.DBTX) error {
+		query := "INSERT INTO wallets (guild_id, user_id, balance) VALUES (?, ?, ?) ON CONFLICT (guild_id, user_id) DO NOTHING"
+		result, err := transaction.ExecContext(ctx, query, wallet.GuildID, wallet.UserID, wallet.Balance)
+		if err != nil {
+			return fmt.Errorf("error while saving wallet: %w", err)
+		}
+
+		rowsAffected, err := result.RowsAffected()
+		if err != nil {
+			return fmt.Errorf("error while getting rows affected: %w", err)
+		}
+		if rowsAffected == 0 {
+			return ErrWalletAlreadyExists
+		}
+
+		if err := insertEntries(ctx, transaction, entries); err != nil {
+			return err
+		}
+
+		return nil
+	})
+}
+
+func (repo *libSQLRepository) GetByUserID(ctx context.Context, guildID, userID string) (*wallet, error) {
+	query := "SELECT guild_id, user_id, balance FROM wallets WHERE guild_id = ? AND user_id = ?"
+	row := repo.db.QueryRowContext(ctx, query, guildID, userID)
+
+	var wallet wallet
+	if err := row.Scan(&wallet.GuildID, &wallet.UserID, &wallet.Balance); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrWalletNotFound
+		}
+		return nil, fmt.Errorf("error while scanning wallet: %w", err)
+	}
+
+	return &wallet, nil
+}
+
+func (repo *libSQLRepository) GetAll(ctx context.Context) ([]*wallet, error) {
+	rows, err := repo.db.QueryContext(ctx, "SELECT guild_id, user_id, balance FROM wallets")
+	if err != nil {
+		return nil, fmt.Errorf("error while executing query: %w", err)
+	}
+	return scanWallets(rows)
+}
+
+func (repo *libSQLRepository) GetAllByUserID(ctx context.Context, userID string) ([]*wallet, error) {
+	rows, err := repo.db.QueryContext(ctx, "SELECT guild_id, user_id, balance FROM wallets WHERE user_id = ? ORDER BY guild_id", userID)
+	if err != nil {
+		return nil, fmt.Errorf("error while executing query: %w", err)
+	}
+	return scanWallets(rows)
+}
+
+func scanWallets(rows *sql.Rows) ([]*wallet, error) {
+	defer rows.Close()
+
+	var wallets []*wallet
+	for rows.Next() {
+		var wallet wallet
+		if err := rows.Scan(&wallet.GuildID, &wallet.UserID, &wallet.Balance); err != nil {
+			return nil, fmt.Errorf("error while scanning wallet: %w", err)
+		}
+		wallets = append(wallets, &wallet)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error during row iteration: %w", err)
+	}
+
+	return wallets, nil
+}
+
+func (repo *libSQLRepository) Debit(ctx context.Context, guildID, userID string, amount int64, entries []LedgerEntry) error {
+	return storage.InTransaction(ctx, repo.db, func(transaction storage.DBTX) error {
+		// The balance check and the update happen in one statement so concurrent
+		// debits cannot overdraw the wallet.
+		query := "UPDATE wallets SET balance = balance - ? WHERE guild_id = ? AND user_id = ? AND balance >= ?"
+		result, err := transaction.ExecContext(ctx, query, amount, guildID, userID, amount)
+		if err != nil {
+			return fmt.Errorf("error while debiting wallet: %w", err)
+		}
+
+		rowsAffected, err := result.RowsAffected()
+		if err != nil {
+			return fmt.Errorf("error while getting rows affected: %w", err)
+		}
+		if rowsAffected == 0 {
+			wallet, err := (&libSQLRepository{db: transaction}).GetByUserID(ctx, guildID, userID)
+			if err != nil {
+				return err
+			}
+			return &InsufficientBalanceError{Balance: wallet.Balance, Amount: amount}
+		}
+
+		if err := insertEntries(ctx, transaction, entries); err != nil {
+			return err
+		}
+
+		return nil
+	})
+}
+
+func (repo *libSQLRepository) Adjust(ctx context.Context, guildID, userID string, amount int64, entries []LedgerEntry) error {
+	return storage.InTransaction(ctx, repo.db, func(transaction storage.DBTX) error {
+		query := "UPDATE wallets SET balance = balance + ? WHERE guild_id = ? AND user_id = ?"
+		result, err := transaction.ExecContext(ctx, query, amount, guildID, userID)
+		if err != nil {
+			return fmt.Errorf("error while adjusting wallet: %w", err)
+		}
+
+		rowsAffected, err := result.RowsAffected()
+		if err != nil {
+			return fmt.Errorf("error while getting rows affected: %w", err)
+		}
+		if rowsAffected == 0 {
+			return ErrWalletNotFound
+		}
+
+		if err := insertEntries(ctx, transaction, entries); err != nil {
+			return err
+		}
+
+		return nil
+	})
+}
+
+func insertEntries(ctx context.Context, transaction storage.DBTX, entries []LedgerEntry) error {
+	query := `INSERT INTO ledger_entries (transaction_id, account, guild_id, user_id, poll_id, kind, amount, memo, created_at)
+              VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`
+
+	for _, entry := range entries {
+		if _, err := transaction.ExecContext(ctx, query, entry.TransactionID, entry.Account, entry.GuildID, entry.UserID, entry.PollID, entry.Kind, entry.Amount, entry.Memo, entry.CreatedAt.UnixMilli()); err != nil {
+			return fmt.Errorf("error while inserting ledger entry: %w", err)
+		}
+	}
+
+	return nil
+}
+
+func (repo *libSQLRepository) GetEntriesByUserID(ctx context.Context, userID string) ([]LedgerEntry, error) {
+	return repo.queryEntries(ctx, "WHERE user_id = ?", userID)
+}
+
+func (repo *libSQLRepository) GetEntriesByPollID(ctx context.Context, pollID string) ([]LedgerEntry, error) {
+	return repo.queryEntries(ctx, "WHERE poll_id = ?", pollID)
+}
+
+func (repo *libSQLRepository) queryEntries(ctx context.Context, where string, args ...any) ([]LedgerEntry, error) {
+	query := `SELECT id, transaction_id, account, guild_id, user_id, poll_id, kind, amount, memo, created_at
+              FROM ledger_entries ` + where + ` ORDER BY id`
+	rows, err := repo.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("error while executing query: %w", err)
+	}
+	defer rows.Close()
+
+	var entries []LedgerEntry
+	for rows.Next() {
+		var entry LedgerEntry
+		var createdAt int64
+		if err := rows.Scan(&entry.ID, &entry.TransactionID, &entry.Account, &entry.GuildID, &entry.UserID, &entry.PollID, &entry.Kind, &entry.Amount, &entry.Memo, &createdAt); err != nil {
+			return nil, fmt.Errorf("error while scanning row: %w", err)
+		}
+		entry.CreatedAt = time.UnixMilli(createdAt)
+		entries = append(entries, entry)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error during row iteration: %w", err)
+	}
+
+	return entries, nil
+}
+
+func (repo *libSQLRepository) GetAccountBalances(ctx context.Context) (map[string]int64, error) {
+	rows, err := repo.db.QueryContext(ctx, "SELECT account, SUM(amount) FROM ledger_entries GROUP BY account")
+	if err != nil {
+		return nil, fmt.Errorf("error while executing query: %w", err)
+	}
+	defer rows.Close()
+
+	balances := make(map[string]int64)
+	for rows.Next() {
+		var account string
+		var balance int64
+		if err := rows.Scan(&account, &balance); err != nil {
+			return nil, fmt.Errorf("error while scanning row: %w", err)
+		}
+		balances[account] = balance
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error during row iteration: %w", err)
+	}
+
+	return balances, nil
+}
+
+var _ WalletRepository = (*libSQLRepository)(nil)
@@ -0,0 +1,224 @@
+package wallet
+
+import (
+	"context"
+	"sort"
+	"sync"
+
+	"betting-discord-bot/internal/storage"
+)
+
+type memoryRepository struct {
+	mu          sync.Mutex
+	wallets     map[walletKey]*wallet
+	entries     []LedgerEntry
+	nextEntryID int64
+}
+
+type walletKey struct {
+	GuildID string
+	UserID  string
+}
+
+func NewMemoryRepository() WalletRepository {
+	return &memoryRepository{
+		wallets:     make(map[walletKey]*wallet),
+		nextEntryID: 1,
+	}
+}
+
+// WithTx snapshots the wallets, so that their balances and ledger entries are
+// put back if the unit of work is rolled back.
+func (repo *memoryRepository) WithTx(tx *storage.Tx) WalletRepository {
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+
+	wallets := make(map[walletKey]wallet, len(repo.wallets))
+	for key, stored := range repo.wallets {
+		wallets[key] = *stored
+	}
+	entryCount := len(repo.entries)
+	nextEntryID := repo.nextEntryID
+
+	tx.OnRollback(func() {
+		repo.mu.Lock()
+		defer repo.mu.Unlock()
+
+		clear(repo.wallets)
+		for key, snapshot := range wallets {
+			stored := snapshot
+			repo.wallets[key] = &stored
+		}
+		repo.entries = repo.entries[:entryCount]
+		repo.nextEntryID = nextEntryID
+	})
+	return repo
+}
+
+func (repo *memoryRepository) Save(ctx context.Context, wallet *wallet, entries []LedgerEntry) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+
+	key := walletKey{wallet.GuildID, wallet.UserID}
+	if _, exists := repo.wallets[key]; exists {
+		return ErrWalletAlreadyExists
+	}
+
+	stored := *wallet
+	repo.wallets[key] = &stored
+	repo.appendEntries(entries)
+	return nil
+}
+
+func (repo *memoryRepository) GetByUserID(ctx context.Context, guildID, userID string) (*wallet, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+
+	stored, exists := repo.wallets[walletKey{guildID, userID}]
+	if !exists {
+		return nil, ErrWalletNotFound
+	}
+
+	wallet := *stored
+	return &wallet, nil
+}
+
+func (repo *memoryRepository) GetAll(ctx context.Context) ([]*wallet, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+
+	wallets := make([]*wallet, 0, len(repo.wallets))
+	for _, stored := range repo.wallets {
+		wallet := *stored
+		wallets = append(wallets, &wallet)
+	}
+	return wallets, nil
+}
+
+func (repo *memoryRepository) GetAllByUserID(ctx context.Context, userID string) ([]*wallet, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+
+	var wallets []*wallet
+	for key, stored := range repo.wallets {
+		if key.UserID == userID {
+			wallet := *stored
+			wallets = append(wallets, &wallet)
+		}
+	}
+	sort.Slice(wallets, func(i, j int) bool {
+		return wallets[i].GuildID < wallets[j].GuildID
+	})
+	return wallets, nil
+}
+
+func (repo *memoryRepository) Debit(ctx context.Context, guildID, userID string, amount int64, entries []LedgerEntry) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+
+	stored, exists := repo.wallets[walletKey{guildID, userID}]
+	if !exists {
+		return ErrWalletNotFound
+	}
+
+	if stored.Balance < amount {
+		return &InsufficientBalanceError{Balance: stored.Balance, Amount: amount}
+	}
+
+	stored.Balance -= amount
+	repo.appendEntries(entries)
+	return nil
+}
+
+func (repo *memoryRepository) Adjust(ctx context.Context, guildID, userID string, amount int64, entries []LedgerEntry) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+
+	stored, exists := repo.wallets[walletKey{guildID, userID}]
+	if !exists {
+		return ErrWalletNotFound
+	}
+
+	stored.Balance += amount
+	repo.appendEntries(entries)
+	return nil
+}
+
+// appendEntries must be called with the lock held.
+func (repo *memoryRepository) appendEntries(entries []LedgerEntry) {
+	for _, entry := range entries {
+		entry.ID = repo.nextEntryID
+		repo.nextEntryID++
+		repo.entries = append(repo.entries, entry)
+	}
+}
+
+func (repo *memoryRepository) GetEntriesByUserID(ctx context.Context, userID string) ([]LedgerEntry, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	return repo.filterEntries(func(entry LedgerEntry) bool { return entry.UserID == userID }), nil
+}
+
+func (repo *memoryRepository) GetEntriesByPollID(ctx context.Context, pollID string) ([]LedgerEntry, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	return repo.filterEntries(func(entry LedgerEntry) bool { return entry.PollID == pollID }), nil
+}
+
+func (repo *memoryRepository) filterEntries(matches func(entry LedgerEntry) bool) []LedgerEntry {
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+
+	var entries []LedgerEntry
+	for _, entry := range repo.entries {
+		if matches(entry) {
+			entries = append(entries, entry)
+		}
+	}
+	return entries
+}
+
+func (repo *memoryRepository) GetAccountBalances(ctx context.Context) (map[string]int64, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+
+	balances := make(map[string]int64)
+	for _, entry := range repo.entries {
+		balances[entry.Account] += entry.Amount
+	}
+	return balances, nil
+}
+
+var _ WalletRepository = (*memoryRepository)(nil)
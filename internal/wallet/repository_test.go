@@ -0,0 +1,484 @@
+package wallet
+
+import (
+	"context"
+	"errors"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"betting-discord-bot/internal/storage"
+)
+
+func setupLibSQL(t *testing.T) (WalletRepository, func()) {
+	t.Helper()
+
+	// Sanitize the test name to create a clean, unique filename for each test run.
+	sanitizedTestName := strings.ReplaceAll(t.Name(), "/", "_")
+	dbPath := sanitizedTestName + ".db"
+
+	// Remove any old database file from a previous failed run.
+	_ = os.Remove(dbPath)
+
+	db, err := storage.InitializeDatabase(dbPath, "")
+	if err != nil {
+		t.Fatalf("Failed to initialize test database: %v", err)
+	}
+
+	repo := NewLibSQLRepository(db)
+
+	teardown := func() {
+		if err := db.Close(); err != nil {
+			t.Fatal("failed to close database")
+		}
+		if err := os.Remove(dbPath); err != nil {
+			t.Fatal("failed to remove database file")
+		}
+	}
+
+	return repo, teardown
+}
+
+func setupInMemory(t *testing.T) (WalletRepository, func()) {
+	t.Helper()
+
+	repo := NewMemoryRepository()
+	teardown := func() {
+		// No cleanup needed for the in-memory version
+	}
+	return repo, teardown
+}
+
+func TestWalletRepositoryImplementations(t *testing.T) {
+	t.Parallel()
+	implementations := []struct {
+		name  string
+		setup func(t *testing.T) (WalletRepository, func())
+	}{
+		{name: "InMemoryRepository", setup: setupInMemory},
+		{name: "LibSQLRepository", setup: setupLibSQL},
+	}
+
+	testCases := []struct {
+		name string
+		run  func(t *testing.T, repo WalletRepository)
+	}{
+		{"it should save and get a wallet", testSaveAndGet},
+		{"it should not save a wallet twice", testSaveTwice},
+		{"it should return an error for a missing wallet", testGetMissing},
+		{"it should debit a wallet that covers the amount", testDebit},
+		{"it should reject a debit larger than the balance", testDebitInsufficientBalance},
+		{"it should adjust a wallet below zero", testAdjust},
+		{"it should list every wallet", testGetAll},
+		{"it should list the wallets of a user", testGetAllByUserID},
+		{"it should record ledger entries with each balance change", testLedgerEntries},
+		{"it should not record ledger entries for a rejected debit", testRejectedDebitLedger},
+		{"it should get ledger entries by poll", testLedgerEntriesByPoll},
+		{"it should add up ledger balances per account", testAccountBalances},
+		{"it should stop once the context is cancelled", testCancelledContext},
+	}
+
+	for _, impl := range implementations {
+		t.Run(impl.name, func(t *testing.T) {
+			t.Parallel()
+
+			for _, tc := range testCases {
+				t.Run(tc.name, func(t *testing.T) {
+					t.Parallel()
+
+					repo, cleanup := impl.setup(t)
+					t.Cleanup(cleanup)
+
+					// Run the actual test logic.
+					tc.run(t, repo)
+				})
+			}
+		})
+	}
+}
+
+func saveTestWallet(t *testing.T, repo WalletRepository, balance int64) *wallet {
+	t.Helper()
+
+	wallet := &wallet{GuildID: testGuildID, UserID: "user", Balance: balance}
+	if err := repo.Save(t.Context(), wallet, testTransaction("user", balance, Reason{Kind: Grant})); err != nil {
+		t.Fatalf("Save() returned an unexpected error: %v", err)
+	}
+	return wallet
+}
+
+// testTransaction builds the two entries of a transaction with a fixed time,
+// which survives the round trip through storage.
+func testTransaction(userID string, amount int64, reason Reason) []LedgerEntry {
+	entries := newTransaction(testGuildID, userID, amount, reason)
+	for index := range entries {
+		entries[index].CreatedAt = time.UnixMilli(1_700_000_000_000)
+	}
+	return entries
+}
+
+func assertBalance(t *testing.T, repo WalletRepository, userID string, expected int64) {
+	t.Helper()
+
+	retrievedWallet, err := repo.GetByUserID(t.Context(), testGuildID, userID)
+	if err != nil {
+		t.Fatalf("GetByUserID() returned an unexpected error: %v", err)
+	}
+	if retrievedWallet.Balance != expected {
+		t.Errorf("Expected balance %d, but got %d", expected, retrievedWallet.Balance)
+	}
+}
+
+func testSaveAndGet(t *testing.T, repo WalletRepository) {
+	wallet := saveTestWallet(t, repo, 100)
+
+	assertBalance(t, repo, wallet.UserID, 100)
+}
+
+func testSaveTwice(t *testing.T, repo WalletRepository) {
+	wallet := saveTestWallet(t, repo, 100)
+
+	err := repo.Save(t.Context(), wallet, nil)
+	if !errors.Is(err, ErrWalletAlreadyExists) {
+		t.Errorf("Expected error '%v', but got '%v'", ErrWalletAlreadyExists, err)
+	}
+}
+
+func testGetMissing(t *testing.T, repo WalletRepository) {
+	_, err := repo.GetByUserID(t.Context(), testGuildID, "missing")
+	if !errors.Is(err, ErrWalletNotFound) {
+		t.Errorf("Expected error '%v', but got '%v'", ErrWalletNotFound, err)
+	}
+}
+
+func testDebit(t *testing.T, repo WalletRepository) {
+	wallet := saveTestWallet(t, repo, 100)
+
+	if err := repo.Debit(t.Context(), testGuildID, wallet.UserID, 100, testTransaction(wallet.UserID, -100, Reason{Kind: Stake, PollID: "poll"})); err != nil {
+		t.Fatalf("Debit() returned an unexpected error: %v", err)
+	}
+
+	assertBalance(t, repo, wallet.UserID, 0)
+}
+
+func testDebitInsufficientBalance(t *testing.T, repo WalletRepository) {
+	wallet := saveTestWallet(t, repo, 100)
+
+	err := repo.Debit(t.Context(), testGuildID, wallet.UserID, 101, testTransaction(wallet.UserID, -101, Reason{Kind: Stake, PollID: "poll"}))
+
+	var insufficientBalance *InsufficientBalanceError
+	if !errors.As(err, &insufficientBalance) {
+		t.Fatalf("Expected an InsufficientBalanceError, but got '%v'", err)
+	}
+	if insufficientBalance.Balance != 100 || insufficientBalance.Amount != 101 {
+		t.Errorf("Expected balance 100 and amount 101, but got %+v", insufficientBalance)
+	}
+
+	assertBalance(t, repo, wallet.UserID, 100)
+}
+
+func testAdjust(t *testing.T, repo WalletRepository) {
+	wallet := saveTestWallet(t, repo, 100)
+
+	if err := repo.Adjust(t.Context(), testGuildID, wallet.UserID, 50, testTransaction(wallet.UserID, 50, Reason{Kind: Adjustment})); err != nil {
+		t.Fatalf("Adjust() returned an unexpected error: %v", err)
+	}
+	if err := repo.Adjust(t.Context(), testGuildID, wallet.UserID, -200, testTransaction(wallet.UserID, -200, Reason{Kind: Adjustment})); err != nil {
+		t.Fatalf("Adjust() returned an unexpected error: %v", err)
+	}
+
+	assertBalance(t, repo, wallet.UserID, -50)
+
+	if err := repo.Adjust(t.Context(), testGuildID, "missing", 10, testTransaction("missing", 10, Reason{Kind: Adjustment})); !errors.Is(err, ErrWalletNotFound) {
+		t.Errorf("Expected error '%v', but got '%v'", ErrWalletNotFound, err)
+	}
+}
+
+func testGetAll(t *testing.T, repo WalletRepository) {
+	for _, userID := range []string{"first", "second"} {
+		if err := repo.Save(t.Context(), &wallet{GuildID: testGuildID, UserID: userID, Balance: 10}, nil); err != nil {
+			t.Fatalf("Save() returned an unexpected error: %v", err)
+		}
+	}
+
+	wallets, err := repo.GetAll(t.Context())
+	if err != nil {
+		t.Fatalf("GetAll() returned an unexpected error: %v", err)
+	}
+	if len(wallets) != 2 {
+		t.Errorf("Expected 2 wallets, but got %d", len(wallets))
+	}
+}
+
+func testGetAllByUserID(t *testing.T, repo WalletRepository) {
+	for _, saved := range []*wallet{
+		{GuildID: "second", UserID: "user", Balance: 20},
+		{GuildID: "first", UserID: "user", Balance: 10},
+		{GuildID: "first", UserID: "other", Balance: 30},
+	} {
+		if err := repo.Save(t.Context(), saved, nil); err != nil {
+			t.Fatalf("Save() returned an unexpected error: %v", err)
+		}
+	}
+
+	wallets, err := repo.GetAllByUserID(t.Context(), "user")
+	if err != nil {
+		t.Fatalf("GetAllByUserID() returned an unexpected error: %v", err)
+	}
+	if len(wallets) != 2 || *wallets[0] != (wallet{GuildID: "first", UserID: "user", Balance: 10}) || *wallets[1] != (wallet{GuildID: "second", UserID: "user", Balance: 20}) {
+		t.Errorf("Expected the user's wallets in guild order, but got %+v", wallets)
+	}
+}
+
+func testLedgerEntries(t *testing.T, repo WalletRepository) {
+	grant := testTransaction("user", 100, Reason{Kind: Grant})
+	if err := repo.Save(t.Context(), &wallet{GuildID: testGuildID, UserID: "user", Balance: 100}, grant); err != nil {
+		t.Fatalf("Save() returned an unexpected error: %v", err)
+	}
+	stake := testTransaction("user", -30, Reason{Kind: Stake, PollID: "poll", Memo: "bet on option 1"})
+	if err := repo.Debit(t.Context(), testGuildID, "user", 30, stake); err != nil {
+		t.Fatalf("Debit() returned an unexpected error: %v", err)
+	}
+
+	entries, err := repo.GetEntriesByUserID(t.Context(), "user")
+	if err != nil {
+		t.Fatalf("GetEntriesByUserID() returned an unexpected error: %v", err)
+	}
+
+	expected := append(grant, stake...)
+	if len(entries) != len(expected) {
+		t.Fatalf("Expected %d ledger entries, but got %d", len(expected), len(entries))
+	}
+	for index, entry := range entries {
+		if entry.ID == 0 {
+			t.Errorf("Expected entry %d to have an ID", index)
+		}
+		if index > 0 && entry.ID <= entries[index-1].ID {
+			t.Errorf("Expected entries in the order they were written, but got IDs %d then %d", entries[index-1].ID, entry.ID)
+		}
+
+		entry.ID = 0
+		if entry != expected[index] {
+			t.Errorf("Expected entry %+v, but got %+v", expected[index], entry)
+		}
+	}
+
+	if balance := ReplayBalance(entries, UserAccount(testGuildID, "user")); balance != 70 {
+		t.Errorf("Expected the replayed balance to be 70, but got %d", balance)
+	}
+}
+
+func testRejectedDebitLedger(t *testing.T, repo WalletRepository) {
+	saveTestWallet(t, repo, 100)
+
+	_ = repo.Debit(t.Context(), testGuildID, "user", 500, testTransaction("user", -500, Reason{Kind: Stake, PollID: "poll"}))
+
+	entries, err := repo.GetEntriesByPollID(t.Context(), "poll")
+	if err != nil {
+		t.Fatalf("GetEntriesByPollID() returned an unexpected error: %v", err)
+	}
+	if len(entries) != 0 {
+		t.Errorf("Expected no ledger entries for the rejected debit, but got %d", len(entries))
+	}
+}
+
+func testLedgerEntriesByPoll(t *testing.T, repo WalletRepository) {
+	for _, userID := range []string{"first", "second"} {
+		if err := repo.Save(t.Context(), &wallet{GuildID: testGuildID, UserID: userID, Balance: 100}, testTransaction(userID, 100, Reason{Kind: Grant})); err != nil {
+			t.Fatalf("Save() returned an unexpected error: %v", err)
+		}
+		if err := repo.Debit(t.Context(), testGuildID, userID, 10, testTransaction(userID, -10, Reason{Kind: Stake, PollID: "poll"})); err != nil {
+			t.Fatalf("Debit() returned an unexpected error: %v", err)
+		}
+	}
+	if err := repo.Debit(t.Context(), testGuildID, "first", 10, testTransaction("first", -10, Reason{Kind: Stake, PollID: "otherPoll"})); err != nil {
+		t.Fatalf("Debit() returned an unexpected error: %v", err)
+	}
+
+	entries, err := repo.GetEntriesByPollID(t.Context(), "poll")
+	if err != nil {
+		t.Fatalf("GetEntriesByPollID() returned an unexpected error: %v", err)
+	}
+	if len(entries) != 4 {
+		t.Fatalf("Expected 4 ledger entries for the poll, but got %d", len(entries))
+	}
+	if balance := ReplayBalance(entries, PollAccount("poll")); balance != 20 {
+		t.Errorf("Expected 20 points staked on the poll, but got %d", balance)
+	}
+}
+
+func testAccountBalances(t *testing.T, repo WalletRepository) {
+	saveTestWallet(t, repo, 100)
+	if err := repo.Debit(t.Context(), testGuildID, "user", 40, testTransaction("user", -40, Reason{Kind: Stake, PollID: "poll"})); err != nil {
+		t.Fatalf("Debit() returned an unexpected error: %v", err)
+	}
+
+	balances, err := repo.GetAccountBalances(t.Context())
+	if err != nil {
+		t.Fatalf("GetAccountBalances() returned an unexpected error: %v", err)
+	}
+
+	expected := map[string]int64{
+		UserAccount(testGuildID, "user"): 60,
+		PollAccount("poll"):              40,
+		HouseAccount:                     -100,
+	}
+	if len(balances) != len(expected) {
+		t.Errorf("Expected balances %v, but got %v", expected, balances)
+	}
+	for account, balance := range expected {
+		if balances[account] != balance {
+			t.Errorf("Expected %s to hold %d, but got %d", account, balance, balances[account])
+		}
+	}
+}
+
+func setupLibSQLWithUnitOfWork(t *testing.T) (WalletRepository, storage.UnitOfWork, func()) {
+	t.Helper()
+
+	sanitizedTestName := strings.ReplaceAll(t.Name(), "/", "_")
+	dbPath := sanitizedTestName + ".db"
+	_ = os.Remove(dbPath)
+
+	db, err := storage.InitializeDatabase(dbPath, "")
+	if err != nil {
+		t.Fatalf("Failed to initialize test database: %v", err)
+	}
+
+	teardown := func() {
+		if err := db.Close(); err != nil {
+			t.Fatal("failed to close database")
+		}
+		if err := os.Remove(dbPath); err != nil {
+			t.Fatal("failed to remove database file")
+		}
+	}
+
+	return NewLibSQLRepository(db), storage.NewLibSQLUnitOfWork(db), teardown
+}
+
+func setupInMemoryWithUnitOfWork(t *testing.T) (WalletRepository, storage.UnitOfWork, func()) {
+	t.Helper()
+
+	return NewMemoryRepository(), storage.NewMemoryUnitOfWork(), func() {}
+}
+
+// TestWalletUnitOfWorkImplementations covers changing balances as part of a
+// unit of work, which needs a unit of work backed by the same storage.
+func TestWalletUnitOfWorkImplementations(t *testing.T) {
+	t.Parallel()
+	implementations := []struct {
+		name  string
+		setup func(t *testing.T) (WalletRepository, storage.UnitOfWork, func())
+	}{
+		{name: "InMemoryRepository", setup: setupInMemoryWithUnitOfWork},
+		{name: "LibSQLRepository", setup: setupLibSQLWithUnitOfWork},
+	}
+
+	testCases := []struct {
+		name string
+		run  func(t *testing.T, repo WalletRepository, unitOfWork storage.UnitOfWork)
+	}{
+		{"it should keep the balance changes of a unit of work", testUnitOfWorkCommit},
+		{"it should undo the balance changes of a failed unit of work", testUnitOfWorkRollback},
+	}
+
+	for _, impl := range implementations {
+		t.Run(impl.name, func(t *testing.T) {
+			t.Parallel()
+
+			for _, tc := range testCases {
+				t.Run(tc.name, func(t *testing.T) {
+					t.Parallel()
+
+					repo, unitOfWork, cleanup := impl.setup(t)
+					t.Cleanup(cleanup)
+
+					tc.run(t, repo, unitOfWork)
+				})
+			}
+		})
+	}
+}
+
+func testUnitOfWorkCommit(t *testing.T, repo WalletRepository, unitOfWork storage.UnitOfWork) {
+	saveTestWallet(t, repo, 100)
+
+	err := unitOfWork.Do(t.Context(), func(tx *storage.Tx) error {
+		return repo.WithTx(tx).Debit(t.Context(), testGuildID, "user", 30, testTransaction("user", -30, Reason{Kind: Stake, PollID: "poll"}))
+	})
+	if err != nil {
+		t.Fatalf("Do() returned an unexpected error: %v", err)
+	}
+
+	assertBalance(t, repo, "user", 70)
+	if entries, _ := repo.GetEntriesByPollID(t.Context(), "poll"); len(entries) != 2 {
+		t.Errorf("Expected the stake to be on the ledger, but got %+v", entries)
+	}
+}
+
+func testUnitOfWorkRollback(t *testing.T, repo WalletRepository, unitOfWork storage.UnitOfWork) {
+	saveTestWallet(t, repo, 100)
+	entriesBefore, err := repo.GetEntriesByUserID(t.Context(), "user")
+	if err != nil {
+		t.Fatalf("GetEntriesByUserID() returned an unexpected error: %v", err)
+	}
+
+	failure := errors.New("something went wrong")
+	err = unitOfWork.Do(t.Context(), func(tx *storage.Tx) error {
+		txRepo := repo.WithTx(tx)
+		if err := txRepo.Debit(t.Context(), testGuildID, "user", 30, testTransaction("user", -30, Reason{Kind: Stake, PollID: "poll"})); err != nil {
+			return err
+		}
+		if err := txRepo.Save(t.Context(), &wallet{GuildID: testGuildID, UserID: "otherUser", Balance: 50}, testTransaction("otherUser", 50, Reason{Kind: Grant})); err != nil {
+			return err
+		}
+		return failure
+	})
+	if !errors.Is(err, failure) {
+		t.Fatalf("Expected Do() to return the error of the unit of work, but got %v", err)
+	}
+
+	assertBalance(t, repo, "user", 100)
+	if _, err := repo.GetByUserID(t.Context(), testGuildID, "otherUser"); !errors.Is(err, ErrWalletNotFound) {
+		t.Errorf("Expected the wallet opened in the failed unit of work to be gone, but got %v", err)
+	}
+
+	entriesAfter, err := repo.GetEntriesByUserID(t.Context(), "user")
+	if err != nil {
+		t.Fatalf("GetEntriesByUserID() returned an unexpected error: %v", err)
+	}
+	if len(entriesAfter) != len(entriesBefore) {
+		t.Errorf("Expected the ledger to be left as it was, but it went from %d to %d entries", len(entriesBefore), len(entriesAfter))
+	}
+
+	// Entries written after the rollback carry on from the entries that were kept.
+	if err := repo.Adjust(t.Context(), testGuildID, "user", 5, testTransaction("user", 5, Reason{Kind: Adjustment})); err != nil {
+		t.Fatalf("Adjust() returned an unexpected error: %v", err)
+	}
+	balances, err := repo.GetAccountBalances(t.Context())
+	if err != nil {
+		t.Fatalf("GetAccountBalances() returned an unexpected error: %v", err)
+	}
+	if balances[UserAccount(testGuildID, "user")] != 105 {
+		t.Errorf("Expected the ledger to hold 105 points for the user, but got %d", balances[UserAccount(testGuildID, "user")])
+	}
+}
+
+func testCancelledContext(t *testing.T, repo WalletRepository) {
+	wallet := saveTestWallet(t, repo, 100)
+
+	ctx, cancel := context.WithCancel(t.Context())
+	cancel()
+
+	err := repo.Debit(ctx, testGuildID, wallet.UserID, 30, testTransaction(wallet.UserID, -30, Reason{Kind: Stake, PollID: "poll"}))
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected Debit() to return '%v', but got '%v'", context.Canceled, err)
+	}
+	if _, err := repo.GetByUserID(ctx, testGuildID, wallet.UserID); !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected GetByUserID() to return '%v', but got '%v'", context.Canceled, err)
+	}
+
+	assertBalance(t, repo, wallet.UserID, 100)
+}
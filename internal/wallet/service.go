@@ -0,0 +1,255 @@
+package wallet
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"betting-discord-bot/internal/storage"
+
+	"github.com/google/uuid"
+)
+
+type service struct {
+	walletRepo      WalletRepository
+	startingBalance int64
+}
+
+func NewService(walletRepo WalletRepository, startingBalance int64) WalletService {
+	return &service{
+		walletRepo:      walletRepo,
+		startingBalance: startingBalance,
+	}
+}
+
+func (s *service) WithTx(tx *storage.Tx) WalletService {
+	return &service{
+		walletRepo:      s.walletRepo.WithTx(tx),
+		startingBalance: s.startingBalance,
+	}
+}
+
+func (s *service) GetWallet(ctx context.Context, guildID, userID string) (Wallet, error) {
+	wallet, err := s.getOrOpenWallet(ctx, guildID, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	return wallet, nil
+}
+
+func (s *service) OpenWallet(ctx context.Context, guildID, userID string, startingBalance int64) (Wallet, error) {
+	if startingBalance < 0 {
+		return nil, ErrInvalidAmount
+	}
+
+	wallet, err := s.openWallet(ctx, guildID, userID, startingBalance)
+	if err != nil {
+		return nil, err
+	}
+
+	return wallet, nil
+}
+
+func (s *service) GetWallets(ctx context.Context, userID string) ([]Wallet, error) {
+	stored, err := s.walletRepo.GetAllByUserID(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get wallets: %w", err)
+	}
+
+	wallets := make([]Wallet, 0, len(stored))
+	for _, wallet := range stored {
+		wallets = append(wallets, wallet)
+	}
+	return wallets, nil
+}
+
+func (s *service) getOrOpenWallet(ctx context.Context, guildID, userID string) (*wallet, error) {
+	return s.openWallet(ctx, guildID, userID, s.startingBalance)
+}
+
+func (s *service) openWallet(ctx context.Context, guildID, userID string, startingBalance int64) (*wallet, error) {
+	existingWallet, err := s.walletRepo.GetByUserID(ctx, guildID, userID)
+	if err == nil {
+		return existingWallet, nil
+	}
+	if !errors.Is(err, ErrWalletNotFound) {
+		return nil, fmt.Errorf("failed to get wallet: %w", err)
+	}
+
+	newWallet := &wallet{
+		GuildID: guildID,
+		UserID:  userID,
+		Balance: startingBalance,
+	}
+
+	var entries []LedgerEntry
+	if startingBalance != 0 {
+		entries = newTransaction(guildID, userID, startingBalance, Reason{Kind: Grant})
+	}
+
+	if err := s.walletRepo.Save(ctx, newWallet, entries); err != nil {
+		// Another request opened the wallet first.
+		if errors.Is(err, ErrWalletAlreadyExists) {
+			return s.walletRepo.GetByUserID(ctx, guildID, userID)
+		}
+		return nil, fmt.Errorf("failed to open wallet: %w", err)
+	}
+
+	return newWallet, nil
+}
+
+func (s *service) Debit(ctx context.Context, guildID, userID string, amount int64, reason Reason) error {
+	if amount <= 0 {
+		return ErrInvalidAmount
+	}
+
+	if _, err := s.getOrOpenWallet(ctx, guildID, userID); err != nil {
+		return err
+	}
+
+	if err := s.walletRepo.Debit(ctx, guildID, userID, amount, newTransaction(guildID, userID, -amount, reason)); err != nil {
+		return fmt.Errorf("failed to debit wallet: %w", err)
+	}
+
+	return nil
+}
+
+func (s *service) Credit(ctx context.Context, guildID, userID string, amount int64, reason Reason) error {
+	if amount <= 0 {
+		return ErrInvalidAmount
+	}
+
+	return s.adjust(ctx, guildID, userID, amount, reason)
+}
+
+func (s *service) Clawback(ctx context.Context, guildID, userID string, amount int64, reason Reason) error {
+	if amount <= 0 {
+		return ErrInvalidAmount
+	}
+
+	return s.adjust(ctx, guildID, userID, -amount, reason)
+}
+
+func (s *service) adjust(ctx context.Context, guildID, userID string, amount int64, reason Reason) error {
+	if _, err := s.getOrOpenWallet(ctx, guildID, userID); err != nil {
+		return err
+	}
+
+	if err := s.walletRepo.Adjust(ctx, guildID, userID, amount, newTransaction(guildID, userID, amount, reason)); err != nil {
+		return fmt.Errorf("failed to adjust wallet: %w", err)
+	}
+
+	return nil
+}
+
+// newTransaction records amount points moving into the user's account in the
+// guild. The other side of the transaction is the poll's account for movements
+// on a poll, and the house otherwise.
+func newTransaction(guildID, userID string, amount int64, reason Reason) []LedgerEntry {
+	counterAccount := HouseAccount
+	if reason.PollID != "" {
+		counterAccount = PollAccount(reason.PollID)
+	}
+
+	transactionID := uuid.NewString()
+	createdAt := time.Now()
+
+	entry := LedgerEntry{
+		TransactionID: transactionID,
+		GuildID:       guildID,
+		UserID:        userID,
+		PollID:        reason.PollID,
+		Kind:          reason.Kind,
+		Memo:          reason.Memo,
+		CreatedAt:     createdAt,
+	}
+
+	userEntry := entry
+	userEntry.Account = UserAccount(guildID, userID)
+	userEntry.Amount = amount
+
+	counterEntry := entry
+	counterEntry.Account = counterAccount
+	counterEntry.Amount = -amount
+
+	return []LedgerEntry{userEntry, counterEntry}
+}
+
+func (s *service) GetLedger(ctx context.Context, userID string) ([]LedgerEntry, error) {
+	entries, err := s.walletRepo.GetEntriesByUserID(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get ledger entries: %w", err)
+	}
+
+	var userEntries []LedgerEntry
+	for _, entry := range entries {
+		if entry.Account == UserAccount(entry.GuildID, userID) {
+			userEntries = append(userEntries, entry)
+		}
+	}
+
+	return userEntries, nil
+}
+
+func (s *service) Reconcile(ctx context.Context) ([]Discrepancy, error) {
+	ledgerBalances, err := s.walletRepo.GetAccountBalances(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get ledger balances: %w", err)
+	}
+
+	var total int64
+	for _, balance := range ledgerBalances {
+		total += balance
+	}
+	if total != 0 {
+		return nil, fmt.Errorf("%w: off by %d points", ErrUnbalancedLedger, total)
+	}
+
+	wallets, err := s.walletRepo.GetAll(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get wallets: %w", err)
+	}
+
+	var discrepancies []Discrepancy
+	checked := make(map[string]bool, len(wallets))
+	for _, wallet := range wallets {
+		account := UserAccount(wallet.GuildID, wallet.UserID)
+		checked[account] = true
+
+		if ledgerBalance := ledgerBalances[account]; ledgerBalance != wallet.Balance {
+			discrepancies = append(discrepancies, Discrepancy{
+				GuildID:       wallet.GuildID,
+				UserID:        wallet.UserID,
+				Balance:       wallet.Balance,
+				LedgerBalance: ledgerBalance,
+			})
+		}
+	}
+
+	// Points booked to a user who has no wallet are missing from every balance.
+	for account, ledgerBalance := range ledgerBalances {
+		guildID, userID, isUserAccount := parseUserAccount(account)
+		if !isUserAccount || checked[account] || ledgerBalance == 0 {
+			continue
+		}
+		discrepancies = append(discrepancies, Discrepancy{
+			GuildID:       guildID,
+			UserID:        userID,
+			LedgerBalance: ledgerBalance,
+		})
+	}
+
+	sort.Slice(discrepancies, func(a, b int) bool {
+		if discrepancies[a].UserID != discrepancies[b].UserID {
+			return discrepancies[a].UserID < discrepancies[b].UserID
+		}
+		return discrepancies[a].GuildID < discrepancies[b].GuildID
+	})
+
+	return discrepancies, nil
+}
+
+var _ WalletService = (*service)(nil)
@@ -0,0 +1,291 @@
+package wallet
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+const testStartingBalance = 1000
+
+const testGuildID = "guild"
+
+func setupService(t *testing.T) WalletService {
+	t.Helper()
+
+	return NewService(NewMemoryRepository(), testStartingBalance)
+}
+
+func TestWalletOpensWithStartingBalance(t *testing.T) {
+	t.Parallel()
+	walletService := setupService(t)
+
+	wallet, err := walletService.GetWallet(t.Context(), testGuildID, "user")
+	if err != nil {
+		t.Fatal("GetWallet returned an unexpected error:", err)
+	}
+
+	if wallet.GetBalance() != testStartingBalance {
+		t.Errorf("Expected balance %d, but got %d", testStartingBalance, wallet.GetBalance())
+	}
+}
+
+func TestOpenWalletWithStartingBalance(t *testing.T) {
+	t.Parallel()
+	walletService := setupService(t)
+
+	wallet, err := walletService.OpenWallet(t.Context(), testGuildID, "user", 250)
+	if err != nil {
+		t.Fatal("OpenWallet returned an unexpected error:", err)
+	}
+	if wallet.GetBalance() != 250 {
+		t.Errorf("Expected balance 250, but got %d", wallet.GetBalance())
+	}
+
+	// An open wallet keeps its balance.
+	wallet, err = walletService.OpenWallet(t.Context(), testGuildID, "user", 500)
+	if err != nil {
+		t.Fatal("OpenWallet returned an unexpected error:", err)
+	}
+	if wallet.GetBalance() != 250 {
+		t.Errorf("Expected balance 250, but got %d", wallet.GetBalance())
+	}
+
+	ledger, err := walletService.GetLedger(t.Context(), "user")
+	if err != nil {
+		t.Fatal("GetLedger returned an unexpected error:", err)
+	}
+	if len(ledger) != 1 || ledger[0].Amount != 250 || ledger[0].Kind != Grant {
+		t.Errorf("Expected a single grant of 250 points, but got %+v", ledger)
+	}
+}
+
+func TestDebitAndCredit(t *testing.T) {
+	t.Parallel()
+	walletService := setupService(t)
+
+	if err := walletService.Debit(t.Context(), testGuildID, "user", 300, Reason{Kind: Stake, PollID: "poll"}); err != nil {
+		t.Fatal("Debit returned an unexpected error:", err)
+	}
+	if err := walletService.Credit(t.Context(), testGuildID, "user", 50, Reason{Kind: Payout, PollID: "poll"}); err != nil {
+		t.Fatal("Credit returned an unexpected error:", err)
+	}
+
+	wallet, err := walletService.GetWallet(t.Context(), testGuildID, "user")
+	if err != nil {
+		t.Fatal("GetWallet returned an unexpected error:", err)
+	}
+	if wallet.GetBalance() != testStartingBalance-300+50 {
+		t.Errorf("Expected balance %d, but got %d", testStartingBalance-300+50, wallet.GetBalance())
+	}
+}
+
+func TestDebitInsufficientBalance(t *testing.T) {
+	t.Parallel()
+	walletService := setupService(t)
+
+	err := walletService.Debit(t.Context(), testGuildID, "user", testStartingBalance+1, Reason{Kind: Stake, PollID: "poll"})
+
+	var insufficientBalance *InsufficientBalanceError
+	if !errors.As(err, &insufficientBalance) {
+		t.Fatalf("Expected an InsufficientBalanceError, but got '%v'", err)
+	}
+	if insufficientBalance.Balance != testStartingBalance {
+		t.Errorf("Expected reported balance %d, but got %d", testStartingBalance, insufficientBalance.Balance)
+	}
+}
+
+func TestClawbackCanOverdraw(t *testing.T) {
+	t.Parallel()
+	walletService := setupService(t)
+
+	if err := walletService.Clawback(t.Context(), testGuildID, "user", testStartingBalance+100, Reason{Kind: Adjustment}); err != nil {
+		t.Fatal("Clawback returned an unexpected error:", err)
+	}
+
+	wallet, err := walletService.GetWallet(t.Context(), testGuildID, "user")
+	if err != nil {
+		t.Fatal("GetWallet returned an unexpected error:", err)
+	}
+	if wallet.GetBalance() != -100 {
+		t.Errorf("Expected balance -100, but got %d", wallet.GetBalance())
+	}
+}
+
+func TestWalletsAreSeparatePerGuild(t *testing.T) {
+	t.Parallel()
+	walletService := setupService(t)
+
+	if err := walletService.Credit(t.Context(), testGuildID, "user", 500, Reason{Kind: Adjustment}); err != nil {
+		t.Fatal("Credit returned an unexpected error:", err)
+	}
+
+	err := walletService.Debit(t.Context(), "otherGuild", "user", testStartingBalance+500, Reason{Kind: Stake, PollID: "poll"})
+	var insufficientErr *InsufficientBalanceError
+	if !errors.As(err, &insufficientErr) {
+		t.Errorf("Expected points given in one guild not to be spendable in another, but got '%v'", err)
+	}
+
+	other, err := walletService.GetWallet(t.Context(), "otherGuild", "user")
+	if err != nil {
+		t.Fatal("GetWallet returned an unexpected error:", err)
+	}
+	if other.GetBalance() != testStartingBalance || other.GetGuildID() != "otherGuild" {
+		t.Errorf("Expected a wallet of %d points in the other guild, but got %d in %q", testStartingBalance, other.GetBalance(), other.GetGuildID())
+	}
+
+	entries, err := walletService.GetLedger(t.Context(), "user")
+	if err != nil {
+		t.Fatal("GetLedger returned an unexpected error:", err)
+	}
+	if balance := ReplayBalance(entries, UserAccount(testGuildID, "user")); balance != testStartingBalance+500 {
+		t.Errorf("Expected the ledger to hold %d points in the first guild, but got %d", testStartingBalance+500, balance)
+	}
+	if balance := ReplayBalance(entries, UserAccount("otherGuild", "user")); balance != testStartingBalance {
+		t.Errorf("Expected the ledger to hold %d points in the other guild, but got %d", testStartingBalance, balance)
+	}
+}
+
+func TestGetWallets(t *testing.T) {
+	t.Parallel()
+	walletService := setupService(t)
+
+	for _, guildID := range []string{testGuildID, "otherGuild"} {
+		if _, err := walletService.GetWallet(t.Context(), guildID, "user"); err != nil {
+			t.Fatal("GetWallet returned an unexpected error:", err)
+		}
+	}
+
+	wallets, err := walletService.GetWallets(t.Context(), "user")
+	if err != nil {
+		t.Fatal("GetWallets returned an unexpected error:", err)
+	}
+	if len(wallets) != 2 {
+		t.Errorf("Expected a wallet in each guild, but got %d wallets", len(wallets))
+	}
+
+	wallets, err = walletService.GetWallets(t.Context(), "newcomer")
+	if err != nil {
+		t.Fatal("GetWallets returned an unexpected error:", err)
+	}
+	if len(wallets) != 0 {
+		t.Errorf("Expected no wallet to be opened, but got %d wallets", len(wallets))
+	}
+}
+
+func TestInvalidAmounts(t *testing.T) {
+	t.Parallel()
+	walletService := setupService(t)
+
+	operations := map[string]func(ctx context.Context, guildID, userID string, amount int64, reason Reason) error{
+		"Debit":    walletService.Debit,
+		"Credit":   walletService.Credit,
+		"Clawback": walletService.Clawback,
+	}
+
+	for name, operation := range operations {
+		for _, amount := range []int64{0, -10} {
+			if err := operation(t.Context(), testGuildID, "user", amount, Reason{Kind: Adjustment}); !errors.Is(err, ErrInvalidAmount) {
+				t.Errorf("Expected %s(%d) to return '%v', but got '%v'", name, amount, ErrInvalidAmount, err)
+			}
+		}
+	}
+}
+
+func TestLedgerRecordsEveryMovement(t *testing.T) {
+	t.Parallel()
+	walletService := setupService(t)
+
+	if err := walletService.Debit(t.Context(), testGuildID, "user", 200, Reason{Kind: Stake, PollID: "poll"}); err != nil {
+		t.Fatal("Debit returned an unexpected error:", err)
+	}
+	if err := walletService.Credit(t.Context(), testGuildID, "user", 350, Reason{Kind: Payout, PollID: "poll"}); err != nil {
+		t.Fatal("Credit returned an unexpected error:", err)
+	}
+	if err := walletService.Clawback(t.Context(), testGuildID, "user", 25, Reason{Kind: Adjustment, Memo: "duplicate payout"}); err != nil {
+		t.Fatal("Clawback returned an unexpected error:", err)
+	}
+
+	entries, err := walletService.GetLedger(t.Context(), "user")
+	if err != nil {
+		t.Fatal("GetLedger returned an unexpected error:", err)
+	}
+
+	expected := []struct {
+		kind   EntryKind
+		amount int64
+	}{
+		{Grant, testStartingBalance},
+		{Stake, -200},
+		{Payout, 350},
+		{Adjustment, -25},
+	}
+	if len(entries) != len(expected) {
+		t.Fatalf("Expected %d ledger entries, but got %d", len(expected), len(entries))
+	}
+	for index, entry := range entries {
+		if entry.Kind != expected[index].kind || entry.Amount != expected[index].amount {
+			t.Errorf("Expected a %s of %d, but got a %s of %d", expected[index].kind, expected[index].amount, entry.Kind, entry.Amount)
+		}
+	}
+
+	wallet, err := walletService.GetWallet(t.Context(), testGuildID, "user")
+	if err != nil {
+		t.Fatal("GetWallet returned an unexpected error:", err)
+	}
+	if replayed := ReplayBalance(entries, UserAccount(testGuildID, "user")); replayed != wallet.GetBalance() {
+		t.Errorf("Expected the replayed balance %d to match the wallet balance %d", replayed, wallet.GetBalance())
+	}
+}
+
+func TestReconcile(t *testing.T) {
+	t.Parallel()
+	walletRepo := NewMemoryRepository()
+	walletService := NewService(walletRepo, testStartingBalance)
+
+	if err := walletService.Debit(t.Context(), testGuildID, "honest", 100, Reason{Kind: Stake, PollID: "poll"}); err != nil {
+		t.Fatal("Debit returned an unexpected error:", err)
+	}
+
+	discrepancies, err := walletService.Reconcile(t.Context())
+	if err != nil {
+		t.Fatal("Reconcile returned an unexpected error:", err)
+	}
+	if len(discrepancies) != 0 {
+		t.Fatalf("Expected no discrepancies, but got %+v", discrepancies)
+	}
+
+	// A balance change that skips the ledger.
+	if err := walletRepo.Adjust(t.Context(), testGuildID, "honest", 5, nil); err != nil {
+		t.Fatal("Adjust returned an unexpected error:", err)
+	}
+
+	discrepancies, err = walletService.Reconcile(t.Context())
+	if err != nil {
+		t.Fatal("Reconcile returned an unexpected error:", err)
+	}
+	expected := Discrepancy{GuildID: testGuildID, UserID: "honest", Balance: testStartingBalance - 95, LedgerBalance: testStartingBalance - 100}
+	if len(discrepancies) != 1 || discrepancies[0] != expected {
+		t.Errorf("Expected discrepancies %+v, but got %+v", []Discrepancy{expected}, discrepancies)
+	}
+}
+
+func TestReconcileUnbalancedLedger(t *testing.T) {
+	t.Parallel()
+	walletRepo := NewMemoryRepository()
+	walletService := NewService(walletRepo, testStartingBalance)
+
+	if _, err := walletService.GetWallet(t.Context(), testGuildID, "user"); err != nil {
+		t.Fatal("GetWallet returned an unexpected error:", err)
+	}
+
+	// Only one side of a transaction was written.
+	oneSided := newTransaction(testGuildID, "user", 10, Reason{Kind: Adjustment})[:1]
+	if err := walletRepo.Adjust(t.Context(), testGuildID, "user", 10, oneSided); err != nil {
+		t.Fatal("Adjust returned an unexpected error:", err)
+	}
+
+	if _, err := walletService.Reconcile(t.Context()); !errors.Is(err, ErrUnbalancedLedger) {
+		t.Errorf("Expected error '%v', but got '%v'", ErrUnbalancedLedger, err)
+	}
+}
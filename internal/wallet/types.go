@@ -0,0 +1,130 @@
+package wallet
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// wallet holds a user's points in one guild. Points cannot move between
+// guilds, so that what a guild grants can only be spent in that guild.
+type wallet struct {
+	GuildID string
+	UserID  string
+	Balance int64
+}
+
+type Wallet interface {
+	GetGuildID() string
+	GetUserID() string
+	GetBalance() int64
+}
+
+func (w *wallet) GetGuildID() string { return w.GuildID }
+func (w *wallet) GetUserID() string  { return w.UserID }
+func (w *wallet) GetBalance() int64  { return w.Balance }
+
+// InsufficientBalanceError is returned when a wallet cannot cover a debit.
+type InsufficientBalanceError struct {
+	Balance int64
+	Amount  int64
+}
+
+func (e *InsufficientBalanceError) Error() string {
+	return fmt.Sprintf("insufficient balance: have %d points, need %d", e.Balance, e.Amount)
+}
+
+// EntryKind says why points moved.
+type EntryKind string
+
+const (
+	// Grant is the starting balance given when a wallet is opened.
+	Grant      EntryKind = "GRANT"
+	Stake      EntryKind = "STAKE"
+	Payout     EntryKind = "PAYOUT"
+	Refund     EntryKind = "REFUND"
+	Adjustment EntryKind = "ADJUSTMENT"
+	// Transfer moves a balance between two accounts of the same user, such as
+	// from a wallet opened before wallets were scoped to a guild into that
+	// guild.
+	Transfer EntryKind = "TRANSFER"
+)
+
+// HouseAccount is where granted points come from and where admin adjustments
+// are balanced against.
+const HouseAccount = "house"
+
+// UserAccount is the ledger account holding a user's balance in a guild.
+// Wallets opened before wallets were scoped to a guild have no guild, and keep
+// the account they had.
+func UserAccount(guildID, userID string) string {
+	if guildID == "" {
+		return "user:" + userID
+	}
+	return "user:" + guildID + ":" + userID
+}
+
+// parseUserAccount returns the guild and user of a UserAccount, and false for
+// every other account.
+func parseUserAccount(account string) (guildID, userID string, ok bool) {
+	rest, ok := strings.CutPrefix(account, "user:")
+	if !ok {
+		return "", "", false
+	}
+	if guildID, userID, scoped := strings.Cut(rest, ":"); scoped {
+		return guildID, userID, true
+	}
+	return "", rest, true
+}
+
+// PollAccount is the ledger account holding the points staked on a poll until
+// they are paid out or refunded.
+func PollAccount(pollID string) string { return "poll:" + pollID }
+
+// Reason describes a point movement for the ledger.
+type Reason struct {
+	Kind EntryKind
+	// PollID is the poll the points moved for, if any. Movements for a poll are
+	// balanced against the poll's account, all others against the house.
+	PollID string
+	Memo   string
+}
+
+// LedgerEntry is one side of a double-entry ledger transaction. Every
+// transaction has two entries whose amounts add up to zero, and entries are
+// never changed or removed once written.
+type LedgerEntry struct {
+	ID            int64
+	TransactionID string
+	Account       string
+	// GuildID, UserID and PollID are the guild, user and poll the transaction
+	// is about, and are set on both of its entries.
+	GuildID string
+	UserID  string
+	PollID  string
+	Kind    EntryKind
+	// Amount is added to the account's balance, so it is negative when points
+	// leave the account.
+	Amount    int64
+	Memo      string
+	CreatedAt time.Time
+}
+
+// Discrepancy is a wallet whose balance does not match its ledger.
+type Discrepancy struct {
+	GuildID       string
+	UserID        string
+	Balance       int64
+	LedgerBalance int64
+}
+
+// ReplayBalance adds up the entries of one account to derive its balance.
+func ReplayBalance(entries []LedgerEntry, account string) int64 {
+	var balance int64
+	for _, entry := range entries {
+		if entry.Account == account {
+			balance += entry.Amount
+		}
+	}
+	return balance
+}